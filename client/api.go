@@ -10,9 +10,12 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
 	"time"
 
+	"github.com/mattermost/rtcd/service/rtc/dc"
+
 	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v4"
 )
@@ -77,7 +80,7 @@ func (c *Client) StartScreenShare(tracks []webrtc.TrackLocal) (*webrtc.RTPTransc
 		return nil, fmt.Errorf("invalid empty tracks")
 	}
 
-	if len(tracks) > 2 {
+	if len(tracks) > 3 {
 		return nil, fmt.Errorf("too many tracks")
 	}
 
@@ -107,8 +110,8 @@ func (c *Client) StartScreenShare(tracks []webrtc.TrackLocal) (*webrtc.RTPTransc
 	}
 
 	// Simulcast
-	if len(tracks) > 1 {
-		if err := trx.Sender().AddEncoding(tracks[1]); err != nil {
+	for _, track := range tracks[1:] {
+		if err := trx.Sender().AddEncoding(track); err != nil {
 			return nil, fmt.Errorf("failed to add encoding: %w", err)
 		}
 	}
@@ -116,43 +119,44 @@ func (c *Client) StartScreenShare(tracks []webrtc.TrackLocal) (*webrtc.RTPTransc
 	c.screenTransceivers = append(c.screenTransceivers, trx)
 
 	sender := trx.Sender()
-
-	rtcpHandler := func(rid string) {
-		defer c.log.Debug("exiting RTCP handler")
-		var n int
-		var err error
-		rtcpBuf := make([]byte, receiveMTU)
-		for {
-			if rid != "" {
-				n, _, err = sender.ReadSimulcast(rtcpBuf, rid)
-			} else {
-				n, _, err = sender.Read(rtcpBuf)
-			}
-			if err != nil {
-				if !errors.Is(err, io.EOF) {
-					c.log.Error("failed to read RTCP packet", slog.String("err", err.Error()))
-				}
-				return
-			}
-			if pkts, err := rtcp.Unmarshal(rtcpBuf[:n]); err != nil {
-				c.log.Error("failed to unmarshal RTCP packet", slog.String("err", err.Error()))
-			} else {
-				c.emit(RTCSenderRTCPPacketEvent, map[string]any{
-					"pkts":   pkts,
-					"rid":    rid,
-					"sender": sender,
-				})
-			}
-		}
-	}
-
 	for _, track := range tracks {
-		go rtcpHandler(track.RID())
+		go c.handleSenderRTCP(sender, track.RID())
 	}
 
 	return trx, nil
 }
 
+// handleSenderRTCP reads the RTCP packets received for the given video sender,
+// emitting a RTCSenderRTCPPacketEvent for each of them.
+func (c *Client) handleSenderRTCP(sender *webrtc.RTPSender, rid string) {
+	defer c.log.Debug("exiting RTCP handler")
+	var n int
+	var err error
+	rtcpBuf := make([]byte, receiveMTU)
+	for {
+		if rid != "" {
+			n, _, err = sender.ReadSimulcast(rtcpBuf, rid)
+		} else {
+			n, _, err = sender.Read(rtcpBuf)
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				c.log.Error("failed to read RTCP packet", slog.String("err", err.Error()))
+			}
+			return
+		}
+		if pkts, err := rtcp.Unmarshal(rtcpBuf[:n]); err != nil {
+			c.log.Error("failed to unmarshal RTCP packet", slog.String("err", err.Error()))
+		} else {
+			c.emit(RTCSenderRTCPPacketEvent, map[string]any{
+				"pkts":   pkts,
+				"rid":    rid,
+				"sender": sender,
+			})
+		}
+	}
+}
+
 func (c *Client) StopScreenShare() error {
 	c.mut.Lock()
 	defer c.mut.Unlock()
@@ -168,6 +172,165 @@ func (c *Client) StopScreenShare() error {
 	return c.sendWS(wsEventScreenOff, nil, false)
 }
 
+// StartVideo starts sending the given camera tracks. Passing more than one
+// track is not supported yet, the camera is sent as a single layer.
+func (c *Client) StartVideo(tracks []webrtc.TrackLocal) (*webrtc.RTPTransceiver, error) {
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("invalid empty tracks")
+	}
+
+	if len(tracks) > 1 {
+		return nil, fmt.Errorf("too many tracks")
+	}
+
+	data, err := json.Marshal(map[string]string{
+		"videoStreamID": tracks[0].StreamID(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if c.pc == nil {
+		return nil, fmt.Errorf("rtc client is not initialized")
+	}
+
+	if err := c.sendWS(wsEventVideoOn, map[string]any{
+		"data": string(data),
+	}, false); err != nil {
+		return nil, fmt.Errorf("failed to send video on event: %w", err)
+	}
+
+	trx, err := c.pc.AddTransceiverFromTrack(tracks[0], webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendonly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add transceiver for track: %w", err)
+	}
+
+	c.videoTransceivers = append(c.videoTransceivers, trx)
+
+	go c.handleSenderRTCP(trx.Sender(), tracks[0].RID())
+
+	return trx, nil
+}
+
+func (c *Client) StopVideo() error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for _, trx := range c.videoTransceivers {
+		if err := c.pc.RemoveTrack(trx.Sender()); err != nil {
+			return fmt.Errorf("failed to remove track: %w", err)
+		}
+	}
+
+	c.videoTransceivers = nil
+
+	return c.sendWS(wsEventVideoOff, nil, false)
+}
+
+// SetPreferredLayer sends the preferred simulcast level (SimulcastLevelHigh,
+// SimulcastLevelMid or SimulcastLevelLow) for the received video tracks
+// through the data channel.
+func (c *Client) SetPreferredLayer(level string) error {
+	if level != SimulcastLevelHigh && level != SimulcastLevelMid && level != SimulcastLevelLow {
+		return fmt.Errorf("invalid simulcast level %q", level)
+	}
+
+	dataCh := c.dc.Load()
+	if dataCh == nil || dataCh.ReadyState() != webrtc.DataChannelStateOpen {
+		return fmt.Errorf("data channel is not open")
+	}
+
+	msg, err := dc.EncodeMessage(dc.MessageTypePreferredSimulcastLevel, level)
+	if err != nil {
+		return fmt.Errorf("failed to encode dc message: %w", err)
+	}
+
+	return dataCh.Send(msg)
+}
+
+// SetPreferredSourceLayer sends the preferred simulcast level (SimulcastLevelHigh,
+// SimulcastLevelMid or SimulcastLevelLow) for the video tracks received from the given session
+// through the data channel. This takes precedence over SetPreferredLayer.
+func (c *Client) SetPreferredSourceLayer(sessionID, level string) error {
+	if sessionID == "" {
+		return fmt.Errorf("invalid empty session ID")
+	}
+
+	if level != SimulcastLevelHigh && level != SimulcastLevelMid && level != SimulcastLevelLow {
+		return fmt.Errorf("invalid simulcast level %q", level)
+	}
+
+	dataCh := c.dc.Load()
+	if dataCh == nil || dataCh.ReadyState() != webrtc.DataChannelStateOpen {
+		return fmt.Errorf("data channel is not open")
+	}
+
+	msg, err := dc.EncodeMessage(dc.MessageTypeSourceSimulcastLevel, dc.MessageSourceSimulcastLevel{
+		SessionID: sessionID,
+		Level:     level,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode dc message: %w", err)
+	}
+
+	return dataCh.Send(msg)
+}
+
+// StopReceiving stops receiving tracks from the given session (e.g. a blocked
+// user) without leaving the call. The receivers for the session are stopped
+// locally and the server is asked, through the data channel, to stop
+// forwarding the session's tracks.
+func (c *Client) StopReceiving(sessionID string) error {
+	if sessionID == "" {
+		return fmt.Errorf("invalid empty session ID")
+	}
+
+	if sessionID == c.originalConnID {
+		return fmt.Errorf("cannot stop receiving from own session")
+	}
+
+	dataCh := c.dc.Load()
+	if dataCh == nil || dataCh.ReadyState() != webrtc.DataChannelStateOpen {
+		return fmt.Errorf("data channel is not open")
+	}
+
+	msg, err := dc.EncodeMessage(dc.MessageTypeStopReceiving, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to encode dc message: %w", err)
+	}
+
+	c.mut.Lock()
+	c.stoppedSources[sessionID] = true
+	c.stopReceivers(sessionID)
+	c.mut.Unlock()
+	c.forgetTrack(TrackTypeVoice, sessionID)
+	c.forgetTrack(TrackTypeScreen, sessionID)
+	c.forgetTrack(TrackTypeVideo, sessionID)
+
+	return dataCh.Send(msg)
+}
+
+// IsVideoPaused returns whether video publishing is currently paused due to
+// low bandwidth. Video packets written while paused are dropped so callers
+// may as well skip encoding in the meantime.
+func (c *Client) IsVideoPaused() bool {
+	return c.videoPaused.Load()
+}
+
+// MediaMap returns the latest media map received from the server, mapping the
+// MIDs of the transceivers receiving media to the tracks they carry. This
+// allows to match a receiver to its sender before any media is received.
+func (c *Client) MediaMap() map[string]TrackInfo {
+	mediaMap := c.mediaMap.Load()
+	if mediaMap == nil {
+		return map[string]TrackInfo{}
+	}
+	return maps.Clone(*mediaMap)
+}
+
 func (c *Client) RaiseHand() error {
 	return c.SendWS(wsEventRaiseHand, nil, false)
 }
@@ -176,6 +339,26 @@ func (c *Client) LowerHand() error {
 	return c.SendWS(wsEventLowerHand, nil, false)
 }
 
+// SendReaction sends an emoji reaction to the call. emoji is the short name
+// of the emoji (e.g. "+1") and unified its unified code point (e.g. "1F44D").
+func (c *Client) SendReaction(emoji string, unified string) error {
+	if emoji == "" {
+		return fmt.Errorf("invalid empty emoji")
+	}
+
+	data, err := json.Marshal(emojiData{
+		Name:    emoji,
+		Unified: unified,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	return c.SendWS(wsEventReact, map[string]any{
+		"data": string(data),
+	}, false)
+}
+
 func (c *Client) StartRecording() error {
 	ctx, cancel := context.WithTimeout(context.Background(), httpRequestTimeout)
 	defer cancel()
@@ -6,6 +6,7 @@ package client
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -340,6 +341,278 @@ func TestAPIMuteUnmuteNegotiation(t *testing.T) {
 	}
 }
 
+func TestAPIMediaMap(t *testing.T) {
+	th := setupTestHelper(t, "calls0")
+
+	// Setup
+	userConnectCh := make(chan struct{})
+	err := th.userClient.On(RTCConnectEvent, func(_ any) error {
+		close(userConnectCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	adminConnectCh := make(chan struct{})
+	err = th.adminClient.On(RTCConnectEvent, func(_ any) error {
+		close(adminConnectCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	mediaMapCh := make(chan map[string]TrackInfo, 10)
+	err = th.adminClient.On(RTCMediaMapEvent, func(ctx any) error {
+		mediaMapCh <- ctx.(map[string]TrackInfo)
+		return nil
+	})
+	require.NoError(t, err)
+
+	go func() {
+		err := th.userClient.Connect()
+		require.NoError(t, err)
+	}()
+
+	go func() {
+		err := th.adminClient.Connect()
+		require.NoError(t, err)
+	}()
+
+	select {
+	case <-userConnectCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for user connect event")
+	}
+
+	select {
+	case <-adminConnectCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for admin connect event")
+	}
+
+	// Test logic
+
+	userCloseCh := make(chan struct{})
+	adminCloseCh := make(chan struct{})
+
+	userVoiceTrack := th.newVoiceTrack()
+	err = th.userClient.Unmute(userVoiceTrack)
+	require.NoError(t, err)
+	go th.voiceTrackWriter(userVoiceTrack, userCloseCh)
+
+	findVoiceTrack := func(mediaMap map[string]TrackInfo) (string, bool) {
+		for mid, info := range mediaMap {
+			if info.SessionID == th.userClient.originalConnID && info.Type == TrackTypeVoice {
+				return mid, true
+			}
+		}
+		return "", false
+	}
+
+	// The map is expected to be received along with the negotiation adding
+	// the user's voice track.
+	var mid string
+	require.Eventually(t, func() bool {
+		var ok bool
+		mid, ok = findVoiceTrack(th.adminClient.MediaMap())
+		return ok
+	}, waitTimeout, 100*time.Millisecond)
+
+	received := false
+	for !received {
+		select {
+		case mediaMap := <-mediaMapCh:
+			_, received = findVoiceTrack(mediaMap)
+		case <-time.After(waitTimeout):
+			require.Fail(t, "timed out waiting for media map event")
+		}
+	}
+
+	// The MID should identify the transceiver receiving the track.
+	require.Eventually(t, func() bool {
+		for _, tr := range th.adminClient.pc.GetTransceivers() {
+			if tr.Mid() == mid {
+				track := tr.Receiver().Track()
+				return track != nil && track.ID() == th.adminClient.MediaMap()[mid].TrackID
+			}
+		}
+		return false
+	}, waitTimeout, 100*time.Millisecond)
+
+	// Teardown
+
+	err = th.userClient.On(CloseEvent, func(_ any) error {
+		close(userCloseCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = th.adminClient.On(CloseEvent, func(_ any) error {
+		close(adminCloseCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	go func() {
+		err := th.userClient.Close()
+		require.NoError(t, err)
+	}()
+
+	go func() {
+		err := th.adminClient.Close()
+		require.NoError(t, err)
+	}()
+
+	select {
+	case <-userCloseCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for close event")
+	}
+
+	select {
+	case <-adminCloseCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for close event")
+	}
+
+	require.Empty(t, th.adminClient.MediaMap())
+}
+
+func TestAPIStopReceiving(t *testing.T) {
+	th := setupTestHelper(t, "calls0")
+
+	// Setup
+	userConnectCh := make(chan struct{})
+	err := th.userClient.On(RTCConnectEvent, func(_ any) error {
+		close(userConnectCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	adminConnectCh := make(chan struct{})
+	err = th.adminClient.On(RTCConnectEvent, func(_ any) error {
+		close(adminConnectCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	t.Run("not initialized", func(t *testing.T) {
+		err := th.adminClient.StopReceiving("sessionID")
+		require.EqualError(t, err, "data channel is not open")
+	})
+
+	go func() {
+		err := th.userClient.Connect()
+		require.NoError(t, err)
+	}()
+
+	go func() {
+		err := th.adminClient.Connect()
+		require.NoError(t, err)
+	}()
+
+	select {
+	case <-userConnectCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for user connect event")
+	}
+
+	select {
+	case <-adminConnectCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for admin connect event")
+	}
+
+	// Test logic
+
+	userCloseCh := make(chan struct{})
+	adminCloseCh := make(chan struct{})
+
+	t.Run("invalid session", func(t *testing.T) {
+		err := th.adminClient.StopReceiving("")
+		require.EqualError(t, err, "invalid empty session ID")
+
+		err = th.adminClient.StopReceiving(th.adminClient.originalConnID)
+		require.EqualError(t, err, "cannot stop receiving from own session")
+	})
+
+	var packetsReceived atomic.Int64
+	adminTrackCh := make(chan struct{})
+	err = th.adminClient.On(RTCTrackEvent, func(ctx any) error {
+		m := ctx.(map[string]any)
+		track := m["track"].(*webrtc.TrackRemote)
+		go func() {
+			for {
+				if _, _, err := track.ReadRTP(); err != nil {
+					return
+				}
+				packetsReceived.Add(1)
+			}
+		}()
+		close(adminTrackCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// User unmutes, admin should receive the track
+	userVoiceTrack := th.newVoiceTrack()
+	err = th.userClient.Unmute(userVoiceTrack)
+	require.NoError(t, err)
+	go th.voiceTrackWriter(userVoiceTrack, userCloseCh)
+
+	select {
+	case <-adminTrackCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for admin client to receive track")
+	}
+
+	require.Eventually(t, func() bool {
+		return packetsReceived.Load() > 0
+	}, waitTimeout, 50*time.Millisecond)
+
+	// Admin stops receiving from user, no further packets should arrive.
+	err = th.adminClient.StopReceiving(th.userClient.originalConnID)
+	require.NoError(t, err)
+
+	time.Sleep(200 * time.Millisecond)
+	count := packetsReceived.Load()
+	time.Sleep(time.Second)
+	require.Equal(t, count, packetsReceived.Load())
+
+	// Teardown
+	err = th.userClient.On(CloseEvent, func(_ any) error {
+		close(userCloseCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = th.adminClient.On(CloseEvent, func(_ any) error {
+		close(adminCloseCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	go func() {
+		err := th.userClient.Close()
+		require.NoError(t, err)
+	}()
+
+	go func() {
+		err := th.adminClient.Close()
+		require.NoError(t, err)
+	}()
+
+	select {
+	case <-userCloseCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for close event")
+	}
+
+	select {
+	case <-adminCloseCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for close event")
+	}
+}
+
 func TestAPIRaiseLowerHand(t *testing.T) {
 	th := setupTestHelper(t, "calls0")
 
@@ -400,55 +673,180 @@ func TestAPIRaiseLowerHand(t *testing.T) {
 		}
 		return nil
 	})
-	require.NoError(t, err)
+	require.NoError(t, err)
+
+	err = th.adminClient.On(WSCallRaisedHandEvent, func(ctx any) error {
+		sessionID := ctx.(string)
+		if sessionID == th.userClient.originalConnID {
+			close(userRaisedHandCh)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	err = th.adminClient.On(WSCallLoweredHandEvent, func(ctx any) error {
+		sessionID := ctx.(string)
+		if sessionID == th.userClient.originalConnID {
+			close(userLoweredHandCh)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = th.userClient.RaiseHand()
+	require.NoError(t, err)
+	select {
+	case <-userRaisedHandCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for user raised hand event")
+	}
+
+	err = th.userClient.LowerHand()
+	require.NoError(t, err)
+	select {
+	case <-userLoweredHandCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for user lowered hand event")
+	}
+
+	err = th.adminClient.RaiseHand()
+	require.NoError(t, err)
+	select {
+	case <-adminRaisedHandCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for admin raised hand event")
+	}
+
+	err = th.adminClient.LowerHand()
+	require.NoError(t, err)
+	select {
+	case <-adminLoweredHandCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for admin lowered hand event")
+	}
+
+	// Teardown
+
+	userCloseCh := make(chan struct{})
+	adminCloseCh := make(chan struct{})
+
+	err = th.userClient.On(CloseEvent, func(_ any) error {
+		close(userCloseCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = th.adminClient.On(CloseEvent, func(_ any) error {
+		close(adminCloseCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	go func() {
+		err := th.userClient.Close()
+		require.NoError(t, err)
+	}()
+
+	go func() {
+		err := th.adminClient.Close()
+		require.NoError(t, err)
+	}()
+
+	select {
+	case <-userCloseCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for close event")
+	}
+
+	select {
+	case <-adminCloseCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for close event")
+	}
+}
+
+func TestAPIReaction(t *testing.T) {
+	th := setupTestHelper(t, "calls0")
+
+	// Setup
+	userConnectCh := make(chan struct{})
+	err := th.userClient.On(RTCConnectEvent, func(_ any) error {
+		close(userConnectCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	adminConnectCh := make(chan struct{})
+	err = th.adminClient.On(RTCConnectEvent, func(_ any) error {
+		close(adminConnectCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	go func() {
+		err := th.userClient.Connect()
+		require.NoError(t, err)
+	}()
+
+	go func() {
+		err := th.adminClient.Connect()
+		require.NoError(t, err)
+	}()
+
+	select {
+	case <-userConnectCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for user connect event")
+	}
+
+	select {
+	case <-adminConnectCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for admin connect event")
+	}
+
+	t.Run("empty emoji", func(t *testing.T) {
+		err := th.userClient.SendReaction("", "")
+		require.EqualError(t, err, "invalid empty emoji")
+	})
 
-	err = th.adminClient.On(WSCallRaisedHandEvent, func(ctx any) error {
-		sessionID := ctx.(string)
-		if sessionID == th.userClient.originalConnID {
-			close(userRaisedHandCh)
+	adminReactionCh := make(chan CallReaction, 1)
+	err = th.adminClient.On(WSCallReactionEvent, func(ctx any) error {
+		reaction := ctx.(CallReaction)
+		if reaction.SessionID == th.userClient.originalConnID {
+			adminReactionCh <- reaction
 		}
 		return nil
 	})
 	require.NoError(t, err)
-	err = th.adminClient.On(WSCallLoweredHandEvent, func(ctx any) error {
-		sessionID := ctx.(string)
-		if sessionID == th.userClient.originalConnID {
-			close(userLoweredHandCh)
+
+	userReactionCh := make(chan CallReaction, 1)
+	err = th.userClient.On(WSCallReactionEvent, func(ctx any) error {
+		reaction := ctx.(CallReaction)
+		if reaction.SessionID == th.adminClient.originalConnID {
+			userReactionCh <- reaction
 		}
 		return nil
 	})
 	require.NoError(t, err)
 
-	err = th.userClient.RaiseHand()
-	require.NoError(t, err)
-	select {
-	case <-userRaisedHandCh:
-	case <-time.After(waitTimeout):
-		require.Fail(t, "timed out waiting for user raised hand event")
-	}
-
-	err = th.userClient.LowerHand()
-	require.NoError(t, err)
-	select {
-	case <-userLoweredHandCh:
-	case <-time.After(waitTimeout):
-		require.Fail(t, "timed out waiting for user lowered hand event")
-	}
-
-	err = th.adminClient.RaiseHand()
+	err = th.userClient.SendReaction("+1", "1F44D")
 	require.NoError(t, err)
 	select {
-	case <-adminRaisedHandCh:
+	case reaction := <-adminReactionCh:
+		require.Equal(t, "+1", reaction.EmojiName)
+		require.Equal(t, "1F44D", reaction.EmojiUnified)
 	case <-time.After(waitTimeout):
-		require.Fail(t, "timed out waiting for admin raised hand event")
+		require.Fail(t, "timed out waiting for user reaction event")
 	}
 
-	err = th.adminClient.LowerHand()
+	err = th.adminClient.SendReaction("tada", "1F389")
 	require.NoError(t, err)
 	select {
-	case <-adminLoweredHandCh:
+	case reaction := <-userReactionCh:
+		require.Equal(t, "tada", reaction.EmojiName)
+		require.Equal(t, "1F389", reaction.EmojiUnified)
 	case <-time.After(waitTimeout):
-		require.Fail(t, "timed out waiting for admin lowered hand event")
+		require.Fail(t, "timed out waiting for admin reaction event")
 	}
 
 	// Teardown
@@ -787,6 +1185,126 @@ func TestAPIScreenShareAV1(t *testing.T) {
 	}
 }
 
+func TestAPIVideo(t *testing.T) {
+	th := setupTestHelper(t, "calls0")
+
+	// Setup
+	userConnectCh := make(chan struct{})
+	err := th.userClient.On(RTCConnectEvent, func(_ any) error {
+		close(userConnectCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	adminConnectCh := make(chan struct{})
+	err = th.adminClient.On(RTCConnectEvent, func(_ any) error {
+		close(adminConnectCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	t.Run("not initialized", func(t *testing.T) {
+		_, err := th.userClient.StartVideo([]webrtc.TrackLocal{th.newVideoTrack(webrtc.MimeTypeVP8)})
+		require.EqualError(t, err, "rtc client is not initialized")
+	})
+
+	t.Run("too many tracks", func(t *testing.T) {
+		_, err := th.userClient.StartVideo([]webrtc.TrackLocal{th.newVideoTrack(webrtc.MimeTypeVP8), th.newVideoTrack(webrtc.MimeTypeVP8)})
+		require.EqualError(t, err, "too many tracks")
+	})
+
+	go func() {
+		err := th.userClient.Connect()
+		require.NoError(t, err)
+	}()
+
+	go func() {
+		err := th.adminClient.Connect()
+		require.NoError(t, err)
+	}()
+
+	select {
+	case <-userConnectCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for user connect event")
+	}
+
+	select {
+	case <-adminConnectCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for admin connect event")
+	}
+
+	userCloseCh := make(chan struct{})
+	adminCloseCh := make(chan struct{})
+
+	// Test logic
+
+	// User turns the camera on, admin should receive the track
+	videoTrackCh := make(chan struct{})
+	err = th.adminClient.On(RTCTrackEvent, func(ctx any) error {
+		m := ctx.(map[string]any)
+		track := m["track"].(*webrtc.TrackRemote)
+		trackType, sessionID, err := ParseTrackID(track.ID())
+		require.NoError(t, err)
+		if trackType == TrackTypeVideo && sessionID == th.userClient.originalConnID {
+			close(videoTrackCh)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	userVideoTrack := th.newVideoTrack(webrtc.MimeTypeVP8)
+	_, err = th.userClient.StartVideo([]webrtc.TrackLocal{userVideoTrack})
+	require.NoError(t, err)
+	go th.screenTrackWriter(userVideoTrack, userCloseCh)
+
+	select {
+	case <-videoTrackCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for video track")
+	}
+
+	err = th.userClient.StopVideo()
+	require.NoError(t, err)
+
+	// Teardown
+
+	err = th.userClient.On(CloseEvent, func(_ any) error {
+		close(userCloseCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = th.adminClient.On(CloseEvent, func(_ any) error {
+		close(adminCloseCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	go func() {
+		err := th.userClient.Close()
+		require.NoError(t, err)
+	}()
+
+	go func() {
+		err := th.adminClient.Close()
+		require.NoError(t, err)
+	}()
+
+	select {
+	case <-userCloseCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for close event")
+	}
+
+	select {
+	case <-adminCloseCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for close event")
+	}
+}
+
 func TestAPIConcurrency(t *testing.T) {
 	t.Run("Mute/Unmute", func(t *testing.T) {
 		th := setupTestHelper(t, "calls0")
@@ -1187,3 +1705,132 @@ func TestAPIScreenSharePLI(t *testing.T) {
 
 	require.Equal(t, 1, pliCount)
 }
+
+func TestAPIScreenShareDisableAutoPLI(t *testing.T) {
+	th := setupTestHelper(t, "calls0")
+	th.userClient.cfg.DisableAutoPLI = true
+
+	// Setup
+	userConnectCh := make(chan struct{})
+	err := th.userClient.On(RTCConnectEvent, func(_ any) error {
+		close(userConnectCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	adminConnectCh := make(chan struct{})
+	err = th.adminClient.On(RTCConnectEvent, func(_ any) error {
+		close(adminConnectCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	go func() {
+		err := th.userClient.Connect()
+		require.NoError(t, err)
+	}()
+
+	go func() {
+		err := th.adminClient.Connect()
+		require.NoError(t, err)
+	}()
+
+	select {
+	case <-userConnectCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for user connect event")
+	}
+
+	select {
+	case <-adminConnectCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for admin connect event")
+	}
+
+	adminCloseCh := make(chan struct{})
+
+	// Test logic
+
+	var pliCount int
+	var mut sync.Mutex
+	err = th.adminClient.On(RTCSenderRTCPPacketEvent, func(ctx any) error {
+		m := ctx.(map[string]any)
+		for _, pkt := range m["pkts"].([]rtcp.Packet) {
+			if _, ok := pkt.(*rtcp.PictureLossIndication); ok {
+				mut.Lock()
+				pliCount++
+				mut.Unlock()
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	screenTrackCh := make(chan struct{})
+	err = th.userClient.On(RTCTrackEvent, func(ctx any) error {
+		track := ctx.(map[string]any)["track"].(*webrtc.TrackRemote)
+		if trackType, _, _ := ParseTrackID(track.ID()); trackType == TrackTypeScreen {
+			close(screenTrackCh)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	// admin screen shares, user should receive the track without requesting a keyframe.
+	adminScreenTrack := th.newScreenTrack(webrtc.MimeTypeVP8)
+	_, err = th.adminClient.StartScreenShare([]webrtc.TrackLocal{adminScreenTrack})
+	require.NoError(t, err)
+	go th.screenTrackWriter(adminScreenTrack, adminCloseCh)
+
+	select {
+	case <-screenTrackCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for screen track")
+	}
+
+	time.Sleep(2 * time.Second)
+
+	err = th.adminClient.StopScreenShare()
+	require.NoError(t, err)
+
+	// Teardown
+
+	userCloseCh := make(chan struct{})
+	err = th.userClient.On(CloseEvent, func(_ any) error {
+		close(userCloseCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = th.adminClient.On(CloseEvent, func(_ any) error {
+		close(adminCloseCh)
+		return nil
+	})
+	require.NoError(t, err)
+
+	go func() {
+		err := th.userClient.Close()
+		require.NoError(t, err)
+	}()
+
+	go func() {
+		err := th.adminClient.Close()
+		require.NoError(t, err)
+	}()
+
+	select {
+	case <-userCloseCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for close event")
+	}
+
+	select {
+	case <-adminCloseCh:
+	case <-time.After(waitTimeout):
+		require.Fail(t, "timed out waiting for close event")
+	}
+
+	mut.Lock()
+	defer mut.Unlock()
+	require.Zero(t, pliCount)
+}
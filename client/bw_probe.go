@@ -0,0 +1,105 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package client
+
+import (
+	"log/slog"
+	"time"
+)
+
+const (
+	// bwProbeDuration is the minimum duration of the probe.
+	bwProbeDuration = 3 * time.Second
+	// bwProbeMaxDuration is the maximum time the probe waits for enough
+	// estimations before giving up.
+	bwProbeMaxDuration = 10 * time.Second
+	// bwProbeMinSamples is the number of estimations needed for a result.
+	bwProbeMinSamples = 3
+	// bwProbeHighRate is the estimated downlink bandwidth, in bits per
+	// second, needed to request the high simulcast level. It matches the
+	// rate at which the server itself would switch to it.
+	bwProbeHighRate = 2_250_000
+)
+
+// bwProbe collects the downlink bandwidth estimations the server sends over
+// the data channel to decide which simulcast level can be sustained.
+type bwProbe struct {
+	log         *slog.Logger
+	duration    time.Duration
+	maxDuration time.Duration
+	samplesCh   chan int
+}
+
+func newBWProbe(log *slog.Logger, duration, maxDuration time.Duration) *bwProbe {
+	return &bwProbe{
+		log:         log,
+		duration:    duration,
+		maxDuration: maxDuration,
+		samplesCh:   make(chan int, bwProbeMinSamples),
+	}
+}
+
+// addSample feeds a bandwidth estimation, in bits per second, to the probe.
+// It never blocks: estimations received while the probe isn't keeping up
+// are dropped.
+func (p *bwProbe) addSample(rate int) {
+	select {
+	case p.samplesCh <- rate:
+	default:
+	}
+}
+
+// Run collects bandwidth estimations for at least the probe duration and
+// until enough of them are received, then returns the simulcast level the
+// client should request. It returns SimulcastLevelLow if not enough
+// estimations were received within the maximum duration, or early if stopCh
+// is closed.
+func (p *bwProbe) Run(stopCh <-chan struct{}) string {
+	p.log.Debug("starting bandwidth probe", slog.Duration("duration", p.duration))
+
+	minTimer := time.NewTimer(p.duration)
+	defer minTimer.Stop()
+	maxTimer := time.NewTimer(p.maxDuration)
+	defer maxTimer.Stop()
+
+	var samples []int
+	var minElapsed bool
+	for !minElapsed || len(samples) < bwProbeMinSamples {
+		select {
+		case rate := <-p.samplesCh:
+			samples = append(samples, rate)
+		case <-minTimer.C:
+			minElapsed = true
+		case <-maxTimer.C:
+			p.log.Debug("bandwidth probe timed out", slog.Int("samples", len(samples)))
+			return SimulcastLevelLow
+		case <-stopCh:
+			return SimulcastLevelLow
+		}
+	}
+
+	level := getProbeSimulcastLevel(samples)
+
+	p.log.Debug("bandwidth probe completed", slog.String("level", level), slog.Any("samples", samples))
+
+	return level
+}
+
+// getProbeSimulcastLevel returns the simulcast level that's sustainable given
+// the bandwidth estimations collected during the probe. The lowest of the
+// most recent ones is used so that a single spike doesn't count. We default
+// to the low level if not enough estimations were received.
+func getProbeSimulcastLevel(samples []int) string {
+	if len(samples) < bwProbeMinSamples {
+		return SimulcastLevelLow
+	}
+
+	for _, rate := range samples[len(samples)-bwProbeMinSamples:] {
+		if rate < bwProbeHighRate {
+			return SimulcastLevelLow
+		}
+	}
+
+	return SimulcastLevelHigh
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package client
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetProbeSimulcastLevel(t *testing.T) {
+	t.Run("no data", func(t *testing.T) {
+		require.Equal(t, SimulcastLevelLow, getProbeSimulcastLevel(nil))
+		require.Equal(t, SimulcastLevelLow, getProbeSimulcastLevel([]int{3_000_000, 3_000_000}))
+	})
+
+	t.Run("constrained", func(t *testing.T) {
+		require.Equal(t, SimulcastLevelLow, getProbeSimulcastLevel([]int{3_000_000, 1_000_000, 3_000_000}))
+	})
+
+	t.Run("sufficient", func(t *testing.T) {
+		require.Equal(t, SimulcastLevelHigh, getProbeSimulcastLevel([]int{3_000_000, 2_500_000, 3_000_000}))
+	})
+
+	t.Run("ramping up", func(t *testing.T) {
+		// Only the most recent estimations count.
+		require.Equal(t, SimulcastLevelHigh, getProbeSimulcastLevel([]int{500_000, 1_000_000, 2_500_000, 2_600_000, 2_700_000}))
+	})
+}
+
+func TestBWProbeRun(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	}))
+
+	t.Run("waits for enough samples", func(t *testing.T) {
+		p := newBWProbe(log, 10*time.Millisecond, 5*time.Second)
+		resultCh := make(chan string, 1)
+		go func() {
+			resultCh <- p.Run(nil)
+		}()
+
+		p.addSample(3_000_000)
+		p.addSample(3_000_000)
+
+		// The minimum duration elapsed but not enough samples were received.
+		select {
+		case <-resultCh:
+			require.FailNow(t, "probe should not have completed")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		p.addSample(3_000_000)
+
+		select {
+		case level := <-resultCh:
+			require.Equal(t, SimulcastLevelHigh, level)
+		case <-time.After(time.Second):
+			require.FailNow(t, "timed out waiting for probe")
+		}
+	})
+
+	t.Run("constrained", func(t *testing.T) {
+		p := newBWProbe(log, 10*time.Millisecond, 5*time.Second)
+		p.addSample(3_000_000)
+		p.addSample(800_000)
+		p.addSample(900_000)
+		require.Equal(t, SimulcastLevelLow, p.Run(nil))
+	})
+
+	t.Run("no samples", func(t *testing.T) {
+		p := newBWProbe(log, 10*time.Millisecond, 50*time.Millisecond)
+		require.Equal(t, SimulcastLevelLow, p.Run(nil))
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		p := newBWProbe(log, time.Second, 5*time.Second)
+		stopCh := make(chan struct{})
+		close(stopCh)
+		require.Equal(t, SimulcastLevelLow, p.Run(stopCh))
+	})
+}
@@ -13,6 +13,7 @@ func (c *Client) joinCall() error {
 		JobID:       c.cfg.JobID,
 		AV1Support:  c.cfg.EnableAV1,
 		DCSignaling: c.cfg.EnableDCSignaling,
+		Version:     c.cfg.Version,
 	}, false); err != nil {
 		return fmt.Errorf("failed to send ws msg: %w", err)
 	}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/mattermost/mattermost/server/public/model"
 
+	"github.com/pion/interceptor/pkg/stats"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -27,6 +28,13 @@ const (
 	RTCDisconnectEvent       EventType = "RTCDisconnect"
 	RTCTrackEvent            EventType = "RTCTrack"
 	RTCSenderRTCPPacketEvent EventType = "RTCSenderRTCPPacket"
+	RTCVideoPausedEvent      EventType = "RTCVideoPaused"
+	RTCVideoResumedEvent     EventType = "RTCVideoResumed"
+	RTCAudioPLCHintEvent     EventType = "RTCAudioPLCHint"
+	RTCLayerChangedEvent     EventType = "RTCLayerChanged"
+	RTCReconnectingEvent     EventType = "RTCReconnecting"
+	RTCReconnectedEvent      EventType = "RTCReconnected"
+	RTCMediaMapEvent         EventType = "RTCMediaMap"
 
 	CloseEvent EventType = "Close"
 	ErrorEvent EventType = "Error"
@@ -44,11 +52,17 @@ const (
 	WSCallLoweredHandEvent    EventType = "WSCallLoweredHand"
 	WSCallScreenOnEvent       EventType = "WSCallScreenOn"
 	WSCallScreenOffEvent      EventType = "WSCallScreenOff"
+	WSCallReactionEvent       EventType = "WSCallReaction"
+	WSActiveSpeakerEvent      EventType = "WSActiveSpeaker"
 )
 
 func (e EventType) IsValid() bool {
 	switch e {
 	case RTCConnectEvent, RTCDisconnectEvent, RTCTrackEvent, RTCSenderRTCPPacketEvent,
+		RTCVideoPausedEvent, RTCVideoResumedEvent, RTCAudioPLCHintEvent,
+		RTCLayerChangedEvent,
+		RTCReconnectingEvent, RTCReconnectedEvent,
+		RTCMediaMapEvent,
 		CloseEvent,
 		ErrorEvent,
 		WSConnectEvent, WSDisconnectEvent,
@@ -58,6 +72,8 @@ func (e EventType) IsValid() bool {
 		WSCallUnmutedEvent, WSCallMutedEvent,
 		WSCallRaisedHandEvent, WSCallLoweredHandEvent,
 		WSCallScreenOnEvent, WSCallScreenOffEvent,
+		WSCallReactionEvent,
+		WSActiveSpeakerEvent,
 		WSCallJobStateEvent,
 		WSJobStopEvent:
 		return true
@@ -98,13 +114,37 @@ type Client struct {
 	currentConnID       string
 
 	// WebRTC
+	// fetchedICEServers and iceServersGen are guarded by mut, including when
+	// first set in Connect.
+	fetchedICEServers  []webrtc.ICEServer
+	iceServersGen      uint64
+	iceRefreshTimer    *time.Timer
 	pc                 *webrtc.PeerConnection
 	dc                 atomic.Pointer[webrtc.DataChannel]
+	dcSignalingFailed  atomic.Bool
+	dcOfferTimer       *time.Timer
+	iceRestartAttempts int
+	iceRestartPending  bool
+	iceRestartTimer    *time.Timer
 	iceCh              chan webrtc.ICECandidateInit
 	receivers          map[string][]*webrtc.RTPReceiver
 	voiceSender        *webrtc.RTPSender
 	screenTransceivers []*webrtc.RTPTransceiver
+	videoTransceivers  []*webrtc.RTPTransceiver
 	rtcMon             *rtcMonitor
+	statsGetter        stats.Getter
+	trackStatsSamples  map[webrtc.SSRC]trackStatsSample
+	videoPaused        atomic.Bool
+	bwProbe            atomic.Pointer[bwProbe]
+	mediaMap           atomic.Pointer[map[string]TrackInfo]
+	expectedTracks     map[trackKey]*expectedTrack
+	receivedTracks     map[trackKey]bool
+	stoppedSources     map[string]bool
+
+	// iceDisconnectedTimeout and iceRestartAnswerTimeout are only meant to
+	// be changed by tests.
+	iceDisconnectedTimeout  time.Duration
+	iceRestartAnswerTimeout time.Duration
 
 	state int32
 
@@ -130,14 +170,21 @@ func New(cfg Config, opts ...Option) (*Client, error) {
 	apiClient.SetToken(cfg.AuthToken)
 
 	c := &Client{
-		cfg:           cfg,
-		handlers:      make(map[EventType]EventHandler),
-		wsDoneCh:      make(chan struct{}),
-		wsCloseCh:     make(chan struct{}),
-		wsClientSeqNo: 1,
-		iceCh:         make(chan webrtc.ICECandidateInit, iceChSize),
-		receivers:     make(map[string][]*webrtc.RTPReceiver),
-		apiClient:     apiClient,
+		cfg:               cfg,
+		handlers:          make(map[EventType]EventHandler),
+		wsDoneCh:          make(chan struct{}),
+		wsCloseCh:         make(chan struct{}),
+		wsClientSeqNo:     1,
+		iceCh:             make(chan webrtc.ICECandidateInit, iceChSize),
+		receivers:         make(map[string][]*webrtc.RTPReceiver),
+		trackStatsSamples: make(map[webrtc.SSRC]trackStatsSample),
+		expectedTracks:    make(map[trackKey]*expectedTrack),
+		receivedTracks:    make(map[trackKey]bool),
+		stoppedSources:    make(map[string]bool),
+		apiClient:         apiClient,
+
+		iceDisconnectedTimeout:  iceDisconnectedTimeout,
+		iceRestartAnswerTimeout: iceRestartAnswerTimeout,
 	}
 
 	for _, opt := range opts {
@@ -162,6 +209,20 @@ func (c *Client) Connect() error {
 		return fmt.Errorf("ws client is already initialized")
 	}
 
+	// The ICE servers are set while holding the lock as the refresh timer and
+	// the server pushes update them concurrently.
+	if c.cfg.FetchICEServers {
+		iceServers, ttl, err := c.fetchICEServers()
+		if err != nil {
+			atomic.StoreInt32(&c.state, clientStateNew)
+			return fmt.Errorf("failed to fetch ice servers: %w", err)
+		}
+		if err := c.setICEServers(iceServers, ttl); err != nil {
+			atomic.StoreInt32(&c.state, clientStateNew)
+			return fmt.Errorf("failed to set ice servers: %w", err)
+		}
+	}
+
 	if err := c.wsOpen(); err != nil {
 		return err
 	}
@@ -230,6 +291,13 @@ func (c *Client) close() {
 		c.rtcMon.Stop()
 	}
 
+	c.mut.Lock()
+	c.clearExpectedTracks()
+	c.scheduleICEServersRefresh(0)
+	c.stopICERestartTimer()
+	c.mut.Unlock()
+	c.mediaMap.Store(nil)
+
 	if c.pc != nil {
 		if err := c.pc.Close(); err != nil {
 			c.log.Error("failed to close peer connection", slog.String("err", err.Error()))
@@ -8,10 +8,19 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
 )
 
 var idRE = regexp.MustCompile(`^[a-z0-9]{26}$`)
 
+// Opus bitrate bounds as defined in RFC 7587.
+const (
+	opusMinBitrate = 6000
+	opusMaxBitrate = 510000
+)
+
 type Config struct {
 	// SiteURL is the URL of the Mattermost installation to connect to.
 	SiteURL string
@@ -30,6 +39,58 @@ type Config struct {
 	EnableDCSignaling bool
 	// EnableRTCMonitor controls whether the RTC monitor component should be enabled.
 	EnableRTCMonitor bool
+	// EnableBandwidthProbe controls whether the client should run a short
+	// bandwidth probe on connect and only request the high simulcast level
+	// if the probe indicates sufficient downlink capacity. The probe relies
+	// on the bandwidth estimations sent by the server, so it always results
+	// in the low level if congestion control is disabled.
+	EnableBandwidthProbe bool
+	// VideoPauseBitrate is the bandwidth estimation (in bits per second)
+	// reported by the server under which the client should pause publishing
+	// video. A zero value disables the feature.
+	VideoPauseBitrate int
+	// DisableAutoPLI controls whether the client should skip sending a PLI
+	// request upon receiving a screen track. This should only be set when the
+	// server provisions keyframes to new receivers on its own, otherwise the
+	// screen track may not be decodable until the sender generates the next
+	// keyframe.
+	DisableAutoPLI bool
+	// TrackResubscribeTimeout is how long the client waits for an expected
+	// track (e.g. after a session unmutes or starts screen sharing) before
+	// asking the server to send it again. This helps recovering from
+	// transient renegotiation failures. A zero value disables the feature.
+	TrackResubscribeTimeout time.Duration
+	// DCSignalingTimeout is how long the client waits for an answer to an
+	// offer sent through the data channel before falling back to WebSocket
+	// signaling for the rest of the session. A zero value disables the
+	// fallback.
+	DCSignalingTimeout time.Duration
+	// ICEServers is a list of ICE (STUN/TURN) servers the client should use
+	// to establish the media connection.
+	ICEServers []webrtc.ICEServer
+	// FetchICEServers controls whether the client should fetch the ICE
+	// servers configured in the Calls plugin on Connect, in addition to
+	// ICEServers. Credentials for TURN servers relying on a static auth
+	// secret are requested as needed.
+	FetchICEServers bool
+	// OpusBitrate is the maximum average bitrate, in bits per second,
+	// advertised (maxaveragebitrate) in the Opus fmtp line of the client's
+	// SDP. A zero value means no limit is advertised.
+	//
+	// OpusBitrate and DisableOpusInbandFEC only affect negotiation: audio is encoded
+	// by the application so its encoder should be configured with the same
+	// values. The server's own Opus fmtp line (minptime=10;useinbandfec=1) is
+	// only used to match codecs, so Opus gets negotiated regardless of these,
+	// and voice tracks are forwarded untouched to other sessions.
+	OpusBitrate int
+	// DisableOpusInbandFEC controls whether support for Opus in-band forward
+	// error correction is advertised (useinbandfec) in the client's SDP. It's
+	// advertised by default.
+	DisableOpusInbandFEC bool
+	// Version is the client version reported when joining a call, which the
+	// server may require to be at least a given one. It defaults to the
+	// version of the rtcd module the client is built from.
+	Version string
 
 	wsURL string
 }
@@ -64,5 +125,26 @@ func (c *Config) Parse() error {
 		return fmt.Errorf("invalid ChannelID value")
 	}
 
+	if c.VideoPauseBitrate < 0 {
+		return fmt.Errorf("invalid VideoPauseBitrate value: should not be negative")
+	}
+
+	if c.TrackResubscribeTimeout < 0 {
+		return fmt.Errorf("invalid TrackResubscribeTimeout value: should not be negative")
+	}
+
+	if c.DCSignalingTimeout < 0 {
+		return fmt.Errorf("invalid DCSignalingTimeout value: should not be negative")
+	}
+
+	if c.OpusBitrate != 0 && (c.OpusBitrate < opusMinBitrate || c.OpusBitrate > opusMaxBitrate) {
+		return fmt.Errorf("invalid OpusBitrate value: %d is not in allowed range [%d, %d]",
+			c.OpusBitrate, opusMinBitrate, opusMaxBitrate)
+	}
+
+	if c.Version == "" {
+		c.Version = getModuleVersion()
+	}
+
 	return nil
 }
@@ -5,6 +5,7 @@ package client
 
 import (
 	"testing"
+	"time"
 
 	"github.com/mattermost/rtcd/service/random"
 
@@ -79,6 +80,23 @@ func TestConfigParse(t *testing.T) {
 		require.Equal(t, "ws://mm-url/subpath/api/v4/websocket", cfg.wsURL)
 	})
 
+	t.Run("Version", func(t *testing.T) {
+		cfg := Config{
+			SiteURL:   "https://mm-url:8065/",
+			AuthToken: random.NewID(),
+			ChannelID: random.NewID(),
+		}
+		err := cfg.Parse()
+		require.NoError(t, err)
+		// Tests run from a local checkout so the module version is unknown.
+		require.Equal(t, devVersion, cfg.Version)
+
+		cfg.Version = "v1.2.0"
+		err = cfg.Parse()
+		require.NoError(t, err)
+		require.Equal(t, "v1.2.0", cfg.Version)
+	})
+
 	t.Run("empty ChannelID", func(t *testing.T) {
 		cfg := Config{
 			SiteURL:   "https://mm-url:8065/",
@@ -89,6 +107,63 @@ func TestConfigParse(t *testing.T) {
 		require.Equal(t, "invalid ChannelID value", err.Error())
 	})
 
+	t.Run("negative VideoPauseBitrate", func(t *testing.T) {
+		cfg := Config{
+			SiteURL:           "https://mm-url:8065/",
+			AuthToken:         random.NewID(),
+			ChannelID:         random.NewID(),
+			VideoPauseBitrate: -1,
+		}
+		err := cfg.Parse()
+		require.Error(t, err)
+		require.Equal(t, "invalid VideoPauseBitrate value: should not be negative", err.Error())
+	})
+
+	t.Run("negative TrackResubscribeTimeout", func(t *testing.T) {
+		cfg := Config{
+			SiteURL:                 "https://mm-url:8065/",
+			AuthToken:               random.NewID(),
+			ChannelID:               random.NewID(),
+			TrackResubscribeTimeout: -time.Second,
+		}
+		err := cfg.Parse()
+		require.Error(t, err)
+		require.Equal(t, "invalid TrackResubscribeTimeout value: should not be negative", err.Error())
+	})
+
+	t.Run("negative DCSignalingTimeout", func(t *testing.T) {
+		cfg := Config{
+			SiteURL:            "https://mm-url:8065/",
+			AuthToken:          random.NewID(),
+			ChannelID:          random.NewID(),
+			DCSignalingTimeout: -time.Second,
+		}
+		err := cfg.Parse()
+		require.Error(t, err)
+		require.Equal(t, "invalid DCSignalingTimeout value: should not be negative", err.Error())
+	})
+
+	t.Run("invalid OpusBitrate", func(t *testing.T) {
+		cfg := Config{
+			SiteURL:     "https://mm-url:8065/",
+			AuthToken:   random.NewID(),
+			ChannelID:   random.NewID(),
+			OpusBitrate: 5999,
+		}
+		err := cfg.Parse()
+		require.Error(t, err)
+		require.Equal(t, "invalid OpusBitrate value: 5999 is not in allowed range [6000, 510000]", err.Error())
+
+		cfg.OpusBitrate = 510001
+		err = cfg.Parse()
+		require.Error(t, err)
+		require.Equal(t, "invalid OpusBitrate value: 510001 is not in allowed range [6000, 510000]", err.Error())
+
+		cfg.OpusBitrate = 32000
+		err = cfg.Parse()
+		require.NoError(t, err)
+	})
+
 	t.Run("valid", func(t *testing.T) {
 		cfg := Config{
 			SiteURL:   "https://mm-url:8065/",
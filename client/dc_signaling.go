@@ -0,0 +1,131 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package client
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mattermost/rtcd/service/rtc/dc"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// signalingDC returns the data channel to be used for signaling, or nil if
+// signaling should go through WebSocket.
+func (c *Client) signalingDC() *webrtc.DataChannel {
+	if !c.cfg.EnableDCSignaling || c.dcSignalingFailed.Load() {
+		return nil
+	}
+	if dataCh := c.dc.Load(); dataCh != nil && dataCh.ReadyState() == webrtc.DataChannelStateOpen {
+		return dataCh
+	}
+	return nil
+}
+
+// sendSDP sends the given session description to the server, through the
+// data channel if DC signaling is usable, through WebSocket otherwise.
+func (c *Client) sendSDP(msg sdpMessage) error {
+	if dataCh := c.signalingDC(); dataCh != nil {
+		c.log.Debug("sending sdp through dc", slog.String("type", msg.Type.String()))
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("failed to marshal sdp: %w", err)
+		}
+
+		dcMsg, err := dc.EncodeMessage(dc.MessageTypeSDP, data)
+		if err != nil {
+			return fmt.Errorf("failed to encode dc message: %w", err)
+		}
+
+		if err := dataCh.Send(dcMsg); err != nil {
+			return fmt.Errorf("failed to send on dc: %w", err)
+		}
+
+		if msg.Type == webrtc.SDPTypeOffer {
+			c.startDCOfferTimer()
+		}
+
+		return nil
+	}
+
+	if c.cfg.EnableDCSignaling {
+		c.log.Debug("dc signaling not available, sending sdp through ws", slog.String("type", msg.Type.String()))
+	}
+
+	return c.sendSDPWS(msg)
+}
+
+func (c *Client) sendSDPWS(msg sdpMessage) error {
+	var sdpData bytes.Buffer
+	w := zlib.NewWriter(&sdpData)
+	if err := json.NewEncoder(w).Encode(msg); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to encode sdp: %w", err)
+	}
+	w.Close()
+
+	return c.SendWS(wsEventSDP, map[string]any{
+		"data": sdpData.Bytes(),
+	}, true)
+}
+
+// startDCOfferTimer waits for the answer to an offer sent through the data
+// channel. If none arrives within the configured DCSignalingTimeout, DC
+// signaling is disabled for the rest of the session and the offer is sent
+// again through WebSocket.
+func (c *Client) startDCOfferTimer() {
+	if c.cfg.DCSignalingTimeout <= 0 {
+		return
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if c.dcOfferTimer != nil {
+		c.dcOfferTimer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(c.cfg.DCSignalingTimeout, func() {
+		c.mut.Lock()
+		if c.dcOfferTimer != timer {
+			c.mut.Unlock()
+			return
+		}
+		c.dcOfferTimer = nil
+		c.mut.Unlock()
+
+		if c.pc.SignalingState() != webrtc.SignalingStateHaveLocalOffer {
+			return
+		}
+
+		c.log.Warn("timed out waiting for answer through dc, falling back to ws signaling")
+		c.dcSignalingFailed.Store(true)
+
+		offer := c.pc.LocalDescription()
+		if offer == nil {
+			return
+		}
+		if err := c.sendSDPWS(sdpMessage{SessionDescription: *offer}); err != nil {
+			c.log.Error("failed to send offer through ws", slog.String("err", err.Error()))
+		}
+	})
+	c.dcOfferTimer = timer
+}
+
+// stopDCOfferTimer is called upon receiving an answer from the server.
+func (c *Client) stopDCOfferTimer() {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if c.dcOfferTimer != nil {
+		c.dcOfferTimer.Stop()
+		c.dcOfferTimer = nil
+	}
+}
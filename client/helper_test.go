@@ -68,6 +68,22 @@ func (th *TestHelper) newScreenTrack(mimeType string) *webrtc.TrackLocalStaticRT
 	return track
 }
 
+func (th *TestHelper) newVideoTrack(mimeType string) *webrtc.TrackLocalStaticRTP {
+	th.tb.Helper()
+
+	track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{
+		MimeType:  mimeType,
+		ClockRate: 90000,
+		RTCPFeedback: []webrtc.RTCPFeedback{
+			{Type: "nack", Parameter: ""},
+			{Type: "nack", Parameter: "pli"},
+		},
+	}, "video", "video_"+random.NewID())
+	require.NoError(th.tb, err)
+
+	return track
+}
+
 func (th *TestHelper) screenTrackWriter(track *webrtc.TrackLocalStaticRTP, closeCh <-chan struct{}) {
 	var payloader rtp.Payloader
 	payloader = &codecs.VP8Payloader{
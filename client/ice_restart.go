@@ -0,0 +1,264 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package client
+
+import (
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattermost/rtcd/service/ws"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// iceRestartMaxAttempts is the maximum number of consecutive ICE restarts
+	// attempted after the connection fails before giving up and closing.
+	iceRestartMaxAttempts = 3
+	// iceDisconnectedTimeout is how long the connection is given to recover
+	// on its own after getting disconnected before restarting ICE. This is
+	// well below the time it takes for ICE to fail.
+	iceDisconnectedTimeout = 5 * time.Second
+	// iceRestartAnswerTimeout is how long to wait for the answer to a restart
+	// offer before trying again.
+	iceRestartAnswerTimeout = 10 * time.Second
+)
+
+func (c *Client) handleICEConnectionStateChange(pc *webrtc.PeerConnection, st webrtc.ICEConnectionState) {
+	if st == webrtc.ICEConnectionStateConnected {
+		c.mut.Lock()
+		restarted := c.iceRestartAttempts > 0
+		c.iceRestartAttempts = 0
+		c.stopICERestartTimer()
+		c.mut.Unlock()
+
+		if restarted {
+			c.log.Debug("ice reconnect")
+			c.emit(RTCReconnectedEvent, nil)
+		} else {
+			c.log.Debug("ice connect")
+			c.emit(RTCConnectEvent, nil)
+		}
+	}
+
+	if st == webrtc.ICEConnectionStateDisconnected {
+		c.log.Debug("ice disconnect")
+		// The server restarts ICE as well upon disconnection. Waiting for it
+		// before sending our own offer avoids collisions which cannot be
+		// resolved since local offers can't be rolled back.
+		c.mut.Lock()
+		if c.iceRestartTimer == nil {
+			c.startICERestartTimer(pc, c.iceDisconnectedTimeout)
+		}
+		c.mut.Unlock()
+	}
+
+	if st == webrtc.ICEConnectionStateFailed {
+		// Either the restart is still pending or the server's one didn't
+		// help, in which case it's our turn.
+		c.mut.RLock()
+		waiting := c.iceRestartTimer != nil
+		c.mut.RUnlock()
+		if waiting {
+			return
+		}
+		err := c.restartICE(pc)
+		if err == nil {
+			return
+		}
+		c.log.Debug("not restarting ice", slog.String("reason", err.Error()))
+	}
+
+	if st == webrtc.ICEConnectionStateClosed || st == webrtc.ICEConnectionStateFailed {
+		c.mut.Lock()
+		c.stopICERestartTimer()
+		c.mut.Unlock()
+		c.iceFailed()
+	}
+}
+
+// iceFailed is called when the connection cannot be recovered.
+func (c *Client) iceFailed() {
+	c.log.Debug("ice closed or failed")
+	c.emit(RTCDisconnectEvent, nil)
+
+	if atomic.LoadInt32(&c.state) != clientStateInit {
+		return
+	}
+
+	c.log.Debug("rtc disconnected, closing")
+	if err := c.Close(); err != nil {
+		c.log.Error("failed to close", slog.String("err", err.Error()))
+	}
+}
+
+// startICERestartTimer restarts ICE after the given timeout unless the
+// connection recovers in the meantime. It's used both to give the server,
+// which restarts ICE on its own, the chance to go first when the connection
+// gets disconnected and to wait for the answer to a restart offer. The caller
+// should hold c.mut.
+func (c *Client) startICERestartTimer(pc *webrtc.PeerConnection, timeout time.Duration) {
+	c.stopICERestartTimer()
+
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		c.mut.Lock()
+		if c.iceRestartTimer != timer {
+			c.mut.Unlock()
+			return
+		}
+		c.iceRestartTimer = nil
+		c.mut.Unlock()
+
+		st := pc.ICEConnectionState()
+		if st == webrtc.ICEConnectionStateConnected || st == webrtc.ICEConnectionStateCompleted ||
+			st == webrtc.ICEConnectionStateClosed {
+			return
+		}
+
+		var err error
+		switch pc.SignalingState() {
+		case webrtc.SignalingStateHaveLocalOffer:
+			err = c.resendICERestartOffer(pc)
+		case webrtc.SignalingStateStable:
+			// Once a restart has been negotiated, the connection either
+			// recovers or fails.
+			if st == webrtc.ICEConnectionStateChecking {
+				return
+			}
+			err = c.restartICE(pc)
+		default:
+			// The server is negotiating, the restart happens afterwards if
+			// still needed.
+			c.mut.Lock()
+			c.iceRestartPending = true
+			c.mut.Unlock()
+		}
+
+		if err != nil {
+			c.log.Debug("not restarting ice", slog.String("reason", err.Error()))
+			c.iceFailed()
+		}
+	})
+	c.iceRestartTimer = timer
+}
+
+// resendICERestartOffer sends again the pending local offer which got no
+// answer. Since local offers cannot be rolled back, this is the only way to
+// move forward with the negotiation. It counts as a restart attempt.
+func (c *Client) resendICERestartOffer(pc *webrtc.PeerConnection) error {
+	offer := pc.LocalDescription()
+	if offer == nil {
+		return fmt.Errorf("local description is not set")
+	}
+
+	c.mut.Lock()
+	if c.iceRestartAttempts >= iceRestartMaxAttempts {
+		c.mut.Unlock()
+		return fmt.Errorf("max attempts reached")
+	}
+	c.iceRestartAttempts++
+	attempt := c.iceRestartAttempts
+	c.startICERestartTimer(pc, c.iceRestartAnswerTimeout)
+	c.mut.Unlock()
+
+	c.log.Warn("timed out waiting for answer, sending offer again", slog.Int("attempt", attempt))
+	c.emit(RTCReconnectingEvent, map[string]any{
+		"attempt": attempt,
+	})
+
+	if err := c.sendSDPWS(sdpMessage{SessionDescription: *offer}); err != nil {
+		return fmt.Errorf("failed to send offer: %w", err)
+	}
+
+	return nil
+}
+
+// stopICERestartTimer cancels the pending ICE restart, if any. The caller
+// should hold c.mut.
+func (c *Client) stopICERestartTimer() {
+	if c.iceRestartTimer != nil {
+		c.iceRestartTimer.Stop()
+		c.iceRestartTimer = nil
+	}
+}
+
+// restartICE attempts to recover a failed connection by renegotiating with
+// new ICE credentials. If a negotiation is in progress, the restart happens
+// as soon as it completes. An error is returned if a restart cannot be
+// attempted (e.g. the client is closing or the attempts have been
+// exhausted).
+func (c *Client) restartICE(pc *webrtc.PeerConnection) error {
+	if atomic.LoadInt32(&c.state) != clientStateInit {
+		return fmt.Errorf("client is not connected")
+	}
+
+	c.mut.Lock()
+	if c.ws == nil || c.ws.GetConnState() != ws.WSConnOpen {
+		c.mut.Unlock()
+		return fmt.Errorf("ws connection is not open")
+	}
+	if c.iceRestartAttempts >= iceRestartMaxAttempts {
+		c.mut.Unlock()
+		return fmt.Errorf("max attempts reached")
+	}
+	if pc.SignalingState() != webrtc.SignalingStateStable {
+		c.log.Debug("negotiation in progress, delaying ice restart")
+		c.iceRestartPending = true
+		// The negotiation could be stuck waiting for an answer.
+		if c.iceRestartTimer == nil {
+			c.startICERestartTimer(pc, c.iceRestartAnswerTimeout)
+		}
+		c.mut.Unlock()
+		return nil
+	}
+	c.iceRestartPending = false
+	c.iceRestartAttempts++
+	attempt := c.iceRestartAttempts
+	c.startICERestartTimer(pc, c.iceRestartAnswerTimeout)
+	c.mut.Unlock()
+
+	c.log.Debug("restarting ice", slog.Int("attempt", attempt))
+	c.emit(RTCReconnectingEvent, map[string]any{
+		"attempt": attempt,
+	})
+
+	offer, err := pc.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	if err != nil {
+		return fmt.Errorf("failed to create offer: %w", err)
+	}
+
+	if err := pc.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("failed to set local description: %w", err)
+	}
+
+	// The data channel runs on top of the failed transport so the offer can
+	// only go through WebSocket.
+	if err := c.sendSDPWS(sdpMessage{SessionDescription: offer}); err != nil {
+		return fmt.Errorf("failed to send offer: %w", err)
+	}
+
+	return nil
+}
+
+// resumeICERestart performs the ICE restart that got delayed by a
+// negotiation, if any. It should be called once the signaling state is back
+// to stable.
+func (c *Client) resumeICERestart() {
+	c.mut.RLock()
+	pending := c.iceRestartPending
+	pc := c.pc
+	c.mut.RUnlock()
+
+	if !pending || pc == nil {
+		return
+	}
+
+	if err := c.restartICE(pc); err != nil {
+		c.log.Debug("not restarting ice", slog.String("reason", err.Error()))
+		c.iceFailed()
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package client
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/ws"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestRestartICE(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	wsServer, err := ws.NewServer(ws.ServerConfig{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		PingInterval:    time.Second,
+	}, log)
+	require.NoError(t, err)
+	defer wsServer.Close()
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		_ = http.Serve(listener, wsServer)
+	}()
+
+	c, err := New(Config{
+		SiteURL:   "http://localhost:8065",
+		AuthToken: random.NewID(),
+		ChannelID: random.NewID(),
+	})
+	require.NoError(t, err)
+	atomic.StoreInt32(&c.state, clientStateInit)
+
+	u := url.URL{Scheme: "ws", Host: listener.Addr().String(), Path: "/ws"}
+	c.ws, err = ws.NewClient(ws.ClientConfig{
+		URL:      u.String(),
+		AuthType: ws.BearerClientAuthType,
+	})
+	require.NoError(t, err)
+	defer c.ws.Close()
+	msg := <-wsServer.ReceiveCh()
+	require.Equal(t, ws.OpenMessage, msg.Type)
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer pc.Close()
+	c.pc = pc
+	_, err = pc.CreateDataChannel("calls-dc", nil)
+	require.NoError(t, err)
+	offer, err := pc.CreateOffer(nil)
+	require.NoError(t, err)
+	err = pc.SetLocalDescription(offer)
+	require.NoError(t, err)
+	initialUfrag := getICEUfrag(t, offer.SDP)
+
+	// completeNegotiation answers the pending offer so that the signaling
+	// state goes back to stable.
+	remotePC, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer remotePC.Close()
+	completeNegotiation := func(t *testing.T, offer webrtc.SessionDescription) {
+		t.Helper()
+		err := remotePC.SetRemoteDescription(offer)
+		require.NoError(t, err)
+		answer, err := remotePC.CreateAnswer(nil)
+		require.NoError(t, err)
+		err = remotePC.SetLocalDescription(answer)
+		require.NoError(t, err)
+		err = pc.SetRemoteDescription(answer)
+		require.NoError(t, err)
+	}
+
+	var events []EventType
+	for _, ev := range []EventType{RTCReconnectingEvent, RTCReconnectedEvent, RTCConnectEvent, RTCDisconnectEvent, CloseEvent} {
+		err := c.On(ev, func(_ any) error {
+			events = append(events, ev)
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	// receiveOffer returns the session description sent to the server
+	// through WebSocket.
+	receiveOffer := func(t *testing.T) sdpMessage {
+		t.Helper()
+
+		var msg ws.Message
+		select {
+		case msg = <-wsServer.ReceiveCh():
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for offer")
+		}
+		require.Equal(t, ws.BinaryMessage, msg.Type)
+
+		var req struct {
+			Action string            `msgpack:"action"`
+			Data   map[string][]byte `msgpack:"data"`
+		}
+		err := msgpack.Unmarshal(msg.Data, &req)
+		require.NoError(t, err)
+		require.Equal(t, wsEventSDP, req.Action)
+
+		r, err := zlib.NewReader(bytes.NewReader(req.Data["data"]))
+		require.NoError(t, err)
+		var sdp sdpMessage
+		err = json.NewDecoder(r).Decode(&sdp)
+		require.NoError(t, err)
+		return sdp
+	}
+
+	t.Run("negotiation in progress", func(t *testing.T) {
+		err := c.restartICE(pc)
+		require.NoError(t, err)
+		require.Empty(t, events)
+		require.True(t, c.iceRestartPending)
+
+		// The restart happens once the negotiation completes.
+		completeNegotiation(t, offer)
+		c.resumeICERestart()
+		require.Equal(t, []EventType{RTCReconnectingEvent}, events)
+		require.False(t, c.iceRestartPending)
+
+		sdp := receiveOffer(t)
+		require.Equal(t, webrtc.SDPTypeOffer, sdp.Type)
+		require.NotEqual(t, initialUfrag, getICEUfrag(t, sdp.SDP))
+		completeNegotiation(t, sdp.SessionDescription)
+
+		c.handleICEConnectionStateChange(pc, webrtc.ICEConnectionStateConnected)
+		require.Equal(t, []EventType{RTCReconnectingEvent, RTCReconnectedEvent}, events)
+		events = nil
+	})
+
+	t.Run("failed connection is restarted", func(t *testing.T) {
+		c.handleICEConnectionStateChange(pc, webrtc.ICEConnectionStateFailed)
+		require.Equal(t, []EventType{RTCReconnectingEvent}, events)
+		require.Equal(t, int32(clientStateInit), atomic.LoadInt32(&c.state))
+
+		sdp := receiveOffer(t)
+		require.Equal(t, webrtc.SDPTypeOffer, sdp.Type)
+		require.NotEqual(t, initialUfrag, getICEUfrag(t, sdp.SDP))
+		completeNegotiation(t, sdp.SessionDescription)
+
+		c.handleICEConnectionStateChange(pc, webrtc.ICEConnectionStateConnected)
+		require.Equal(t, []EventType{RTCReconnectingEvent, RTCReconnectedEvent}, events)
+		require.Zero(t, c.iceRestartAttempts)
+	})
+
+	t.Run("disconnected connection is restarted", func(t *testing.T) {
+		events = nil
+		c.handleICEConnectionStateChange(pc, webrtc.ICEConnectionStateDisconnected)
+		c.mut.RLock()
+		require.NotNil(t, c.iceRestartTimer)
+		c.mut.RUnlock()
+
+		// Recovering cancels the restart.
+		c.handleICEConnectionStateChange(pc, webrtc.ICEConnectionStateConnected)
+		c.mut.RLock()
+		require.Nil(t, c.iceRestartTimer)
+		c.mut.RUnlock()
+		require.Equal(t, []EventType{RTCConnectEvent}, events)
+	})
+
+	t.Run("answer timeout", func(t *testing.T) {
+		events = nil
+		c.mut.Lock()
+		c.iceRestartAnswerTimeout = 100 * time.Millisecond
+		c.mut.Unlock()
+		defer func() {
+			c.mut.Lock()
+			c.iceRestartAnswerTimeout = iceRestartAnswerTimeout
+			c.iceRestartAttempts = 0
+			c.stopICERestartTimer()
+			c.mut.Unlock()
+		}()
+
+		err := c.restartICE(pc)
+		require.NoError(t, err)
+		sdp := receiveOffer(t)
+		require.Equal(t, webrtc.SignalingStateHaveLocalOffer, pc.SignalingState())
+
+		// Without an answer the offer gets sent again.
+		retry := receiveOffer(t)
+		require.Equal(t, getICEUfrag(t, sdp.SDP), getICEUfrag(t, retry.SDP))
+		c.mut.Lock()
+		require.Equal(t, 2, c.iceRestartAttempts)
+		c.stopICERestartTimer()
+		c.mut.Unlock()
+		completeNegotiation(t, retry.SessionDescription)
+	})
+
+	t.Run("offer collision", func(t *testing.T) {
+		events = nil
+		defer func() {
+			c.mut.Lock()
+			c.iceRestartAttempts = 0
+			c.stopICERestartTimer()
+			c.mut.Unlock()
+		}()
+
+		err := c.restartICE(pc)
+		require.NoError(t, err)
+		sdp := receiveOffer(t)
+
+		serverPC, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+		require.NoError(t, err)
+		defer serverPC.Close()
+		_, err = serverPC.CreateDataChannel("calls-dc", nil)
+		require.NoError(t, err)
+		serverOffer, err := serverPC.CreateOffer(nil)
+		require.NoError(t, err)
+
+		err = c.handleOffer(serverOffer.SDP, 0)
+		require.EqualError(t, err, "offer collision: local offer pending")
+		require.Equal(t, webrtc.SignalingStateHaveLocalOffer, pc.SignalingState())
+
+		completeNegotiation(t, sdp.SessionDescription)
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		events = nil
+		for i := 0; i < iceRestartMaxAttempts; i++ {
+			err := c.restartICE(pc)
+			require.NoError(t, err)
+			completeNegotiation(t, receiveOffer(t).SessionDescription)
+		}
+		require.Len(t, events, iceRestartMaxAttempts)
+
+		err := c.restartICE(pc)
+		require.EqualError(t, err, "max attempts reached")
+		require.Len(t, events, iceRestartMaxAttempts)
+		c.iceRestartAttempts = 0
+	})
+
+	t.Run("ws not open", func(t *testing.T) {
+		events = nil
+		err := c.ws.Close()
+		require.NoError(t, err)
+
+		err = c.restartICE(pc)
+		require.EqualError(t, err, "ws connection is not open")
+		require.Empty(t, events)
+	})
+
+	t.Run("closing", func(t *testing.T) {
+		atomic.StoreInt32(&c.state, clientStateClosing)
+		err := c.restartICE(pc)
+		require.EqualError(t, err, "client is not connected")
+		require.Empty(t, events)
+	})
+}
+
+func getICEUfrag(t *testing.T, sdp string) string {
+	t.Helper()
+	for _, line := range bytes.Split([]byte(sdp), []byte("\r\n")) {
+		if ufrag, ok := bytes.CutPrefix(line, []byte("a=ice-ufrag:")); ok {
+			return string(ufrag)
+		}
+	}
+	require.FailNow(t, "ice-ufrag not found")
+	return ""
+}
@@ -0,0 +1,293 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// iceServersRefreshRetryInterval is the time to wait before trying again
+	// after failing to refresh the ICE servers.
+	iceServersRefreshRetryInterval = 30 * time.Second
+)
+
+// turnCredentialsRefreshRatio is the fraction of the TURN credentials
+// lifetime after which they get refreshed.
+var turnCredentialsRefreshRatio = 0.8
+
+// iceServerConfig mirrors the ICE server configuration returned by the Calls
+// plugin.
+type iceServerConfig struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+	// TLS marks TURN servers accepting connections over TLS, in which case
+	// their URLs should use the turns: scheme.
+	TLS bool `json:"tls,omitempty"`
+	// TTL is the lifetime, in seconds, of short-lived credentials.
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+// credentialsTTL returns the remaining lifetime of the server's credentials,
+// or zero if unknown. Unless explicitly given, it's derived from the username
+// of generated credentials, which is in the form of <expiration ts>:<id>.
+func (c iceServerConfig) credentialsTTL(now time.Time) time.Duration {
+	if c.TTL > 0 {
+		return time.Duration(c.TTL) * time.Second
+	}
+
+	ts, _, ok := strings.Cut(c.Username, ":")
+	if !ok {
+		return 0
+	}
+	expiresAt, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || expiresAt <= 0 {
+		return 0
+	}
+	if ttl := time.Unix(expiresAt, 0).Sub(now); ttl > 0 {
+		return ttl
+	}
+	return 0
+}
+
+func (c iceServerConfig) isTURN() bool {
+	for _, u := range c.URLs {
+		if strings.HasPrefix(u, "turn:") || strings.HasPrefix(u, "turns:") {
+			return true
+		}
+	}
+	return false
+}
+
+func (c iceServerConfig) toICEServer() webrtc.ICEServer {
+	urls := c.URLs
+	if c.TLS {
+		urls = make([]string, 0, len(c.URLs))
+		for _, u := range c.URLs {
+			if strings.HasPrefix(u, "turn:") {
+				u = "turns:" + strings.TrimPrefix(u, "turn:")
+			}
+			urls = append(urls, u)
+		}
+	}
+
+	srv := webrtc.ICEServer{
+		URLs:     urls,
+		Username: c.Username,
+	}
+	// Credential is an interface so it's only set if given.
+	if c.Credential != "" {
+		srv.Credential = c.Credential
+	}
+	return srv
+}
+
+// GetTURNCredentials returns the TURN servers configured in the Calls plugin
+// along with short-lived credentials for the current user. These are
+// generated from a static auth secret shared with the TURN server.
+func (c *Client) GetTURNCredentials() ([]webrtc.ICEServer, error) {
+	iceServers, _, err := c.getTURNCredentials()
+	return iceServers, err
+}
+
+// getTURNCredentials returns the TURN servers along with generated
+// credentials and the shortest of their lifetimes, if known.
+func (c *Client) getTURNCredentials() ([]webrtc.ICEServer, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), httpRequestTimeout)
+	defer cancel()
+	res, err := c.apiClient.DoAPIRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s/plugins/%s/turn-credentials", c.cfg.SiteURL, pluginID), "", "")
+	if err != nil {
+		return nil, 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, 0, fmt.Errorf("unexpected response status code %d", res.StatusCode)
+	}
+
+	dec := json.NewDecoder(&io.LimitedReader{
+		R: res.Body,
+		N: httpResponseBodyMaxSizeBytes,
+	})
+
+	var configs []iceServerConfig
+	if err := dec.Decode(&configs); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	now := time.Now()
+	var ttl time.Duration
+	iceServers := make([]webrtc.ICEServer, 0, len(configs))
+	for _, cfg := range configs {
+		iceServers = append(iceServers, cfg.toICEServer())
+		if cfgTTL := cfg.credentialsTTL(now); cfgTTL > 0 && (ttl == 0 || cfgTTL < ttl) {
+			ttl = cfgTTL
+		}
+	}
+
+	return iceServers, ttl, nil
+}
+
+// fetchICEServers returns the ICE servers configured in the Calls plugin.
+// TURN servers relying on a static auth secret are returned with generated
+// credentials, in which case their lifetime is returned as well.
+func (c *Client) fetchICEServers() ([]webrtc.ICEServer, time.Duration, error) {
+	config, err := c.GetCallsConfig()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get calls config: %w", err)
+	}
+
+	// Going through JSON to convert the generic config value.
+	data, err := json.Marshal(config["ICEServersConfigs"])
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to marshal ice servers config: %w", err)
+	}
+	var configs []iceServerConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, 0, fmt.Errorf("failed to unmarshal ice servers config: %w", err)
+	}
+
+	needsTURNCredentials, _ := config["NeedsTURNCredentials"].(bool)
+
+	var iceServers []webrtc.ICEServer
+	for _, cfg := range configs {
+		// TURN servers without credentials can't be used as they are. Their
+		// credentials are generated on demand below.
+		if needsTURNCredentials && cfg.isTURN() && cfg.Credential == "" {
+			continue
+		}
+		iceServers = append(iceServers, cfg.toICEServer())
+	}
+
+	var ttl time.Duration
+	if needsTURNCredentials {
+		var turnServers []webrtc.ICEServer
+		turnServers, ttl, err = c.getTURNCredentials()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get turn credentials: %w", err)
+		}
+		iceServers = append(iceServers, turnServers...)
+	}
+
+	c.log.Debug("fetched ice servers", slog.Int("count", len(iceServers)))
+
+	return iceServers, ttl, nil
+}
+
+// scheduleICEServersRefresh schedules fetching the ICE servers again before
+// the credentials with the given lifetime expire so that valid ones are
+// available for any future ICE restart. Any previously scheduled refresh is
+// replaced, or canceled if ttl is zero. The caller should hold c.mut.
+func (c *Client) scheduleICEServersRefresh(ttl time.Duration) {
+	if c.iceRefreshTimer != nil {
+		c.iceRefreshTimer.Stop()
+		c.iceRefreshTimer = nil
+	}
+
+	if ttl <= 0 || !c.cfg.FetchICEServers {
+		return
+	}
+
+	c.iceRefreshTimer = time.AfterFunc(time.Duration(float64(ttl)*turnCredentialsRefreshRatio), c.refreshICEServers)
+}
+
+// refreshICEServers fetches the ICE servers, and new TURN credentials, and
+// updates the peer connection configuration accordingly.
+func (c *Client) refreshICEServers() {
+	if atomic.LoadInt32(&c.state) != clientStateInit {
+		return
+	}
+
+	c.log.Debug("refreshing ice servers")
+
+	c.mut.RLock()
+	gen := c.iceServersGen
+	c.mut.RUnlock()
+
+	iceServers, ttl, err := c.fetchICEServers()
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if atomic.LoadInt32(&c.state) != clientStateInit {
+		return
+	}
+
+	// The servers got updated (i.e. pushed by the server) while fetching, in
+	// which case the fetched ones could be older and the refresh has already
+	// been rescheduled.
+	if gen != c.iceServersGen {
+		c.log.Debug("ice servers updated while refreshing, discarding")
+		return
+	}
+
+	if err != nil {
+		c.log.Error("failed to refresh ice servers", slog.String("err", err.Error()))
+		c.iceRefreshTimer = time.AfterFunc(iceServersRefreshRetryInterval, c.refreshICEServers)
+		return
+	}
+
+	if err := c.setICEServers(iceServers, ttl); err != nil {
+		c.log.Error("failed to set ice servers", slog.String("err", err.Error()))
+	}
+}
+
+// setICEServers replaces the ICE servers, either fetched or pushed by the
+// server, that are used alongside the configured ones and schedules their
+// refresh according to the given lifetime. The caller should hold c.mut.
+//
+// Note: the ICE servers are only applied when the peer connection is created
+// as the ICE agent doesn't support changing them afterwards, not even on
+// restart. Updating the configuration keeps it consistent with what a new
+// peer connection would be created with.
+func (c *Client) setICEServers(iceServers []webrtc.ICEServer, ttl time.Duration) error {
+	c.iceServersGen++
+	c.fetchedICEServers = iceServers
+	c.scheduleICEServersRefresh(ttl)
+
+	if c.pc == nil {
+		return nil
+	}
+
+	cfg := c.pc.GetConfiguration()
+	cfg.ICEServers = c.iceServers()
+	if err := c.pc.SetConfiguration(cfg); err != nil {
+		return fmt.Errorf("failed to set configuration: %w", err)
+	}
+
+	return nil
+}
+
+// iceServers returns the ICE servers the peer connection should use: the
+// configured ones followed by those fetched from, or pushed by, the server.
+// The caller should hold c.mut.
+func (c *Client) iceServers() []webrtc.ICEServer {
+	iceServers := make([]webrtc.ICEServer, 0, len(c.cfg.ICEServers)+len(c.fetchedICEServers))
+	iceServers = append(iceServers, c.cfg.ICEServers...)
+	return append(iceServers, c.fetchedICEServers...)
+}
+
+// rtcConfiguration returns the configuration for the peer connection.
+func (c *Client) rtcConfiguration() webrtc.Configuration {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	return webrtc.Configuration{
+		ICEServers:   c.iceServers(),
+		SDPSemantics: webrtc.SDPSemanticsUnifiedPlan,
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchICEServers(t *testing.T) {
+	var needsTURNCredentials bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/plugins/" + pluginID + "/config":
+			err := json.NewEncoder(w).Encode(map[string]any{
+				"ICEServersConfigs": []map[string]any{
+					{
+						"urls": []string{"stun:stun.example.com:3478"},
+					},
+					{
+						"urls": []string{"turn:turn.example.com:3478"},
+					},
+				},
+				"NeedsTURNCredentials": needsTURNCredentials,
+			})
+			require.NoError(t, err)
+		case "/plugins/" + pluginID + "/turn-credentials":
+			err := json.NewEncoder(w).Encode([]map[string]any{
+				{
+					"urls":       []string{"turn:turn.example.com:3478"},
+					"username":   "1700000000:userA",
+					"credential": "ZXhhbXBsZQ==",
+				},
+			})
+			require.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(Config{
+		SiteURL:   srv.URL,
+		AuthToken: random.NewID(),
+		ChannelID: random.NewID(),
+		ICEServers: []webrtc.ICEServer{
+			{
+				URLs: []string{"stun:stun.local:3478"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	t.Run("static credentials", func(t *testing.T) {
+		iceServers, ttl, err := c.fetchICEServers()
+		require.NoError(t, err)
+		require.Zero(t, ttl)
+		require.Equal(t, []webrtc.ICEServer{
+			{
+				URLs: []string{"stun:stun.example.com:3478"},
+			},
+			{
+				URLs: []string{"turn:turn.example.com:3478"},
+			},
+		}, iceServers)
+	})
+
+	t.Run("generated credentials", func(t *testing.T) {
+		needsTURNCredentials = true
+		defer func() { needsTURNCredentials = false }()
+
+		iceServers, ttl, err := c.fetchICEServers()
+		require.NoError(t, err)
+		// Already expired credentials.
+		require.Zero(t, ttl)
+		require.Equal(t, []webrtc.ICEServer{
+			{
+				URLs: []string{"stun:stun.example.com:3478"},
+			},
+			{
+				URLs:       []string{"turn:turn.example.com:3478"},
+				Username:   "1700000000:userA",
+				Credential: "ZXhhbXBsZQ==",
+			},
+		}, iceServers)
+
+		c.mut.Lock()
+		c.fetchedICEServers = iceServers
+		c.mut.Unlock()
+
+		pc, err := webrtc.NewPeerConnection(c.rtcConfiguration())
+		require.NoError(t, err)
+		defer pc.Close()
+
+		require.Equal(t, []webrtc.ICEServer{
+			{
+				URLs: []string{"stun:stun.local:3478"},
+			},
+			{
+				URLs: []string{"stun:stun.example.com:3478"},
+			},
+			{
+				URLs:       []string{"turn:turn.example.com:3478"},
+				Username:   "1700000000:userA",
+				Credential: "ZXhhbXBsZQ==",
+			},
+		}, pc.GetConfiguration().ICEServers)
+	})
+
+	t.Run("request failure", func(t *testing.T) {
+		c, err := New(Config{
+			SiteURL:   srv.URL + "/invalid",
+			AuthToken: random.NewID(),
+			ChannelID: random.NewID(),
+		})
+		require.NoError(t, err)
+
+		_, _, err = c.fetchICEServers()
+		require.ErrorContains(t, err, "failed to get calls config")
+	})
+}
+
+func TestICEServersRefresh(t *testing.T) {
+	var mut sync.Mutex
+	var credentialsRequests []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/plugins/" + pluginID + "/config":
+			err := json.NewEncoder(w).Encode(map[string]any{
+				"ICEServersConfigs": []map[string]any{
+					{
+						"urls": []string{"turn:turn.example.com:3478"},
+					},
+				},
+				"NeedsTURNCredentials": true,
+			})
+			require.NoError(t, err)
+		case "/plugins/" + pluginID + "/turn-credentials":
+			mut.Lock()
+			credentialsRequests = append(credentialsRequests, time.Now())
+			n := len(credentialsRequests)
+			mut.Unlock()
+			err := json.NewEncoder(w).Encode([]map[string]any{
+				{
+					"urls":       []string{"turn:turn.example.com:3478"},
+					"username":   fmt.Sprintf("%d:userA", time.Now().Add(time.Second).Unix()),
+					"credential": fmt.Sprintf("credential%d", n),
+					"ttl":        1,
+				},
+			})
+			require.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(Config{
+		SiteURL:         srv.URL,
+		AuthToken:       random.NewID(),
+		ChannelID:       random.NewID(),
+		FetchICEServers: true,
+	})
+	require.NoError(t, err)
+
+	atomic.StoreInt32(&c.state, clientStateInit)
+	defer c.close()
+
+	iceServers, ttl, err := c.fetchICEServers()
+	require.NoError(t, err)
+	require.Equal(t, time.Second, ttl)
+	require.Len(t, iceServers, 1)
+	require.Equal(t, "credential1", iceServers[0].Credential)
+
+	c.mut.Lock()
+	c.fetchedICEServers = iceServers
+	c.scheduleICEServersRefresh(ttl)
+	c.mut.Unlock()
+
+	// The credentials should get refreshed before they expire.
+	require.Eventually(t, func() bool {
+		c.mut.RLock()
+		defer c.mut.RUnlock()
+		return len(c.fetchedICEServers) == 1 && c.fetchedICEServers[0].Credential == "credential2"
+	}, ttl, 10*time.Millisecond)
+
+	mut.Lock()
+	defer mut.Unlock()
+	require.GreaterOrEqual(t, len(credentialsRequests), 2)
+	require.Less(t, credentialsRequests[1].Sub(credentialsRequests[0]), ttl)
+}
+
+func TestICEServersRefreshPushed(t *testing.T) {
+	reqCh := make(chan struct{})
+	pushedCh := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/plugins/" + pluginID + "/config":
+			close(reqCh)
+			<-pushedCh
+			err := json.NewEncoder(w).Encode(map[string]any{
+				"ICEServersConfigs": []map[string]any{
+					{
+						"urls":       []string{"turn:turn.example.com:3478"},
+						"username":   "username",
+						"credential": "fetched",
+					},
+				},
+			})
+			require.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(Config{
+		SiteURL:         srv.URL,
+		AuthToken:       random.NewID(),
+		ChannelID:       random.NewID(),
+		FetchICEServers: true,
+		ICEServers: []webrtc.ICEServer{
+			{
+				URLs: []string{"stun:stun.local:3478"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	atomic.StoreInt32(&c.state, clientStateInit)
+	defer c.close()
+
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		c.refreshICEServers()
+	}()
+
+	// Servers pushed while a refresh is in flight should not get overwritten.
+	<-reqCh
+	pushed := []webrtc.ICEServer{
+		{
+			URLs:       []string{"turn:turn.example.com:3478"},
+			Username:   "username",
+			Credential: "pushed",
+		},
+	}
+	c.mut.Lock()
+	err = c.setICEServers(pushed, 0)
+	c.mut.Unlock()
+	require.NoError(t, err)
+	close(pushedCh)
+	<-doneCh
+
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	require.Equal(t, pushed, c.fetchedICEServers)
+	require.Equal(t, []webrtc.ICEServer{c.cfg.ICEServers[0], pushed[0]}, c.iceServers())
+}
+
+func TestICEServerConfigCredentialsTTL(t *testing.T) {
+	now := time.Now()
+
+	t.Run("explicit", func(t *testing.T) {
+		cfg := iceServerConfig{
+			Username: fmt.Sprintf("%d:userA", now.Add(time.Hour).Unix()),
+			TTL:      60,
+		}
+		require.Equal(t, time.Minute, cfg.credentialsTTL(now))
+	})
+
+	t.Run("from username", func(t *testing.T) {
+		cfg := iceServerConfig{
+			Username: fmt.Sprintf("%d:userA", now.Add(time.Hour).Unix()),
+		}
+		require.Equal(t, time.Hour, cfg.credentialsTTL(now.Truncate(time.Second)))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		cfg := iceServerConfig{
+			Username: "1700000000:userA",
+		}
+		require.Zero(t, cfg.credentialsTTL(now))
+	})
+
+	t.Run("static", func(t *testing.T) {
+		cfg := iceServerConfig{
+			Username: "username",
+		}
+		require.Zero(t, cfg.credentialsTTL(now))
+	})
+}
+
+func TestICEServerConfigToICEServer(t *testing.T) {
+	t.Run("TLS", func(t *testing.T) {
+		cfg := iceServerConfig{
+			URLs:       []string{"turn:turn.example.com:443?transport=tcp"},
+			Username:   "username",
+			Credential: "password",
+			TLS:        true,
+		}
+		require.Equal(t, webrtc.ICEServer{
+			URLs:       []string{"turns:turn.example.com:443?transport=tcp"},
+			Username:   "username",
+			Credential: "password",
+		}, cfg.toICEServer())
+	})
+}
@@ -4,13 +4,12 @@
 package client
 
 import (
-	"bytes"
-	"compress/zlib"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"sync/atomic"
 	"time"
 
@@ -31,6 +30,10 @@ const (
 	receiveMTU         = 1460
 	rtcMonitorInterval = 4 * time.Second
 	pingInterval       = time.Second
+
+	// The bandwidth estimation needs to go this much above the configured
+	// VideoPauseBitrate for video to resume. This avoids flapping.
+	videoResumeRateMultiplier = 1.25
 )
 
 var rtpVideoExtensions = []string{
@@ -89,8 +92,17 @@ func (c *Client) handleWSEventSignal(evData map[string]any) error {
 		if !ok {
 			return fmt.Errorf("invalid SDP data received")
 		}
+		offerSeq, _ := msg["offerSeq"].(float64)
+
+		// With DC signaling enabled the server only sends offers through
+		// WebSocket if it has given up on the data channel, in which case we
+		// should answer (and keep signaling) through WebSocket as well.
+		if c.signalingDC() != nil {
+			c.log.Warn("received offer through ws, falling back to ws signaling")
+			c.dcSignalingFailed.Store(true)
+		}
 
-		return c.handleOffer(sdp)
+		return c.handleOffer(sdp, uint64(offerSeq))
 	case signalMsgAnswer:
 		sdp, ok := msg["sdp"].(string)
 		if !ok {
@@ -108,6 +120,8 @@ func (c *Client) handleWSEventSignal(evData map[string]any) error {
 func (c *Client) handleAnswer(sdp string) error {
 	c.log.Debug("received sdp answer", slog.Any("sdp", sdp))
 
+	c.stopDCOfferTimer()
+
 	if err := c.pc.SetRemoteDescription(webrtc.SessionDescription{
 		Type: webrtc.SDPTypeAnswer,
 		SDP:  sdp,
@@ -115,6 +129,14 @@ func (c *Client) handleAnswer(sdp string) error {
 		return fmt.Errorf("failed to set remote description: %w", err)
 	}
 
+	// Once a restart is negotiated the connection either recovers or fails,
+	// in which case it's restarted again.
+	c.mut.Lock()
+	if c.iceRestartAttempts > 0 {
+		c.stopICERestartTimer()
+	}
+	c.mut.Unlock()
+
 	for i := 0; i < len(c.iceCh); i++ {
 		c.log.Debug("adding queued remote candidate")
 		if err := c.pc.AddICECandidate(<-c.iceCh); err != nil {
@@ -122,12 +144,24 @@ func (c *Client) handleAnswer(sdp string) error {
 		}
 	}
 
+	c.resumeICERestart()
+
 	return nil
 }
 
-func (c *Client) handleOffer(sdp string) error {
+// handleOffer answers the given offer. The offer sequence number, if any, is
+// echoed back in the answer so that the server can match it to its offer.
+func (c *Client) handleOffer(sdp string, offerSeq uint64) error {
 	c.log.Debug("received sdp offer", slog.Any("sdp", sdp))
 
+	// Local offers can't be rolled back so there's no way to accept the
+	// server's offer until ours gets answered. The server ignores client offers
+	// while negotiating so this is avoided by not offering when it's expected
+	// to (e.g. ICE restarts).
+	if c.pc.SignalingState() == webrtc.SignalingStateHaveLocalOffer {
+		return fmt.Errorf("offer collision: local offer pending")
+	}
+
 	if err := c.pc.SetRemoteDescription(webrtc.SessionDescription{
 		Type: webrtc.SDPTypeOffer,
 		SDP:  sdp,
@@ -144,47 +178,55 @@ func (c *Client) handleOffer(sdp string) error {
 		return fmt.Errorf("failed to set local description: %w", err)
 	}
 
-	if dataCh := c.dc.Load(); c.cfg.EnableDCSignaling && dataCh != nil && dataCh.ReadyState() == webrtc.DataChannelStateOpen {
-		c.log.Debug("sending answer through dc")
-		data, err := json.Marshal(answer)
-		if err != nil {
-			return fmt.Errorf("failed to marshal answer: %w", err)
-		}
+	if err := c.sendSDP(sdpMessage{SessionDescription: answer, OfferSeq: offerSeq}); err != nil {
+		return err
+	}
 
-		msg, err := dc.EncodeMessage(dc.MessageTypeSDP, data)
-		if err != nil {
-			return fmt.Errorf("failed to encode dc message: %w", err)
-		}
+	c.resumeICERestart()
 
-		return dataCh.Send(msg)
-	}
+	return nil
+}
 
-	if c.cfg.EnableDCSignaling {
-		c.log.Debug("dc not connected, sending answer through ws")
+// opusCodec returns the Opus codec parameters advertised by the client,
+// carrying the configured OpusBitrate and DisableOpusInbandFEC.
+func (c *Client) opusCodec() webrtc.RTPCodecParameters {
+	fmtp := "minptime=10;useinbandfec=1"
+	if c.cfg.DisableOpusInbandFEC {
+		fmtp = "minptime=10;useinbandfec=0"
+	}
+	if c.cfg.OpusBitrate > 0 {
+		fmtp += fmt.Sprintf(";maxaveragebitrate=%d", c.cfg.OpusBitrate)
 	}
 
-	var sdpData bytes.Buffer
-	w := zlib.NewWriter(&sdpData)
-	if err := json.NewEncoder(w).Encode(answer); err != nil {
-		w.Close()
-		return fmt.Errorf("failed to encode answer: %w", err)
+	return webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    webrtc.MimeTypeOpus,
+			ClockRate:   48000,
+			Channels:    2,
+			SDPFmtpLine: fmtp,
+		},
+		PayloadType: 111,
 	}
-	w.Close()
+}
 
-	return c.SendWS(wsEventSDP, map[string]any{
-		"data": sdpData.Bytes(),
-	}, true)
+func (c *Client) registerCodecs(m *webrtc.MediaEngine) error {
+	// Opus needs to be registered before the defaults for our parameters to
+	// take precedence.
+	if err := m.RegisterCodec(c.opusCodec(), webrtc.RTPCodecTypeAudio); err != nil {
+		return fmt.Errorf("failed to register opus codec: %w", err)
+	}
+	if err := m.RegisterDefaultCodecs(); err != nil {
+		return fmt.Errorf("failed to register default codecs: %w", err)
+	}
+	return nil
 }
 
 func (c *Client) initRTCSession() error {
-	cfg := webrtc.Configuration{
-		ICEServers:   []webrtc.ICEServer{}, // TODO: consider loading ICE servers from config
-		SDPSemantics: webrtc.SDPSemanticsUnifiedPlan,
-	}
+	cfg := c.rtcConfiguration()
 
 	var m webrtc.MediaEngine
-	if err := m.RegisterDefaultCodecs(); err != nil {
-		return fmt.Errorf("failed to register default codecs: %w", err)
+	if err := c.registerCodecs(&m); err != nil {
+		return err
 	}
 
 	i := interceptor.Registry{}
@@ -205,6 +247,12 @@ func (c *Client) initRTCSession() error {
 		return fmt.Errorf("failed to register default interceptors: %w", err)
 	}
 
+	// Added last so that paused packets are dropped before reaching any other
+	// interceptor.
+	if c.cfg.VideoPauseBitrate > 0 {
+		i.Add(&videoPauseInterceptorFactory{paused: &c.videoPaused})
+	}
+
 	for _, ext := range rtpVideoExtensions {
 		if err := m.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: ext}, webrtc.RTPCodecTypeVideo); err != nil {
 			return fmt.Errorf("failed to register header extension: %w", err)
@@ -228,6 +276,7 @@ func (c *Client) initRTCSession() error {
 	if c.cfg.EnableRTCMonitor {
 		c.mut.Lock()
 		c.rtcMon = rtcMon
+		c.statsGetter = statsGetter
 		c.mut.Unlock()
 		rtcMon.Start()
 	}
@@ -254,28 +303,7 @@ func (c *Client) initRTCSession() error {
 	})
 
 	pc.OnICEConnectionStateChange(func(st webrtc.ICEConnectionState) {
-		if st == webrtc.ICEConnectionStateConnected {
-			c.log.Debug("ice connect")
-			c.emit(RTCConnectEvent, nil)
-		}
-
-		if st == webrtc.ICEConnectionStateDisconnected {
-			c.log.Debug("ice disconnect")
-		}
-
-		if st == webrtc.ICEConnectionStateClosed || st == webrtc.ICEConnectionStateFailed {
-			c.log.Debug("ice closed or failed")
-			c.emit(RTCDisconnectEvent, nil)
-
-			if atomic.LoadInt32(&c.state) != clientStateInit {
-				return
-			}
-
-			c.log.Debug("rtc disconnected, closing")
-			if err := c.Close(); err != nil {
-				c.log.Error("failed to close", slog.String("err", err.Error()))
-			}
-		}
+		c.handleICEConnectionStateChange(pc, st)
 	})
 
 	pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
@@ -293,7 +321,7 @@ func (c *Client) initRTCSession() error {
 			return
 		}
 
-		if trackType != TrackTypeVoice && trackType != TrackTypeScreen {
+		if trackType != TrackTypeVoice && trackType != TrackTypeScreen && trackType != TrackTypeVideo {
 			c.log.Debug("ignoring unsupported track type", slog.Any("trackType", trackType))
 			if err := receiver.Stop(); err != nil {
 				c.log.Error("failed to stop receiver", slog.String("err", err.Error()))
@@ -301,8 +329,19 @@ func (c *Client) initRTCSession() error {
 			return
 		}
 
-		if trackType == TrackTypeScreen {
-			c.log.Debug("sending PLI request for received screen track", slog.String("trackID", track.ID()), slog.Any("SSRC", track.SSRC()))
+		c.mut.RLock()
+		stopped := c.stoppedSources[sessionID]
+		c.mut.RUnlock()
+		if stopped {
+			c.log.Debug("ignoring track from stopped session", slog.String("sessionID", sessionID))
+			if err := receiver.Stop(); err != nil {
+				c.log.Error("failed to stop receiver", slog.String("err", err.Error()))
+			}
+			return
+		}
+
+		if (trackType == TrackTypeScreen || trackType == TrackTypeVideo) && !c.cfg.DisableAutoPLI {
+			c.log.Debug("sending PLI request for received video track", slog.String("trackID", track.ID()), slog.Any("SSRC", track.SSRC()))
 			if err := pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}}); err != nil {
 				c.log.Error("failed to write RTCP packet", slog.String("err", err.Error()))
 			}
@@ -310,6 +349,7 @@ func (c *Client) initRTCSession() error {
 
 		c.mut.Lock()
 		c.receivers[sessionID] = append(c.receivers[sessionID], receiver)
+		c.trackReceived(trackType, sessionID)
 		c.mut.Unlock()
 
 		// RTCP handler
@@ -352,43 +392,8 @@ func (c *Client) initRTCSession() error {
 			return
 		}
 
-		if dataCh := c.dc.Load(); c.cfg.EnableDCSignaling && dataCh != nil && dataCh.ReadyState() == webrtc.DataChannelStateOpen {
-			c.log.Debug("sending offer through dc")
-			data, err := json.Marshal(offer)
-			if err != nil {
-				c.log.Error("failed to marshal offer", slog.String("err", err.Error()))
-				return
-			}
-
-			msg, err := dc.EncodeMessage(dc.MessageTypeSDP, data)
-			if err != nil {
-				c.log.Error("failed to encode dc message", slog.String("err", err.Error()))
-				return
-			}
-
-			if err := dataCh.Send(msg); err != nil {
-				c.log.Error("failed to send on dc", slog.String("err", err.Error()))
-			}
-		} else {
-			if c.cfg.EnableDCSignaling {
-				c.log.Debug("dc not connected, sending offer through ws")
-			}
-
-			var sdpData bytes.Buffer
-			w := zlib.NewWriter(&sdpData)
-			if err := json.NewEncoder(w).Encode(offer); err != nil {
-				w.Close()
-				c.log.Error("failed to encode offer", slog.String("err", err.Error()))
-				return
-			}
-			w.Close()
-			err = c.SendWS(wsEventSDP, map[string]any{
-				"data": sdpData.Bytes(),
-			}, true)
-			if err != nil {
-				c.log.Error("failed to send ws msg", slog.String("err", err.Error()))
-				return
-			}
+		if err := c.sendSDP(sdpMessage{SessionDescription: offer}); err != nil {
+			c.log.Error("failed to send offer", slog.String("err", err.Error()))
 		}
 	})
 
@@ -399,6 +404,13 @@ func (c *Client) initRTCSession() error {
 		return fmt.Errorf("failed to create data channel: %w", err)
 	}
 	c.dc.Store(dataCh)
+	c.dcSignalingFailed.Store(false)
+
+	if c.cfg.EnableBandwidthProbe {
+		dataCh.OnOpen(func() {
+			go c.runBWProbe()
+		})
+	}
 
 	lastPingTS := new(int64)
 	lastRTT := new(int64)
@@ -476,14 +488,14 @@ func (c *Client) initRTCSession() error {
 				atomic.StoreInt64(lastRTT, time.Now().UnixMilli()-ts)
 			}
 		case dc.MessageTypeSDP:
-			var sdp webrtc.SessionDescription
+			var sdp sdpMessage
 			if err := json.Unmarshal(payload.([]byte), &sdp); err != nil {
 				c.log.Error("failed to unmarshal sdp", slog.String("err", err.Error()))
 				return
 			}
 			c.log.Debug("received sdp through DC", slog.String("sdp", sdp.SDP))
 			if sdp.Type == webrtc.SDPTypeOffer {
-				if err := c.handleOffer(sdp.SDP); err != nil {
+				if err := c.handleOffer(sdp.SDP, sdp.OfferSeq); err != nil {
 					c.log.Error("failed to offer", slog.String("err", err.Error()))
 				}
 			} else if sdp.Type == webrtc.SDPTypeAnswer {
@@ -491,6 +503,23 @@ func (c *Client) initRTCSession() error {
 					c.log.Error("failed to answer", slog.String("err", err.Error()))
 				}
 			}
+		case dc.MessageTypeBandwidthEstimation:
+			c.handleBWE(payload.(int))
+		case dc.MessageTypeAudioPLCHint:
+			// The server detected high loss on our voice track. The
+			// application is expected to increase the encoder's FEC.
+			c.log.Debug("received audio plc hint", slog.Any("lossRate", payload))
+			c.emit(RTCAudioPLCHintEvent, map[string]any{
+				"lossRate": payload.(float64),
+			})
+		case dc.MessageTypeSimulcastLevelChanged:
+			c.handleSimulcastLevelChanged(payload.(string))
+		case dc.MessageTypeICEServers:
+			if err := c.handleICEServers(payload.(dc.MessageICEServers)); err != nil {
+				c.log.Error("failed to update ice servers", slog.String("err", err.Error()))
+			}
+		case dc.MessageTypeMediaMap:
+			c.handleMediaMap(payload.(dc.MessageMediaMap))
 		default:
 			c.log.Error("unexpected dc message type", slog.Any("mt", mt))
 		}
@@ -498,3 +527,148 @@ func (c *Client) initRTCSession() error {
 
 	return nil
 }
+
+// handleICEServers updates the ICE servers, and TURN credentials, pushed by
+// the server. These replace the fetched ones as they go through the same
+// path as a refresh.
+func (c *Client) handleICEServers(msg dc.MessageICEServers) error {
+	var ttl time.Duration
+	iceServers := make([]webrtc.ICEServer, 0, len(msg))
+	for _, srv := range msg {
+		iceServers = append(iceServers, webrtc.ICEServer{
+			URLs:       srv.URLs,
+			Username:   srv.Username,
+			Credential: srv.Credential,
+		})
+		if srvTTL := time.Duration(srv.TTL) * time.Second; srvTTL > 0 && (ttl == 0 || srvTTL < ttl) {
+			ttl = srvTTL
+		}
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if c.pc == nil {
+		return fmt.Errorf("rtc client is not initialized")
+	}
+
+	c.log.Debug("updating ice servers", slog.Int("count", len(iceServers)))
+
+	return c.setICEServers(iceServers, ttl)
+}
+
+// handleMediaMap stores the media map sent by the server after each
+// negotiation and emits a RTCMediaMapEvent with it. Entries missing some
+// information fall back to what can be parsed from the track ID while those
+// that can't be attributed to a sender are skipped.
+func (c *Client) handleMediaMap(msg dc.MessageMediaMap) {
+	mediaMap := make(map[string]TrackInfo, len(msg))
+	for mid, track := range msg {
+		if mid == "" {
+			c.log.Debug("skipping media map entry with no mid", slog.String("trackID", track.TrackID))
+			continue
+		}
+
+		info := TrackInfo{
+			TrackID:   track.TrackID,
+			Type:      track.TrackType,
+			SessionID: track.SessionID,
+		}
+
+		if info.Type == "" || info.SessionID == "" {
+			trackType, sessionID, err := ParseTrackID(info.TrackID)
+			if err != nil {
+				c.log.Debug("skipping invalid media map entry", slog.String("mid", mid), slog.String("err", err.Error()))
+				continue
+			}
+			if info.Type == "" {
+				info.Type = trackType
+			}
+			if info.SessionID == "" {
+				info.SessionID = sessionID
+			}
+		}
+
+		mediaMap[mid] = info
+	}
+
+	c.log.Debug("received media map", slog.Int("count", len(mediaMap)))
+	c.mediaMap.Store(&mediaMap)
+
+	c.emit(RTCMediaMapEvent, maps.Clone(mediaMap))
+}
+
+// runBWProbe keeps the received video at the low simulcast level and only
+// requests the high one if the bandwidth estimations sent by the server
+// indicate sufficient downlink.
+func (c *Client) runBWProbe() {
+	if err := c.SetPreferredLayer(SimulcastLevelLow); err != nil {
+		c.log.Error("failed to set preferred layer", slog.String("err", err.Error()))
+		return
+	}
+
+	probe := newBWProbe(c.log, bwProbeDuration, bwProbeMaxDuration)
+	c.bwProbe.Store(probe)
+	level := probe.Run(c.wsCloseCh)
+	c.bwProbe.CompareAndSwap(probe, nil)
+
+	if level == SimulcastLevelHigh {
+		if err := c.SetPreferredLayer(SimulcastLevelHigh); err != nil {
+			c.log.Error("failed to set preferred layer", slog.String("err", err.Error()))
+		}
+	}
+}
+
+// handleBWE pauses video publishing when the bandwidth estimation reported by
+// the server drops below the configured VideoPauseBitrate and resumes it once
+// the estimation recovers. Estimations are also fed to the bandwidth probe,
+// if running.
+func (c *Client) handleBWE(rate int) {
+	if probe := c.bwProbe.Load(); probe != nil {
+		probe.addSample(rate)
+	}
+
+	if c.cfg.VideoPauseBitrate <= 0 {
+		return
+	}
+
+	if rate < c.cfg.VideoPauseBitrate {
+		if c.videoPaused.CompareAndSwap(false, true) {
+			c.log.Debug("pausing video", slog.Int("rate", rate))
+			c.emit(RTCVideoPausedEvent, map[string]any{
+				"rate": rate,
+			})
+		}
+		return
+	}
+
+	if rate >= int(float64(c.cfg.VideoPauseBitrate)*videoResumeRateMultiplier) && c.videoPaused.CompareAndSwap(true, false) {
+		c.log.Debug("resuming video", slog.Int("rate", rate))
+		c.emit(RTCVideoResumedEvent, map[string]any{
+			"rate": rate,
+		})
+	}
+}
+
+// handleSimulcastLevelChanged notifies the application that the server
+// switched the simulcast level of the screen track we are receiving (e.g.
+// quality reduced due to network conditions).
+func (c *Client) handleSimulcastLevelChanged(level string) {
+	c.log.Debug("received simulcast level change", slog.String("level", level))
+	c.emit(RTCLayerChangedEvent, map[string]any{
+		"level": level,
+	})
+}
+
+// stopReceivers stops all the receivers for the given session.
+// NOTE: this is expected to always be called under lock (c.mut).
+func (c *Client) stopReceivers(sessionID string) {
+	for _, rx := range c.receivers[sessionID] {
+		if err := rx.Stop(); err != nil {
+			c.log.Error("failed to stop receiver for session",
+				slog.String("sessionID", sessionID), slog.String("err", err.Error()))
+		}
+		c.clearTrackStatsSamples(rx)
+	}
+	delete(c.receivers, sessionID)
+}
@@ -4,9 +4,13 @@
 package client
 
 import (
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc/dc"
+
 	"github.com/pion/webrtc/v4"
 	"github.com/stretchr/testify/require"
 )
@@ -538,3 +542,369 @@ func TestRTCTrack(t *testing.T) {
 		}
 	})
 }
+
+func TestRTCHandleBWE(t *testing.T) {
+	c, err := New(Config{
+		SiteURL:           "http://localhost:8065",
+		AuthToken:         random.NewID(),
+		ChannelID:         random.NewID(),
+		VideoPauseBitrate: 200000,
+	})
+	require.NoError(t, err)
+
+	var pausedCount, resumedCount int
+	err = c.On(RTCVideoPausedEvent, func(_ any) error {
+		pausedCount++
+		return nil
+	})
+	require.NoError(t, err)
+	err = c.On(RTCVideoResumedEvent, func(_ any) error {
+		resumedCount++
+		return nil
+	})
+	require.NoError(t, err)
+
+	c.handleBWE(1000000)
+	require.False(t, c.IsVideoPaused())
+	require.Zero(t, pausedCount)
+
+	c.handleBWE(100000)
+	require.True(t, c.IsVideoPaused())
+	require.Equal(t, 1, pausedCount)
+
+	c.handleBWE(50000)
+	require.True(t, c.IsVideoPaused())
+	require.Equal(t, 1, pausedCount)
+
+	// Not enough to resume.
+	c.handleBWE(210000)
+	require.True(t, c.IsVideoPaused())
+	require.Zero(t, resumedCount)
+
+	c.handleBWE(300000)
+	require.False(t, c.IsVideoPaused())
+	require.Equal(t, 1, resumedCount)
+}
+
+func TestRTCHandleSimulcastLevelChanged(t *testing.T) {
+	c, err := New(Config{
+		SiteURL:   "http://localhost:8065",
+		AuthToken: random.NewID(),
+		ChannelID: random.NewID(),
+	})
+	require.NoError(t, err)
+
+	var levels []string
+	err = c.On(RTCLayerChangedEvent, func(ctx any) error {
+		levels = append(levels, ctx.(map[string]any)["level"].(string))
+		return nil
+	})
+	require.NoError(t, err)
+
+	c.handleSimulcastLevelChanged("l")
+	c.handleSimulcastLevelChanged("h")
+	require.Equal(t, []string{"l", "h"}, levels)
+}
+
+func TestRTCHandleICEServers(t *testing.T) {
+	c, err := New(Config{
+		SiteURL:   "http://localhost:8065",
+		AuthToken: random.NewID(),
+		ChannelID: random.NewID(),
+		ICEServers: []webrtc.ICEServer{
+			{
+				URLs: []string{"stun:stun.local:3478"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	msg := dc.MessageICEServers{
+		{
+			URLs:       []string{"turn:turn.example.com:3478"},
+			Username:   "username",
+			Credential: "credential",
+		},
+	}
+
+	t.Run("not initialized", func(t *testing.T) {
+		err := c.handleICEServers(msg)
+		require.EqualError(t, err, "rtc client is not initialized")
+	})
+
+	t.Run("updated", func(t *testing.T) {
+		c.pc, err = webrtc.NewPeerConnection(webrtc.Configuration{})
+		require.NoError(t, err)
+		defer c.pc.Close()
+
+		err := c.handleICEServers(msg)
+		require.NoError(t, err)
+		// The configured servers are kept.
+		require.Equal(t, []webrtc.ICEServer{
+			{
+				URLs: []string{"stun:stun.local:3478"},
+			},
+			{
+				URLs:       []string{"turn:turn.example.com:3478"},
+				Username:   "username",
+				Credential: "credential",
+			},
+		}, c.pc.GetConfiguration().ICEServers)
+		require.Equal(t, c.pc.GetConfiguration().ICEServers, c.rtcConfiguration().ICEServers)
+	})
+}
+
+func TestRTCHandleMediaMap(t *testing.T) {
+	c, err := New(Config{
+		SiteURL:   "http://localhost:8065",
+		AuthToken: random.NewID(),
+		ChannelID: random.NewID(),
+	})
+	require.NoError(t, err)
+
+	var emitted []map[string]TrackInfo
+	err = c.On(RTCMediaMapEvent, func(ctx any) error {
+		emitted = append(emitted, ctx.(map[string]TrackInfo))
+		return nil
+	})
+	require.NoError(t, err)
+
+	t.Run("not received", func(t *testing.T) {
+		require.Empty(t, c.MediaMap())
+	})
+
+	t.Run("full", func(t *testing.T) {
+		c.handleMediaMap(dc.MessageMediaMap{
+			"0": {
+				TrackID:   "voice_sessionA_trackA",
+				TrackType: TrackTypeVoice,
+				SessionID: "sessionA",
+			},
+			"1": {
+				TrackID:   "screen_sessionB_trackB",
+				TrackType: TrackTypeScreen,
+				SessionID: "sessionB",
+			},
+		})
+
+		expected := map[string]TrackInfo{
+			"0": {TrackID: "voice_sessionA_trackA", Type: TrackTypeVoice, SessionID: "sessionA"},
+			"1": {TrackID: "screen_sessionB_trackB", Type: TrackTypeScreen, SessionID: "sessionB"},
+		}
+		require.Equal(t, expected, c.MediaMap())
+		require.Len(t, emitted, 1)
+		require.Equal(t, expected, emitted[0])
+
+		// Callers get their own copy.
+		delete(c.MediaMap(), "0")
+		require.Equal(t, expected, c.MediaMap())
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		c.handleMediaMap(dc.MessageMediaMap{
+			"0": {
+				TrackID: "voice_sessionA_trackA",
+			},
+			"1": {
+				TrackID:   "invalid",
+				TrackType: TrackTypeScreen,
+			},
+			"": {
+				TrackID:   "video_sessionC_trackC",
+				TrackType: TrackTypeVideo,
+				SessionID: "sessionC",
+			},
+		})
+
+		require.Equal(t, map[string]TrackInfo{
+			"0": {TrackID: "voice_sessionA_trackA", Type: TrackTypeVoice, SessionID: "sessionA"},
+		}, c.MediaMap())
+		require.Len(t, emitted, 2)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		c.handleMediaMap(dc.MessageMediaMap{})
+		require.Empty(t, c.MediaMap())
+		require.Len(t, emitted, 3)
+		require.Empty(t, emitted[2])
+
+		c.handleMediaMap(nil)
+		require.Empty(t, c.MediaMap())
+		require.Len(t, emitted, 4)
+	})
+}
+
+func TestClientTrackStats(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		c, err := New(Config{
+			SiteURL:   "http://localhost:8065",
+			AuthToken: random.NewID(),
+			ChannelID: random.NewID(),
+		})
+		require.NoError(t, err)
+		require.Nil(t, c.TrackStats(random.NewID()))
+	})
+
+	t.Run("receiving", func(t *testing.T) {
+		th := setupTestHelper(t, "calls0")
+		th.userClient.cfg.EnableRTCMonitor = true
+
+		rtcConnectChA := make(chan struct{})
+		err := th.userClient.On(RTCConnectEvent, func(_ any) error {
+			close(rtcConnectChA)
+			return nil
+		})
+		require.NoError(t, err)
+
+		rtcConnectChB := make(chan struct{})
+		err = th.adminClient.On(RTCConnectEvent, func(_ any) error {
+			close(rtcConnectChB)
+			return nil
+		})
+		require.NoError(t, err)
+
+		rtcTrackCh := make(chan struct{})
+		err = th.userClient.On(RTCTrackEvent, func(_ any) error {
+			close(rtcTrackCh)
+			return nil
+		})
+		require.NoError(t, err)
+
+		go func() {
+			err := th.userClient.Connect()
+			require.NoError(t, err)
+		}()
+
+		go func() {
+			err := th.adminClient.Connect()
+			require.NoError(t, err)
+		}()
+
+		select {
+		case <-rtcConnectChA:
+		case <-time.After(waitTimeout):
+			require.Fail(t, "timed out waiting for rtc connect event")
+		}
+
+		select {
+		case <-rtcConnectChB:
+		case <-time.After(waitTimeout):
+			require.Fail(t, "timed out waiting for rtc connect event")
+		}
+
+		th.transmitAudioTrack(th.adminClient)
+
+		select {
+		case <-rtcTrackCh:
+		case <-time.After(waitTimeout):
+			require.Fail(t, "timed out waiting for rtc track event")
+		}
+
+		// First call primes the bitrate computation.
+		th.userClient.TrackStats(th.adminClient.originalConnID)
+		time.Sleep(time.Second)
+
+		stats := th.userClient.TrackStats(th.adminClient.originalConnID)
+		require.Contains(t, stats, TrackTypeVoice)
+		require.NotZero(t, stats[TrackTypeVoice].PacketsReceived)
+		require.NotZero(t, stats[TrackTypeVoice].Bitrate)
+
+		closeChA := make(chan struct{})
+		err = th.userClient.On(CloseEvent, func(_ any) error {
+			close(closeChA)
+			return nil
+		})
+		require.NoError(t, err)
+
+		closeChB := make(chan struct{})
+		err = th.adminClient.On(CloseEvent, func(_ any) error {
+			close(closeChB)
+			return nil
+		})
+		require.NoError(t, err)
+
+		go func() {
+			err := th.userClient.Close()
+			require.NoError(t, err)
+		}()
+
+		go func() {
+			err := th.adminClient.Close()
+			require.NoError(t, err)
+		}()
+
+		select {
+		case <-closeChA:
+		case <-time.After(waitTimeout):
+			require.Fail(t, "timed out waiting for close event")
+		}
+
+		select {
+		case <-closeChB:
+		case <-time.After(waitTimeout):
+			require.Fail(t, "timed out waiting for close event")
+		}
+	})
+}
+
+func TestRTCOpusFmtp(t *testing.T) {
+	getOpusFmtp := func(t *testing.T, cfg Config) string {
+		t.Helper()
+
+		cfg.SiteURL = "http://localhost:8065"
+		cfg.AuthToken = random.NewID()
+		cfg.ChannelID = random.NewID()
+		c, err := New(cfg)
+		require.NoError(t, err)
+
+		var m webrtc.MediaEngine
+		err = c.registerCodecs(&m)
+		require.NoError(t, err)
+		pc, err := webrtc.NewAPI(webrtc.WithMediaEngine(&m)).NewPeerConnection(webrtc.Configuration{})
+		require.NoError(t, err)
+		defer pc.Close()
+
+		_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio)
+		require.NoError(t, err)
+		offer, err := pc.CreateOffer(nil)
+		require.NoError(t, err)
+
+		for _, line := range strings.Split(offer.SDP, "\r\n") {
+			if fmtp, ok := strings.CutPrefix(line, "a=fmtp:111 "); ok {
+				return fmtp
+			}
+		}
+		require.FailNow(t, "opus fmtp line not found")
+		return ""
+	}
+
+	t.Run("default", func(t *testing.T) {
+		require.Equal(t, "minptime=10;useinbandfec=1", getOpusFmtp(t, Config{}))
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		fmtp := getOpusFmtp(t, Config{
+			OpusBitrate: 32000,
+		})
+		require.Equal(t, "minptime=10;useinbandfec=1;maxaveragebitrate=32000", fmtp)
+	})
+
+	t.Run("FEC disabled", func(t *testing.T) {
+		fmtp := getOpusFmtp(t, Config{
+			OpusBitrate:          32000,
+			DisableOpusInbandFEC: true,
+		})
+		require.Equal(t, "minptime=10;useinbandfec=0;maxaveragebitrate=32000", fmtp)
+	})
+
+	t.Run("invalid bitrate", func(t *testing.T) {
+		c, err := New(Config{
+			SiteURL:     "http://localhost:8065",
+			AuthToken:   random.NewID(),
+			ChannelID:   random.NewID(),
+			OpusBitrate: 1000,
+		})
+		require.EqualError(t, err, "failed to validate config: invalid OpusBitrate value: 1000 is not in allowed range [6000, 510000]")
+		require.Nil(t, c)
+	})
+}
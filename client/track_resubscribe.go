@@ -0,0 +1,134 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package client
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mattermost/rtcd/service/rtc/dc"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// trackResubscribeMaxAttempts is the maximum number of times the server is
+// asked to send again a track that was expected but never received.
+const trackResubscribeMaxAttempts = 3
+
+type expectedTrack struct {
+	timer    *time.Timer
+	attempts int
+}
+
+type trackKey struct {
+	trackType string
+	sessionID string
+}
+
+// expectTrack starts waiting for a track of the given type from the given
+// session. If the track doesn't arrive within the configured
+// TrackResubscribeTimeout (e.g. because a renegotiation failed), the server
+// is requested to send it again.
+func (c *Client) expectTrack(trackType, sessionID string) {
+	if c.cfg.TrackResubscribeTimeout <= 0 || sessionID == c.originalConnID {
+		return
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	key := trackKey{trackType, sessionID}
+	if c.receivedTracks[key] || c.expectedTracks[key] != nil || c.stoppedSources[sessionID] {
+		return
+	}
+
+	et := &expectedTrack{}
+	et.timer = time.AfterFunc(c.cfg.TrackResubscribeTimeout, func() {
+		c.mut.Lock()
+		if c.expectedTracks[key] != et {
+			c.mut.Unlock()
+			return
+		}
+		if et.attempts == trackResubscribeMaxAttempts {
+			delete(c.expectedTracks, key)
+			c.mut.Unlock()
+			c.log.Warn("expected track never received", slog.String("trackType", trackType), slog.String("sessionID", sessionID))
+			return
+		}
+		et.attempts++
+		attempt := et.attempts
+		et.timer.Reset(c.cfg.TrackResubscribeTimeout)
+		c.mut.Unlock()
+
+		c.log.Debug("expected track not received, resubscribing",
+			slog.String("trackType", trackType), slog.String("sessionID", sessionID), slog.Int("attempt", attempt))
+		if err := c.sendTrackResubscribe(trackType, sessionID); err != nil {
+			c.log.Error("failed to send track resubscribe", slog.String("err", err.Error()))
+		}
+	})
+	c.expectedTracks[key] = et
+}
+
+// trackReceived marks the track of the given type from the given session as
+// received.
+// NOTE: this is expected to always be called under lock (c.mut).
+func (c *Client) trackReceived(trackType, sessionID string) {
+	key := trackKey{trackType, sessionID}
+	if et := c.expectedTracks[key]; et != nil {
+		et.timer.Stop()
+		delete(c.expectedTracks, key)
+	}
+	c.receivedTracks[key] = true
+}
+
+// forgetTrack stops tracking the track of the given type from the given
+// session (e.g. after screen sharing ended). An empty sessionID matches any
+// session.
+func (c *Client) forgetTrack(trackType, sessionID string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	matches := func(key trackKey) bool {
+		return key.trackType == trackType && (sessionID == "" || key.sessionID == sessionID)
+	}
+
+	for key, et := range c.expectedTracks {
+		if matches(key) {
+			et.timer.Stop()
+			delete(c.expectedTracks, key)
+		}
+	}
+	for key := range c.receivedTracks {
+		if matches(key) {
+			delete(c.receivedTracks, key)
+		}
+	}
+}
+
+// clearExpectedTracks stops all the pending resubscribe timers.
+// NOTE: this is expected to always be called under lock (c.mut).
+func (c *Client) clearExpectedTracks() {
+	for key, et := range c.expectedTracks {
+		et.timer.Stop()
+		delete(c.expectedTracks, key)
+	}
+}
+
+func (c *Client) sendTrackResubscribe(trackType, sessionID string) error {
+	dataCh := c.dc.Load()
+	if dataCh == nil || dataCh.ReadyState() != webrtc.DataChannelStateOpen {
+		return fmt.Errorf("data channel is not open")
+	}
+
+	msg, err := dc.EncodeMessage(dc.MessageTypeTrackResubscribe, dc.MessageTrackResubscribe{
+		SessionID: sessionID,
+		TrackType: trackType,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode dc message: %w", err)
+	}
+
+	return dataCh.Send(msg)
+}
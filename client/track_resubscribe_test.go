@@ -0,0 +1,112 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectTrack(t *testing.T) {
+	newClient := func(t *testing.T, timeout time.Duration) *Client {
+		t.Helper()
+		c, err := New(Config{
+			SiteURL:                 "http://localhost:8065",
+			AuthToken:               random.NewID(),
+			ChannelID:               random.NewID(),
+			TrackResubscribeTimeout: timeout,
+		})
+		require.NoError(t, err)
+		c.originalConnID = random.NewID()
+		return c
+	}
+
+	getExpectedTrack := func(c *Client, trackType, sessionID string) *expectedTrack {
+		c.mut.RLock()
+		defer c.mut.RUnlock()
+		return c.expectedTracks[trackKey{trackType, sessionID}]
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		c := newClient(t, 0)
+		c.expectTrack(TrackTypeVoice, random.NewID())
+		require.Empty(t, c.expectedTracks)
+	})
+
+	t.Run("own session", func(t *testing.T) {
+		c := newClient(t, time.Minute)
+		c.expectTrack(TrackTypeVoice, c.originalConnID)
+		require.Empty(t, c.expectedTracks)
+	})
+
+	t.Run("stopped source", func(t *testing.T) {
+		c := newClient(t, time.Minute)
+		sessionID := random.NewID()
+		c.stoppedSources[sessionID] = true
+		c.expectTrack(TrackTypeVoice, sessionID)
+		require.Empty(t, c.expectedTracks)
+	})
+
+	t.Run("received", func(t *testing.T) {
+		c := newClient(t, time.Minute)
+		sessionID := random.NewID()
+
+		c.expectTrack(TrackTypeVoice, sessionID)
+		require.NotNil(t, getExpectedTrack(c, TrackTypeVoice, sessionID))
+
+		c.mut.Lock()
+		c.trackReceived(TrackTypeVoice, sessionID)
+		c.mut.Unlock()
+		require.Empty(t, c.expectedTracks)
+
+		// Already received tracks are not expected again.
+		c.expectTrack(TrackTypeVoice, sessionID)
+		require.Empty(t, c.expectedTracks)
+
+		c.forgetTrack(TrackTypeVoice, sessionID)
+		require.Empty(t, c.receivedTracks)
+		c.expectTrack(TrackTypeVoice, sessionID)
+		require.NotNil(t, getExpectedTrack(c, TrackTypeVoice, sessionID))
+		c.close()
+		require.Empty(t, c.expectedTracks)
+	})
+
+	t.Run("resubscribe attempts", func(t *testing.T) {
+		c := newClient(t, 10*time.Millisecond)
+		sessionID := random.NewID()
+
+		c.expectTrack(TrackTypeScreen, sessionID)
+		et := getExpectedTrack(c, TrackTypeScreen, sessionID)
+		require.NotNil(t, et)
+
+		// The track should stop being expected once the attempts are
+		// exhausted.
+		require.Eventually(t, func() bool {
+			return getExpectedTrack(c, TrackTypeScreen, sessionID) == nil
+		}, 2*time.Second, 10*time.Millisecond)
+		c.mut.RLock()
+		require.Equal(t, trackResubscribeMaxAttempts, et.attempts)
+		c.mut.RUnlock()
+	})
+
+	t.Run("forget any session", func(t *testing.T) {
+		c := newClient(t, time.Minute)
+		sessionA := random.NewID()
+		sessionB := random.NewID()
+
+		c.expectTrack(TrackTypeScreen, sessionA)
+		c.expectTrack(TrackTypeScreen, sessionB)
+		c.expectTrack(TrackTypeVoice, sessionA)
+		require.Len(t, c.expectedTracks, 3)
+
+		c.forgetTrack(TrackTypeScreen, "")
+		require.Len(t, c.expectedTracks, 1)
+		require.NotNil(t, getExpectedTrack(c, TrackTypeVoice, sessionA))
+		c.close()
+	})
+}
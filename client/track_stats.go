@@ -0,0 +1,96 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package client
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TrackStats holds statistics about the media being received from a remote
+// session for a given track type.
+type TrackStats struct {
+	// Bitrate is the receiving rate in bits per second computed since the
+	// previous call to TrackStats. It's zero on the first call.
+	Bitrate int
+	// PacketsReceived is the total number of RTP packets received.
+	PacketsReceived uint64
+	// PacketsLost is the total number of RTP packets lost.
+	PacketsLost int64
+	// LossRate is the fraction of packets lost over the total expected.
+	LossRate float64
+}
+
+type trackStatsSample struct {
+	bytesReceived uint64
+	ts            time.Time
+}
+
+// TrackStats returns the inbound statistics for the tracks currently received
+// from the given session, keyed by track type (e.g. TrackTypeVoice).
+// It requires Config.EnableRTCMonitor to be set, returning nil otherwise.
+func (c *Client) TrackStats(sessionID string) map[string]TrackStats {
+	if !c.cfg.EnableRTCMonitor {
+		return nil
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if c.statsGetter == nil {
+		return nil
+	}
+
+	now := time.Now()
+	res := make(map[string]TrackStats)
+	for _, rcv := range c.receivers[sessionID] {
+		for _, track := range rcv.Tracks() {
+			trackType, _, err := ParseTrackID(track.ID())
+			if err != nil {
+				continue
+			}
+
+			stats := c.statsGetter.Get(uint32(track.SSRC()))
+			if stats == nil {
+				continue
+			}
+
+			ts := res[trackType]
+			ts.PacketsReceived += stats.InboundRTPStreamStats.PacketsReceived
+			ts.PacketsLost += stats.InboundRTPStreamStats.PacketsLost
+
+			bytesReceived := stats.InboundRTPStreamStats.BytesReceived
+			if prev, ok := c.trackStatsSamples[track.SSRC()]; ok && bytesReceived >= prev.bytesReceived {
+				if elapsed := now.Sub(prev.ts).Seconds(); elapsed > 0 {
+					ts.Bitrate += int(float64(bytesReceived-prev.bytesReceived) * 8 / elapsed)
+				}
+			}
+			c.trackStatsSamples[track.SSRC()] = trackStatsSample{
+				bytesReceived: bytesReceived,
+				ts:            now,
+			}
+
+			res[trackType] = ts
+		}
+	}
+
+	for trackType, ts := range res {
+		if expected := float64(ts.PacketsReceived) + float64(ts.PacketsLost); expected > 0 && ts.PacketsLost > 0 {
+			ts.LossRate = float64(ts.PacketsLost) / expected
+			res[trackType] = ts
+		}
+	}
+
+	return res
+}
+
+// clearTrackStatsSamples removes the cached samples for the tracks of the
+// given receiver.
+// NOTE: this is expected to be called under lock (c.mut).
+func (c *Client) clearTrackStatsSamples(rcv *webrtc.RTPReceiver) {
+	for _, track := range rcv.Tracks() {
+		delete(c.trackStatsSamples, track.SSRC())
+	}
+}
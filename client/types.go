@@ -3,6 +3,10 @@
 
 package client
 
+import (
+	"github.com/pion/webrtc/v4"
+)
+
 const pluginID = "com.mattermost.calls"
 
 type CallJoinMessage struct {
@@ -10,6 +14,14 @@ type CallJoinMessage struct {
 	JobID       string `json:"jobID"`
 	AV1Support  bool   `json:"av1Support"`
 	DCSignaling bool   `json:"dcSignaling"`
+	Version     string `json:"version"`
+}
+
+// sdpMessage is the format of SDP messages exchanged with rtcd. OfferSeq is
+// set on offers and needs to be echoed back in the matching answer.
+type sdpMessage struct {
+	webrtc.SessionDescription
+	OfferSeq uint64 `json:"offerSeq,omitempty"`
 }
 
 type CallReconnectMessage struct {
@@ -18,6 +30,22 @@ type CallReconnectMessage struct {
 	PrevConnID     string `json:"prevConnID"`
 }
 
+// emojiData is the format of the emoji sent as part of a reaction.
+type emojiData struct {
+	Name    string `json:"name"`
+	Unified string `json:"unified"`
+}
+
+// CallReaction is the data emitted along with WSCallReactionEvent.
+type CallReaction struct {
+	UserID    string
+	SessionID string
+	// EmojiName is the short name of the emoji (e.g. "+1").
+	EmojiName string
+	// EmojiUnified is the emoji's unified code point (e.g. "1F44D").
+	EmojiUnified string
+}
+
 type CallJobState struct {
 	Type    string `json:"type"`
 	InitAt  int64  `json:"init_at"`
@@ -40,7 +68,22 @@ func (cjs *CallJobState) FromMap(m map[string]any) {
 	cjs.Err = err
 }
 
+// TrackInfo describes a track sent to the client, as found in the media map
+// (see Client.MediaMap).
+type TrackInfo struct {
+	TrackID   string
+	Type      string
+	SessionID string
+}
+
 const (
 	TrackTypeVoice  = "voice"
 	TrackTypeScreen = "screen"
+	TrackTypeVideo  = "video"
+)
+
+const (
+	SimulcastLevelHigh = "h"
+	SimulcastLevelMid  = "m"
+	SimulcastLevelLow  = "l"
 )
@@ -5,9 +5,17 @@ package client
 
 import (
 	"fmt"
+	"runtime/debug"
 	"strings"
 )
 
+const (
+	rtcdModulePath = "github.com/mattermost/rtcd"
+	// devVersion is reported when the module version is not known, e.g. when
+	// building from a local checkout.
+	devVersion = "0.0.0-dev"
+)
+
 // ParseTrackID returns the track type and session ID for the given
 // track ID.
 func ParseTrackID(trackID string) (string, string, error) {
@@ -18,3 +26,29 @@ func ParseTrackID(trackID string) (string, string, error) {
 
 	return fields[0], fields[1], nil
 }
+
+// getModuleVersion returns the version of the rtcd module the client is
+// built from.
+func getModuleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return devVersion
+	}
+
+	mod := &info.Main
+	for _, dep := range info.Deps {
+		if dep.Path == rtcdModulePath {
+			mod = dep
+			break
+		}
+	}
+	if mod.Replace != nil {
+		mod = mod.Replace
+	}
+
+	if mod.Path != rtcdModulePath || mod.Version == "" || mod.Version == "(devel)" {
+		return devVersion
+	}
+
+	return mod.Version
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package client
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+)
+
+// videoPauseInterceptorFactory creates interceptors dropping the outgoing
+// video packets (screen and camera) while publishing is paused because of low
+// bandwidth (Config.VideoPauseBitrate).
+type videoPauseInterceptorFactory struct {
+	paused *atomic.Bool
+}
+
+func (f *videoPauseInterceptorFactory) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+	return &videoPauseInterceptor{paused: f.paused}, nil
+}
+
+type videoPauseInterceptor struct {
+	interceptor.NoOp
+	paused *atomic.Bool
+}
+
+func (i *videoPauseInterceptor) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	if !strings.HasPrefix(strings.ToLower(info.MimeType), "video/") {
+		return writer
+	}
+
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		if i.paused.Load() {
+			return header.MarshalSize() + len(payload), nil
+		}
+		return writer.Write(header, payload, attributes)
+	})
+}
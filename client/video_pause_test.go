@@ -0,0 +1,56 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package client
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVideoPauseInterceptor(t *testing.T) {
+	var paused atomic.Bool
+	f := &videoPauseInterceptorFactory{paused: &paused}
+	i, err := f.NewInterceptor("")
+	require.NoError(t, err)
+
+	bind := func(mimeType string) (interceptor.RTPWriter, *int) {
+		var written int
+		writer := i.BindLocalStream(&interceptor.StreamInfo{MimeType: mimeType}, interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, _ interceptor.Attributes) (int, error) {
+			written++
+			return header.MarshalSize() + len(payload), nil
+		}))
+		return writer, &written
+	}
+
+	videoWriter, videoWritten := bind(webrtc.MimeTypeVP8)
+	audioWriter, audioWritten := bind(webrtc.MimeTypeOpus)
+
+	write := func() {
+		for _, w := range []interceptor.RTPWriter{videoWriter, audioWriter} {
+			n, err := w.Write(&rtp.Header{Version: 2}, make([]byte, 10), nil)
+			require.NoError(t, err)
+			require.Equal(t, 22, n)
+		}
+	}
+
+	write()
+	require.Equal(t, 1, *videoWritten)
+	require.Equal(t, 1, *audioWritten)
+
+	// Only video is dropped while paused.
+	paused.Store(true)
+	write()
+	require.Equal(t, 1, *videoWritten)
+	require.Equal(t, 2, *audioWritten)
+
+	paused.Store(false)
+	write()
+	require.Equal(t, 2, *videoWritten)
+	require.Equal(t, 3, *audioWritten)
+}
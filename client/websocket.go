@@ -36,6 +36,8 @@ const (
 	wsEventUnmute    = wsEvPrefix + "unmute"
 	wsEventScreenOn  = wsEvPrefix + "screen_on"
 	wsEventScreenOff = wsEvPrefix + "screen_off"
+	wsEventVideoOn   = wsEvPrefix + "video_on"
+	wsEventVideoOff  = wsEvPrefix + "video_off"
 	wsEventRaiseHand = wsEvPrefix + "raise_hand"
 	wsEventLowerHand = wsEvPrefix + "unraise_hand"
 	wsEventReact     = wsEvPrefix + "react"
@@ -45,20 +47,21 @@ const (
 	wsEventReconnect = wsEvPrefix + "reconnect"
 
 	// Server sent events
-	wsEventSignal          = wsEvPrefix + "signal"
-	wsEventError           = wsEvPrefix + "error"
-	wsEventUserLeft        = wsEvPrefix + "user_left"
-	wsEventCallEnd         = wsEvPrefix + "call_end"
-	wsEventCallJobState    = wsEvPrefix + "call_job_state"
-	wsEventJobStop         = wsEvPrefix + "job_stop"
-	wsEventCallHostChanged = wsEvPrefix + "call_host_changed"
-	wsEventUserMuted       = wsEvPrefix + "user_muted"
-	wsEventUserUnmuted     = wsEvPrefix + "user_unmuted"
-	wsEventUserRaisedHand  = wsEvPrefix + "user_raise_hand"
-	wsEventUserLoweredHand = wsEvPrefix + "user_unraise_hand"
-	wsEventUserScreenOn    = wsEvPrefix + "user_screen_on"
-	wsEventUserScreenOff   = wsEvPrefix + "user_screen_off"
-	wsEventUserReacted     = wsEvPrefix + "user_reacted"
+	wsEventSignal            = wsEvPrefix + "signal"
+	wsEventError             = wsEvPrefix + "error"
+	wsEventUserLeft          = wsEvPrefix + "user_left"
+	wsEventCallEnd           = wsEvPrefix + "call_end"
+	wsEventCallJobState      = wsEvPrefix + "call_job_state"
+	wsEventJobStop           = wsEvPrefix + "job_stop"
+	wsEventCallHostChanged   = wsEvPrefix + "call_host_changed"
+	wsEventUserMuted         = wsEvPrefix + "user_muted"
+	wsEventUserUnmuted       = wsEvPrefix + "user_unmuted"
+	wsEventUserRaisedHand    = wsEvPrefix + "user_raise_hand"
+	wsEventUserLoweredHand   = wsEvPrefix + "user_unraise_hand"
+	wsEventUserScreenOn      = wsEvPrefix + "user_screen_on"
+	wsEventUserScreenOff     = wsEvPrefix + "user_screen_off"
+	wsEventUserReacted       = wsEvPrefix + "user_reacted"
+	wsEventUserActiveSpeaker = wsEvPrefix + "user_active_speaker"
 )
 
 var (
@@ -189,16 +192,14 @@ func (c *Client) handleWSMsg(msg ws.Message) error {
 			if sessionID == "" {
 				return fmt.Errorf("missing session_id from user_left event")
 			}
+			c.log.Debug("stopping receivers for disconnected session", slog.String("sessionID", sessionID))
 			c.mut.Lock()
-			for _, rx := range c.receivers[sessionID] {
-				c.log.Debug("stopping receiver for disconnected session", slog.String("sessionID", sessionID))
-				if err := rx.Stop(); err != nil {
-					c.log.Error("failed to stop receiver for session",
-						slog.String("sessionID", sessionID), slog.String("err", err.Error()))
-				}
-				delete(c.receivers, sessionID)
-			}
+			c.stopReceivers(sessionID)
+			delete(c.stoppedSources, sessionID)
 			c.mut.Unlock()
+			c.forgetTrack(TrackTypeVoice, sessionID)
+			c.forgetTrack(TrackTypeScreen, sessionID)
+			c.forgetTrack(TrackTypeVideo, sessionID)
 		case wsEventCallEnd:
 			channelID := ev.GetBroadcast().ChannelId
 			if channelID == "" {
@@ -260,6 +261,8 @@ func (c *Client) handleWSMsg(msg ws.Message) error {
 			evType := WSCallUnmutedEvent
 			if ev.EventType() == wsEventUserMuted {
 				evType = WSCallMutedEvent
+			} else {
+				c.expectTrack(TrackTypeVoice, sessionID)
 			}
 			c.emit(evType, sessionID)
 		case wsEventUserRaisedHand, wsEventUserLoweredHand:
@@ -295,8 +298,49 @@ func (c *Client) handleWSMsg(msg ws.Message) error {
 			evType := WSCallScreenOnEvent
 			if ev.EventType() == wsEventUserScreenOff {
 				evType = WSCallScreenOffEvent
+				c.forgetTrack(TrackTypeScreen, sessionID)
+			} else {
+				c.expectTrack(TrackTypeScreen, sessionID)
 			}
 			c.emit(evType, sessionID)
+		case wsEventUserActiveSpeaker:
+			channelID := ev.GetBroadcast().ChannelId
+			if channelID == "" {
+				channelID, _ = ev.GetData()["channelID"].(string)
+			}
+			if channelID != c.cfg.ChannelID {
+				return nil
+			}
+			sessionID, _ := ev.GetData()["session_id"].(string)
+			if sessionID == "" {
+				return fmt.Errorf("missing session_id from %s event", ev.EventType())
+			}
+			c.emit(WSActiveSpeakerEvent, sessionID)
+		case wsEventUserReacted:
+			channelID := ev.GetBroadcast().ChannelId
+			if channelID == "" {
+				channelID, _ = ev.GetData()["channelID"].(string)
+			}
+			if channelID != c.cfg.ChannelID {
+				return nil
+			}
+			sessionID, _ := ev.GetData()["session_id"].(string)
+			if sessionID == "" {
+				return fmt.Errorf("missing session_id from %s event", ev.EventType())
+			}
+			emoji, _ := ev.GetData()["emoji"].(map[string]any)
+			name, _ := emoji["name"].(string)
+			if name == "" {
+				return fmt.Errorf("missing emoji from %s event", ev.EventType())
+			}
+			unified, _ := emoji["unified"].(string)
+			userID, _ := ev.GetData()["user_id"].(string)
+			c.emit(WSCallReactionEvent, CallReaction{
+				UserID:       userID,
+				SessionID:    sessionID,
+				EmojiName:    name,
+				EmojiUnified: unified,
+			})
 		default:
 		}
 	case ws.BinaryMessage:
@@ -33,3 +33,18 @@ func loadConfig(path string) (service.Config, error) {
 	}
 	return cfg, nil
 }
+
+// reloadConfig loads the config file again and applies it to the running
+// service. Failures are logged as the service keeps running with the
+// current config.
+func reloadConfig(s *service.Service, path string) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		log.Printf("rtcd: failed to reload config: %s", err.Error())
+		return
+	}
+
+	if err := s.Reload(cfg); err != nil {
+		log.Printf("rtcd: failed to reload config: %s", err.Error())
+	}
+}
@@ -37,8 +37,14 @@ func main() {
 	}
 
 	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	<-sig
+	signal.Notify(sig, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for s := range sig {
+		// SIGHUP reloads the config without restarting the service.
+		if s != syscall.SIGHUP {
+			break
+		}
+		reloadConfig(service, configPath)
+	}
 
 	if err := service.Stop(); err != nil {
 		log.Fatalf("rtcd: failed to stop service: %s", err.Error())
@@ -5,6 +5,7 @@ go 1.22.7
 require (
 	git.mills.io/prologic/bitcask v1.0.2
 	github.com/BurntSushi/toml v1.0.0
+	github.com/blang/semver/v4 v4.0.0
 	github.com/gorilla/websocket v1.5.1
 	github.com/grafana/pyroscope-go/godeltaprof v0.1.8
 	github.com/kelseyhightower/envconfig v1.4.0
@@ -15,10 +16,13 @@ require (
 	github.com/pion/logging v0.2.2
 	github.com/pion/rtcp v1.2.15
 	github.com/pion/rtp v1.8.9
+	github.com/pion/sdp/v3 v3.0.9
 	github.com/pion/stun/v3 v3.0.0
+	github.com/pion/turn/v4 v4.0.0
 	github.com/pion/webrtc/v4 v4.0.6
 	github.com/prometheus/client_golang v1.15.0
 	github.com/prometheus/procfs v0.9.0
+	github.com/redis/go-redis/v9 v9.7.3
 	github.com/stretchr/testify v1.10.0
 	github.com/vmihailenco/msgpack/v5 v5.4.1
 	golang.org/x/crypto v0.31.0
@@ -31,9 +35,9 @@ replace github.com/pion/interceptor v0.1.37 => github.com/streamer45/interceptor
 require (
 	github.com/abcum/lcp v0.0.0-20201209214815-7a3f3840be81 // indirect
 	github.com/beorn7/perks v1.0.1 // indirect
-	github.com/blang/semver/v4 v4.0.0 // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/dyatlov/go-opengraph/opengraph v0.0.0-20220524092352-606d7b1e5f8a // indirect
 	github.com/francoispqt/gojay v1.2.13 // indirect
 	github.com/go-asn1-ber/asn1-ber v1.5.5 // indirect
@@ -52,10 +56,8 @@ require (
 	github.com/pion/mdns/v2 v2.0.7 // indirect
 	github.com/pion/randutil v0.1.0 // indirect
 	github.com/pion/sctp v1.8.35 // indirect
-	github.com/pion/sdp/v3 v3.0.9 // indirect
 	github.com/pion/srtp/v3 v3.0.4 // indirect
 	github.com/pion/transport/v3 v3.0.7 // indirect
-	github.com/pion/turn/v4 v4.0.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/plar/go-adaptive-radix-tree v1.0.4 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
@@ -33,7 +33,28 @@ func New(config Config) (*mlog.Logger, error) {
 		return nil, err
 	}
 
+	if err := Configure(logger, config); err != nil {
+		return nil, err
+	}
+
+	return logger, nil
+}
+
+// Configure (re)configures the targets of the given logger with the given cfg.
+// It can be used to update a running logger (e.g. change its levels).
+func Configure(logger *mlog.Logger, config Config) error {
+	return ConfigureWithTargets(logger, config, nil, nil)
+}
+
+// ConfigureWithTargets is like Configure but also registers the given extra
+// targets. Targets of custom types get created through factories.
+func ConfigureWithTargets(logger *mlog.Logger, config Config, targets mlog.LoggerConfiguration, factories *mlog.Factories) error {
+	if err := config.IsValid(); err != nil {
+		return err
+	}
+
 	cfg := mlog.LoggerConfiguration{}
+	cfg.Append(targets)
 	if config.EnableConsole {
 		var format string
 		var formatOpts string
@@ -76,9 +97,5 @@ func New(config Config) (*mlog.Logger, error) {
 			MaxQueueSize:  1000,
 		}
 	}
-	if err := logger.ConfigureTargets(cfg, nil); err != nil {
-		return nil, err
-	}
-
-	return logger, nil
+	return logger.ConfigureTargets(cfg, factories)
 }
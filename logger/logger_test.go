@@ -4,6 +4,10 @@
 package logger
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -82,3 +86,88 @@ func TestNewLogger(t *testing.T) {
 		require.NotNil(t, logger)
 	})
 }
+
+func TestConfigure(t *testing.T) {
+	var cfg Config
+	cfg.EnableConsole = true
+	cfg.ConsoleLevel = "INFO"
+	logger, err := New(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, logger)
+	defer func() {
+		err := logger.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	t.Run("invalid cfg", func(t *testing.T) {
+		cfg.ConsoleLevel = "INVALID"
+		err := Configure(logger, cfg)
+		require.Error(t, err)
+		require.Equal(t, `invalid ConsoleLevel value "INVALID"`, err.Error())
+	})
+
+	t.Run("valid cfg", func(t *testing.T) {
+		cfg.ConsoleLevel = "DEBUG"
+		err := Configure(logger, cfg)
+		require.NoError(t, err)
+	})
+
+	t.Run("extra targets", func(t *testing.T) {
+		target := &testTarget{}
+		factories := &mlog.Factories{
+			TargetFactory: func(targetType string, _ json.RawMessage) (mlog.Target, error) {
+				if targetType != "test" {
+					return nil, fmt.Errorf("unsupported target type %q", targetType)
+				}
+				return target, nil
+			},
+		}
+
+		err := ConfigureWithTargets(logger, cfg, mlog.LoggerConfiguration{
+			"test": mlog.TargetCfg{
+				Type:   "test",
+				Levels: mlog.StdAll,
+				Format: "json",
+			},
+		}, factories)
+		require.NoError(t, err)
+
+		logger.Info("test message")
+		err = logger.Flush()
+		require.NoError(t, err)
+		require.Contains(t, target.String(), "test message")
+
+		// Reconfiguring without the extra targets removes them.
+		err = Configure(logger, cfg)
+		require.NoError(t, err)
+		logger.Info("other message")
+		err = logger.Flush()
+		require.NoError(t, err)
+		require.NotContains(t, target.String(), "other message")
+	})
+}
+
+type testTarget struct {
+	mut sync.Mutex
+	sb  strings.Builder
+}
+
+func (t *testTarget) Init() error {
+	return nil
+}
+
+func (t *testTarget) Write(p []byte, _ *mlog.LogRec) (int, error) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	return t.sb.Write(p)
+}
+
+func (t *testTarget) Shutdown() error {
+	return nil
+}
+
+func (t *testTarget) String() string {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	return t.sb.String()
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+// statusRecorder keeps track of the status code written to the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack is needed for WebSocket connections to be upgraded.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer (e.g.
+// to reset the write deadline on streaming responses).
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+type clientIDContextKey struct{}
+
+// SetClientID records the ID of the client the given request got
+// authenticated as so that it can be included in the access log. This is
+// needed for credentials, such as bearer tokens, which don't carry the ID
+// themselves. It's a no-op if access logging is disabled.
+func SetClientID(r *http.Request, clientID string) {
+	if id, ok := r.Context().Value(clientIDContextKey{}).(*string); ok {
+		*id = clientID
+	}
+}
+
+// accessLogHandler logs every request served by the given handler as
+// structured fields, with the duration expressed in seconds. Credentials
+// (e.g. the Authorization header or the basic auth password) and query
+// parameters are never logged.
+func (s *Server) accessLogHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		var authClientID string
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), clientIDContextKey{}, &authClientID)))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		// Falling back to the username part of basic auth credentials, which
+		// identifies the client, in case authentication didn't succeed.
+		clientID := authClientID
+		if clientID == "" {
+			clientID, _, _ = r.BasicAuth()
+		}
+
+		s.log.Info("api: request",
+			mlog.String("method", r.Method),
+			mlog.String("path", r.URL.Path),
+			mlog.Int("status", status),
+			mlog.Float("duration", time.Since(start).Seconds()),
+			mlog.String("clientID", clientID),
+			mlog.String("remoteAddr", r.RemoteAddr),
+		)
+	})
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+// getAffinityHint returns the affinity hint the request was sent with, if
+// any.
+func getAffinityHint(r *http.Request, cfg AffinityConfig) string {
+	if cfg.HeaderName != "" {
+		if hint := r.Header.Get(cfg.HeaderName); hint != "" {
+			return hint
+		}
+	}
+
+	if cfg.CookieName != "" {
+		if cookie, err := r.Cookie(cfg.CookieName); err == nil {
+			return cookie.Value
+		}
+	}
+
+	return ""
+}
+
+// affinityHandler sets a hint identifying this node on every response served
+// by the given handler, as a cookie and/or header (AffinityConfig). Load
+// balancers can then learn it to keep routing a client's requests, including
+// reconnecting WebSockets, to the node its calls are hosted on.
+//
+// Requests carrying a hint for a different node (e.g. because the node it
+// refers to is gone) are still served and the hint updated to point to
+// this node.
+func (s *Server) affinityHandler(next http.Handler) (http.Handler, error) {
+	cfg := s.cfg.Affinity
+
+	nodeID := cfg.NodeID
+	if nodeID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get hostname: %w", err)
+		}
+		nodeID = hostname
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hint := getAffinityHint(r, cfg); hint != "" && hint != nodeID {
+			s.log.Debug("api: request affinity hint points to a different node",
+				mlog.String("path", r.URL.Path),
+				mlog.String("hint", hint),
+				mlog.String("nodeID", nodeID),
+			)
+		}
+
+		if cfg.HeaderName != "" {
+			w.Header().Set(cfg.HeaderName, nodeID)
+		}
+
+		if cfg.CookieName != "" {
+			http.SetCookie(w, &http.Cookie{
+				Name:     cfg.CookieName,
+				Value:    nodeID,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   s.cfg.TLS.Enable,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+
+		next.ServeHTTP(w, r)
+	}), nil
+}
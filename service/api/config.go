@@ -6,6 +6,8 @@ package api
 import (
 	"crypto/tls"
 	"fmt"
+	"net/http"
+	"strings"
 )
 
 type TLSConfig struct {
@@ -31,9 +33,74 @@ func (c TLSConfig) IsValid() error {
 	return nil
 }
 
+// AffinityConfig controls the hints set on responses to help load balancers
+// route all the requests (and WebSocket connections) of a client to the same
+// node.
+type AffinityConfig struct {
+	Enable bool `toml:"enable"`
+	// NodeID identifies this node in the hints. Defaults to the hostname.
+	NodeID string `toml:"node_id"`
+	// CookieName is the name of the cookie holding the hint. If empty, no
+	// cookie is set.
+	CookieName string `toml:"cookie_name"`
+	// HeaderName is the name of the response header holding the hint. If
+	// empty, no header is set.
+	HeaderName string `toml:"header_name"`
+}
+
+func (c AffinityConfig) IsValid() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if c.CookieName == "" && c.HeaderName == "" {
+		return fmt.Errorf("invalid CookieName and HeaderName values: at least one should be set")
+	}
+
+	if c.CookieName != "" {
+		if err := (&http.Cookie{Name: c.CookieName}).Valid(); err != nil {
+			return fmt.Errorf("invalid CookieName value: %w", err)
+		}
+	}
+
+	if c.HeaderName != "" && !isHeaderName(c.HeaderName) {
+		return fmt.Errorf("invalid HeaderName value: %q is not a valid header name", c.HeaderName)
+	}
+
+	if c.NodeID != "" {
+		if err := (&http.Cookie{Name: "node", Value: c.NodeID}).Valid(); err != nil {
+			return fmt.Errorf("invalid NodeID value: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// isHeaderName returns whether name is a valid HTTP header field name, as
+// defined by RFC 7230.
+func isHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", r) {
+			return false
+		}
+	}
+	return true
+}
+
 type Config struct {
 	ListenAddress string `toml:"listen_address"`
 	TLS           TLSConfig
+	// EnableAccessLog controls whether every HTTP request served should be
+	// logged (method, path, status, duration, client ID and remote address).
+	EnableAccessLog bool `toml:"enable_access_log"`
+	// Affinity controls the load balancer affinity hints.
+	Affinity AffinityConfig `toml:"affinity"`
 }
 
 func (c Config) IsValid() error {
@@ -43,5 +110,8 @@ func (c Config) IsValid() error {
 	if err := c.TLS.IsValid(); err != nil {
 		return fmt.Errorf("invalid TLS config: %w", err)
 	}
+	if err := c.Affinity.IsValid(); err != nil {
+		return fmt.Errorf("invalid Affinity config: %w", err)
+	}
 	return nil
 }
@@ -64,3 +64,46 @@ func TestIsValid(t *testing.T) {
 		require.NoError(t, err)
 	})
 }
+
+func TestAffinityConfigIsValid(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		var cfg AffinityConfig
+		err := cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("no cookie nor header", func(t *testing.T) {
+		cfg := AffinityConfig{Enable: true}
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid CookieName and HeaderName values: at least one should be set")
+	})
+
+	t.Run("invalid cookie name", func(t *testing.T) {
+		cfg := AffinityConfig{Enable: true, CookieName: "rtcd node"}
+		err := cfg.IsValid()
+		require.ErrorContains(t, err, "invalid CookieName value")
+	})
+
+	t.Run("invalid header name", func(t *testing.T) {
+		cfg := AffinityConfig{Enable: true, HeaderName: "X-Rtcd:Node"}
+		err := cfg.IsValid()
+		require.EqualError(t, err, `invalid HeaderName value: "X-Rtcd:Node" is not a valid header name`)
+	})
+
+	t.Run("invalid node id", func(t *testing.T) {
+		cfg := AffinityConfig{Enable: true, HeaderName: "X-Rtcd-Node", NodeID: "rtcd;1"}
+		err := cfg.IsValid()
+		require.ErrorContains(t, err, "invalid NodeID value")
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		cfg := AffinityConfig{
+			Enable:     true,
+			NodeID:     "rtcd-1",
+			CookieName: "rtcd_node",
+			HeaderName: "X-Rtcd-Node",
+		}
+		err := cfg.IsValid()
+		require.NoError(t, err)
+	})
+}
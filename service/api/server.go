@@ -40,12 +40,22 @@ func NewServer(cfg Config, log mlog.LoggerIFace) (*Server, error) {
 					tls.CurveP256,
 				},
 			},
-			Handler: mux,
 		},
 		log: log,
 		cfg: cfg,
 		mux: mux,
 	}
+	s.srv.Handler = mux
+	if cfg.Affinity.Enable {
+		handler, err := s.affinityHandler(s.srv.Handler)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create affinity handler: %w", err)
+		}
+		s.srv.Handler = handler
+	}
+	if cfg.EnableAccessLog {
+		s.srv.Handler = s.accessLogHandler(s.srv.Handler)
+	}
 	return s, nil
 }
 
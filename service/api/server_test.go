@@ -4,10 +4,15 @@
 package api
 
 import (
+	"bytes"
 	"crypto/tls"
+	"encoding/json"
 	"net"
 	"net/http"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mattermost/mattermost/server/public/shared/mlog"
 	"github.com/stretchr/testify/require"
@@ -100,3 +105,263 @@ func TestStartServer(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+func TestAccessLog(t *testing.T) {
+	setup := func(t *testing.T, enable bool) (*Server, *bytes.Buffer, *mlog.Logger) {
+		t.Helper()
+
+		log, err := mlog.NewLogger()
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		err = mlog.AddWriterTarget(log, &buf, true, mlog.StdAll...)
+		require.NoError(t, err)
+
+		s, err := NewServer(Config{
+			ListenAddress:   ":0",
+			EnableAccessLog: enable,
+		}, log)
+		require.NoError(t, err)
+		s.RegisterHandleFunc("/register", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		})
+		s.RegisterHandleFunc("/bearer", func(w http.ResponseWriter, r *http.Request) {
+			SetClientID(r, "clientB")
+			w.WriteHeader(http.StatusOK)
+		})
+		s.RegisterHandleFunc("/stream", func(w http.ResponseWriter, _ *http.Request) {
+			if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+
+		err = s.Start()
+		require.NoError(t, err)
+
+		return s, &buf, log
+	}
+
+	getEntry := func(t *testing.T, buf *bytes.Buffer, path string) map[string]any {
+		t.Helper()
+
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if !strings.Contains(line, `"api: request"`) {
+				continue
+			}
+			var entry map[string]any
+			err := json.Unmarshal([]byte(line), &entry)
+			require.NoError(t, err)
+			if entry["path"] == path {
+				return entry
+			}
+		}
+		return nil
+	}
+
+	do := func(t *testing.T, s *Server, path string, setAuth func(req *http.Request)) int {
+		t.Helper()
+
+		_, port, err := net.SplitHostPort(s.listener.Addr().String())
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodGet, "http://localhost:"+port+path, nil)
+		require.NoError(t, err)
+		setAuth(req)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	register := func(t *testing.T, s *Server) {
+		t.Helper()
+
+		_, port, err := net.SplitHostPort(s.listener.Addr().String())
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:"+port+"/register?key=querySecret", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("clientA", "authSecret")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		s, buf, log := setup(t, true)
+		register(t, s)
+		err := s.Stop()
+		require.NoError(t, err)
+		err = log.Shutdown()
+		require.NoError(t, err)
+
+		entry := getEntry(t, buf, "/register")
+		require.NotNil(t, entry)
+		require.Equal(t, http.MethodPost, entry["method"])
+		require.Equal(t, "/register", entry["path"])
+		require.Equal(t, float64(http.StatusCreated), entry["status"])
+		require.Contains(t, entry, "duration")
+		require.Equal(t, "clientA", entry["clientID"])
+		require.NotEmpty(t, entry["remoteAddr"])
+
+		require.NotContains(t, buf.String(), "authSecret")
+		require.NotContains(t, buf.String(), "querySecret")
+		require.NotContains(t, buf.String(), "Authorization")
+	})
+
+	t.Run("bearer token", func(t *testing.T) {
+		s, buf, log := setup(t, true)
+		code := do(t, s, "/bearer", func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer tokenSecret")
+		})
+		require.Equal(t, http.StatusOK, code)
+		err := s.Stop()
+		require.NoError(t, err)
+		err = log.Shutdown()
+		require.NoError(t, err)
+
+		entry := getEntry(t, buf, "/bearer")
+		require.NotNil(t, entry)
+		require.Equal(t, "clientB", entry["clientID"])
+		require.NotContains(t, buf.String(), "tokenSecret")
+	})
+
+	t.Run("write deadline", func(t *testing.T) {
+		s, buf, log := setup(t, true)
+		code := do(t, s, "/stream", func(req *http.Request) {
+			req.SetBasicAuth("clientA", "authSecret")
+		})
+		require.Equal(t, http.StatusOK, code)
+		err := s.Stop()
+		require.NoError(t, err)
+		err = log.Shutdown()
+		require.NoError(t, err)
+
+		entry := getEntry(t, buf, "/stream")
+		require.NotNil(t, entry)
+		require.Equal(t, float64(http.StatusOK), entry["status"])
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		s, buf, log := setup(t, false)
+		register(t, s)
+		err := s.Stop()
+		require.NoError(t, err)
+		err = log.Shutdown()
+		require.NoError(t, err)
+
+		require.NotContains(t, buf.String(), `"api: request"`)
+	})
+}
+
+func TestAffinity(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	setup := func(t *testing.T, cfg AffinityConfig) string {
+		t.Helper()
+
+		s, err := NewServer(Config{
+			ListenAddress: ":0",
+			Affinity:      cfg,
+		}, log)
+		require.NoError(t, err)
+		s.RegisterHandleFunc("/version", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+		err = s.Start()
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			err := s.Stop()
+			require.NoError(t, err)
+		})
+
+		_, port, err := net.SplitHostPort(s.listener.Addr().String())
+		require.NoError(t, err)
+		return "http://localhost:" + port
+	}
+
+	getVersion := func(t *testing.T, req *http.Request) *http.Response {
+		t.Helper()
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp
+	}
+
+	getCookie := func(resp *http.Response, name string) *http.Cookie {
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == name {
+				return cookie
+			}
+		}
+		return nil
+	}
+
+	cfg := AffinityConfig{
+		Enable:     true,
+		NodeID:     "rtcd-1",
+		CookieName: "rtcd_node",
+		HeaderName: "X-Rtcd-Node",
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		u := setup(t, cfg)
+
+		req, err := http.NewRequest(http.MethodGet, u+"/version", nil)
+		require.NoError(t, err)
+		resp := getVersion(t, req)
+		require.Equal(t, "rtcd-1", resp.Header.Get("X-Rtcd-Node"))
+		cookie := getCookie(resp, "rtcd_node")
+		require.NotNil(t, cookie)
+		require.Equal(t, "rtcd-1", cookie.Value)
+		require.Equal(t, "/", cookie.Path)
+		require.True(t, cookie.HttpOnly)
+	})
+
+	t.Run("hint for another node", func(t *testing.T) {
+		u := setup(t, cfg)
+
+		req, err := http.NewRequest(http.MethodGet, u+"/version", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Rtcd-Node", "rtcd-2")
+		req.AddCookie(&http.Cookie{Name: "rtcd_node", Value: "rtcd-2"})
+		resp := getVersion(t, req)
+		require.Equal(t, "rtcd-1", resp.Header.Get("X-Rtcd-Node"))
+		cookie := getCookie(resp, "rtcd_node")
+		require.NotNil(t, cookie)
+		require.Equal(t, "rtcd-1", cookie.Value)
+	})
+
+	t.Run("header only with default node ID", func(t *testing.T) {
+		hostname, err := os.Hostname()
+		require.NoError(t, err)
+
+		u := setup(t, AffinityConfig{
+			Enable:     true,
+			HeaderName: "X-Rtcd-Node",
+		})
+
+		req, err := http.NewRequest(http.MethodGet, u+"/version", nil)
+		require.NoError(t, err)
+		resp := getVersion(t, req)
+		require.Equal(t, hostname, resp.Header.Get("X-Rtcd-Node"))
+		require.Nil(t, getCookie(resp, "rtcd_node"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		u := setup(t, AffinityConfig{})
+
+		req, err := http.NewRequest(http.MethodGet, u+"/version", nil)
+		require.NoError(t, err)
+		resp := getVersion(t, req)
+		require.Empty(t, resp.Header.Get("X-Rtcd-Node"))
+		require.Empty(t, resp.Cookies())
+	})
+}
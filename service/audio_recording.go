@@ -0,0 +1,255 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+const (
+	// audioRecordingChannels is the channel count of the mixed audio.
+	audioRecordingChannels  = 1
+	audioRecordingClockRate = 48000
+	// audioRecordingFrameSize is the number of samples in a 20ms frame.
+	audioRecordingFrameSize     = audioRecordingClockRate / 50
+	audioRecordingMaxPacketSize = 1500
+)
+
+var (
+	errAudioRecordingActive    = errors.New("recording already active")
+	errAudioRecordingNotActive = errors.New("recording not active")
+)
+
+// audioRecording writes the mixed audio of a call to an Ogg file. It's the
+// sink of the call's audio mixer so that it gets closed whenever the mixer
+// stops, including when the call ends.
+type audioRecording struct {
+	s        *Service
+	clientID string
+	callID   string
+	w        *oggwriter.OggWriter
+	encoder  rtc.AudioEncoder
+	// hasData is whether any audio was written. It's only accessed by the
+	// mixer.
+	hasData bool
+
+	mut sync.Mutex
+	// connID is the connection the final job state is sent to.
+	connID string
+}
+
+func (r *audioRecording) WriteRTP(packet *rtp.Packet) error {
+	r.hasData = true
+	return r.w.WriteRTP(packet)
+}
+
+// writeSilence writes a single silent frame. The Ogg writer needs at least a
+// data page to properly terminate the stream.
+func (r *audioRecording) writeSilence() error {
+	data := make([]byte, audioRecordingMaxPacketSize)
+	n, err := r.encoder.Encode(make([]int16, audioRecordingFrameSize), data)
+	if err != nil {
+		return fmt.Errorf("failed to encode: %w", err)
+	}
+	return r.WriteRTP(&rtp.Packet{Payload: data[:n]})
+}
+
+func (r *audioRecording) Close() error {
+	r.s.removeAudioRecording(r.clientID, r.callID)
+
+	state := CallJobState{
+		CallID: r.callID,
+		Type:   CallJobTypeAudioRecording,
+		EndAt:  time.Now().UnixMilli(),
+	}
+
+	var err error
+	if !r.hasData {
+		err = r.writeSilence()
+	}
+	if closeErr := r.w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		state.Err = fmt.Sprintf("failed to close recording: %s", err.Error())
+	}
+
+	r.mut.Lock()
+	connID := r.connID
+	r.mut.Unlock()
+
+	r.s.log.Info("audio recording stopped", mlog.String("callID", r.callID))
+
+	if err := r.s.sendCallJobState(connID, r.clientID, state); err != nil {
+		r.s.log.Error("failed to send job state", mlog.Err(err), mlog.String("callID", r.callID))
+	}
+
+	return err
+}
+
+func audioRecordingKey(clientID, callID string) string {
+	return clientID + "/" + callID
+}
+
+func (s *Service) removeAudioRecording(clientID, callID string) {
+	s.audioRecordingsMut.Lock()
+	defer s.audioRecordingsMut.Unlock()
+	delete(s.audioRecordings, audioRecordingKey(clientID, callID))
+}
+
+// startAudioRecording starts recording the mixed audio of the given call to a
+// file in the configured recordings directory. Clients can only record calls
+// belonging to their own group.
+func (s *Service) startAudioRecording(connID, clientID, callID string) error {
+	state := CallJobState{
+		CallID: callID,
+		Type:   CallJobTypeAudioRecording,
+	}
+
+	if err := s.doStartAudioRecording(connID, clientID, callID); err != nil {
+		s.log.Error("failed to start audio recording", mlog.Err(err), mlog.String("callID", callID))
+		state.Err = err.Error()
+	} else {
+		state.StartAt = time.Now().UnixMilli()
+	}
+
+	return s.sendCallJobState(connID, clientID, state)
+}
+
+func (s *Service) doStartAudioRecording(connID, clientID, callID string) error {
+	if s.cfg.Recording.AudioDir == "" {
+		return fmt.Errorf("audio recordings are disabled")
+	}
+
+	if s.newAudioDecoder == nil || s.newAudioEncoder == nil {
+		return fmt.Errorf("audio recordings are unavailable: no audio codecs configured")
+	}
+
+	// The callID ends up in the file name so it shouldn't be able to point
+	// outside of the recordings directory.
+	if filepath.Base(callID) != callID || callID == "." || callID == ".." {
+		return fmt.Errorf("invalid callID")
+	}
+
+	if !s.hasCall(clientID, callID) {
+		return fmt.Errorf("failed to start recording: %w", rtc.ErrCallNotFound)
+	}
+
+	key := audioRecordingKey(clientID, callID)
+	s.audioRecordingsMut.Lock()
+	defer s.audioRecordingsMut.Unlock()
+	if s.audioRecordings[key] != nil {
+		return fmt.Errorf("failed to start recording: %w", errAudioRecordingActive)
+	}
+
+	if err := os.MkdirAll(s.cfg.Recording.AudioDir, 0700); err != nil {
+		return fmt.Errorf("failed to create recordings directory: %w", err)
+	}
+
+	encoder, err := s.newAudioEncoder()
+	if err != nil {
+		return fmt.Errorf("failed to create audio encoder: %w", err)
+	}
+
+	name := fmt.Sprintf("%s_%d_%s.ogg", callID, time.Now().UnixMilli(), random.NewID())
+	path := filepath.Join(s.cfg.Recording.AudioDir, name)
+	w, err := oggwriter.New(path, audioRecordingClockRate, audioRecordingChannels)
+	if err != nil {
+		return fmt.Errorf("failed to create recording file: %w", err)
+	}
+
+	rec := &audioRecording{
+		s:        s,
+		clientID: clientID,
+		callID:   callID,
+		w:        w,
+		encoder:  encoder,
+		connID:   connID,
+	}
+	// Registering before starting so that the entry can't be left behind if
+	// the call ends right away.
+	s.audioRecordings[key] = rec
+
+	err = s.rtcServer.StartCallAudioMixer(clientID, callID, rtc.AudioMixerConfig{
+		NewDecoder: s.newAudioDecoder,
+		Encoder:    encoder,
+		Sink:       rec,
+	})
+	if err != nil {
+		delete(s.audioRecordings, key)
+		w.Close()
+		os.Remove(path)
+		if errors.Is(err, rtc.ErrAudioMixerActive) {
+			err = errAudioRecordingActive
+		}
+		return fmt.Errorf("failed to start recording: %w", err)
+	}
+
+	s.log.Info("audio recording started", mlog.String("callID", callID), mlog.String("file", path))
+
+	return nil
+}
+
+// hasCall returns whether the given call is active in the given group.
+func (s *Service) hasCall(groupID, callID string) bool {
+	for _, c := range s.rtcServer.GetCalls() {
+		if c.GroupID == groupID && c.CallID == callID {
+			return true
+		}
+	}
+	return false
+}
+
+// stopAudioRecording stops the audio recording of the given call, if any.
+// The final job state is sent once the recording file is closed.
+func (s *Service) stopAudioRecording(connID, clientID, callID string) error {
+	s.audioRecordingsMut.Lock()
+	rec := s.audioRecordings[audioRecordingKey(clientID, callID)]
+	s.audioRecordingsMut.Unlock()
+
+	if rec == nil {
+		return s.sendCallJobState(connID, clientID, CallJobState{
+			CallID: callID,
+			Type:   CallJobTypeAudioRecording,
+			Err:    fmt.Sprintf("failed to stop recording: %s", errAudioRecordingNotActive.Error()),
+		})
+	}
+
+	rec.mut.Lock()
+	rec.connID = connID
+	rec.mut.Unlock()
+
+	if err := s.rtcServer.StopCallAudioMixer(clientID, callID); err != nil {
+		s.log.Error("failed to stop audio recording", mlog.Err(err), mlog.String("callID", callID))
+		return s.sendCallJobState(connID, clientID, CallJobState{
+			CallID: callID,
+			Type:   CallJobTypeAudioRecording,
+			Err:    fmt.Sprintf("failed to stop recording: %s", err.Error()),
+		})
+	}
+
+	return nil
+}
+
+func (s *Service) sendCallJobState(connID, clientID string, state CallJobState) error {
+	data, err := NewPackedClientMessage(ClientMessageCallJobState, state)
+	if err != nil {
+		return fmt.Errorf("failed to pack job state message: %w", err)
+	}
+
+	return s.sendClientMessage(connID, clientID, data)
+}
@@ -0,0 +1,279 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/auth"
+	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc"
+
+	"github.com/pion/webrtc/v4/pkg/media/oggreader"
+	"github.com/stretchr/testify/require"
+)
+
+// testAudioCodec is a fake codec passing the first sample of each frame
+// through.
+type testAudioCodec struct{}
+
+func (testAudioCodec) Decode(data []byte, pcm []int16) (int, error) {
+	if len(data) < 2 {
+		return 0, fmt.Errorf("short payload")
+	}
+	for i := range pcm {
+		pcm[i] = int16(binary.BigEndian.Uint16(data))
+	}
+	return len(pcm), nil
+}
+
+func (testAudioCodec) Encode(pcm []int16, data []byte) (int, error) {
+	binary.BigEndian.PutUint16(data, uint16(pcm[0]))
+	return 2, nil
+}
+
+func withTestAudioCodecs() ServiceOption {
+	return WithAudioCodecs(func() (rtc.AudioDecoder, error) {
+		return testAudioCodec{}, nil
+	}, func() (rtc.AudioEncoder, error) {
+		return testAudioCodec{}, nil
+	})
+}
+
+func TestAudioRecording(t *testing.T) {
+	cfg := MakeDefaultCfg(t)
+	cfg.Recording.AudioDir = t.TempDir()
+	th := SetupTestHelper(t, cfg, withTestAudioCodecs())
+	defer th.Teardown()
+
+	clientID := "clientA"
+	authKey, err := random.NewSecureString(auth.MinKeyLen)
+	require.NoError(t, err)
+	err = th.adminClient.Register(clientID, authKey)
+	require.NoError(t, err)
+
+	c, err := NewClient(ClientConfig{
+		URL:      th.apiURL,
+		ClientID: clientID,
+		AuthKey:  authKey,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	err = c.Connect()
+	require.NoError(t, err)
+
+	msg, ok := <-c.ReceiveCh()
+	require.True(t, ok)
+	require.Equal(t, ClientMessageHello, msg.Type)
+
+	waitJobState := func() CallJobState {
+		t.Helper()
+		select {
+		case msg, ok := <-c.ReceiveCh():
+			require.True(t, ok)
+			require.Equal(t, ClientMessageCallJobState, msg.Type)
+			state, ok := msg.Data.(CallJobState)
+			require.True(t, ok)
+			return state
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for job state message")
+		}
+		return CallJobState{}
+	}
+
+	t.Run("call not found", func(t *testing.T) {
+		err := c.StartAudioRecording("callA")
+		require.NoError(t, err)
+
+		state := waitJobState()
+		require.Equal(t, "callA", state.CallID)
+		require.Equal(t, CallJobTypeAudioRecording, state.Type)
+		require.Zero(t, state.StartAt)
+		require.Equal(t, "failed to start recording: call not found", state.Err)
+	})
+
+	sessionID := random.NewID()
+	err = c.Send(*NewClientMessage(ClientMessageJoin, map[string]any{
+		"callID":    "callA",
+		"userID":    random.NewID(),
+		"sessionID": sessionID,
+	}))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		th.srvc.mut.RLock()
+		defer th.srvc.mut.RUnlock()
+		return th.srvc.connMap[sessionID] != ""
+	}, 5*time.Second, 10*time.Millisecond)
+
+	t.Run("invalid callID", func(t *testing.T) {
+		err := c.StartAudioRecording("../callA")
+		require.NoError(t, err)
+
+		state := waitJobState()
+		require.Equal(t, "invalid callID", state.Err)
+	})
+
+	t.Run("not active", func(t *testing.T) {
+		err := c.StopAudioRecording("callA")
+		require.NoError(t, err)
+
+		state := waitJobState()
+		require.Equal(t, "failed to stop recording: recording not active", state.Err)
+	})
+
+	t.Run("start and stop", func(t *testing.T) {
+		err := c.StartAudioRecording("callA")
+		require.NoError(t, err)
+
+		state := waitJobState()
+		require.Equal(t, "callA", state.CallID)
+		require.Equal(t, CallJobTypeAudioRecording, state.Type)
+		require.Empty(t, state.Err)
+		require.NotZero(t, state.StartAt)
+		require.Zero(t, state.EndAt)
+
+		err = c.StartAudioRecording("callA")
+		require.NoError(t, err)
+		state = waitJobState()
+		require.Equal(t, "failed to start recording: recording already active", state.Err)
+
+		err = c.StopAudioRecording("callA")
+		require.NoError(t, err)
+
+		state = waitJobState()
+		require.Equal(t, "callA", state.CallID)
+		require.Empty(t, state.Err)
+		require.NotZero(t, state.EndAt)
+
+		files, err := filepath.Glob(filepath.Join(cfg.Recording.AudioDir, "callA_*.ogg"))
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+
+		// A single mixed stream, properly terminated.
+		data, err := os.ReadFile(files[0])
+		require.NoError(t, err)
+		_, header, err := oggreader.NewWith(bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, uint8(1), header.Channels)
+		lastPage := bytes.LastIndex(data, []byte("OggS"))
+		require.NotEqual(t, -1, lastPage)
+		require.NotZero(t, data[lastPage+5]&0x04)
+	})
+
+	t.Run("call end", func(t *testing.T) {
+		err := c.StartAudioRecording("callA")
+		require.NoError(t, err)
+
+		state := waitJobState()
+		require.Empty(t, state.Err)
+		require.NotZero(t, state.StartAt)
+
+		err = th.srvc.rtcServer.CloseSession(sessionID, rtc.CloseReasonLeft)
+		require.NoError(t, err)
+
+		// The recording gets stopped automatically, sending a final state.
+		state = waitJobState()
+		require.Equal(t, "callA", state.CallID)
+		require.Equal(t, CallJobTypeAudioRecording, state.Type)
+		require.Empty(t, state.Err)
+		require.NotZero(t, state.EndAt)
+
+		th.srvc.audioRecordingsMut.Lock()
+		defer th.srvc.audioRecordingsMut.Unlock()
+		require.Empty(t, th.srvc.audioRecordings)
+	})
+}
+
+func TestAudioRecordingNoCodecs(t *testing.T) {
+	cfg := MakeDefaultCfg(t)
+	cfg.Recording.AudioDir = t.TempDir()
+	th := SetupTestHelper(t, cfg)
+	defer th.Teardown()
+
+	clientID := "clientA"
+	authKey, err := random.NewSecureString(auth.MinKeyLen)
+	require.NoError(t, err)
+	err = th.adminClient.Register(clientID, authKey)
+	require.NoError(t, err)
+
+	c, err := NewClient(ClientConfig{
+		URL:      th.apiURL,
+		ClientID: clientID,
+		AuthKey:  authKey,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	err = c.Connect()
+	require.NoError(t, err)
+
+	msg, ok := <-c.ReceiveCh()
+	require.True(t, ok)
+	require.Equal(t, ClientMessageHello, msg.Type)
+
+	err = c.StartAudioRecording("callA")
+	require.NoError(t, err)
+
+	select {
+	case msg, ok := <-c.ReceiveCh():
+		require.True(t, ok)
+		require.Equal(t, ClientMessageCallJobState, msg.Type)
+		require.Equal(t, CallJobState{
+			CallID: "callA",
+			Type:   CallJobTypeAudioRecording,
+			Err:    "audio recordings are unavailable: no audio codecs configured",
+		}, msg.Data)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for job state message")
+	}
+}
+
+func TestAudioRecordingDisabled(t *testing.T) {
+	th := SetupTestHelper(t, nil)
+	defer th.Teardown()
+
+	clientID := "clientA"
+	authKey, err := random.NewSecureString(auth.MinKeyLen)
+	require.NoError(t, err)
+	err = th.adminClient.Register(clientID, authKey)
+	require.NoError(t, err)
+
+	c, err := NewClient(ClientConfig{
+		URL:      th.apiURL,
+		ClientID: clientID,
+		AuthKey:  authKey,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	err = c.Connect()
+	require.NoError(t, err)
+
+	msg, ok := <-c.ReceiveCh()
+	require.True(t, ok)
+	require.Equal(t, ClientMessageHello, msg.Type)
+
+	err = c.StartAudioRecording("callA")
+	require.NoError(t, err)
+
+	select {
+	case msg, ok := <-c.ReceiveCh():
+		require.True(t, ok)
+		require.Equal(t, ClientMessageCallJobState, msg.Type)
+		require.Equal(t, CallJobState{
+			CallID: "callA",
+			Type:   CallJobTypeAudioRecording,
+			Err:    "audio recordings are disabled",
+		}, msg.Data)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for job state message")
+	}
+}
@@ -10,6 +10,9 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/mattermost/rtcd/service/api"
+	"github.com/mattermost/rtcd/service/auth"
+
 	"github.com/mattermost/mattermost/server/public/shared/mlog"
 )
 
@@ -29,6 +32,10 @@ func (s *Service) authHandler(w http.ResponseWriter, r *http.Request) (clientID
 		data.reqData["clientID"] = clientID
 
 		s.httpAudit("authHandler", data, nil, r)
+
+		if err == nil {
+			api.SetClientID(r, clientID)
+		}
 	}()
 
 	if strings.HasPrefix(r.Header.Get("Authorization"), bearerPrefix) {
@@ -53,6 +60,7 @@ func (s *Service) basicAuthHandler(_ http.ResponseWriter, r *http.Request) (stri
 
 	if err := s.auth.Authenticate(clientID, authKey); err != nil {
 		s.log.Error("authentication failed", mlog.Err(err), mlog.String("clientID", clientID))
+		s.handleAuthError(clientID, err)
 		return "", http.StatusUnauthorized, errors.New("authentication failed")
 	}
 
@@ -77,6 +85,23 @@ func (s *Service) bearerAuthHandler(_ http.ResponseWriter, r *http.Request) (str
 	return session.ClientID, http.StatusOK, nil
 }
 
+// handleAuthError records auth failures that require an admin to intervene.
+func (s *Service) handleAuthError(clientID string, err error) {
+	if errors.Is(err, auth.ErrCorruptedEntry) {
+		s.log.Error("corrupted store entry found, client should be unregistered to recover", mlog.String("clientID", clientID))
+		s.metrics.IncAuthErrors("corrupted_entry")
+	}
+}
+
+func (s *Service) updateRegisteredClientsMetric() {
+	count, err := s.auth.ClientsCount()
+	if err != nil {
+		s.log.Error("failed to get registered clients count", mlog.Err(err))
+		return
+	}
+	s.metrics.SetRegisteredClients(count)
+}
+
 func parseBearerAuth(auth string) (token string, ok bool) {
 	if len(auth) < len(bearerPrefix) || !strings.EqualFold(auth[:len(bearerPrefix)], bearerPrefix) {
 		return
@@ -113,12 +138,32 @@ func (s *Service) registerClient(w http.ResponseWriter, r *http.Request) {
 
 	clientID := data.reqData["clientID"]
 	authKey := data.reqData["authKey"]
+
+	s.registerMut.Lock()
+	defer s.registerMut.Unlock()
+
+	if maxClients := s.cfg.API.Security.MaxRegisteredClients; maxClients > 0 {
+		count, err := s.auth.ClientsCount()
+		if err != nil {
+			data.err = err.Error()
+			data.code = http.StatusInternalServerError
+			return
+		}
+		if count >= maxClients {
+			data.err = "registration failed: max registered clients reached"
+			data.code = http.StatusForbidden
+			return
+		}
+	}
+
 	err := s.auth.Register(clientID, authKey)
 	if err != nil {
+		s.handleAuthError(clientID, err)
 		data.err = err.Error()
 		data.code = http.StatusBadRequest
 		return
 	}
+	s.updateRegisteredClientsMetric()
 
 	s.log.Debug("registered new client", mlog.String("clientID", clientID))
 	data.code = http.StatusCreated
@@ -181,6 +226,7 @@ func (s *Service) unregisterClient(w http.ResponseWriter, r *http.Request) {
 		data.code = http.StatusBadRequest
 		return
 	}
+	s.updateRegisteredClientsMetric()
 
 	s.log.Debug("unregistered client", mlog.String("clientID", clientID))
 	data.code = http.StatusOK
@@ -208,6 +254,7 @@ func (s *Service) loginClient(w http.ResponseWriter, r *http.Request) {
 	authKey := data.reqData["authKey"]
 	bearerToken, err := s.auth.Login(clientID, authKey)
 	if err != nil {
+		s.handleAuthError(clientID, err)
 		data.err = err.Error()
 		data.code = http.StatusBadRequest
 		return
@@ -40,6 +40,15 @@ func hashKey(key string) (string, error) {
 	return string(hash), nil
 }
 
+// validateKeyHash checks whether the given hash is a well formed bcrypt hash.
+func validateKeyHash(hash string) error {
+	if hash == "" {
+		return fmt.Errorf("invalid empty hash")
+	}
+	_, err := bcrypt.Cost([]byte(hash))
+	return err
+}
+
 // compareKeyHash compares the given hash and key using bcrypt.CompareHashAndPassword
 func compareKeyHash(hash string, key string) error {
 	if hash == "" {
@@ -21,22 +21,36 @@ const (
 	authRequestsPerSecondPerCPU rate.Limit = 12 // MM-53483
 )
 
+// ErrCorruptedEntry is returned when the stored data for a client cannot be
+// decoded. The entry should be deleted (e.g. through /unregister) for the
+// client to be able to register again.
+var ErrCorruptedEntry = errors.New("corrupted store entry")
+
 type Service struct {
 	sessionCache *SessionCache
 	store        store.Store
 	limiter      *rate.Limiter
 }
 
-func NewService(store store.Store, sessionCache *SessionCache) (*Service, error) {
-	if store == nil {
+func NewService(dataStore store.Store, sessionCache *SessionCache) (*Service, error) {
+	if dataStore == nil {
 		return nil, errors.New("invalid store")
 	}
 	if sessionCache == nil {
 		return nil, errors.New("invalid session cache")
 	}
+
+	// Clients can be unregistered through other instances sharing the store,
+	// in which case their cached sessions need to go as well.
+	if notifier, ok := dataStore.(store.ChangeNotifier); ok {
+		if err := notifier.OnChange(sessionCache.Delete); err != nil {
+			return nil, fmt.Errorf("failed to watch store changes: %w", err)
+		}
+	}
+
 	return &Service{
 		sessionCache: sessionCache,
-		store:        store,
+		store:        dataStore,
 		limiter:      rate.NewLimiter(authRequestsPerSecondPerCPU*rate.Limit(runtime.NumCPU()), 1),
 	}, nil
 }
@@ -47,6 +61,10 @@ func (s *Service) Authenticate(id, authToken string) error {
 		return fmt.Errorf("authentication failed: %w", err)
 	}
 
+	if err := validateKeyHash(hash); err != nil {
+		return fmt.Errorf("authentication failed: %w", ErrCorruptedEntry)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), authTimeout)
 	defer cancel()
 	if err := s.limiter.Wait(ctx); err != nil {
@@ -64,7 +82,10 @@ func (s *Service) Register(id, key string) error {
 		return errors.New("registration failed: key not long enough")
 	}
 
-	if _, err := s.store.Get(id); err == nil {
+	if hash, err := s.store.Get(id); err == nil {
+		if err := validateKeyHash(hash); err != nil {
+			return fmt.Errorf("registration failed: %w", ErrCorruptedEntry)
+		}
 		return errors.New("registration failed: already registered")
 	} else if !errors.Is(err, store.ErrNotFound) {
 		return fmt.Errorf("registration failed: %w", err)
@@ -106,6 +127,11 @@ func (s *Service) Unregister(id string) error {
 	return nil
 }
 
+// ClientsCount returns the number of registered clients.
+func (s *Service) ClientsCount() (int, error) {
+	return s.store.Count()
+}
+
 func (s *Service) Login(id, key string) (string, error) {
 	if err := s.Authenticate(id, key); err != nil {
 		return "", fmt.Errorf("login failed: %w", err)
@@ -56,6 +56,37 @@ func TestNewService(t *testing.T) {
 		require.NoError(t, err)
 		require.NotNil(t, s)
 	})
+
+	t.Run("shared store", func(t *testing.T) {
+		st := &notifierStore{Store: dbStore}
+		s, err := NewService(st, sessionCache)
+		require.NoError(t, err)
+		require.NotNil(t, s)
+		require.NotNil(t, st.cb)
+
+		err = sessionCache.Put("clientA", "tokenA")
+		require.NoError(t, err)
+		_, err = sessionCache.Get("tokenA")
+		require.NoError(t, err)
+
+		// Entries changed through other instances invalidate the cached
+		// sessions.
+		st.cb("clientA")
+		_, err = sessionCache.Get("tokenA")
+		require.Error(t, err)
+	})
+}
+
+// notifierStore is a store notifying of changes happening elsewhere, as a
+// shared (e.g. Redis) one would.
+type notifierStore struct {
+	store.Store
+	cb func(key string)
+}
+
+func (s *notifierStore) OnChange(cb func(key string)) error {
+	s.cb = cb
+	return nil
 }
 
 func TestRegister(t *testing.T) {
@@ -123,3 +154,39 @@ func TestAuthenticate(t *testing.T) {
 	require.Error(t, err)
 	require.EqualError(t, err, "authentication failed: error: not found")
 }
+
+func TestCorruptedEntry(t *testing.T) {
+	dbStore, teardown := newTestDBStore(t)
+	defer teardown()
+	sessionCache := newTestSessionCache(t)
+
+	s, err := NewService(dbStore, sessionCache)
+	require.NoError(t, err)
+	require.NotNil(t, s)
+
+	err = dbStore.Put("instanceA", "corrupted")
+	require.NoError(t, err)
+
+	authKey, err := newRandomString(MinKeyLen)
+	require.NoError(t, err)
+
+	err = s.Authenticate("instanceA", authKey)
+	require.ErrorIs(t, err, ErrCorruptedEntry)
+	require.EqualError(t, err, "authentication failed: corrupted store entry")
+
+	_, err = s.Login("instanceA", authKey)
+	require.ErrorIs(t, err, ErrCorruptedEntry)
+
+	err = s.Register("instanceA", authKey)
+	require.ErrorIs(t, err, ErrCorruptedEntry)
+	require.EqualError(t, err, "registration failed: corrupted store entry")
+
+	err = s.Unregister("instanceA")
+	require.NoError(t, err)
+
+	err = s.Register("instanceA", authKey)
+	require.NoError(t, err)
+
+	err = s.Authenticate("instanceA", authKey)
+	require.NoError(t, err)
+}
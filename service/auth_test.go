@@ -54,6 +54,34 @@ func TestRegisterClient(t *testing.T) {
 	})
 }
 
+func TestRegisterClientMaxClients(t *testing.T) {
+	cfg := MakeDefaultCfg(t)
+	cfg.API.Security.MaxRegisteredClients = 2
+	th := SetupTestHelper(t, cfg)
+	defer th.Teardown()
+
+	register := func(clientID string) int {
+		t.Helper()
+		buf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"clientID": "%s", "authKey": "Ey4-H_BJA00_TVByPi8DozE12ekN3S7L"}`, clientID)))
+		req, err := http.NewRequest("POST", th.apiURL+"/register", buf)
+		require.NoError(t, err)
+		req.SetBasicAuth("", th.srvc.cfg.API.Security.AdminSecretKey)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	require.Equal(t, http.StatusCreated, register("clientA"))
+	require.Equal(t, http.StatusCreated, register("clientB"))
+	require.Equal(t, http.StatusForbidden, register("clientC"))
+
+	err := th.srvc.auth.Unregister("clientB")
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusCreated, register("clientC"))
+}
+
 func TestUnregisterClient(t *testing.T) {
 	t.Run("invalid method", func(t *testing.T) {
 		th := SetupTestHelper(t, nil)
@@ -242,6 +270,38 @@ func TestLoginClient(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, http.StatusOK, resp.StatusCode)
 	})
+
+	t.Run("corrupted entry", func(t *testing.T) {
+		clientID := "clientB"
+		authKey := "Ey4-H_BJA00_TVByPi8DozE12ekN3S7L"
+		err := th.srvc.store.Put(clientID, "corrupted")
+		require.NoError(t, err)
+
+		buf := bytes.NewBuffer([]byte(fmt.Sprintf(`{"clientID": "%s", "authKey": "%s"}`, clientID, authKey)))
+		req, err := http.NewRequest("POST", th.apiURL+"/login", buf)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		defer resp.Body.Close()
+		var response map[string]string
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		require.NoError(t, err)
+		require.Equal(t, "login failed: authentication failed: corrupted store entry", response["error"])
+
+		// An admin can delete the corrupted entry so that the client can register again.
+		buf = bytes.NewBuffer([]byte(fmt.Sprintf(`{"clientID": "%s"}`, clientID)))
+		req, err = http.NewRequest("POST", th.apiURL+"/unregister", buf)
+		require.NoError(t, err)
+		req.SetBasicAuth("", th.srvc.cfg.API.Security.AdminSecretKey)
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		defer resp.Body.Close()
+
+		err = th.srvc.auth.Register(clientID, authKey)
+		require.NoError(t, err)
+	})
 }
 
 func TestWSAuthHandler(t *testing.T) {
@@ -0,0 +1,56 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/rtcd/service/rtc"
+)
+
+// callDrainGracePeriodDefault is the time given to the sessions of a draining
+// call before they get closed, if not specified in the request.
+const callDrainGracePeriodDefault = 30 * time.Second
+
+// drainCall stops new sessions from joining the given call and closes the
+// existing ones after a grace period. Admin only.
+func (s *Service) drainCall(_ http.ResponseWriter, r *http.Request, _ string, data *httpData) {
+	callID := r.PathValue("id")
+	groupID := r.URL.Query().Get("groupID")
+	data.reqData["callID"] = callID
+	data.reqData["groupID"] = groupID
+
+	if groupID == "" {
+		data.err = "missing groupID"
+		data.code = http.StatusBadRequest
+		return
+	}
+
+	gracePeriod := callDrainGracePeriodDefault
+	if val := r.URL.Query().Get("gracePeriod"); val != "" {
+		data.reqData["gracePeriod"] = val
+		var err error
+		gracePeriod, err = time.ParseDuration(val)
+		if err != nil || gracePeriod < 0 {
+			data.err = "invalid gracePeriod"
+			data.code = http.StatusBadRequest
+			return
+		}
+	}
+
+	err := s.rtcServer.DrainCall(groupID, callID, gracePeriod)
+	if errors.Is(err, rtc.ErrCallNotFound) {
+		data.err = err.Error()
+		data.code = http.StatusNotFound
+		return
+	} else if err != nil {
+		data.err = err.Error()
+		data.code = http.StatusInternalServerError
+		return
+	}
+
+	data.code = http.StatusOK
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/auth"
+	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientDrainCall(t *testing.T) {
+	th := SetupTestHelper(t, nil)
+	defer th.Teardown()
+
+	t.Run("forbidden", func(t *testing.T) {
+		authKey, err := random.NewSecureString(auth.MinKeyLen)
+		require.NoError(t, err)
+		err = th.adminClient.Register("clientA", authKey)
+		require.NoError(t, err)
+
+		c, err := NewClient(ClientConfig{
+			URL:      th.apiURL,
+			ClientID: "clientA",
+			AuthKey:  authKey,
+		})
+		require.NoError(t, err)
+		defer c.Close()
+
+		err = c.DrainCall("clientA", random.NewID(), time.Second)
+		require.EqualError(t, err, "request failed: forbidden")
+	})
+
+	t.Run("missing group", func(t *testing.T) {
+		req, err := http.NewRequest("POST", th.apiURL+"/calls/callA/drain", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("", th.srvc.cfg.API.Security.AdminSecretKey)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("invalid grace period", func(t *testing.T) {
+		req, err := http.NewRequest("POST", th.apiURL+"/calls/callA/drain?groupID=groupA&gracePeriod=invalid", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("", th.srvc.cfg.API.Security.AdminSecretKey)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		err := th.adminClient.DrainCall(random.NewID(), random.NewID(), time.Second)
+		require.ErrorIs(t, err, rtc.ErrCallNotFound)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		cfg := rtc.SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		closedCh := make(chan rtc.CloseReason, 1)
+		err := th.srvc.rtcServer.InitSession(cfg, func(reason rtc.CloseReason) error {
+			closedCh <- reason
+			return nil
+		})
+		require.NoError(t, err)
+
+		err = th.adminClient.DrainCall(cfg.GroupID, cfg.CallID, 100*time.Millisecond)
+		require.NoError(t, err)
+
+		select {
+		case reason := <-closedCh:
+			require.Equal(t, rtc.CloseReasonDrained, reason)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for session to close")
+		}
+	})
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"net/http"
+)
+
+// endCall forcibly ends the given call, disconnecting all of its sessions.
+// Succeeds if the call doesn't exist. Admin only.
+func (s *Service) endCall(_ http.ResponseWriter, r *http.Request, _ string, data *httpData) {
+	callID := r.PathValue("id")
+	groupID := r.URL.Query().Get("groupID")
+	data.reqData["callID"] = callID
+	data.reqData["groupID"] = groupID
+
+	if groupID == "" {
+		data.err = "missing groupID"
+		data.code = http.StatusBadRequest
+		return
+	}
+
+	if err := s.rtcServer.CloseCall(groupID, callID); err != nil {
+		data.err = err.Error()
+		data.code = http.StatusInternalServerError
+		return
+	}
+
+	data.code = http.StatusOK
+}
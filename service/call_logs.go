@@ -0,0 +1,250 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mattermost/rtcd/logger"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+const (
+	callLogsTargetName      = "_callLogs"
+	callLogsTargetType      = "call_logs"
+	callLogsTargetQueueSize = 1000
+	callLogsChSize          = 100
+	callLogsKeepAlivePeriod = 15 * time.Second
+)
+
+// callLogsStreamer fans out log records tagged with a callID to any
+// subscribers for that call. The underlying log target is only registered
+// while there are active subscribers to avoid any overhead when unused.
+type callLogsStreamer struct {
+	log *mlog.Logger
+
+	subs         map[string]map[chan []byte]struct{}
+	targetActive bool
+	mut          sync.Mutex
+
+	// targetMut serializes (re)configuring the logger. It's kept separate
+	// from mut since removing the target flushes pending records through
+	// Write.
+	targetMut sync.Mutex
+	logCfg    logger.Config
+}
+
+func newCallLogsStreamer(log *mlog.Logger, logCfg logger.Config) *callLogsStreamer {
+	return &callLogsStreamer{
+		log:    log,
+		logCfg: logCfg,
+		subs:   map[string]map[chan []byte]struct{}{},
+	}
+}
+
+// callLogsTarget is the log target feeding records to the streamer.
+type callLogsTarget struct {
+	s *callLogsStreamer
+}
+
+func (t *callLogsTarget) Init() error {
+	return nil
+}
+
+func (t *callLogsTarget) Write(p []byte, _ *mlog.LogRec) (int, error) {
+	return t.s.Write(p)
+}
+
+func (t *callLogsTarget) Shutdown() error {
+	return nil
+}
+
+func (s *callLogsStreamer) newTarget(targetType string, _ json.RawMessage) (mlog.Target, error) {
+	if targetType != callLogsTargetType {
+		return nil, fmt.Errorf("unsupported target type %q", targetType)
+	}
+	return &callLogsTarget{s: s}, nil
+}
+
+// applyLoggerConfig configures the logger, including the call logs target if
+// requested. Since configuring replaces all the targets, this is the only
+// way to add or remove it.
+// NOTE: this is expected to always be called with targetMut held.
+func (s *callLogsStreamer) applyLoggerConfig(withTarget bool) error {
+	var targets mlog.LoggerConfiguration
+	if withTarget {
+		targets = mlog.LoggerConfiguration{
+			callLogsTargetName: mlog.TargetCfg{
+				Type:          callLogsTargetType,
+				Levels:        mlog.StdAll,
+				Format:        "json",
+				FormatOptions: json.RawMessage(`{"enable_caller": true}`),
+				MaxQueueSize:  callLogsTargetQueueSize,
+			},
+		}
+	}
+
+	return logger.ConfigureWithTargets(s.log, s.logCfg, targets, &mlog.Factories{
+		TargetFactory: s.newTarget,
+	})
+}
+
+// Write implements io.Writer. It gets called by the log target with a single
+// JSON encoded record at a time.
+func (s *callLogsStreamer) Write(p []byte) (int, error) {
+	var record struct {
+		CallID string `json:"callID"`
+	}
+	if err := json.Unmarshal(p, &record); err != nil || record.CallID == "" {
+		return len(p), nil
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if len(s.subs[record.CallID]) == 0 {
+		return len(p), nil
+	}
+
+	data := make([]byte, len(p))
+	copy(data, p)
+	for ch := range s.subs[record.CallID] {
+		select {
+		case ch <- data:
+		default:
+			// Dropping records for slow subscribers rather than blocking logging.
+		}
+	}
+
+	return len(p), nil
+}
+
+func (s *callLogsStreamer) subscribe(callID string) (chan []byte, error) {
+	s.targetMut.Lock()
+	defer s.targetMut.Unlock()
+
+	ch := make(chan []byte, callLogsChSize)
+
+	s.mut.Lock()
+	if s.subs[callID] == nil {
+		s.subs[callID] = map[chan []byte]struct{}{}
+	}
+	s.subs[callID][ch] = struct{}{}
+	needsTarget := !s.targetActive
+	s.targetActive = true
+	s.mut.Unlock()
+
+	if needsTarget {
+		if err := s.applyLoggerConfig(true); err != nil {
+			s.mut.Lock()
+			delete(s.subs[callID], ch)
+			if len(s.subs[callID]) == 0 {
+				delete(s.subs, callID)
+			}
+			s.targetActive = false
+			s.mut.Unlock()
+			return nil, fmt.Errorf("failed to add log target: %w", err)
+		}
+	}
+
+	return ch, nil
+}
+
+// configure applies the given config to the logger, keeping the call logs
+// target if there are active subscribers.
+func (s *callLogsStreamer) configure(logCfg logger.Config) error {
+	s.targetMut.Lock()
+	defer s.targetMut.Unlock()
+
+	s.mut.Lock()
+	active := s.targetActive
+	s.mut.Unlock()
+
+	s.logCfg = logCfg
+
+	return s.applyLoggerConfig(active)
+}
+
+func (s *callLogsStreamer) unsubscribe(callID string, ch chan []byte) {
+	s.targetMut.Lock()
+	defer s.targetMut.Unlock()
+
+	s.mut.Lock()
+	delete(s.subs[callID], ch)
+	if len(s.subs[callID]) == 0 {
+		delete(s.subs, callID)
+	}
+	needsRemoval := s.targetActive && len(s.subs) == 0
+	if needsRemoval {
+		s.targetActive = false
+	}
+	s.mut.Unlock()
+
+	if needsRemoval {
+		if err := s.applyLoggerConfig(false); err != nil {
+			s.log.Error("failed to remove log target", mlog.Err(err))
+		}
+	}
+}
+
+// streamCallLogs streams, as server-sent events, all the log records tagged
+// with the given call ID until the client disconnects. Admin only.
+func (s *Service) streamCallLogs(w http.ResponseWriter, r *http.Request, _ string, data *httpData) {
+	callID := r.PathValue("id")
+	data.reqData["callID"] = callID
+
+	ch, err := s.callLogs.subscribe(callID)
+	if err != nil {
+		data.err = err.Error()
+		data.code = http.StatusInternalServerError
+		return
+	}
+	defer s.callLogs.unsubscribe(callID, ch)
+
+	// Streaming is expected to outlive the server's write timeout.
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		s.log.Warn("failed to reset write deadline", mlog.Err(err), mlog.String("callID", callID))
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	data.code = http.StatusOK
+	if err := rc.Flush(); err != nil {
+		s.log.Error("failed to flush response", mlog.Err(err))
+		return
+	}
+
+	ticker := time.NewTicker(callLogsKeepAlivePeriod)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case record := <-ch:
+			_, err = fmt.Fprintf(w, "data: %s\n\n", bytes.TrimRight(record, "\r\n"))
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		case <-s.stopCh:
+			return
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			s.log.Debug("failed to write call logs", mlog.Err(err), mlog.String("callID", callID))
+			return
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamCallLogs(t *testing.T) {
+	th := SetupTestHelper(t, nil)
+	defer th.Teardown()
+
+	t.Run("invalid method", func(t *testing.T) {
+		req, err := http.NewRequest("POST", th.apiURL+"/calls/callA/logs", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("", th.srvc.cfg.API.Security.AdminSecretKey)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		req, err := http.NewRequest("GET", th.apiURL+"/calls/callA/logs", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("", "invalid")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		testStreamCallLogs(t, th)
+	})
+}
+
+func TestStreamCallLogsAccessLog(t *testing.T) {
+	cfg := MakeDefaultCfg(t)
+	cfg.API.HTTP.EnableAccessLog = true
+	th := SetupTestHelper(t, cfg)
+	defer th.Teardown()
+
+	// Failing to reset the write deadline would be logged, and streamed,
+	// ahead of the target call log.
+	testStreamCallLogs(t, th)
+}
+
+func testStreamCallLogs(t *testing.T, th *TestHelper) {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", th.apiURL+"/calls/callA/logs", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("", th.srvc.cfg.API.Security.AdminSecretKey)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	th.srvc.log.Info("other call log", mlog.String("callID", "callB"))
+	th.srvc.log.Info("untagged log")
+	th.srvc.log.Info("target call log", mlog.String("callID", "callA"))
+
+	rd := bufio.NewReader(resp.Body)
+	line, err := rd.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(line, "data: "))
+
+	var record map[string]any
+	err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &record)
+	require.NoError(t, err)
+	require.Equal(t, "target call log", record["msg"])
+	require.Equal(t, "callA", record["callID"])
+}
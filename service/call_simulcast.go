@@ -0,0 +1,45 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mattermost/rtcd/service/rtc"
+)
+
+// setCallSimulcastLevel pins all the receivers in the given call to a
+// simulcast level. An empty level restores the default behavior. Admin only.
+func (s *Service) setCallSimulcastLevel(_ http.ResponseWriter, r *http.Request, _ string, data *httpData) {
+	callID := r.PathValue("id")
+	groupID := r.URL.Query().Get("groupID")
+	level := r.URL.Query().Get("level")
+	data.reqData["callID"] = callID
+	data.reqData["groupID"] = groupID
+	data.reqData["level"] = level
+
+	if groupID == "" {
+		data.err = "missing groupID"
+		data.code = http.StatusBadRequest
+		return
+	}
+
+	err := s.rtcServer.SetCallSimulcastLevel(groupID, callID, level)
+	if errors.Is(err, rtc.ErrInvalidSimulcastLevel) {
+		data.err = err.Error()
+		data.code = http.StatusBadRequest
+		return
+	} else if errors.Is(err, rtc.ErrCallNotFound) {
+		data.err = err.Error()
+		data.code = http.StatusNotFound
+		return
+	} else if err != nil {
+		data.err = err.Error()
+		data.code = http.StatusInternalServerError
+		return
+	}
+
+	data.code = http.StatusOK
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/rtcd/service/auth"
+	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientSetCallSimulcastLevel(t *testing.T) {
+	th := SetupTestHelper(t, nil)
+	defer th.Teardown()
+
+	t.Run("forbidden", func(t *testing.T) {
+		authKey, err := random.NewSecureString(auth.MinKeyLen)
+		require.NoError(t, err)
+		err = th.adminClient.Register("clientA", authKey)
+		require.NoError(t, err)
+
+		c, err := NewClient(ClientConfig{
+			URL:      th.apiURL,
+			ClientID: "clientA",
+			AuthKey:  authKey,
+		})
+		require.NoError(t, err)
+		defer c.Close()
+
+		err = c.SetCallSimulcastLevel("clientA", random.NewID(), rtc.SimulcastLevelHigh)
+		require.EqualError(t, err, "request failed: forbidden")
+	})
+
+	t.Run("missing group", func(t *testing.T) {
+		req, err := http.NewRequest("POST", th.apiURL+"/calls/callA/simulcast_level?level=h", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("", th.srvc.cfg.API.Security.AdminSecretKey)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		err := th.adminClient.SetCallSimulcastLevel(random.NewID(), random.NewID(), rtc.SimulcastLevelHigh)
+		require.ErrorIs(t, err, rtc.ErrCallNotFound)
+	})
+
+	t.Run("invalid level", func(t *testing.T) {
+		err := th.adminClient.SetCallSimulcastLevel(random.NewID(), random.NewID(), "x")
+		require.EqualError(t, err, `request failed: invalid simulcast level: "x"`)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		cfg := rtc.SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err := th.srvc.rtcServer.InitSession(cfg, nil)
+		require.NoError(t, err)
+		defer func() {
+			err := th.srvc.rtcServer.CloseSession(cfg.SessionID, rtc.CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		err = th.adminClient.SetCallSimulcastLevel(cfg.GroupID, cfg.CallID, rtc.SimulcastLevelHigh)
+		require.NoError(t, err)
+
+		err = th.adminClient.SetCallSimulcastLevel(cfg.GroupID, cfg.CallID, "")
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mattermost/rtcd/service/rtc"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+// getCallTopology returns which sessions each session in the given call is
+// receiving media from. Admin only.
+func (s *Service) getCallTopology(w http.ResponseWriter, r *http.Request, _ string, data *httpData) {
+	callID := r.PathValue("id")
+	groupID := r.URL.Query().Get("groupID")
+	data.reqData["callID"] = callID
+	data.reqData["groupID"] = groupID
+
+	if groupID == "" {
+		data.err = "missing groupID"
+		data.code = http.StatusBadRequest
+		return
+	}
+
+	topology, err := s.rtcServer.GetCallTopology(groupID, callID)
+	if errors.Is(err, rtc.ErrCallNotFound) {
+		data.err = err.Error()
+		data.code = http.StatusNotFound
+		return
+	} else if err != nil {
+		data.err = err.Error()
+		data.code = http.StatusInternalServerError
+		return
+	}
+
+	data.code = http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&topology); err != nil {
+		s.log.Error("failed to encode data", mlog.Err(err))
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+// getCalls returns the calls currently active on this instance along with
+// their sessions count. Admin only.
+func (s *Service) getCalls(w http.ResponseWriter, _ *http.Request, _ string, data *httpData) {
+	calls := s.rtcServer.GetCalls()
+
+	data.code = http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(calls); err != nil {
+		s.log.Error("failed to encode data", mlog.Err(err))
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"testing"
+
+	"github.com/mattermost/rtcd/service/auth"
+	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientGetCalls(t *testing.T) {
+	th := SetupTestHelper(t, nil)
+	defer th.Teardown()
+
+	t.Run("forbidden", func(t *testing.T) {
+		authKey, err := random.NewSecureString(auth.MinKeyLen)
+		require.NoError(t, err)
+		err = th.adminClient.Register("clientA", authKey)
+		require.NoError(t, err)
+
+		c, err := NewClient(ClientConfig{
+			URL:      th.apiURL,
+			ClientID: "clientA",
+			AuthKey:  authKey,
+		})
+		require.NoError(t, err)
+		defer c.Close()
+
+		_, err = c.GetCalls()
+		require.EqualError(t, err, "request failed: forbidden")
+	})
+
+	t.Run("no calls", func(t *testing.T) {
+		calls, err := th.adminClient.GetCalls()
+		require.NoError(t, err)
+		require.Empty(t, calls)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		cfg := rtc.SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err := th.srvc.rtcServer.InitSession(cfg, nil)
+		require.NoError(t, err)
+		defer func() {
+			err := th.srvc.rtcServer.CloseSession(cfg.SessionID, rtc.CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		calls, err := th.adminClient.GetCalls()
+		require.NoError(t, err)
+		require.Equal(t, []rtc.CallInfo{
+			{
+				GroupID:       cfg.GroupID,
+				CallID:        cfg.CallID,
+				SessionsCount: 1,
+			},
+		}, calls)
+	})
+}
@@ -11,9 +11,11 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
+	"github.com/mattermost/rtcd/service/rtc"
 	"github.com/mattermost/rtcd/service/ws"
 )
 
@@ -25,12 +27,15 @@ const (
 type Client struct {
 	cfg    *ClientConfig
 	connID string
+	// instanceID is the identifier of the service instance we last connected
+	// to, as advertised in the hello message.
+	instanceID string
 
 	httpClient  *http.Client
 	wsClient    *ws.Client
 	receiveCh   chan ClientMessage
 	errorCh     chan error
-	reconnectCb ClientReconnectCb
+	reconnectCb ClientReconnectStateCb
 	dialFn      DialContextFn
 	closed      bool
 
@@ -232,6 +237,20 @@ func (c *Client) Send(msg ClientMessage) error {
 	return c.wsClient.Send(ws.BinaryMessage, data)
 }
 
+// StartAudioRecording asks the service to start an audio-only recording of
+// the given call. The outcome is notified through a ClientMessageCallJobState
+// message.
+func (c *Client) StartAudioRecording(callID string) error {
+	return c.Send(*NewClientMessage(ClientMessageAudioRecordingStart, map[string]string{"callID": callID}))
+}
+
+// StopAudioRecording asks the service to stop the audio-only recording of the
+// given call. The outcome is notified through a ClientMessageCallJobState
+// message.
+func (c *Client) StopAudioRecording(callID string) error {
+	return c.Send(*NewClientMessage(ClientMessageAudioRecordingStop, map[string]string{"callID": callID}))
+}
+
 func (c *Client) Connected() bool {
 	c.mut.RLock()
 	defer c.mut.RUnlock()
@@ -310,6 +329,7 @@ func (c *Client) msgReader(wsClient *ws.Client) {
 			if ok && data["connID"] != "" {
 				c.mut.Lock()
 				c.connID = data["connID"]
+				c.instanceID = data["instanceID"]
 				c.mut.Unlock()
 			}
 		}
@@ -333,7 +353,7 @@ func (c *Client) reconnectHandler() {
 		time.Sleep(waitTime)
 
 		if c.reconnectCb != nil {
-			if err := c.reconnectCb(c, attempt); err != nil {
+			if err := c.reconnectCb(c, c.getReconnectState(attempt)); err != nil {
 				c.sendError(fmt.Errorf("reconnect callback failed: %w", err))
 				c.mut.Lock()
 				c.closed = true
@@ -353,6 +373,34 @@ func (c *Client) reconnectHandler() {
 	}
 }
 
+// getReconnectState returns information about the lost connection. Whether the
+// service restarted is detected by comparing the instance ID it currently
+// advertises with the one received in the last hello message. If the service
+// cannot be reached or doesn't advertise an instance ID we can't tell, so
+// ServerRestarted is false.
+func (c *Client) getReconnectState(attempt int) ClientReconnectState {
+	c.mut.RLock()
+	state := ClientReconnectState{
+		Attempt:    attempt,
+		LastConnID: c.connID,
+	}
+	instanceID := c.instanceID
+	c.mut.RUnlock()
+
+	if instanceID == "" {
+		return state
+	}
+
+	info, err := c.GetVersionInfo()
+	if err != nil {
+		return state
+	}
+
+	state.ServerRestarted = info.InstanceID != "" && info.InstanceID != instanceID
+
+	return state
+}
+
 func (c *Client) GetVersionInfo() (VersionInfo, error) {
 	if c.httpClient == nil {
 		return VersionInfo{}, fmt.Errorf("http client is not initialized")
@@ -408,3 +456,189 @@ func (c *Client) GetSystemInfo() (SystemInfo, error) {
 
 	return info, nil
 }
+
+// GetSessionStats returns live media statistics for the given session.
+func (c *Client) GetSessionStats(groupID, callID, sessionID string) (rtc.SessionStats, error) {
+	if c.httpClient == nil {
+		return rtc.SessionStats{}, fmt.Errorf("http client is not initialized")
+	}
+
+	reqURL := fmt.Sprintf("%s/groups/%s/calls/%s/sessions/%s/stats", c.cfg.httpURL,
+		url.PathEscape(groupID), url.PathEscape(callID), url.PathEscape(sessionID))
+	req, err := http.NewRequest("GET", reqURL, nil)
+	if err != nil {
+		return rtc.SessionStats{}, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.SetBasicAuth(c.cfg.ClientID, c.cfg.AuthKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return rtc.SessionStats{}, fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return rtc.SessionStats{}, rtc.ErrSessionNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return rtc.SessionStats{}, fmt.Errorf("request failed with status %s", resp.Status)
+	}
+
+	var stats rtc.SessionStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return rtc.SessionStats{}, fmt.Errorf("decoding http response failed: %w", err)
+	}
+
+	return stats, nil
+}
+
+// GetCalls returns the calls currently active on the service. Requires admin
+// access.
+func (c *Client) GetCalls() ([]rtc.CallInfo, error) {
+	if c.httpClient == nil {
+		return nil, fmt.Errorf("http client is not initialized")
+	}
+
+	req, err := http.NewRequest("GET", c.cfg.httpURL+"/calls", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.SetBasicAuth(c.cfg.ClientID, c.cfg.AuthKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respData := map[string]string{}
+		if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
+			return nil, fmt.Errorf("decoding http response failed: %w", err)
+		}
+
+		if errMsg := respData["error"]; errMsg != "" {
+			return nil, fmt.Errorf("request failed: %s", errMsg)
+		}
+		return nil, fmt.Errorf("request failed with status %s", resp.Status)
+	}
+
+	var calls []rtc.CallInfo
+	if err := json.NewDecoder(resp.Body).Decode(&calls); err != nil {
+		return nil, fmt.Errorf("decoding http response failed: %w", err)
+	}
+
+	return calls, nil
+}
+
+// EndCall forcibly ends the given call, disconnecting all of its sessions.
+// Requires admin access.
+func (c *Client) EndCall(groupID, callID string) error {
+	if c.httpClient == nil {
+		return fmt.Errorf("http client is not initialized")
+	}
+
+	reqURL := fmt.Sprintf("%s/calls/%s/end?groupID=%s", c.cfg.httpURL,
+		url.PathEscape(callID), url.QueryEscape(groupID))
+	req, err := http.NewRequest("POST", reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.SetBasicAuth(c.cfg.ClientID, c.cfg.AuthKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respData := map[string]string{}
+		if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
+			return fmt.Errorf("decoding http response failed: %w", err)
+		}
+
+		if errMsg := respData["error"]; errMsg != "" {
+			return fmt.Errorf("request failed: %s", errMsg)
+		}
+		return fmt.Errorf("request failed with status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// DrainCall stops new sessions from joining the given call and closes the
+// existing ones once gracePeriod has elapsed. Requires admin access.
+func (c *Client) DrainCall(groupID, callID string, gracePeriod time.Duration) error {
+	if c.httpClient == nil {
+		return fmt.Errorf("http client is not initialized")
+	}
+
+	reqURL := fmt.Sprintf("%s/calls/%s/drain?groupID=%s&gracePeriod=%s", c.cfg.httpURL,
+		url.PathEscape(callID), url.QueryEscape(groupID), url.QueryEscape(gracePeriod.String()))
+	req, err := http.NewRequest("POST", reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.SetBasicAuth(c.cfg.ClientID, c.cfg.AuthKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return rtc.ErrCallNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		respData := map[string]string{}
+		if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
+			return fmt.Errorf("decoding http response failed: %w", err)
+		}
+
+		if errMsg := respData["error"]; errMsg != "" {
+			return fmt.Errorf("request failed: %s", errMsg)
+		}
+		return fmt.Errorf("request failed with status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// SetCallSimulcastLevel pins all the receivers in the given call to the given
+// simulcast level. An empty level restores the default behavior. Requires
+// admin access.
+func (c *Client) SetCallSimulcastLevel(groupID, callID, level string) error {
+	if c.httpClient == nil {
+		return fmt.Errorf("http client is not initialized")
+	}
+
+	reqURL := fmt.Sprintf("%s/calls/%s/simulcast_level?groupID=%s&level=%s", c.cfg.httpURL,
+		url.PathEscape(callID), url.QueryEscape(groupID), url.QueryEscape(level))
+	req, err := http.NewRequest("POST", reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.SetBasicAuth(c.cfg.ClientID, c.cfg.AuthKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return rtc.ErrCallNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		respData := map[string]string{}
+		if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
+			return fmt.Errorf("decoding http response failed: %w", err)
+		}
+
+		if errMsg := respData["error"]; errMsg != "" {
+			return fmt.Errorf("request failed: %s", errMsg)
+		}
+		return fmt.Errorf("request failed with status %s", resp.Status)
+	}
+
+	return nil
+}
@@ -17,13 +17,58 @@ type ClientMessage struct {
 }
 
 const (
-	ClientMessageJoin      = "join"
-	ClientMessageLeave     = "leave"
-	ClientMessageRTC       = "rtc"
-	ClientMessageHello     = "hello"
-	ClientMessageReconnect = "reconnect"
-	ClientMessageClose     = "close"
-	ClientMessageVAD       = "vad"
+	ClientMessageJoin          = "join"
+	ClientMessageLeave         = "leave"
+	ClientMessageRTC           = "rtc"
+	ClientMessageHello         = "hello"
+	ClientMessageReconnect     = "reconnect"
+	ClientMessageClose         = "close"
+	ClientMessageVAD           = "vad"
+	ClientMessageScreen        = "screen"
+	ClientMessageMute          = "mute"
+	ClientMessageStats         = "stats"
+	ClientMessageTrack         = "track"
+	ClientMessageActiveSpeaker = "active_speaker"
+	ClientMessageError         = "error"
+	// ClientMessageAudioRecordingStart and ClientMessageAudioRecordingStop
+	// are sent by clients to toggle the audio-only recording of a call.
+	ClientMessageAudioRecordingStart = "audio_recording_start"
+	ClientMessageAudioRecordingStop  = "audio_recording_stop"
+	// ClientMessageCallJobState is sent to clients whenever the state of a
+	// call job (e.g. an audio recording) changes.
+	ClientMessageCallJobState = "call_job_state"
+)
+
+// Job types sent as part of ClientMessageCallJobState messages.
+const (
+	CallJobTypeAudioRecording = "audio_recording"
+)
+
+// CallJobState holds the state of a job (e.g. an audio recording) running
+// for a call. Timestamps are in milliseconds since epoch.
+type CallJobState struct {
+	CallID  string `msgpack:"callID"`
+	Type    string `msgpack:"type"`
+	StartAt int64  `msgpack:"start_at,omitempty"`
+	EndAt   int64  `msgpack:"end_at,omitempty"`
+	Err     string `msgpack:"err,omitempty"`
+}
+
+// Error codes sent as part of ClientMessageError messages.
+const (
+	ClientErrorCodeCallFull = "call_full"
+	// ClientErrorCodeServerOverloaded is sent when the node is too busy to
+	// accept new sessions. Joining can be retried, possibly on another node.
+	ClientErrorCodeServerOverloaded = "server_overloaded"
+	// ClientErrorCodeClientVersionTooOld is sent when the client is older
+	// than the minimum version allowed (rtc.ServerConfig.MinClientVersion).
+	// Joining shouldn't be retried until the client is updated.
+	ClientErrorCodeClientVersionTooOld = "client_version_too_old"
+	// ClientErrorCodeRedirect is sent when the node is over capacity
+	// (APIConfig.Redirect). The message carries the URL of the node the
+	// session should join through instead, which the client is expected to
+	// open a separate connection to.
+	ClientErrorCodeRedirect = "redirect"
 )
 
 var _ msgpack.CustomEncoder = (*ClientMessage)(nil)
@@ -48,18 +93,25 @@ func (cm *ClientMessage) DecodeMsgpack(dec *msgpack.Decoder) error {
 			return fmt.Errorf("failed to decode msg.Data: %w", err)
 		}
 		cm.Data = data
-	case ClientMessageLeave, ClientMessageHello, ClientMessageReconnect, ClientMessageClose:
+	case ClientMessageLeave, ClientMessageHello, ClientMessageReconnect, ClientMessageClose, ClientMessageError,
+		ClientMessageAudioRecordingStart, ClientMessageAudioRecordingStop:
 		data, err := dec.DecodeTypedMap()
 		if err != nil {
 			return fmt.Errorf("failed to decode msg.Data: %w", err)
 		}
 		cm.Data = data
-	case ClientMessageRTC, ClientMessageVAD:
+	case ClientMessageRTC, ClientMessageVAD, ClientMessageScreen, ClientMessageMute, ClientMessageStats, ClientMessageTrack, ClientMessageActiveSpeaker:
 		var rtcMsg rtc.Message
 		if err = dec.Decode(&rtcMsg); err != nil {
 			return fmt.Errorf("failed to decode rtc.Message: %w", err)
 		}
 		cm.Data = rtcMsg
+	case ClientMessageCallJobState:
+		var state CallJobState
+		if err = dec.Decode(&state); err != nil {
+			return fmt.Errorf("failed to decode CallJobState: %w", err)
+		}
+		cm.Data = state
 	default:
 		data, err := dec.DecodeInterface()
 		if err != nil {
@@ -67,4 +67,83 @@ func TestClientMessage(t *testing.T) {
 		require.Equal(t, ClientMessageRTC, msg2.Type)
 		require.Equal(t, rtcMsg, msg2.Data)
 	})
+	t.Run("with stats type", func(t *testing.T) {
+		rtcMsg := rtc.Message{
+			SessionID: "session_id",
+			GroupID:   "group_id",
+			Type:      rtc.StatsMessage,
+			Data:      []byte(`{"lossRate":0.01,"rtt":0.1,"jitter":0.02}`),
+		}
+		msg := NewClientMessage(ClientMessageStats, rtcMsg)
+		data, err := msg.Pack()
+		require.NoError(t, err)
+		msg2 := &ClientMessage{}
+		err = msg2.Unpack(data)
+		require.NoError(t, err)
+		require.Equal(t, msg, msg2)
+		require.Equal(t, ClientMessageStats, msg2.Type)
+		require.Equal(t, rtcMsg, msg2.Data)
+	})
+
+	t.Run("with track type", func(t *testing.T) {
+		rtcMsg := rtc.Message{
+			SessionID: "session_id",
+			GroupID:   "group_id",
+			Type:      rtc.TrackRejectMessage,
+			Data:      []byte(`{"trackID":"screen_sessionID_trackID","reason":"maximum number of receivers per publisher reached"}`),
+		}
+		msg := NewClientMessage(ClientMessageTrack, rtcMsg)
+		data, err := msg.Pack()
+		require.NoError(t, err)
+		msg2 := &ClientMessage{}
+		err = msg2.Unpack(data)
+		require.NoError(t, err)
+		require.Equal(t, msg, msg2)
+		require.Equal(t, ClientMessageTrack, msg2.Type)
+		require.Equal(t, rtcMsg, msg2.Data)
+	})
+
+	t.Run("with active speaker type", func(t *testing.T) {
+		rtcMsg := rtc.Message{
+			SessionID: "session_id",
+			GroupID:   "group_id",
+			CallID:    "call_id",
+			Type:      rtc.ActiveSpeakerMessage,
+		}
+		msg := NewClientMessage(ClientMessageActiveSpeaker, rtcMsg)
+		data, err := msg.Pack()
+		require.NoError(t, err)
+		msg2 := &ClientMessage{}
+		err = msg2.Unpack(data)
+		require.NoError(t, err)
+		require.Equal(t, msg, msg2)
+		require.Equal(t, ClientMessageActiveSpeaker, msg2.Type)
+		require.Equal(t, rtcMsg, msg2.Data)
+	})
+
+	t.Run("with audio recording start type", func(t *testing.T) {
+		msg := NewClientMessage(ClientMessageAudioRecordingStart, map[string]string{"callID": "call_id"})
+		data, err := msg.Pack()
+		require.NoError(t, err)
+		msg2 := &ClientMessage{}
+		err = msg2.Unpack(data)
+		require.NoError(t, err)
+		require.Equal(t, msg, msg2)
+	})
+
+	t.Run("with call job state type", func(t *testing.T) {
+		state := CallJobState{
+			CallID:  "call_id",
+			Type:    CallJobTypeAudioRecording,
+			StartAt: 1000,
+		}
+		msg := NewClientMessage(ClientMessageCallJobState, state)
+		data, err := msg.Pack()
+		require.NoError(t, err)
+		msg2 := &ClientMessage{}
+		err = msg2.Unpack(data)
+		require.NoError(t, err)
+		require.Equal(t, msg, msg2)
+		require.Equal(t, state, msg2.Data)
+	})
 }
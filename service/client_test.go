@@ -5,6 +5,7 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/mattermost/rtcd/service/auth"
 	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc"
 	"github.com/mattermost/rtcd/service/ws"
 
 	"github.com/stretchr/testify/require"
@@ -393,6 +395,193 @@ func TestClientReceive(t *testing.T) {
 	wg.Wait()
 }
 
+func TestClientReceiveStats(t *testing.T) {
+	th := SetupTestHelper(t, nil)
+	defer th.Teardown()
+
+	clientID := "clientA"
+	authKey, err := random.NewSecureString(auth.MinKeyLen)
+	require.NoError(t, err)
+	err = th.adminClient.Register(clientID, authKey)
+	require.NoError(t, err)
+
+	c, err := NewClient(ClientConfig{
+		URL:      th.apiURL,
+		ClientID: clientID,
+		AuthKey:  authKey,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	err = c.Connect()
+	require.NoError(t, err)
+
+	msg, ok := <-c.ReceiveCh()
+	require.True(t, ok)
+	require.Equal(t, ClientMessageHello, msg.Type)
+	msgData, ok := msg.Data.(map[string]string)
+	require.True(t, ok)
+
+	sessionID := random.NewID()
+	th.srvc.mut.Lock()
+	th.srvc.connMap[sessionID] = msgData["connID"]
+	th.srvc.mut.Unlock()
+
+	stats := rtc.ClientStats{LossRate: 0.01, RTT: 0.1, Jitter: 0.02}
+	data, err := json.Marshal(stats)
+	require.NoError(t, err)
+	rtcMsg := rtc.Message{
+		GroupID:   clientID,
+		UserID:    random.NewID(),
+		SessionID: sessionID,
+		CallID:    random.NewID(),
+		Type:      rtc.StatsMessage,
+		Data:      data,
+	}
+	err = th.srvc.handleRTCMsg(rtcMsg)
+	require.NoError(t, err)
+
+	select {
+	case msg, ok := <-c.ReceiveCh():
+		require.True(t, ok)
+		require.Equal(t, ClientMessageStats, msg.Type)
+		require.Equal(t, rtcMsg, msg.Data)
+
+		var receivedStats rtc.ClientStats
+		err := json.Unmarshal(msg.Data.(rtc.Message).Data, &receivedStats)
+		require.NoError(t, err)
+		require.Equal(t, stats, receivedStats)
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for stats message")
+	}
+}
+
+func TestClientJoinCallFull(t *testing.T) {
+	cfg := MakeDefaultCfg(t)
+	cfg.RTC.MaxCallParticipants = 1
+	th := SetupTestHelper(t, cfg)
+	defer th.Teardown()
+
+	clientID := "clientA"
+	authKey, err := random.NewSecureString(auth.MinKeyLen)
+	require.NoError(t, err)
+	err = th.adminClient.Register(clientID, authKey)
+	require.NoError(t, err)
+
+	c, err := NewClient(ClientConfig{
+		URL:      th.apiURL,
+		ClientID: clientID,
+		AuthKey:  authKey,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	err = c.Connect()
+	require.NoError(t, err)
+
+	msg, ok := <-c.ReceiveCh()
+	require.True(t, ok)
+	require.Equal(t, ClientMessageHello, msg.Type)
+
+	join := func(sessionID string) {
+		t.Helper()
+		err := c.Send(*NewClientMessage(ClientMessageJoin, map[string]any{
+			"callID":    "callA",
+			"userID":    random.NewID(),
+			"sessionID": sessionID,
+		}))
+		require.NoError(t, err)
+	}
+
+	sessionA := random.NewID()
+	join(sessionA)
+	require.Eventually(t, func() bool {
+		th.srvc.mut.RLock()
+		defer th.srvc.mut.RUnlock()
+		return th.srvc.connMap[sessionA] != ""
+	}, 5*time.Second, 10*time.Millisecond)
+	defer func() {
+		err := th.srvc.rtcServer.CloseSession(sessionA, rtc.CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	sessionB := random.NewID()
+	join(sessionB)
+
+	select {
+	case msg, ok := <-c.ReceiveCh():
+		require.True(t, ok)
+		require.Equal(t, ClientMessageError, msg.Type)
+		require.Equal(t, map[string]string{
+			"sessionID": sessionB,
+			"code":      ClientErrorCodeCallFull,
+			"error":     "failed to add session: call is full",
+		}, msg.Data)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for error message")
+	}
+
+	th.srvc.mut.RLock()
+	_, ok = th.srvc.connMap[sessionB]
+	th.srvc.mut.RUnlock()
+	require.False(t, ok)
+}
+
+func TestClientJoinVersionTooOld(t *testing.T) {
+	cfg := MakeDefaultCfg(t)
+	cfg.RTC.MinClientVersion = "v1.2.0"
+	th := SetupTestHelper(t, cfg)
+	defer th.Teardown()
+
+	clientID := "clientA"
+	authKey, err := random.NewSecureString(auth.MinKeyLen)
+	require.NoError(t, err)
+	err = th.adminClient.Register(clientID, authKey)
+	require.NoError(t, err)
+
+	c, err := NewClient(ClientConfig{
+		URL:      th.apiURL,
+		ClientID: clientID,
+		AuthKey:  authKey,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	err = c.Connect()
+	require.NoError(t, err)
+
+	msg, ok := <-c.ReceiveCh()
+	require.True(t, ok)
+	require.Equal(t, ClientMessageHello, msg.Type)
+
+	sessionID := random.NewID()
+	err = c.Send(*NewClientMessage(ClientMessageJoin, map[string]any{
+		"callID":    "callA",
+		"userID":    random.NewID(),
+		"sessionID": sessionID,
+		"version":   "v1.1.0",
+	}))
+	require.NoError(t, err)
+
+	select {
+	case msg, ok := <-c.ReceiveCh():
+		require.True(t, ok)
+		require.Equal(t, ClientMessageError, msg.Type)
+		require.Equal(t, map[string]string{
+			"sessionID": sessionID,
+			"code":      ClientErrorCodeClientVersionTooOld,
+			"error":     "invalid session config: client version is too old, please update: 1.1.0 is lower than 1.2.0",
+		}, msg.Data)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for error message")
+	}
+
+	th.srvc.mut.RLock()
+	_, ok = th.srvc.connMap[sessionID]
+	th.srvc.mut.RUnlock()
+	require.False(t, ok)
+}
+
 func TestClientReconnect(t *testing.T) {
 	th := SetupTestHelper(t, nil)
 	defer th.Teardown()
@@ -452,6 +641,46 @@ func TestClientReconnect(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("state callback", func(t *testing.T) {
+		var cbState ClientReconnectState
+		c, err := NewClient(ClientConfig{
+			URL:      th.apiURL,
+			ClientID: clientID,
+			AuthKey:  authKey,
+		}, WithClientReconnectStateCb(func(_ *Client, state ClientReconnectState) error {
+			cbState = state
+			return nil
+		}))
+		require.NoError(t, err)
+		require.NotNil(t, c)
+
+		err = c.Connect()
+		require.NoError(t, err)
+
+		msg, ok := <-c.ReceiveCh()
+		require.True(t, ok)
+		require.Equal(t, ClientMessageHello, msg.Type)
+
+		msgData, ok := msg.Data.(map[string]string)
+		require.True(t, ok)
+		require.Equal(t, th.srvc.instanceID, msgData["instanceID"])
+
+		err = th.srvc.wsServer.Send(ws.Message{Type: ws.CloseMessage, ClientID: clientID, ConnID: msgData["connID"]})
+		require.NoError(t, err)
+
+		msg, ok = <-c.ReceiveCh()
+		require.True(t, ok)
+		require.Equal(t, ClientMessageHello, msg.Type)
+
+		require.Equal(t, ClientReconnectState{
+			Attempt:    1,
+			LastConnID: msgData["connID"],
+		}, cbState)
+
+		err = c.Close()
+		require.NoError(t, err)
+	})
+
 	t.Run("callback error", func(t *testing.T) {
 		var cbCalled bool
 		c, err := NewClient(ClientConfig{
@@ -634,6 +863,7 @@ func TestClientGetVersionInfo(t *testing.T) {
 			GoVersion:    runtime.Version(),
 			GoOS:         runtime.GOOS,
 			GoArch:       runtime.GOARCH,
+			InstanceID:   th.srvc.instanceID,
 		}, info)
 	})
 }
@@ -759,6 +989,86 @@ func TestReconnectClientHerd(t *testing.T) {
 	reconnectWg.Wait()
 }
 
+func TestReconnectClientHerdState(t *testing.T) {
+	cfg := MakeDefaultCfg(t)
+	cfg.API.HTTP.ListenAddress = ":38046"
+	cfg.API.Security.AllowSelfRegistration = true
+
+	th := SetupTestHelper(t, cfg)
+
+	authKey, err := random.NewSecureString(auth.MinKeyLen)
+	require.NoError(t, err)
+
+	// NOTE: this value needs to be bumped for any serious benchmarking.
+	n := 10
+	var registerWg sync.WaitGroup
+	registerWg.Add(n)
+
+	var reconnectWg sync.WaitGroup
+	reconnectWg.Add(n)
+
+	for i := 0; i < n; i++ {
+		go func(clientID string) {
+			var connIDs []string
+			var restarted bool
+
+			reconnectCb := func(c *Client, state ClientReconnectState) error {
+				require.Equal(t, connIDs[0], state.LastConnID)
+				// The service may not be reachable yet, in which case we can't
+				// tell and the next attempt will fail to authenticate.
+				restarted = state.ServerRestarted
+				if restarted {
+					err := c.Register(clientID, authKey)
+					require.NoError(t, err)
+				}
+				return nil
+			}
+
+			c, _ := NewClient(ClientConfig{
+				URL:               th.apiURL,
+				AuthKey:           authKey,
+				ClientID:          clientID,
+				ReconnectInterval: 500 * time.Millisecond,
+			}, WithClientReconnectStateCb(reconnectCb))
+			err := c.Register(clientID, authKey)
+			require.NoError(t, err)
+
+			err = c.Connect()
+			require.NoError(t, err)
+
+			for msg := range c.ReceiveCh() {
+				if msg.Type == ClientMessageHello {
+					data, ok := msg.Data.(map[string]string)
+					require.True(t, ok)
+					require.NotEmpty(t, data["instanceID"])
+					connIDs = append(connIDs, data["connID"])
+					if len(connIDs) == 1 {
+						registerWg.Done()
+					} else if len(connIDs) == 2 {
+						// Second connection means we reconnected successfully.
+						require.NotEqual(t, connIDs[0], connIDs[1])
+						require.True(t, restarted)
+						err := c.Close()
+						require.NoError(t, err)
+						reconnectWg.Done()
+					}
+				}
+			}
+		}(fmt.Sprintf("client%d", i))
+	}
+
+	// We wait for all clients to register.
+	registerWg.Wait()
+
+	// Simulate service restart
+	th.Teardown()
+	th = SetupTestHelper(t, cfg)
+	defer th.Teardown()
+
+	// We wait for all clients to reconnect successfully.
+	reconnectWg.Wait()
+}
+
 func TestClientGetSystemInfo(t *testing.T) {
 	th := SetupTestHelper(t, nil)
 	defer th.Teardown()
@@ -0,0 +1,43 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+type videoCodecsData struct {
+	Codecs []string `json:"codecs"`
+}
+
+// handleVideoCodecs returns (GET) or updates (POST) the video codecs enabled
+// for newly created sessions. Admin only.
+func (s *Service) handleVideoCodecs(w http.ResponseWriter, r *http.Request, _ string, data *httpData) {
+	if r.Method == http.MethodPost {
+		var reqData videoCodecsData
+		if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
+			data.err = err.Error()
+			data.code = http.StatusBadRequest
+			return
+		}
+		data.reqData["codecs"] = strings.Join(reqData.Codecs, ",")
+
+		if err := s.rtcServer.SetEnabledVideoCodecs(reqData.Codecs); err != nil {
+			data.err = err.Error()
+			data.code = http.StatusBadRequest
+			return
+		}
+	}
+
+	data.code = http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(videoCodecsData{Codecs: s.rtcServer.GetEnabledVideoCodecs()}); err != nil {
+		s.log.Error("failed to encode data", mlog.Err(err))
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleVideoCodecs(t *testing.T) {
+	th := SetupTestHelper(t, nil)
+	defer th.Teardown()
+
+	doRequest := func(t *testing.T, method, body, authKey string) (*http.Response, videoCodecsData) {
+		t.Helper()
+		req, err := http.NewRequest(method, th.apiURL+"/codecs/video", strings.NewReader(body))
+		require.NoError(t, err)
+		req.SetBasicAuth("", authKey)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var data videoCodecsData
+		if resp.StatusCode == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(&data)
+			require.NoError(t, err)
+		}
+
+		return resp, data
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		resp, _ := doRequest(t, http.MethodGet, "", "invalid")
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		resp, data := doRequest(t, http.MethodGet, "", th.srvc.cfg.API.Security.AdminSecretKey)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, []string{webrtc.MimeTypeAV1, webrtc.MimeTypeVP8}, data.Codecs)
+	})
+
+	t.Run("invalid codec", func(t *testing.T) {
+		resp, _ := doRequest(t, http.MethodPost, `{"codecs": ["video/VP8", "video/unknown"]}`, th.srvc.cfg.API.Security.AdminSecretKey)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("set", func(t *testing.T) {
+		resp, data := doRequest(t, http.MethodPost, `{"codecs": ["video/VP8"]}`, th.srvc.cfg.API.Security.AdminSecretKey)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, []string{webrtc.MimeTypeVP8}, data.Codecs)
+		require.Equal(t, []string{webrtc.MimeTypeVP8}, th.srvc.rtcServer.GetEnabledVideoCodecs())
+	})
+}
@@ -6,6 +6,7 @@ package service
 import (
 	"fmt"
 	"net/url"
+	"path/filepath"
 	"time"
 
 	"github.com/mattermost/rtcd/service/auth"
@@ -23,9 +24,16 @@ type SecurityConfig struct {
 	// Whether or not to allow clients to self-register.
 	AllowSelfRegistration bool                    `toml:"allow_self_registration"`
 	SessionCache          auth.SessionCacheConfig `toml:"session_cache"`
+	// The maximum number of clients that can be registered. A zero value
+	// means no limit.
+	MaxRegisteredClients int `toml:"max_registered_clients"`
 }
 
 func (c SecurityConfig) IsValid() error {
+	if c.MaxRegisteredClients < 0 {
+		return fmt.Errorf("invalid MaxRegisteredClients value: should not be negative")
+	}
+
 	if !c.EnableAdmin {
 		return nil
 	}
@@ -37,16 +45,83 @@ func (c SecurityConfig) IsValid() error {
 	return nil
 }
 
+const wsPingInterval = 10 * time.Second
+
+type WebSocketConfig struct {
+	// The time, in seconds, to wait for a pong response from a client before
+	// considering its connection dead. Lower values allow half-open connections
+	// to be detected faster. A zero value means twice the ping interval
+	// (20 seconds).
+	PongWaitSeconds int `toml:"pong_wait_seconds"`
+	// The maximum size, in KB, of a message received from a client.
+	// Connections sending larger messages are closed. A zero value means the
+	// default (1024KB) is used.
+	MaxMessageSizeKB int `toml:"max_message_size_kb"`
+	// Whether per-message compression should be negotiated with clients
+	// asking for it. This reduces the size of signaling messages (e.g. SDP)
+	// at the cost of some extra CPU usage.
+	EnableCompression bool `toml:"enable_compression"`
+}
+
+func (c WebSocketConfig) IsValid() error {
+	if c.PongWaitSeconds < 0 {
+		return fmt.Errorf("invalid PongWaitSeconds value: should not be negative")
+	}
+
+	if c.PongWaitSeconds != 0 && time.Duration(c.PongWaitSeconds)*time.Second <= wsPingInterval {
+		return fmt.Errorf("invalid PongWaitSeconds value: should be greater than %d", int(wsPingInterval.Seconds()))
+	}
+
+	if c.MaxMessageSizeKB < 0 {
+		return fmt.Errorf("invalid MaxMessageSizeKB value: should not be negative")
+	}
+
+	return nil
+}
+
+type RedirectConfig struct {
+	// The maximum number of sessions this instance will accept. Once the limit
+	// is reached, joins are rejected with an error (ClientErrorCodeRedirect)
+	// pointing clients to URL. A zero value means no limit.
+	MaxSessions int `toml:"max_sessions"`
+	// The URL of the instance clients should be redirected to when this one
+	// is over capacity.
+	URL string `toml:"url"`
+}
+
+func (c RedirectConfig) IsValid() error {
+	if c.MaxSessions < 0 {
+		return fmt.Errorf("invalid MaxSessions value: should not be negative")
+	}
+
+	if c.MaxSessions == 0 {
+		return nil
+	}
+
+	if c.URL == "" {
+		return fmt.Errorf("invalid URL value: should not be empty")
+	}
+
+	if err := (&ClientConfig{URL: c.URL}).Parse(); err != nil {
+		return fmt.Errorf("invalid URL value: %w", err)
+	}
+
+	return nil
+}
+
 type APIConfig struct {
-	HTTP     api.Config     `toml:"http"`
-	Security SecurityConfig `toml:"security"`
+	HTTP      api.Config      `toml:"http"`
+	Security  SecurityConfig  `toml:"security"`
+	WebSocket WebSocketConfig `toml:"websocket"`
+	Redirect  RedirectConfig  `toml:"redirect"`
 }
 
 type Config struct {
-	API    APIConfig
-	RTC    rtc.ServerConfig
-	Store  StoreConfig
-	Logger logger.Config
+	API       APIConfig
+	RTC       rtc.ServerConfig
+	Store     StoreConfig
+	Recording RecordingConfig
+	Logger    logger.Config
 }
 
 func (c APIConfig) IsValid() error {
@@ -58,6 +133,14 @@ func (c APIConfig) IsValid() error {
 		return fmt.Errorf("failed to validate http config: %w", err)
 	}
 
+	if err := c.WebSocket.IsValid(); err != nil {
+		return fmt.Errorf("failed to validate websocket config: %w", err)
+	}
+
+	if err := c.Redirect.IsValid(); err != nil {
+		return fmt.Errorf("failed to validate redirect config: %w", err)
+	}
+
 	return nil
 }
 
@@ -74,16 +157,25 @@ func (c Config) IsValid() error {
 		return err
 	}
 
+	if err := c.Recording.IsValid(); err != nil {
+		return err
+	}
+
 	return c.Logger.IsValid()
 }
 
 func (c *Config) SetDefaults() {
 	c.API.HTTP.ListenAddress = ":8045"
+	c.API.HTTP.Affinity.CookieName = "rtcd_node"
+	c.API.HTTP.Affinity.HeaderName = "X-Rtcd-Node"
 	c.API.Security.SessionCache.ExpirationMinutes = 1440
 	c.RTC.ICEPortUDP = 8443
 	c.RTC.ICEPortTCP = 8443
 	c.RTC.TURNConfig.CredentialsExpirationMinutes = 1440
+	c.RTC.TURNAdvertisePolicy = rtc.TURNAdvertisePolicyAlways
 	c.RTC.UDPSocketsCount = rtc.GetDefaultUDPListeningSocketsCount()
+	c.RTC.ICETCPAcceptConcurrency = rtc.GetDefaultTCPAcceptConcurrency()
+	c.RTC.EnableRTCPReducedSize = true
 	c.Store.DataSource = "/tmp/rtcd_db"
 	c.Logger.EnableConsole = true
 	c.Logger.ConsoleJSON = false
@@ -106,6 +198,26 @@ func (c StoreConfig) IsValid() error {
 	return nil
 }
 
+type RecordingConfig struct {
+	// The directory audio-only call recordings, requested by clients through
+	// ClientMessageAudioRecordingStart, are written to. An empty value
+	// disables audio recordings. Recordings hold the mixed audio of the call
+	// and so also require audio codecs to be set (WithAudioCodecs).
+	AudioDir string `toml:"audio_dir"`
+}
+
+func (c RecordingConfig) IsValid() error {
+	if c.AudioDir == "" {
+		return nil
+	}
+
+	if !filepath.IsAbs(c.AudioDir) {
+		return fmt.Errorf("invalid AudioDir value: should be an absolute path")
+	}
+
+	return nil
+}
+
 type ClientConfig struct {
 	httpURL string
 	wsURL   string
@@ -24,6 +24,14 @@ func TestSecurityConfigIsValid(t *testing.T) {
 		require.Equal(t, "invalid AdminSecretKey value: should not be empty", err.Error())
 	})
 
+	t.Run("negative MaxRegisteredClients", func(t *testing.T) {
+		var cfg SecurityConfig
+		cfg.MaxRegisteredClients = -1
+		err := cfg.IsValid()
+		require.Error(t, err)
+		require.Equal(t, "invalid MaxRegisteredClients value: should not be negative", err.Error())
+	})
+
 	t.Run("valid", func(t *testing.T) {
 		var cfg SecurityConfig
 		cfg.EnableAdmin = true
@@ -33,6 +41,87 @@ func TestSecurityConfigIsValid(t *testing.T) {
 	})
 }
 
+func TestWebSocketConfigIsValid(t *testing.T) {
+	t.Run("empty struct", func(t *testing.T) {
+		var cfg WebSocketConfig
+		err := cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("negative PongWaitSeconds", func(t *testing.T) {
+		var cfg WebSocketConfig
+		cfg.PongWaitSeconds = -1
+		err := cfg.IsValid()
+		require.Error(t, err)
+		require.Equal(t, "invalid PongWaitSeconds value: should not be negative", err.Error())
+	})
+
+	t.Run("PongWaitSeconds too low", func(t *testing.T) {
+		var cfg WebSocketConfig
+		cfg.PongWaitSeconds = 10
+		err := cfg.IsValid()
+		require.Error(t, err)
+		require.Equal(t, "invalid PongWaitSeconds value: should be greater than 10", err.Error())
+	})
+
+	t.Run("negative MaxMessageSizeKB", func(t *testing.T) {
+		var cfg WebSocketConfig
+		cfg.MaxMessageSizeKB = -1
+		err := cfg.IsValid()
+		require.Error(t, err)
+		require.Equal(t, "invalid MaxMessageSizeKB value: should not be negative", err.Error())
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		var cfg WebSocketConfig
+		cfg.PongWaitSeconds = 15
+		cfg.MaxMessageSizeKB = 64
+		err := cfg.IsValid()
+		require.NoError(t, err)
+	})
+}
+
+func TestRedirectConfigIsValid(t *testing.T) {
+	t.Run("empty struct", func(t *testing.T) {
+		var cfg RedirectConfig
+		err := cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("negative MaxSessions", func(t *testing.T) {
+		var cfg RedirectConfig
+		cfg.MaxSessions = -1
+		err := cfg.IsValid()
+		require.Error(t, err)
+		require.Equal(t, "invalid MaxSessions value: should not be negative", err.Error())
+	})
+
+	t.Run("empty URL", func(t *testing.T) {
+		var cfg RedirectConfig
+		cfg.MaxSessions = 10
+		err := cfg.IsValid()
+		require.Error(t, err)
+		require.Equal(t, "invalid URL value: should not be empty", err.Error())
+	})
+
+	t.Run("invalid URL", func(t *testing.T) {
+		var cfg RedirectConfig
+		cfg.MaxSessions = 10
+		cfg.URL = "ftp://localhost"
+		err := cfg.IsValid()
+		require.Error(t, err)
+		require.Equal(t, `invalid URL value: invalid url scheme: "ftp" is not valid`, err.Error())
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		var cfg RedirectConfig
+		cfg.MaxSessions = 10
+		cfg.URL = "http://localhost:8045"
+		err := cfg.IsValid()
+		require.NoError(t, err)
+	})
+}
+
 func TestStoreConfigIsValid(t *testing.T) {
 	t.Run("empty struct", func(t *testing.T) {
 		var cfg StoreConfig
@@ -49,6 +138,29 @@ func TestStoreConfigIsValid(t *testing.T) {
 	})
 }
 
+func TestRecordingConfigIsValid(t *testing.T) {
+	t.Run("empty struct", func(t *testing.T) {
+		var cfg RecordingConfig
+		err := cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("relative AudioDir", func(t *testing.T) {
+		var cfg RecordingConfig
+		cfg.AudioDir = "recordings"
+		err := cfg.IsValid()
+		require.Error(t, err)
+		require.Equal(t, "invalid AudioDir value: should be an absolute path", err.Error())
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		var cfg RecordingConfig
+		cfg.AudioDir = "/tmp/rtcd_recordings"
+		err := cfg.IsValid()
+		require.NoError(t, err)
+	})
+}
+
 func TestClientConfigParse(t *testing.T) {
 	t.Run("empty struct", func(t *testing.T) {
 		var cfg ClientConfig
@@ -0,0 +1,95 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/mattermost/rtcd/service/api"
+)
+
+// authedHandlerFunc handles an authenticated request. An empty clientID means
+// admin. The outcome should be recorded in data, which gets audited once the
+// handler returns.
+type authedHandlerFunc func(w http.ResponseWriter, r *http.Request, clientID string, data *httpData)
+
+// auditResponseWriter keeps track of whether the handler wrote a response so
+// that the audit doesn't write a second one.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *auditResponseWriter) WriteHeader(code int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (w *auditResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// authedHandler returns a handler only accepting the given methods which
+// authenticates the request before passing it to handler. The request is
+// audited under name once it's done.
+func (s *Service) authedHandler(name string, handler authedHandlerFunc, methods ...string) api.HandleFunc {
+	return s.newAuthedHandler(name, false, handler, methods)
+}
+
+// adminHandler is the same as authedHandler except that only admin requests
+// are accepted, provided admin access is enabled.
+func (s *Service) adminHandler(name string, handler authedHandlerFunc, methods ...string) api.HandleFunc {
+	return s.newAuthedHandler(name, true, handler, methods)
+}
+
+func (s *Service) newAuthedHandler(name string, adminOnly bool, handler authedHandlerFunc, methods []string) api.HandleFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(methods, r.Method) {
+			http.NotFound(w, r)
+			return
+		}
+
+		data := &httpData{
+			reqData: map[string]string{},
+			resData: map[string]string{},
+		}
+		rw := &auditResponseWriter{ResponseWriter: w}
+		defer func() {
+			if rw.written {
+				s.httpAudit(name, data, nil, r)
+				return
+			}
+			s.httpAudit(name, data, w, r)
+		}()
+
+		if adminOnly && !s.cfg.API.Security.EnableAdmin {
+			data.err = "admin access not enabled"
+			data.code = http.StatusForbidden
+			return
+		}
+
+		clientID, code, err := s.authHandler(w, r)
+		if err != nil {
+			data.err = err.Error()
+			data.code = code
+			return
+		}
+
+		// An empty clientID means admin.
+		if adminOnly && clientID != "" {
+			data.err = "forbidden"
+			data.code = http.StatusForbidden
+			return
+		}
+
+		handler(rw, r, clientID, data)
+	}
+}
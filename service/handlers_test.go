@@ -0,0 +1,82 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminHandler(t *testing.T) {
+	th := SetupTestHelper(t, nil)
+	defer th.Teardown()
+
+	var called bool
+	handler := th.srvc.adminHandler("test", func(w http.ResponseWriter, r *http.Request, clientID string, data *httpData) {
+		called = true
+		require.Empty(t, clientID)
+		data.reqData["key"] = r.URL.Query().Get("key")
+		data.code = http.StatusOK
+		if r.URL.Query().Get("body") == "true" {
+			w.Header().Add("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]string{"custom": "body"})
+		}
+	}, http.MethodGet)
+
+	do := func(method, url string, auth bool) (int, map[string]string) {
+		t.Helper()
+		called = false
+		req := httptest.NewRequest(method, url, nil)
+		if auth {
+			req.SetBasicAuth("", th.srvc.cfg.API.Security.AdminSecretKey)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		var res map[string]string
+		_ = json.NewDecoder(rec.Body).Decode(&res)
+		return rec.Code, res
+	}
+
+	t.Run("invalid method", func(t *testing.T) {
+		code, _ := do(http.MethodPost, "/test", true)
+		require.Equal(t, http.StatusNotFound, code)
+		require.False(t, called)
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		code, res := do(http.MethodGet, "/test", false)
+		require.Equal(t, http.StatusUnauthorized, code)
+		require.NotEmpty(t, res["error"])
+		require.False(t, called)
+	})
+
+	t.Run("admin disabled", func(t *testing.T) {
+		th.srvc.cfg.API.Security.EnableAdmin = false
+		defer func() {
+			th.srvc.cfg.API.Security.EnableAdmin = true
+		}()
+		code, res := do(http.MethodGet, "/test", true)
+		require.Equal(t, http.StatusForbidden, code)
+		require.Equal(t, "admin access not enabled", res["error"])
+		require.False(t, called)
+	})
+
+	t.Run("audited response", func(t *testing.T) {
+		code, res := do(http.MethodGet, "/test?key=value", true)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, map[string]string{"code": "200"}, res)
+		require.True(t, called)
+	})
+
+	t.Run("handler response", func(t *testing.T) {
+		code, res := do(http.MethodGet, "/test?body=true", true)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, map[string]string{"custom": "body"}, res)
+		require.True(t, called)
+	})
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"net/http"
+)
+
+// getHealth is meant to be used as a liveness probe. It always succeeds
+// as long as the API server is up.
+func (s *Service) getHealth(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.NotFound(w, req)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// getReady is meant to be used as a readiness probe. It only succeeds once
+// the service has fully started and while it's not draining, so that no new
+// calls get routed to an instance that is shutting down.
+func (s *Service) getReady(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.NotFound(w, req)
+		return
+	}
+
+	if !s.ready.Load() {
+		http.Error(w, "service is not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	if s.rtcServer.IsDraining() {
+		http.Error(w, "service is draining", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthAndReady(t *testing.T) {
+	th := SetupTestHelper(t, nil)
+	defer func() {
+		err := os.RemoveAll(th.dbDir)
+		require.NoError(t, err)
+	}()
+
+	getStatus := func(path string) int {
+		t.Helper()
+		resp, err := http.Get(th.apiURL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	t.Run("invalid method", func(t *testing.T) {
+		for _, path := range []string{"/health", "/ready"} {
+			resp, err := http.Post(th.apiURL+path, "", nil)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		}
+	})
+
+	t.Run("started", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, getStatus("/health"))
+		require.Equal(t, http.StatusOK, getStatus("/ready"))
+	})
+
+	t.Run("draining", func(t *testing.T) {
+		cfg := rtc.SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err := th.srvc.rtcServer.InitSession(cfg, nil)
+		require.NoError(t, err)
+
+		stopErrCh := make(chan error, 1)
+		go func() {
+			stopErrCh <- th.srvc.Stop()
+		}()
+
+		require.Eventually(t, func() bool {
+			return getStatus("/ready") == http.StatusServiceUnavailable
+		}, 4*time.Second, 50*time.Millisecond)
+		require.Equal(t, http.StatusOK, getStatus("/health"))
+
+		err = th.srvc.rtcServer.CloseSession(cfg.SessionID, rtc.CloseReasonLeft)
+		require.NoError(t, err)
+
+		select {
+		case err := <-stopErrCh:
+			require.NoError(t, err)
+		case <-time.After(4 * time.Second):
+			require.Fail(t, "timed out waiting for service to stop")
+		}
+	})
+}
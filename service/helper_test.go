@@ -26,7 +26,7 @@ type TestHelper struct {
 }
 
 // SetupTestHelper takes a *cfg, pass nil to use the default config.
-func SetupTestHelper(tb testing.TB, cfg *Config) *TestHelper {
+func SetupTestHelper(tb testing.TB, cfg *Config, opts ...ServiceOption) *TestHelper {
 	tb.Helper()
 	var err error
 
@@ -40,7 +40,7 @@ func SetupTestHelper(tb testing.TB, cfg *Config) *TestHelper {
 		dbDir: cfg.Store.DataSource,
 	}
 
-	th.srvc, err = New(th.cfg)
+	th.srvc, err = New(th.cfg, opts...)
 	require.NoError(th.tb, err)
 	require.NotNil(th.tb, th.srvc)
 
@@ -5,16 +5,54 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"net"
+
+	"github.com/mattermost/rtcd/service/rtc"
 )
 
+type ServiceOption func(s *Service) error
+
 type ClientOption func(c *Client) error
 type ClientReconnectCb func(c *Client, attempt int) error
+type ClientReconnectStateCb func(c *Client, state ClientReconnectState) error
+
+// ClientReconnectState holds information about the lost connection. It's
+// passed to a ClientReconnectStateCb prior to every reconnection attempt.
+type ClientReconnectState struct {
+	// Attempt is the current reconnection attempt, starting from 1.
+	Attempt int
+	// LastConnID is the ID of the last connection established with the
+	// service.
+	LastConnID string
+	// ServerRestarted is true if the service likely restarted since the last
+	// connection was established, in which case any state it held (e.g.
+	// client registrations) may need to be recreated.
+	ServerRestarted bool
+}
 type DialContextFn func(ctx context.Context, network, addr string) (net.Conn, error)
 
 // WithClientReconnectCb lets the caller set an optional callback to be called prior to
 // performing a WebSocket reconnection.
 func WithClientReconnectCb(cb ClientReconnectCb) ClientOption {
+	return func(c *Client) error {
+		if cb == nil {
+			c.reconnectCb = nil
+			return nil
+		}
+		c.reconnectCb = func(c *Client, state ClientReconnectState) error {
+			return cb(c, state.Attempt)
+		}
+		return nil
+	}
+}
+
+// WithClientReconnectStateCb lets the caller set an optional callback to be
+// called prior to performing a WebSocket reconnection. Compared to
+// WithClientReconnectCb, the callback is also passed information about the
+// previous connection so that the caller can decide whether to re-register or
+// resume. It replaces any callback previously set through WithClientReconnectCb.
+func WithClientReconnectStateCb(cb ClientReconnectStateCb) ClientOption {
 	return func(c *Client) error {
 		c.reconnectCb = cb
 		return nil
@@ -29,3 +67,19 @@ func WithDialFunc(dialFn DialContextFn) ClientOption {
 		return nil
 	}
 }
+
+// WithAudioCodecs lets the caller provide the Opus codecs needed to mix the
+// audio of a call, which audio recordings rely on. Since no Opus
+// implementation ships with rtcd, audio recordings are unavailable otherwise.
+// A new decoder and encoder are created for every mixed track and recording
+// respectively, as they are stateful.
+func WithAudioCodecs(newDecoder func() (rtc.AudioDecoder, error), newEncoder func() (rtc.AudioEncoder, error)) ServiceOption {
+	return func(s *Service) error {
+		if newDecoder == nil || newEncoder == nil {
+			return fmt.Errorf("audio codecs should not be nil")
+		}
+		s.newAudioDecoder = newDecoder
+		s.newAudioEncoder = newEncoder
+		return nil
+	}
+}
@@ -5,6 +5,7 @@ package perf
 
 import (
 	"net/http"
+	"runtime"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
@@ -15,21 +16,37 @@ const (
 	metricsSubSystemRTC       = "rtc"
 	metricsSubSystemRTCClient = "rtc_client"
 	metricsSubSystemWS        = "ws"
+	metricsSubSystemAuth      = "auth"
 )
 
 var (
 	latencyBuckets = []float64{.001, .005, .0075, .01, .025, .05, .075, .1, .25, .3, .4, .5, .75, 1}
 	lossBuckets    = []float64{.001, .005, .0075, .01, .025, .05, .075, .1, .25, .5, .75, 1}
+	// signalingBuckets are wider than latencyBuckets since signaling
+	// messages are relayed through the Mattermost server.
+	signalingBuckets = []float64{.01, .025, .05, .1, .25, .5, .75, 1, 2.5, 5, 10}
 )
 
 type Metrics struct {
 	registry *prometheus.Registry
 
-	RTPTracks            *prometheus.GaugeVec
-	RTPTrackWrites       *prometheus.HistogramVec
-	RTCSessions          *prometheus.GaugeVec
-	RTCConnStateCounters *prometheus.CounterVec
-	RTCErrors            *prometheus.CounterVec
+	RTPTracks             *prometheus.GaugeVec
+	RTPTrackWrites        *prometheus.HistogramVec
+	RTCSessions           *prometheus.GaugeVec
+	RTCCalls              prometheus.Gauge
+	RTCGroups             prometheus.Gauge
+	Goroutines            prometheus.GaugeFunc
+	RTCConnStateCounters  *prometheus.CounterVec
+	RTCErrors             *prometheus.CounterVec
+	RTCSessionInitsQueued prometheus.Gauge
+	RTCSignalingRTT       *prometheus.HistogramVec
+	RTCCallDrains         prometheus.Counter
+	RTCRecordingBytes     *prometheus.CounterVec
+	RTCPeerConnRetries    *prometheus.CounterVec
+	RTCDroppedMessages    *prometheus.CounterVec
+	RTCCoalescedOffers    *prometheus.CounterVec
+	RTCChannelFull        *prometheus.CounterVec
+	RTCChannelDepth       *prometheus.GaugeVec
 
 	RTCClientLoss   *prometheus.HistogramVec
 	RTCClientRTT    *prometheus.HistogramVec
@@ -37,6 +54,10 @@ type Metrics struct {
 
 	WSConnections     *prometheus.GaugeVec
 	WSMessageCounters *prometheus.CounterVec
+	WSErrors          *prometheus.CounterVec
+
+	AuthErrors        *prometheus.CounterVec
+	RegisteredClients prometheus.Gauge
 }
 
 func NewMetrics(namespace string, registry *prometheus.Registry) *Metrics {
@@ -86,6 +107,37 @@ func NewMetrics(namespace string, registry *prometheus.Registry) *Metrics {
 	)
 	m.registry.MustRegister(m.RTCSessions)
 
+	m.RTCCalls = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: metricsSubSystemRTC,
+			Name:      "calls_total",
+			Help:      "Total number of active calls",
+		},
+	)
+	m.registry.MustRegister(m.RTCCalls)
+
+	m.RTCGroups = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: metricsSubSystemRTC,
+			Name:      "groups_total",
+			Help:      "Total number of groups with active calls",
+		},
+	)
+	m.registry.MustRegister(m.RTCGroups)
+
+	// Sampled on scrape so it doesn't need updating.
+	m.Goroutines = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "goroutines",
+			Help:      "Number of goroutines that currently exist",
+		},
+		func() float64 { return float64(runtime.NumGoroutine()) },
+	)
+	m.registry.MustRegister(m.Goroutines)
+
 	m.RTCConnStateCounters = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
@@ -108,6 +160,104 @@ func NewMetrics(namespace string, registry *prometheus.Registry) *Metrics {
 	)
 	m.registry.MustRegister(m.RTCErrors)
 
+	m.RTCSessionInitsQueued = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: metricsSubSystemRTC,
+			Name:      "session_inits_queued_total",
+			Help:      "Total number of session initializations waiting to start",
+		},
+	)
+	m.registry.MustRegister(m.RTCSessionInitsQueued)
+
+	m.RTCSignalingRTT = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: metricsSubSystemRTC,
+			Name:      "signaling_rtt",
+			Help:      "Time taken by clients to answer renegotiation offers",
+			Buckets:   signalingBuckets,
+		},
+		[]string{"groupID"},
+	)
+	m.registry.MustRegister(m.RTCSignalingRTT)
+
+	m.RTCCallDrains = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: metricsSubSystemRTC,
+			Name:      "call_drains_total",
+			Help:      "Total number of calls drained for maintenance",
+		},
+	)
+	m.registry.MustRegister(m.RTCCallDrains)
+
+	m.RTCRecordingBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: metricsSubSystemRTC,
+			Name:      "recording_bytes_total",
+			Help:      "Total number of bytes written by call recordings",
+		},
+		[]string{"groupID"},
+	)
+	m.registry.MustRegister(m.RTCRecordingBytes)
+
+	m.RTCPeerConnRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: metricsSubSystemRTC,
+			Name:      "peer_connection_retries_total",
+			Help:      "Total number of retried peer connection creations",
+		},
+		[]string{"groupID"},
+	)
+	m.registry.MustRegister(m.RTCPeerConnRetries)
+
+	m.RTCDroppedMessages = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: metricsSubSystemRTC,
+			Name:      "dropped_messages_total",
+			Help:      "Total number of messages dropped, either because of full internal channels or rate limiting",
+		},
+		[]string{"groupID", "channel", "reason"},
+	)
+	m.registry.MustRegister(m.RTCDroppedMessages)
+
+	m.RTCCoalescedOffers = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: metricsSubSystemRTC,
+			Name:      "coalesced_offers_total",
+			Help:      "Total number of offers avoided by coalescing track changes held for sessions with too many outstanding offers",
+		},
+		[]string{"groupID"},
+	)
+	m.registry.MustRegister(m.RTCCoalescedOffers)
+
+	m.RTCChannelFull = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: metricsSubSystemRTC,
+			Name:      "channel_full_total",
+			Help:      "Total number of messages that failed to be queued because an internal channel was full",
+		},
+		[]string{"groupID", "channel"},
+	)
+	m.registry.MustRegister(m.RTCChannelFull)
+
+	m.RTCChannelDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: metricsSubSystemRTC,
+			Name:      "channel_depth",
+			Help:      "Current number of messages queued in the server's signaling channels",
+		},
+		[]string{"channel"},
+	)
+	m.registry.MustRegister(m.RTCChannelDepth)
+
 	m.WSConnections = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
@@ -130,6 +280,38 @@ func NewMetrics(namespace string, registry *prometheus.Registry) *Metrics {
 	)
 	m.registry.MustRegister(m.WSMessageCounters)
 
+	m.WSErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: metricsSubSystemWS,
+			Name:      "errors_total",
+			Help:      "Total number of WebSocket connection errors",
+		},
+		[]string{"clientID", "type"},
+	)
+	m.registry.MustRegister(m.WSErrors)
+
+	m.AuthErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: metricsSubSystemAuth,
+			Name:      "errors_total",
+			Help:      "Total number of auth related errors",
+		},
+		[]string{"type"},
+	)
+	m.registry.MustRegister(m.AuthErrors)
+
+	m.RegisteredClients = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: metricsSubSystemAuth,
+			Name:      "registered_clients_total",
+			Help:      "Total number of registered clients",
+		},
+	)
+	m.registry.MustRegister(m.RegisteredClients)
+
 	// Client metrics
 
 	m.RTCClientLoss = prometheus.NewHistogramVec(
@@ -179,6 +361,14 @@ func (m *Metrics) DecRTCSessions(groupID string) {
 	m.RTCSessions.With(prometheus.Labels{"groupID": groupID}).Dec()
 }
 
+func (m *Metrics) SetRTCCallCount(count int) {
+	m.RTCCalls.Set(float64(count))
+}
+
+func (m *Metrics) SetRTCGroupCount(count int) {
+	m.RTCGroups.Set(float64(count))
+}
+
 func (m *Metrics) IncRTCConnState(state string) {
 	m.RTCConnStateCounters.With(prometheus.Labels{"type": state}).Inc()
 }
@@ -195,6 +385,42 @@ func (m *Metrics) DecRTPTracks(groupID, direction, trackType string) {
 	m.RTPTracks.With(prometheus.Labels{"groupID": groupID, "direction": direction, "type": trackType}).Dec()
 }
 
+func (m *Metrics) IncRTCSessionInitsQueued() {
+	m.RTCSessionInitsQueued.Inc()
+}
+
+func (m *Metrics) DecRTCSessionInitsQueued() {
+	m.RTCSessionInitsQueued.Dec()
+}
+
+func (m *Metrics) IncRTCCallDrains() {
+	m.RTCCallDrains.Inc()
+}
+
+func (m *Metrics) AddRTCRecordingBytes(groupID string, n int) {
+	m.RTCRecordingBytes.With(prometheus.Labels{"groupID": groupID}).Add(float64(n))
+}
+
+func (m *Metrics) IncRTCPeerConnRetries(groupID string) {
+	m.RTCPeerConnRetries.With(prometheus.Labels{"groupID": groupID}).Inc()
+}
+
+func (m *Metrics) IncRTCDroppedMessages(groupID, channel, reason string) {
+	m.RTCDroppedMessages.With(prometheus.Labels{"groupID": groupID, "channel": channel, "reason": reason}).Inc()
+}
+
+func (m *Metrics) AddRTCCoalescedOffers(groupID string, n int) {
+	m.RTCCoalescedOffers.With(prometheus.Labels{"groupID": groupID}).Add(float64(n))
+}
+
+func (m *Metrics) IncRTCChannelFull(groupID, channel string) {
+	m.RTCChannelFull.With(prometheus.Labels{"groupID": groupID, "channel": channel}).Inc()
+}
+
+func (m *Metrics) SetRTCChannelDepth(channel string, depth int) {
+	m.RTCChannelDepth.With(prometheus.Labels{"channel": channel}).Set(float64(depth))
+}
+
 func (m *Metrics) IncWSConnections(clientID string) {
 	m.WSConnections.With(prometheus.Labels{"clientID": clientID}).Inc()
 }
@@ -207,6 +433,18 @@ func (m *Metrics) IncWSMessages(clientID, msgType, direction string) {
 	m.WSMessageCounters.With(prometheus.Labels{"clientID": clientID, "type": msgType, "direction": direction}).Inc()
 }
 
+func (m *Metrics) IncWSErrors(clientID, errType string) {
+	m.WSErrors.With(prometheus.Labels{"clientID": clientID, "type": errType}).Inc()
+}
+
+func (m *Metrics) IncAuthErrors(errType string) {
+	m.AuthErrors.With(prometheus.Labels{"type": errType}).Inc()
+}
+
+func (m *Metrics) SetRegisteredClients(count int) {
+	m.RegisteredClients.Set(float64(count))
+}
+
 func (m *Metrics) Handler() http.Handler {
 	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
 }
@@ -215,6 +453,10 @@ func (m *Metrics) ObserveRTPTracksWrite(groupID, trackType string, dur float64)
 	m.RTPTrackWrites.With(prometheus.Labels{"groupID": groupID, "type": trackType}).Observe(dur)
 }
 
+func (m *Metrics) ObserveRTCSignalingRTT(groupID string, val float64) {
+	m.RTCSignalingRTT.With(prometheus.Labels{"groupID": groupID}).Observe(val)
+}
+
 func (m *Metrics) ObserveRTCClientLossRate(groupID string, val float64) {
 	m.RTCClientLoss.With(prometheus.Labels{"groupID": groupID}).Observe(val)
 }
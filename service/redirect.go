@@ -0,0 +1,47 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errOverCapacity is returned to joining sessions when the instance reached
+// APIConfig.Redirect.MaxSessions.
+var errOverCapacity = errors.New("instance is over capacity")
+
+// isOverCapacity returns whether joining sessions should be redirected to a
+// different instance (APIConfig.Redirect).
+func (s *Service) isOverCapacity() bool {
+	if s.cfg.API.Redirect.MaxSessions == 0 {
+		return false
+	}
+
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return len(s.connMap) >= s.cfg.API.Redirect.MaxSessions
+}
+
+// sendRedirect rejects the given session's join, pointing the client to the
+// instance at the configured redirect URL instead. Only this join is
+// affected: the client's connection, and so any other session it carries,
+// is left untouched.
+func (s *Service) sendRedirect(connID, clientID, sessionID string) error {
+	data, err := NewPackedClientMessage(ClientMessageError, map[string]string{
+		"sessionID": sessionID,
+		"code":      ClientErrorCodeRedirect,
+		"error":     errOverCapacity.Error(),
+		"url":       s.cfg.API.Redirect.URL,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to pack error message: %w", err)
+	}
+
+	if err := s.sendClientMessage(connID, clientID, data); err != nil {
+		return fmt.Errorf("failed to send error message: %w", err)
+	}
+
+	return nil
+}
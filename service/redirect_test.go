@@ -0,0 +1,130 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/auth"
+	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientRedirect(t *testing.T) {
+	cfgB := MakeDefaultCfg(t)
+	cfgB.RTC.ICEPortUDP = 30445
+	cfgB.RTC.ICEPortTCP = 30445
+	thB := SetupTestHelper(t, cfgB)
+	defer thB.Teardown()
+
+	cfgA := MakeDefaultCfg(t)
+	cfgA.API.Redirect.MaxSessions = 1
+	cfgA.API.Redirect.URL = thB.apiURL
+	thA := SetupTestHelper(t, cfgA)
+	defer thA.Teardown()
+
+	authKey, err := random.NewSecureString(auth.MinKeyLen)
+	require.NoError(t, err)
+	err = thA.adminClient.Register("clientA", authKey)
+	require.NoError(t, err)
+	err = thB.adminClient.Register("clientA", authKey)
+	require.NoError(t, err)
+
+	c, err := NewClient(ClientConfig{
+		URL:      thA.apiURL,
+		ClientID: "clientA",
+		AuthKey:  authKey,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	err = c.Connect()
+	require.NoError(t, err)
+
+	waitForMsg := func(c *Client, msgType string) ClientMessage {
+		t.Helper()
+		for {
+			select {
+			case msg, ok := <-c.ReceiveCh():
+				require.True(t, ok)
+				if msg.Type == msgType {
+					return msg
+				}
+			case <-time.After(5 * time.Second):
+				require.FailNow(t, "timed out waiting for message", msgType)
+			}
+		}
+	}
+
+	msg := waitForMsg(c, ClientMessageHello)
+	require.Equal(t, thA.srvc.instanceID, msg.Data.(map[string]string)["instanceID"])
+
+	join := func(c *Client, sessionID string) {
+		t.Helper()
+		err := c.Send(*NewClientMessage(ClientMessageJoin, map[string]any{
+			"callID":    "callA",
+			"userID":    random.NewID(),
+			"sessionID": sessionID,
+		}))
+		require.NoError(t, err)
+	}
+
+	// The first session fills the instance.
+	sessionA := random.NewID()
+	join(c, sessionA)
+	require.Eventually(t, func() bool {
+		return thA.srvc.isOverCapacity()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The second one gets rejected with a redirect.
+	sessionB := random.NewID()
+	join(c, sessionB)
+
+	msg = waitForMsg(c, ClientMessageError)
+	require.Equal(t, map[string]string{
+		"sessionID": sessionB,
+		"code":      ClientErrorCodeRedirect,
+		"error":     errOverCapacity.Error(),
+		"url":       thB.apiURL,
+	}, msg.Data)
+
+	// The connection, and so the sessions already joined through it, are not
+	// affected.
+	require.True(t, c.Connected())
+	thA.srvc.mut.RLock()
+	require.NotEmpty(t, thA.srvc.connMap[sessionA])
+	_, ok := thA.srvc.connMap[sessionB]
+	thA.srvc.mut.RUnlock()
+	require.False(t, ok)
+
+	// Joining through a separate connection to the other instance.
+	cB, err := NewClient(ClientConfig{
+		URL:      msg.Data.(map[string]string)["url"],
+		ClientID: "clientA",
+		AuthKey:  authKey,
+	})
+	require.NoError(t, err)
+	defer cB.Close()
+
+	err = cB.Connect()
+	require.NoError(t, err)
+
+	msg = waitForMsg(cB, ClientMessageHello)
+	require.Equal(t, thB.srvc.instanceID, msg.Data.(map[string]string)["instanceID"])
+
+	join(cB, sessionB)
+	require.Eventually(t, func() bool {
+		thB.srvc.mut.RLock()
+		defer thB.srvc.mut.RUnlock()
+		return thB.srvc.connMap[sessionB] != ""
+	}, 5*time.Second, 10*time.Millisecond)
+
+	err = thA.srvc.rtcServer.CloseSession(sessionA, rtc.CloseReasonLeft)
+	require.NoError(t, err)
+	err = thB.srvc.rtcServer.CloseSession(sessionB, rtc.CloseReasonLeft)
+	require.NoError(t, err)
+}
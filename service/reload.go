@@ -0,0 +1,103 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mattermost/rtcd/logger"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+// getImmutableConfigChanges returns the config sections in which settings that
+// can't be changed at runtime differ between oldCfg and newCfg.
+func getImmutableConfigChanges(oldCfg, newCfg Config) []string {
+	// Copying over the settings that can be reloaded so that whatever is left
+	// different requires a restart.
+	newCfg.RTC.ICEServers = oldCfg.RTC.ICEServers
+	newCfg.RTC.TURNConfig = oldCfg.RTC.TURNConfig
+	newCfg.Logger.ConsoleLevel = oldCfg.Logger.ConsoleLevel
+	newCfg.Logger.FileLevel = oldCfg.Logger.FileLevel
+
+	var changes []string
+	if !reflect.DeepEqual(oldCfg.API, newCfg.API) {
+		changes = append(changes, "api")
+	}
+	if !reflect.DeepEqual(oldCfg.RTC, newCfg.RTC) {
+		changes = append(changes, "rtc")
+	}
+	if !reflect.DeepEqual(oldCfg.Store, newCfg.Store) {
+		changes = append(changes, "store")
+	}
+	if !reflect.DeepEqual(oldCfg.Recording, newCfg.Recording) {
+		changes = append(changes, "recording")
+	}
+	if !reflect.DeepEqual(oldCfg.Logger, newCfg.Logger) {
+		changes = append(changes, "logger")
+	}
+
+	return changes
+}
+
+// Reload applies the given config to the running service. Only a subset of
+// the settings can be changed this way: the ICE servers, the TURN config and
+// the logging levels. Active calls are not affected while sessions joining
+// afterwards use the new values. Reloads changing any other setting (e.g.
+// ports or addresses) are rejected since a restart is needed for them to take
+// effect.
+func (s *Service) Reload(cfg Config) error {
+	if err := cfg.IsValid(); err != nil {
+		return fmt.Errorf("failed to validate config: %w", err)
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if changes := getImmutableConfigChanges(s.cfg, cfg); len(changes) > 0 {
+		err := fmt.Errorf("settings in %s cannot be changed without a restart", strings.Join(changes, ", "))
+		s.log.Warn("rtcd: rejecting config reload", mlog.Err(err))
+		return err
+	}
+
+	// The logger goes first as it's the most likely to fail (e.g. file
+	// targets) and can be reverted should the ICE config be rejected. This way
+	// the reload is either applied as a whole or not at all.
+	oldLoggerCfg := s.cfg.Logger
+	loggerChanged := cfg.Logger != oldLoggerCfg
+	if loggerChanged {
+		if err := s.configureLogger(cfg.Logger); err != nil {
+			if revertErr := s.configureLogger(oldLoggerCfg); revertErr != nil {
+				s.log.Error("rtcd: failed to revert logger config", mlog.Err(revertErr))
+			}
+			return fmt.Errorf("failed to configure logger: %w", err)
+		}
+	}
+
+	if err := s.rtcServer.UpdateICEConfig(cfg.RTC.ICEServers, cfg.RTC.TURNConfig); err != nil {
+		if loggerChanged {
+			if revertErr := s.configureLogger(oldLoggerCfg); revertErr != nil {
+				s.log.Error("rtcd: failed to revert logger config", mlog.Err(revertErr))
+			}
+		}
+		return fmt.Errorf("failed to update ICE config: %w", err)
+	}
+
+	s.cfg.RTC.ICEServers = cfg.RTC.ICEServers
+	s.cfg.RTC.TURNConfig = cfg.RTC.TURNConfig
+	s.cfg.Logger = cfg.Logger
+
+	s.log.Info("rtcd: config reloaded")
+
+	return nil
+}
+
+// configureLogger applies the given config to the service's logger. Since
+// reconfiguring drops any target not part of the config, this goes through
+// the call logs streamer so that its target is kept if in use.
+func (s *Service) configureLogger(cfg logger.Config) error {
+	return s.callLogs.configure(cfg)
+}
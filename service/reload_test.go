@@ -0,0 +1,81 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	th := SetupTestHelper(t, nil)
+	defer th.Teardown()
+
+	t.Run("invalid config", func(t *testing.T) {
+		cfg := th.cfg
+		cfg.Logger.ConsoleLevel = "invalid"
+		err := th.srvc.Reload(cfg)
+		require.ErrorContains(t, err, "failed to validate config")
+	})
+
+	t.Run("immutable settings", func(t *testing.T) {
+		cfg := th.cfg
+		cfg.RTC.ICEPortUDP = 30445
+		cfg.API.HTTP.ListenAddress = ":8046"
+		err := th.srvc.Reload(cfg)
+		require.EqualError(t, err, "settings in api, rtc cannot be changed without a restart")
+		require.Equal(t, th.cfg, th.srvc.cfg)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		cfg := th.cfg
+		cfg.RTC.ICEServers = rtc.ICEServers{
+			rtc.ICEServerConfig{
+				URLs: []string{"turn:turn.example.com:3478"},
+			},
+		}
+		cfg.RTC.TURNConfig = rtc.TURNConfig{
+			StaticAuthSecret:             "secret",
+			CredentialsExpirationMinutes: 60,
+		}
+		cfg.Logger.ConsoleLevel = "DEBUG"
+		err := th.srvc.Reload(cfg)
+		require.NoError(t, err)
+		require.Equal(t, cfg, th.srvc.cfg)
+	})
+
+	t.Run("call logs keep streaming", func(t *testing.T) {
+		callID := random.NewID()
+		ch, err := th.srvc.callLogs.subscribe(callID)
+		require.NoError(t, err)
+		defer th.srvc.callLogs.unsubscribe(callID, ch)
+
+		cfg := th.srvc.cfg
+		cfg.Logger.ConsoleLevel = "INFO"
+		err = th.srvc.Reload(cfg)
+		require.NoError(t, err)
+
+		th.srvc.log.Info("test message", mlog.String("callID", callID))
+
+		select {
+		case record := <-ch:
+			require.Contains(t, string(record), "test message")
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for log record")
+		}
+
+		// The record is only received once.
+		select {
+		case record := <-ch:
+			require.FailNow(t, "unexpected record", string(record))
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
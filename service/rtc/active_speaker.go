@@ -0,0 +1,154 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// activeSpeakerDebounceDefault is the default time a session needs to be
+	// the loudest speaker before becoming the active one
+	// (ServerConfig.ActiveSpeakerDebounceMs).
+	activeSpeakerDebounceDefault = 300 * time.Millisecond
+)
+
+// activeSpeakerDetector keeps track of the current active speaker in a call
+// based on the VAD state and the audio levels of its sessions.
+type activeSpeakerDetector struct {
+	debounce       time.Duration
+	speakers       map[string]*speakerLevel
+	voice          map[string]bool
+	current        string
+	candidate      string
+	candidateSince time.Time
+	now            func() time.Time
+	mut            sync.Mutex
+}
+
+func newActiveSpeakerDetector(debounce time.Duration, now func() time.Time) *activeSpeakerDetector {
+	if debounce <= 0 {
+		debounce = activeSpeakerDebounceDefault
+	}
+
+	if now == nil {
+		now = time.Now
+	}
+
+	return &activeSpeakerDetector{
+		debounce: debounce,
+		speakers: map[string]*speakerLevel{},
+		voice:    map[string]bool{},
+		now:      now,
+	}
+}
+
+// setVoice records the VAD state for the given session.
+func (d *activeSpeakerDetector) setVoice(sessionID string, voice bool) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	if voice {
+		d.voice[sessionID] = true
+	} else {
+		delete(d.voice, sessionID)
+	}
+}
+
+// pushAudioLevel records an audio level sample (RFC 6464, 0 being the
+// loudest) for the given session. It returns true if, as a result, the
+// session became the active speaker.
+func (d *activeSpeakerDetector) pushAudioLevel(sessionID string, level uint8) bool {
+	if level > audioLevelSilence {
+		level = audioLevelSilence
+	}
+	loudness := float64(audioLevelSilence - level)
+
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	now := d.now()
+	sl := d.speakers[sessionID]
+	if sl == nil || now.Sub(sl.lastTS) > audioSelectorStaleTimeout {
+		sl = &speakerLevel{loudness: loudness}
+		d.speakers[sessionID] = sl
+	} else {
+		sl.loudness = audioSelectorSmoothing*loudness + (1-audioSelectorSmoothing)*sl.loudness
+	}
+	sl.lastTS = now
+
+	if sessionID == d.current || !d.isLoudest(sessionID, now) {
+		if sessionID == d.candidate {
+			d.candidate = ""
+		}
+		return false
+	}
+
+	if sessionID != d.candidate {
+		d.candidate = sessionID
+		d.candidateSince = now
+		return false
+	}
+
+	if now.Sub(d.candidateSince) < d.debounce {
+		return false
+	}
+
+	d.current = sessionID
+	d.candidate = ""
+
+	return true
+}
+
+// isLoudest returns whether the given session has voice activity and is the
+// loudest among the sessions that do.
+// NOTE: this is expected to always be called under lock (activeSpeakerDetector.mut).
+func (d *activeSpeakerDetector) isLoudest(sessionID string, now time.Time) bool {
+	if !d.voice[sessionID] {
+		return false
+	}
+
+	loudness := d.speakers[sessionID].loudness
+	for id := range d.voice {
+		if id == sessionID {
+			continue
+		}
+		sl := d.speakers[id]
+		if sl == nil || now.Sub(sl.lastTS) > audioSelectorStaleTimeout {
+			continue
+		}
+		if sl.loudness > loudness {
+			return false
+		}
+	}
+
+	return true
+}
+
+// removeSession drops any state associated with the given session. It
+// returns true if the session was the active speaker, which is then cleared.
+func (d *activeSpeakerDetector) removeSession(sessionID string) bool {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	delete(d.speakers, sessionID)
+	delete(d.voice, sessionID)
+	if d.candidate == sessionID {
+		d.candidate = ""
+	}
+	if d.current == sessionID {
+		d.current = ""
+		return true
+	}
+
+	return false
+}
+
+// getActiveSpeaker returns the ID of the current active speaker, if any.
+func (d *activeSpeakerDetector) getActiveSpeaker() string {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	return d.current
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestActiveSpeakerDetector(t *testing.T) {
+	now := time.Now()
+	nowFn := func() time.Time { return now }
+
+	// pushLevels feeds the given levels (in -dBov so lower means louder) for
+	// the duration d and returns the active speaker changes.
+	pushLevels := func(d *activeSpeakerDetector, levels map[string]uint8, dur time.Duration) []string {
+		var changes []string
+		for i := 0; i < int(dur/(20*time.Millisecond)); i++ {
+			now = now.Add(20 * time.Millisecond)
+			for sessionID, level := range levels {
+				if d.pushAudioLevel(sessionID, level) {
+					changes = append(changes, sessionID)
+				}
+			}
+		}
+		return changes
+	}
+
+	t.Run("default debounce", func(t *testing.T) {
+		d := newActiveSpeakerDetector(0, nowFn)
+		require.Equal(t, activeSpeakerDebounceDefault, d.debounce)
+	})
+
+	t.Run("debounce", func(t *testing.T) {
+		d := newActiveSpeakerDetector(300*time.Millisecond, nowFn)
+		d.setVoice("sessionA", true)
+
+		require.Empty(t, pushLevels(d, map[string]uint8{"sessionA": 30}, 200*time.Millisecond))
+		require.Empty(t, d.getActiveSpeaker())
+
+		require.Equal(t, []string{"sessionA"}, pushLevels(d, map[string]uint8{"sessionA": 30}, 200*time.Millisecond))
+		require.Equal(t, "sessionA", d.getActiveSpeaker())
+
+		// No further changes while the speaker stays the same.
+		require.Empty(t, pushLevels(d, map[string]uint8{"sessionA": 30}, time.Second))
+	})
+
+	t.Run("voice off", func(t *testing.T) {
+		d := newActiveSpeakerDetector(300*time.Millisecond, nowFn)
+		d.setVoice("sessionA", true)
+
+		// Louder but without voice activity.
+		levels := map[string]uint8{"sessionA": 60, "sessionB": 20}
+		require.Equal(t, []string{"sessionA"}, pushLevels(d, levels, time.Second))
+		require.Equal(t, "sessionA", d.getActiveSpeaker())
+
+		d.setVoice("sessionB", true)
+		require.Equal(t, []string{"sessionB"}, pushLevels(d, levels, time.Second))
+		require.Equal(t, "sessionB", d.getActiveSpeaker())
+	})
+
+	t.Run("no flapping", func(t *testing.T) {
+		d := newActiveSpeakerDetector(300*time.Millisecond, nowFn)
+		d.setVoice("sessionA", true)
+		d.setVoice("sessionB", true)
+
+		require.Equal(t, []string{"sessionA"}, pushLevels(d, map[string]uint8{"sessionA": 30, "sessionB": 35}, time.Second))
+
+		// Short bursts from a competing speaker shouldn't cause changes.
+		for i := 0; i < 5; i++ {
+			require.Empty(t, pushLevels(d, map[string]uint8{"sessionA": 40, "sessionB": 10}, 100*time.Millisecond))
+			require.Empty(t, pushLevels(d, map[string]uint8{"sessionA": 10, "sessionB": 40}, 100*time.Millisecond))
+		}
+		require.Equal(t, "sessionA", d.getActiveSpeaker())
+
+		// A consistently louder one should take over.
+		require.Equal(t, []string{"sessionB"}, pushLevels(d, map[string]uint8{"sessionA": 60, "sessionB": 10}, 2*time.Second))
+		require.Equal(t, "sessionB", d.getActiveSpeaker())
+	})
+
+	t.Run("stale speaker", func(t *testing.T) {
+		d := newActiveSpeakerDetector(300*time.Millisecond, nowFn)
+		d.setVoice("sessionA", true)
+		d.setVoice("sessionB", true)
+
+		require.Equal(t, []string{"sessionA"}, pushLevels(d, map[string]uint8{"sessionA": 10, "sessionB": 60}, time.Second))
+
+		// sessionA stops sending audio levels (e.g. muted).
+		now = now.Add(audioSelectorStaleTimeout + time.Millisecond)
+		require.Equal(t, []string{"sessionB"}, pushLevels(d, map[string]uint8{"sessionB": 60}, time.Second))
+	})
+
+	t.Run("remove session", func(t *testing.T) {
+		d := newActiveSpeakerDetector(300*time.Millisecond, nowFn)
+		d.setVoice("sessionA", true)
+
+		require.Equal(t, []string{"sessionA"}, pushLevels(d, map[string]uint8{"sessionA": 30}, time.Second))
+
+		d.setVoice("sessionB", true)
+		d.pushAudioLevel("sessionB", 60)
+		require.False(t, d.removeSession("sessionB"))
+		require.Equal(t, "sessionA", d.getActiveSpeaker())
+
+		require.True(t, d.removeSession("sessionA"))
+		require.Empty(t, d.getActiveSpeaker())
+		require.Empty(t, d.speakers)
+		require.Empty(t, d.voice)
+	})
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// audioSelectorSmoothing is the weight given to the most recent audio level
+	// sample when computing the smoothed loudness.
+	audioSelectorSmoothing = 0.1
+	// audioSelectorHysteresis is the loudness margin (in dB) a non forwarded
+	// speaker needs to exceed the quietest forwarded one by in order to
+	// replace it.
+	audioSelectorHysteresis = 6.0
+	// audioSelectorUpdateInterval is the minimum interval between selection
+	// updates.
+	audioSelectorUpdateInterval = 200 * time.Millisecond
+	// audioSelectorStaleTimeout is the time after which a speaker that stopped
+	// sending audio levels (e.g. muted) is considered silent.
+	audioSelectorStaleTimeout = time.Second
+	// audioLevelSilence is the lowest audio level (-127 dBov) as defined in
+	// RFC 6464.
+	audioLevelSilence = 127
+)
+
+type speakerLevel struct {
+	loudness float64
+	lastTS   time.Time
+}
+
+// audioSelector keeps track of the loudest speakers in a call so that only
+// a limited number of voice streams gets forwarded.
+type audioSelector struct {
+	maxStreams int
+	// minLoudness is the smoothed loudness under which a speaker is
+	// considered silent and not eligible for forwarding.
+	minLoudness float64
+	speakers    map[string]*speakerLevel
+	forwarded   map[string]bool
+	lastUpdate  time.Time
+	now         func() time.Time
+	mut         sync.Mutex
+}
+
+// newAudioSelector creates a selector forwarding up to maxStreams voice
+// streams. Speakers with an audio level above silenceThreshold (RFC 6464)
+// are considered silent. A zero silenceThreshold disables the check.
+func newAudioSelector(maxStreams, silenceThreshold int, now func() time.Time) *audioSelector {
+	if now == nil {
+		now = time.Now
+	}
+
+	var minLoudness float64
+	if silenceThreshold > 0 {
+		minLoudness = float64(audioLevelSilence - silenceThreshold)
+	}
+
+	return &audioSelector{
+		maxStreams:  maxStreams,
+		minLoudness: minLoudness,
+		speakers:    map[string]*speakerLevel{},
+		forwarded:   map[string]bool{},
+		now:         now,
+	}
+}
+
+// pushAudioLevel records an audio level sample (RFC 6464, 0 being the
+// loudest) for the given session.
+func (a *audioSelector) pushAudioLevel(sessionID string, level uint8) {
+	if level > audioLevelSilence {
+		level = audioLevelSilence
+	}
+	loudness := float64(audioLevelSilence - level)
+
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	now := a.now()
+	sl := a.speakers[sessionID]
+	if sl == nil || now.Sub(sl.lastTS) > audioSelectorStaleTimeout {
+		sl = &speakerLevel{loudness: loudness}
+		a.speakers[sessionID] = sl
+	} else {
+		sl.loudness = audioSelectorSmoothing*loudness + (1-audioSelectorSmoothing)*sl.loudness
+	}
+	sl.lastTS = now
+}
+
+// removeSpeaker drops any state associated with the given session.
+func (a *audioSelector) removeSpeaker(sessionID string) {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	delete(a.speakers, sessionID)
+	delete(a.forwarded, sessionID)
+}
+
+// isForwarded returns whether the voice stream for the given session should
+// currently be forwarded.
+func (a *audioSelector) isForwarded(sessionID string) bool {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	if now := a.now(); now.Sub(a.lastUpdate) >= audioSelectorUpdateInterval {
+		a.update(now)
+	}
+
+	return a.forwarded[sessionID]
+}
+
+func (a *audioSelector) getLoudness(sessionID string, now time.Time) float64 {
+	sl := a.speakers[sessionID]
+	if sl == nil || now.Sub(sl.lastTS) > audioSelectorStaleTimeout {
+		return 0
+	}
+	return sl.loudness
+}
+
+// isSilent returns whether the given session's loudness is below the
+// configured silence threshold.
+// NOTE: this is expected to always be called under lock (audioSelector.mut).
+func (a *audioSelector) isSilent(sessionID string, now time.Time) bool {
+	return a.minLoudness > 0 && a.getLoudness(sessionID, now) < a.minLoudness
+}
+
+// update recomputes the set of forwarded speakers. A currently forwarded
+// speaker only gets replaced if the candidate is louder by at least
+// audioSelectorHysteresis to avoid frequent swaps.
+// NOTE: this is expected to always be called under lock (audioSelector.mut).
+func (a *audioSelector) update(now time.Time) {
+	a.lastUpdate = now
+
+	candidates := make([]string, 0, len(a.speakers))
+	for sessionID := range a.speakers {
+		if !a.forwarded[sessionID] && !a.isSilent(sessionID, now) {
+			candidates = append(candidates, sessionID)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		li, lj := a.getLoudness(candidates[i], now), a.getLoudness(candidates[j], now)
+		if li == lj {
+			return candidates[i] < candidates[j]
+		}
+		return li > lj
+	})
+
+	for _, sessionID := range candidates {
+		if len(a.forwarded) < a.maxStreams {
+			a.forwarded[sessionID] = true
+			continue
+		}
+
+		var quietestID string
+		var quietest float64
+		for id := range a.forwarded {
+			if l := a.getLoudness(id, now); quietestID == "" || l < quietest {
+				quietestID = id
+				quietest = l
+			}
+		}
+
+		// Candidates are sorted so there's no point in checking further.
+		if a.getLoudness(sessionID, now) < quietest+audioSelectorHysteresis {
+			break
+		}
+
+		delete(a.forwarded, quietestID)
+		a.forwarded[sessionID] = true
+	}
+}
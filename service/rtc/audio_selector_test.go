@@ -0,0 +1,119 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudioSelector(t *testing.T) {
+	now := time.Now()
+	nowFn := func() time.Time { return now }
+
+	// Levels are expressed in -dBov so lower means louder.
+	levels := map[string]uint8{
+		"sessionA": 60,
+		"sessionB": 20,
+		"sessionC": 90,
+		"sessionD": 30,
+		"sessionE": 127,
+	}
+
+	pushLevels := func(a *audioSelector, levels map[string]uint8, d time.Duration) {
+		for i := 0; i < int(d/(20*time.Millisecond)); i++ {
+			now = now.Add(20 * time.Millisecond)
+			for sessionID, level := range levels {
+				a.pushAudioLevel(sessionID, level)
+			}
+		}
+	}
+
+	getForwarded := func(a *audioSelector) []string {
+		var forwarded []string
+		for sessionID := range levels {
+			if a.isForwarded(sessionID) {
+				forwarded = append(forwarded, sessionID)
+			}
+		}
+		return forwarded
+	}
+
+	t.Run("loudest forwarded", func(t *testing.T) {
+		a := newAudioSelector(2, 0, nowFn)
+		pushLevels(a, levels, time.Second)
+		require.ElementsMatch(t, []string{"sessionB", "sessionD"}, getForwarded(a))
+	})
+
+	t.Run("swapping speakers", func(t *testing.T) {
+		a := newAudioSelector(2, 0, nowFn)
+		pushLevels(a, levels, time.Second)
+		require.ElementsMatch(t, []string{"sessionB", "sessionD"}, getForwarded(a))
+
+		// A slightly louder speaker should not cause a swap.
+		newLevels := map[string]uint8{
+			"sessionA": 28,
+			"sessionB": 20,
+			"sessionC": 90,
+			"sessionD": 30,
+			"sessionE": 127,
+		}
+		pushLevels(a, newLevels, time.Second)
+		require.ElementsMatch(t, []string{"sessionB", "sessionD"}, getForwarded(a))
+
+		// A much louder speaker replaces the quietest forwarded one.
+		newLevels["sessionA"] = 0
+		pushLevels(a, newLevels, time.Second)
+		require.ElementsMatch(t, []string{"sessionA", "sessionB"}, getForwarded(a))
+	})
+
+	t.Run("stale speaker", func(t *testing.T) {
+		a := newAudioSelector(2, 0, nowFn)
+		pushLevels(a, levels, time.Second)
+		require.ElementsMatch(t, []string{"sessionB", "sessionD"}, getForwarded(a))
+
+		// sessionB stops sending audio (e.g. muted).
+		newLevels := map[string]uint8{
+			"sessionA": 60,
+			"sessionC": 90,
+			"sessionD": 30,
+			"sessionE": 127,
+		}
+		pushLevels(a, newLevels, 2*time.Second)
+		require.ElementsMatch(t, []string{"sessionA", "sessionD"}, getForwarded(a))
+	})
+
+	t.Run("remove speaker", func(t *testing.T) {
+		a := newAudioSelector(2, 0, nowFn)
+		pushLevels(a, levels, time.Second)
+		require.ElementsMatch(t, []string{"sessionB", "sessionD"}, getForwarded(a))
+
+		a.removeSpeaker("sessionB")
+		now = now.Add(audioSelectorUpdateInterval)
+		require.ElementsMatch(t, []string{"sessionA", "sessionD"}, getForwarded(a))
+	})
+	t.Run("silence threshold", func(t *testing.T) {
+		// Without a threshold free slots get filled regardless of levels.
+		a := newAudioSelector(4, 0, nowFn)
+		pushLevels(a, levels, time.Second)
+		require.Len(t, getForwarded(a), 4)
+
+		a = newAudioSelector(4, 80, nowFn)
+		pushLevels(a, levels, time.Second)
+		require.ElementsMatch(t, []string{"sessionA", "sessionB", "sessionD"}, getForwarded(a))
+
+		// A speaker getting louder than the threshold becomes eligible.
+		newLevels := map[string]uint8{
+			"sessionA": 60,
+			"sessionB": 20,
+			"sessionC": 70,
+			"sessionD": 30,
+			"sessionE": 127,
+		}
+		pushLevels(a, newLevels, 2*time.Second)
+		require.ElementsMatch(t, []string{"sessionA", "sessionB", "sessionC", "sessionD"}, getForwarded(a))
+	})
+}
@@ -4,36 +4,110 @@
 package rtc
 
 import (
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pion/webrtc/v4"
 	"golang.org/x/time/rate"
 
 	"github.com/mattermost/mattermost/server/public/shared/mlog"
+
+	"github.com/mattermost/rtcd/service/rtc/dc"
 )
 
+// ErrCallFull is returned when trying to join a call that already has
+// ServerConfig.MaxCallParticipants sessions.
+var ErrCallFull = errors.New("call is full")
+
 type call struct {
 	id            string
 	sessions      map[string]*session
 	screenSession *session
 	pliLimiters   map[webrtc.SSRC]*rate.Limiter
-	metrics       Metrics
+	// pliInterval is the minimum interval between PLI requests forwarded for
+	// the same SSRC (ServerConfig.PLIMaxIntervalMs).
+	pliInterval time.Duration
+	// plcHintLimiters rate limits the audio PLC hints sent to each session,
+	// keyed by session ID. Only set if ServerConfig.EnableAudioPLCHint is true.
+	plcHintLimiters map[string]*rate.Limiter
+	metrics         *serverMetrics
+	// drops accounts for the messages dropped because of full channels.
+	drops *droppedMessages
+	// audioSelector is only set when limiting the number of forwarded voice
+	// streams (ServerConfig.MaxForwardedAudioStreams).
+	audioSelector *audioSelector
+	// activeSpeaker tracks the call's current active speaker based on
+	// sessions' VAD and audio levels.
+	activeSpeaker *activeSpeakerDetector
+	// forwardingSem bounds the number of video tracks concurrently forwarding
+	// packets for the call (ServerConfig.MaxForwardingWorkersPerCall). Nil if
+	// no limit is set.
+	forwardingSem chan struct{}
+	// maxSessions caps the number of sessions in the call
+	// (ServerConfig.MaxCallParticipants). Zero means no limit.
+	maxSessions int
+	// receiversLimiter caps the number of receivers of each published track
+	// (ServerConfig.MaxReceiversPerPublisher). Nil if no limit is set.
+	receiversLimiter *receiversLimiter
+	// audioMixer is only set while the call's voice tracks are being mixed
+	// (Server.StartCallAudioMixer).
+	audioMixer atomic.Pointer[audioMixer]
+	// recorder is only set while the call's audio tracks are being recorded
+	// (Server.StartRecording).
+	recorder atomic.Pointer[callRecorder]
+	// draining is set while the call is being drained (Server.DrainCall) so
+	// that no new sessions can join.
+	draining bool
+	// fixedSimulcastLevel, if set, is the simulcast level all receivers in
+	// the call get (Server.SetCallSimulcastLevel). It's atomic since it's
+	// read by sessions while c.mut may already be held (e.g. iterSessions).
+	fixedSimulcastLevel atomic.Value
 
 	mut sync.RWMutex
 }
 
+// pliMaxIntervalDefault is the default minimum interval between PLI requests
+// forwarded for the same SSRC.
+const pliMaxIntervalDefault = time.Second
+
+// getPLILimiter returns the limiter for the PLI requests forwarded to the
+// given SSRC, creating it if needed.
+func (c *call) getPLILimiter(ssrc webrtc.SSRC) *rate.Limiter {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	limiter, ok := c.pliLimiters[ssrc]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Every(c.pliInterval), 1)
+		c.pliLimiters[ssrc] = limiter
+	}
+
+	return limiter
+}
+
 func (c *call) getSession(sessionID string) *session {
 	c.mut.RLock()
 	defer c.mut.RUnlock()
 	return c.sessions[sessionID]
 }
 
-func (c *call) addSession(cfg SessionConfig, rtcConn *webrtc.PeerConnection, closeCb func() error, log mlog.LoggerIFace) (*session, bool) {
+func (c *call) isFull() bool {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.maxSessions > 0 && len(c.sessions) >= c.maxSessions
+}
+
+func (c *call) addSession(cfg SessionConfig, rtcConn *webrtc.PeerConnection, closeCb func(reason CloseReason) error, log mlog.LoggerIFace) (*session, error) {
 	c.mut.Lock()
 	defer c.mut.Unlock()
 	if s := c.sessions[cfg.SessionID]; s != nil {
-		return s, false
+		return s, errSessionExists
+	}
+	if c.maxSessions > 0 && len(c.sessions) >= c.maxSessions {
+		return nil, ErrCallFull
 	}
 
 	s := &session{
@@ -41,8 +115,14 @@ func (c *call) addSession(cfg SessionConfig, rtcConn *webrtc.PeerConnection, clo
 		rtcConn:            rtcConn,
 		iceInCh:            make(chan []byte, signalChSize*2),
 		sdpOfferInCh:       make(chan offerMessage, signalChSize),
-		sdpAnswerInCh:      make(chan webrtc.SessionDescription, signalChSize),
+		sdpAnswerInCh:      make(chan sdpMessage, signalChSize),
 		dcSDPCh:            make(chan Message, signalChSize),
+		dcBWECh:            make(chan int, 1),
+		dcPLCHintCh:        make(chan float64, 1),
+		dcICEServersCh:     make(chan []webrtc.ICEServer, 1),
+		dcMediaMapCh:       make(chan dc.MessageMediaMap, 1),
+		dcLevelCh:          make(chan string, 1),
+		dcOpenCh:           make(chan struct{}),
 		closeCh:            make(chan struct{}),
 		closeCb:            closeCb,
 		doneCh:             make(chan struct{}),
@@ -53,10 +133,11 @@ func (c *call) addSession(cfg SessionConfig, rtcConn *webrtc.PeerConnection, clo
 		log:                log,
 		call:               c,
 		rxTracks:           make(map[string]webrtc.TrackLocal),
+		createdAt:          time.Now(),
 	}
 
 	c.sessions[cfg.SessionID] = s
-	return s, true
+	return s, nil
 }
 
 func (c *call) getScreenSession() *session {
@@ -65,16 +146,82 @@ func (c *call) getScreenSession() *session {
 	return c.screenSession
 }
 
+// setScreenSession sets the given session as the one screen sharing in the
+// call. It returns false if another session is already sharing. The current
+// screen session can call it again to change its screen source.
 func (c *call) setScreenSession(s *session) bool {
 	c.mut.Lock()
 	defer c.mut.Unlock()
-	if c.screenSession == nil {
+	if c.screenSession == nil || c.screenSession == s {
 		c.screenSession = s
 		return true
 	}
 	return false
 }
 
+// forwardingBatchSize is the maximum number of queued packets a track writer
+// forwards before giving its slot back to the other tracks in the call.
+const forwardingBatchSize = 32
+
+// acquireForwardingSlot blocks until the call allows another track writer to
+// forward packets. It must be paired with releaseForwardingSlot.
+func (c *call) acquireForwardingSlot() {
+	if c.forwardingSem != nil {
+		c.forwardingSem <- struct{}{}
+	}
+}
+
+func (c *call) releaseForwardingSlot() {
+	if c.forwardingSem != nil {
+		<-c.forwardingSem
+	}
+}
+
+// enableVoiceTrack enables the voice track of the given session unless that
+// would exceed maxUnmuted enabled voice tracks in the call, in which case false
+// is returned. A zero maxUnmuted means no limit. The track is left disabled if
+// the session is muted.
+func (c *call) enableVoiceTrack(s *session, maxUnmuted int) bool {
+	// Holding the write lock so that concurrent unmutes are serialized.
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	// Nothing to enable, so a muted session can't be rejected.
+	s.mut.RLock()
+	muted := s.voiceMuted
+	s.mut.RUnlock()
+	if muted {
+		return true
+	}
+
+	if maxUnmuted > 0 {
+		var unmuted int
+		for _, ss := range c.sessions {
+			if ss == s {
+				continue
+			}
+			ss.mut.RLock()
+			if ss.outVoiceTrackEnabled {
+				unmuted++
+			}
+			ss.mut.RUnlock()
+		}
+		if unmuted >= maxUnmuted {
+			return false
+		}
+	}
+
+	s.mut.Lock()
+	// A mute requested in the meantime (e.g. while the track was being
+	// added) is honored.
+	if !s.voiceMuted {
+		s.outVoiceTrackEnabled = true
+	}
+	s.mut.Unlock()
+
+	return true
+}
+
 func (c *call) iterSessions(cb func(s *session)) {
 	c.mut.RLock()
 	defer c.mut.RUnlock()
@@ -109,7 +256,7 @@ func (c *call) clearScreenState(screenSession *session) error {
 			select {
 			case s.tracksCh <- trackActionContext{action: trackActionRemove, track: s.screenTrackSender.Track()}:
 			default:
-				s.log.Error("failed to send screen track: channel is full", mlog.String("sessionID", s.cfg.SessionID))
+				c.drops.droppedMessage(s.cfg.GroupID, "tracks", "screen_track", mlog.String("sessionID", s.cfg.SessionID))
 			}
 			s.screenTrackSender = nil
 		}
@@ -119,12 +266,42 @@ func (c *call) clearScreenState(screenSession *session) error {
 	return nil
 }
 
+// clearVideoState stops forwarding the camera track sent by the given session
+// to all the other sessions in the call.
+func (c *call) clearVideoState(videoSession *session) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	videoSession.mut.Lock()
+	track := videoSession.outVideoTrack
+	videoSession.clearVideoState()
+	videoSession.mut.Unlock()
+
+	if track == nil {
+		return
+	}
+
+	for _, s := range c.sessions {
+		if s == videoSession || !canReceiveVideoTrack(s, track) {
+			continue
+		}
+
+		select {
+		case s.tracksCh <- trackActionContext{action: trackActionRemove, track: track}:
+		default:
+			c.drops.droppedMessage(s.cfg.GroupID, "tracks", "video_track", mlog.String("sessionID", s.cfg.SessionID))
+		}
+	}
+}
+
 // handleSessionClose cleans up resources such as senders or receivers for the
 // closing session.
 // NOTE: this is expected to always be called under lock (call.mut).
 func (c *call) handleSessionClose(us *session) {
 	us.log.Debug("handleSessionClose", mlog.String("sessionID", us.cfg.SessionID))
 
+	delete(c.plcHintLimiters, us.cfg.SessionID)
+
 	us.mut.Lock()
 	defer us.mut.Unlock()
 
@@ -180,6 +357,9 @@ func (c *call) handleSessionClose(us *session) {
 	if us.outScreenAudioTrack != nil {
 		outTracks[us.outScreenAudioTrack.ID()] = true
 	}
+	if us.outVideoTrack != nil {
+		outTracks[us.outVideoTrack.ID()] = true
+	}
 	for _, tracks := range us.outScreenTracks {
 		for _, track := range tracks {
 			outTracks[track.ID()] = true
@@ -208,13 +388,13 @@ func (c *call) handleSessionClose(us *session) {
 					mlog.String("sessionID", ss.cfg.SessionID),
 					mlog.String("trackID", track.ID()),
 				)
-				// If it's a screen sharing track we should remove it as we normally would when
-				// sharing ends.
+				// If it's a video (screen or camera) track we should remove it as we normally
+				// would when sharing ends.
 				if track.Kind() == webrtc.RTPCodecTypeVideo {
 					select {
 					case ss.tracksCh <- trackActionContext{action: trackActionRemove, track: track}:
 					default:
-						ss.log.Error("failed to send screen track: channel is full", mlog.String("sessionID", ss.cfg.SessionID))
+						c.drops.droppedMessage(ss.cfg.GroupID, "tracks", "video_track", mlog.String("sessionID", ss.cfg.SessionID))
 					}
 				} else {
 					cleanUp(ss.cfg.SessionID, sender, track)
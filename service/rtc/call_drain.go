@@ -0,0 +1,69 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+// ErrCallDraining is returned when trying to join a call that's being
+// drained.
+var ErrCallDraining = errors.New("call is draining")
+
+func (c *call) isDraining() bool {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.draining
+}
+
+// DrainCall stops accepting new sessions into the given call and closes the
+// existing ones with CloseReasonDrained once gracePeriod has elapsed. Unlike
+// Stop, this only affects a single call. Draining a call that's already
+// draining is a no-op.
+func (s *Server) DrainCall(groupID, callID string, gracePeriod time.Duration) error {
+	c := s.getCallByID(groupID, callID)
+	if c == nil {
+		return ErrCallNotFound
+	}
+
+	c.mut.Lock()
+	if c.draining {
+		c.mut.Unlock()
+		return nil
+	}
+	c.draining = true
+	sessionsCount := len(c.sessions)
+	c.mut.Unlock()
+
+	s.log.Info("draining call",
+		mlog.String("callID", callID),
+		mlog.Int("sessions", sessionsCount),
+		mlog.Any("gracePeriod", gracePeriod),
+	)
+	s.metrics.IncRTCCallDrains()
+
+	time.AfterFunc(gracePeriod, func() {
+		// CloseSession needs to lock the call so sessions are collected first.
+		var sessionIDs []string
+		c.iterSessions(func(us *session) {
+			sessionIDs = append(sessionIDs, us.cfg.SessionID)
+		})
+
+		s.log.Info("call drain grace period elapsed, closing sessions",
+			mlog.String("callID", callID),
+			mlog.Int("sessions", len(sessionIDs)),
+		)
+
+		for _, sessionID := range sessionIDs {
+			if err := s.CloseSession(sessionID, CloseReasonDrained); err != nil {
+				s.log.Error("failed to close session", mlog.Err(err), mlog.String("sessionID", sessionID))
+			}
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainCall(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	t.Run("not found", func(t *testing.T) {
+		err := s.DrainCall(random.NewID(), random.NewID(), time.Second)
+		require.ErrorIs(t, err, ErrCallNotFound)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		groupID := random.NewID()
+		callID := random.NewID()
+		otherCallID := random.NewID()
+
+		reasonCh := make(chan CloseReason, 3)
+		closeCb := func(reason CloseReason) error {
+			reasonCh <- reason
+			return nil
+		}
+
+		for i := 0; i < 2; i++ {
+			err := s.InitSession(SessionConfig{
+				GroupID:   groupID,
+				CallID:    callID,
+				UserID:    random.NewID(),
+				SessionID: random.NewID(),
+			}, closeCb)
+			require.NoError(t, err)
+		}
+
+		otherCfg := SessionConfig{
+			GroupID:   groupID,
+			CallID:    otherCallID,
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err := s.InitSession(otherCfg, closeCb)
+		require.NoError(t, err)
+		defer func() {
+			err := s.CloseSession(otherCfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		gracePeriod := time.Second
+
+		// Calls are scoped to their group.
+		err = s.DrainCall(random.NewID(), callID, gracePeriod)
+		require.ErrorIs(t, err, ErrCallNotFound)
+
+		drainStart := time.Now()
+		err = s.DrainCall(groupID, callID, gracePeriod)
+		require.NoError(t, err)
+
+		// Idempotent.
+		err = s.DrainCall(groupID, callID, gracePeriod)
+		require.NoError(t, err)
+
+		// New joins are rejected while draining.
+		err = s.InitSession(SessionConfig{
+			GroupID:   groupID,
+			CallID:    callID,
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}, closeCb)
+		require.ErrorIs(t, err, ErrCallDraining)
+
+		// Other calls are unaffected.
+		require.False(t, s.getGroup(groupID).getCall(otherCallID).isDraining())
+
+		for i := 0; i < 2; i++ {
+			select {
+			case reason := <-reasonCh:
+				require.Equal(t, CloseReasonDrained, reason)
+				require.GreaterOrEqual(t, time.Since(drainStart), gracePeriod)
+			case <-time.After(5 * time.Second):
+				require.FailNow(t, "timed out waiting for session to close")
+			}
+		}
+
+		require.Nil(t, s.getGroup(groupID).getCall(callID))
+		require.NotNil(t, s.getGroup(groupID).getCall(otherCallID))
+		require.Empty(t, reasonCh)
+	})
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+// ErrInvalidSimulcastLevel is returned when trying to set an unknown
+// simulcast level.
+var ErrInvalidSimulcastLevel = errors.New("invalid simulcast level")
+
+func (c *call) getFixedSimulcastLevel() string {
+	level, _ := c.fixedSimulcastLevel.Load().(string)
+	return level
+}
+
+// SetCallSimulcastLevel pins all the receivers in the given call to the
+// given simulcast level, regardless of their estimated bandwidth or
+// preferences. This is meant for calls where video quality is critical (e.g.
+// sign-language interpretation). An empty level restores the default
+// behavior. The level applies to screen tracks started after the call.
+func (s *Server) SetCallSimulcastLevel(groupID, callID, level string) error {
+	if level != "" && !isValidSimulcastLevel(level) {
+		return fmt.Errorf("%w: %q", ErrInvalidSimulcastLevel, level)
+	}
+
+	c := s.getCallByID(groupID, callID)
+	if c == nil {
+		return ErrCallNotFound
+	}
+
+	c.fixedSimulcastLevel.Store(level)
+
+	s.log.Info("call simulcast level set",
+		mlog.String("callID", callID),
+		mlog.String("level", level),
+	)
+
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/interceptor/pkg/gcc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetCallSimulcastLevel(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+
+	var sessions []*session
+	for i := 0; i < 3; i++ {
+		cfg := SessionConfig{
+			GroupID:   groupID,
+			CallID:    callID,
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		us := s.getGroup(groupID).getCall(callID).getSession(cfg.SessionID)
+		require.NotNil(t, us)
+
+		// Simulating a constrained network.
+		rate := getRateForSimulcastLevel(SimulcastLevelLow)
+		bwEstimator, err := gcc.NewSendSideBWE(
+			gcc.SendSideBWEInitialBitrate(rate),
+			gcc.SendSideBWEMinBitrate(rate),
+			gcc.SendSideBWEMaxBitrate(rate),
+		)
+		require.NoError(t, err)
+		us.mut.Lock()
+		us.bwEstimator = bwEstimator
+		us.mut.Unlock()
+
+		sessions = append(sessions, us)
+	}
+
+	// Preferences are overridden as well.
+	require.NoError(t, sessions[0].setPreferredSimulcastLevel(SimulcastLevelMid))
+
+	for _, us := range sessions {
+		require.Equal(t, SimulcastLevelLow, us.getExpectedSimulcastLevel(""))
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		err := s.SetCallSimulcastLevel(groupID, random.NewID(), SimulcastLevelHigh)
+		require.ErrorIs(t, err, ErrCallNotFound)
+
+		// Calls are scoped to their group.
+		err = s.SetCallSimulcastLevel(random.NewID(), callID, SimulcastLevelHigh)
+		require.ErrorIs(t, err, ErrCallNotFound)
+	})
+
+	t.Run("invalid level", func(t *testing.T) {
+		err := s.SetCallSimulcastLevel(groupID, callID, "x")
+		require.ErrorIs(t, err, ErrInvalidSimulcastLevel)
+	})
+
+	t.Run("pinned", func(t *testing.T) {
+		err := s.SetCallSimulcastLevel(groupID, callID, SimulcastLevelHigh)
+		require.NoError(t, err)
+
+		for _, us := range sessions {
+			require.Equal(t, SimulcastLevelHigh, us.getExpectedSimulcastLevel(""))
+		}
+	})
+
+	t.Run("unpinned", func(t *testing.T) {
+		err := s.SetCallSimulcastLevel(groupID, callID, "")
+		require.NoError(t, err)
+
+		for _, us := range sessions {
+			require.Equal(t, SimulcastLevelLow, us.getExpectedSimulcastLevel(""))
+		}
+	})
+
+	t.Run("while iterating sessions", func(t *testing.T) {
+		err := s.SetCallSimulcastLevel(groupID, callID, SimulcastLevelMid)
+		require.NoError(t, err)
+
+		// A writer waiting on the call lock must not prevent the level from
+		// being read while sessions are being iterated.
+		c := s.getGroup(groupID).getCall(callID)
+		writerDoneCh := make(chan struct{})
+		var once bool
+		c.iterSessions(func(us *session) {
+			if !once {
+				once = true
+				go func() {
+					c.mut.Lock()
+					c.mut.Unlock()
+					close(writerDoneCh)
+				}()
+				time.Sleep(50 * time.Millisecond)
+			}
+			require.Equal(t, SimulcastLevelMid, us.getExpectedSimulcastLevel(""))
+		})
+
+		select {
+		case <-writerDoneCh:
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "timed out waiting for writer")
+		}
+	})
+}
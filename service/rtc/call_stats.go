@@ -0,0 +1,68 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"sort"
+)
+
+// CallStats holds statistics about the sessions connected to a call.
+type CallStats struct {
+	CallID   string         `json:"callID"`
+	Sessions []SessionStats `json:"sessions"`
+}
+
+// SessionStats holds statistics about a session connected to a call.
+type SessionStats struct {
+	SessionID string `json:"sessionID"`
+	UserID    string `json:"userID"`
+	// SignalingRTTMs is the time, in milliseconds, the client took to answer
+	// the last renegotiation offer. Zero if none completed yet.
+	SignalingRTTMs float64 `json:"signalingRTTMs"`
+	// Packet counters, summed across all the RTP streams received from
+	// (inbound) and sent to (outbound) the session.
+	PacketsReceived uint64 `json:"packetsReceived"`
+	PacketsSent     uint64 `json:"packetsSent"`
+	// NACKsSent is the number of NACKs sent to the session for the streams it
+	// publishes.
+	NACKsSent uint64 `json:"nacksSent"`
+	// NACKsReceived is the number of NACKs received from the session for the
+	// streams forwarded to it.
+	NACKsReceived uint64 `json:"nacksReceived"`
+	// BandwidthEstimate is the current estimate, in bits per second, of the
+	// bandwidth available to send media to the session. Zero if not
+	// available yet.
+	BandwidthEstimate int `json:"bandwidthEstimate"`
+	// SimulcastLevel is the simulcast level the session is expected to
+	// receive for the screen share currently ongoing in the call. Empty if
+	// there's none.
+	SimulcastLevel string `json:"simulcastLevel,omitempty"`
+	// ScreenRates maps the screen tracks published by the session, keyed by
+	// mime type and RID, to their rate in bits per second. Tracks with no
+	// rate available yet are omitted.
+	ScreenRates map[string]int `json:"screenRates,omitempty"`
+}
+
+// GetCallStats returns statistics for the sessions connected to the given call.
+func (s *Server) GetCallStats(groupID, callID string) (CallStats, error) {
+	stats := CallStats{
+		CallID: callID,
+	}
+
+	c := s.getCallByID(groupID, callID)
+	if c == nil {
+		return stats, ErrCallNotFound
+	}
+
+	screenSession := c.getScreenSession()
+	c.iterSessions(func(us *session) {
+		stats.Sessions = append(stats.Sessions, us.getStats(screenSession))
+	})
+
+	sort.Slice(stats.Sessions, func(i, j int) bool {
+		return stats.Sessions[i].SessionID < stats.Sessions[j].SessionID
+	})
+
+	return stats, nil
+}
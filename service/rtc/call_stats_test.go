@@ -0,0 +1,97 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/perf"
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCallStats(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	t.Run("call not found", func(t *testing.T) {
+		_, err := s.GetCallStats(random.NewID(), random.NewID())
+		require.ErrorIs(t, err, ErrCallNotFound)
+	})
+
+	t.Run("signaling rtt", func(t *testing.T) {
+		groupID := random.NewID()
+		callID := random.NewID()
+		senderCfg := SessionConfig{
+			GroupID:   groupID,
+			CallID:    callID,
+			UserID:    random.NewID(),
+			SessionID: "sessionA",
+		}
+		receiverCfg := SessionConfig{
+			GroupID:   groupID,
+			CallID:    callID,
+			UserID:    random.NewID(),
+			SessionID: "sessionB",
+		}
+
+		initSession := setupTestPeers(t, s)
+
+		receiverPC := initSession(receiverCfg)
+		defer receiverPC.Close()
+		defer func() {
+			err := s.CloseSession(receiverCfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		// No renegotiation happened yet.
+		stats, err := s.GetCallStats(groupID, callID)
+		require.NoError(t, err)
+		require.Len(t, stats.Sessions, 1)
+		require.Zero(t, stats.Sessions[0].SignalingRTTMs)
+
+		// Adding a track triggers a renegotiation on the receiver.
+		voiceTrack, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, "voice", random.NewID())
+		require.NoError(t, err)
+		senderPC := initSession(senderCfg, voiceTrack)
+		defer senderPC.Close()
+		defer func() {
+			err := s.CloseSession(senderCfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		// The track is only forwarded once media starts flowing.
+		metrics := s.metrics.Metrics.(*perf.Metrics)
+		var seq uint16
+		require.Eventually(t, func() bool {
+			seq++
+			_ = voiceTrack.WriteRTP(&rtp.Packet{
+				Header: rtp.Header{
+					Version:        2,
+					SequenceNumber: seq,
+					Timestamp:      uint32(seq) * 960,
+				},
+				Payload: []byte{0xf8, 0xff, 0xfe},
+			})
+			return testutil.CollectAndCount(metrics.RTCSignalingRTT) > 0
+		}, 10*time.Second, 20*time.Millisecond)
+
+		stats, err = s.GetCallStats(groupID, callID)
+		require.NoError(t, err)
+		require.Equal(t, callID, stats.CallID)
+		require.Len(t, stats.Sessions, 2)
+		require.Equal(t, senderCfg.SessionID, stats.Sessions[0].SessionID)
+		require.Equal(t, receiverCfg.SessionID, stats.Sessions[1].SessionID)
+		require.Equal(t, receiverCfg.UserID, stats.Sessions[1].UserID)
+		require.NotZero(t, stats.Sessions[1].SignalingRTTMs)
+	})
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+func TestCallForwardingSlots(t *testing.T) {
+	t.Run("no limit", func(t *testing.T) {
+		c := &call{}
+		for i := 0; i < 10; i++ {
+			c.acquireForwardingSlot()
+		}
+		for i := 0; i < 10; i++ {
+			c.releaseForwardingSlot()
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		c := &call{forwardingSem: make(chan struct{}, 2)}
+
+		var active, maxActive int32
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.acquireForwardingSlot()
+				defer c.releaseForwardingSlot()
+				n := atomic.AddInt32(&active, 1)
+				for {
+					m := atomic.LoadInt32(&maxActive)
+					if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&active, -1)
+			}()
+		}
+		wg.Wait()
+
+		require.Equal(t, int32(2), maxActive)
+		require.Empty(t, c.forwardingSem)
+	})
+}
+
+func TestWriteVideoTrackForwardingSlots(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, log.Shutdown())
+	}()
+
+	s := &Server{log: log}
+	us := &session{cfg: SessionConfig{SessionID: "sessionID"}}
+	c := &call{forwardingSem: make(chan struct{}, 1)}
+
+	outTrack, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "trackID", "streamID")
+	require.NoError(t, err)
+
+	writerCh := make(chan videoPacket, forwardingBatchSize*2)
+	for i := 0; i < cap(writerCh); i++ {
+		writerCh <- videoPacket{Packet: &rtp.Packet{Header: rtp.Header{SequenceNumber: uint16(i)}}}
+	}
+	close(writerCh)
+
+	// Holding the only slot so that the writer can't forward.
+	c.acquireForwardingSlot()
+
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		s.writeVideoTrack(c, us, trackTypeScreen, writerCh, outTrack, nil)
+	}()
+
+	select {
+	case <-doneCh:
+		require.FailNow(t, "writer should be waiting for a slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// Only the packet starting the burst got dequeued.
+	require.Len(t, writerCh, cap(writerCh)-1)
+
+	c.releaseForwardingSlot()
+
+	select {
+	case <-doneCh:
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for writer")
+	}
+	require.Empty(t, writerCh)
+	require.Empty(t, c.forwardingSem)
+}
+
+func TestCallEnableVoiceTrack(t *testing.T) {
+	newSession := func(enabled, muted bool) *session {
+		return &session{outVoiceTrackEnabled: enabled, voiceMuted: muted}
+	}
+
+	t.Run("limit", func(t *testing.T) {
+		s := newSession(false, false)
+		c := &call{sessions: map[string]*session{
+			"sessionA": newSession(true, false),
+			"sessionB": newSession(true, false),
+			"sessionC": s,
+		}}
+
+		require.False(t, c.enableVoiceTrack(s, 2))
+		require.False(t, s.outVoiceTrackEnabled)
+
+		require.True(t, c.enableVoiceTrack(s, 3))
+		require.True(t, s.outVoiceTrackEnabled)
+	})
+
+	t.Run("muted at limit", func(t *testing.T) {
+		s := newSession(false, true)
+		c := &call{sessions: map[string]*session{
+			"sessionA": newSession(true, false),
+			"sessionB": newSession(true, false),
+			"sessionC": s,
+		}}
+
+		require.True(t, c.enableVoiceTrack(s, 2))
+		require.False(t, s.outVoiceTrackEnabled)
+	})
+}
+
+// BenchmarkCallForwardingFairness simulates a heavy call saturating the CPU
+// with forwarding work alongside a few light calls and reports the p99
+// latency of the light calls' writes.
+func BenchmarkCallForwardingFairness(b *testing.B) {
+	// spin simulates the CPU cost of writing a packet to many receivers.
+	spin := func(d time.Duration) {
+		start := time.Now()
+		for time.Since(start) < d {
+		}
+	}
+
+	nHeavyWriters := runtime.NumCPU() * 8
+	nLightCalls := 4
+
+	for _, budget := range []int{0, max(runtime.NumCPU()/2, 1)} {
+		b.Run(fmt.Sprintf("budget=%d", budget), func(b *testing.B) {
+			newCall := func() *call {
+				c := &call{}
+				if budget > 0 {
+					c.forwardingSem = make(chan struct{}, budget)
+				}
+				return c
+			}
+
+			heavyCall := newCall()
+			stopCh := make(chan struct{})
+			var heavyWg sync.WaitGroup
+			for i := 0; i < nHeavyWriters; i++ {
+				heavyWg.Add(1)
+				go func() {
+					defer heavyWg.Done()
+					for {
+						select {
+						case <-stopCh:
+							return
+						default:
+						}
+						heavyCall.acquireForwardingSlot()
+						spin(200 * time.Microsecond)
+						heavyCall.releaseForwardingSlot()
+						runtime.Gosched()
+					}
+				}()
+			}
+
+			var mut sync.Mutex
+			var latencies []time.Duration
+
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			for i := 0; i < nLightCalls; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					lightCall := newCall()
+					for j := 0; j < b.N; j++ {
+						start := time.Now()
+						lightCall.acquireForwardingSlot()
+						spin(20 * time.Microsecond)
+						lightCall.releaseForwardingSlot()
+						mut.Lock()
+						latencies = append(latencies, time.Since(start))
+						mut.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			b.StopTimer()
+
+			close(stopCh)
+			heavyWg.Wait()
+
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			b.ReportMetric(float64(latencies[len(latencies)*99/100].Microseconds()), "p99-µs")
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mattermost/rtcd/service/rtc/dc"
+)
+
+// clientStatsInterval is the minimum interval between StatsMessage messages
+// emitted for a session.
+var clientStatsInterval = 10 * time.Second
+
+// ClientStats holds the latest network statistics reported by a session's
+// client through the data channel. It's the payload of StatsMessage.
+type ClientStats struct {
+	// LossRate is the fraction of packets lost, in the [0, 1] range.
+	LossRate float64 `json:"lossRate"`
+	// RTT is the round trip time, in seconds.
+	RTT float64 `json:"rtt"`
+	// Jitter is the inter-arrival jitter, in seconds.
+	Jitter float64 `json:"jitter"`
+}
+
+// updateClientStats records a client reported statistic, returning the
+// current stats if they are due to be reported.
+func (s *session) updateClientStats(mt dc.MessageType, value float64) (ClientStats, bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	switch mt {
+	case dc.MessageTypeLossRate:
+		s.clientStats.LossRate = value
+	case dc.MessageTypeRoundTripTime:
+		s.clientStats.RTT = value
+	case dc.MessageTypeJitter:
+		s.clientStats.Jitter = value
+	default:
+		return ClientStats{}, false
+	}
+
+	now := time.Now()
+	if now.Sub(s.clientStatsReportedAt) < clientStatsInterval {
+		return ClientStats{}, false
+	}
+	s.clientStatsReportedAt = now
+
+	return s.clientStats, true
+}
+
+// sendClientStats relays the client reported stats for the session through
+// the receive channel.
+func (s *Server) sendClientStats(us *session, stats ClientStats) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	select {
+	case s.receiveCh <- newMessage(us, StatsMessage, data):
+	default:
+		return fmt.Errorf("channel is full")
+	}
+
+	return nil
+}
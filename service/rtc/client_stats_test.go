@@ -0,0 +1,82 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc/dc"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateClientStats(t *testing.T) {
+	var us session
+
+	// The first report is relayed right away.
+	stats, ok := us.updateClientStats(dc.MessageTypeLossRate, 0.05)
+	require.True(t, ok)
+	require.Equal(t, ClientStats{LossRate: 0.05}, stats)
+
+	// Further ones are accumulated until the interval elapses.
+	_, ok = us.updateClientStats(dc.MessageTypeRoundTripTime, 0.1)
+	require.False(t, ok)
+	_, ok = us.updateClientStats(dc.MessageTypeJitter, 0.02)
+	require.False(t, ok)
+
+	// Unrelated message types are ignored.
+	_, ok = us.updateClientStats(dc.MessageTypePing, 1)
+	require.False(t, ok)
+
+	us.clientStatsReportedAt = time.Now().Add(-clientStatsInterval)
+	stats, ok = us.updateClientStats(dc.MessageTypeLossRate, 0.01)
+	require.True(t, ok)
+	require.Equal(t, ClientStats{LossRate: 0.01, RTT: 0.1, Jitter: 0.02}, stats)
+}
+
+func TestClientStatsMessage(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	cfg := SessionConfig{
+		GroupID:   random.NewID(),
+		CallID:    random.NewID(),
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+	err = s.InitSession(cfg, nil)
+	require.NoError(t, err)
+	defer func() {
+		err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+	require.NotNil(t, us)
+
+	data, err := dc.EncodeMessage(dc.MessageTypeRoundTripTime, 0.25)
+	require.NoError(t, err)
+	err = s.handleDCMessage(data, us, nil)
+	require.NoError(t, err)
+
+	select {
+	case msg := <-s.ReceiveCh():
+		require.Equal(t, StatsMessage, msg.Type)
+		require.Equal(t, cfg.SessionID, msg.SessionID)
+		require.Equal(t, cfg.GroupID, msg.GroupID)
+
+		var stats ClientStats
+		err := json.Unmarshal(msg.Data, &stats)
+		require.NoError(t, err)
+		require.Equal(t, ClientStats{RTT: 0.25}, stats)
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for stats message")
+	}
+}
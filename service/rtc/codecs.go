@@ -0,0 +1,91 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+// getSupportedVideoCodecs returns the parameters of all the video codecs
+// the server is able to forward, keyed by mime type. Experimental codecs are
+// only included if enabled.
+func getSupportedVideoCodecs(cfg ExperimentalConfig) map[string]webrtc.RTPCodecParameters {
+	codecs := make(map[string]webrtc.RTPCodecParameters, len(rtpVideoCodecs))
+	for mimeType, params := range rtpVideoCodecs {
+		codecs[mimeType] = params
+	}
+	if cfg.EnableVP9 {
+		codecs[webrtc.MimeTypeVP9] = rtpExperimentalVideoCodecs[webrtc.MimeTypeVP9]
+	}
+	if cfg.EnableH264 {
+		codecs[webrtc.MimeTypeH264] = rtpExperimentalVideoCodecs[webrtc.MimeTypeH264]
+	}
+	return codecs
+}
+
+// getSupportedVideoExtensions returns the video header extensions to
+// negotiate. Experimental ones are only included if enabled.
+func getSupportedVideoExtensions(cfg ExperimentalConfig) []string {
+	extensions := slices.Clone(rtpVideoExtensions)
+	if cfg.EnableAV1SVC {
+		extensions = append(extensions, av1DependencyDescriptorURI)
+	}
+	if cfg.EnableFrameMarking {
+		extensions = append(extensions, frameMarkingURI)
+	}
+	return extensions
+}
+
+func getVideoCodecsMimeTypes(codecs map[string]webrtc.RTPCodecParameters) []string {
+	mimeTypes := make([]string, 0, len(codecs))
+	for mimeType := range codecs {
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+	sort.Strings(mimeTypes)
+	return mimeTypes
+}
+
+// GetEnabledVideoCodecs returns the mime types of the video codecs that are
+// registered for newly created sessions.
+func (s *Server) GetEnabledVideoCodecs() []string {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return slices.Clone(s.videoCodecs)
+}
+
+// SetEnabledVideoCodecs updates the video codecs that are registered for
+// sessions created from now on. Existing sessions are unaffected.
+// The default screen sharing codec (VP8) cannot be disabled as it's used as
+// a fallback for clients not supporting anything else.
+func (s *Server) SetEnabledVideoCodecs(codecs []string) error {
+	enabled := make([]string, 0, len(codecs))
+	for _, mimeType := range codecs {
+		if _, ok := s.videoCodecParams[mimeType]; !ok {
+			return fmt.Errorf("unknown video codec %q", mimeType)
+		}
+		if !slices.Contains(enabled, mimeType) {
+			enabled = append(enabled, mimeType)
+		}
+	}
+
+	if !slices.Contains(enabled, ScreenTrackMimeTypeDefault) {
+		return fmt.Errorf("video codec %q cannot be disabled", ScreenTrackMimeTypeDefault)
+	}
+
+	sort.Strings(enabled)
+
+	s.mut.Lock()
+	s.videoCodecs = enabled
+	s.mut.Unlock()
+
+	s.log.Info("rtc: enabled video codecs updated", mlog.Any("codecs", enabled))
+
+	return nil
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/rtcd/service/perf"
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetEnabledVideoCodecs(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	require.Equal(t, []string{webrtc.MimeTypeAV1, webrtc.MimeTypeVP8}, s.GetEnabledVideoCodecs())
+
+	t.Run("unknown codec", func(t *testing.T) {
+		err := s.SetEnabledVideoCodecs([]string{webrtc.MimeTypeVP8, webrtc.MimeTypeH264})
+		require.EqualError(t, err, `unknown video codec "video/H264"`)
+		require.Equal(t, []string{webrtc.MimeTypeAV1, webrtc.MimeTypeVP8}, s.GetEnabledVideoCodecs())
+	})
+
+	t.Run("missing default codec", func(t *testing.T) {
+		err := s.SetEnabledVideoCodecs([]string{webrtc.MimeTypeAV1})
+		require.EqualError(t, err, `video codec "video/VP8" cannot be disabled`)
+		require.Equal(t, []string{webrtc.MimeTypeAV1, webrtc.MimeTypeVP8}, s.GetEnabledVideoCodecs())
+	})
+
+	initSession := func(t *testing.T) *session {
+		t.Helper()
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+			Props:     SessionProps{"av1Support": true},
+		}
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		})
+		return s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+	}
+
+	t.Run("toggle AV1", func(t *testing.T) {
+		sessionA := initSession(t)
+		require.True(t, sessionA.supportsAV1())
+
+		err := s.SetEnabledVideoCodecs([]string{webrtc.MimeTypeVP8})
+		require.NoError(t, err)
+		require.Equal(t, []string{webrtc.MimeTypeVP8}, s.GetEnabledVideoCodecs())
+
+		sessionB := initSession(t)
+		require.False(t, sessionB.supportsAV1())
+		// Existing sessions should be unaffected.
+		require.True(t, sessionA.supportsAV1())
+
+		err = s.SetEnabledVideoCodecs([]string{webrtc.MimeTypeVP8, webrtc.MimeTypeAV1, webrtc.MimeTypeVP8})
+		require.NoError(t, err)
+		require.Equal(t, []string{webrtc.MimeTypeAV1, webrtc.MimeTypeVP8}, s.GetEnabledVideoCodecs())
+
+		sessionC := initSession(t)
+		require.True(t, sessionC.supportsAV1())
+		require.False(t, sessionB.supportsAV1())
+	})
+}
+
+func TestExperimentalVideoCodecs(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	newServer := func(t *testing.T, experimental ExperimentalConfig) *Server {
+		t.Helper()
+		cfg := ServerConfig{
+			ICEPortUDP:      30433,
+			ICEPortTCP:      30433,
+			UDPSocketsCount: 1,
+			Experimental:    experimental,
+		}
+		s, err := NewServer(cfg, log, perf.NewMetrics("rtcd", nil))
+		require.NoError(t, err)
+		return s
+	}
+
+	// getOfferSDP returns an offer generated from a media engine configured
+	// as it would be for a new session.
+	getOfferSDP := func(t *testing.T, s *Server) string {
+		t.Helper()
+		var videoCodecs []webrtc.RTPCodecParameters
+		for _, mimeType := range s.GetEnabledVideoCodecs() {
+			videoCodecs = append(videoCodecs, s.videoCodecParams[mimeType])
+		}
+		m, err := initMediaEngine(rtpAudioCodec, videoCodecs, s.videoExtensions)
+		require.NoError(t, err)
+
+		pc, err := webrtc.NewAPI(webrtc.WithMediaEngine(m)).NewPeerConnection(webrtc.Configuration{})
+		require.NoError(t, err)
+		defer pc.Close()
+
+		_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo)
+		require.NoError(t, err)
+
+		offer, err := pc.CreateOffer(nil)
+		require.NoError(t, err)
+
+		return offer.SDP
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		s := newServer(t, ExperimentalConfig{})
+		require.Equal(t, []string{webrtc.MimeTypeAV1, webrtc.MimeTypeVP8}, s.GetEnabledVideoCodecs())
+
+		err := s.SetEnabledVideoCodecs([]string{webrtc.MimeTypeVP8, webrtc.MimeTypeVP9})
+		require.EqualError(t, err, `unknown video codec "video/VP9"`)
+
+		sdp := getOfferSDP(t, s)
+		require.Contains(t, sdp, "VP8/90000")
+		require.Contains(t, sdp, "AV1/90000")
+		require.NotContains(t, sdp, "VP9/90000")
+		require.NotContains(t, sdp, "H264/90000")
+		require.NotContains(t, sdp, av1DependencyDescriptorURI)
+		require.NotContains(t, sdp, frameMarkingURI)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		s := newServer(t, ExperimentalConfig{
+			EnableVP9:          true,
+			EnableH264:         true,
+			EnableAV1SVC:       true,
+			EnableFrameMarking: true,
+		})
+		require.Equal(t, []string{webrtc.MimeTypeAV1, webrtc.MimeTypeH264, webrtc.MimeTypeVP8, webrtc.MimeTypeVP9}, s.GetEnabledVideoCodecs())
+
+		sdp := getOfferSDP(t, s)
+		require.Contains(t, sdp, "VP8/90000")
+		require.Contains(t, sdp, "AV1/90000")
+		require.Contains(t, sdp, "VP9/90000")
+		require.Contains(t, sdp, "H264/90000")
+		require.Contains(t, sdp, av1DependencyDescriptorURI)
+		require.Contains(t, sdp, frameMarkingURI)
+
+		// Experimental codecs can still be disabled at runtime.
+		err := s.SetEnabledVideoCodecs([]string{webrtc.MimeTypeVP8, webrtc.MimeTypeH264})
+		require.NoError(t, err)
+		sdp = getOfferSDP(t, s)
+		require.True(t, strings.Contains(sdp, "H264/90000"))
+		require.False(t, strings.Contains(sdp, "VP9/90000"))
+	})
+}
+
+func TestOpusDTX(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	// getSessionOfferSDP returns an audio offer generated by the peer
+	// connection of a new session with the given props.
+	getSessionOfferSDP := func(t *testing.T, props SessionProps) string {
+		t.Helper()
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+			Props:     props,
+		}
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+		us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+
+		_, err = us.rtcConn.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio)
+		require.NoError(t, err)
+
+		offer, err := us.rtcConn.CreateOffer(nil)
+		require.NoError(t, err)
+
+		return offer.SDP
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		sdp := getSessionOfferSDP(t, SessionProps{"opusDTXSupport": true})
+		require.Contains(t, sdp, "minptime=10;useinbandfec=1")
+		require.NotContains(t, sdp, "usedtx=1")
+	})
+
+	s.cfg.EnableOpusDTX = true
+	defer func() { s.cfg.EnableOpusDTX = false }()
+
+	t.Run("unsupported by client", func(t *testing.T) {
+		sdp := getSessionOfferSDP(t, SessionProps{})
+		require.Contains(t, sdp, "minptime=10;useinbandfec=1")
+		require.NotContains(t, sdp, "usedtx=1")
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		sdp := getSessionOfferSDP(t, SessionProps{"opusDTXSupport": true})
+		require.Contains(t, sdp, "minptime=10;useinbandfec=1;usedtx=1")
+	})
+}
+
+func TestGetDTXSilenceFrames(t *testing.T) {
+	tcs := []struct {
+		name   string
+		prevTS uint32
+		ts     uint32
+		frames int
+	}{
+		{name: "consecutive", prevTS: 1000, ts: 1000 + opusFrameSamples, frames: 0},
+		{name: "longest packet", prevTS: 1000, ts: 1000 + opusMaxPacketSamples, frames: 0},
+		{name: "dtx gap", prevTS: 1000, ts: 1000 + 20*opusFrameSamples, frames: 19},
+		{name: "wrap around", prevTS: math.MaxUint32 - opusFrameSamples + 1, ts: 19 * opusFrameSamples, frames: 19},
+		{name: "out of order", prevTS: 1000 + 20*opusFrameSamples, ts: 1000, frames: 0},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.frames, getDTXSilenceFrames(tc.prevTS, tc.ts))
+		})
+	}
+}
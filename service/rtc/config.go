@@ -5,10 +5,14 @@ package rtc
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/blang/semver/v4"
 )
 
 type ServerConfig struct {
@@ -29,8 +33,14 @@ type ServerConfig struct {
 	// A list of ICE server (STUN/TURN) configurations to use.
 	ICEServers ICEServers `toml:"ice_servers"`
 	TURNConfig TURNConfig `toml:"turn"`
+	// TURNAdvertisePolicy controls when TURN servers should be included in the
+	// ICE configuration given to sessions. Defaults to TURNAdvertisePolicyAlways.
+	TURNAdvertisePolicy TURNAdvertisePolicy `toml:"turn_advertise_policy"`
 	// EnableIPv6 specifies whether or not IPv6 should be used.
 	EnableIPv6 bool `toml:"enable_ipv6"`
+	// IPv6Only specifies whether IPv6 should be used exclusively, ignoring any
+	// IPv4 address. Requires EnableIPv6 to be set.
+	IPv6Only bool `toml:"ipv6_only"`
 	// UDPSocketsCount controls the number of listening UDP sockets used for each local
 	// network address. A larger number can improve performance by reducing contention
 	// over a few file descriptors. At the same time, it will cause more file descriptors
@@ -38,8 +48,365 @@ type ServerConfig struct {
 	// a constant multiplier of 100. E.g. On a 4 CPUs node, 400 sockets per local
 	// network address will be open.
 	UDPSocketsCount int `toml:"udp_sockets_count"`
+	// ICETCPAcceptConcurrency controls the number of goroutines concurrently
+	// accepting connections on the ICE-TCP listener. A zero value means the
+	// default, which is the number of available CPUs.
+	ICETCPAcceptConcurrency int `toml:"ice_tcp_accept_concurrency"`
+	// RequireChannelID controls whether sessions with no channelID set in
+	// their props should be rejected.
+	RequireChannelID bool `toml:"require_channel_id"`
+	// AllowE2EE controls whether sessions can set the e2ee property to have
+	// their media forwarded opaquely. Since encrypted media can't be mixed
+	// nor recorded, this is a server policy rather than a client choice.
+	AllowE2EE bool `toml:"allow_e2ee"`
+	// EnableRTCPReducedSize controls whether reduced-size RTCP (RFC 5506)
+	// should be advertised to clients. Compound RTCP is used for clients
+	// that don't support it.
+	EnableRTCPReducedSize bool `toml:"enable_rtcp_reduced_size"`
+	// EnableOpusDTX controls whether Opus discontinuous transmission (DTX)
+	// should be negotiated, letting clients stop sending audio packets
+	// during silence. Only applies to sessions advertising support for it.
+	EnableOpusDTX bool `toml:"enable_opus_dtx"`
+	// EnablePacing controls whether the packets forwarded to each session
+	// should be paced according to the session's estimated downstream rate,
+	// smoothing out bursts that could otherwise cause jitter on receivers.
+	EnablePacing bool `toml:"enable_pacing"`
+	// MaxForwardedAudioStreams limits the number of voice streams forwarded
+	// to each session in a call to the N loudest speakers. Relies on the
+	// audio level extension being negotiated. A zero value means no limit.
+	MaxForwardedAudioStreams int `toml:"max_forwarded_audio_streams"`
+	// AudioLevelSilenceThreshold is the audio level (in -dBov, as defined in
+	// RFC 6464) above which a voice stream is considered silent and thus not
+	// counted among the loudest when MaxForwardedAudioStreams is set. Useful
+	// to account for varying microphone gains. A zero value disables the check.
+	AudioLevelSilenceThreshold int `toml:"audio_level_silence_threshold"`
+	// MaxUnmutedSpeakers limits the number of sessions in a call that can
+	// have their voice track enabled at the same time. Unmute attempts past
+	// the limit are rejected. A zero value means no limit.
+	MaxUnmutedSpeakers int `toml:"max_unmuted_speakers"`
+	// MaxConcurrentSessionInits limits the number of sessions that can be
+	// initialized concurrently. Excess initializations are queued for a short
+	// time before failing with ErrSessionInitTimeout. A zero value means no limit.
+	MaxConcurrentSessionInits int `toml:"max_concurrent_session_inits"`
+	// WarmPoolSize is the number of session media stacks (media engine,
+	// interceptors, settings and DTLS certificate) kept pre-built in the
+	// background to lower the latency of session initializations. Each is
+	// used by a single session. A zero value disables the pool.
+	WarmPoolSize int `toml:"warm_pool_size"`
+	// PeerConnectionRetries is the number of times creating a session's peer
+	// connection is retried, using a newly built media stack, after failing
+	// with a transient error (e.g. resource exhaustion under load).
+	// Configuration errors are never retried. A zero value disables retries.
+	PeerConnectionRetries int `toml:"peer_connection_retries"`
+	// MaxForwardingWorkersPerCall limits the number of video tracks that can
+	// concurrently forward packets for a single call. This prevents a heavy
+	// call from starving other calls sharing the same node. A zero value means
+	// no limit.
+	MaxForwardingWorkersPerCall int `toml:"max_forwarding_workers_per_call"`
+	// EnableAudioPLCHint controls whether the server should ask senders to
+	// increase their audio error resilience (e.g. Opus FEC) when receivers
+	// report high packet loss on their voice tracks.
+	EnableAudioPLCHint bool `toml:"enable_audio_plc_hint"`
+	// ICEKeepaliveIntervalMs controls how often, in milliseconds, ICE
+	// keepalive traffic is sent when no media is flowing. A lower value helps
+	// keeping NAT bindings alive on aggressive routers at the cost of some
+	// extra traffic. A zero value means the default (2 seconds) is used.
+	ICEKeepaliveIntervalMs int `toml:"ice_keepalive_interval_ms"`
+	// ICERestartTimeoutMs controls how long, in milliseconds, a session whose
+	// connection failed while restarting ICE after getting disconnected (e.g.
+	// a client switching networks) is given to recover before getting
+	// closed. A zero value means the default (5 seconds) is used.
+	ICERestartTimeoutMs int `toml:"ice_restart_timeout_ms"`
+	// PLIMaxIntervalMs is the minimum time, in milliseconds, between PLI
+	// (keyframe) requests forwarded to a video sender for the same track.
+	// Lower values let late joiners get a keyframe sooner at the cost of more
+	// keyframes being generated. A zero value means the default (1 second)
+	// is used.
+	PLIMaxIntervalMs int `toml:"pli_max_interval_ms"`
+	// DroppedMessagesLogIntervalMs is the minimum time, in milliseconds,
+	// between logs of internal messages dropped because of full channels, for
+	// the same channel and reason. Drops are always counted through metrics.
+	// A zero value means the default (5 seconds) is used.
+	DroppedMessagesLogIntervalMs int `toml:"dropped_messages_log_interval_ms"`
+	// AudioAnswerBandwidthKbps, ScreenAnswerBandwidthKbps and
+	// VideoAnswerBandwidthKbps control the bandwidth, in kilobits per second,
+	// advertised (b=AS and b=TIAS lines) in the audio, screen sharing and
+	// camera sections of the SDP answers sent to clients. Some clients honor
+	// these to cap their send rate. A zero value means no bandwidth line is
+	// added.
+	AudioAnswerBandwidthKbps  int `toml:"audio_answer_bandwidth_kbps"`
+	ScreenAnswerBandwidthKbps int `toml:"screen_answer_bandwidth_kbps"`
+	VideoAnswerBandwidthKbps  int `toml:"video_answer_bandwidth_kbps"`
+	// UnexpectedVideoTrackHoldMs controls how long, in milliseconds, a video
+	// track not matching the expected screen or camera stream is held before
+	// getting dropped. This covers the case of a track being received before
+	// its related screen or video on message. A zero value means such tracks
+	// are dropped immediately.
+	UnexpectedVideoTrackHoldMs int `toml:"unexpected_video_track_hold_ms"`
+	// DCOpenTimeoutMs controls how long, in milliseconds since joining, a
+	// session using data channel signaling has to open its data channel
+	// before the server falls back to WebSocket signaling for it. A zero value
+	// means negotiations are attempted through the data channel regardless,
+	// failing over only once they time out.
+	DCOpenTimeoutMs int `toml:"dc_open_timeout_ms"`
+	// SignalingTimeoutMs controls how long, in milliseconds, to wait for a
+	// client to complete a negotiation (e.g. answer an offer) before failing
+	// it. Higher values accommodate high-latency links. A zero value means
+	// the default (10s) is used.
+	SignalingTimeoutMs int `toml:"signaling_timeout_ms"`
+	// MaxOutstandingOffers is the maximum number of offers a session can
+	// leave unanswered (e.g. a slow client) before further track changes are
+	// held, and coalesced where possible, until answers catch up. A zero
+	// value means no limit.
+	MaxOutstandingOffers int `toml:"max_outstanding_offers"`
+	// MaxSessionDurationMs bounds, in milliseconds, the lifetime of a session
+	// and its signaling goroutines. Sessions exceeding it are closed with
+	// CloseReasonMaxDuration. A zero value means no limit.
+	MaxSessionDurationMs int `toml:"max_session_duration_ms"`
+	// VADVoiceOffHoldMs controls how long, in milliseconds, voice activity
+	// needs to stop before a voice off event is emitted. Voice resuming
+	// within the hold time cancels the event so that brief pauses in speech
+	// don't cause speaking indicators to flap. A zero value means events are
+	// emitted immediately.
+	VADVoiceOffHoldMs int `toml:"vad_voice_off_hold_ms"`
+	// ActiveSpeakerDebounceMs controls how long, in milliseconds, a session
+	// needs to be the loudest speaker in a call before being reported as the
+	// active one. This avoids flapping between speakers at similar levels. A
+	// zero value means the default (300ms) is used.
+	ActiveSpeakerDebounceMs int `toml:"active_speaker_debounce_ms"`
+	// MaxDCMessagesPerSecond limits the rate of inbound data channel messages
+	// for each session. Excess messages are dropped, with the exception of
+	// signaling, keepalive and control ones. A zero value means no limit.
+	MaxDCMessagesPerSecond int `toml:"max_dc_messages_per_second"`
+	// MaxGroupMessagesPerSecond limits the rate of inbound signaling messages
+	// (SDP, ICE) for each group so that a single group cannot starve the
+	// others. Excess messages are queued and only dropped once the group's
+	// queue is full. Other messages are never limited. A zero value means no
+	// limit.
+	MaxGroupMessagesPerSecond int `toml:"max_group_messages_per_second"`
+	// GroupMessagesPerSecond overrides MaxGroupMessagesPerSecond for specific
+	// groups, keyed by group ID. A zero value means no limit for the group.
+	GroupMessagesPerSecond map[string]int `toml:"group_messages_per_second"`
+	// ICEUfragLength is the length of the ICE username fragment generated
+	// for each session. A zero value means the default (16) is used.
+	// Setting either ICEUfragLength or ICEPwdLength fixes the session's
+	// credentials so ICE restarts are left to clients.
+	ICEUfragLength int `toml:"ice_ufrag_length"`
+	// ICEPwdLength is the length of the ICE password generated for each
+	// session. A zero value means the default (32) is used.
+	ICEPwdLength int `toml:"ice_pwd_length"`
+	// TrackIDLength is the length of the random part of the IDs generated
+	// for forwarded tracks. Longer IDs are easier to tell apart while
+	// debugging, shorter ones reduce SDP size. A zero value means the default
+	// (8) is used.
+	TrackIDLength int `toml:"track_id_length"`
+	// MetricsSampleRate is the fraction of sessions, in the (0, 1] range,
+	// emitting fine-grained metrics (e.g. track write durations, client
+	// reported stats). Coarse counters are always emitted. A zero value means
+	// all sessions are sampled.
+	MetricsSampleRate float64 `toml:"metrics_sample_rate"`
+	// ScreenDemotionCPUThreshold is the CPU usage, in the (0, 1] range, above
+	// which screen share tracks forwarded to about half of the receivers are
+	// demoted to ScreenDemotionTargetFPS. Only frames no others depend on are
+	// dropped. Receivers of tracks carrying no layer information are switched
+	// to the lowest simulcast level instead. A zero value disables demotion.
+	ScreenDemotionCPUThreshold float64 `toml:"screen_demotion_cpu_threshold"`
+	// ScreenDemotionTargetFPS is the frame rate demoted screen share tracks
+	// are limited to. A zero value means the default (5) is used.
+	ScreenDemotionTargetFPS int `toml:"screen_demotion_target_fps"`
+	// MaxCPUUtilization is the CPU usage, in the (0, 1] range, above which new
+	// sessions are rejected with ErrServerOverloaded so that existing calls
+	// don't get degraded during load spikes. A zero value disables the check.
+	MaxCPUUtilization float64 `toml:"max_cpu_utilization"`
+	// SimulcastBackoffInitialMs is the minimum time, in milliseconds, between
+	// the first simulcast level changes of a receiving session. The backoff
+	// grows by SimulcastBackoffFactor after each change, up to
+	// SimulcastBackoffMaxMs. Higher values favor stability, avoiding frequent
+	// switches on fluctuating networks, while lower values make sessions adapt
+	// faster to bandwidth changes. Level downgrades due to a drop in the
+	// estimated rate are never delayed. A zero value means the default
+	// (10 seconds) is used.
+	SimulcastBackoffInitialMs int `toml:"simulcast_backoff_initial_ms"`
+	// SimulcastBackoffMaxMs caps the simulcast level change backoff, in
+	// milliseconds. A zero value means no cap.
+	SimulcastBackoffMaxMs int `toml:"simulcast_backoff_max_ms"`
+	// SimulcastBackoffFactor is the multiplier applied to the simulcast level
+	// change backoff after each change. A value of 1 keeps the backoff
+	// constant. A zero value means the default (1.5) is used.
+	SimulcastBackoffFactor float64 `toml:"simulcast_backoff_factor"`
+	// MaxTracksPerSession caps the number of tracks, both forwarded to and
+	// published by a session, to bound the resources a single session can
+	// consume. Tracks exceeding the cap are rejected. A zero value means no
+	// limit.
+	MaxTracksPerSession int `toml:"max_tracks_per_session"`
+	// MaxReceiversPerPublisher caps the number of sessions a single published
+	// track (e.g. a screen share) is forwarded to. Receivers exceeding the cap
+	// don't get the track and are notified through a TrackRejectMessage. A
+	// zero value means no limit.
+	MaxReceiversPerPublisher int `toml:"max_receivers_per_publisher"`
+	// MaxCallParticipants caps the number of sessions a single call can have.
+	// Sessions joining a full call are rejected with ErrCallFull. A zero value
+	// means no limit.
+	MaxCallParticipants int `toml:"max_call_participants"`
+	// MinClientVersion is the minimum client version, as reported through the
+	// version session property, allowed to initialize a session. Versions are
+	// compared following semantic versioning. Sessions reporting no version are
+	// rejected as well. An empty value disables the check.
+	MinClientVersion string `toml:"min_client_version"`
+	// Experimental holds toggles for features that are not production ready.
+	Experimental ExperimentalConfig `toml:"experimental"`
+}
+
+// ExperimentalConfig holds toggles for features that are still being
+// evaluated. These are all disabled by default and should not be turned on
+// in production environments.
+type ExperimentalConfig struct {
+	// EnableVP9 specifies whether the VP9 video codec can be negotiated.
+	EnableVP9 bool `toml:"enable_vp9"`
+	// EnableH264 specifies whether the H264 video codec can be negotiated.
+	EnableH264 bool `toml:"enable_h264"`
+	// EnableAV1SVC specifies whether the AV1 dependency descriptor header
+	// extension should be negotiated, which is needed to forward scalable
+	// (SVC) AV1 streams.
+	EnableAV1SVC bool `toml:"enable_av1_svc"`
+	// EnableFrameMarking specifies whether the frame marking header extension
+	// should be negotiated for video. When received, it's used to identify
+	// keyframes and discardable frames while forwarding.
+	EnableFrameMarking bool `toml:"enable_frame_marking"`
+}
+
+// getGroupMessagesPerSecond returns the inbound messages rate limit for the
+// given group.
+func (c ServerConfig) getGroupMessagesPerSecond(groupID string) int {
+	if limit, ok := c.GroupMessagesPerSecond[groupID]; ok {
+		return limit
+	}
+	return c.MaxGroupMessagesPerSecond
+}
+
+// getSimulcastBackoff returns the simulcast level change backoff parameters,
+// falling back to the defaults for unset values.
+func (c ServerConfig) getSimulcastBackoff() SimulcastBackoff {
+	backoff := SimulcastBackoff{
+		Initial: levelChangeInitialBackoff,
+		Max:     time.Duration(c.SimulcastBackoffMaxMs) * time.Millisecond,
+		Factor:  levelChangeBackoffFactor,
+	}
+	if c.SimulcastBackoffInitialMs > 0 {
+		backoff.Initial = time.Duration(c.SimulcastBackoffInitialMs) * time.Millisecond
+	}
+	if c.SimulcastBackoffFactor > 0 {
+		backoff.Factor = c.SimulcastBackoffFactor
+	}
+	return backoff
+}
+
+// getICETCPAcceptConcurrency returns the number of goroutines accepting ICE-TCP
+// connections, falling back to the default if unset.
+func (c ServerConfig) getICETCPAcceptConcurrency() int {
+	if c.ICETCPAcceptConcurrency > 0 {
+		return c.ICETCPAcceptConcurrency
+	}
+	return GetDefaultTCPAcceptConcurrency()
+}
+
+// getSignalingTimeout returns the negotiations timeout, falling back to the
+// default if unset.
+func (c ServerConfig) getSignalingTimeout() time.Duration {
+	if c.SignalingTimeoutMs > 0 {
+		return time.Duration(c.SignalingTimeoutMs) * time.Millisecond
+	}
+	return signalingTimeout
+}
+
+// enabledFeatures returns the names of the experimental features that are
+// turned on.
+func (c ExperimentalConfig) enabledFeatures() []string {
+	var features []string
+	if c.EnableVP9 {
+		features = append(features, "VP9")
+	}
+	if c.EnableH264 {
+		features = append(features, "H264")
+	}
+	if c.EnableAV1SVC {
+		features = append(features, "AV1-SVC")
+	}
+	if c.EnableFrameMarking {
+		features = append(features, "frame-marking")
+	}
+	return features
 }
 
+const (
+	iceKeepaliveIntervalMinMs       = 200
+	iceKeepaliveIntervalMaxMs       = 4000
+	iceRestartTimeoutMinMs          = 1000
+	iceRestartTimeoutMaxMs          = 60000
+	unexpectedVideoTrackHoldMaxMs   = 5000
+	dcOpenTimeoutMaxMs              = 30000
+	signalingTimeoutMinMs           = 1000
+	signalingTimeoutMaxMs           = 60000
+	maxSessionDurationMinMs         = 60000
+	maxSessionDurationMaxMs         = 7 * 24 * 60 * 60 * 1000
+	vadVoiceOffHoldMaxMs            = 5000
+	activeSpeakerDebounceMinMs      = 50
+	activeSpeakerDebounceMaxMs      = 5000
+	pliMaxIntervalMinMs             = 200
+	pliMaxIntervalMaxMs             = 10000
+	peerConnRetriesMax              = 5
+	maxOutstandingOffersMax         = 10
+	droppedMessagesLogIntervalMinMs = 100
+	droppedMessagesLogIntervalMaxMs = 300000
+	// Answer bandwidth bounds. The audio ones match the Opus bitrate range.
+	audioAnswerBandwidthMinKbps = 6
+	audioAnswerBandwidthMaxKbps = 510
+	videoAnswerBandwidthMinKbps = 100
+	videoAnswerBandwidthMaxKbps = 100000
+	// ICE credentials bounds as defined in RFC 5245 (Section 15.4).
+	iceUfragMinLength = 4
+	iceUfragMaxLength = 256
+	icePwdMinLength   = 22
+	icePwdMaxLength   = 256
+	// Track IDs bounds. The upper one is the length of random.NewID().
+	trackIDMinLength = 4
+	trackIDMaxLength = 26
+	// Simulcast level change backoff bounds.
+	simulcastBackoffInitialMinMs = 100
+	simulcastBackoffMaxMs        = 600000
+	simulcastBackoffFactorMin    = 1.0
+	simulcastBackoffFactorMax    = 4.0
+	// screenDemotionMaxTargetFPS is the highest frame rate demoted screen
+	// share tracks can be limited to.
+	screenDemotionMaxTargetFPS = 30
+)
+
+// ErrMissingChannelID is returned when initializing a session with no
+// channelID while ServerConfig.RequireChannelID is set.
+var ErrMissingChannelID = errors.New("missing channelID")
+
+// ErrE2EENotAllowed is returned when initializing a session with the e2ee
+// property set while ServerConfig.AllowE2EE is not.
+var ErrE2EENotAllowed = errors.New("e2ee not allowed")
+
+// ErrRelayUnavailable is returned when initializing a session requesting
+// relay only connectivity (relayOnly prop) while no TURN server is available.
+var ErrRelayUnavailable = errors.New("relay only connectivity requested but no TURN server is available")
+
+// ErrClientVersionTooOld is returned when initializing a session from a client
+// older than ServerConfig.MinClientVersion. The client should be updated.
+var ErrClientVersionTooOld = errors.New("client version is too old, please update")
+
+// ErrServerOverloaded is returned when initializing a session while the CPU
+// usage is above ServerConfig.MaxCPUUtilization. The operation can be retried,
+// possibly on a different node.
+var ErrServerOverloaded = errors.New("server is overloaded")
+
+// ErrSessionInitTimeout is returned when a session initialization could not
+// start in time because ServerConfig.MaxConcurrentSessionInits was reached.
+// The operation can be safely retried.
+var ErrSessionInitTimeout = errors.New("timed out waiting to initialize session")
+
 func (c ServerConfig) IsValid() error {
 	if c.ICEAddressUDP != "" && net.ParseIP(c.ICEAddressUDP) == nil {
 		return fmt.Errorf("invalid ICEAddressUDP value: not a valid address")
@@ -69,10 +436,205 @@ func (c ServerConfig) IsValid() error {
 		return fmt.Errorf("invalid ICEHostPortOverride value: %w", err)
 	}
 
+	if err := c.TURNAdvertisePolicy.IsValid(); err != nil {
+		return fmt.Errorf("invalid TURNAdvertisePolicy value: %w", err)
+	}
+
+	if c.IPv6Only && !c.EnableIPv6 {
+		return fmt.Errorf("invalid IPv6Only value: EnableIPv6 should be set")
+	}
+
 	if c.UDPSocketsCount <= 0 {
 		return fmt.Errorf("invalid UDPSocketsCount value: should be greater than 0")
 	}
 
+	if c.ICETCPAcceptConcurrency < 0 {
+		return fmt.Errorf("invalid ICETCPAcceptConcurrency value: should be a non-negative number")
+	}
+
+	if c.MaxForwardedAudioStreams < 0 {
+		return fmt.Errorf("invalid MaxForwardedAudioStreams value: should be a non-negative number")
+	}
+
+	if c.AudioLevelSilenceThreshold < 0 || c.AudioLevelSilenceThreshold > audioLevelSilence {
+		return fmt.Errorf("invalid AudioLevelSilenceThreshold value: %d is not in allowed range [0, %d]",
+			c.AudioLevelSilenceThreshold, audioLevelSilence)
+	}
+
+	if c.MaxUnmutedSpeakers < 0 {
+		return fmt.Errorf("invalid MaxUnmutedSpeakers value: should be a non-negative number")
+	}
+
+	if c.MaxConcurrentSessionInits < 0 {
+		return fmt.Errorf("invalid MaxConcurrentSessionInits value: should be a non-negative number")
+	}
+
+	if c.WarmPoolSize < 0 {
+		return fmt.Errorf("invalid WarmPoolSize value: should be a non-negative number")
+	}
+
+	if c.PeerConnectionRetries < 0 || c.PeerConnectionRetries > peerConnRetriesMax {
+		return fmt.Errorf("invalid PeerConnectionRetries value: %d is not in allowed range [0, %d]",
+			c.PeerConnectionRetries, peerConnRetriesMax)
+	}
+
+	if c.ICEKeepaliveIntervalMs != 0 && (c.ICEKeepaliveIntervalMs < iceKeepaliveIntervalMinMs || c.ICEKeepaliveIntervalMs > iceKeepaliveIntervalMaxMs) {
+		return fmt.Errorf("invalid ICEKeepaliveIntervalMs value: %d is not in allowed range [%d, %d]",
+			c.ICEKeepaliveIntervalMs, iceKeepaliveIntervalMinMs, iceKeepaliveIntervalMaxMs)
+	}
+
+	if c.ICERestartTimeoutMs != 0 && (c.ICERestartTimeoutMs < iceRestartTimeoutMinMs || c.ICERestartTimeoutMs > iceRestartTimeoutMaxMs) {
+		return fmt.Errorf("invalid ICERestartTimeoutMs value: %d is not in allowed range [%d, %d]",
+			c.ICERestartTimeoutMs, iceRestartTimeoutMinMs, iceRestartTimeoutMaxMs)
+	}
+
+	if c.PLIMaxIntervalMs != 0 && (c.PLIMaxIntervalMs < pliMaxIntervalMinMs || c.PLIMaxIntervalMs > pliMaxIntervalMaxMs) {
+		return fmt.Errorf("invalid PLIMaxIntervalMs value: %d is not in allowed range [%d, %d]",
+			c.PLIMaxIntervalMs, pliMaxIntervalMinMs, pliMaxIntervalMaxMs)
+	}
+
+	if c.DroppedMessagesLogIntervalMs != 0 && (c.DroppedMessagesLogIntervalMs < droppedMessagesLogIntervalMinMs || c.DroppedMessagesLogIntervalMs > droppedMessagesLogIntervalMaxMs) {
+		return fmt.Errorf("invalid DroppedMessagesLogIntervalMs value: %d is not in allowed range [%d, %d]",
+			c.DroppedMessagesLogIntervalMs, droppedMessagesLogIntervalMinMs, droppedMessagesLogIntervalMaxMs)
+	}
+
+	if c.AudioAnswerBandwidthKbps != 0 && (c.AudioAnswerBandwidthKbps < audioAnswerBandwidthMinKbps || c.AudioAnswerBandwidthKbps > audioAnswerBandwidthMaxKbps) {
+		return fmt.Errorf("invalid AudioAnswerBandwidthKbps value: %d is not in allowed range [%d, %d]",
+			c.AudioAnswerBandwidthKbps, audioAnswerBandwidthMinKbps, audioAnswerBandwidthMaxKbps)
+	}
+
+	if c.ScreenAnswerBandwidthKbps != 0 && (c.ScreenAnswerBandwidthKbps < videoAnswerBandwidthMinKbps || c.ScreenAnswerBandwidthKbps > videoAnswerBandwidthMaxKbps) {
+		return fmt.Errorf("invalid ScreenAnswerBandwidthKbps value: %d is not in allowed range [%d, %d]",
+			c.ScreenAnswerBandwidthKbps, videoAnswerBandwidthMinKbps, videoAnswerBandwidthMaxKbps)
+	}
+
+	if c.VideoAnswerBandwidthKbps != 0 && (c.VideoAnswerBandwidthKbps < videoAnswerBandwidthMinKbps || c.VideoAnswerBandwidthKbps > videoAnswerBandwidthMaxKbps) {
+		return fmt.Errorf("invalid VideoAnswerBandwidthKbps value: %d is not in allowed range [%d, %d]",
+			c.VideoAnswerBandwidthKbps, videoAnswerBandwidthMinKbps, videoAnswerBandwidthMaxKbps)
+	}
+
+	if c.UnexpectedVideoTrackHoldMs < 0 || c.UnexpectedVideoTrackHoldMs > unexpectedVideoTrackHoldMaxMs {
+		return fmt.Errorf("invalid UnexpectedVideoTrackHoldMs value: %d is not in allowed range [0, %d]",
+			c.UnexpectedVideoTrackHoldMs, unexpectedVideoTrackHoldMaxMs)
+	}
+
+	if c.DCOpenTimeoutMs < 0 || c.DCOpenTimeoutMs > dcOpenTimeoutMaxMs {
+		return fmt.Errorf("invalid DCOpenTimeoutMs value: %d is not in allowed range [0, %d]",
+			c.DCOpenTimeoutMs, dcOpenTimeoutMaxMs)
+	}
+
+	if c.SignalingTimeoutMs != 0 && (c.SignalingTimeoutMs < signalingTimeoutMinMs || c.SignalingTimeoutMs > signalingTimeoutMaxMs) {
+		return fmt.Errorf("invalid SignalingTimeoutMs value: %d is not in allowed range [%d, %d]",
+			c.SignalingTimeoutMs, signalingTimeoutMinMs, signalingTimeoutMaxMs)
+	}
+
+	if c.MaxOutstandingOffers < 0 || c.MaxOutstandingOffers > maxOutstandingOffersMax {
+		return fmt.Errorf("invalid MaxOutstandingOffers value: %d is not in allowed range [0, %d]",
+			c.MaxOutstandingOffers, maxOutstandingOffersMax)
+	}
+
+	if c.MaxSessionDurationMs != 0 && (c.MaxSessionDurationMs < maxSessionDurationMinMs || c.MaxSessionDurationMs > maxSessionDurationMaxMs) {
+		return fmt.Errorf("invalid MaxSessionDurationMs value: %d is not in allowed range [%d, %d]",
+			c.MaxSessionDurationMs, maxSessionDurationMinMs, maxSessionDurationMaxMs)
+	}
+
+	if c.VADVoiceOffHoldMs < 0 || c.VADVoiceOffHoldMs > vadVoiceOffHoldMaxMs {
+		return fmt.Errorf("invalid VADVoiceOffHoldMs value: %d is not in allowed range [0, %d]",
+			c.VADVoiceOffHoldMs, vadVoiceOffHoldMaxMs)
+	}
+
+	if c.ActiveSpeakerDebounceMs != 0 && (c.ActiveSpeakerDebounceMs < activeSpeakerDebounceMinMs || c.ActiveSpeakerDebounceMs > activeSpeakerDebounceMaxMs) {
+		return fmt.Errorf("invalid ActiveSpeakerDebounceMs value: %d is not in allowed range [%d, %d]",
+			c.ActiveSpeakerDebounceMs, activeSpeakerDebounceMinMs, activeSpeakerDebounceMaxMs)
+	}
+
+	if c.SimulcastBackoffInitialMs != 0 && (c.SimulcastBackoffInitialMs < simulcastBackoffInitialMinMs || c.SimulcastBackoffInitialMs > simulcastBackoffMaxMs) {
+		return fmt.Errorf("invalid SimulcastBackoffInitialMs value: %d is not in allowed range [%d, %d]",
+			c.SimulcastBackoffInitialMs, simulcastBackoffInitialMinMs, simulcastBackoffMaxMs)
+	}
+
+	if c.SimulcastBackoffMaxMs < 0 || c.SimulcastBackoffMaxMs > simulcastBackoffMaxMs {
+		return fmt.Errorf("invalid SimulcastBackoffMaxMs value: %d is not in allowed range [0, %d]",
+			c.SimulcastBackoffMaxMs, simulcastBackoffMaxMs)
+	}
+
+	if c.SimulcastBackoffFactor != 0 && (c.SimulcastBackoffFactor < simulcastBackoffFactorMin || c.SimulcastBackoffFactor > simulcastBackoffFactorMax) {
+		return fmt.Errorf("invalid SimulcastBackoffFactor value: %g is not in allowed range [%g, %g]",
+			c.SimulcastBackoffFactor, simulcastBackoffFactorMin, simulcastBackoffFactorMax)
+	}
+
+	if err := c.getSimulcastBackoff().IsValid(); err != nil {
+		return fmt.Errorf("invalid simulcast backoff config: %w", err)
+	}
+
+	if c.ICEUfragLength != 0 && (c.ICEUfragLength < iceUfragMinLength || c.ICEUfragLength > iceUfragMaxLength) {
+		return fmt.Errorf("invalid ICEUfragLength value: %d is not in allowed range [%d, %d]",
+			c.ICEUfragLength, iceUfragMinLength, iceUfragMaxLength)
+	}
+
+	if c.ICEPwdLength != 0 && (c.ICEPwdLength < icePwdMinLength || c.ICEPwdLength > icePwdMaxLength) {
+		return fmt.Errorf("invalid ICEPwdLength value: %d is not in allowed range [%d, %d]",
+			c.ICEPwdLength, icePwdMinLength, icePwdMaxLength)
+	}
+
+	if c.TrackIDLength != 0 && (c.TrackIDLength < trackIDMinLength || c.TrackIDLength > trackIDMaxLength) {
+		return fmt.Errorf("invalid TrackIDLength value: %d is not in allowed range [%d, %d]",
+			c.TrackIDLength, trackIDMinLength, trackIDMaxLength)
+	}
+
+	if c.MetricsSampleRate < 0 || c.MetricsSampleRate > 1 {
+		return fmt.Errorf("invalid MetricsSampleRate value: %g is not in allowed range [0, 1]", c.MetricsSampleRate)
+	}
+
+	if c.ScreenDemotionCPUThreshold < 0 || c.ScreenDemotionCPUThreshold > 1 {
+		return fmt.Errorf("invalid ScreenDemotionCPUThreshold value: %g is not in allowed range [0, 1]", c.ScreenDemotionCPUThreshold)
+	}
+
+	if c.MaxCPUUtilization < 0 || c.MaxCPUUtilization > 1 {
+		return fmt.Errorf("invalid MaxCPUUtilization value: %g is not in allowed range [0, 1]", c.MaxCPUUtilization)
+	}
+
+	if c.ScreenDemotionTargetFPS < 0 || c.ScreenDemotionTargetFPS > screenDemotionMaxTargetFPS {
+		return fmt.Errorf("invalid ScreenDemotionTargetFPS value: %d is not in allowed range [0, %d]",
+			c.ScreenDemotionTargetFPS, screenDemotionMaxTargetFPS)
+	}
+
+	if c.MaxTracksPerSession < 0 {
+		return fmt.Errorf("invalid MaxTracksPerSession value: should be a non-negative number")
+	}
+
+	if c.MaxReceiversPerPublisher < 0 {
+		return fmt.Errorf("invalid MaxReceiversPerPublisher value: should be a non-negative number")
+	}
+
+	if c.MaxCallParticipants < 0 {
+		return fmt.Errorf("invalid MaxCallParticipants value: should be a non-negative number")
+	}
+
+	if c.MinClientVersion != "" {
+		if _, err := semver.ParseTolerant(c.MinClientVersion); err != nil {
+			return fmt.Errorf("invalid MinClientVersion value: %w", err)
+		}
+	}
+
+	if c.MaxDCMessagesPerSecond < 0 {
+		return fmt.Errorf("invalid MaxDCMessagesPerSecond value: should be a non-negative number")
+	}
+
+	if c.MaxGroupMessagesPerSecond < 0 {
+		return fmt.Errorf("invalid MaxGroupMessagesPerSecond value: should be a non-negative number")
+	}
+
+	for groupID, limit := range c.GroupMessagesPerSecond {
+		if limit < 0 {
+			return fmt.Errorf("invalid GroupMessagesPerSecond value for group %q: should be a non-negative number", groupID)
+		}
+	}
+
+	if c.MaxForwardingWorkersPerCall < 0 {
+		return fmt.Errorf("invalid MaxForwardingWorkersPerCall value: should be a non-negative number")
+	}
+
 	return nil
 }
 
@@ -101,11 +663,53 @@ func (p SessionProps) AV1Support() bool {
 	return val
 }
 
+func (p SessionProps) VP9Support() bool {
+	val, _ := p["vp9Support"].(bool)
+	return val
+}
+
+// OpusDTXSupport returns whether the client the session originates from
+// supports Opus discontinuous transmission (DTX).
+func (p SessionProps) OpusDTXSupport() bool {
+	val, _ := p["opusDTXSupport"].(bool)
+	return val
+}
+
+// DisableCongestionControl returns whether congestion control should be
+// skipped for the session (e.g. bots on unmetered networks), in which case
+// the highest simulcast level is always selected.
+func (p SessionProps) DisableCongestionControl() bool {
+	val, _ := p["disableCongestionControl"].(bool)
+	return val
+}
+
 func (p SessionProps) DCSignaling() bool {
 	val, _ := p["dcSignaling"].(bool)
 	return val
 }
 
+// Version returns the version of the client the session originates from.
+func (p SessionProps) Version() string {
+	val, _ := p["version"].(string)
+	return val
+}
+
+// E2EE returns whether the session's media payloads are end-to-end encrypted
+// (e.g. through insertable streams), in which case they must be forwarded
+// opaquely.
+func (p SessionProps) E2EE() bool {
+	val, _ := p["e2ee"].(bool)
+	return val
+}
+
+// RelayOnly returns whether the session's connectivity should be limited to
+// relay (TURN) candidates, regardless of the node wide configuration. Useful
+// for clients on networks known to be problematic.
+func (p SessionProps) RelayOnly() bool {
+	val, _ := p["relayOnly"].(bool)
+	return val
+}
+
 func (c SessionConfig) IsValid() error {
 	if c.GroupID == "" {
 		return fmt.Errorf("invalid GroupID value: should not be empty")
@@ -139,9 +743,15 @@ func (c *SessionConfig) FromMap(m map[string]any) error {
 	c.UserID, _ = m["userID"].(string)
 	c.SessionID, _ = m["sessionID"].(string)
 	c.Props = SessionProps{
-		"channelID":   m["channelID"],
-		"av1Support":  m["av1Support"],
-		"dcSignaling": m["dcSignaling"],
+		"channelID":                m["channelID"],
+		"av1Support":               m["av1Support"],
+		"vp9Support":               m["vp9Support"],
+		"dcSignaling":              m["dcSignaling"],
+		"e2ee":                     m["e2ee"],
+		"version":                  m["version"],
+		"opusDTXSupport":           m["opusDTXSupport"],
+		"disableCongestionControl": m["disableCongestionControl"],
+		"relayOnly":                m["relayOnly"],
 	}
 
 	return nil
@@ -151,6 +761,10 @@ type ICEServerConfig struct {
 	URLs       []string `toml:"urls" json:"urls"`
 	Username   string   `toml:"username,omitempty" json:"username,omitempty"`
 	Credential string   `toml:"credential,omitempty" json:"credential,omitempty"`
+	// Whether the TURN server accepts connections over TLS (TURNS), e.g. to
+	// traverse networks only allowing TLS egress on port 443. When set, its
+	// turn: URLs are advertised with the turns: scheme.
+	TLS bool `toml:"tls,omitempty" json:"tls,omitempty"`
 }
 
 type ICEServers []ICEServerConfig
@@ -168,9 +782,51 @@ func (c ICEServerConfig) IsValid() error {
 			return fmt.Errorf("URL is not a valid STUN/TURN server")
 		}
 	}
+
+	if c.TLS && !c.IsTURN() {
+		return fmt.Errorf("invalid TLS value: only supported for TURN servers")
+	}
+
+	// The default TURNS port (5349) is rarely the one exposed when relying on
+	// TLS to traverse restrictive networks so we require it to be explicit.
+	for _, u := range c.GetURLs() {
+		if strings.HasPrefix(u, "turns:") && !hasURLPort(u) {
+			return fmt.Errorf("invalid TURNS URL %q: port should be specified", u)
+		}
+	}
+
 	return nil
 }
 
+// GetURLs returns the server's URLs as they should be advertised, with TURN
+// URLs using the turns: scheme if TLS is set.
+func (c ICEServerConfig) GetURLs() []string {
+	if !c.TLS {
+		return c.URLs
+	}
+
+	urls := make([]string, 0, len(c.URLs))
+	for _, u := range c.URLs {
+		if strings.HasPrefix(u, "turn:") {
+			u = "turns:" + strings.TrimPrefix(u, "turn:")
+		}
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// hasURLPort returns whether the given STUN/TURN URL (e.g.
+// turns:host:443?transport=tcp) explicitly specifies a port.
+func hasURLPort(u string) bool {
+	_, hostPort, ok := strings.Cut(u, ":")
+	if !ok {
+		return false
+	}
+	hostPort, _, _ = strings.Cut(hostPort, "?")
+	_, port, err := net.SplitHostPort(hostPort)
+	return err == nil && port != ""
+}
+
 func (c ICEServerConfig) IsTURN() bool {
 	for _, u := range c.URLs {
 		if !strings.HasPrefix(u, "turn:") && !strings.HasPrefix(u, "turns:") {
@@ -245,6 +901,7 @@ func (s *ICEServers) UnmarshalTOML(data interface{}) error {
 			}
 			server.Username, _ = m["username"].(string)
 			server.Credential, _ = m["credential"].(string)
+			server.TLS, _ = m["tls"].(bool)
 		default:
 			return fmt.Errorf("unknown type %T", t)
 		}
@@ -343,3 +1000,23 @@ func (s *ICEHostPortOverride) UnmarshalTOML(data interface{}) error {
 
 	return nil
 }
+
+type TURNAdvertisePolicy string
+
+const (
+	// TURNAdvertisePolicyAlways causes TURN servers to always be advertised.
+	TURNAdvertisePolicyAlways TURNAdvertisePolicy = "always"
+	// TURNAdvertisePolicyNATOnly causes TURN servers to be advertised only if
+	// the server is found to be behind NAT (i.e. public IP discovery did not
+	// find a direct 1:1 mapping between local and public addresses).
+	TURNAdvertisePolicyNATOnly TURNAdvertisePolicy = "natOnly"
+)
+
+func (p TURNAdvertisePolicy) IsValid() error {
+	switch p {
+	case "", TURNAdvertisePolicyAlways, TURNAdvertisePolicyNATOnly:
+		return nil
+	default:
+		return fmt.Errorf("unknown policy %q", p)
+	}
+}
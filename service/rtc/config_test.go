@@ -5,6 +5,7 @@ package rtc
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -16,6 +17,46 @@ func TestServerConfigIsValid(t *testing.T) {
 		require.Error(t, err)
 	})
 
+	t.Run("invalid SignalingTimeoutMs", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.SignalingTimeoutMs = 999
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid SignalingTimeoutMs value: 999 is not in allowed range [1000, 60000]")
+
+		cfg.SignalingTimeoutMs = 60001
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid SignalingTimeoutMs value: 60001 is not in allowed range [1000, 60000]")
+
+		cfg.SignalingTimeoutMs = 30000
+		err = cfg.IsValid()
+		require.NoError(t, err)
+		require.Equal(t, 30*time.Second, cfg.getSignalingTimeout())
+
+		cfg.SignalingTimeoutMs = 0
+		require.Equal(t, signalingTimeout, cfg.getSignalingTimeout())
+	})
+
+	t.Run("invalid MaxOutstandingOffers", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.MaxOutstandingOffers = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid MaxOutstandingOffers value: -1 is not in allowed range [0, 10]")
+
+		cfg.MaxOutstandingOffers = 11
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid MaxOutstandingOffers value: 11 is not in allowed range [0, 10]")
+
+		cfg.MaxOutstandingOffers = 2
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
 	t.Run("invalid ICEAddressUDP", func(t *testing.T) {
 		var cfg ServerConfig
 		cfg.ICEAddressUDP = "not_an_address"
@@ -95,6 +136,16 @@ func TestServerConfigIsValid(t *testing.T) {
 		})
 	})
 
+	t.Run("invalid IPv6Only", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.IPv6Only = true
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid IPv6Only value: EnableIPv6 should be set")
+	})
+
 	t.Run("invalid UDPSocketsCount", func(t *testing.T) {
 		var cfg ServerConfig
 		cfg.ICEPortUDP = 8443
@@ -104,6 +155,536 @@ func TestServerConfigIsValid(t *testing.T) {
 		require.EqualError(t, err, "invalid UDPSocketsCount value: should be greater than 0")
 	})
 
+	t.Run("invalid MaxForwardedAudioStreams", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.MaxForwardedAudioStreams = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid MaxForwardedAudioStreams value: should be a non-negative number")
+	})
+
+	t.Run("invalid AudioLevelSilenceThreshold", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.AudioLevelSilenceThreshold = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid AudioLevelSilenceThreshold value: -1 is not in allowed range [0, 127]")
+
+		cfg.AudioLevelSilenceThreshold = 128
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid AudioLevelSilenceThreshold value: 128 is not in allowed range [0, 127]")
+
+		cfg.AudioLevelSilenceThreshold = 70
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid WarmPoolSize", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.WarmPoolSize = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid WarmPoolSize value: should be a non-negative number")
+	})
+
+	t.Run("invalid PeerConnectionRetries", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.PeerConnectionRetries = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid PeerConnectionRetries value: -1 is not in allowed range [0, 5]")
+
+		cfg.PeerConnectionRetries = 6
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid PeerConnectionRetries value: 6 is not in allowed range [0, 5]")
+
+		cfg.PeerConnectionRetries = 2
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid group messages rate limit", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.MaxGroupMessagesPerSecond = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid MaxGroupMessagesPerSecond value: should be a non-negative number")
+
+		cfg.MaxGroupMessagesPerSecond = 100
+		cfg.GroupMessagesPerSecond = map[string]int{"groupA": 0, "groupB": -1}
+		err = cfg.IsValid()
+		require.EqualError(t, err, `invalid GroupMessagesPerSecond value for group "groupB": should be a non-negative number`)
+
+		cfg.GroupMessagesPerSecond["groupB"] = 10
+		err = cfg.IsValid()
+		require.NoError(t, err)
+		require.Equal(t, 0, cfg.getGroupMessagesPerSecond("groupA"))
+		require.Equal(t, 10, cfg.getGroupMessagesPerSecond("groupB"))
+		require.Equal(t, 100, cfg.getGroupMessagesPerSecond("groupC"))
+	})
+
+	t.Run("invalid MaxUnmutedSpeakers", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.MaxUnmutedSpeakers = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid MaxUnmutedSpeakers value: should be a non-negative number")
+	})
+
+	t.Run("invalid MaxConcurrentSessionInits", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.MaxConcurrentSessionInits = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid MaxConcurrentSessionInits value: should be a non-negative number")
+	})
+
+	t.Run("invalid ICEKeepaliveIntervalMs", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.ICEKeepaliveIntervalMs = 100
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid ICEKeepaliveIntervalMs value: 100 is not in allowed range [200, 4000]")
+
+		cfg.ICEKeepaliveIntervalMs = 5000
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid ICEKeepaliveIntervalMs value: 5000 is not in allowed range [200, 4000]")
+
+		cfg.ICEKeepaliveIntervalMs = 1000
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid ICERestartTimeoutMs", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.ICERestartTimeoutMs = 500
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid ICERestartTimeoutMs value: 500 is not in allowed range [1000, 60000]")
+
+		cfg.ICERestartTimeoutMs = 70000
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid ICERestartTimeoutMs value: 70000 is not in allowed range [1000, 60000]")
+
+		cfg.ICERestartTimeoutMs = 5000
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid answer bandwidth", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.AudioAnswerBandwidthKbps = 5
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid AudioAnswerBandwidthKbps value: 5 is not in allowed range [6, 510]")
+
+		cfg.AudioAnswerBandwidthKbps = 600
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid AudioAnswerBandwidthKbps value: 600 is not in allowed range [6, 510]")
+
+		cfg.AudioAnswerBandwidthKbps = 64
+		cfg.ScreenAnswerBandwidthKbps = 50
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid ScreenAnswerBandwidthKbps value: 50 is not in allowed range [100, 100000]")
+
+		cfg.ScreenAnswerBandwidthKbps = 2500
+		cfg.VideoAnswerBandwidthKbps = 200000
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid VideoAnswerBandwidthKbps value: 200000 is not in allowed range [100, 100000]")
+
+		cfg.VideoAnswerBandwidthKbps = 1000
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid PLIMaxIntervalMs", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.PLIMaxIntervalMs = 100
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid PLIMaxIntervalMs value: 100 is not in allowed range [200, 10000]")
+
+		cfg.PLIMaxIntervalMs = 20000
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid PLIMaxIntervalMs value: 20000 is not in allowed range [200, 10000]")
+
+		cfg.PLIMaxIntervalMs = 500
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid DroppedMessagesLogIntervalMs", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.DroppedMessagesLogIntervalMs = 50
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid DroppedMessagesLogIntervalMs value: 50 is not in allowed range [100, 300000]")
+
+		cfg.DroppedMessagesLogIntervalMs = 1000
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid ICE credentials length", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.ICEUfragLength = 3
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid ICEUfragLength value: 3 is not in allowed range [4, 256]")
+
+		cfg.ICEUfragLength = 257
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid ICEUfragLength value: 257 is not in allowed range [4, 256]")
+
+		cfg.ICEUfragLength = 4
+		cfg.ICEPwdLength = 21
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid ICEPwdLength value: 21 is not in allowed range [22, 256]")
+
+		cfg.ICEPwdLength = 257
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid ICEPwdLength value: 257 is not in allowed range [22, 256]")
+
+		cfg.ICEPwdLength = 22
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid TrackIDLength", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.TrackIDLength = 3
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid TrackIDLength value: 3 is not in allowed range [4, 26]")
+
+		cfg.TrackIDLength = 27
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid TrackIDLength value: 27 is not in allowed range [4, 26]")
+
+		cfg.TrackIDLength = 26
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid MetricsSampleRate", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.MetricsSampleRate = -0.1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid MetricsSampleRate value: -0.1 is not in allowed range [0, 1]")
+
+		cfg.MetricsSampleRate = 1.5
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid MetricsSampleRate value: 1.5 is not in allowed range [0, 1]")
+
+		cfg.MetricsSampleRate = 0.25
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid screen demotion settings", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.ScreenDemotionCPUThreshold = 1.1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid ScreenDemotionCPUThreshold value: 1.1 is not in allowed range [0, 1]")
+
+		cfg.ScreenDemotionCPUThreshold = 0.8
+		cfg.ScreenDemotionTargetFPS = -1
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid ScreenDemotionTargetFPS value: -1 is not in allowed range [0, 30]")
+
+		cfg.ScreenDemotionTargetFPS = 31
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid ScreenDemotionTargetFPS value: 31 is not in allowed range [0, 30]")
+
+		cfg.ScreenDemotionTargetFPS = 10
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid MaxCPUUtilization", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.MaxCPUUtilization = -0.1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid MaxCPUUtilization value: -0.1 is not in allowed range [0, 1]")
+
+		cfg.MaxCPUUtilization = 1.5
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid MaxCPUUtilization value: 1.5 is not in allowed range [0, 1]")
+
+		cfg.MaxCPUUtilization = 0.9
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid MaxTracksPerSession", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.MaxTracksPerSession = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid MaxTracksPerSession value: should be a non-negative number")
+
+		cfg.MaxTracksPerSession = 10
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid MaxReceiversPerPublisher", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.MaxReceiversPerPublisher = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid MaxReceiversPerPublisher value: should be a non-negative number")
+
+		cfg.MaxReceiversPerPublisher = 10
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid MaxCallParticipants", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.MaxCallParticipants = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid MaxCallParticipants value: should be a non-negative number")
+
+		cfg.MaxCallParticipants = 100
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid MinClientVersion", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.MinClientVersion = "invalid"
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid MinClientVersion value: Invalid character(s) found in major number \"0invalid\"")
+
+		cfg.MinClientVersion = "v1.2.0"
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid UnexpectedVideoTrackHoldMs", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.UnexpectedVideoTrackHoldMs = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid UnexpectedVideoTrackHoldMs value: -1 is not in allowed range [0, 5000]")
+
+		cfg.UnexpectedVideoTrackHoldMs = 5001
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid UnexpectedVideoTrackHoldMs value: 5001 is not in allowed range [0, 5000]")
+
+		cfg.UnexpectedVideoTrackHoldMs = 500
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid DCOpenTimeoutMs", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.DCOpenTimeoutMs = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid DCOpenTimeoutMs value: -1 is not in allowed range [0, 30000]")
+
+		cfg.DCOpenTimeoutMs = 30001
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid DCOpenTimeoutMs value: 30001 is not in allowed range [0, 30000]")
+
+		cfg.DCOpenTimeoutMs = 2000
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid MaxSessionDurationMs", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.MaxSessionDurationMs = 59999
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid MaxSessionDurationMs value: 59999 is not in allowed range [60000, 604800000]")
+
+		cfg.MaxSessionDurationMs = 604800001
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid MaxSessionDurationMs value: 604800001 is not in allowed range [60000, 604800000]")
+
+		cfg.MaxSessionDurationMs = 3600000
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid VADVoiceOffHoldMs", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.VADVoiceOffHoldMs = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid VADVoiceOffHoldMs value: -1 is not in allowed range [0, 5000]")
+
+		cfg.VADVoiceOffHoldMs = 5001
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid VADVoiceOffHoldMs value: 5001 is not in allowed range [0, 5000]")
+
+		cfg.VADVoiceOffHoldMs = 500
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid ActiveSpeakerDebounceMs", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.ActiveSpeakerDebounceMs = 49
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid ActiveSpeakerDebounceMs value: 49 is not in allowed range [50, 5000]")
+
+		cfg.ActiveSpeakerDebounceMs = 5001
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid ActiveSpeakerDebounceMs value: 5001 is not in allowed range [50, 5000]")
+
+		cfg.ActiveSpeakerDebounceMs = 500
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid simulcast backoff", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.SimulcastBackoffInitialMs = 99
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid SimulcastBackoffInitialMs value: 99 is not in allowed range [100, 600000]")
+
+		cfg.SimulcastBackoffInitialMs = 2000
+		cfg.SimulcastBackoffMaxMs = -1
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid SimulcastBackoffMaxMs value: -1 is not in allowed range [0, 600000]")
+
+		cfg.SimulcastBackoffMaxMs = 1000
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid simulcast backoff config: invalid Max value: should not be lower than Initial")
+
+		// The default initial backoff (10s) applies when unset.
+		cfg.SimulcastBackoffInitialMs = 0
+		cfg.SimulcastBackoffMaxMs = 5000
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid simulcast backoff config: invalid Max value: should not be lower than Initial")
+
+		cfg.SimulcastBackoffMaxMs = 30000
+		cfg.SimulcastBackoffFactor = 0.5
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid SimulcastBackoffFactor value: 0.5 is not in allowed range [1, 4]")
+
+		cfg.SimulcastBackoffFactor = 4.5
+		err = cfg.IsValid()
+		require.EqualError(t, err, "invalid SimulcastBackoffFactor value: 4.5 is not in allowed range [1, 4]")
+
+		cfg.SimulcastBackoffFactor = 2
+		err = cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid MaxDCMessagesPerSecond", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.MaxDCMessagesPerSecond = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid MaxDCMessagesPerSecond value: should be a non-negative number")
+	})
+
+	t.Run("invalid TURNAdvertisePolicy", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.TURNAdvertisePolicy = "never"
+		err := cfg.IsValid()
+		require.EqualError(t, err, `invalid TURNAdvertisePolicy value: unknown policy "never"`)
+	})
+
+	t.Run("invalid MaxForwardingWorkersPerCall", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.MaxForwardingWorkersPerCall = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid MaxForwardingWorkersPerCall value: should be a non-negative number")
+	})
+
+	t.Run("invalid ICETCPAcceptConcurrency", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ICEPortUDP = 8443
+		cfg.ICEPortTCP = 8443
+		cfg.UDPSocketsCount = 1
+		cfg.ICETCPAcceptConcurrency = -1
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid ICETCPAcceptConcurrency value: should be a non-negative number")
+
+		cfg.ICETCPAcceptConcurrency = 0
+		err = cfg.IsValid()
+		require.NoError(t, err)
+		require.Equal(t, GetDefaultTCPAcceptConcurrency(), cfg.getICETCPAcceptConcurrency())
+
+		cfg.ICETCPAcceptConcurrency = 2
+		require.Equal(t, 2, cfg.getICETCPAcceptConcurrency())
+	})
+
 	t.Run("valid", func(t *testing.T) {
 		var cfg ServerConfig
 		cfg.ICEAddressUDP = "127.0.0.1"
@@ -283,6 +864,94 @@ func TestICEServerConfigIsValid(t *testing.T) {
 		err := cfg.IsValid()
 		require.NoError(t, err)
 	})
+
+	t.Run("secured, missing port", func(t *testing.T) {
+		cfg := ICEServerConfig{
+			URLs: []string{
+				"turns:localhost?transport=tcp",
+			},
+		}
+		err := cfg.IsValid()
+		require.EqualError(t, err, `invalid TURNS URL "turns:localhost?transport=tcp": port should be specified`)
+	})
+
+	t.Run("secured, IPv6", func(t *testing.T) {
+		cfg := ICEServerConfig{
+			URLs: []string{
+				"turns:[::1]:443?transport=tcp",
+			},
+		}
+		err := cfg.IsValid()
+		require.NoError(t, err)
+	})
+
+	t.Run("TLS, missing port", func(t *testing.T) {
+		cfg := ICEServerConfig{
+			URLs: []string{
+				"turn:localhost",
+			},
+			TLS: true,
+		}
+		err := cfg.IsValid()
+		require.EqualError(t, err, `invalid TURNS URL "turns:localhost": port should be specified`)
+	})
+
+	t.Run("TLS, STUN server", func(t *testing.T) {
+		cfg := ICEServerConfig{
+			URLs: []string{
+				"stun:localhost:443",
+			},
+			TLS: true,
+		}
+		err := cfg.IsValid()
+		require.EqualError(t, err, "invalid TLS value: only supported for TURN servers")
+	})
+
+	t.Run("TLS, valid", func(t *testing.T) {
+		cfg := ICEServerConfig{
+			URLs: []string{
+				"turn:localhost:443",
+			},
+			TLS: true,
+		}
+		err := cfg.IsValid()
+		require.NoError(t, err)
+	})
+}
+
+func TestICEServerConfigGetURLs(t *testing.T) {
+	t.Run("no TLS", func(t *testing.T) {
+		cfg := ICEServerConfig{
+			URLs: []string{"turn:localhost:3478", "turns:localhost:443"},
+		}
+		require.Equal(t, []string{"turn:localhost:3478", "turns:localhost:443"}, cfg.GetURLs())
+	})
+
+	t.Run("TLS", func(t *testing.T) {
+		cfg := ICEServerConfig{
+			URLs: []string{"turn:localhost:443?transport=tcp", "turns:localhost:5349"},
+			TLS:  true,
+		}
+		require.Equal(t, []string{"turns:localhost:443?transport=tcp", "turns:localhost:5349"}, cfg.GetURLs())
+		// The configured URLs are left untouched.
+		require.Equal(t, "turn:localhost:443?transport=tcp", cfg.URLs[0])
+	})
+}
+
+func TestICEServersUnmarshalTOML(t *testing.T) {
+	var servers ICEServers
+	err := servers.UnmarshalTOML([]interface{}{
+		"stun:localhost:3478",
+		map[string]interface{}{
+			"urls": []interface{}{"turn:localhost:443"},
+			"tls":  true,
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, ICEServers{
+		{URLs: []string{"stun:localhost:3478"}},
+		{URLs: []string{"turn:localhost:443"}, TLS: true},
+	}, servers)
 }
 
 func TestICEHostPortOverrideParseMap(t *testing.T) {
@@ -354,9 +1023,15 @@ func TestSessionConfigFromMap(t *testing.T) {
 			UserID:    "userID",
 			CallID:    "callID",
 			Props: SessionProps{
-				"channelID":   nil,
-				"av1Support":  nil,
-				"dcSignaling": nil,
+				"channelID":                nil,
+				"av1Support":               nil,
+				"vp9Support":               nil,
+				"dcSignaling":              nil,
+				"e2ee":                     nil,
+				"version":                  nil,
+				"opusDTXSupport":           nil,
+				"disableCongestionControl": nil,
+				"relayOnly":                nil,
 			},
 		}, cfg)
 	})
@@ -364,13 +1039,19 @@ func TestSessionConfigFromMap(t *testing.T) {
 	t.Run("complete", func(t *testing.T) {
 		var cfg SessionConfig
 		err := cfg.FromMap(map[string]any{
-			"callID":      "callID",
-			"sessionID":   "sessionID",
-			"groupID":     "groupID",
-			"userID":      "userID",
-			"channelID":   "channelID",
-			"av1Support":  true,
-			"dcSignaling": true,
+			"callID":                   "callID",
+			"sessionID":                "sessionID",
+			"groupID":                  "groupID",
+			"userID":                   "userID",
+			"channelID":                "channelID",
+			"av1Support":               true,
+			"vp9Support":               true,
+			"dcSignaling":              true,
+			"e2ee":                     true,
+			"version":                  "1.2.0",
+			"opusDTXSupport":           true,
+			"disableCongestionControl": true,
+			"relayOnly":                true,
 		})
 		require.NoError(t, err)
 		require.NoError(t, cfg.IsValid())
@@ -380,9 +1061,15 @@ func TestSessionConfigFromMap(t *testing.T) {
 			UserID:    "userID",
 			CallID:    "callID",
 			Props: SessionProps{
-				"channelID":   "channelID",
-				"av1Support":  true,
-				"dcSignaling": true,
+				"channelID":                "channelID",
+				"av1Support":               true,
+				"vp9Support":               true,
+				"dcSignaling":              true,
+				"e2ee":                     true,
+				"version":                  "1.2.0",
+				"opusDTXSupport":           true,
+				"disableCongestionControl": true,
+				"relayOnly":                true,
 			},
 		}, cfg)
 	})
@@ -395,16 +1082,31 @@ func TestSessionProps(t *testing.T) {
 		}
 		require.Empty(t, cfg.Props.ChannelID())
 		require.False(t, cfg.Props.AV1Support())
+		require.False(t, cfg.Props.VP9Support())
+		require.False(t, cfg.Props.E2EE())
+		require.False(t, cfg.Props.OpusDTXSupport())
+		require.False(t, cfg.Props.DisableCongestionControl())
+		require.Empty(t, cfg.Props.Version())
 	})
 
 	t.Run("complete props", func(t *testing.T) {
 		cfg := SessionConfig{
 			Props: SessionProps{
-				"channelID":  "channelID",
-				"av1Support": true,
+				"channelID":                "channelID",
+				"av1Support":               true,
+				"vp9Support":               true,
+				"e2ee":                     true,
+				"version":                  "1.2.0",
+				"opusDTXSupport":           true,
+				"disableCongestionControl": true,
 			},
 		}
 		require.Equal(t, "channelID", cfg.Props.ChannelID())
 		require.True(t, cfg.Props.AV1Support())
+		require.True(t, cfg.Props.VP9Support())
+		require.True(t, cfg.Props.E2EE())
+		require.True(t, cfg.Props.OpusDTXSupport())
+		require.True(t, cfg.Props.DisableCongestionControl())
+		require.Equal(t, "1.2.0", cfg.Props.Version())
 	})
 }
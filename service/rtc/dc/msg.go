@@ -19,17 +19,68 @@ import (
 type MessageType uint8
 
 const (
-	MessageTypePing          MessageType = iota + 1 // no payload
-	MessageTypePong                                 // no payload
-	MessageTypeSDP                                  // MessageSDP
-	MessageTypeLossRate                             // float64
-	MessageTypeRoundTripTime                        // float64
-	MessageTypeJitter                               // float64
+	MessageTypePing                    MessageType = iota + 1 // no payload
+	MessageTypePong                                           // no payload
+	MessageTypeSDP                                            // MessageSDP
+	MessageTypeLossRate                                       // float64
+	MessageTypeRoundTripTime                                  // float64
+	MessageTypeJitter                                         // float64
+	MessageTypePreferredSimulcastLevel                        // string
+	MessageTypeBandwidthEstimation                            // int
+	MessageTypeSourceSimulcastLevel                           // MessageSourceSimulcastLevel
+	MessageTypeAudioPLCHint                                   // float64
+	MessageTypeTrackResubscribe                               // MessageTrackResubscribe
+	MessageTypeStopReceiving                                  // string (source session ID)
+	MessageTypeICEServers                                     // MessageICEServers
+	MessageTypeSimulcastLevelChanged                          // string
+	MessageTypeMediaMap                                       // MessageMediaMap
 )
 
 // Supported payloads
 type MessageSDP []byte // payload is zlib compressed data of a JSON serialized webrtc.SessionDescription
 
+// MessageSourceSimulcastLevel holds the preferred simulcast level for the
+// video tracks sent by a specific session.
+type MessageSourceSimulcastLevel struct {
+	SessionID string `msgpack:"sessionID"`
+	Level     string `msgpack:"level"`
+}
+
+// MessageTrackResubscribe is sent by clients to request a track that was
+// expected but never received (e.g. due to a failed renegotiation) to be
+// sent again.
+type MessageTrackResubscribe struct {
+	SessionID string `msgpack:"sessionID"`
+	TrackType string `msgpack:"trackType"`
+}
+
+// MessageICEServer holds the configuration for an ICE (STUN/TURN) server.
+type MessageICEServer struct {
+	URLs       []string `msgpack:"urls"`
+	Username   string   `msgpack:"username,omitempty"`
+	Credential string   `msgpack:"credential,omitempty"`
+	// TTL is the remaining lifetime, in seconds, of short-lived credentials
+	// so that clients can refresh them ahead of expiration. It's zero for
+	// static ones.
+	TTL int64 `msgpack:"ttl,omitempty"`
+}
+
+// MessageICEServers is sent by the server to refresh the ICE servers
+// configuration (e.g. short-lived TURN credentials) of a client.
+type MessageICEServers []MessageICEServer
+
+// MessageMediaMapTrack describes the track sent through a transceiver.
+type MessageMediaMapTrack struct {
+	TrackID   string `msgpack:"trackID"`
+	TrackType string `msgpack:"trackType"`
+	SessionID string `msgpack:"sessionID"`
+}
+
+// MessageMediaMap is sent by the server after each negotiation to map the
+// media IDs (MIDs) of the transceivers sending tracks to a client to the
+// tracks themselves.
+type MessageMediaMap map[string]MessageMediaMapTrack
+
 func unpackData(data []byte) ([]byte, error) {
 	rd, err := zlib.NewReader(bytes.NewBuffer(data))
 	if err != nil {
@@ -112,12 +163,60 @@ func DecodeMessage(msg []byte) (MessageType, any, error) {
 	case MessageTypeRoundTripTime:
 		fallthrough
 	case MessageTypeJitter:
+		fallthrough
+	case MessageTypeAudioPLCHint:
 		var payload float64
 		err := dec.Decode(&payload)
 		if err != nil {
 			return 0, nil, fmt.Errorf("failed to decode message type %d: %w", t, err)
 		}
 		return MessageType(t), payload, nil
+	case MessageTypePreferredSimulcastLevel:
+		fallthrough
+	case MessageTypeStopReceiving:
+		fallthrough
+	case MessageTypeSimulcastLevelChanged:
+		var payload string
+		err := dec.Decode(&payload)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to decode message type %d: %w", t, err)
+		}
+		return MessageType(t), payload, nil
+	case MessageTypeBandwidthEstimation:
+		var payload int
+		err := dec.Decode(&payload)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to decode message type %d: %w", t, err)
+		}
+		return MessageType(t), payload, nil
+	case MessageTypeSourceSimulcastLevel:
+		var payload MessageSourceSimulcastLevel
+		err := dec.Decode(&payload)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to decode message type %d: %w", t, err)
+		}
+		return MessageType(t), payload, nil
+	case MessageTypeTrackResubscribe:
+		var payload MessageTrackResubscribe
+		err := dec.Decode(&payload)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to decode message type %d: %w", t, err)
+		}
+		return MessageType(t), payload, nil
+	case MessageTypeICEServers:
+		var payload MessageICEServers
+		err := dec.Decode(&payload)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to decode message type %d: %w", t, err)
+		}
+		return MessageType(t), payload, nil
+	case MessageTypeMediaMap:
+		var payload MessageMediaMap
+		err := dec.Decode(&payload)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to decode message type %d: %w", t, err)
+		}
+		return MessageType(t), payload, nil
 	}
 
 	return 0, nil, fmt.Errorf("unexpected dc message type: %d", t)
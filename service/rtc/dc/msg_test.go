@@ -53,4 +53,134 @@ func TestEncodeMessage(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, sdp, decodedSDP)
 	})
+
+	t.Run("preferred simulcast level", func(t *testing.T) {
+		dcMsg, err := EncodeMessage(MessageTypePreferredSimulcastLevel, "l")
+		require.NoError(t, err)
+
+		mt, payload, err := DecodeMessage(dcMsg)
+		require.NoError(t, err)
+		require.Equal(t, MessageTypePreferredSimulcastLevel, mt)
+		require.Equal(t, "l", payload)
+	})
+
+	t.Run("audio plc hint", func(t *testing.T) {
+		dcMsg, err := EncodeMessage(MessageTypeAudioPLCHint, 0.25)
+		require.NoError(t, err)
+
+		mt, payload, err := DecodeMessage(dcMsg)
+		require.NoError(t, err)
+		require.Equal(t, MessageTypeAudioPLCHint, mt)
+		require.Equal(t, 0.25, payload)
+	})
+
+	t.Run("bandwidth estimation", func(t *testing.T) {
+		dcMsg, err := EncodeMessage(MessageTypeBandwidthEstimation, 1000000)
+		require.NoError(t, err)
+
+		mt, payload, err := DecodeMessage(dcMsg)
+		require.NoError(t, err)
+		require.Equal(t, MessageTypeBandwidthEstimation, mt)
+		require.Equal(t, 1000000, payload)
+	})
+
+	t.Run("source simulcast level", func(t *testing.T) {
+		msg := MessageSourceSimulcastLevel{
+			SessionID: "sessionID",
+			Level:     "h",
+		}
+		dcMsg, err := EncodeMessage(MessageTypeSourceSimulcastLevel, msg)
+		require.NoError(t, err)
+
+		mt, payload, err := DecodeMessage(dcMsg)
+		require.NoError(t, err)
+		require.Equal(t, MessageTypeSourceSimulcastLevel, mt)
+		require.Equal(t, msg, payload)
+	})
+
+	t.Run("track resubscribe", func(t *testing.T) {
+		msg := MessageTrackResubscribe{
+			SessionID: "sessionID",
+			TrackType: "screen",
+		}
+		dcMsg, err := EncodeMessage(MessageTypeTrackResubscribe, msg)
+		require.NoError(t, err)
+
+		mt, payload, err := DecodeMessage(dcMsg)
+		require.NoError(t, err)
+		require.Equal(t, MessageTypeTrackResubscribe, mt)
+		require.Equal(t, msg, payload)
+	})
+
+	t.Run("stop receiving", func(t *testing.T) {
+		dcMsg, err := EncodeMessage(MessageTypeStopReceiving, "sessionID")
+		require.NoError(t, err)
+
+		mt, payload, err := DecodeMessage(dcMsg)
+		require.NoError(t, err)
+		require.Equal(t, MessageTypeStopReceiving, mt)
+		require.Equal(t, "sessionID", payload)
+	})
+
+	t.Run("simulcast level changed", func(t *testing.T) {
+		dcMsg, err := EncodeMessage(MessageTypeSimulcastLevelChanged, "l")
+		require.NoError(t, err)
+
+		mt, payload, err := DecodeMessage(dcMsg)
+		require.NoError(t, err)
+		require.Equal(t, MessageTypeSimulcastLevelChanged, mt)
+		require.Equal(t, "l", payload)
+	})
+
+	t.Run("ice servers", func(t *testing.T) {
+		msg := MessageICEServers{
+			{
+				URLs: []string{"stun:stun.example.com:3478"},
+			},
+			{
+				URLs:       []string{"turn:turn.example.com:3478"},
+				Username:   "username",
+				Credential: "credential",
+			},
+		}
+		dcMsg, err := EncodeMessage(MessageTypeICEServers, msg)
+		require.NoError(t, err)
+
+		mt, payload, err := DecodeMessage(dcMsg)
+		require.NoError(t, err)
+		require.Equal(t, MessageTypeICEServers, mt)
+		require.Equal(t, msg, payload)
+	})
+
+	t.Run("media map", func(t *testing.T) {
+		msg := MessageMediaMap{
+			"1": {
+				TrackID:   "voice_sessionA_trackA",
+				TrackType: "voice",
+				SessionID: "sessionA",
+			},
+			"2": {
+				TrackID:   "screen_sessionB_trackB",
+				TrackType: "screen",
+				SessionID: "sessionB",
+			},
+		}
+		dcMsg, err := EncodeMessage(MessageTypeMediaMap, msg)
+		require.NoError(t, err)
+
+		mt, payload, err := DecodeMessage(dcMsg)
+		require.NoError(t, err)
+		require.Equal(t, MessageTypeMediaMap, mt)
+		require.Equal(t, msg, payload)
+	})
+
+	t.Run("empty media map", func(t *testing.T) {
+		dcMsg, err := EncodeMessage(MessageTypeMediaMap, MessageMediaMap{})
+		require.NoError(t, err)
+
+		mt, payload, err := DecodeMessage(dcMsg)
+		require.NoError(t, err)
+		require.Equal(t, MessageTypeMediaMap, mt)
+		require.Empty(t, payload)
+	})
 }
@@ -0,0 +1,96 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+// droppedMessagesLogIntervalDefault is the default minimum interval between
+// logs of messages dropped for the same channel and reason.
+const droppedMessagesLogIntervalDefault = 5 * time.Second
+
+type droppedMessagesKey struct {
+	channel string
+	reason  string
+}
+
+type droppedMessagesState struct {
+	loggedAt   time.Time
+	suppressed int
+}
+
+// droppedMessages accounts for the messages dropped because of full channels.
+// Every drop is counted through metrics, both per reason and as a full channel,
+// while logging is rate limited so that sustained drops don't end up flooding
+// the logs.
+type droppedMessages struct {
+	log      mlog.LoggerIFace
+	metrics  *serverMetrics
+	interval time.Duration
+	states   map[droppedMessagesKey]*droppedMessagesState
+
+	mut sync.Mutex
+}
+
+func newDroppedMessages(log mlog.LoggerIFace, metrics *serverMetrics, interval time.Duration) *droppedMessages {
+	if interval <= 0 {
+		interval = droppedMessagesLogIntervalDefault
+	}
+
+	return &droppedMessages{
+		log:      log,
+		metrics:  metrics,
+		interval: interval,
+		states:   map[droppedMessagesKey]*droppedMessagesState{},
+	}
+}
+
+// droppedMessage records a message for the given group dropped on the given
+// channel for the given reason. At most one log per channel and reason is
+// emitted each interval, including the number of drops that weren't logged in
+// the meantime. It's safe to call on a nil receiver, in which case nothing
+// happens.
+func (d *droppedMessages) droppedMessage(groupID, channel, reason string, fields ...mlog.Field) {
+	if d == nil {
+		return
+	}
+
+	d.metrics.IncRTCDroppedMessages(groupID, channel, reason)
+	d.metrics.IncRTCChannelFull(groupID, channel)
+
+	key := droppedMessagesKey{channel: channel, reason: reason}
+	now := time.Now()
+
+	d.mut.Lock()
+	state := d.states[key]
+	if state == nil {
+		state = &droppedMessagesState{}
+		d.states[key] = state
+	}
+	if !state.loggedAt.IsZero() && now.Sub(state.loggedAt) < d.interval {
+		state.suppressed++
+		d.mut.Unlock()
+		return
+	}
+	suppressed := state.suppressed
+	state.loggedAt = now
+	state.suppressed = 0
+	d.mut.Unlock()
+
+	fields = append(fields,
+		mlog.String("channel", channel),
+		mlog.String("reason", reason),
+		mlog.Int("suppressed", suppressed),
+	)
+	d.log.Error("dropped message: channel is full", fields...)
+}
+
+// droppedMessage records a message dropped on one of the server's channels.
+func (s *Server) droppedMessage(groupID, channel, reason string, fields ...mlog.Field) {
+	s.drops.droppedMessage(groupID, channel, reason, fields...)
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/perf"
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type syncBuffer struct {
+	buf bytes.Buffer
+	mut sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.buf.String()
+}
+
+func TestDroppedMessages(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	var buf syncBuffer
+	err = mlog.AddWriterTarget(log, &buf, true, mlog.LvlError)
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	metrics := perf.NewMetrics("rtcd", nil)
+	require.NotNil(t, metrics)
+
+	countLogs := func() int {
+		require.NoError(t, log.Flush())
+		return strings.Count(buf.String(), "dropped message")
+	}
+
+	t.Run("nil", func(t *testing.T) {
+		var d *droppedMessages
+		require.NotPanics(t, func() {
+			d.droppedMessage("groupID", "tracks", "voice_track")
+		})
+	})
+
+	t.Run("counted and rate limited", func(t *testing.T) {
+		d := newDroppedMessages(log, newServerMetrics(metrics), 200*time.Millisecond)
+
+		for i := 0; i < 10; i++ {
+			d.droppedMessage("groupID", "tracks", "voice_track")
+		}
+		require.Equal(t, 10.0, testutil.ToFloat64(metrics.RTCDroppedMessages.WithLabelValues("groupID", "tracks", "voice_track")))
+		require.Equal(t, 10.0, testutil.ToFloat64(metrics.RTCChannelFull.WithLabelValues("groupID", "tracks")))
+		require.Equal(t, 1, countLogs())
+
+		// Other channels and reasons are limited separately.
+		d.droppedMessage("groupID", "receive", "voice_track")
+		d.droppedMessage("groupID", "tracks", "screen_track")
+		require.Equal(t, 3, countLogs())
+
+		// Once the interval elapsed the next drop gets logged along with the
+		// number of suppressed ones.
+		time.Sleep(250 * time.Millisecond)
+		d.droppedMessage("groupID", "tracks", "voice_track")
+		require.Equal(t, 11.0, testutil.ToFloat64(metrics.RTCDroppedMessages.WithLabelValues("groupID", "tracks", "voice_track")))
+		require.Equal(t, 12.0, testutil.ToFloat64(metrics.RTCChannelFull.WithLabelValues("groupID", "tracks")))
+		require.Equal(t, 4, countLogs())
+		require.Contains(t, buf.String(), `"suppressed":9`)
+	})
+
+	t.Run("default interval", func(t *testing.T) {
+		d := newDroppedMessages(log, newServerMetrics(metrics), 0)
+		require.Equal(t, droppedMessagesLogIntervalDefault, d.interval)
+	})
+}
+
+func TestChannelMetrics(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	metrics := s.metrics.Metrics.(*perf.Metrics)
+
+	t.Run("full tracks channel", func(t *testing.T) {
+		// Nothing reads from the channel so it's always full.
+		us := &session{
+			cfg: SessionConfig{
+				GroupID:   random.NewID(),
+				SessionID: random.NewID(),
+			},
+			tracksCh: make(chan trackActionContext),
+		}
+		s.startICERestart(us)
+		defer us.stopICERestart()
+
+		require.Equal(t, 1.0, testutil.ToFloat64(metrics.RTCDroppedMessages.WithLabelValues(us.cfg.GroupID, "tracks", "ice_restart")))
+		require.Equal(t, 1.0, testutil.ToFloat64(metrics.RTCChannelFull.WithLabelValues(us.cfg.GroupID, "tracks")))
+	})
+
+	t.Run("receive channel depth", func(t *testing.T) {
+		s.receiveCh <- Message{}
+		require.Eventually(t, func() bool {
+			return testutil.ToFloat64(metrics.RTCChannelDepth.WithLabelValues("receive")) == 1
+		}, 5*time.Second, 50*time.Millisecond)
+
+		<-s.receiveCh
+		require.Eventually(t, func() bool {
+			return testutil.ToFloat64(metrics.RTCChannelDepth.WithLabelValues("receive")) == 0
+		}, 5*time.Second, 50*time.Millisecond)
+	})
+}
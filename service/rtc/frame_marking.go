@@ -0,0 +1,59 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"fmt"
+
+	"github.com/pion/rtp"
+)
+
+// videoPacket is a video packet to forward along with its frame marking
+// information, if available.
+type videoPacket struct {
+	*rtp.Packet
+	marking *frameMarking
+}
+
+// frameMarking holds the information carried by the frame marking RTP
+// header extension (draft-ietf-avtext-framemarking).
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|S|E|I|D|B| TID |      LID      |    TL0PICIDX  |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//
+// LID and TL0PICIDX are only present for scalable streams.
+type frameMarking struct {
+	// startOfFrame is set on the first packet of a frame.
+	startOfFrame bool
+	// endOfFrame is set on the last packet of a frame.
+	endOfFrame bool
+	// independent is set if the frame can be decoded independently of
+	// any other (i.e. it's a keyframe).
+	independent bool
+	// discardable is set if no other frame depends on this one.
+	discardable bool
+	// baseLayerSync is set if the frame only depends on the base temporal
+	// layer.
+	baseLayerSync bool
+	// temporalID is the temporal layer of the frame.
+	temporalID uint8
+}
+
+func parseFrameMarking(data []byte) (frameMarking, error) {
+	if len(data) != 1 && len(data) != 3 {
+		return frameMarking{}, fmt.Errorf("invalid frame marking length %d", len(data))
+	}
+
+	return frameMarking{
+		startOfFrame:  data[0]&0x80 != 0,
+		endOfFrame:    data[0]&0x40 != 0,
+		independent:   data[0]&0x20 != 0,
+		discardable:   data[0]&0x10 != 0,
+		baseLayerSync: data[0]&0x08 != 0,
+		temporalID:    data[0] & 0x07,
+	}, nil
+}
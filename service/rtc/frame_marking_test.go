@@ -0,0 +1,116 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFrameMarking(t *testing.T) {
+	t.Run("invalid", func(t *testing.T) {
+		_, err := parseFrameMarking(nil)
+		require.EqualError(t, err, "invalid frame marking length 0")
+
+		_, err = parseFrameMarking([]byte{0x80, 0x00})
+		require.EqualError(t, err, "invalid frame marking length 2")
+	})
+
+	t.Run("short form", func(t *testing.T) {
+		fm, err := parseFrameMarking([]byte{0xe0})
+		require.NoError(t, err)
+		require.Equal(t, frameMarking{
+			startOfFrame: true,
+			endOfFrame:   true,
+			independent:  true,
+		}, fm)
+	})
+
+	t.Run("long form", func(t *testing.T) {
+		fm, err := parseFrameMarking([]byte{0x5a, 0x01, 0x20})
+		require.NoError(t, err)
+		require.Equal(t, frameMarking{
+			endOfFrame:    true,
+			discardable:   true,
+			baseLayerSync: true,
+			temporalID:    2,
+		}, fm)
+	})
+
+	t.Run("keyframe detection", func(t *testing.T) {
+		const extID = 5
+
+		newPacket := func(t *testing.T, marking byte) *rtp.Packet {
+			t.Helper()
+			pkt := &rtp.Packet{
+				Header: rtp.Header{
+					Version: 2,
+				},
+				Payload: []byte{0x00},
+			}
+			err := pkt.SetExtension(extID, []byte{marking})
+			require.NoError(t, err)
+
+			// Going through the wire format as the forwarding loop would.
+			data, err := pkt.Marshal()
+			require.NoError(t, err)
+			var out rtp.Packet
+			err = out.Unmarshal(data)
+			require.NoError(t, err)
+			return &out
+		}
+
+		fm, err := parseFrameMarking(newPacket(t, 0xa0).GetExtension(extID))
+		require.NoError(t, err)
+		require.True(t, fm.independent)
+
+		fm, err = parseFrameMarking(newPacket(t, 0x90).GetExtension(extID))
+		require.NoError(t, err)
+		require.False(t, fm.independent)
+		require.True(t, fm.discardable)
+	})
+}
+
+func TestFrameDropperWithFrameMarking(t *testing.T) {
+	const clockRate = 90000
+	d := newFrameDropper(clockRate, 5, webrtc.MimeTypeVP8)
+
+	var seq uint16
+	var ts uint32
+	// pushFrame sends a single packet frame at 30fps and returns whether it
+	// was forwarded.
+	pushFrame := func(marking *frameMarking) bool {
+		seq++
+		ts += clockRate / 30
+		pkt := &rtp.Packet{
+			Header: rtp.Header{
+				SequenceNumber: seq,
+				Timestamp:      ts,
+				Marker:         true,
+			},
+		}
+		return !d.drop(pkt, marking, true)
+	}
+
+	// The first frame is always forwarded.
+	require.True(t, pushFrame(&frameMarking{independent: true}))
+
+	// Keyframes are never dropped.
+	require.True(t, pushFrame(&frameMarking{independent: true}))
+
+	// Frames that others depend on are never dropped either.
+	require.True(t, pushFrame(&frameMarking{}))
+
+	// Discardable frames are dropped to meet the target FPS.
+	require.False(t, pushFrame(&frameMarking{discardable: true}))
+
+	// Even if marked as discardable, keyframes are forwarded.
+	require.True(t, pushFrame(&frameMarking{independent: true, discardable: true}))
+
+	// Without any layer information frames are never dropped.
+	require.True(t, pushFrame(nil))
+}
@@ -4,17 +4,100 @@
 package rtc
 
 import (
+	"context"
+	"fmt"
 	"sync"
+
+	"golang.org/x/time/rate"
 )
 
+// groupSignalingQueueSize is the number of signaling messages that can be
+// queued for a rate limited group before they start getting dropped.
+const groupSignalingQueueSize = 256
+
 // group defines a collection of calls that belongs to the same group.
 type group struct {
 	id    string
 	calls map[string]*call
+	// msgLimiter rate limits inbound signaling messages for the group
+	// (ServerConfig.MaxGroupMessagesPerSecond). Nil if no limit is set.
+	msgLimiter *rate.Limiter
+	// signalingCh queues the group's signaling messages until the limiter
+	// allows them through. Only set along with msgLimiter.
+	signalingCh chan Message
+	stopCh      chan struct{}
+	doneCh      chan struct{}
+	stopOnce    sync.Once
 
 	mut sync.RWMutex
 }
 
+func newGroup(id string, msgsPerSecond int) *group {
+	g := &group{
+		id:    id,
+		calls: map[string]*call{},
+	}
+	if msgsPerSecond > 0 {
+		g.msgLimiter = rate.NewLimiter(rate.Limit(msgsPerSecond), msgsPerSecond)
+		g.signalingCh = make(chan Message, groupSignalingQueueSize)
+		g.stopCh = make(chan struct{})
+		g.doneCh = make(chan struct{})
+	}
+	return g
+}
+
+// queueSignaling queues a signaling message to be sent once the group's rate
+// limit allows it. It fails if the queue is full.
+func (g *group) queueSignaling(msg Message) error {
+	select {
+	case g.signalingCh <- msg:
+		return nil
+	default:
+		return fmt.Errorf("failed to send rtc message, group signaling queue is full")
+	}
+}
+
+// processSignaling passes the queued signaling messages to send, in order,
+// at the rate allowed by the group's limiter, until the group is stopped.
+func (g *group) processSignaling(send func(msg Message) error) {
+	defer close(g.doneCh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-g.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-g.signalingCh:
+			if err := g.msgLimiter.Wait(ctx); err != nil {
+				return
+			}
+			// Failures are accounted for by send.
+			_ = send(msg)
+		case <-g.stopCh:
+			return
+		}
+	}
+}
+
+// stop stops processing the group's signaling queue, waiting for it to be
+// done. It's safe to call multiple times.
+func (g *group) stop() {
+	if g.stopCh == nil {
+		return
+	}
+	g.stopOnce.Do(func() {
+		close(g.stopCh)
+	})
+	<-g.doneCh
+}
+
 func (g *group) getCall(callID string) *call {
 	g.mut.RLock()
 	defer g.mut.RUnlock()
@@ -26,3 +109,21 @@ func (s *Server) getGroup(groupID string) *group {
 	defer s.mut.RUnlock()
 	return s.groups[groupID]
 }
+
+// updateCallsCount applies delta to the number of active calls and reports
+// it.
+func (s *Server) updateCallsCount(delta int) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.callsCount += delta
+	s.metrics.SetRTCCallCount(s.callsCount)
+}
+
+// getCallByID returns the call with the given ID in the given group, if any.
+func (s *Server) getCallByID(groupID, callID string) *call {
+	g := s.getGroup(groupID)
+	if g == nil {
+		return nil
+	}
+	return g.getCall(callID)
+}
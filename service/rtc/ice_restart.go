@@ -0,0 +1,119 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+	"github.com/pion/webrtc/v4"
+)
+
+// iceRestartTimeoutDefault is the default time given to a session whose
+// connection failed to recover through an ICE restart before getting closed.
+const iceRestartTimeoutDefault = 5 * time.Second
+
+// startICERestart gives the session a chance to recover from a disconnection
+// (e.g. the client switching networks) by sending an ICE restart offer.
+func (s *Server) startICERestart(us *session) {
+	us.mut.Lock()
+	if us.iceRestarting {
+		us.mut.Unlock()
+		return
+	}
+	us.iceRestarting = true
+	us.mut.Unlock()
+
+	s.log.Debug("restarting ice", mlog.String("sessionID", us.cfg.SessionID))
+	s.metrics.IncRTCConnState("ice_restart")
+
+	select {
+	case us.tracksCh <- trackActionContext{action: trackActionICERestart}:
+	default:
+		s.metrics.IncRTCErrors(us.cfg.GroupID, "ice_restart")
+		s.droppedMessage(us.cfg.GroupID, "tracks", "ice_restart", mlog.String("sessionID", us.cfg.SessionID))
+	}
+}
+
+// startICERestartTimeout closes the session, whose connection failed while
+// restarting ICE, unless it recovers within the grace period
+// (ServerConfig.ICERestartTimeoutMs).
+func (s *Server) startICERestartTimeout(us *session) {
+	timeout := iceRestartTimeoutDefault
+	if s.cfg.ICERestartTimeoutMs > 0 {
+		timeout = time.Duration(s.cfg.ICERestartTimeoutMs) * time.Millisecond
+	}
+
+	us.mut.Lock()
+	defer us.mut.Unlock()
+	if us.iceRestartTimer != nil {
+		return
+	}
+	us.iceRestartTimer = time.AfterFunc(timeout, func() {
+		us.mut.Lock()
+		us.iceRestartTimer = nil
+		state := us.connState
+		us.mut.Unlock()
+
+		if state != webrtc.PeerConnectionStateFailed {
+			return
+		}
+
+		s.log.Debug("ice restart timed out", mlog.String("sessionID", us.cfg.SessionID))
+		if err := s.CloseSession(us.cfg.SessionID, CloseReasonFailed); err != nil {
+			s.log.Error("failed to close RTC session", mlog.Err(err), mlog.Any("sessionCfg", us.cfg))
+		}
+	})
+}
+
+// stopICERestart is called once the connection recovers, or is closed, to
+// cancel the ongoing ICE restart, if any.
+func (s *session) stopICERestart() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.iceRestarting = false
+	if s.iceRestartTimer != nil {
+		s.iceRestartTimer.Stop()
+		s.iceRestartTimer = nil
+	}
+}
+
+func (s *session) isRestartingICE() bool {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return s.iceRestarting
+}
+
+// restartICE sends an offer restarting ICE and waits for the answer.
+func (s *session) restartICE(sdpOutCh chan<- Message) error {
+	s.log.Debug("restartICE", mlog.String("sessionID", s.cfg.SessionID))
+
+	s.mut.Lock()
+	s.makingOffer = true
+	s.mut.Unlock()
+	defer func() {
+		s.mut.Lock()
+		s.makingOffer = false
+		s.mut.Unlock()
+	}()
+
+	if err := s.sendOffer(sdpOutCh, &webrtc.OfferOptions{ICERestart: true}); err != nil {
+		return fmt.Errorf("failed to send offer: %w", err)
+	}
+
+	answer, err := s.waitForAnswer()
+	if errors.Is(err, errSessionClosed) {
+		s.log.Debug("session closed during signaling", mlog.Any("sessionCfg", s.cfg))
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := s.setRemoteDescription(answer); err != nil {
+		return fmt.Errorf("failed to set remote description: %w", err)
+	}
+
+	return nil
+}
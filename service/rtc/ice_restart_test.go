@@ -0,0 +1,185 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+var iceUfragRE = regexp.MustCompile(`a=ice-ufrag:(\S+)`)
+
+func getICEUfrag(t *testing.T, desc *webrtc.SessionDescription) string {
+	t.Helper()
+	require.NotNil(t, desc)
+	m := iceUfragRE.FindStringSubmatch(desc.SDP)
+	require.Len(t, m, 2)
+	return m[1]
+}
+
+func TestICERestart(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.ICERestartTimeoutMs = 1000
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	initSession := setupTestPeers(t, s)
+
+	t.Run("transient disconnect", func(t *testing.T) {
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+
+		pc := initSession(cfg)
+		defer pc.Close()
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		require.Eventually(t, func() bool {
+			return pc.ConnectionState() == webrtc.PeerConnectionStateConnected
+		}, 10*time.Second, 50*time.Millisecond)
+
+		us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+		require.NotNil(t, us)
+
+		// The server's ICE credentials change as part of the restart.
+		ufrag := getICEUfrag(t, pc.RemoteDescription())
+
+		s.handleConnectionStateChange(us, webrtc.PeerConnectionStateDisconnected)
+		require.True(t, us.isRestartingICE())
+
+		require.Eventually(t, func() bool {
+			return pc.SignalingState() == webrtc.SignalingStateStable &&
+				getICEUfrag(t, pc.RemoteDescription()) != ufrag
+		}, 5*time.Second, 50*time.Millisecond)
+
+		s.handleConnectionStateChange(us, webrtc.PeerConnectionStateConnected)
+		require.False(t, us.isRestartingICE())
+
+		// The session is kept past the grace period.
+		time.Sleep(1500 * time.Millisecond)
+		require.NotNil(t, s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID))
+	})
+
+	t.Run("fixed credentials", func(t *testing.T) {
+		s.cfg.ICEUfragLength = 16
+		defer func() {
+			s.cfg.ICEUfragLength = 0
+		}()
+
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+
+		pc := initSession(cfg)
+		defer pc.Close()
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		require.Eventually(t, func() bool {
+			return pc.ConnectionState() == webrtc.PeerConnectionStateConnected
+		}, 10*time.Second, 50*time.Millisecond)
+
+		us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+		require.NotNil(t, us)
+		ufrag := getICEUfrag(t, pc.RemoteDescription())
+
+		// Restarting with the same credentials is left to the client.
+		s.handleConnectionStateChange(us, webrtc.PeerConnectionStateDisconnected)
+		require.True(t, us.isRestartingICE())
+		time.Sleep(500 * time.Millisecond)
+		require.Equal(t, webrtc.SignalingStateStable, pc.SignalingState())
+		require.Equal(t, ufrag, getICEUfrag(t, pc.RemoteDescription()))
+
+		s.handleConnectionStateChange(us, webrtc.PeerConnectionStateConnected)
+		require.False(t, us.isRestartingICE())
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+
+		closedCh := make(chan CloseReason, 1)
+		err := s.InitSession(cfg, func(reason CloseReason) error {
+			closedCh <- reason
+			return nil
+		})
+		require.NoError(t, err)
+
+		us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+		require.NotNil(t, us)
+
+		s.handleConnectionStateChange(us, webrtc.PeerConnectionStateDisconnected)
+
+		// The grace period starts once the connection fails.
+		time.Sleep(1500 * time.Millisecond)
+		select {
+		case <-closedCh:
+			require.FailNow(t, "session should not be closed")
+		default:
+		}
+
+		start := time.Now()
+		s.handleConnectionStateChange(us, webrtc.PeerConnectionStateFailed)
+
+		select {
+		case reason := <-closedCh:
+			require.Equal(t, CloseReasonFailed, reason)
+			require.GreaterOrEqual(t, time.Since(start), time.Second)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for session to close")
+		}
+	})
+
+	t.Run("failure without disconnect", func(t *testing.T) {
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+
+		closedCh := make(chan CloseReason, 1)
+		err := s.InitSession(cfg, func(reason CloseReason) error {
+			closedCh <- reason
+			return nil
+		})
+		require.NoError(t, err)
+
+		us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+		require.NotNil(t, us)
+
+		s.handleConnectionStateChange(us, webrtc.PeerConnectionStateFailed)
+
+		select {
+		case reason := <-closedCh:
+			require.Equal(t, CloseReasonFailed, reason)
+		default:
+			require.FailNow(t, "session should be closed")
+		}
+	})
+}
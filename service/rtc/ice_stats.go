@@ -0,0 +1,129 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"errors"
+
+	"github.com/pion/webrtc/v4"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionICEStats holds statistics about the ICE connectivity checks
+// performed for a session.
+type SessionICEStats struct {
+	SessionID string `json:"sessionID"`
+	// ICEState is the current ICE connection state.
+	ICEState string `json:"iceState"`
+	// CandidatePairs is the number of candidate pairs formed so far.
+	CandidatePairs int `json:"candidatePairs"`
+	// Connectivity check counters, summed across all candidate pairs.
+	// Depending on the ICE library version some of these may not be
+	// populated.
+	RequestsSent      uint64 `json:"requestsSent"`
+	RequestsReceived  uint64 `json:"requestsReceived"`
+	ResponsesSent     uint64 `json:"responsesSent"`
+	ResponsesReceived uint64 `json:"responsesReceived"`
+	// NominatedPair is the candidate pair selected for media. Nil if no pair
+	// has been nominated yet.
+	NominatedPair *ICECandidatePairStats `json:"nominatedPair,omitempty"`
+	// ConnectionTimeMs is the time it took the session to connect, measured
+	// from its initialization. Zero if it hasn't connected yet.
+	ConnectionTimeMs int64 `json:"connectionTimeMs"`
+}
+
+// ICECandidatePairStats describes a local/remote candidate pair.
+type ICECandidatePairStats struct {
+	Local  ICECandidateStats `json:"local"`
+	Remote ICECandidateStats `json:"remote"`
+	// CurrentRoundTripTime is the latest round trip time measured on the
+	// pair, in seconds.
+	CurrentRoundTripTime float64 `json:"currentRoundTripTime"`
+}
+
+// ICECandidateStats describes an ICE candidate.
+type ICECandidateStats struct {
+	Type     string `json:"type"`
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Port     int32  `json:"port"`
+}
+
+// GetSessionICEStats returns the ICE connectivity stats for the given
+// session.
+func (s *Server) GetSessionICEStats(sessionID string) (SessionICEStats, error) {
+	stats := SessionICEStats{
+		SessionID: sessionID,
+	}
+
+	s.mut.RLock()
+	cfg, ok := s.sessions[sessionID]
+	s.mut.RUnlock()
+	if !ok {
+		return stats, ErrSessionNotFound
+	}
+
+	group := s.getGroup(cfg.GroupID)
+	if group == nil {
+		return stats, ErrSessionNotFound
+	}
+	call := group.getCall(cfg.CallID)
+	if call == nil {
+		return stats, ErrSessionNotFound
+	}
+	us := call.getSession(sessionID)
+	if us == nil {
+		return stats, ErrSessionNotFound
+	}
+
+	stats.ICEState = us.rtcConn.ICEConnectionState().String()
+
+	us.mut.RLock()
+	if !us.connectedAt.IsZero() {
+		stats.ConnectionTimeMs = us.connectedAt.Sub(us.createdAt).Milliseconds()
+	}
+	us.mut.RUnlock()
+
+	report := us.rtcConn.GetStats()
+
+	candidates := map[string]webrtc.ICECandidateStats{}
+	for _, st := range report {
+		if cs, ok := st.(webrtc.ICECandidateStats); ok {
+			candidates[cs.ID] = cs
+		}
+	}
+
+	for _, st := range report {
+		ps, ok := st.(webrtc.ICECandidatePairStats)
+		if !ok {
+			continue
+		}
+
+		stats.CandidatePairs++
+		stats.RequestsSent += ps.RequestsSent
+		stats.RequestsReceived += ps.RequestsReceived
+		stats.ResponsesSent += ps.ResponsesSent
+		stats.ResponsesReceived += ps.ResponsesReceived
+
+		if ps.Nominated && stats.NominatedPair == nil {
+			stats.NominatedPair = &ICECandidatePairStats{
+				Local:                newICECandidateStats(candidates[ps.LocalCandidateID]),
+				Remote:               newICECandidateStats(candidates[ps.RemoteCandidateID]),
+				CurrentRoundTripTime: ps.CurrentRoundTripTime,
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+func newICECandidateStats(cs webrtc.ICECandidateStats) ICECandidateStats {
+	return ICECandidateStats{
+		Type:     cs.CandidateType.String(),
+		Protocol: cs.Protocol,
+		Address:  cs.IP,
+		Port:     cs.Port,
+	}
+}
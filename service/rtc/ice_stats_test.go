@@ -0,0 +1,73 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSessionICEStats(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	t.Run("session not found", func(t *testing.T) {
+		_, err := s.GetSessionICEStats(random.NewID())
+		require.ErrorIs(t, err, ErrSessionNotFound)
+	})
+
+	t.Run("connected session", func(t *testing.T) {
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+
+		receiveCh := make(chan Message, 50)
+		go func() {
+			for msg := range s.ReceiveCh() {
+				receiveCh <- msg
+			}
+		}()
+
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		stats, err := s.GetSessionICEStats(cfg.SessionID)
+		require.NoError(t, err)
+		require.Equal(t, cfg.SessionID, stats.SessionID)
+		require.Zero(t, stats.CandidatePairs)
+		require.Nil(t, stats.NominatedPair)
+		require.Zero(t, stats.ConnectionTimeMs)
+
+		connectSession(t, cfg, s, receiveCh)
+
+		require.Eventually(t, func() bool {
+			stats, err = s.GetSessionICEStats(cfg.SessionID)
+			require.NoError(t, err)
+			return stats.NominatedPair != nil && stats.ConnectionTimeMs > 0
+		}, 5*time.Second, 50*time.Millisecond)
+
+		require.Equal(t, webrtc.ICEConnectionStateConnected.String(), stats.ICEState)
+		require.NotZero(t, stats.CandidatePairs)
+		require.NotZero(t, stats.ResponsesReceived)
+		require.NotEmpty(t, stats.NominatedPair.Local.Address)
+		require.NotZero(t, stats.NominatedPair.Local.Port)
+		require.NotEmpty(t, stats.NominatedPair.Remote.Address)
+		require.NotZero(t, stats.NominatedPair.Remote.Port)
+	})
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+
+	"github.com/mattermost/rtcd/service/rtc/dc"
+)
+
+// getMediaMap returns the media IDs (MIDs) of the transceivers currently
+// sending tracks to the session mapped to the tracks themselves. Transceivers
+// that have yet to be negotiated or that aren't sending anything are left out.
+func (s *session) getMediaMap() dc.MessageMediaMap {
+	mediaMap := dc.MessageMediaMap{}
+	for _, t := range s.rtcConn.GetTransceivers() {
+		mid := t.Mid()
+		sender := t.Sender()
+		if mid == "" || sender == nil || sender.Track() == nil {
+			continue
+		}
+
+		trackID := sender.Track().ID()
+		tt, sessionID, err := parseTrackID(trackID)
+		if err != nil {
+			s.log.Warn("failed to parse track ID", mlog.Err(err), mlog.String("trackID", trackID), mlog.String("sessionID", s.cfg.SessionID))
+			continue
+		}
+
+		mediaMap[mid] = dc.MessageMediaMapTrack{
+			TrackID:   trackID,
+			TrackType: string(tt),
+			SessionID: sessionID,
+		}
+	}
+	return mediaMap
+}
+
+// sendMediaMap sends the session's current media map to the client through
+// the data channel.
+func (s *Server) sendMediaMap(us *session) {
+	mediaMap := us.getMediaMap()
+
+	// Only the most recent map is worth sending so we replace any that hasn't
+	// been delivered yet (e.g. data channel not open).
+	select {
+	case <-us.dcMediaMapCh:
+	default:
+	}
+	select {
+	case us.dcMediaMapCh <- mediaMap:
+	default:
+		s.droppedMessage(us.cfg.GroupID, "dc_media_map", "media_map", mlog.String("sessionID", us.cfg.SessionID))
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc/dc"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMediaMap(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+	senderCfg := SessionConfig{
+		GroupID:   groupID,
+		CallID:    callID,
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+	receiverCfg := SessionConfig{
+		GroupID:   groupID,
+		CallID:    callID,
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+
+	initSession := setupTestPeers(t, s)
+
+	voiceTrack, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, "voice", random.NewID())
+	require.NoError(t, err)
+	senderPC := initSession(senderCfg, voiceTrack)
+	defer senderPC.Close()
+	defer func() {
+		err := s.CloseSession(senderCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	err = s.Send(Message{
+		GroupID:   senderCfg.GroupID,
+		CallID:    senderCfg.CallID,
+		UserID:    senderCfg.UserID,
+		SessionID: senderCfg.SessionID,
+		Type:      UnmuteMessage,
+	})
+	require.NoError(t, err)
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		var seq uint16
+		for {
+			select {
+			case <-ticker.C:
+				seq++
+				_ = voiceTrack.WriteRTP(&rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						SequenceNumber: seq,
+						Timestamp:      uint32(seq) * 960,
+					},
+					Payload: []byte{0x08, 0x01, 0x02},
+				})
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(stopCh)
+		<-doneCh
+	}()
+
+	receiverPC := initSession(receiverCfg)
+	defer receiverPC.Close()
+	defer func() {
+		err := s.CloseSession(receiverCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	us := s.getGroup(groupID).getCall(callID).getSession(receiverCfg.SessionID)
+	require.NotNil(t, us)
+
+	// The map should include the sender's voice track once negotiated.
+	var mid string
+	var entry dc.MessageMediaMapTrack
+	require.Eventually(t, func() bool {
+		for m, track := range us.getMediaMap() {
+			if track.SessionID == senderCfg.SessionID && track.TrackType == string(trackTypeVoice) {
+				mid, entry = m, track
+				return true
+			}
+		}
+		return false
+	}, 10*time.Second, 50*time.Millisecond)
+
+	// The MID should identify the same track on the receiving side.
+	require.Eventually(t, func() bool {
+		for _, tr := range receiverPC.GetTransceivers() {
+			if tr.Mid() != mid {
+				continue
+			}
+			track := tr.Receiver().Track()
+			return track != nil && track.ID() == entry.TrackID
+		}
+		return false
+	}, 10*time.Second, 50*time.Millisecond)
+
+	// The sender isn't receiving anything.
+	senderSession := s.getGroup(groupID).getCall(callID).getSession(senderCfg.SessionID)
+	require.NotNil(t, senderSession)
+	require.Empty(t, senderSession.getMediaMap())
+}
@@ -17,3 +17,108 @@ type Metrics interface {
 	ObserveRTCClientRTT(groupID string, val float64)
 	ObserveRTCClientJitter(groupID string, val float64)
 }
+
+// ExtendedMetrics can optionally be implemented by the Metrics given to the
+// server to collect additional metrics. These are simply not collected
+// otherwise, so that existing implementations keep working.
+type ExtendedMetrics interface {
+	SetRTCCallCount(count int)
+	SetRTCGroupCount(count int)
+	IncRTCSessionInitsQueued()
+	DecRTCSessionInitsQueued()
+	ObserveRTCSignalingRTT(groupID string, val float64)
+	IncRTCCallDrains()
+	IncRTCPeerConnRetries(groupID string)
+	AddRTCRecordingBytes(groupID string, n int)
+	IncRTCDroppedMessages(groupID, channel, reason string)
+	AddRTCCoalescedOffers(groupID string, n int)
+	IncRTCChannelFull(groupID, channel string)
+	SetRTCChannelDepth(channel string, depth int)
+}
+
+// serverMetrics wraps the Metrics given to the server, forwarding the
+// ExtendedMetrics calls only if implemented.
+type serverMetrics struct {
+	Metrics
+	ext ExtendedMetrics
+}
+
+func newServerMetrics(metrics Metrics) *serverMetrics {
+	ext, _ := metrics.(ExtendedMetrics)
+	return &serverMetrics{
+		Metrics: metrics,
+		ext:     ext,
+	}
+}
+
+func (m *serverMetrics) SetRTCCallCount(count int) {
+	if m.ext != nil {
+		m.ext.SetRTCCallCount(count)
+	}
+}
+
+func (m *serverMetrics) SetRTCGroupCount(count int) {
+	if m.ext != nil {
+		m.ext.SetRTCGroupCount(count)
+	}
+}
+
+func (m *serverMetrics) IncRTCSessionInitsQueued() {
+	if m.ext != nil {
+		m.ext.IncRTCSessionInitsQueued()
+	}
+}
+
+func (m *serverMetrics) DecRTCSessionInitsQueued() {
+	if m.ext != nil {
+		m.ext.DecRTCSessionInitsQueued()
+	}
+}
+
+func (m *serverMetrics) ObserveRTCSignalingRTT(groupID string, val float64) {
+	if m.ext != nil {
+		m.ext.ObserveRTCSignalingRTT(groupID, val)
+	}
+}
+
+func (m *serverMetrics) IncRTCCallDrains() {
+	if m.ext != nil {
+		m.ext.IncRTCCallDrains()
+	}
+}
+
+func (m *serverMetrics) IncRTCPeerConnRetries(groupID string) {
+	if m.ext != nil {
+		m.ext.IncRTCPeerConnRetries(groupID)
+	}
+}
+
+func (m *serverMetrics) AddRTCRecordingBytes(groupID string, n int) {
+	if m.ext != nil {
+		m.ext.AddRTCRecordingBytes(groupID, n)
+	}
+}
+
+func (m *serverMetrics) IncRTCDroppedMessages(groupID, channel, reason string) {
+	if m.ext != nil {
+		m.ext.IncRTCDroppedMessages(groupID, channel, reason)
+	}
+}
+
+func (m *serverMetrics) AddRTCCoalescedOffers(groupID string, n int) {
+	if m.ext != nil {
+		m.ext.AddRTCCoalescedOffers(groupID, n)
+	}
+}
+
+func (m *serverMetrics) IncRTCChannelFull(groupID, channel string) {
+	if m.ext != nil {
+		m.ext.IncRTCChannelFull(groupID, channel)
+	}
+}
+
+func (m *serverMetrics) SetRTCChannelDepth(channel string, depth int) {
+	if m.ext != nil {
+		m.ext.SetRTCChannelDepth(channel, depth)
+	}
+}
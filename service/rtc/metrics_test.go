@@ -0,0 +1,61 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"testing"
+
+	"github.com/mattermost/rtcd/service/perf"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerMetrics(t *testing.T) {
+	t.Run("extended", func(t *testing.T) {
+		metrics := perf.NewMetrics("rtcd", nil)
+		m := newServerMetrics(metrics)
+		require.NotNil(t, m.ext)
+
+		m.IncRTCCallDrains()
+		require.Equal(t, float64(1), testutil.ToFloat64(metrics.RTCCallDrains))
+	})
+
+	t.Run("base only", func(t *testing.T) {
+		metrics := perf.NewMetrics("rtcd", nil)
+		// Only exposing the methods of the Metrics interface.
+		base := struct{ Metrics }{metrics}
+		m := newServerMetrics(base)
+		require.Nil(t, m.ext)
+
+		require.NotPanics(t, func() {
+			m.IncRTCCallDrains()
+			m.SetRTCChannelDepth("send", 1)
+		})
+		require.Zero(t, testutil.ToFloat64(metrics.RTCCallDrains))
+
+		m.IncRTCSessions("groupID")
+		require.Equal(t, float64(1), testutil.ToFloat64(metrics.RTCSessions.WithLabelValues("groupID")))
+	})
+
+	t.Run("server", func(t *testing.T) {
+		log, err := mlog.NewLogger()
+		require.NoError(t, err)
+		defer func() {
+			err := log.Shutdown()
+			require.NoError(t, err)
+		}()
+
+		cfg := ServerConfig{
+			ICEPortUDP:      30433,
+			ICEPortTCP:      30433,
+			UDPSocketsCount: 1,
+		}
+		s, err := NewServer(cfg, log, struct{ Metrics }{perf.NewMetrics("rtcd", nil)})
+		require.NoError(t, err)
+		require.NotNil(t, s)
+	})
+}
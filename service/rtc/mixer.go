@@ -0,0 +1,350 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtp"
+	"golang.org/x/time/rate"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+const (
+	// audioMixerFrameDuration is the duration of a single mixed frame.
+	audioMixerFrameDuration = 20 * time.Millisecond
+	// audioMixerFrameSize is the number of (mono) samples in a single frame.
+	audioMixerFrameSize = rtpAudioClockRate / 1000 * int(audioMixerFrameDuration/time.Millisecond)
+	// audioMixerMaxQueuedFrames is the maximum number of decoded frames kept
+	// for each source. Older frames are dropped to avoid accumulating latency.
+	audioMixerMaxQueuedFrames = 5
+	audioMixerInChSize        = 256
+	audioMixerMaxPacketSize   = 1500
+	// audioMixerDropLogInterval is the minimum interval between logs about
+	// packets dropped because the mixer is falling behind.
+	audioMixerDropLogInterval = 5 * time.Second
+	rtpAudioClockRate         = 48000
+	rtpAudioPayloadType       = 111
+)
+
+var ErrAudioMixerActive = errors.New("audio mixer already active")
+
+// AudioDecoder decodes voice packet payloads into 48kHz mono PCM samples.
+type AudioDecoder interface {
+	// Decode decodes data into pcm, returning the number of samples decoded.
+	Decode(data []byte, pcm []int16) (int, error)
+}
+
+// AudioEncoder encodes 48kHz mono PCM samples into a packet payload.
+type AudioEncoder interface {
+	// Encode encodes pcm into data, returning the number of bytes written.
+	Encode(pcm []int16, data []byte) (int, error)
+}
+
+// AudioMixerSink is where mixed audio packets get written to.
+// As an example, the media/oggwriter package from pion can be used to write
+// to an Ogg file, or packets can be marshaled and sent over a UDP connection.
+// Packets should not be retained after WriteRTP returns.
+// If the sink also implements io.Closer, it's closed once the mixer stops,
+// including when that's because the call ended.
+type AudioMixerSink interface {
+	WriteRTP(packet *rtp.Packet) error
+}
+
+// AudioMixerConfig holds the configuration for a call's audio mixer.
+//
+// Since no Opus implementation ships with rtcd (doing so would require cgo),
+// the codecs need to be provided by the caller.
+type AudioMixerConfig struct {
+	// NewDecoder is called to create a decoder for each voice track being
+	// mixed, as decoders are stateful.
+	NewDecoder func() (AudioDecoder, error)
+	// Encoder is used to encode the mixed output.
+	Encoder AudioEncoder
+	// Sink is where the encoded mixed output is written to.
+	Sink AudioMixerSink
+}
+
+func (c AudioMixerConfig) IsValid() error {
+	if c.NewDecoder == nil {
+		return fmt.Errorf("invalid NewDecoder value: should not be nil")
+	}
+	if c.Encoder == nil {
+		return fmt.Errorf("invalid Encoder value: should not be nil")
+	}
+	if c.Sink == nil {
+		return fmt.Errorf("invalid Sink value: should not be nil")
+	}
+	return nil
+}
+
+type audioMixerPacket struct {
+	sessionID string
+	payload   []byte
+}
+
+type audioMixerSource struct {
+	decoder AudioDecoder
+	frames  [][]int16
+}
+
+// audioMixer combines all the voice tracks in a call into a single stream.
+// Incoming packets are tapped from the voice forwarding path, decoded and
+// summed every audioMixerFrameDuration.
+type audioMixer struct {
+	cfg     AudioMixerConfig
+	log     mlog.LoggerIFace
+	sources map[string]*audioMixerSource
+	// removed keeps track of the sessions that left the call so that late
+	// packets don't add them back.
+	removed map[string]bool
+	inCh    chan audioMixerPacket
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+	stopped bool
+
+	seqNo     uint16
+	timestamp uint32
+	ssrc      uint32
+
+	droppedPackets atomic.Int64
+	dropLimiter    *rate.Limiter
+
+	mut sync.Mutex
+}
+
+func newAudioMixer(cfg AudioMixerConfig, log mlog.LoggerIFace) (*audioMixer, error) {
+	if err := cfg.IsValid(); err != nil {
+		return nil, err
+	}
+
+	return &audioMixer{
+		cfg:       cfg,
+		log:       log,
+		sources:   map[string]*audioMixerSource{},
+		removed:   map[string]bool{},
+		inCh:      make(chan audioMixerPacket, audioMixerInChSize),
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+		seqNo:     uint16(rand.Uint32()),
+		timestamp: rand.Uint32(),
+		ssrc:      rand.Uint32(),
+
+		dropLimiter: rate.NewLimiter(rate.Every(audioMixerDropLogInterval), 1),
+	}, nil
+}
+
+func (m *audioMixer) start() {
+	go m.run()
+}
+
+// stop stops the mixer, waiting for it to be done. It's safe to call
+// multiple times.
+func (m *audioMixer) stop() {
+	m.mut.Lock()
+	if m.stopped {
+		m.mut.Unlock()
+		<-m.doneCh
+		return
+	}
+	m.stopped = true
+	close(m.stopCh)
+	m.mut.Unlock()
+	<-m.doneCh
+}
+
+// push queues a voice packet for mixing. It's meant to be called from the
+// forwarding path, so it never blocks.
+func (m *audioMixer) push(sessionID string, packet *rtp.Packet) {
+	if len(packet.Payload) == 0 {
+		return
+	}
+
+	// The packet gets forwarded afterwards so we need our own copy.
+	payload := make([]byte, len(packet.Payload))
+	copy(payload, packet.Payload)
+
+	select {
+	case m.inCh <- audioMixerPacket{sessionID: sessionID, payload: payload}:
+	default:
+		// This runs for every voice packet so logging is rate limited.
+		dropped := m.droppedPackets.Add(1)
+		if m.dropLimiter.Allow() {
+			m.droppedPackets.Add(-dropped)
+			m.log.Warn("audio mixer channel is full, dropping packets",
+				mlog.String("sessionID", sessionID), mlog.Int("dropped", dropped))
+		}
+	}
+}
+
+// removeSource removes the given session from the mix. Any pending frame is
+// discarded and packets still queued for the session are ignored.
+func (m *audioMixer) removeSource(sessionID string) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	delete(m.sources, sessionID)
+	m.removed[sessionID] = true
+}
+
+func (m *audioMixer) run() {
+	defer close(m.doneCh)
+	defer func() {
+		if closer, ok := m.cfg.Sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				m.log.Error("failed to close audio mixer sink", mlog.Err(err))
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(audioMixerFrameDuration)
+	defer ticker.Stop()
+
+	mixed := make([]int32, audioMixerFrameSize)
+	pcm := make([]int16, audioMixerFrameSize)
+	data := make([]byte, audioMixerMaxPacketSize)
+
+	for {
+		select {
+		case pkt := <-m.inCh:
+			if err := m.decode(pkt); err != nil {
+				m.log.Error("failed to decode audio packet", mlog.Err(err), mlog.String("sessionID", pkt.sessionID))
+			}
+		case <-ticker.C:
+			if err := m.mix(mixed, pcm, data); err != nil {
+				m.log.Error("failed to mix audio", mlog.Err(err))
+			}
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+func (m *audioMixer) decode(pkt audioMixerPacket) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.removed[pkt.sessionID] {
+		return nil
+	}
+
+	src := m.sources[pkt.sessionID]
+	if src == nil {
+		decoder, err := m.cfg.NewDecoder()
+		if err != nil {
+			return fmt.Errorf("failed to create decoder: %w", err)
+		}
+		src = &audioMixerSource{decoder: decoder}
+		m.sources[pkt.sessionID] = src
+	}
+
+	frame := make([]int16, audioMixerFrameSize)
+	n, err := src.decoder.Decode(pkt.payload, frame)
+	if err != nil {
+		return err
+	}
+
+	if len(src.frames) == audioMixerMaxQueuedFrames {
+		src.frames = src.frames[1:]
+	}
+	src.frames = append(src.frames, frame[:n])
+
+	return nil
+}
+
+func (m *audioMixer) mix(mixed []int32, pcm []int16, data []byte) error {
+	m.mut.Lock()
+	var hasAudio bool
+	clear(mixed)
+	for _, src := range m.sources {
+		if len(src.frames) == 0 {
+			continue
+		}
+		hasAudio = true
+		for i, sample := range src.frames[0] {
+			mixed[i] += int32(sample)
+		}
+		src.frames = src.frames[1:]
+	}
+	m.mut.Unlock()
+
+	// Timestamps need to advance even when nobody is speaking so that the
+	// output keeps its timing.
+	defer func() { m.timestamp += uint32(audioMixerFrameSize) }()
+
+	if !hasAudio {
+		return nil
+	}
+
+	for i, sample := range mixed {
+		pcm[i] = int16(min(max(sample, math.MinInt16), math.MaxInt16))
+	}
+
+	n, err := m.cfg.Encoder.Encode(pcm, data)
+	if err != nil {
+		return fmt.Errorf("failed to encode: %w", err)
+	}
+
+	packet := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    rtpAudioPayloadType,
+			SequenceNumber: m.seqNo,
+			Timestamp:      m.timestamp,
+			SSRC:           m.ssrc,
+		},
+		Payload: data[:n],
+	}
+	m.seqNo++
+
+	if err := m.cfg.Sink.WriteRTP(packet); err != nil {
+		return fmt.Errorf("failed to write packet: %w", err)
+	}
+
+	return nil
+}
+
+// StartCallAudioMixer starts mixing all the voice tracks in the given call
+// into a single stream written to the configured sink. Mixing is CPU
+// intensive so it should only be enabled on the calls that need it.
+// The mixer is automatically stopped when the call ends.
+func (s *Server) StartCallAudioMixer(groupID, callID string, cfg AudioMixerConfig) error {
+	c := s.getCallByID(groupID, callID)
+	if c == nil {
+		return ErrCallNotFound
+	}
+
+	m, err := newAudioMixer(cfg, s.log.With(mlog.String("callID", callID)))
+	if err != nil {
+		return fmt.Errorf("failed to create audio mixer: %w", err)
+	}
+
+	if !c.audioMixer.CompareAndSwap(nil, m) {
+		return ErrAudioMixerActive
+	}
+	m.start()
+
+	return nil
+}
+
+// StopCallAudioMixer stops the audio mixer for the given call, if any.
+func (s *Server) StopCallAudioMixer(groupID, callID string) error {
+	c := s.getCallByID(groupID, callID)
+	if c == nil {
+		return ErrCallNotFound
+	}
+
+	if m := c.audioMixer.Swap(nil); m != nil {
+		m.stop()
+	}
+
+	return nil
+}
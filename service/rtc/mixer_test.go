@@ -0,0 +1,224 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+// testAudioCodec fills frames with a constant sample value taken from the
+// payload and encodes only the first sample of a frame.
+type testAudioCodec struct{}
+
+func (testAudioCodec) Decode(data []byte, pcm []int16) (int, error) {
+	if len(data) < 2 {
+		return 0, fmt.Errorf("short payload")
+	}
+	for i := range pcm {
+		pcm[i] = int16(binary.BigEndian.Uint16(data))
+	}
+	return len(pcm), nil
+}
+
+func (testAudioCodec) Encode(pcm []int16, data []byte) (int, error) {
+	binary.BigEndian.PutUint16(data, uint16(pcm[0]))
+	return 2, nil
+}
+
+type testAudioSink struct {
+	samples []int16
+	mut     sync.Mutex
+}
+
+func (s *testAudioSink) WriteRTP(packet *rtp.Packet) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.samples = append(s.samples, int16(binary.BigEndian.Uint16(packet.Payload)))
+	return nil
+}
+
+func (s *testAudioSink) hasSample(sample int16) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	for _, s := range s.samples {
+		if s == sample {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestAudioMixerConfig(sink AudioMixerSink) AudioMixerConfig {
+	return AudioMixerConfig{
+		NewDecoder: func() (AudioDecoder, error) {
+			return testAudioCodec{}, nil
+		},
+		Encoder: testAudioCodec{},
+		Sink:    sink,
+	}
+}
+
+func newTestVoicePacket(sample int16) *rtp.Packet {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, uint16(sample))
+	return &rtp.Packet{Payload: payload}
+}
+
+func TestAudioMixer(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	t.Run("invalid config", func(t *testing.T) {
+		m, err := newAudioMixer(AudioMixerConfig{}, log)
+		require.EqualError(t, err, "invalid NewDecoder value: should not be nil")
+		require.Nil(t, m)
+	})
+
+	t.Run("multiple speakers", func(t *testing.T) {
+		sink := &testAudioSink{}
+		m, err := newAudioMixer(newTestAudioMixerConfig(sink), log)
+		require.NoError(t, err)
+		m.start()
+		defer m.stop()
+
+		stopCh := make(chan struct{})
+		var wg sync.WaitGroup
+		for sessionID, sample := range map[string]int16{"sessionA": 100, "sessionB": 200, "sessionC": 300} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ticker := time.NewTicker(audioMixerFrameDuration)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						m.push(sessionID, newTestVoicePacket(sample))
+					case <-stopCh:
+						return
+					}
+				}
+			}()
+		}
+		defer func() {
+			close(stopCh)
+			wg.Wait()
+		}()
+
+		require.Eventually(t, func() bool {
+			return sink.hasSample(600)
+		}, 2*time.Second, 20*time.Millisecond)
+	})
+
+	t.Run("clipping", func(t *testing.T) {
+		sink := &testAudioSink{}
+		m, err := newAudioMixer(newTestAudioMixerConfig(sink), log)
+		require.NoError(t, err)
+
+		mixed := make([]int32, audioMixerFrameSize)
+		pcm := make([]int16, audioMixerFrameSize)
+		data := make([]byte, audioMixerMaxPacketSize)
+
+		require.NoError(t, m.decode(audioMixerPacket{sessionID: "sessionA", payload: newTestVoicePacket(30000).Payload}))
+		require.NoError(t, m.decode(audioMixerPacket{sessionID: "sessionB", payload: newTestVoicePacket(30000).Payload}))
+		require.NoError(t, m.mix(mixed, pcm, data))
+		require.Equal(t, []int16{32767}, sink.samples)
+
+		// Nothing should be written on silence.
+		require.NoError(t, m.mix(mixed, pcm, data))
+		require.Len(t, sink.samples, 1)
+
+		m.removeSource("sessionA")
+		require.NoError(t, m.decode(audioMixerPacket{sessionID: "sessionB", payload: newTestVoicePacket(-100).Payload}))
+		require.NoError(t, m.mix(mixed, pcm, data))
+		require.Equal(t, []int16{32767, -100}, sink.samples)
+
+		// Late packets from removed sessions are ignored.
+		require.NoError(t, m.decode(audioMixerPacket{sessionID: "sessionA", payload: newTestVoicePacket(100).Payload}))
+		require.NoError(t, m.decode(audioMixerPacket{sessionID: "sessionB", payload: newTestVoicePacket(-100).Payload}))
+		require.NoError(t, m.mix(mixed, pcm, data))
+		require.Equal(t, []int16{32767, -100, -100}, sink.samples)
+		require.NotContains(t, m.sources, "sessionA")
+	})
+
+	t.Run("dropped packets", func(t *testing.T) {
+		sink := &testAudioSink{}
+		m, err := newAudioMixer(newTestAudioMixerConfig(sink), log)
+		require.NoError(t, err)
+
+		// Not starting the mixer so that the channel fills up.
+		for i := 0; i < audioMixerInChSize+10; i++ {
+			m.push("sessionA", newTestVoicePacket(100))
+		}
+		require.Len(t, m.inCh, audioMixerInChSize)
+		// The first drop got logged, the others are pending.
+		require.Equal(t, int64(9), m.droppedPackets.Load())
+	})
+}
+
+func TestStartCallAudioMixer(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	err = s.StartCallAudioMixer(random.NewID(), "unknown", newTestAudioMixerConfig(&testAudioSink{}))
+	require.ErrorIs(t, err, ErrCallNotFound)
+
+	cfg := SessionConfig{
+		GroupID:   random.NewID(),
+		CallID:    random.NewID(),
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+	err = s.InitSession(cfg, nil)
+	require.NoError(t, err)
+	c := s.getGroup(cfg.GroupID).getCall(cfg.CallID)
+
+	err = s.StartCallAudioMixer(cfg.GroupID, cfg.CallID, AudioMixerConfig{})
+	require.EqualError(t, err, "failed to create audio mixer: invalid NewDecoder value: should not be nil")
+
+	err = s.StartCallAudioMixer(cfg.GroupID, cfg.CallID, newTestAudioMixerConfig(&testAudioSink{}))
+	require.NoError(t, err)
+	require.NotNil(t, c.audioMixer.Load())
+
+	err = s.StartCallAudioMixer(cfg.GroupID, cfg.CallID, newTestAudioMixerConfig(&testAudioSink{}))
+	require.ErrorIs(t, err, ErrAudioMixerActive)
+
+	err = s.StopCallAudioMixer(cfg.GroupID, cfg.CallID)
+	require.NoError(t, err)
+	require.Nil(t, c.audioMixer.Load())
+
+	// The mixer should be stopped when the call ends.
+	err = s.StartCallAudioMixer(cfg.GroupID, cfg.CallID, newTestAudioMixerConfig(&testAudioSink{}))
+	require.NoError(t, err)
+	m := c.audioMixer.Load()
+	require.NotNil(t, m)
+
+	err = s.CloseSession(cfg.SessionID, CloseReasonLeft)
+	require.NoError(t, err)
+	require.Nil(t, c.audioMixer.Load())
+	select {
+	case <-m.doneCh:
+	default:
+		require.Fail(t, "mixer should be stopped")
+	}
+
+	err = s.StopCallAudioMixer(cfg.GroupID, cfg.CallID)
+	require.ErrorIs(t, err, ErrCallNotFound)
+}
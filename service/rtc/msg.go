@@ -5,6 +5,7 @@ package rtc
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/pion/webrtc/v4"
@@ -21,6 +22,23 @@ const (
 	ScreenOffMessage
 	VoiceOnMessage
 	VoiceOffMessage
+	ScreenRejectMessage
+	UnmuteRejectMessage
+	StatsMessage
+	VideoOnMessage
+	VideoOffMessage
+	TrackRejectMessage
+	ActiveSpeakerMessage
+	// ActiveSpeakerClearedMessage is sent when the active speaker leaves the
+	// call. As that session is gone, it's sent on behalf of one of the
+	// remaining sessions, with the former speaker's session ID in Data.
+	ActiveSpeakerClearedMessage
+)
+
+var (
+	ErrScreenShareActive  = errors.New("screen sharing already active")
+	ErrMaxUnmutedSpeakers = errors.New("maximum number of unmuted speakers reached")
+	ErrMaxReceivers       = errors.New("maximum number of receivers per publisher reached")
 )
 
 type Message struct {
@@ -0,0 +1,126 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+const (
+	acceptErrorMinBackoff = 5 * time.Millisecond
+	acceptErrorMaxBackoff = time.Second
+)
+
+// multiListener wraps a net.Listener so that connections are accepted
+// concurrently by multiple goroutines and fed to a single Accept caller.
+//
+// Accept errors other than the listener being closed (e.g. running out of
+// file descriptors) are not returned since the caller would stop accepting
+// altogether. The failing acceptor backs off and retries instead.
+type multiListener struct {
+	net.Listener
+	log            mlog.LoggerIFace
+	acceptResultCh chan acceptResult
+	closeCh        chan struct{}
+	closeOnce      sync.Once
+	wg             sync.WaitGroup
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+func newMultiListener(listener net.Listener, concurrency int, log mlog.LoggerIFace) (*multiListener, error) {
+	if listener == nil {
+		return nil, errors.New("invalid nil listener")
+	}
+	if concurrency <= 0 {
+		return nil, errors.New("concurrency should be greater than 0")
+	}
+	if log == nil {
+		return nil, errors.New("invalid nil logger")
+	}
+
+	var ml multiListener
+	ml.Listener = listener
+	ml.log = log
+	ml.acceptResultCh = make(chan acceptResult, concurrency)
+	ml.closeCh = make(chan struct{})
+	ml.wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go ml.acceptor()
+	}
+	return &ml, nil
+}
+
+func (ml *multiListener) acceptor() {
+	defer ml.wg.Done()
+	var backoff time.Duration
+	for {
+		conn, err := ml.Listener.Accept()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			if backoff == 0 {
+				backoff = acceptErrorMinBackoff
+			} else {
+				backoff = min(2*backoff, acceptErrorMaxBackoff)
+			}
+			ml.log.Warn("failed to accept connection, retrying", mlog.Err(err), mlog.Duration("backoff", backoff))
+			select {
+			case <-time.After(backoff):
+				continue
+			case <-ml.closeCh:
+				return
+			}
+		}
+		backoff = 0
+
+		select {
+		case ml.acceptResultCh <- acceptResult{conn: conn, err: err}:
+		case <-ml.closeCh:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (ml *multiListener) Accept() (net.Conn, error) {
+	select {
+	case res := <-ml.acceptResultCh:
+		return res.conn, res.err
+	case <-ml.closeCh:
+		return nil, net.ErrClosed
+	}
+}
+
+func (ml *multiListener) Close() error {
+	err := net.ErrClosed
+	ml.closeOnce.Do(func() {
+		close(ml.closeCh)
+		err = ml.Listener.Close()
+		ml.wg.Wait()
+		// Closing any connection accepted but never handed over.
+		for {
+			select {
+			case res := <-ml.acceptResultCh:
+				if res.conn != nil {
+					res.conn.Close()
+				}
+			default:
+				return
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMultiListener(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	t.Run("error - nil listener", func(t *testing.T) {
+		ml, err := newMultiListener(nil, 1, log)
+		require.EqualError(t, err, "invalid nil listener")
+		require.Nil(t, ml)
+	})
+
+	t.Run("error - invalid concurrency", func(t *testing.T) {
+		listener, err := net.Listen("tcp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+
+		ml, err := newMultiListener(listener, 0, log)
+		require.EqualError(t, err, "concurrency should be greater than 0")
+		require.Nil(t, ml)
+	})
+
+	t.Run("error - nil logger", func(t *testing.T) {
+		listener, err := net.Listen("tcp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+
+		ml, err := newMultiListener(listener, 1, nil)
+		require.EqualError(t, err, "invalid nil logger")
+		require.Nil(t, ml)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		listener, err := net.Listen("tcp4", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		ml, err := newMultiListener(listener, 4, log)
+		require.NoError(t, err)
+		require.NotNil(t, ml)
+		require.Equal(t, listener.Addr(), ml.Addr())
+
+		err = ml.Close()
+		require.NoError(t, err)
+
+		conn, err := ml.Accept()
+		require.ErrorIs(t, err, net.ErrClosed)
+		require.Nil(t, conn)
+
+		err = ml.Close()
+		require.ErrorIs(t, err, net.ErrClosed)
+	})
+}
+
+func TestMultiListenerAccept(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ml, err := newMultiListener(listener, 4, log)
+	require.NoError(t, err)
+	defer ml.Close()
+
+	n := 100
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			conn, err := net.Dial("tcp4", ml.Addr().String())
+			require.NoError(t, err)
+			_, err = conn.Write([]byte("ping"))
+			require.NoError(t, err)
+			conn.Close()
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		conn, err := ml.Accept()
+		require.NoError(t, err)
+		buf := make([]byte, 4)
+		_, err = conn.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, "ping", string(buf))
+		conn.Close()
+	}
+
+	wg.Wait()
+}
+
+// failingListener fails the first accept calls before falling back to the
+// wrapped listener.
+type failingListener struct {
+	net.Listener
+	failures atomic.Int32
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	if l.failures.Add(-1) >= 0 {
+		return nil, errors.New("too many open files")
+	}
+	return l.Listener.Accept()
+}
+
+func TestMultiListenerAcceptError(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	fl := &failingListener{Listener: listener}
+	fl.failures.Store(3)
+
+	ml, err := newMultiListener(fl, 1, log)
+	require.NoError(t, err)
+
+	// Transient errors are retried rather than returned.
+	go func() {
+		conn, err := net.Dial("tcp4", ml.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := ml.Accept()
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+	conn.Close()
+
+	// Closing is not held back by a pending backoff.
+	fl.failures.Store(1 << 20)
+	go func() {
+		conn, err := net.Dial("tcp4", ml.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	closedCh := make(chan struct{})
+	go func() {
+		defer close(closedCh)
+		err := ml.Close()
+		require.NoError(t, err)
+	}()
+	select {
+	case <-closedCh:
+	case <-time.After(time.Second):
+		require.Fail(t, "timed out closing listener")
+	}
+}
+
+func BenchmarkMultiListenerAccept(b *testing.B) {
+	log, err := mlog.NewLogger()
+	require.NoError(b, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(b, err)
+	}()
+
+	for _, concurrency := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			listener, err := net.Listen("tcp4", "127.0.0.1:0")
+			require.NoError(b, err)
+
+			ml, err := newMultiListener(listener, concurrency, log)
+			require.NoError(b, err)
+			defer ml.Close()
+
+			// Accepted connections get a byte written back so that each
+			// iteration completes only after its connection went through
+			// Accept, not just the kernel handshake.
+			go func() {
+				for {
+					conn, err := ml.Accept()
+					if err != nil {
+						return
+					}
+					_, _ = conn.Write([]byte{0})
+					conn.Close()
+				}
+			}()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				buf := make([]byte, 1)
+				for pb.Next() {
+					conn, err := net.Dial("tcp4", ml.Addr().String())
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					if _, err := conn.Read(buf); err != nil {
+						b.Error(err)
+					}
+					conn.Close()
+				}
+			})
+		})
+	}
+}
@@ -30,6 +30,10 @@ func GetDefaultUDPListeningSocketsCount() int {
 	return runtime.NumCPU() * 100
 }
 
+func GetDefaultTCPAcceptConcurrency() int {
+	return runtime.NumCPU()
+}
+
 // getSystemIPs returns a list of all the available local addresses.
 func getSystemIPs(log mlog.LoggerIFace, dualStack bool) ([]netip.Addr, error) {
 	var ips []netip.Addr
@@ -78,6 +82,17 @@ func getSystemIPs(log mlog.LoggerIFace, dualStack bool) ([]netip.Addr, error) {
 	return ips, nil
 }
 
+// filterIPv6Addrs returns the IPv6 addresses in the given list.
+func filterIPv6Addrs(ips []netip.Addr) []netip.Addr {
+	var v6IPs []netip.Addr
+	for _, ip := range ips {
+		if ip.Is6() && !ip.Is4In6() {
+			v6IPs = append(v6IPs, ip)
+		}
+	}
+	return v6IPs
+}
+
 func createUDPConnsForAddr(log mlog.LoggerIFace, network, listenAddress string, socketsCount int) ([]net.PacketConn, error) {
 	var conns []net.PacketConn
 
@@ -57,6 +57,21 @@ func TestGetSystemIPs(t *testing.T) {
 	})
 }
 
+func TestFilterIPv6Addrs(t *testing.T) {
+	require.Empty(t, filterIPv6Addrs(nil))
+
+	ips := []netip.Addr{
+		netip.MustParseAddr("127.0.0.1"),
+		netip.MustParseAddr("fd00::2"),
+		netip.MustParseAddr("::ffff:10.0.0.1"),
+		netip.MustParseAddr("2001:db8::1"),
+	}
+	require.Equal(t, []netip.Addr{
+		netip.MustParseAddr("fd00::2"),
+		netip.MustParseAddr("2001:db8::1"),
+	}, filterIPv6Addrs(ips))
+}
+
 func TestCreateUDPConnsForAddr(t *testing.T) {
 	log, err := mlog.NewLogger()
 	require.NoError(t, err)
@@ -0,0 +1,27 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"fmt"
+)
+
+type ServerOption func(s *Server) error
+
+// SessionIDValidator is a function checking whether a session ID is well
+// formed. It should return a non-nil error describing the problem otherwise.
+type SessionIDValidator func(sessionID string) error
+
+// WithSessionIDValidator lets the caller set an optional function to validate
+// session IDs upon session initialization, in addition to the default
+// non-empty check.
+func WithSessionIDValidator(fn SessionIDValidator) ServerOption {
+	return func(s *Server) error {
+		if fn == nil {
+			return fmt.Errorf("session ID validator should not be nil")
+		}
+		s.sessionIDValidator = fn
+		return nil
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+// heldTrackActions holds the track actions received while a session has too
+// many outstanding offers (ServerConfig.MaxOutstandingOffers), until answers
+// catch up or the signaling timeout expires.
+type heldTrackActions struct {
+	actions []trackActionContext
+	timer   *time.Timer
+}
+
+// timeoutCh returns the channel notified once the held actions have waited
+// too long. It's nil if there's nothing held.
+func (h *heldTrackActions) timeoutCh() <-chan time.Time {
+	if h.timer == nil {
+		return nil
+	}
+	return h.timer.C
+}
+
+func (h *heldTrackActions) stop() {
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+}
+
+func (s *session) getOutstandingOffers() int {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return s.outstandingOffers
+}
+
+func (s *session) resetOutstandingOffers() {
+	s.mut.Lock()
+	s.outstandingOffers = 0
+	s.mut.Unlock()
+}
+
+// applyLateAnswer completes the pending offer with an answer received while
+// track actions were held. It returns false if the answer is stale.
+func (s *session) applyLateAnswer(answer sdpMessage) (bool, error) {
+	if s.rtcConn.SignalingState() != webrtc.SignalingStateHaveLocalOffer ||
+		(answer.OfferSeq != 0 && answer.OfferSeq != s.offerSeq) {
+		s.log.Debug("discarding stale sdp answer",
+			mlog.String("sessionID", s.cfg.SessionID),
+			mlog.Uint("answerOfferSeq", answer.OfferSeq),
+			mlog.Uint("offerSeq", s.offerSeq))
+		return false, nil
+	}
+
+	if err := s.setRemoteDescription(answer.SessionDescription); err != nil {
+		return false, fmt.Errorf("failed to set remote description: %w", err)
+	}
+	s.observeSignalingRTT(time.Since(s.offerSentAt))
+	s.resetOutstandingOffers()
+
+	return true, nil
+}
+
+// tooManyOutstandingOffers returns whether the session has reached the
+// maximum number of unanswered offers.
+func (s *Server) tooManyOutstandingOffers(us *session) bool {
+	return s.cfg.MaxOutstandingOffers > 0 && us.getOutstandingOffers() >= s.cfg.MaxOutstandingOffers
+}
+
+// holdTrackAction queues the given track action until the session's answers
+// catch up. Actions cancelling out held ones, such as removing a track whose
+// addition is held, are coalesced so that they don't cost any offer.
+func (s *Server) holdTrackAction(us *session, held *heldTrackActions, ctx trackActionContext) {
+	for i, heldCtx := range held.actions {
+		if heldCtx.action != trackActionAdd || heldCtx.track != ctx.track {
+			continue
+		}
+
+		switch ctx.action {
+		case trackActionAdd:
+			s.metrics.AddRTCCoalescedOffers(us.cfg.GroupID, 1)
+			return
+		case trackActionRemove:
+			held.actions = append(held.actions[:i], held.actions[i+1:]...)
+			s.metrics.AddRTCCoalescedOffers(us.cfg.GroupID, 2)
+			if len(held.actions) == 0 {
+				held.stop()
+			}
+			return
+		}
+	}
+
+	if len(held.actions) >= tracksChSize {
+		s.metrics.IncRTCErrors(us.cfg.GroupID, "track")
+		s.droppedMessage(us.cfg.GroupID, "tracks", "held_track_action", mlog.String("sessionID", us.cfg.SessionID))
+		return
+	}
+
+	s.log.Debug("too many outstanding offers, holding track action",
+		mlog.String("sessionID", us.cfg.SessionID), mlog.Int("action", int(ctx.action)))
+
+	held.actions = append(held.actions, ctx)
+	if held.timer == nil {
+		held.timer = time.NewTimer(us.signalingTimeout)
+	}
+}
+
+// releaseHeldTrackActions performs the held track actions, in order, for as
+// long as the session's outstanding offers stay below the limit. If force is
+// set at least one is performed regardless.
+func (s *Server) releaseHeldTrackActions(call *call, us *session, held *heldTrackActions, force bool) {
+	held.stop()
+
+	for len(held.actions) > 0 {
+		if !force && s.tooManyOutstandingOffers(us) {
+			break
+		}
+		force = false
+
+		ctx := held.actions[0]
+		held.actions = held.actions[1:]
+		s.handleTrackAction(call, us, ctx)
+	}
+
+	if len(held.actions) > 0 {
+		held.timer = time.NewTimer(us.signalingTimeout)
+	}
+}
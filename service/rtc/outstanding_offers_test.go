@@ -0,0 +1,199 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/perf"
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxOutstandingOffers(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.SignalingTimeoutMs = 1000
+
+	s.cfg.MaxOutstandingOffers = 1
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	cfg := SessionConfig{
+		GroupID:   random.NewID(),
+		CallID:    random.NewID(),
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+
+	sendMsg := func(msgType MessageType, data []byte) {
+		t.Helper()
+		err := s.Send(Message{
+			GroupID:   cfg.GroupID,
+			CallID:    cfg.CallID,
+			UserID:    cfg.UserID,
+			SessionID: cfg.SessionID,
+			Type:      msgType,
+			Data:      data,
+		})
+		require.NoError(t, err)
+	}
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer pc.Close()
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		data, err := json.Marshal(candidate.ToJSON())
+		require.NoError(t, err)
+		sendMsg(ICEMessage, data)
+	})
+	_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionSendrecv,
+	})
+	require.NoError(t, err)
+
+	answer := func(offer sdpMessage) {
+		t.Helper()
+		err := pc.SetRemoteDescription(offer.SessionDescription)
+		require.NoError(t, err)
+		answer, err := pc.CreateAnswer(nil)
+		require.NoError(t, err)
+		err = pc.SetLocalDescription(answer)
+		require.NoError(t, err)
+		data, err := json.Marshal(sdpMessage{SessionDescription: answer, OfferSeq: offer.OfferSeq})
+		require.NoError(t, err)
+		sendMsg(SDPMessage, data)
+	}
+
+	// Acting as a client which answers offers only while answering is set.
+	var answering atomic.Bool
+	answering.Store(true)
+	var offers atomic.Int64
+	var mut sync.Mutex
+	var lastOffer sdpMessage
+	go func() {
+		for msg := range s.ReceiveCh() {
+			if msg.SessionID != cfg.SessionID {
+				continue
+			}
+
+			switch msg.Type {
+			case ICEMessage:
+				data := make(map[string]any)
+				err := json.Unmarshal(msg.Data, &data)
+				require.NoError(t, err)
+				candidate := data["candidate"].(map[string]any)["candidate"].(string)
+				go func() {
+					for pc.RemoteDescription() == nil {
+						time.Sleep(10 * time.Millisecond)
+					}
+					_ = pc.AddICECandidate(webrtc.ICECandidateInit{Candidate: candidate})
+				}()
+			case SDPMessage:
+				var sdp sdpMessage
+				err := json.Unmarshal(msg.Data, &sdp)
+				require.NoError(t, err)
+				if sdp.Type != webrtc.SDPTypeOffer {
+					err = pc.SetRemoteDescription(sdp.SessionDescription)
+					require.NoError(t, err)
+					continue
+				}
+				offers.Add(1)
+				if answering.Load() {
+					answer(sdp)
+					continue
+				}
+				mut.Lock()
+				lastOffer = sdp
+				mut.Unlock()
+			}
+		}
+	}()
+
+	offer, err := pc.CreateOffer(nil)
+	require.NoError(t, err)
+	err = pc.SetLocalDescription(offer)
+	require.NoError(t, err)
+	err = s.InitSession(cfg, nil)
+	require.NoError(t, err)
+	defer func() {
+		err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+	data, err := json.Marshal(offer)
+	require.NoError(t, err)
+	sendMsg(SDPMessage, data)
+
+	require.Eventually(t, func() bool {
+		return pc.RemoteDescription() != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+	require.NotNil(t, us)
+
+	newTrack := func() webrtc.TrackLocal {
+		t.Helper()
+		track, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, genTrackID(trackTypeVoice, random.NewID(), 0), random.NewID())
+		require.NoError(t, err)
+		return track
+	}
+
+	hasTrack := func(track webrtc.TrackLocal) bool {
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		return us.rxTracks[track.ID()] != nil
+	}
+
+	// The client stops answering so that the first offer is left outstanding.
+	answering.Store(false)
+	trackA := newTrack()
+	us.tracksCh <- trackActionContext{action: trackActionAdd, track: trackA}
+	require.Eventually(t, func() bool {
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		return us.outstandingOffers == 1 && !us.makingOffer
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(1), offers.Load())
+
+	// Rapid track changes are held, coalescing those cancelling out.
+	trackB := newTrack()
+	trackC := newTrack()
+	us.tracksCh <- trackActionContext{action: trackActionAdd, track: trackB}
+	us.tracksCh <- trackActionContext{action: trackActionAdd, track: trackB}
+	us.tracksCh <- trackActionContext{action: trackActionAdd, track: trackC}
+	us.tracksCh <- trackActionContext{action: trackActionRemove, track: trackC}
+
+	metrics := s.metrics.Metrics.(*perf.Metrics)
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.RTCCoalescedOffers.WithLabelValues(cfg.GroupID)) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(1), offers.Load())
+
+	// Answers catching up release the held actions.
+	answering.Store(true)
+	mut.Lock()
+	answer(lastOffer)
+	mut.Unlock()
+
+	require.Eventually(t, func() bool {
+		return hasTrack(trackB)
+	}, 5*time.Second, 10*time.Millisecond)
+	require.False(t, hasTrack(trackC))
+	require.Equal(t, int64(2), offers.Load())
+	require.Zero(t, us.getOutstandingOffers())
+	require.Equal(t, webrtc.SignalingStateStable, us.rtcConn.SignalingState())
+	require.Equal(t, webrtc.SignalingStateStable, pc.SignalingState())
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/gcc"
+	"github.com/pion/rtp"
+)
+
+const (
+	// pacingInterval is how often queued packets are sent out.
+	pacingInterval = 5 * time.Millisecond
+	// pacingFactor allows sending above the estimated rate so that queues
+	// built up during bursts can drain.
+	pacingFactor = 1.5
+	// pacerMaxQueueDelay caps the latency added by pacing. Packets queued for
+	// longer are sent regardless of the budget.
+	pacerMaxQueueDelay = 100 * time.Millisecond
+)
+
+type pacedPacket struct {
+	header     *rtp.Header
+	payload    []byte
+	attributes interceptor.Attributes
+	queuedAt   time.Time
+}
+
+// pacer smooths the packets sent to a session according to the rate estimated
+// by the congestion controller (ServerConfig.EnablePacing). It implements
+// gcc.Pacer.
+type pacer struct {
+	// targetRate is the rate, in bits per second, packets are paced at.
+	// Packets are sent as they come until a rate is set.
+	targetRate atomic.Int64
+
+	writers map[uint32]interceptor.RTPWriter
+	queue   []pacedPacket
+
+	startOnce sync.Once
+	closeOnce sync.Once
+	wakeCh    chan struct{}
+	doneCh    chan struct{}
+
+	mut sync.Mutex
+}
+
+var _ gcc.Pacer = (*pacer)(nil)
+
+func newPacer() *pacer {
+	return &pacer{
+		writers: map[uint32]interceptor.RTPWriter{},
+		wakeCh:  make(chan struct{}, 1),
+		doneCh:  make(chan struct{}),
+	}
+}
+
+// AddStream adds the writer for the stream with the given SSRC.
+func (p *pacer) AddStream(ssrc uint32, writer interceptor.RTPWriter) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.writers[ssrc] = writer
+}
+
+// SetTargetBitrate sets the estimated rate, in bits per second, packets are
+// paced at.
+func (p *pacer) SetTargetBitrate(rate int) {
+	p.targetRate.Store(int64(rate))
+}
+
+// Write queues the given packet to be sent out by the pacing loop.
+func (p *pacer) Write(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+	p.mut.Lock()
+	writer, ok := p.writers[header.SSRC]
+	if !ok {
+		p.mut.Unlock()
+		return 0, fmt.Errorf("%w: %v", gcc.ErrUnknownStream, header.SSRC)
+	}
+
+	if p.targetRate.Load() <= 0 {
+		p.mut.Unlock()
+		return writer.Write(header, payload, attributes)
+	}
+
+	// The caller owns both the header and the payload so they need to be
+	// copied before returning.
+	hdr := header.Clone()
+	p.queue = append(p.queue, pacedPacket{
+		header:     &hdr,
+		payload:    append([]byte(nil), payload...),
+		attributes: attributes,
+		queuedAt:   time.Now(),
+	})
+	p.mut.Unlock()
+
+	p.startOnce.Do(func() {
+		go p.run()
+	})
+
+	select {
+	case p.wakeCh <- struct{}{}:
+	default:
+	}
+
+	return header.MarshalSize() + len(payload), nil
+}
+
+// Close stops the pacing loop. Packets still queued are dropped.
+func (p *pacer) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.doneCh)
+	})
+	return nil
+}
+
+func (p *pacer) run() {
+	for {
+		select {
+		case <-p.wakeCh:
+			p.drain()
+		case <-p.doneCh:
+			return
+		}
+	}
+}
+
+// drain sends out the queued packets at the target rate until the queue is
+// empty.
+func (p *pacer) drain() {
+	ticker := time.NewTicker(pacingInterval)
+	defer ticker.Stop()
+
+	// Starting with a full budget lets an interval's worth of data through
+	// right away.
+	budget := p.maxBudget()
+	lastRefill := time.Now()
+	for {
+		for {
+			p.mut.Lock()
+			if len(p.queue) == 0 {
+				p.mut.Unlock()
+				return
+			}
+			pkt := p.queue[0]
+			if budget <= 0 && time.Since(pkt.queuedAt) < pacerMaxQueueDelay {
+				p.mut.Unlock()
+				break
+			}
+			p.queue[0] = pacedPacket{}
+			p.queue = p.queue[1:]
+			writer := p.writers[pkt.header.SSRC]
+			p.mut.Unlock()
+
+			n, _ := writer.Write(pkt.header, pkt.payload, pkt.attributes)
+			budget -= n
+		}
+
+		select {
+		case now := <-ticker.C:
+			budget = min(budget+p.bytesPerDuration(now.Sub(lastRefill)), p.maxBudget())
+			lastRefill = now
+		case <-p.doneCh:
+			return
+		}
+	}
+}
+
+func (p *pacer) bytesPerDuration(d time.Duration) int {
+	return int(float64(p.targetRate.Load()) * pacingFactor * d.Seconds() / 8)
+}
+
+// maxBudget is the maximum amount of data, in bytes, that can be sent in a
+// single burst.
+func (p *pacer) maxBudget() int {
+	return p.bytesPerDuration(pacingInterval)
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/gcc"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+type pacerTestWriter struct {
+	seqs []uint16
+	ts   []time.Time
+	mut  sync.Mutex
+}
+
+func (w *pacerTestWriter) Write(header *rtp.Header, payload []byte, _ interceptor.Attributes) (int, error) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	w.seqs = append(w.seqs, header.SequenceNumber)
+	w.ts = append(w.ts, time.Now())
+	return header.MarshalSize() + len(payload), nil
+}
+
+func (w *pacerTestWriter) count() int {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return len(w.seqs)
+}
+
+// sendBursts writes numBursts bursts of burstSize packets every interval
+// through the given pacer and returns the intervals between the packets as
+// they were sent out.
+func sendBursts(t *testing.T, p gcc.Pacer, numBursts, burstSize int, interval time.Duration) []time.Duration {
+	t.Helper()
+
+	w := &pacerTestWriter{}
+	p.AddStream(1, w)
+
+	var seq uint16
+	payload := make([]byte, 1000)
+	for i := 0; i < numBursts; i++ {
+		for j := 0; j < burstSize; j++ {
+			seq++
+			_, err := p.Write(&rtp.Header{SSRC: 1, SequenceNumber: seq}, payload, nil)
+			require.NoError(t, err)
+		}
+		time.Sleep(interval)
+	}
+
+	require.Eventually(t, func() bool {
+		return w.count() == numBursts*burstSize
+	}, time.Second, 10*time.Millisecond)
+
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	// Packets are sent out in order.
+	for i := range w.seqs {
+		require.Equal(t, uint16(i+1), w.seqs[i])
+	}
+
+	gaps := make([]time.Duration, 0, len(w.ts)-1)
+	for i := 1; i < len(w.ts); i++ {
+		gaps = append(gaps, w.ts[i].Sub(w.ts[i-1]))
+	}
+
+	return gaps
+}
+
+func stdDev(values []time.Duration) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += float64(v)
+	}
+	mean := sum / float64(len(values))
+
+	var variance float64
+	for _, v := range values {
+		variance += (float64(v) - mean) * (float64(v) - mean)
+	}
+
+	return math.Sqrt(variance / float64(len(values)))
+}
+
+func TestPacer(t *testing.T) {
+	t.Run("unknown stream", func(t *testing.T) {
+		p := newPacer()
+		defer p.Close()
+		_, err := p.Write(&rtp.Header{SSRC: 1}, nil, nil)
+		require.ErrorIs(t, err, gcc.ErrUnknownStream)
+	})
+
+	t.Run("no target rate", func(t *testing.T) {
+		p := newPacer()
+		defer p.Close()
+		w := &pacerTestWriter{}
+		p.AddStream(1, w)
+
+		// Packets are sent right away until a rate is estimated.
+		for i := 0; i < 10; i++ {
+			_, err := p.Write(&rtp.Header{SSRC: 1}, make([]byte, 1000), nil)
+			require.NoError(t, err)
+		}
+		require.Equal(t, 10, w.count())
+	})
+
+	t.Run("max queue delay", func(t *testing.T) {
+		p := newPacer()
+		defer p.Close()
+		// Way too low for the data being sent.
+		p.SetTargetBitrate(10_000)
+		w := &pacerTestWriter{}
+		p.AddStream(1, w)
+
+		for i := 0; i < 10; i++ {
+			_, err := p.Write(&rtp.Header{SSRC: 1}, make([]byte, 1000), nil)
+			require.NoError(t, err)
+		}
+		require.Less(t, w.count(), 10)
+
+		require.Eventually(t, func() bool {
+			return w.count() == 10
+		}, 4*pacerMaxQueueDelay, 10*time.Millisecond)
+	})
+
+	t.Run("payload is copied", func(t *testing.T) {
+		p := newPacer()
+		defer p.Close()
+		p.SetTargetBitrate(10_000)
+
+		var payloads [][]byte
+		var mut sync.Mutex
+		p.AddStream(1, interceptor.RTPWriterFunc(func(_ *rtp.Header, payload []byte, _ interceptor.Attributes) (int, error) {
+			mut.Lock()
+			defer mut.Unlock()
+			payloads = append(payloads, payload)
+			return len(payload), nil
+		}))
+
+		buf := make([]byte, 1000)
+		for i := 0; i < 5; i++ {
+			buf[0] = byte(i)
+			_, err := p.Write(&rtp.Header{SSRC: 1}, buf, nil)
+			require.NoError(t, err)
+		}
+
+		require.Eventually(t, func() bool {
+			mut.Lock()
+			defer mut.Unlock()
+			return len(payloads) == 5
+		}, time.Second, 10*time.Millisecond)
+
+		for i, payload := range payloads {
+			require.Equal(t, byte(i), payload[0])
+		}
+	})
+}
+
+func TestPacerBurstiness(t *testing.T) {
+	// Bursts of 10 packets every 100ms amount to about 800Kbps.
+	numBursts := 5
+	burstSize := 10
+	burstInterval := 100 * time.Millisecond
+
+	unpacedGaps := sendBursts(t, gcc.NewNoOpPacer(), numBursts, burstSize, burstInterval)
+
+	p := newPacer()
+	defer p.Close()
+	p.SetTargetBitrate(600_000)
+	pacedGaps := sendBursts(t, p, numBursts, burstSize, burstInterval)
+
+	unpacedStdDev := stdDev(unpacedGaps)
+	pacedStdDev := stdDev(pacedGaps)
+	t.Logf("inter-packet gap std dev: unpaced=%v, paced=%v", time.Duration(unpacedStdDev), time.Duration(pacedStdDev))
+
+	require.Less(t, pacedStdDev, unpacedStdDev/2)
+
+	// Bursts are spread out rather than sent back to back.
+	var backToBack int
+	for _, gap := range pacedGaps {
+		if gap < time.Millisecond {
+			backToBack++
+		}
+	}
+	require.Less(t, backToBack, len(pacedGaps)/2)
+}
+
+func TestPacingConfig(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	sa, err := s.newSessionAPI(nil, false, true)
+	require.NoError(t, err)
+	require.Nil(t, sa.pacer)
+
+	s.cfg.EnablePacing = true
+	sa, err = s.newSessionAPI(nil, false, true)
+	require.NoError(t, err)
+	require.NotNil(t, sa.pacer)
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"sync"
+)
+
+// publishedTrackKey identifies a track published by a session regardless of
+// the out tracks (e.g. simulcast levels) it's forwarded through.
+type publishedTrackKey struct {
+	sessionID string
+	trackType trackType
+}
+
+// receiversLimiter keeps track of the sessions each published track is
+// forwarded to so that their number can be capped.
+type receiversLimiter struct {
+	maxReceivers int
+	receivers    map[publishedTrackKey]map[string]bool
+	mut          sync.Mutex
+}
+
+func newReceiversLimiter(maxReceivers int) *receiversLimiter {
+	return &receiversLimiter{
+		maxReceivers: maxReceivers,
+		receivers:    map[publishedTrackKey]map[string]bool{},
+	}
+}
+
+// acquire reserves a receiver slot for the given track. It returns false if
+// the track's publisher already reached the maximum number of receivers.
+// Acquiring is idempotent for a given receiver.
+func (l *receiversLimiter) acquire(trackID, receiverID string) bool {
+	tt, senderID, err := parseTrackID(trackID)
+	if err != nil {
+		return true
+	}
+	key := publishedTrackKey{sessionID: senderID, trackType: tt}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	receivers := l.receivers[key]
+	if receivers[receiverID] {
+		return true
+	}
+	if len(receivers) >= l.maxReceivers {
+		return false
+	}
+	if receivers == nil {
+		receivers = map[string]bool{}
+		l.receivers[key] = receivers
+	}
+	receivers[receiverID] = true
+
+	return true
+}
+
+// release frees the receiver slot held for the given track, if any.
+func (l *receiversLimiter) release(trackID, receiverID string) {
+	tt, senderID, err := parseTrackID(trackID)
+	if err != nil {
+		return
+	}
+	key := publishedTrackKey{sessionID: senderID, trackType: tt}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	delete(l.receivers[key], receiverID)
+	if len(l.receivers[key]) == 0 {
+		delete(l.receivers, key)
+	}
+}
+
+// replace frees the slot held for oldTrackID once the receiver has been
+// switched to newTrackID, unless both are accounted under the same slot.
+func (l *receiversLimiter) replace(oldTrackID, newTrackID, receiverID string) {
+	oldType, oldSenderID, err := parseTrackID(oldTrackID)
+	if err != nil {
+		return
+	}
+	if tt, senderID, err := parseTrackID(newTrackID); err == nil && tt == oldType && senderID == oldSenderID {
+		return
+	}
+	l.release(oldTrackID, receiverID)
+}
+
+// removeSession frees all the slots held by or for the tracks of the given
+// session.
+func (l *receiversLimiter) removeSession(sessionID string) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	for key, receivers := range l.receivers {
+		delete(receivers, sessionID)
+		if key.sessionID == sessionID || len(receivers) == 0 {
+			delete(l.receivers, key)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/perf"
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiversLimiter(t *testing.T) {
+	l := newReceiversLimiter(2)
+
+	screenTrackA := genTrackID(trackTypeScreen, "publisherA", 0)
+	screenTrackB := genTrackID(trackTypeScreen, "publisherA", 0)
+	voiceTrack := genTrackID(trackTypeVoice, "publisherA", 0)
+
+	t.Run("invalid track ID", func(t *testing.T) {
+		require.True(t, l.acquire("invalid", "receiverA"))
+		require.Empty(t, l.receivers)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		require.True(t, l.acquire(screenTrackA, "receiverA"))
+		// Out tracks of the same type count as the same published track.
+		require.True(t, l.acquire(screenTrackB, "receiverB"))
+		require.False(t, l.acquire(screenTrackA, "receiverC"))
+
+		// Acquiring again is idempotent.
+		require.True(t, l.acquire(screenTrackB, "receiverA"))
+
+		// Other tracks by the same publisher are limited separately.
+		require.True(t, l.acquire(voiceTrack, "receiverC"))
+	})
+
+	t.Run("release", func(t *testing.T) {
+		l.release(screenTrackA, "receiverB")
+		require.True(t, l.acquire(screenTrackA, "receiverC"))
+		require.False(t, l.acquire(screenTrackA, "receiverB"))
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		// Out tracks of the same published track share the slot.
+		l.replace(screenTrackA, screenTrackB, "receiverC")
+		require.False(t, l.acquire(screenTrackA, "receiverB"))
+
+		otherScreenTrack := genTrackID(trackTypeScreen, "publisherB", 0)
+		require.True(t, l.acquire(otherScreenTrack, "receiverC"))
+		l.replace(screenTrackA, otherScreenTrack, "receiverC")
+		require.True(t, l.acquire(screenTrackA, "receiverB"))
+		l.release(screenTrackA, "receiverB")
+		l.release(otherScreenTrack, "receiverC")
+		require.True(t, l.acquire(screenTrackA, "receiverC"))
+	})
+
+	t.Run("remove session", func(t *testing.T) {
+		l.removeSession("receiverC")
+		require.True(t, l.acquire(screenTrackA, "receiverB"))
+
+		l.removeSession("publisherA")
+		require.Empty(t, l.receivers)
+	})
+}
+
+func TestTrackRejectMessage(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	cfg := SessionConfig{
+		GroupID:   random.NewID(),
+		CallID:    random.NewID(),
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+	err = s.InitSession(cfg, nil)
+	require.NoError(t, err)
+	defer func() {
+		err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+	require.NotNil(t, us)
+
+	trackID := genTrackID(trackTypeScreen, random.NewID(), 0)
+	err = s.sendTrackReject(us, trackID)
+	require.NoError(t, err)
+
+	select {
+	case msg := <-s.ReceiveCh():
+		require.Equal(t, TrackRejectMessage, msg.Type)
+		require.Equal(t, cfg.SessionID, msg.SessionID)
+
+		var data map[string]string
+		err := json.Unmarshal(msg.Data, &data)
+		require.NoError(t, err)
+		require.Equal(t, trackID, data["trackID"])
+		require.Equal(t, ErrMaxReceivers.Error(), data["reason"])
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for track reject message")
+	}
+}
+
+func TestMaxReceiversPerPublisher(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.MaxReceiversPerPublisher = 2
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+	newCfg := func() SessionConfig {
+		return SessionConfig{
+			GroupID:   groupID,
+			CallID:    callID,
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+	}
+
+	initSession := setupTestPeers(t, s)
+
+	var receiverCfgs []SessionConfig
+	for i := 0; i < 3; i++ {
+		cfg := newCfg()
+		pc := initSession(cfg)
+		defer pc.Close()
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+		receiverCfgs = append(receiverCfgs, cfg)
+	}
+
+	publisherCfg := newCfg()
+	screenTrack, err := webrtc.NewTrackLocalStaticRTP(rtpVideoCodecs[webrtc.MimeTypeVP8].RTPCodecCapability, "screen", "screenStream")
+	require.NoError(t, err)
+	publisherPC := initSession(publisherCfg, screenTrack)
+	defer publisherPC.Close()
+	defer func() {
+		err := s.CloseSession(publisherCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	data, err := json.Marshal(map[string]string{"screenStreamID": "screenStream"})
+	require.NoError(t, err)
+	err = s.Send(Message{
+		GroupID:   publisherCfg.GroupID,
+		CallID:    publisherCfg.CallID,
+		UserID:    publisherCfg.UserID,
+		SessionID: publisherCfg.SessionID,
+		Type:      ScreenOnMessage,
+		Data:      data,
+	})
+	require.NoError(t, err)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go func() {
+		ticker := time.NewTicker(30 * time.Millisecond)
+		defer ticker.Stop()
+		var seq uint16
+		for {
+			select {
+			case <-ticker.C:
+				seq++
+				_ = screenTrack.WriteRTP(&rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						SequenceNumber: seq,
+						Timestamp:      uint32(seq) * 3000,
+					},
+					Payload: []byte{0x10, 0x00, 0x00, 0x00},
+				})
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	metrics := s.metrics.Metrics.(*perf.Metrics)
+	call := s.getGroup(groupID).getCall(callID)
+	hasScreenTrack := func(cfg SessionConfig) bool {
+		us := call.getSession(cfg.SessionID)
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		for trackID := range us.rxTracks {
+			if tt, _, err := parseTrackID(trackID); err == nil && tt == trackTypeScreen {
+				return true
+			}
+		}
+		return false
+	}
+	screenReceivers := func() int {
+		var n int
+		for _, cfg := range receiverCfgs {
+			if hasScreenTrack(cfg) {
+				n++
+			}
+		}
+		return n
+	}
+
+	require.Eventually(t, func() bool {
+		return screenReceivers() == 2
+	}, 10*time.Second, 50*time.Millisecond)
+
+	// The third receiver should never get the track.
+	require.Never(t, func() bool {
+		return screenReceivers() > 2
+	}, time.Second, 50*time.Millisecond)
+
+	// Switching a receiver to another out track of the same published track
+	// (e.g. on a simulcast level change) keeps its slot, even if failing.
+	var us *session
+	for _, cfg := range receiverCfgs {
+		if hasScreenTrack(cfg) {
+			us = call.getSession(cfg.SessionID)
+			break
+		}
+	}
+	for _, replace := range []bool{true, false} {
+		outTrack, err := webrtc.NewTrackLocalStaticRTP(rtpVideoCodecs[webrtc.MimeTypeVP8].RTPCodecCapability,
+			genTrackID(trackTypeScreen, publisherCfg.SessionID, 0), random.NewID())
+		require.NoError(t, err)
+		us.tracksCh <- trackActionContext{action: trackActionAdd, track: outTrack, replace: replace}
+		if replace {
+			require.Eventually(t, func() bool {
+				us.mut.RLock()
+				defer us.mut.RUnlock()
+				return us.rxTracks[outTrack.ID()] != nil
+			}, 5*time.Second, 50*time.Millisecond)
+		} else {
+			// Adding fails as the session is already receiving a screen track.
+			require.Eventually(t, func() bool {
+				return testutil.ToFloat64(metrics.RTCErrors.With(prometheus.Labels{"groupID": groupID, "type": "track"})) == 1
+			}, 5*time.Second, 50*time.Millisecond)
+		}
+		require.Equal(t, 2, screenReceivers())
+		require.False(t, call.receiversLimiter.acquire(outTrack.ID(), random.NewID()))
+	}
+
+	// A receiver leaving frees its slot for future receivers.
+	for _, cfg := range receiverCfgs {
+		if hasScreenTrack(cfg) {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+			break
+		}
+	}
+	require.True(t, call.receiversLimiter.acquire(genTrackID(trackTypeScreen, publisherCfg.SessionID, 0), random.NewID()))
+}
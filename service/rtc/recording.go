@@ -0,0 +1,330 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/pion/webrtc/v4/pkg/media/ivfwriter"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+const (
+	recorderInChSize     = 256
+	recorderRemoveChSize = 16
+	// recorderChannels is the channel count advertised in the Ogg Opus
+	// headers, matching rtpAudioCodec.
+	recorderChannels = 2
+)
+
+var ErrRecordingActive = errors.New("recording already active")
+
+// RecordingTrack describes a track being recorded.
+type RecordingTrack struct {
+	SessionID string
+	// Type is the track type, one of voice, screen-audio and screen.
+	Type     string
+	MimeType string
+	SSRC     uint32
+}
+
+// RecordingPathFunc returns the path of the file the given track should be
+// recorded to. Each track is recorded to its own file: Ogg for audio and IVF
+// for screen sharing video.
+type RecordingPathFunc func(track RecordingTrack) (string, error)
+
+type recorderPacket struct {
+	track  RecordingTrack
+	packet *rtp.Packet
+}
+
+// isRecordableMimeType returns whether tracks encoded with the given codec can
+// be written to file.
+func isRecordableMimeType(mimeType string) bool {
+	switch mimeType {
+	case webrtc.MimeTypeOpus, webrtc.MimeTypeVP8, webrtc.MimeTypeAV1:
+		return true
+	default:
+		return false
+	}
+}
+
+// callRecorder tees the tracks (voice, screen sharing audio and video)
+// forwarded in a call into files, one per track. A track's file is created as
+// soon as its first packet is received and finalized when its session leaves
+// or the recording stops.
+//
+// All the file IO happens in the run goroutine so that callers, which may
+// hold the call locks, never block on it.
+type callRecorder struct {
+	groupID string
+	pathFn  RecordingPathFunc
+	log     mlog.LoggerIFace
+	metrics *serverMetrics
+	drops   *droppedMessages
+
+	// writers is only accessed by the run goroutine. A nil writer means the
+	// track couldn't be recorded and should be ignored.
+	writers map[uint32]media.Writer
+	// sessions maps the recorded SSRCs to the session that sent them.
+	sessions map[uint32]string
+
+	inCh     chan recorderPacket
+	removeCh chan string
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+
+	mut sync.Mutex
+	// removed keeps track of the sessions that left the call so that late
+	// packets don't re-open their tracks.
+	removed map[string]bool
+	stopped bool
+}
+
+func newCallRecorder(groupID string, pathFn RecordingPathFunc, log mlog.LoggerIFace, metrics *serverMetrics, drops *droppedMessages) (*callRecorder, error) {
+	if pathFn == nil {
+		return nil, fmt.Errorf("invalid path func: should not be nil")
+	}
+
+	return &callRecorder{
+		groupID:  groupID,
+		pathFn:   pathFn,
+		log:      log,
+		metrics:  metrics,
+		drops:    drops,
+		writers:  map[uint32]media.Writer{},
+		sessions: map[uint32]string{},
+		inCh:     make(chan recorderPacket, recorderInChSize),
+		removeCh: make(chan string, recorderRemoveChSize),
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+		removed:  map[string]bool{},
+	}, nil
+}
+
+func (r *callRecorder) start() {
+	go r.run()
+}
+
+// stop stops the recorder, waiting for all the queued packets to be written
+// and the files to be finalized. It's safe to call multiple times.
+func (r *callRecorder) stop() {
+	r.mut.Lock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.stopCh)
+	}
+	r.mut.Unlock()
+	<-r.doneCh
+}
+
+// push queues a packet for recording. It's meant to be called from the
+// forwarding path, so it never blocks.
+func (r *callRecorder) push(track RecordingTrack, packet *rtp.Packet) {
+	if len(packet.Payload) == 0 {
+		return
+	}
+
+	// The packet gets forwarded afterwards so we need our own copy.
+	select {
+	case r.inCh <- recorderPacket{track: track, packet: packet.Clone()}:
+	default:
+		r.drops.droppedMessage(r.groupID, "recorder", "rtp", mlog.String("sessionID", track.SessionID))
+	}
+}
+
+// removeSession stops recording the tracks sent by the given session. The
+// files are finalized asynchronously.
+func (r *callRecorder) removeSession(sessionID string) {
+	r.mut.Lock()
+	r.removed[sessionID] = true
+	r.mut.Unlock()
+
+	// If the channel is full the tracks get finalized when the recording
+	// stops. Packets are ignored in the meantime.
+	select {
+	case r.removeCh <- sessionID:
+	default:
+	}
+}
+
+func (r *callRecorder) isRemoved(sessionID string) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.removed[sessionID]
+}
+
+func (r *callRecorder) run() {
+	defer close(r.doneCh)
+
+	for {
+		select {
+		case pkt := <-r.inCh:
+			r.write(pkt)
+		case sessionID := <-r.removeCh:
+			r.closeSession(sessionID)
+		case <-r.stopCh:
+			// Flushing whatever is left.
+			for {
+				select {
+				case pkt := <-r.inCh:
+					r.write(pkt)
+				default:
+					r.closeAll()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *callRecorder) newWriter(track RecordingTrack) (media.Writer, error) {
+	path, err := r.pathFn(track)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recording path: %w", err)
+	}
+
+	// The file based writers are used as they finalize the output on close
+	// (i.e. Ogg EOS page, IVF frame count).
+	if track.MimeType == webrtc.MimeTypeOpus {
+		return oggwriter.New(path, rtpAudioClockRate, recorderChannels)
+	}
+
+	return ivfwriter.New(path, ivfwriter.WithCodec(track.MimeType))
+}
+
+func (r *callRecorder) write(pkt recorderPacket) {
+	if r.isRemoved(pkt.track.SessionID) {
+		return
+	}
+
+	ssrc := pkt.packet.SSRC
+	w, ok := r.writers[ssrc]
+	if !ok {
+		var err error
+		w, err = r.newWriter(pkt.track)
+		if err != nil {
+			r.log.Error("failed to create track writer", mlog.Err(err),
+				mlog.String("sessionID", pkt.track.SessionID), mlog.String("trackType", pkt.track.Type))
+			w = nil
+		}
+		r.writers[ssrc] = w
+		r.sessions[ssrc] = pkt.track.SessionID
+	}
+	if w == nil {
+		return
+	}
+
+	if err := w.WriteRTP(pkt.packet); err != nil {
+		r.log.Error("failed to record packet", mlog.Err(err), mlog.String("sessionID", pkt.track.SessionID))
+		return
+	}
+	r.metrics.AddRTCRecordingBytes(r.groupID, len(pkt.packet.Payload))
+}
+
+func (r *callRecorder) closeWriter(ssrc uint32) {
+	if w := r.writers[ssrc]; w != nil {
+		if err := w.Close(); err != nil {
+			r.log.Error("failed to close track writer", mlog.Err(err), mlog.String("sessionID", r.sessions[ssrc]))
+		}
+	}
+	delete(r.writers, ssrc)
+	delete(r.sessions, ssrc)
+}
+
+func (r *callRecorder) closeSession(sessionID string) {
+	for ssrc, id := range r.sessions {
+		if id == sessionID {
+			r.closeWriter(ssrc)
+		}
+	}
+}
+
+func (r *callRecorder) closeAll() {
+	for ssrc := range r.writers {
+		r.closeWriter(ssrc)
+	}
+}
+
+// StartRecording starts recording the tracks (voice, screen sharing audio and
+// video) forwarded in the given call. Each track is written to its own file,
+// at the path returned by pathFn. Tracks from E2EE sessions are skipped since
+// their payload can't be accessed, and so are screen tracks using codecs
+// that can't be stored in IVF (i.e. VP9). The recording is automatically
+// stopped when the call ends.
+func (s *Server) StartRecording(groupID, callID string, pathFn RecordingPathFunc) error {
+	g := s.getGroup(groupID)
+	if g == nil {
+		return ErrCallNotFound
+	}
+	c := g.getCall(callID)
+	if c == nil {
+		return ErrCallNotFound
+	}
+
+	r, err := newCallRecorder(groupID, pathFn, s.log.With(mlog.String("callID", callID)), s.metrics, s.drops)
+	if err != nil {
+		return fmt.Errorf("failed to create recorder: %w", err)
+	}
+
+	if !c.recorder.CompareAndSwap(nil, r) {
+		return ErrRecordingActive
+	}
+	r.start()
+
+	// Video can only be written starting from a key frame. Requesting it takes
+	// the call lock so it can't be done while iterating.
+	var sessions []*session
+	c.iterSessions(func(ss *session) {
+		sessions = append(sessions, ss)
+	})
+	for _, ss := range sessions {
+		for _, mimeType := range screenTrackMimeTypes {
+			if !isRecordableMimeType(mimeType) || ss.getRemoteScreenTrack(mimeType, getRecordedScreenLevel(ss, mimeType)) == nil {
+				continue
+			}
+			if err := ss.requestScreenKeyFrame(mimeType, getRecordedScreenLevel(ss, mimeType)); err != nil {
+				s.log.Error("failed to request key frame", mlog.Err(err), mlog.String("sessionID", ss.cfg.SessionID))
+			}
+		}
+	}
+
+	return nil
+}
+
+// getRecordedScreenLevel returns the simulcast level of the screen track
+// that gets recorded for the given session and codec: the highest one if
+// simulcast is used.
+func getRecordedScreenLevel(ss *session, mimeType string) string {
+	if ss.getRemoteScreenTrack(mimeType, SimulcastLevelHigh) != nil {
+		return SimulcastLevelHigh
+	}
+	return ""
+}
+
+// StopRecording stops the recording for the given call, if any, finalizing
+// its files.
+func (s *Server) StopRecording(groupID, callID string) error {
+	g := s.getGroup(groupID)
+	if g == nil {
+		return ErrCallNotFound
+	}
+	c := g.getCall(callID)
+	if c == nil {
+		return ErrCallNotFound
+	}
+
+	if r := c.recorder.Swap(nil); r != nil {
+		r.stop()
+	}
+
+	return nil
+}
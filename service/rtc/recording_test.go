@@ -0,0 +1,299 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/perf"
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media/ivfreader"
+	"github.com/pion/webrtc/v4/pkg/media/oggreader"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+// testRecordingPaths returns a path func writing the recorded tracks to the
+// given directory, keeping track of the requested paths.
+func testRecordingPaths(dir string) (RecordingPathFunc, func() map[string]RecordingTrack) {
+	var mut sync.Mutex
+	paths := map[string]RecordingTrack{}
+	pathFn := func(track RecordingTrack) (string, error) {
+		mut.Lock()
+		defer mut.Unlock()
+		ext := "ivf"
+		if track.MimeType == webrtc.MimeTypeOpus {
+			ext = "ogg"
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%s_%s.%s", track.SessionID, track.Type, ext))
+		paths[path] = track
+		return path, nil
+	}
+	return pathFn, func() map[string]RecordingTrack {
+		mut.Lock()
+		defer mut.Unlock()
+		return maps.Clone(paths)
+	}
+}
+
+func TestStartRecording(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+
+	pathFn, getPaths := testRecordingPaths(t.TempDir())
+
+	err = s.StartRecording(groupID, callID, pathFn)
+	require.ErrorIs(t, err, ErrCallNotFound)
+
+	cfg := SessionConfig{
+		GroupID:   groupID,
+		CallID:    callID,
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+
+	initSession := setupTestPeers(t, s)
+
+	voiceTrack, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, "voice", random.NewID())
+	require.NoError(t, err)
+	screenTrack, err := webrtc.NewTrackLocalStaticRTP(rtpVideoCodecs[webrtc.MimeTypeVP8].RTPCodecCapability, "screen", "screenStream")
+	require.NoError(t, err)
+	pc := initSession(cfg, voiceTrack, screenTrack)
+	defer pc.Close()
+
+	data, err := json.Marshal(map[string]string{"screenStreamID": "screenStream"})
+	require.NoError(t, err)
+	err = s.Send(Message{
+		GroupID:   cfg.GroupID,
+		CallID:    cfg.CallID,
+		UserID:    cfg.UserID,
+		SessionID: cfg.SessionID,
+		Type:      ScreenOnMessage,
+		Data:      data,
+	})
+	require.NoError(t, err)
+
+	c := s.getGroup(groupID).getCall(callID)
+
+	err = s.StartRecording(groupID, callID, nil)
+	require.EqualError(t, err, "failed to create recorder: invalid path func: should not be nil")
+
+	err = s.StartRecording(groupID, callID, pathFn)
+	require.NoError(t, err)
+	require.NotNil(t, c.recorder.Load())
+
+	err = s.StartRecording(groupID, callID, pathFn)
+	require.ErrorIs(t, err, ErrRecordingActive)
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		var seq uint16
+		for {
+			select {
+			case <-ticker.C:
+				seq++
+				_ = voiceTrack.WriteRTP(&rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						SequenceNumber: seq,
+						Timestamp:      uint32(seq) * 960,
+					},
+					// TOC byte for a 20ms SILK frame followed by some data.
+					Payload: append([]byte{0x08}, random.NewID()...),
+				})
+				_ = screenTrack.WriteRTP(&rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						SequenceNumber: seq,
+						Timestamp:      uint32(seq) * 1800,
+						Marker:         true,
+					},
+					// Single packet VP8 key frames.
+					Payload: []byte{0x10, 0x00, 0x00, 0x00},
+				})
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	fileSize := func(path string) int64 {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0
+		}
+		return info.Size()
+	}
+
+	// Waiting for both tracks to be written past their headers.
+	require.Eventually(t, func() bool {
+		paths := getPaths()
+		if len(paths) != 2 {
+			return false
+		}
+		for path := range paths {
+			if fileSize(path) < 1024 {
+				return false
+			}
+		}
+		return true
+	}, 10*time.Second, 50*time.Millisecond)
+	close(stopCh)
+	<-doneCh
+
+	err = s.StopRecording(groupID, callID)
+	require.NoError(t, err)
+	require.Nil(t, c.recorder.Load())
+
+	// Stopping again is a no-op.
+	err = s.StopRecording(groupID, callID)
+	require.NoError(t, err)
+
+	paths := getPaths()
+	var oggPath, ivfPath string
+	for path, track := range paths {
+		require.Equal(t, cfg.SessionID, track.SessionID)
+		switch track.MimeType {
+		case webrtc.MimeTypeOpus:
+			require.Equal(t, string(trackTypeVoice), track.Type)
+			oggPath = path
+		case webrtc.MimeTypeVP8:
+			require.Equal(t, string(trackTypeScreen), track.Type)
+			ivfPath = path
+		}
+	}
+
+	t.Run("valid ogg", func(t *testing.T) {
+		data, err := os.ReadFile(oggPath)
+		require.NoError(t, err)
+
+		reader, header, err := oggreader.NewWith(bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, uint8(recorderChannels), header.Channels)
+		require.Equal(t, uint32(rtpAudioClockRate), header.SampleRate)
+
+		var pages int
+		var granule uint64
+		for {
+			segments, pageHeader, err := reader.ParseNextPage()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			require.NotEmpty(t, segments)
+			require.GreaterOrEqual(t, pageHeader.GranulePosition, granule)
+			granule = pageHeader.GranulePosition
+			pages++
+		}
+		require.Greater(t, pages, 10)
+		require.NotZero(t, granule)
+
+		// The last page should be flagged as the end of the stream.
+		lastPage := bytes.LastIndex(data, []byte("OggS"))
+		require.NotEqual(t, -1, lastPage)
+		require.NotZero(t, data[lastPage+5]&0x04)
+	})
+
+	t.Run("valid ivf", func(t *testing.T) {
+		f, err := os.Open(ivfPath)
+		require.NoError(t, err)
+		defer f.Close()
+
+		reader, header, err := ivfreader.NewWith(f)
+		require.NoError(t, err)
+		require.Equal(t, "VP80", header.FourCC)
+
+		var frames uint32
+		for {
+			_, _, err := reader.ParseNextFrame()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			frames++
+		}
+		require.Greater(t, frames, uint32(10))
+		require.Equal(t, frames, header.NumFrames)
+	})
+
+	// The recording should be stopped when the call ends.
+	pathFn, _ = testRecordingPaths(t.TempDir())
+	err = s.StartRecording(groupID, callID, pathFn)
+	require.NoError(t, err)
+	r := c.recorder.Load()
+	require.NotNil(t, r)
+
+	err = s.CloseSession(cfg.SessionID, CloseReasonLeft)
+	require.NoError(t, err)
+	require.Nil(t, c.recorder.Load())
+	select {
+	case <-r.doneCh:
+	default:
+		require.Fail(t, "recorder should be stopped")
+	}
+}
+
+func TestCallRecorderRemoveSession(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	pathFn, getPaths := testRecordingPaths(t.TempDir())
+	metrics := newServerMetrics(perf.NewMetrics("rtcd", nil))
+	r, err := newCallRecorder("groupID", pathFn, log, metrics, newDroppedMessages(log, metrics, 0))
+	require.NoError(t, err)
+	r.start()
+	defer r.stop()
+
+	track := RecordingTrack{
+		SessionID: "sessionA",
+		Type:      string(trackTypeVoice),
+		MimeType:  webrtc.MimeTypeOpus,
+		SSRC:      1,
+	}
+	packet := &rtp.Packet{
+		Header:  rtp.Header{Version: 2, SSRC: 1},
+		Payload: []byte{0x08, 0x01},
+	}
+
+	r.push(track, packet)
+	require.Eventually(t, func() bool {
+		return len(getPaths()) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	r.removeSession("sessionA")
+
+	// A late packet shouldn't re-open the track.
+	r.push(track, packet)
+	r.stop()
+	require.Len(t, getPaths(), 1)
+	require.Empty(t, r.writers)
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+)
+
+const rtcpRsizeAttr = "a=rtcp-rsize"
+
+// rtcpCompoundInterceptor makes sure all outgoing RTCP packets are sent as
+// compound packets (RFC 3550) unless reduced-size RTCP (RFC 5506) has been
+// negotiated with the remote peer.
+type rtcpCompoundInterceptor struct {
+	interceptor.NoOp
+
+	// enabled controls whether reduced-size RTCP should be advertised.
+	enabled bool
+	// reducedSize is set when both sides support reduced-size RTCP.
+	reducedSize atomic.Bool
+
+	ssrc  uint32
+	cname string
+}
+
+func newRTCPCompoundInterceptor(enabled bool, ssrc uint32, cname string) *rtcpCompoundInterceptor {
+	return &rtcpCompoundInterceptor{
+		enabled: enabled,
+		ssrc:    ssrc,
+		cname:   cname,
+	}
+}
+
+// NewInterceptor implements interceptor.Factory. The registry is built once
+// per peer connection so we can return the same instance.
+func (i *rtcpCompoundInterceptor) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+	return i, nil
+}
+
+func (i *rtcpCompoundInterceptor) BindRTCPWriter(writer interceptor.RTCPWriter) interceptor.RTCPWriter {
+	return interceptor.RTCPWriterFunc(func(pkts []rtcp.Packet, attributes interceptor.Attributes) (int, error) {
+		if !i.reducedSize.Load() {
+			pkts = i.makeCompound(pkts)
+		}
+		return writer.Write(pkts, attributes)
+	})
+}
+
+// makeCompound prepends a receiver report and adds a CNAME source
+// description, if missing, so that the resulting packet is a valid compound
+// RTCP packet.
+func (i *rtcpCompoundInterceptor) makeCompound(pkts []rtcp.Packet) []rtcp.Packet {
+	if len(pkts) == 0 {
+		return pkts
+	}
+
+	var reportsCount int
+	var hasSDES bool
+	for idx, pkt := range pkts {
+		switch pkt.(type) {
+		case *rtcp.SenderReport, *rtcp.ReceiverReport:
+			if idx == reportsCount {
+				reportsCount++
+			}
+		case *rtcp.SourceDescription:
+			hasSDES = true
+		}
+	}
+
+	compound := make([]rtcp.Packet, 0, len(pkts)+2)
+	if reportsCount == 0 {
+		compound = append(compound, &rtcp.ReceiverReport{SSRC: i.ssrc})
+	}
+	compound = append(compound, pkts[:reportsCount]...)
+	if !hasSDES {
+		compound = append(compound, &rtcp.SourceDescription{
+			Chunks: []rtcp.SourceDescriptionChunk{{
+				Source: i.ssrc,
+				Items: []rtcp.SourceDescriptionItem{{
+					Type: rtcp.SDESCNAME,
+					Text: i.cname,
+				}},
+			}},
+		})
+	}
+	compound = append(compound, pkts[reportsCount:]...)
+
+	return compound
+}
+
+// onRemoteDescription updates the negotiated state given the remote SDP.
+func (i *rtcpCompoundInterceptor) onRemoteDescription(sdp string) {
+	if i == nil {
+		return
+	}
+	i.reducedSize.Store(i.enabled && hasRTCPRsize(sdp))
+}
+
+// localDescription returns the SDP to be sent to the remote peer, removing
+// the reduced-size RTCP attribute if not enabled.
+func (i *rtcpCompoundInterceptor) localDescription(sdp string) string {
+	if i == nil || i.enabled {
+		return sdp
+	}
+	return stripRTCPRsize(sdp)
+}
+
+func hasRTCPRsize(sdp string) bool {
+	for _, line := range strings.Split(sdp, "\n") {
+		if strings.TrimSpace(line) == rtcpRsizeAttr {
+			return true
+		}
+	}
+	return false
+}
+
+func stripRTCPRsize(sdp string) string {
+	lines := strings.SplitAfter(sdp, "\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if strings.TrimSpace(line) == rtcpRsizeAttr {
+			continue
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "")
+}
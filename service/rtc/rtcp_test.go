@@ -0,0 +1,140 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRTCPCompoundInterceptor(t *testing.T) {
+	i := newRTCPCompoundInterceptor(true, 45454545, "cname")
+
+	t.Run("empty", func(t *testing.T) {
+		require.Empty(t, i.makeCompound(nil))
+	})
+
+	t.Run("feedback only", func(t *testing.T) {
+		pli := &rtcp.PictureLossIndication{MediaSSRC: 1}
+		pkts := i.makeCompound([]rtcp.Packet{pli})
+		require.Len(t, pkts, 3)
+		require.IsType(t, &rtcp.ReceiverReport{}, pkts[0])
+		require.IsType(t, &rtcp.SourceDescription{}, pkts[1])
+		require.Equal(t, pli, pkts[2])
+
+		_, err := rtcp.Marshal(pkts)
+		require.NoError(t, err)
+	})
+
+	t.Run("report first", func(t *testing.T) {
+		sr := &rtcp.SenderReport{SSRC: 1}
+		pli := &rtcp.PictureLossIndication{MediaSSRC: 1}
+		pkts := i.makeCompound([]rtcp.Packet{sr, pli})
+		require.Len(t, pkts, 3)
+		require.Equal(t, sr, pkts[0])
+		require.IsType(t, &rtcp.SourceDescription{}, pkts[1])
+		require.Equal(t, pli, pkts[2])
+	})
+
+	t.Run("already compound", func(t *testing.T) {
+		rr := &rtcp.ReceiverReport{SSRC: 1}
+		sdes := &rtcp.SourceDescription{}
+		pkts := i.makeCompound([]rtcp.Packet{rr, sdes})
+		require.Equal(t, []rtcp.Packet{rr, sdes}, pkts)
+	})
+
+	t.Run("negotiation", func(t *testing.T) {
+		i.onRemoteDescription("v=0\r\na=rtcp-mux\r\n")
+		require.False(t, i.reducedSize.Load())
+
+		i.onRemoteDescription("v=0\r\na=rtcp-mux\r\na=rtcp-rsize\r\n")
+		require.True(t, i.reducedSize.Load())
+
+		disabled := newRTCPCompoundInterceptor(false, 45454545, "cname")
+		disabled.onRemoteDescription("v=0\r\na=rtcp-mux\r\na=rtcp-rsize\r\n")
+		require.False(t, disabled.reducedSize.Load())
+		require.Equal(t, "v=0\r\na=rtcp-mux\r\n", disabled.localDescription("v=0\r\na=rtcp-mux\r\na=rtcp-rsize\r\n"))
+	})
+}
+
+func TestRTCPReducedSizeNegotiation(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	getAnswer := func(t *testing.T) string {
+		t.Helper()
+
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+		require.NoError(t, err)
+		defer pc.Close()
+
+		_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionRecvonly,
+		})
+		require.NoError(t, err)
+
+		offer, err := pc.CreateOffer(nil)
+		require.NoError(t, err)
+		require.True(t, hasRTCPRsize(offer.SDP))
+
+		offerData, err := json.Marshal(&offer)
+		require.NoError(t, err)
+
+		err = s.Send(Message{
+			GroupID:   cfg.GroupID,
+			CallID:    cfg.CallID,
+			UserID:    cfg.UserID,
+			SessionID: cfg.SessionID,
+			Type:      SDPMessage,
+			Data:      offerData,
+		})
+		require.NoError(t, err)
+
+		for msg := range s.ReceiveCh() {
+			if msg.Type != SDPMessage {
+				continue
+			}
+			var answer webrtc.SessionDescription
+			err := json.Unmarshal(msg.Data, &answer)
+			require.NoError(t, err)
+			require.Equal(t, webrtc.SDPTypeAnswer, answer.Type)
+			return answer.SDP
+		}
+
+		return ""
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		s.cfg.EnableRTCPReducedSize = true
+		defer func() { s.cfg.EnableRTCPReducedSize = false }()
+		require.True(t, strings.Contains(getAnswer(t), rtcpRsizeAttr))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		require.False(t, strings.Contains(getAnswer(t), rtcpRsizeAttr))
+	})
+}
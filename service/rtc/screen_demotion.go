@@ -0,0 +1,261 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"math"
+	"strings"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+const screenDemotionDefaultTargetFPS = 5
+
+// SetCPUUsage updates the CPU usage of the node, expressed as a fraction in
+// the [0, 1] range. It's used to decide whether forwarded screen share tracks
+// should be demoted (ServerConfig.ScreenDemotionCPUThreshold) and whether new
+// sessions should be rejected (ServerConfig.MaxCPUUtilization).
+func (s *Server) SetCPUUsage(usage float64) {
+	s.cpuUsage.Store(math.Float64bits(usage))
+}
+
+// isUnderCPUPressure returns whether screen share demotion is enabled and the
+// CPU usage is above the configured threshold.
+func (s *Server) isUnderCPUPressure() bool {
+	if s.cfg.ScreenDemotionCPUThreshold == 0 {
+		return false
+	}
+	return math.Float64frombits(s.cpuUsage.Load()) >= s.cfg.ScreenDemotionCPUThreshold
+}
+
+// isOverloaded returns whether admission control is enabled and the CPU usage
+// is above the configured limit.
+func (s *Server) isOverloaded() bool {
+	if s.cfg.MaxCPUUtilization == 0 {
+		return false
+	}
+	return math.Float64frombits(s.cpuUsage.Load()) > s.cfg.MaxCPUUtilization
+}
+
+// newScreenFrameDropper returns a frame dropper for the screen share output
+// track at the given index, or nil if the track should never be demoted.
+// To only affect a subset of receivers, just the second half of the output
+// tracks (among which receivers are randomly distributed) gets demoted.
+func (s *Server) newScreenFrameDropper(idx, numTracks int, clockRate uint32, mimeType string) *frameDropper {
+	if s.cfg.ScreenDemotionCPUThreshold == 0 || idx < numTracks/2 {
+		return nil
+	}
+
+	fps := s.cfg.ScreenDemotionTargetFPS
+	if fps == 0 {
+		fps = screenDemotionDefaultTargetFPS
+	}
+
+	return newFrameDropper(clockRate, fps, mimeType)
+}
+
+// frameLayerInfo holds what's known about the dependencies of a video frame.
+type frameLayerInfo struct {
+	// independent is set if the frame is a keyframe.
+	independent bool
+	// discardable is set if no other frame depends on this one.
+	discardable bool
+	// temporalID is the temporal layer of the frame.
+	temporalID uint8
+}
+
+// parseVP8LayerInfo returns the layer information found in the VP8 payload
+// descriptor (RFC 7741) of the given payload, if any.
+func parseVP8LayerInfo(payload []byte) (frameLayerInfo, bool) {
+	if len(payload) == 0 {
+		return frameLayerInfo{}, false
+	}
+
+	info := frameLayerInfo{
+		discardable: payload[0]&0x20 != 0,
+	}
+	hasTID := false
+
+	// Extended control bits.
+	if payload[0]&0x80 != 0 && len(payload) > 1 {
+		ext := payload[1]
+		off := 2
+		if ext&0x80 != 0 {
+			// PictureID, two bytes long if M is set.
+			if len(payload) <= off {
+				return frameLayerInfo{}, false
+			}
+			if payload[off]&0x80 != 0 {
+				off++
+			}
+			off++
+		}
+		if ext&0x40 != 0 {
+			// TL0PICIDX
+			off++
+		}
+		if ext&0x20 != 0 {
+			if len(payload) <= off {
+				return frameLayerInfo{}, false
+			}
+			info.temporalID = payload[off] >> 6
+			hasTID = true
+		}
+	}
+
+	return info, info.discardable || hasTID
+}
+
+// parseVP9LayerInfo returns the layer information found in the VP9 payload
+// descriptor (RFC 9628) of the given payload, if any. With SVC, all the
+// spatial layers of a picture share the same timestamp so they are dropped
+// or forwarded together, along with the temporal layer they belong to.
+func parseVP9LayerInfo(payload []byte) (frameLayerInfo, bool) {
+	if len(payload) == 0 {
+		return frameLayerInfo{}, false
+	}
+
+	// Layer indices are only present if L is set.
+	if payload[0]&0x20 == 0 {
+		return frameLayerInfo{}, false
+	}
+
+	info := frameLayerInfo{
+		// P unset means no inter-picture prediction.
+		independent: payload[0]&0x40 == 0,
+	}
+
+	off := 1
+	if payload[0]&0x80 != 0 {
+		// PictureID, two bytes long if M is set.
+		if len(payload) <= off {
+			return frameLayerInfo{}, false
+		}
+		if payload[off]&0x80 != 0 {
+			off++
+		}
+		off++
+	}
+	if len(payload) <= off {
+		return frameLayerInfo{}, false
+	}
+	info.temporalID = payload[off] >> 5
+
+	return info, true
+}
+
+// frameDropper drops whole video frames to limit the rate of a forwarded
+// track to a target FPS. Only frames known not to be referenced by the ones
+// that get forwarded are dropped: frames marked as discardable and frames in
+// temporal layers above the base one, along with any later frame that could
+// depend on them. Streams carrying no such information are never thinned.
+// Sequence numbers of the forwarded packets are rewritten so that receivers
+// don't detect the dropped ones as lost.
+// It's not safe for concurrent use.
+type frameDropper struct {
+	// minInterval is the minimum distance between forwarded frames, in RTP
+	// timestamp units.
+	minInterval uint32
+	// parseLayerInfo reads the layer information from the payload descriptor
+	// when frame marking is not available. It's nil if the codec doesn't
+	// carry any.
+	parseLayerInfo func(payload []byte) (frameLayerInfo, bool)
+
+	started     bool
+	dropping    bool
+	frameTS     uint32
+	forwardedTS uint32
+	seqOffset   uint16
+	// droppedTID is the lowest temporal layer (above the base one) of the
+	// referenced frames dropped since a frame from a lower layer was last
+	// forwarded. Frames from this layer and above can depend on them so they
+	// need to be dropped as well. A zero value means none.
+	droppedTID uint8
+	// layered is whether the last frame carried layer information.
+	layered bool
+}
+
+func newFrameDropper(clockRate uint32, fps int, mimeType string) *frameDropper {
+	d := &frameDropper{
+		minInterval: clockRate / uint32(fps),
+	}
+
+	switch {
+	case strings.EqualFold(mimeType, webrtc.MimeTypeVP8):
+		d.parseLayerInfo = parseVP8LayerInfo
+	case strings.EqualFold(mimeType, webrtc.MimeTypeVP9):
+		d.parseLayerInfo = parseVP9LayerInfo
+	}
+
+	return d
+}
+
+func (d *frameDropper) getLayerInfo(pkt *rtp.Packet, marking *frameMarking) (frameLayerInfo, bool) {
+	if marking != nil {
+		return frameLayerInfo{
+			independent: marking.independent,
+			discardable: marking.discardable,
+			temporalID:  marking.temporalID,
+		}, true
+	}
+
+	if d.parseLayerInfo != nil {
+		return d.parseLayerInfo(pkt.Payload)
+	}
+
+	return frameLayerInfo{}, false
+}
+
+// thinnable returns whether the stream can currently be thinned, that is
+// whether the last frame carried layer information.
+func (d *frameDropper) thinnable() bool {
+	return d.layered
+}
+
+// drop returns whether the given packet should be dropped. Frames are only
+// dropped to limit the rate while active is set, although frames depending
+// on previously dropped ones keep being dropped regardless.
+// If the packet is to be forwarded, its sequence number is adjusted to
+// account for the previously dropped ones.
+func (d *frameDropper) drop(pkt *rtp.Packet, marking *frameMarking, active bool) bool {
+	if !d.started || pkt.Timestamp != d.frameTS {
+		// First packet of a new frame: packets belonging to the same frame
+		// share the same timestamp.
+		info, ok := d.getLayerInfo(pkt, marking)
+		d.layered = ok
+
+		switch {
+		case !d.started || !ok || info.independent:
+			d.dropping = false
+		case d.droppedTID > 0 && info.temporalID >= d.droppedTID:
+			// The frame could reference a dropped one.
+			d.dropping = true
+		case info.discardable || info.temporalID > 0:
+			d.dropping = active && pkt.Timestamp-d.forwardedTS < d.minInterval
+			if d.dropping && !info.discardable {
+				d.droppedTID = info.temporalID
+			}
+		default:
+			d.dropping = false
+		}
+
+		if !d.dropping {
+			d.forwardedTS = pkt.Timestamp
+			if !ok || info.independent || info.temporalID < d.droppedTID {
+				d.droppedTID = 0
+			}
+		}
+		d.started = true
+		d.frameTS = pkt.Timestamp
+	}
+
+	if d.dropping {
+		d.seqOffset++
+		return true
+	}
+
+	pkt.SequenceNumber -= d.seqOffset
+	return false
+}
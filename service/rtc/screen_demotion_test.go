@@ -0,0 +1,258 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScreenDemotion(t *testing.T) {
+	const (
+		clockRate       = 90000
+		sourceFPS       = 30
+		pktsPerFrame    = 3
+		durationSeconds = 2
+	)
+
+	// l1t3 returns the frame marking of the i-th frame of a stream with
+	// three temporal layers.
+	l1t3 := func(i int) *frameMarking {
+		tid := []uint8{0, 2, 1, 2}[i%4]
+		return &frameMarking{
+			independent: i == 0,
+			discardable: tid == 2,
+			temporalID:  tid,
+		}
+	}
+
+	noMarking := func(_ int) *frameMarking {
+		return nil
+	}
+
+	// forward pushes durationSeconds worth of sourceFPS video through the
+	// dropper and returns the forwarded packets.
+	forward := func(s *Server, d *frameDropper, seq uint16, ts uint32, marking func(i int) *frameMarking) []*rtp.Packet {
+		var forwarded []*rtp.Packet
+		for i := 0; i < sourceFPS*durationSeconds; i++ {
+			for j := 0; j < pktsPerFrame; j++ {
+				pkt := &rtp.Packet{
+					Header: rtp.Header{
+						SequenceNumber: seq,
+						Timestamp:      ts,
+						Marker:         j == pktsPerFrame-1,
+					},
+				}
+				seq++
+				if !d.drop(pkt, marking(i), s.isUnderCPUPressure()) {
+					forwarded = append(forwarded, pkt)
+				}
+			}
+			ts += clockRate / sourceFPS
+		}
+		return forwarded
+	}
+
+	requireContiguous := func(t *testing.T, pkts []*rtp.Packet) {
+		t.Helper()
+		for i := 1; i < len(pkts); i++ {
+			require.Equal(t, pkts[i-1].SequenceNumber+1, pkts[i].SequenceNumber)
+		}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		s := &Server{}
+		s.SetCPUUsage(1)
+		require.False(t, s.isUnderCPUPressure())
+		require.Nil(t, s.newScreenFrameDropper(1, 2, clockRate, webrtc.MimeTypeVP8))
+	})
+
+	t.Run("subset of tracks", func(t *testing.T) {
+		s := &Server{cfg: ServerConfig{ScreenDemotionCPUThreshold: 0.8}}
+		require.Nil(t, s.newScreenFrameDropper(0, 4, clockRate, webrtc.MimeTypeVP8))
+		require.Nil(t, s.newScreenFrameDropper(1, 4, clockRate, webrtc.MimeTypeVP8))
+		require.NotNil(t, s.newScreenFrameDropper(2, 4, clockRate, webrtc.MimeTypeVP8))
+		require.NotNil(t, s.newScreenFrameDropper(3, 4, clockRate, webrtc.MimeTypeVP8))
+		require.NotNil(t, s.newScreenFrameDropper(0, 1, clockRate, webrtc.MimeTypeVP8))
+	})
+
+	t.Run("cpu pressure", func(t *testing.T) {
+		s := &Server{cfg: ServerConfig{ScreenDemotionCPUThreshold: 0.8, ScreenDemotionTargetFPS: 5}}
+		d := s.newScreenFrameDropper(1, 2, clockRate, webrtc.MimeTypeVP8)
+		require.NotNil(t, d)
+
+		// No pressure, everything is forwarded.
+		s.SetCPUUsage(0.5)
+		require.False(t, s.isUnderCPUPressure())
+		forwarded := forward(s, d, 1000, 0, l1t3)
+		require.Len(t, forwarded, sourceFPS*durationSeconds*pktsPerFrame)
+		requireContiguous(t, forwarded)
+		require.True(t, d.thinnable())
+
+		// High CPU, the forwarded rate should go down as close to the target
+		// FPS as the layers allow, that is down to the base layer (a fourth
+		// of the frames).
+		s.SetCPUUsage(0.9)
+		require.True(t, s.isUnderCPUPressure())
+		demoted := forward(s, d, 1000+uint16(len(forwarded)), clockRate*durationSeconds, l1t3)
+		require.Len(t, demoted, sourceFPS*durationSeconds*pktsPerFrame/4)
+		requireContiguous(t, append(forwarded[len(forwarded)-1:], demoted...))
+
+		// Only whole frames should be forwarded.
+		for i := 0; i < len(demoted); i += pktsPerFrame {
+			for j := 1; j < pktsPerFrame; j++ {
+				require.Equal(t, demoted[i].Timestamp, demoted[i+j].Timestamp)
+			}
+			require.True(t, demoted[i+pktsPerFrame-1].Marker)
+		}
+
+		// Pressure going away should restore the full rate.
+		s.SetCPUUsage(0.1)
+		restored := forward(s, d, 1000+uint16(2*len(forwarded)), 2*clockRate*durationSeconds, l1t3)
+		require.Len(t, restored, sourceFPS*durationSeconds*pktsPerFrame)
+		requireContiguous(t, append(demoted[len(demoted)-1:], restored...))
+	})
+
+	t.Run("no layer information", func(t *testing.T) {
+		s := &Server{cfg: ServerConfig{ScreenDemotionCPUThreshold: 0.8, ScreenDemotionTargetFPS: 5}}
+		d := s.newScreenFrameDropper(1, 2, clockRate, webrtc.MimeTypeAV1)
+		require.NotNil(t, d)
+
+		// Frames that could be referenced are never dropped.
+		s.SetCPUUsage(0.9)
+		forwarded := forward(s, d, 1000, 0, noMarking)
+		require.Len(t, forwarded, sourceFPS*durationSeconds*pktsPerFrame)
+		require.False(t, d.thinnable())
+	})
+
+	t.Run("dependent frames", func(t *testing.T) {
+		s := &Server{cfg: ServerConfig{ScreenDemotionCPUThreshold: 0.8, ScreenDemotionTargetFPS: 5}}
+		d := s.newScreenFrameDropper(1, 2, clockRate, webrtc.MimeTypeVP8)
+		require.NotNil(t, d)
+
+		pushFrame := func(i int, active bool) bool {
+			pkt := &rtp.Packet{
+				Header: rtp.Header{
+					SequenceNumber: uint16(i),
+					Timestamp:      uint32(i) * clockRate / sourceFPS,
+				},
+			}
+			return d.drop(pkt, l1t3(i), active)
+		}
+
+		require.False(t, pushFrame(0, true)) // T0, keyframe
+		require.True(t, pushFrame(1, true))  // T2
+		require.True(t, pushFrame(2, true))  // T1
+
+		// The next T2 frame references the dropped T1 one so it must be
+		// dropped even though the pressure went away.
+		require.True(t, pushFrame(3, false))  // T2
+		require.False(t, pushFrame(4, false)) // T0
+		require.False(t, pushFrame(5, false)) // T2
+	})
+}
+
+func TestParseVP8LayerInfo(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		_, ok := parseVP8LayerInfo(nil)
+		require.False(t, ok)
+	})
+
+	t.Run("no information", func(t *testing.T) {
+		_, ok := parseVP8LayerInfo([]byte{0x10, 0x00})
+		require.False(t, ok)
+	})
+
+	t.Run("non-reference frame", func(t *testing.T) {
+		info, ok := parseVP8LayerInfo([]byte{0x30, 0x00})
+		require.True(t, ok)
+		require.True(t, info.discardable)
+	})
+
+	t.Run("temporal layer", func(t *testing.T) {
+		// X, I (with two bytes picture ID), L and T set.
+		info, ok := parseVP8LayerInfo([]byte{0x90, 0xe0, 0x80, 0x01, 0x05, 0x80, 0x00})
+		require.True(t, ok)
+		require.False(t, info.discardable)
+		require.Equal(t, uint8(2), info.temporalID)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, ok := parseVP8LayerInfo([]byte{0x90, 0xe0, 0x80, 0x01})
+		require.False(t, ok)
+	})
+}
+
+func TestParseVP9LayerInfo(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		_, ok := parseVP9LayerInfo(nil)
+		require.False(t, ok)
+	})
+
+	t.Run("no layer indices", func(t *testing.T) {
+		_, ok := parseVP9LayerInfo([]byte{0x8c, 0x00, 0x00})
+		require.False(t, ok)
+	})
+
+	t.Run("key frame", func(t *testing.T) {
+		// I (with two bytes picture ID), L, B and E set, P unset.
+		info, ok := parseVP9LayerInfo([]byte{0xac, 0x80, 0x01, 0x00, 0x00})
+		require.True(t, ok)
+		require.True(t, info.independent)
+		require.Equal(t, uint8(0), info.temporalID)
+	})
+
+	t.Run("temporal layer", func(t *testing.T) {
+		// I (with one byte picture ID), P and L set, TID 2 and SID 1.
+		info, ok := parseVP9LayerInfo([]byte{0xe0, 0x05, 0x42, 0x00})
+		require.True(t, ok)
+		require.False(t, info.independent)
+		require.Equal(t, uint8(2), info.temporalID)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, ok := parseVP9LayerInfo([]byte{0xa0, 0x80, 0x01})
+		require.False(t, ok)
+	})
+}
+
+func TestFrameDropperVP9(t *testing.T) {
+	const clockRate = 90000
+
+	d := newFrameDropper(clockRate, 5, webrtc.MimeTypeVP9)
+	require.NotNil(t, d.parseLayerInfo)
+
+	// pushFrame pushes a frame made of two spatial layers, returning whether
+	// it got dropped.
+	var seq uint16
+	pushFrame := func(i int, tid uint8) bool {
+		var p byte
+		if i > 0 {
+			p = 0x40
+		}
+		var dropped bool
+		for sid := byte(0); sid < 2; sid++ {
+			pkt := &rtp.Packet{
+				Header: rtp.Header{
+					SequenceNumber: seq,
+					Timestamp:      uint32(i) * clockRate / 30,
+				},
+				Payload: []byte{0xa0 | p, byte(i), tid<<5 | sid<<1, 0x00},
+			}
+			seq++
+			dropped = d.drop(pkt, nil, true)
+		}
+		require.True(t, d.thinnable())
+		return dropped
+	}
+
+	require.False(t, pushFrame(0, 0)) // T0, key frame
+	require.True(t, pushFrame(1, 2))  // T2
+	require.True(t, pushFrame(2, 1))  // T1
+	require.True(t, pushFrame(3, 2))  // T2, depends on the dropped T1
+	require.False(t, pushFrame(4, 0)) // T0
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// answerBandwidth holds the bandwidth, in kilobits per second, to advertise
+// for each media type in the SDP answers sent to a session. Zero values mean
+// no bandwidth line is added.
+type answerBandwidth struct {
+	audioKbps  int
+	screenKbps int
+	videoKbps  int
+}
+
+func (b answerBandwidth) isSet() bool {
+	return b.audioKbps > 0 || b.screenKbps > 0 || b.videoKbps > 0
+}
+
+// sdpMediaSection is a media (m=) section of an SDP, split in lines.
+type sdpMediaSection struct {
+	lines []string
+}
+
+func (m sdpMediaSection) kind() string {
+	fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(m.lines[0]), "m="))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+func (m sdpMediaSection) attr(key string) (string, bool) {
+	prefix := "a=" + key + ":"
+	for _, line := range m.lines {
+		if val, ok := strings.CutPrefix(strings.TrimSpace(line), prefix); ok {
+			return val, true
+		}
+	}
+	return "", false
+}
+
+// splitSDP splits the given SDP into its session section lines and its media
+// sections. Lines keep their line endings.
+func splitSDP(sdp string) ([]string, []sdpMediaSection) {
+	var session []string
+	var media []sdpMediaSection
+	for _, line := range strings.SplitAfter(sdp, "\n") {
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "m=") {
+			media = append(media, sdpMediaSection{})
+		}
+		if len(media) == 0 {
+			session = append(session, line)
+			continue
+		}
+		media[len(media)-1].lines = append(media[len(media)-1].lines, line)
+	}
+	return session, media
+}
+
+// addAnswerBandwidth adds bandwidth lines to the media sections of the given
+// answer according to their type. Video sections are considered screen
+// sharing ones if their stream, as announced in the offer, matches
+// screenStreamID.
+func addAnswerBandwidth(offer, answer string, bw answerBandwidth, screenStreamID string) string {
+	if !bw.isSet() {
+		return answer
+	}
+
+	// Mapping the offer's video sections to the stream they carry.
+	streamIDs := map[string]string{}
+	_, offerMedia := splitSDP(offer)
+	for _, m := range offerMedia {
+		mid, ok := m.attr("mid")
+		if !ok {
+			continue
+		}
+		if msid, ok := m.attr("msid"); ok && len(strings.Fields(msid)) > 0 {
+			streamIDs[mid] = strings.Fields(msid)[0]
+		}
+	}
+
+	session, media := splitSDP(answer)
+	out := make([]string, 0, len(session)+len(media)*2)
+	out = append(out, session...)
+	for _, m := range media {
+		var kbps int
+		switch m.kind() {
+		case "audio":
+			kbps = bw.audioKbps
+		case "video":
+			kbps = bw.videoKbps
+			if mid, ok := m.attr("mid"); ok && screenStreamID != "" && streamIDs[mid] == screenStreamID {
+				kbps = bw.screenKbps
+			}
+		}
+
+		if kbps == 0 {
+			out = append(out, m.lines...)
+			continue
+		}
+
+		eol := "\n"
+		if strings.HasSuffix(m.lines[0], "\r\n") {
+			eol = "\r\n"
+		}
+		bwLines := []string{
+			fmt.Sprintf("b=AS:%d%s", kbps, eol),
+			fmt.Sprintf("b=TIAS:%d%s", kbps*1000, eol),
+		}
+
+		// Bandwidth lines go after the optional title (i=) and connection
+		// (c=) lines (RFC 8866, Section 5).
+		idx := 1
+		for idx < len(m.lines) && (strings.HasPrefix(m.lines[idx], "i=") || strings.HasPrefix(m.lines[idx], "c=")) {
+			idx++
+		}
+		out = append(out, m.lines[:idx]...)
+		out = append(out, bwLines...)
+		for _, line := range m.lines[idx:] {
+			if strings.HasPrefix(line, "b=") {
+				continue
+			}
+			out = append(out, line)
+		}
+	}
+
+	return strings.Join(out, "")
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// getSDPMediaSection returns the media section of the given kind and mid.
+func getSDPMediaSection(t *testing.T, sdp, kind, mid string) string {
+	t.Helper()
+	_, media := splitSDP(sdp)
+	for _, m := range media {
+		if m.kind() != kind {
+			continue
+		}
+		if val, _ := m.attr("mid"); mid == "" || val == mid {
+			return strings.Join(m.lines, "")
+		}
+	}
+	require.FailNow(t, "media section not found", "kind=%s mid=%s", kind, mid)
+	return ""
+}
+
+func TestAddAnswerBandwidth(t *testing.T) {
+	offer := "v=0\r\n" +
+		"o=- 1 1 IN IP4 0.0.0.0\r\n" +
+		"s=-\r\n" +
+		"t=0 0\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=mid:0\r\n" +
+		"a=msid:voiceStream voiceTrack\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=mid:1\r\n" +
+		"a=msid:screenStream screenTrack\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=mid:2\r\n" +
+		"a=msid:videoStream videoTrack\r\n" +
+		"m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=mid:3\r\n"
+
+	answer := "v=0\r\n" +
+		"o=- 2 2 IN IP4 0.0.0.0\r\n" +
+		"s=-\r\n" +
+		"t=0 0\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=mid:0\r\n" +
+		"a=recvonly\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"b=AS:50\r\n" +
+		"a=mid:1\r\n" +
+		"a=recvonly\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=mid:2\r\n" +
+		"a=recvonly\r\n" +
+		"m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=mid:3\r\n"
+
+	t.Run("not set", func(t *testing.T) {
+		require.Equal(t, answer, addAnswerBandwidth(offer, answer, answerBandwidth{}, "screenStream"))
+	})
+
+	t.Run("all media types", func(t *testing.T) {
+		out := addAnswerBandwidth(offer, answer, answerBandwidth{
+			audioKbps:  64,
+			screenKbps: 2500,
+			videoKbps:  1000,
+		}, "screenStream")
+
+		require.Equal(t, "m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n"+
+			"c=IN IP4 0.0.0.0\r\n"+
+			"b=AS:64\r\n"+
+			"b=TIAS:64000\r\n"+
+			"a=mid:0\r\n"+
+			"a=recvonly\r\n", getSDPMediaSection(t, out, "audio", "0"))
+
+		// Existing bandwidth lines are replaced.
+		require.Equal(t, "m=video 9 UDP/TLS/RTP/SAVPF 96\r\n"+
+			"c=IN IP4 0.0.0.0\r\n"+
+			"b=AS:2500\r\n"+
+			"b=TIAS:2500000\r\n"+
+			"a=mid:1\r\n"+
+			"a=recvonly\r\n", getSDPMediaSection(t, out, "video", "1"))
+
+		require.Equal(t, "m=video 9 UDP/TLS/RTP/SAVPF 96\r\n"+
+			"c=IN IP4 0.0.0.0\r\n"+
+			"b=AS:1000\r\n"+
+			"b=TIAS:1000000\r\n"+
+			"a=mid:2\r\n"+
+			"a=recvonly\r\n", getSDPMediaSection(t, out, "video", "2"))
+
+		require.NotContains(t, getSDPMediaSection(t, out, "application", "3"), "b=")
+		require.True(t, strings.HasPrefix(out, "v=0\r\no=- 2 2 IN IP4 0.0.0.0\r\ns=-\r\nt=0 0\r\n"))
+	})
+
+	t.Run("single media type", func(t *testing.T) {
+		out := addAnswerBandwidth(offer, answer, answerBandwidth{
+			screenKbps: 2500,
+		}, "screenStream")
+		require.NotContains(t, getSDPMediaSection(t, out, "audio", "0"), "b=")
+		require.Contains(t, getSDPMediaSection(t, out, "video", "1"), "b=AS:2500\r\n")
+		require.NotContains(t, getSDPMediaSection(t, out, "video", "2"), "b=")
+	})
+
+	t.Run("no screen stream", func(t *testing.T) {
+		out := addAnswerBandwidth(offer, answer, answerBandwidth{
+			screenKbps: 2500,
+			videoKbps:  1000,
+		}, "")
+		require.Contains(t, getSDPMediaSection(t, out, "video", "1"), "b=AS:1000\r\n")
+		require.Contains(t, getSDPMediaSection(t, out, "video", "2"), "b=AS:1000\r\n")
+	})
+}
+
+func TestAnswerBandwidth(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.AudioAnswerBandwidthKbps = 64
+	s.cfg.VideoAnswerBandwidthKbps = 1000
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	cfg := SessionConfig{
+		GroupID:   random.NewID(),
+		CallID:    random.NewID(),
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+
+	voiceTrack, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, "voice", "voiceStream")
+	require.NoError(t, err)
+	videoTrack, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		"video", "camera")
+	require.NoError(t, err)
+
+	initSession := setupTestPeers(t, s)
+	pc := initSession(cfg, voiceTrack, videoTrack)
+	defer pc.Close()
+	defer func() {
+		err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	require.Eventually(t, func() bool {
+		return pc.RemoteDescription() != nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	answer := pc.RemoteDescription()
+	require.Equal(t, webrtc.SDPTypeAnswer, answer.Type)
+
+	audio := getSDPMediaSection(t, answer.SDP, "audio", "")
+	require.Contains(t, audio, "b=AS:64\r\n")
+	require.Contains(t, audio, "b=TIAS:64000\r\n")
+
+	video := getSDPMediaSection(t, answer.SDP, "video", "")
+	require.Contains(t, video, "b=AS:1000\r\n")
+	require.Contains(t, video, "b=TIAS:1000000\r\n")
+
+	require.NotContains(t, getSDPMediaSection(t, answer.SDP, "application", ""), "b=")
+}
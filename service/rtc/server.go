@@ -6,9 +6,12 @@ package rtc
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net"
 	"net/netip"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mattermost/rtcd/service/rtc/dc"
@@ -20,33 +23,77 @@ import (
 )
 
 const (
-	msgChSize        = 2000
+	msgChSize  = 2000
+	catchAllIP = "0.0.0.0"
+	// signalingTimeout is the default for ServerConfig.SignalingTimeoutMs.
 	signalingTimeout = 10 * time.Second
-	catchAllIP       = "0.0.0.0"
+	// signalingExitTimeout bounds how long closing a session waits for its
+	// signaling goroutines to exit.
+	signalingExitTimeout = 10 * time.Second
 )
 
+// channelDepthReportInterval is how often the number of messages queued in
+// the server's signaling channels gets reported through metrics.
+const channelDepthReportInterval = time.Second
+
 type Server struct {
 	cfg     ServerConfig
 	log     mlog.LoggerIFace
-	metrics Metrics
+	metrics *serverMetrics
 
 	groups   map[string]*group
 	sessions map[string]SessionConfig
 
-	udpMux         ice.UDPMux
-	tcpMux         ice.TCPMux
+	udpMux   ice.UDPMux
+	tcpMux   ice.TCPMux
+	localIPs []netip.Addr
+	// publicAddrsMap maps local addresses to the public ones discovered
+	// through STUN. It's never modified in place but replaced as a whole
+	// (setPublicAddrsMap) so that readers can safely hold on to it.
 	publicAddrsMap map[netip.Addr]string
-	localIPs       []netip.Addr
+	publicAddrsMut sync.RWMutex
 
 	sendCh    chan Message
 	receiveCh chan Message
 	drainCh   chan struct{}
 	bufPool   *sync.Pool
+	// initSem limits the number of concurrent session initializations
+	// (ServerConfig.MaxConcurrentSessionInits). Nil if no limit is set.
+	initSem chan struct{}
+	// warmPool holds pre-built session APIs (ServerConfig.WarmPoolSize).
+	// Nil if the pool is disabled.
+	warmPool chan *sessionAPI
+	// warmPoolDoneCh stops the warm pool filler.
+	warmPoolDoneCh chan struct{}
+	// channelDepthDoneCh stops the signaling channels depth reporter.
+	channelDepthDoneCh chan struct{}
+	// videoCodecParams holds the parameters of all the supported video
+	// codecs, keyed by mime type.
+	videoCodecParams map[string]webrtc.RTPCodecParameters
+	// videoExtensions holds the video header extensions to negotiate.
+	videoExtensions []string
+	// videoCodecs holds the mime types of the video codecs registered for
+	// newly created sessions.
+	videoCodecs []string
+	// sessionIDValidator, if set, is called to validate session IDs on
+	// InitSession (WithSessionIDValidator).
+	sessionIDValidator SessionIDValidator
+	// newPeerConnection creates a peer connection out of a session API. Only
+	// meant to be overridden in tests.
+	newPeerConnection func(api *webrtc.API, cfg webrtc.Configuration) (*webrtc.PeerConnection, error)
+	// drops accounts for the messages dropped because of full channels.
+	drops *droppedMessages
+	// cpuUsage holds the last reported CPU usage (SetCPUUsage), stored as
+	// float64 bits.
+	cpuUsage atomic.Uint64
+	// callsCount holds the number of active calls, as reported through
+	// metrics. Guarded by mut.
+	callsCount int
 
 	mut sync.RWMutex
 }
 
-func NewServer(cfg ServerConfig, log mlog.LoggerIFace, metrics Metrics) (*Server, error) {
+func NewServer(cfg ServerConfig, log mlog.LoggerIFace, metrics Metrics, opts ...ServerOption) (*Server, error) {
 	if err := cfg.IsValid(); err != nil {
 		return nil, err
 	}
@@ -60,27 +107,97 @@ func NewServer(cfg ServerConfig, log mlog.LoggerIFace, metrics Metrics) (*Server
 	s := &Server{
 		cfg:            cfg,
 		log:            log,
-		metrics:        metrics,
+		metrics:        newServerMetrics(metrics),
 		groups:         map[string]*group{},
 		sessions:       map[string]SessionConfig{},
 		sendCh:         make(chan Message, msgChSize),
 		receiveCh:      make(chan Message, msgChSize),
 		bufPool:        &sync.Pool{New: func() interface{} { return make([]byte, receiveMTU) }},
 		publicAddrsMap: make(map[netip.Addr]string),
+		newPeerConnection: func(api *webrtc.API, cfg webrtc.Configuration) (*webrtc.PeerConnection, error) {
+			return api.NewPeerConnection(cfg)
+		},
+	}
+
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, fmt.Errorf("failed to apply option: %w", err)
+		}
+	}
+
+	s.drops = newDroppedMessages(log, s.metrics, time.Duration(cfg.DroppedMessagesLogIntervalMs)*time.Millisecond)
+
+	s.videoCodecParams = getSupportedVideoCodecs(cfg.Experimental)
+	s.videoExtensions = getSupportedVideoExtensions(cfg.Experimental)
+	s.videoCodecs = getVideoCodecsMimeTypes(s.videoCodecParams)
+
+	for _, feature := range cfg.Experimental.enabledFeatures() {
+		s.log.Warn("rtc: experimental feature enabled, not recommended for production use", mlog.String("feature", feature))
+	}
+
+	if cfg.MaxConcurrentSessionInits > 0 {
+		s.initSem = make(chan struct{}, cfg.MaxConcurrentSessionInits)
+	}
+
+	if cfg.WarmPoolSize > 0 {
+		s.warmPool = make(chan *sessionAPI, cfg.WarmPoolSize)
 	}
 
 	return s, nil
 }
 
 func (s *Server) Send(msg Message) error {
+	// Signaling messages of rate limited groups go through a bounded per-group
+	// queue so that a single group flooding SDP/ICE cannot fill up the channel
+	// shared with all the others. Other messages change the session's state so
+	// they are never limited.
+	if msg.Type == SDPMessage || msg.Type == ICEMessage {
+		if g := s.getSessionGroup(msg.SessionID); g != nil && g.signalingCh != nil {
+			if err := g.queueSignaling(msg); err != nil {
+				s.metrics.IncRTCDroppedMessages(g.id, "send", "rate_limit")
+				return err
+			}
+			return nil
+		}
+	}
+
+	return s.sendMessage(msg)
+}
+
+// sendMessage queues the given message to be processed.
+func (s *Server) sendMessage(msg Message) error {
 	select {
 	case s.sendCh <- msg:
 	default:
+		s.metrics.IncRTCChannelFull(s.getSessionGroupID(msg.SessionID), "send")
 		return fmt.Errorf("failed to send rtc message, channel is full")
 	}
 	return nil
 }
 
+// getSessionGroupID returns the ID of the group the given session belongs to,
+// if any.
+func (s *Server) getSessionGroupID(sessionID string) string {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return s.sessions[sessionID].GroupID
+}
+
+// getSessionGroup returns the group the given session belongs to, if any. The
+// group is looked up from the session as the one set in messages cannot be
+// trusted.
+func (s *Server) getSessionGroup(sessionID string) *group {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+
+	cfg, ok := s.sessions[sessionID]
+	if !ok {
+		return nil
+	}
+
+	return s.groups[cfg.GroupID]
+}
+
 func (s *Server) ReceiveCh() <-chan Message {
 	return s.receiveCh
 }
@@ -89,7 +206,11 @@ func (s *Server) Start() error {
 	udpNetwork := "udp4"
 	tcpNetwork := "tcp4"
 
-	if s.cfg.EnableIPv6 {
+	if s.cfg.IPv6Only {
+		s.log.Info("rtc: experimental IPv6 only mode enabled")
+		udpNetwork = "udp6"
+		tcpNetwork = "tcp6"
+	} else if s.cfg.EnableIPv6 {
 		s.log.Info("rtc: experimental IPv6 support enabled")
 		udpNetwork = "udp"
 		tcpNetwork = "tcp"
@@ -99,6 +220,12 @@ func (s *Server) Start() error {
 	if err != nil {
 		return fmt.Errorf("failed to get system IPs: %w", err)
 	}
+	if s.cfg.IPv6Only {
+		localIPs = filterIPv6Addrs(localIPs)
+		if len(localIPs) == 0 {
+			return fmt.Errorf("no valid IPv6 address to listen on was found")
+		}
+	}
 	if len(localIPs) == 0 {
 		return fmt.Errorf("no valid address to listen on was found")
 	}
@@ -122,6 +249,8 @@ func (s *Server) Start() error {
 
 	// Populate public IP addresses map if override is not set and STUN is provided.
 	if s.cfg.ICEHostOverride == "" && len(s.cfg.ICEServers) > 0 {
+		publicAddrsMap := make(map[netip.Addr]string, len(localIPs))
+		maps.Copy(publicAddrsMap, s.getPublicAddrsMap())
 		for _, ip := range localIPs {
 			udpListenAddr := netip.AddrPortFrom(ip, uint16(s.cfg.ICEPortUDP)).String()
 			udpAddr, err := net.ResolveUDPAddr(udpNetwork, udpListenAddr)
@@ -139,8 +268,9 @@ func (s *Server) Start() error {
 				s.log.Info("got public IP address for local interface", mlog.String("localAddr", ip.String()), mlog.String("remoteAddr", addr))
 			}
 
-			s.publicAddrsMap[ip] = addr
+			publicAddrsMap[ip] = addr
 		}
+		s.setPublicAddrsMap(publicAddrsMap)
 	}
 
 	if err := s.initUDP(localIPs, udpNetwork); err != nil {
@@ -153,6 +283,16 @@ func (s *Server) Start() error {
 
 	go s.msgReader()
 
+	s.channelDepthDoneCh = make(chan struct{})
+	go s.reportChannelDepth(s.channelDepthDoneCh)
+
+	// Session APIs depend on the muxes so the pool can only be filled once
+	// these are initialized.
+	if s.warmPool != nil {
+		s.warmPoolDoneCh = make(chan struct{})
+		go s.fillWarmPool(s.warmPoolDoneCh)
+	}
+
 	return nil
 }
 
@@ -172,9 +312,25 @@ func (s *Server) Stop() error {
 		<-drainCh
 	}
 
+	// Groups are normally stopped along with their last call but this can
+	// still be in progress after draining.
+	s.mut.Lock()
+	for _, g := range s.groups {
+		g.stop()
+	}
+	s.mut.Unlock()
+
 	close(s.receiveCh)
 	close(s.sendCh)
 
+	if s.warmPoolDoneCh != nil {
+		close(s.warmPoolDoneCh)
+	}
+
+	if s.channelDepthDoneCh != nil {
+		close(s.channelDepthDoneCh)
+	}
+
 	if s.tcpMux != nil {
 		if err := s.tcpMux.Close(); err != nil {
 			return fmt.Errorf("failed to close tcp mux: %w", err)
@@ -192,6 +348,112 @@ func (s *Server) Stop() error {
 	return nil
 }
 
+// IsDraining returns whether the server is waiting for ongoing sessions to
+// end before shutting down.
+func (s *Server) IsDraining() bool {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return s.drainCh != nil
+}
+
+// CallInfo holds summary information about an active call.
+type CallInfo struct {
+	GroupID       string `json:"groupID"`
+	CallID        string `json:"callID"`
+	SessionsCount int    `json:"sessionsCount"`
+	// HasScreen is whether a session in the call is sharing its screen.
+	HasScreen bool `json:"hasScreen"`
+}
+
+// GetCalls returns information about all the active calls, sorted by group
+// and call ID.
+func (s *Server) GetCalls() []CallInfo {
+	// Locks are taken one at a time, copying the data out, so that this can't
+	// deadlock against CloseSession.
+	s.mut.RLock()
+	groups := make([]*group, 0, len(s.groups))
+	for _, g := range s.groups {
+		groups = append(groups, g)
+	}
+	s.mut.RUnlock()
+
+	calls := []CallInfo{}
+	for _, g := range groups {
+		g.mut.RLock()
+		groupCalls := make([]*call, 0, len(g.calls))
+		for _, c := range g.calls {
+			groupCalls = append(groupCalls, c)
+		}
+		g.mut.RUnlock()
+
+		for _, c := range groupCalls {
+			c.mut.RLock()
+			calls = append(calls, CallInfo{
+				GroupID:       g.id,
+				CallID:        c.id,
+				SessionsCount: len(c.sessions),
+				HasScreen:     c.screenSession != nil,
+			})
+			c.mut.RUnlock()
+		}
+	}
+
+	sort.Slice(calls, func(i, j int) bool {
+		if calls[i].GroupID != calls[j].GroupID {
+			return calls[i].GroupID < calls[j].GroupID
+		}
+		return calls[i].CallID < calls[j].CallID
+	})
+
+	return calls
+}
+
+// UpdateICEConfig replaces the ICE servers and TURN configurations. Active
+// sessions are left untouched while sessions initialized afterwards, as well
+// as any subsequent TURN credentials refresh, use the new values. This allows
+// to rotate the TURN static auth secret without restarting the server.
+func (s *Server) UpdateICEConfig(iceServers ICEServers, turnCfg TURNConfig) error {
+	if err := iceServers.IsValid(); err != nil {
+		return fmt.Errorf("invalid ICEServers value: %w", err)
+	}
+	if err := turnCfg.IsValid(); err != nil {
+		return fmt.Errorf("invalid TURNConfig: %w", err)
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.cfg.ICEServers = append(ICEServers(nil), iceServers...)
+	s.cfg.TURNConfig = turnCfg
+
+	return nil
+}
+
+// getICEConfig returns the current ICE servers and TURN configurations
+// (UpdateICEConfig).
+func (s *Server) getICEConfig() (ICEServers, TURNConfig) {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return s.cfg.ICEServers, s.cfg.TURNConfig
+}
+
+// reportChannelDepth periodically reports the number of messages queued in
+// the server's signaling channels until doneCh gets closed.
+func (s *Server) reportChannelDepth(doneCh <-chan struct{}) {
+	ticker := time.NewTicker(channelDepthReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.metrics.SetRTCChannelDepth("send", len(s.sendCh))
+			s.metrics.SetRTCChannelDepth("receive", len(s.receiveCh))
+		case <-doneCh:
+			return
+		}
+	}
+}
+
 func (s *Server) msgReader() {
 	for msg := range s.sendCh {
 		if err := msg.IsValid(); err != nil {
@@ -234,7 +496,7 @@ func (s *Server) msgReader() {
 			select {
 			case session.iceInCh <- msg.Data:
 			default:
-				s.log.Error("failed to send sdp message: channel is full", mlog.Any("session", session.cfg))
+				s.droppedMessage(session.cfg.GroupID, "ice", "ice_candidate", mlog.String("sessionID", session.cfg.SessionID))
 			}
 		case SDPMessage:
 			if err := s.handleIncomingSDP(session, s.receiveCh, msg.Data); err != nil {
@@ -250,43 +512,78 @@ func (s *Server) msgReader() {
 			s.log.Debug("received screen sharing stream ID", mlog.String("screenStreamID", data["screenStreamID"]))
 
 			session.mut.Lock()
+			// The source changed while sharing. The tracks of the previous one
+			// are dropped and receivers get the new ones swapped in place as
+			// they arrive.
+			if session.screenStreamID != "" && session.screenStreamID != data["screenStreamID"] {
+				s.log.Debug("screen source changed", mlog.String("sessionID", session.cfg.SessionID))
+				session.clearScreenTracks()
+			}
 			session.screenStreamID = data["screenStreamID"]
 			session.mut.Unlock()
 
 			if ok := call.setScreenSession(session); !ok {
-				s.log.Error("screen session should not be set")
+				s.log.Warn("screen session is already set, rejecting screen share",
+					mlog.String("sessionID", session.cfg.SessionID))
+
+				session.mut.Lock()
+				session.screenStreamID = ""
+				session.rejectedScreenStreamID = data["screenStreamID"]
+				session.mut.Unlock()
+
+				if err := s.sendScreenReject(session, data["screenStreamID"]); err != nil {
+					s.log.Error("failed to send screen reject message", mlog.Err(err))
+				}
 			}
 		case ScreenOffMessage:
+			session.mut.Lock()
+			session.rejectedScreenStreamID = ""
+			session.mut.Unlock()
+
 			if err := call.clearScreenState(session); err != nil {
 				s.log.Error("failed to clear screen state", mlog.Err(err))
 			}
+		case VideoOnMessage:
+			data := map[string]string{}
+			if err := json.Unmarshal(msg.Data, &data); err != nil {
+				s.log.Error("failed to unmarshal video msg data", mlog.Err(err))
+				continue
+			}
+
+			s.log.Debug("received video stream ID", mlog.String("videoStreamID", data["videoStreamID"]))
+
+			session.mut.Lock()
+			session.videoStreamID = data["videoStreamID"]
+			session.mut.Unlock()
+		case VideoOffMessage:
+			call.clearVideoState(session)
 		case MuteMessage, UnmuteMessage:
-			session.mut.RLock()
+			// The requested state is recorded even if the voice track hasn't
+			// been received yet (e.g. renegotiation still in flight) so that
+			// it's honored once it is.
+			session.mut.Lock()
+			session.voiceMuted = msg.Type == MuteMessage
 			track := session.outVoiceTrack
-			session.mut.RUnlock()
+			session.mut.Unlock()
 			if track == nil {
 				continue
 			}
 
-			var enabled bool
 			if msg.Type == UnmuteMessage {
-				enabled = true
-			} else {
-				session.mut.Lock()
-				if session.vadMonitor != nil {
-					s.log.Debug("resetting vad monitor for session",
-						mlog.String("sessionID", session.cfg.SessionID))
-					session.vadMonitor.Reset()
-				}
-				session.mut.Unlock()
+				s.log.Debug("enabling voice track", mlog.String("sessionID", session.cfg.SessionID))
+				s.enableVoiceTrack(call, session)
+				continue
 			}
 
-			s.log.Debug("setting voice track state",
-				mlog.Bool("enabled", enabled),
-				mlog.String("sessionID", session.cfg.SessionID))
+			s.log.Debug("disabling voice track", mlog.String("sessionID", session.cfg.SessionID))
 
 			session.mut.Lock()
-			session.outVoiceTrackEnabled = enabled
+			if session.vadMonitor != nil {
+				s.log.Debug("resetting vad monitor for session",
+					mlog.String("sessionID", session.cfg.SessionID))
+				session.vadMonitor.Reset()
+			}
+			session.outVoiceTrackEnabled = false
 			session.mut.Unlock()
 		default:
 			s.log.Error("received unexpected message type")
@@ -294,6 +591,111 @@ func (s *Server) msgReader() {
 	}
 }
 
+// sendScreenReject notifies the session that its screen sharing attempt was
+// rejected because another session in the call is already sharing.
+func (s *Server) sendScreenReject(session *session, screenStreamID string) error {
+	data, err := json.Marshal(map[string]string{
+		"screenStreamID": screenStreamID,
+		"reason":         ErrScreenShareActive.Error(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	select {
+	case s.receiveCh <- newMessage(session, ScreenRejectMessage, data):
+	default:
+		s.metrics.IncRTCChannelFull(session.cfg.GroupID, "receive")
+		return fmt.Errorf("channel is full")
+	}
+
+	return nil
+}
+
+// sendTrackReject notifies the session that the given track won't be forwarded
+// to it because its publisher reached ServerConfig.MaxReceiversPerPublisher.
+func (s *Server) sendTrackReject(session *session, trackID string) error {
+	data, err := json.Marshal(map[string]string{
+		"trackID": trackID,
+		"reason":  ErrMaxReceivers.Error(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	select {
+	case s.receiveCh <- newMessage(session, TrackRejectMessage, data):
+	default:
+		s.metrics.IncRTCChannelFull(session.cfg.GroupID, "receive")
+		return fmt.Errorf("channel is full")
+	}
+
+	return nil
+}
+
+// sendActiveSpeakerCleared notifies that the given former active speaker left
+// the call. The message is sent on behalf of session, which is still in the
+// call.
+func (s *Server) sendActiveSpeakerCleared(session *session, speakerSessionID string) {
+	data, err := json.Marshal(map[string]string{
+		"sessionID": speakerSessionID,
+	})
+	if err != nil {
+		s.log.Error("failed to marshal data", mlog.Err(err))
+		return
+	}
+
+	select {
+	case s.receiveCh <- newMessage(session, ActiveSpeakerClearedMessage, data):
+	default:
+		s.droppedMessage(session.cfg.GroupID, "receive", "active_speaker", mlog.String("sessionID", session.cfg.SessionID))
+	}
+}
+
+// enableVoiceTrack enables the session's voice track, notifying the session
+// if it was rejected because the call reached ServerConfig.MaxUnmutedSpeakers.
+func (s *Server) enableVoiceTrack(call *call, session *session) {
+	if call.enableVoiceTrack(session, s.cfg.MaxUnmutedSpeakers) {
+		return
+	}
+
+	s.log.Debug("max unmuted speakers reached, rejecting unmute",
+		mlog.String("sessionID", session.cfg.SessionID))
+	s.metrics.IncRTCErrors(session.cfg.GroupID, "unmute_reject")
+
+	data, err := json.Marshal(map[string]string{
+		"reason": ErrMaxUnmutedSpeakers.Error(),
+	})
+	if err != nil {
+		s.log.Error("failed to marshal data", mlog.Err(err))
+		return
+	}
+
+	select {
+	case s.receiveCh <- newMessage(session, UnmuteRejectMessage, data):
+	default:
+		s.droppedMessage(session.cfg.GroupID, "receive", "unmute_reject", mlog.String("sessionID", session.cfg.SessionID))
+	}
+}
+
+// isBehindNAT returns whether the server is assumed to be behind NAT. In case
+// no public address could be determined we conservatively assume it is.
+func (s *Server) isBehindNAT() bool {
+	return !hasDirectPublicMapping(s.localIPs, s.getPublicAddrsMap(), s.cfg.ICEHostOverride)
+}
+
+func (s *Server) getPublicAddrsMap() map[netip.Addr]string {
+	s.publicAddrsMut.RLock()
+	defer s.publicAddrsMut.RUnlock()
+	return s.publicAddrsMap
+}
+
+func (s *Server) setPublicAddrsMap(m map[netip.Addr]string) {
+	s.publicAddrsMut.Lock()
+	defer s.publicAddrsMut.Unlock()
+	s.publicAddrsMap = m
+}
+
 func (s *Server) initUDP(localIPs []netip.Addr, network string) error {
 	var udpMuxes []ice.UDPMux
 
@@ -343,9 +745,15 @@ func (s *Server) initTCP(network string) error {
 		return fmt.Errorf("failed to create TCP listener: %w", err)
 	}
 
+	ml, err := newMultiListener(tcpListener, s.cfg.getICETCPAcceptConcurrency(), s.log)
+	if err != nil {
+		tcpListener.Close()
+		return fmt.Errorf("failed to create multi listener: %w", err)
+	}
+
 	s.tcpMux = ice.NewTCPMuxDefault(ice.TCPMuxParams{
 		Logger:          newPionLeveledLogger(s.log),
-		Listener:        tcpListener,
+		Listener:        ml,
 		ReadBufferSize:  tcpConnReadBufferLength,
 		WriteBufferSize: tcpSocketWriteBufferSize,
 	})
@@ -354,10 +762,11 @@ func (s *Server) initTCP(network string) error {
 }
 
 func (s *Server) handleIncomingSDP(us *session, answerCh chan<- Message, data []byte) error {
-	var sdp webrtc.SessionDescription
-	if err := json.Unmarshal(data, &sdp); err != nil {
+	var msg sdpMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
 		return fmt.Errorf("failed to unmarshal sdp: %w", err)
 	}
+	sdp := msg.SessionDescription
 
 	s.log.Debug("signaling", mlog.Int("sdpType", int(sdp.Type)), mlog.Any("session", us.cfg))
 
@@ -369,7 +778,7 @@ func (s *Server) handleIncomingSDP(us *session, answerCh chan<- Message, data []
 		}
 	} else if sdp.Type == webrtc.SDPTypeAnswer {
 		select {
-		case us.sdpAnswerInCh <- sdp:
+		case us.sdpAnswerInCh <- msg:
 		default:
 			return fmt.Errorf("failed to send sdp answer: channel is full")
 		}
@@ -380,12 +789,36 @@ func (s *Server) handleIncomingSDP(us *session, answerCh chan<- Message, data []
 	return nil
 }
 
+// isDCControlMessage returns whether the given data channel message type is
+// used for signaling, keepalive or to control what the session receives.
+// These are never rate limited as dropping them would break the session, as
+// opposed to telemetry which is fine to lose.
+func isDCControlMessage(mt dc.MessageType) bool {
+	switch mt {
+	case dc.MessageTypePing,
+		dc.MessageTypePong,
+		dc.MessageTypeSDP,
+		dc.MessageTypePreferredSimulcastLevel,
+		dc.MessageTypeSourceSimulcastLevel,
+		dc.MessageTypeTrackResubscribe,
+		dc.MessageTypeStopReceiving:
+		return true
+	default:
+		return false
+	}
+}
+
 func (s *Server) handleDCMessage(data []byte, us *session, dataCh *webrtc.DataChannel) error {
 	mt, payload, err := dc.DecodeMessage(data)
 	if err != nil {
 		return fmt.Errorf("failed to decode DC message: %w", err)
 	}
 
+	if us.dcLimiter != nil && !isDCControlMessage(mt) && !us.dcLimiter.Allow() {
+		s.metrics.IncRTCDroppedMessages(us.cfg.GroupID, "dc", "rate_limit")
+		return nil
+	}
+
 	// Identify and handle message
 	switch mt {
 	case dc.MessageTypePong:
@@ -403,12 +836,54 @@ func (s *Server) handleDCMessage(data []byte, us *session, dataCh *webrtc.DataCh
 		if err := s.handleIncomingSDP(us, us.dcSDPCh, payload.([]byte)); err != nil {
 			return fmt.Errorf("failed to handle incoming sdp message: %w", err)
 		}
-	case dc.MessageTypeLossRate:
-		s.metrics.ObserveRTCClientLossRate(us.cfg.GroupID, payload.(float64))
-	case dc.MessageTypeRoundTripTime:
-		s.metrics.ObserveRTCClientRTT(us.cfg.GroupID, payload.(float64))
-	case dc.MessageTypeJitter:
-		s.metrics.ObserveRTCClientJitter(us.cfg.GroupID, payload.(float64))
+	case dc.MessageTypeLossRate, dc.MessageTypeRoundTripTime, dc.MessageTypeJitter:
+		value := payload.(float64)
+		if us.metricsSampled {
+			switch mt {
+			case dc.MessageTypeLossRate:
+				s.metrics.ObserveRTCClientLossRate(us.cfg.GroupID, value)
+			case dc.MessageTypeRoundTripTime:
+				s.metrics.ObserveRTCClientRTT(us.cfg.GroupID, value)
+			case dc.MessageTypeJitter:
+				s.metrics.ObserveRTCClientJitter(us.cfg.GroupID, value)
+			}
+		}
+		if stats, ok := us.updateClientStats(mt, value); ok {
+			if err := s.sendClientStats(us, stats); err != nil {
+				return fmt.Errorf("failed to send client stats: %w", err)
+			}
+		}
+	case dc.MessageTypePreferredSimulcastLevel:
+		level := payload.(string)
+		s.log.Debug("received preferred simulcast level", mlog.String("sessionID", us.cfg.SessionID), mlog.String("level", level))
+		if err := us.setPreferredSimulcastLevel(level); err != nil {
+			return fmt.Errorf("failed to set preferred simulcast level: %w", err)
+		}
+	case dc.MessageTypeSourceSimulcastLevel:
+		msg := payload.(dc.MessageSourceSimulcastLevel)
+		s.log.Debug("received source simulcast level", mlog.String("sessionID", us.cfg.SessionID),
+			mlog.String("sourceSessionID", msg.SessionID), mlog.String("level", msg.Level))
+		if err := us.setSourceSimulcastLevel(msg.SessionID, msg.Level); err != nil {
+			return fmt.Errorf("failed to set source simulcast level: %w", err)
+		}
+	case dc.MessageTypeTrackResubscribe:
+		msg := payload.(dc.MessageTrackResubscribe)
+		s.log.Debug("received track resubscribe", mlog.String("sessionID", us.cfg.SessionID),
+			mlog.String("sourceSessionID", msg.SessionID), mlog.String("trackType", msg.TrackType))
+		tt := trackTypes[msg.TrackType]
+		if tt == "" {
+			return fmt.Errorf("invalid track type %q", msg.TrackType)
+		}
+		if err := s.handleTrackResubscribe(us, msg.SessionID, tt); err != nil {
+			return fmt.Errorf("failed to resubscribe track: %w", err)
+		}
+	case dc.MessageTypeStopReceiving:
+		sourceSessionID := payload.(string)
+		s.log.Debug("received stop receiving", mlog.String("sessionID", us.cfg.SessionID),
+			mlog.String("sourceSessionID", sourceSessionID))
+		if err := s.handleStopReceiving(us, sourceSessionID); err != nil {
+			return fmt.Errorf("failed to stop receiving: %w", err)
+		}
 	}
 
 	return nil
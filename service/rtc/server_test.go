@@ -5,20 +5,32 @@ package rtc
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/netip"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/mattermost/rtcd/service/perf"
 	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc/dc"
 
 	"github.com/mattermost/mattermost/server/public/shared/mlog"
 	"github.com/mattermost/rtcd/logger"
+	"github.com/pborman/uuid"
 	"github.com/pion/ice/v4"
+	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/rtcerr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 )
 
@@ -197,10 +209,13 @@ func TestDraining(t *testing.T) {
 		s.sessions["test1"] = SessionConfig{}
 		s.mut.Unlock()
 
+		require.False(t, s.IsDraining())
+
 		go func() {
 			time.Sleep(time.Second * 2)
-			_ = s.CloseSession("test")
-			_ = s.CloseSession("test1")
+			require.True(t, s.IsDraining())
+			_ = s.CloseSession("test", CloseReasonLeft)
+			_ = s.CloseSession("test1", CloseReasonLeft)
 		}()
 
 		beforeStop := time.Now()
@@ -209,6 +224,110 @@ func TestDraining(t *testing.T) {
 		require.NoError(t, err)
 
 		require.True(t, time.Since(beforeStop) > time.Second)
+		require.False(t, s.IsDraining())
+	})
+
+	t.Run("call ended", func(t *testing.T) {
+		s, err := NewServer(cfg, log, metrics)
+		require.NoError(t, err)
+		require.NotNil(t, s)
+
+		err = s.Start()
+		require.NoError(t, err)
+
+		groupID := random.NewID()
+		callID := random.NewID()
+		for i := 0; i < 2; i++ {
+			err := s.InitSession(SessionConfig{
+				GroupID:   groupID,
+				CallID:    callID,
+				UserID:    random.NewID(),
+				SessionID: random.NewID(),
+			}, nil)
+			require.NoError(t, err)
+		}
+
+		go func() {
+			time.Sleep(time.Second)
+			_ = s.CloseCall(groupID, callID)
+		}()
+
+		beforeStop := time.Now()
+
+		err = s.Stop()
+		require.NoError(t, err)
+
+		require.True(t, time.Since(beforeStop) > 500*time.Millisecond)
+	})
+}
+
+func TestCloseCall(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	t.Run("not found", func(t *testing.T) {
+		err := s.CloseCall(random.NewID(), random.NewID())
+		require.NoError(t, err)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		groupID := random.NewID()
+		callID := random.NewID()
+		otherCallID := random.NewID()
+
+		reasonCh := make(chan CloseReason, 3)
+		closeCb := func(reason CloseReason) error {
+			reasonCh <- reason
+			return nil
+		}
+
+		var sessionIDs []string
+		for i := 0; i < 2; i++ {
+			sessionIDs = append(sessionIDs, random.NewID())
+			err := s.InitSession(SessionConfig{
+				GroupID:   groupID,
+				CallID:    callID,
+				UserID:    random.NewID(),
+				SessionID: sessionIDs[i],
+			}, closeCb)
+			require.NoError(t, err)
+		}
+
+		otherCfg := SessionConfig{
+			GroupID:   groupID,
+			CallID:    otherCallID,
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err := s.InitSession(otherCfg, nil)
+		require.NoError(t, err)
+		defer func() {
+			err := s.CloseSession(otherCfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		err = s.CloseCall(groupID, callID)
+		require.NoError(t, err)
+
+		require.Len(t, reasonCh, 2)
+		for i := 0; i < 2; i++ {
+			require.Equal(t, CloseReasonKicked, <-reasonCh)
+		}
+		require.Nil(t, s.getGroup(groupID).getCall(callID))
+		require.NotNil(t, s.getGroup(groupID).getCall(otherCallID))
+
+		s.mut.RLock()
+		for _, sessionID := range sessionIDs {
+			require.NotContains(t, s.sessions, sessionID)
+		}
+		s.mut.RUnlock()
+
+		// Ending an already ended call is a no-op.
+		err = s.CloseCall(groupID, callID)
+		require.NoError(t, err)
 	})
 }
 
@@ -269,7 +388,7 @@ func TestInitSession(t *testing.T) {
 
 	for _, cfg := range sessions {
 		go func(id string) {
-			err := s.CloseSession(id)
+			err := s.CloseSession(id, CloseReasonLeft)
 			require.NoError(t, err)
 		}(cfg.SessionID)
 	}
@@ -278,7 +397,371 @@ func TestInitSession(t *testing.T) {
 	require.NoError(t, err)
 }
 
-func connectSession(t *testing.T, cfg SessionConfig, s *Server, receiveCh chan Message) {
+func TestInitSessionMinClientVersion(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	s.cfg.MinClientVersion = "1.2.0"
+	defer func() { s.cfg.MinClientVersion = "" }()
+
+	newCfg := func(version string) SessionConfig {
+		return SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+			Props: SessionProps{
+				"version": version,
+			},
+		}
+	}
+
+	t.Run("old version", func(t *testing.T) {
+		err := s.InitSession(newCfg("1.1.0"), nil)
+		require.ErrorIs(t, err, ErrClientVersionTooOld)
+		require.EqualError(t, err, "invalid session config: client version is too old, please update: 1.1.0 is lower than 1.2.0")
+	})
+
+	t.Run("missing version", func(t *testing.T) {
+		err := s.InitSession(newCfg(""), nil)
+		require.ErrorIs(t, err, ErrClientVersionTooOld)
+	})
+
+	t.Run("current version", func(t *testing.T) {
+		cfg := newCfg("v1.2.0")
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+
+		err = s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	})
+}
+
+func TestInitSessionRequireChannelID(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	t.Run("enabled", func(t *testing.T) {
+		s.cfg.RequireChannelID = true
+		defer func() { s.cfg.RequireChannelID = false }()
+
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err := s.InitSession(cfg, nil)
+		require.ErrorIs(t, err, ErrMissingChannelID)
+
+		cfg.Props = SessionProps{"channelID": random.NewID()}
+		err = s.InitSession(cfg, nil)
+		require.NoError(t, err)
+
+		err = s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+
+		err = s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	})
+}
+
+func TestInitSessionMaxCallParticipants(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.MaxCallParticipants = 3
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+	newCfg := func() SessionConfig {
+		return SessionConfig{
+			GroupID:   groupID,
+			CallID:    callID,
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+	}
+
+	var cfgs []SessionConfig
+	for i := 0; i < s.cfg.MaxCallParticipants; i++ {
+		cfg := newCfg()
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		cfgs = append(cfgs, cfg)
+	}
+	defer func() {
+		for _, cfg := range cfgs {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}
+	}()
+
+	t.Run("full", func(t *testing.T) {
+		goroutines := runtime.NumGoroutine()
+
+		cfg := newCfg()
+		err := s.InitSession(cfg, nil)
+		require.ErrorIs(t, err, ErrCallFull)
+
+		// No peer connection should have been created.
+		require.Equal(t, goroutines, runtime.NumGoroutine())
+		require.Len(t, s.getGroup(groupID).getCall(callID).sessions, s.cfg.MaxCallParticipants)
+
+		metrics := s.metrics.Metrics.(*perf.Metrics)
+		require.Equal(t, 1.0, testutil.ToFloat64(metrics.RTCErrors.With(prometheus.Labels{"groupID": groupID, "type": "call_full"})))
+	})
+
+	t.Run("filled concurrently", func(t *testing.T) {
+		// Covering the case of the call filling up after InitSession checked.
+		peerConn, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+		require.NoError(t, err)
+		defer peerConn.Close()
+
+		us, err := s.addSession(newCfg(), peerConn, nil)
+		require.ErrorIs(t, err, ErrCallFull)
+		require.Nil(t, us)
+	})
+
+	t.Run("other calls", func(t *testing.T) {
+		cfg := newCfg()
+		cfg.CallID = random.NewID()
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		err = s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	})
+
+	t.Run("after leaving", func(t *testing.T) {
+		err := s.CloseSession(cfgs[0].SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+
+		cfg := newCfg()
+		err = s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		cfgs[0] = cfg
+	})
+}
+
+func TestInitSessionOverloaded(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.MaxCPUUtilization = 0.8
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	newCfg := func() SessionConfig {
+		return SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+	}
+
+	t.Run("overloaded", func(t *testing.T) {
+		s.SetCPUUsage(0.9)
+
+		var peerConnCreated bool
+		s.newPeerConnection = func(api *webrtc.API, cfg webrtc.Configuration) (*webrtc.PeerConnection, error) {
+			peerConnCreated = true
+			return api.NewPeerConnection(cfg)
+		}
+
+		cfg := newCfg()
+		err := s.InitSession(cfg, nil)
+		require.ErrorIs(t, err, ErrServerOverloaded)
+		require.False(t, peerConnCreated)
+		require.Nil(t, s.getGroup(cfg.GroupID))
+
+		metrics := s.metrics.Metrics.(*perf.Metrics)
+		require.Equal(t, 1.0, testutil.ToFloat64(metrics.RTCErrors.With(prometheus.Labels{"groupID": cfg.GroupID, "type": "overloaded"})))
+	})
+
+	t.Run("below threshold", func(t *testing.T) {
+		s.SetCPUUsage(0.5)
+
+		cfg := newCfg()
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		err = s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		s.cfg.MaxCPUUtilization = 0
+		s.SetCPUUsage(1)
+
+		cfg := newCfg()
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		err = s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	})
+}
+
+func TestInitSessionPeerConnRetry(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	metrics := s.metrics.Metrics.(*perf.Metrics)
+
+	// Failing the first n creations with the given error.
+	var apis []*webrtc.API
+	failCreations := func(n int, failErr error) {
+		apis = nil
+		s.newPeerConnection = func(api *webrtc.API, cfg webrtc.Configuration) (*webrtc.PeerConnection, error) {
+			apis = append(apis, api)
+			if len(apis) <= n {
+				return nil, failErr
+			}
+			return api.NewPeerConnection(cfg)
+		}
+	}
+
+	newCfg := func() SessionConfig {
+		return SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		failCreations(1, errors.New("transient failure"))
+
+		cfg := newCfg()
+		err := s.InitSession(cfg, nil)
+		require.EqualError(t, err, "failed to create peer connection: transient failure")
+		require.Len(t, apis, 1)
+		require.Zero(t, testutil.ToFloat64(metrics.RTCPeerConnRetries.With(prometheus.Labels{"groupID": cfg.GroupID})))
+	})
+
+	s.cfg.PeerConnectionRetries = 2
+
+	t.Run("transient failure", func(t *testing.T) {
+		failCreations(1, errors.New("transient failure"))
+
+		cfg := newCfg()
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		// The retry should happen with a newly built API.
+		require.Len(t, apis, 2)
+		require.NotSame(t, apis[0], apis[1])
+		require.Equal(t, 1.0, testutil.ToFloat64(metrics.RTCPeerConnRetries.With(prometheus.Labels{"groupID": cfg.GroupID})))
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		failCreations(3, errors.New("transient failure"))
+
+		cfg := newCfg()
+		err := s.InitSession(cfg, nil)
+		require.EqualError(t, err, "failed to create peer connection: transient failure")
+		require.Len(t, apis, 3)
+		require.Equal(t, 2.0, testutil.ToFloat64(metrics.RTCPeerConnRetries.With(prometheus.Labels{"groupID": cfg.GroupID})))
+	})
+
+	t.Run("config error", func(t *testing.T) {
+		failCreations(1, &rtcerr.InvalidAccessError{Err: webrtc.ErrNoTurnCredentials})
+
+		cfg := newCfg()
+		err := s.InitSession(cfg, nil)
+		require.ErrorIs(t, err, webrtc.ErrNoTurnCredentials)
+		require.Len(t, apis, 1)
+		require.Zero(t, testutil.ToFloat64(metrics.RTCPeerConnRetries.With(prometheus.Labels{"groupID": cfg.GroupID})))
+	})
+}
+
+func TestInitSessionIDValidator(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	metrics := perf.NewMetrics("rtcd", nil)
+	require.NotNil(t, metrics)
+
+	cfg := ServerConfig{
+		ICEPortUDP:      30433,
+		ICEPortTCP:      30433,
+		UDPSocketsCount: GetDefaultUDPListeningSocketsCount(),
+	}
+
+	t.Run("nil validator", func(t *testing.T) {
+		s, err := NewServer(cfg, log, metrics, WithSessionIDValidator(nil))
+		require.EqualError(t, err, "failed to apply option: session ID validator should not be nil")
+		require.Nil(t, s)
+	})
+
+	t.Run("uuid validator", func(t *testing.T) {
+		s, err := NewServer(cfg, log, metrics, WithSessionIDValidator(func(sessionID string) error {
+			if uuid.Parse(sessionID) == nil {
+				return fmt.Errorf("should be a valid UUID")
+			}
+			return nil
+		}))
+		require.NoError(t, err)
+		require.NotNil(t, s)
+
+		err = s.Start()
+		require.NoError(t, err)
+		defer func() {
+			err := s.Stop()
+			require.NoError(t, err)
+		}()
+
+		sessionCfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err = s.InitSession(sessionCfg, nil)
+		require.EqualError(t, err, "invalid session config: invalid SessionID value: should be a valid UUID")
+
+		sessionCfg.SessionID = uuid.New()
+		err = s.InitSession(sessionCfg, nil)
+		require.NoError(t, err)
+
+		err = s.CloseSession(sessionCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	})
+}
+
+func connectSession(t *testing.T, cfg SessionConfig, s *Server, receiveCh chan Message, tracks ...webrtc.TrackLocal) {
 	t.Helper()
 
 	connectCh := make(chan struct{})
@@ -316,6 +799,11 @@ func connectSession(t *testing.T, cfg SessionConfig, s *Server, receiveCh chan M
 	require.NoError(t, err)
 	require.NotNil(t, dc)
 
+	for _, track := range tracks {
+		_, err := pc.AddTrack(track)
+		require.NoError(t, err)
+	}
+
 	offer, err := pc.CreateOffer(nil)
 	require.NoError(t, err)
 
@@ -378,130 +866,412 @@ func connectSession(t *testing.T, cfg SessionConfig, s *Server, receiveCh chan M
 	connectWg.Wait()
 }
 
-func TestCalls(t *testing.T) {
-	log, err := logger.New(logger.Config{
-		EnableConsole: true,
-		ConsoleLevel:  "INFO",
-	})
+func TestInitSessionConcurrencyLimit(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.MaxConcurrentSessionInits = 1
+	s.initSem = make(chan struct{}, s.cfg.MaxConcurrentSessionInits)
+
+	err := s.Start()
 	require.NoError(t, err)
+
+	newCfg := func() SessionConfig {
+		return SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+	}
+
+	t.Run("queued", func(t *testing.T) {
+		// Simulating an ongoing initialization.
+		s.initSem <- struct{}{}
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			<-s.initSem
+		}()
+
+		cfg := newCfg()
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		require.Empty(t, s.initSem)
+
+		err = s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		s.initSem <- struct{}{}
+		defer func() { <-s.initSem }()
+
+		err := s.InitSession(newCfg(), nil)
+		require.ErrorIs(t, err, ErrSessionInitTimeout)
+	})
+}
+
+func BenchmarkInitSessionBurst(b *testing.B) {
+	log, err := mlog.NewLogger()
+	require.NoError(b, err)
 	defer func() {
 		err := log.Shutdown()
-		require.NoError(t, err)
+		require.NoError(b, err)
 	}()
 
 	metrics := perf.NewMetrics("rtcd", nil)
-	require.NotNil(t, metrics)
+	require.NotNil(b, metrics)
 
-	cfg := ServerConfig{
-		ICEPortUDP:      30433,
-		ICEPortTCP:      30433,
-		UDPSocketsCount: GetDefaultUDPListeningSocketsCount(),
+	nSessions := 50
+
+	for _, limit := range []int{0, 4} {
+		b.Run(fmt.Sprintf("limit=%d", limit), func(b *testing.B) {
+			cfg := ServerConfig{
+				ICEPortUDP:                30433,
+				ICEPortTCP:                30433,
+				UDPSocketsCount:           GetDefaultUDPListeningSocketsCount(),
+				MaxConcurrentSessionInits: limit,
+			}
+			s, err := NewServer(cfg, log, metrics)
+			require.NoError(b, err)
+			err = s.Start()
+			require.NoError(b, err)
+			defer func() {
+				err := s.Stop()
+				require.NoError(b, err)
+			}()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				callID := random.NewID()
+				sessions := make([]SessionConfig, nSessions)
+				for j := range sessions {
+					sessions[j] = SessionConfig{
+						GroupID:   "groupID",
+						CallID:    callID,
+						UserID:    random.NewID(),
+						SessionID: random.NewID(),
+					}
+				}
+
+				var wg sync.WaitGroup
+				wg.Add(nSessions)
+				for _, cfg := range sessions {
+					go func(cfg SessionConfig) {
+						defer wg.Done()
+						if err := s.InitSession(cfg, nil); err != nil {
+							b.Error(err)
+						}
+					}(cfg)
+				}
+				wg.Wait()
+
+				b.StopTimer()
+				for _, cfg := range sessions {
+					if err := s.CloseSession(cfg.SessionID, CloseReasonLeft); err != nil {
+						b.Error(err)
+					}
+				}
+				b.StartTimer()
+			}
+		})
 	}
+}
 
-	s, err := NewServer(cfg, log, metrics)
+func TestCloseSessionReason(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
 	require.NoError(t, err)
-	require.NotNil(t, s)
 
-	nCalls := 5
-	nSessionsPerCall := 5
+	initSession := func(t *testing.T) (SessionConfig, <-chan CloseReason) {
+		t.Helper()
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		reasonCh := make(chan CloseReason, 1)
+		err := s.InitSession(cfg, func(reason CloseReason) error {
+			reasonCh <- reason
+			return nil
+		})
+		require.NoError(t, err)
+		return cfg, reasonCh
+	}
 
-	err = s.Start()
+	waitReason := func(t *testing.T, reasonCh <-chan CloseReason) CloseReason {
+		t.Helper()
+		select {
+		case reason := <-reasonCh:
+			return reason
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for close callback")
+		}
+		return ""
+	}
+
+	t.Run("left", func(t *testing.T) {
+		cfg, reasonCh := initSession(t)
+		err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+		require.Equal(t, CloseReasonLeft, waitReason(t, reasonCh))
+	})
+
+	t.Run("kicked", func(t *testing.T) {
+		cfg, reasonCh := initSession(t)
+		err := s.CloseSession(cfg.SessionID, CloseReasonKicked)
+		require.NoError(t, err)
+		require.Equal(t, CloseReasonKicked, waitReason(t, reasonCh))
+	})
+
+	t.Run("failed signaling", func(t *testing.T) {
+		cfg, reasonCh := initSession(t)
+
+		offerData, err := json.Marshal(webrtc.SessionDescription{
+			Type: webrtc.SDPTypeOffer,
+			SDP:  "invalid",
+		})
+		require.NoError(t, err)
+
+		err = s.Send(Message{
+			GroupID:   cfg.GroupID,
+			CallID:    cfg.CallID,
+			UserID:    cfg.UserID,
+			SessionID: cfg.SessionID,
+			Type:      SDPMessage,
+			Data:      offerData,
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, CloseReasonFailed, waitReason(t, reasonCh))
+	})
+
+	t.Run("signaling timeout", func(t *testing.T) {
+		s.cfg.SignalingTimeoutMs = 1000
+		defer func() { s.cfg.SignalingTimeoutMs = 0 }()
+
+		// No offer is ever sent.
+		start := time.Now()
+		_, reasonCh := initSession(t)
+		require.Equal(t, CloseReasonFailed, waitReason(t, reasonCh))
+		require.GreaterOrEqual(t, time.Since(start), time.Second)
+		require.Less(t, time.Since(start), signalingTimeout)
+	})
+}
+
+func TestScreenShareReject(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
 	require.NoError(t, err)
 
-	receiveChans := make(map[string]chan Message)
-	var sessions []SessionConfig
 	groupID := random.NewID()
-	for i := 0; i < nCalls; i++ {
-		callID := random.NewID()
-		for j := 0; j < nSessionsPerCall; j++ {
-			sessionID := random.NewID()
-			sessions = append(sessions, SessionConfig{
-				GroupID:   groupID,
-				CallID:    callID,
-				UserID:    random.NewID(),
-				SessionID: sessionID,
-			})
+	callID := random.NewID()
 
-			receiveChans[sessionID] = make(chan Message, 50)
+	var sessions []SessionConfig
+	for i := 0; i < 2; i++ {
+		cfg := SessionConfig{
+			GroupID:   groupID,
+			CallID:    callID,
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
 		}
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+		sessions = append(sessions, cfg)
 	}
 
-	go func() {
-		for msg := range s.ReceiveCh() {
-			select {
-			case receiveChans[msg.SessionID] <- msg:
-			default:
-				require.FailNow(t, "channel is full")
-			}
+	screenOn := func(cfg SessionConfig, screenStreamID string) {
+		t.Helper()
+		data, err := json.Marshal(map[string]string{"screenStreamID": screenStreamID})
+		require.NoError(t, err)
+		err = s.Send(Message{
+			GroupID:   cfg.GroupID,
+			UserID:    cfg.UserID,
+			SessionID: cfg.SessionID,
+			CallID:    cfg.CallID,
+			Type:      ScreenOnMessage,
+			Data:      data,
+		})
+		require.NoError(t, err)
+	}
+
+	// Both sessions attempt to start sharing at the same time.
+	screenOn(sessions[0], "streamA")
+	screenOn(sessions[1], "streamB")
+
+	select {
+	case msg := <-s.ReceiveCh():
+		require.Equal(t, ScreenRejectMessage, msg.Type)
+		require.Equal(t, sessions[1].SessionID, msg.SessionID)
+
+		var data map[string]string
+		err := json.Unmarshal(msg.Data, &data)
+		require.NoError(t, err)
+		require.Equal(t, "streamB", data["screenStreamID"])
+		require.Equal(t, ErrScreenShareActive.Error(), data["reason"])
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for reject message")
+	}
+
+	c := s.getGroup(groupID).getCall(callID)
+	require.NotNil(t, c)
+	screenSession := c.getScreenSession()
+	require.NotNil(t, screenSession)
+	require.Equal(t, sessions[0].SessionID, screenSession.cfg.SessionID)
+	require.Equal(t, "streamA", screenSession.getScreenStreamID())
+
+	rejected := c.getSession(sessions[1].SessionID)
+	require.NotNil(t, rejected)
+	require.Empty(t, rejected.getScreenStreamID())
+	require.Equal(t, "streamB", rejected.getRejectedScreenStreamID())
+
+	t.Run("source change", func(t *testing.T) {
+		screenSession.mut.Lock()
+		screenSession.outScreenTracks[getTrackIndex(webrtc.MimeTypeVP8, SimulcastLevelDefault)] = []*webrtc.TrackLocalStaticRTP{}
+		screenSession.mut.Unlock()
+
+		// The sharing session changing its source is not rejected.
+		screenOn(sessions[0], "streamC")
+		require.Eventually(t, func() bool {
+			return screenSession.getScreenStreamID() == "streamC"
+		}, time.Second, 10*time.Millisecond)
+		require.Equal(t, screenSession, c.getScreenSession())
+		require.Empty(t, screenSession.getRejectedScreenStreamID())
+
+		// The tracks of the previous source are dropped.
+		screenSession.mut.RLock()
+		require.Empty(t, screenSession.outScreenTracks)
+		screenSession.mut.RUnlock()
+
+		select {
+		case msg := <-s.ReceiveCh():
+			require.Fail(t, "unexpected message", msg.Type)
+		case <-time.After(100 * time.Millisecond):
 		}
-	}()
+	})
+}
 
-	var initWg sync.WaitGroup
-	initWg.Add(len(sessions))
-	for _, cfg := range sessions {
-		go func(cfg SessionConfig) {
-			defer initWg.Done()
-			err := s.InitSession(cfg, nil)
+func TestMaxUnmutedSpeakers(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.MaxUnmutedSpeakers = 2
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+
+	var sessions []SessionConfig
+	for i := 0; i < 3; i++ {
+		cfg := SessionConfig{
+			GroupID:   groupID,
+			CallID:    callID,
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
 			require.NoError(t, err)
-		}(cfg)
+		}()
+		sessions = append(sessions, cfg)
 	}
-	initWg.Wait()
 
-	var connectWg sync.WaitGroup
-	connectWg.Add(len(sessions))
+	c := s.getGroup(groupID).getCall(callID)
+	require.NotNil(t, c)
+
+	// Voice tracks are only created upon receiving media so we set them
+	// directly.
 	for _, cfg := range sessions {
-		go func(cfg SessionConfig) {
-			defer connectWg.Done()
-			connectSession(t, cfg, s, receiveChans[cfg.SessionID])
-		}(cfg)
+		us := c.getSession(cfg.SessionID)
+		require.NotNil(t, us)
+		track, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, genTrackID(trackTypeVoice, cfg.SessionID, 0), random.NewID())
+		require.NoError(t, err)
+		us.mut.Lock()
+		us.outVoiceTrack = track
+		us.mut.Unlock()
 	}
-	connectWg.Wait()
 
-	var closeWg sync.WaitGroup
-	closeWg.Add(len(sessions))
-	for _, cfg := range sessions {
-		go func(id string) {
-			defer closeWg.Done()
-			err := s.CloseSession(id)
-			require.NoError(t, err)
-		}(cfg.SessionID)
+	sendMsg := func(cfg SessionConfig, msgType MessageType) {
+		t.Helper()
+		err := s.Send(Message{
+			GroupID:   cfg.GroupID,
+			UserID:    cfg.UserID,
+			SessionID: cfg.SessionID,
+			CallID:    cfg.CallID,
+			Type:      msgType,
+		})
+		require.NoError(t, err)
 	}
-	closeWg.Wait()
 
-	err = s.Stop()
-	require.NoError(t, err)
-}
+	isEnabled := func(cfg SessionConfig) bool {
+		us := c.getSession(cfg.SessionID)
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		return us.outVoiceTrackEnabled
+	}
 
-func TestTCPCandidates(t *testing.T) {
-	log, err := logger.New(logger.Config{
-		EnableConsole: true,
-		ConsoleLevel:  "DEBUG",
-	})
-	require.NoError(t, err)
-	defer func() {
-		err := log.Shutdown()
-		require.NoError(t, err)
-	}()
+	sendMsg(sessions[0], UnmuteMessage)
+	sendMsg(sessions[1], UnmuteMessage)
+	require.Eventually(t, func() bool {
+		return isEnabled(sessions[0]) && isEnabled(sessions[1])
+	}, time.Second, 10*time.Millisecond)
 
-	metrics := perf.NewMetrics("rtcd", nil)
-	require.NotNil(t, metrics)
+	// The third unmute exceeds the limit.
+	sendMsg(sessions[2], UnmuteMessage)
 
-	serverCfg := ServerConfig{
-		ICEPortUDP:      30433,
-		ICEPortTCP:      30433,
-		UDPSocketsCount: GetDefaultUDPListeningSocketsCount(),
+	select {
+	case msg := <-s.ReceiveCh():
+		require.Equal(t, UnmuteRejectMessage, msg.Type)
+		require.Equal(t, sessions[2].SessionID, msg.SessionID)
+
+		var data map[string]string
+		err := json.Unmarshal(msg.Data, &data)
+		require.NoError(t, err)
+		require.Equal(t, ErrMaxUnmutedSpeakers.Error(), data["reason"])
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for reject message")
 	}
+	require.False(t, isEnabled(sessions[2]))
+
+	// Unmuting again is a no-op for sessions already counted.
+	sendMsg(sessions[1], UnmuteMessage)
+
+	// Once a speaker mutes, a slot frees up.
+	sendMsg(sessions[0], MuteMessage)
+	require.Eventually(t, func() bool {
+		return !isEnabled(sessions[0])
+	}, time.Second, 10*time.Millisecond)
+
+	sendMsg(sessions[2], UnmuteMessage)
+	require.Eventually(t, func() bool {
+		return isEnabled(sessions[2])
+	}, time.Second, 10*time.Millisecond)
+	require.True(t, isEnabled(sessions[1]))
+	require.Empty(t, s.ReceiveCh())
+
+	metrics := s.metrics.Metrics.(*perf.Metrics)
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.RTCErrors.With(prometheus.Labels{"groupID": groupID, "type": "unmute_reject"})))
+}
 
-	s, err := NewServer(serverCfg, log, metrics)
-	require.NoError(t, err)
-	require.NotNil(t, s)
+func TestMuteDuringVoiceTrackAdd(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
 
-	err = s.Start()
+	err := s.Start()
 	require.NoError(t, err)
-	defer func() {
-		err := s.Stop()
-		require.NoError(t, err)
-	}()
 
 	cfg := SessionConfig{
 		GroupID:   random.NewID(),
@@ -509,242 +1279,2393 @@ func TestTCPCandidates(t *testing.T) {
 		UserID:    random.NewID(),
 		SessionID: random.NewID(),
 	}
-	err = s.InitSession(cfg, nil)
-	require.NoError(t, err)
 
-	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
-	require.NoError(t, err)
+	sendMsg := func(msgType MessageType, data []byte) {
+		t.Helper()
+		err := s.Send(Message{
+			GroupID:   cfg.GroupID,
+			UserID:    cfg.UserID,
+			SessionID: cfg.SessionID,
+			CallID:    cfg.CallID,
+			Type:      msgType,
+			Data:      data,
+		})
+		require.NoError(t, err)
+	}
+
+	initSession := setupTestPeers(t, s)
+	pc := initSession(cfg)
 	defer pc.Close()
+	defer func() {
+		err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
 
-	dc, err := pc.CreateDataChannel("calls-dc", nil)
-	require.NoError(t, err)
-	require.NotNil(t, dc)
+	us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+	require.NotNil(t, us)
+	require.Eventually(t, func() bool {
+		return pc.ConnectionState() == webrtc.PeerConnectionStateConnected
+	}, 10*time.Second, 50*time.Millisecond)
+
+	getVoiceState := func() (bool, bool) {
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		return us.outVoiceTrack != nil, us.outVoiceTrackEnabled
+	}
 
+	// Adding the voice track through a renegotiation, as done when unmuting,
+	// and muting again while it's still in flight.
+	voiceTrack, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, "voice", random.NewID())
+	require.NoError(t, err)
+	_, err = pc.AddTrack(voiceTrack)
+	require.NoError(t, err)
 	offer, err := pc.CreateOffer(nil)
 	require.NoError(t, err)
-
 	err = pc.SetLocalDescription(offer)
 	require.NoError(t, err)
-
-	offerData, err := json.Marshal(&offer)
+	data, err := json.Marshal(offer)
 	require.NoError(t, err)
+	sendMsg(SDPMessage, data)
+	sendMsg(UnmuteMessage, nil)
+	sendMsg(MuteMessage, nil)
 
-	err = s.Send(Message{
-		GroupID:   cfg.GroupID,
-		CallID:    cfg.CallID,
-		UserID:    cfg.UserID,
-		SessionID: cfg.SessionID,
-		Type:      SDPMessage,
-		Data:      offerData,
-	})
-	require.NoError(t, err)
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		var seq uint16
+		for {
+			select {
+			case <-ticker.C:
+				seq++
+				_ = voiceTrack.WriteRTP(&rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						SequenceNumber: seq,
+						Timestamp:      uint32(seq) * 960,
+					},
+					Payload: []byte{0x08, 0x01, 0x02},
+				})
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(stopCh)
+		<-doneCh
+	}()
 
-	for msg := range s.ReceiveCh() {
+	require.Eventually(t, func() bool {
+		received, _ := getVoiceState()
+		return received
+	}, 10*time.Second, 20*time.Millisecond)
+
+	// The mute should be honored after the track is added.
+	require.Never(t, func() bool {
+		_, enabled := getVoiceState()
+		return enabled
+	}, 500*time.Millisecond, 20*time.Millisecond)
+
+	sendMsg(UnmuteMessage, nil)
+	require.Eventually(t, func() bool {
+		_, enabled := getVoiceState()
+		return enabled
+	}, time.Second, 10*time.Millisecond)
+
+	sendMsg(MuteMessage, nil)
+	require.Eventually(t, func() bool {
+		_, enabled := getVoiceState()
+		return !enabled
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestGroupMessagesRateLimit(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	groupA := random.NewID()
+	groupB := random.NewID()
+	s.cfg.GroupMessagesPerSecond = map[string]int{groupA: 10}
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	var sessions []SessionConfig
+	for _, groupID := range []string{groupA, groupB} {
+		cfg := SessionConfig{
+			GroupID:   groupID,
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+		sessions = append(sessions, cfg)
+	}
+	floodCfg, cfg := sessions[0], sessions[1]
+
+	// Group A floods more signaling messages than the shared channel can
+	// hold. The group set in the message is not trusted so claiming another
+	// one doesn't help.
+	n := 2 * msgChSize
+	var failed int
+	for i := 0; i < n; i++ {
+		err := s.Send(Message{
+			GroupID:   groupB,
+			CallID:    floodCfg.CallID,
+			UserID:    floodCfg.UserID,
+			SessionID: floodCfg.SessionID,
+			Type:      ICEMessage,
+			Data:      []byte(`{"candidate":{}}`),
+		})
+		if err != nil {
+			failed++
+		}
+	}
+
+	// Group B's messages still go through promptly.
+	data, err := json.Marshal(map[string]string{"screenStreamID": "streamID"})
+	require.NoError(t, err)
+	err = s.Send(Message{
+		GroupID:   cfg.GroupID,
+		CallID:    cfg.CallID,
+		UserID:    cfg.UserID,
+		SessionID: cfg.SessionID,
+		Type:      ScreenOnMessage,
+		Data:      data,
+	})
+	require.NoError(t, err)
+
+	us := s.getGroup(groupB).getCall(cfg.CallID).getSession(cfg.SessionID)
+	require.NotNil(t, us)
+	require.Eventually(t, func() bool {
+		return us.getScreenStreamID() == "streamID"
+	}, time.Second, 10*time.Millisecond)
+
+	// Excess messages are queued, and only dropped once the queue is full.
+	metrics := s.metrics.Metrics.(*perf.Metrics)
+	dropped := testutil.ToFloat64(metrics.RTCDroppedMessages.With(prometheus.Labels{"groupID": groupA, "channel": "send", "reason": "rate_limit"}))
+	require.Equal(t, float64(failed), dropped)
+	require.Greater(t, dropped, float64(n-groupSignalingQueueSize-100))
+	require.LessOrEqual(t, dropped, float64(n-groupSignalingQueueSize))
+	require.Zero(t, testutil.ToFloat64(metrics.RTCDroppedMessages.With(prometheus.Labels{"groupID": groupB, "channel": "send", "reason": "rate_limit"})))
+
+	// State changing messages are never limited.
+	floodSession := s.getGroup(groupA).getCall(floodCfg.CallID).getSession(floodCfg.SessionID)
+	require.NotNil(t, floodSession)
+	for _, msgType := range []MessageType{UnmuteMessage, MuteMessage} {
+		err := s.Send(Message{
+			GroupID:   floodCfg.GroupID,
+			CallID:    floodCfg.CallID,
+			UserID:    floodCfg.UserID,
+			SessionID: floodCfg.SessionID,
+			Type:      msgType,
+		})
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool {
+		floodSession.mut.RLock()
+		defer floodSession.mut.RUnlock()
+		return floodSession.voiceMuted
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, dropped, testutil.ToFloat64(metrics.RTCDroppedMessages.With(prometheus.Labels{"groupID": groupA, "channel": "send", "reason": "rate_limit"})))
+}
+
+func TestActiveCountMetrics(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupA := random.NewID()
+	groupB := random.NewID()
+	callA1 := random.NewID()
+	callA2 := random.NewID()
+	callB := random.NewID()
+
+	var sessions []SessionConfig
+	for _, ids := range [][2]string{{groupA, callA1}, {groupA, callA1}, {groupA, callA2}, {groupB, callB}} {
+		cfg := SessionConfig{
+			GroupID:   ids[0],
+			CallID:    ids[1],
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		sessions = append(sessions, cfg)
+	}
+
+	metrics := s.metrics.Metrics.(*perf.Metrics)
+	sessionsCount := func(groupID string) float64 {
+		return testutil.ToFloat64(metrics.RTCSessions.With(prometheus.Labels{"groupID": groupID}))
+	}
+
+	require.Equal(t, 3.0, sessionsCount(groupA))
+	require.Equal(t, 1.0, sessionsCount(groupB))
+	require.Equal(t, 3.0, testutil.ToFloat64(metrics.RTCCalls))
+	require.Equal(t, 2.0, testutil.ToFloat64(metrics.RTCGroups))
+	require.Greater(t, testutil.ToFloat64(metrics.Goroutines), 0.0)
+
+	// Closing the only session in group B.
+	err = s.CloseSession(sessions[3].SessionID, CloseReasonLeft)
+	require.NoError(t, err)
+	require.Equal(t, 3.0, sessionsCount(groupA))
+	require.Zero(t, sessionsCount(groupB))
+	require.Equal(t, 2.0, testutil.ToFloat64(metrics.RTCCalls))
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.RTCGroups))
+
+	// Closing a session in a call that still has others.
+	err = s.CloseSession(sessions[0].SessionID, CloseReasonLeft)
+	require.NoError(t, err)
+	require.Equal(t, 2.0, sessionsCount(groupA))
+	require.Equal(t, 2.0, testutil.ToFloat64(metrics.RTCCalls))
+
+	// Closing twice is a no-op.
+	err = s.CloseSession(sessions[0].SessionID, CloseReasonLeft)
+	require.NoError(t, err)
+	require.Equal(t, 2.0, sessionsCount(groupA))
+
+	for _, cfg := range sessions[1:3] {
+		err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}
+	require.Zero(t, sessionsCount(groupA))
+	require.Zero(t, testutil.ToFloat64(metrics.RTCCalls))
+	require.Zero(t, testutil.ToFloat64(metrics.RTCGroups))
+}
+
+func TestUnexpectedVideoTrackHold(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.UnexpectedVideoTrackHoldMs = 2000
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+
+	var sessions []SessionConfig
+	receiveChans := make(map[string]chan Message)
+	for i := 0; i < 2; i++ {
+		cfg := SessionConfig{
+			GroupID:   groupID,
+			CallID:    callID,
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		receiveChans[cfg.SessionID] = make(chan Message, 50)
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+		sessions = append(sessions, cfg)
+	}
+
+	go func() {
+		for msg := range s.ReceiveCh() {
+			select {
+			case receiveChans[msg.SessionID] <- msg:
+			default:
+			}
+		}
+	}()
+
+	sendMsg := func(cfg SessionConfig, msgType MessageType, data map[string]string) {
+		t.Helper()
+		js, err := json.Marshal(data)
+		require.NoError(t, err)
+		err = s.Send(Message{
+			GroupID:   cfg.GroupID,
+			UserID:    cfg.UserID,
+			SessionID: cfg.SessionID,
+			CallID:    cfg.CallID,
+			Type:      msgType,
+			Data:      js,
+		})
+		require.NoError(t, err)
+	}
+
+	// The first session is sharing its screen.
+	sendMsg(sessions[0], ScreenOnMessage, map[string]string{"screenStreamID": "streamA"})
+
+	// The second session starts sharing, with its track arriving before the
+	// first session's screen share is stopped and its own ScreenOn message.
+	track, err := webrtc.NewTrackLocalStaticRTP(rtpVideoCodecs[webrtc.MimeTypeVP8].RTPCodecCapability, "screen", "streamB")
+	require.NoError(t, err)
+	connectSession(t, sessions[1], s, receiveChans[sessions[1].SessionID], track)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		var seq uint16
+		for {
+			select {
+			case <-ticker.C:
+				seq++
+				_ = track.WriteRTP(&rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						SequenceNumber: seq,
+						Timestamp:      uint32(seq) * 3000,
+					},
+					Payload: []byte{0x10, 0x00, 0x00, 0x00},
+				})
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	sendMsg(sessions[0], ScreenOffMessage, nil)
+	sendMsg(sessions[1], ScreenOnMessage, map[string]string{"screenStreamID": "streamB"})
+
+	us := s.getGroup(groupID).getCall(callID).getSession(sessions[1].SessionID)
+	require.NotNil(t, us)
+	require.Eventually(t, func() bool {
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		return len(us.outScreenTracks) > 0
+	}, 4*time.Second, 50*time.Millisecond)
+}
+
+func TestCalls(t *testing.T) {
+	log, err := logger.New(logger.Config{
+		EnableConsole: true,
+		ConsoleLevel:  "INFO",
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	metrics := perf.NewMetrics("rtcd", nil)
+	require.NotNil(t, metrics)
+
+	cfg := ServerConfig{
+		ICEPortUDP:      30433,
+		ICEPortTCP:      30433,
+		UDPSocketsCount: GetDefaultUDPListeningSocketsCount(),
+	}
+
+	s, err := NewServer(cfg, log, metrics)
+	require.NoError(t, err)
+	require.NotNil(t, s)
+
+	nCalls := 5
+	nSessionsPerCall := 5
+
+	err = s.Start()
+	require.NoError(t, err)
+
+	receiveChans := make(map[string]chan Message)
+	var sessions []SessionConfig
+	groupID := random.NewID()
+	for i := 0; i < nCalls; i++ {
+		callID := random.NewID()
+		for j := 0; j < nSessionsPerCall; j++ {
+			sessionID := random.NewID()
+			sessions = append(sessions, SessionConfig{
+				GroupID:   groupID,
+				CallID:    callID,
+				UserID:    random.NewID(),
+				SessionID: sessionID,
+			})
+
+			receiveChans[sessionID] = make(chan Message, 50)
+		}
+	}
+
+	go func() {
+		for msg := range s.ReceiveCh() {
+			select {
+			case receiveChans[msg.SessionID] <- msg:
+			default:
+				require.FailNow(t, "channel is full")
+			}
+		}
+	}()
+
+	var initWg sync.WaitGroup
+	initWg.Add(len(sessions))
+	for _, cfg := range sessions {
+		go func(cfg SessionConfig) {
+			defer initWg.Done()
+			err := s.InitSession(cfg, nil)
+			require.NoError(t, err)
+		}(cfg)
+	}
+	initWg.Wait()
+
+	var connectWg sync.WaitGroup
+	connectWg.Add(len(sessions))
+	for _, cfg := range sessions {
+		go func(cfg SessionConfig) {
+			defer connectWg.Done()
+			connectSession(t, cfg, s, receiveChans[cfg.SessionID])
+		}(cfg)
+	}
+	connectWg.Wait()
+
+	var closeWg sync.WaitGroup
+	closeWg.Add(len(sessions))
+	for _, cfg := range sessions {
+		go func(id string) {
+			defer closeWg.Done()
+			err := s.CloseSession(id, CloseReasonLeft)
+			require.NoError(t, err)
+		}(cfg.SessionID)
+	}
+	closeWg.Wait()
+
+	err = s.Stop()
+	require.NoError(t, err)
+}
+
+func TestTCPCandidates(t *testing.T) {
+	log, err := logger.New(logger.Config{
+		EnableConsole: true,
+		ConsoleLevel:  "DEBUG",
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	metrics := perf.NewMetrics("rtcd", nil)
+	require.NotNil(t, metrics)
+
+	serverCfg := ServerConfig{
+		ICEPortUDP:      30433,
+		ICEPortTCP:      30433,
+		UDPSocketsCount: GetDefaultUDPListeningSocketsCount(),
+	}
+
+	s, err := NewServer(serverCfg, log, metrics)
+	require.NoError(t, err)
+	require.NotNil(t, s)
+
+	err = s.Start()
+	require.NoError(t, err)
+	defer func() {
+		err := s.Stop()
+		require.NoError(t, err)
+	}()
+
+	cfg := SessionConfig{
+		GroupID:   random.NewID(),
+		CallID:    random.NewID(),
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+	err = s.InitSession(cfg, nil)
+	require.NoError(t, err)
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer pc.Close()
+
+	dc, err := pc.CreateDataChannel("calls-dc", nil)
+	require.NoError(t, err)
+	require.NotNil(t, dc)
+
+	offer, err := pc.CreateOffer(nil)
+	require.NoError(t, err)
+
+	err = pc.SetLocalDescription(offer)
+	require.NoError(t, err)
+
+	offerData, err := json.Marshal(&offer)
+	require.NoError(t, err)
+
+	err = s.Send(Message{
+		GroupID:   cfg.GroupID,
+		CallID:    cfg.CallID,
+		UserID:    cfg.UserID,
+		SessionID: cfg.SessionID,
+		Type:      SDPMessage,
+		Data:      offerData,
+	})
+	require.NoError(t, err)
+
+	for msg := range s.ReceiveCh() {
 		if msg.Type == ICEMessage {
 			data := make(map[string]any)
 			err := json.Unmarshal(msg.Data, &data)
 			require.NoError(t, err)
 
-			iceString := data["candidate"].(map[string]interface{})["candidate"].(string)
+			iceString := data["candidate"].(map[string]interface{})["candidate"].(string)
+
+			candidate, err := ice.UnmarshalCandidate(iceString)
+			require.NoError(t, err)
+
+			require.Equal(t, ice.CandidateTypeHost, candidate.Type())
+			require.Equal(t, serverCfg.ICEPortTCP, candidate.Port())
+
+			if candidate.NetworkType() == ice.NetworkTypeTCP4 {
+				break
+			}
+		}
+	}
+
+	err = s.CloseSession(cfg.SessionID, CloseReasonLeft)
+	require.NoError(t, err)
+}
+
+func TestICEHostPortOverride(t *testing.T) {
+	log, err := logger.New(logger.Config{
+		EnableConsole: true,
+		ConsoleLevel:  "DEBUG",
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	metrics := perf.NewMetrics("rtcd", nil)
+	require.NotNil(t, metrics)
+
+	gatherCandidates := func(serverCfg ServerConfig, publicAddrsMap map[netip.Addr]string) <-chan ice.Candidate {
+		s, err := NewServer(serverCfg, log, metrics)
+		require.NoError(t, err)
+		require.NotNil(t, s)
+
+		if publicAddrsMap != nil {
+			s.setPublicAddrsMap(publicAddrsMap)
+		}
+
+		err = s.Start()
+		require.NoError(t, err)
+		defer func() {
+			err := s.Stop()
+			require.NoError(t, err)
+		}()
+
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err = s.InitSession(cfg, nil)
+		require.NoError(t, err)
+
+		pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+		require.NoError(t, err)
+		defer pc.Close()
+
+		dc, err := pc.CreateDataChannel("calls-dc", nil)
+		require.NoError(t, err)
+		require.NotNil(t, dc)
+
+		offer, err := pc.CreateOffer(nil)
+		require.NoError(t, err)
+
+		err = pc.SetLocalDescription(offer)
+		require.NoError(t, err)
+
+		offerData, err := json.Marshal(&offer)
+		require.NoError(t, err)
+
+		err = s.Send(Message{
+			GroupID:   cfg.GroupID,
+			CallID:    cfg.CallID,
+			UserID:    cfg.UserID,
+			SessionID: cfg.SessionID,
+			Type:      SDPMessage,
+			Data:      offerData,
+		})
+		require.NoError(t, err)
+
+		candidatesCh := make(chan ice.Candidate, 10)
+		go func() {
+			for msg := range s.ReceiveCh() {
+				if msg.Type == ICEMessage {
+					data := make(map[string]any)
+					err := json.Unmarshal(msg.Data, &data)
+					require.NoError(t, err)
+
+					iceString := data["candidate"].(map[string]interface{})["candidate"].(string)
+
+					candidate, err := ice.UnmarshalCandidate(iceString)
+					require.NoError(t, err)
+
+					candidatesCh <- candidate
+				}
+			}
+		}()
+
+		time.Sleep(time.Second)
+
+		err = s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+
+		return candidatesCh
+	}
+
+	t.Run("no host override", func(t *testing.T) {
+		serverCfg := ServerConfig{
+			ICEPortUDP:          30433,
+			ICEPortTCP:          30433,
+			ICEHostPortOverride: "8443",
+			UDPSocketsCount:     GetDefaultUDPListeningSocketsCount(),
+		}
+
+		candidatesCh := gatherCandidates(serverCfg, nil)
+
+		require.NotEmpty(t, candidatesCh)
+		for i := 0; i < len(candidatesCh); i++ {
+			candidate := <-candidatesCh
+			require.Equal(t, ice.CandidateTypeHost, candidate.Type())
+			require.Equal(t, serverCfg.ICEPortUDP, candidate.Port())
+		}
+	})
+
+	t.Run("host override - single port", func(t *testing.T) {
+		serverCfg := ServerConfig{
+			ICEPortUDP:          30433,
+			ICEPortTCP:          30433,
+			ICEHostOverride:     "8.8.8.8",
+			ICEHostPortOverride: "8443",
+			UDPSocketsCount:     GetDefaultUDPListeningSocketsCount(),
+		}
+
+		candidatesCh := gatherCandidates(serverCfg, nil)
+
+		require.NotEmpty(t, candidatesCh)
+		for i := 0; i < len(candidatesCh); i++ {
+			candidate := <-candidatesCh
+			require.Equal(t, ice.CandidateTypeHost, candidate.Type())
+
+			if candidate.Address() == serverCfg.ICEHostOverride {
+				require.Equal(t, 8443, candidate.Port())
+			} else {
+				require.Equal(t, serverCfg.ICEPortUDP, candidate.Port())
+			}
+		}
+	})
+
+	t.Run("host override - mapping", func(t *testing.T) {
+		serverCfg := ServerConfig{
+			ICEPortUDP:          30433,
+			ICEPortTCP:          30433,
+			ICEHostOverride:     "8.8.8.8",
+			ICEHostPortOverride: "127.0.0.1/8443",
+			UDPSocketsCount:     GetDefaultUDPListeningSocketsCount(),
+		}
+
+		candidatesCh := gatherCandidates(serverCfg, nil)
+
+		require.NotEmpty(t, candidatesCh)
+		for i := 0; i < len(candidatesCh); i++ {
+			candidate := <-candidatesCh
+			require.Equal(t, ice.CandidateTypeHost, candidate.Type())
+
+			if candidate.Address() == serverCfg.ICEHostOverride {
+				require.Equal(t, 8443, candidate.Port())
+			} else {
+				require.Equal(t, serverCfg.ICEPortUDP, candidate.Port())
+			}
+		}
+	})
+
+	t.Run("host override from STUN", func(t *testing.T) {
+		serverCfg := ServerConfig{
+			ICEPortUDP:          30433,
+			ICEPortTCP:          30433,
+			ICEHostPortOverride: "8443",
+			ICEHostOverride:     "",
+			UDPSocketsCount:     GetDefaultUDPListeningSocketsCount(),
+		}
+
+		publicIP := "8.8.8.8"
+		candidatesCh := gatherCandidates(serverCfg, map[netip.Addr]string{
+			netip.MustParseAddr("127.0.0.1"): publicIP,
+		})
+
+		require.NotEmpty(t, candidatesCh)
+		for i := 0; i < len(candidatesCh); i++ {
+			candidate := <-candidatesCh
+			require.Equal(t, ice.CandidateTypeHost, candidate.Type())
+
+			if candidate.Address() == publicIP {
+				require.Equal(t, 8443, candidate.Port())
+			} else {
+				require.Equal(t, serverCfg.ICEPortUDP, candidate.Port())
+			}
+		}
+	})
+}
+
+func TestIPv6Only(t *testing.T) {
+	// Skipping this test in CI since IPv6 is not yet supported by Github actions.
+	if os.Getenv("CI") != "" {
+		t.Skip()
+	}
+
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	ips, err := getSystemIPs(log, true)
+	require.NoError(t, err)
+	if len(filterIPv6Addrs(ips)) == 0 {
+		t.Skip("no IPv6 address available")
+	}
+
+	metrics := perf.NewMetrics("rtcd", nil)
+	require.NotNil(t, metrics)
+
+	serverCfg := ServerConfig{
+		ICEPortUDP:      30433,
+		ICEPortTCP:      30433,
+		EnableIPv6:      true,
+		IPv6Only:        true,
+		UDPSocketsCount: 1,
+	}
+
+	s, err := NewServer(serverCfg, log, metrics)
+	require.NoError(t, err)
+	require.NotNil(t, s)
+
+	err = s.Start()
+	require.NoError(t, err)
+	defer func() {
+		err := s.Stop()
+		require.NoError(t, err)
+	}()
+
+	for _, ip := range s.localIPs {
+		require.True(t, ip.Is6())
+	}
+
+	cfg := SessionConfig{
+		GroupID:   random.NewID(),
+		CallID:    random.NewID(),
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+	err = s.InitSession(cfg, nil)
+	require.NoError(t, err)
+	defer func() {
+		err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer pc.Close()
+
+	_, err = pc.CreateDataChannel("calls-dc", nil)
+	require.NoError(t, err)
+
+	offer, err := pc.CreateOffer(nil)
+	require.NoError(t, err)
+	err = pc.SetLocalDescription(offer)
+	require.NoError(t, err)
+	offerData, err := json.Marshal(&offer)
+	require.NoError(t, err)
+
+	err = s.Send(Message{
+		GroupID:   cfg.GroupID,
+		CallID:    cfg.CallID,
+		UserID:    cfg.UserID,
+		SessionID: cfg.SessionID,
+		Type:      SDPMessage,
+		Data:      offerData,
+	})
+	require.NoError(t, err)
+
+	var candidates int
+	timeoutCh := time.After(time.Second)
+	for {
+		select {
+		case msg := <-s.ReceiveCh():
+			if msg.Type != ICEMessage {
+				continue
+			}
+
+			data := make(map[string]any)
+			err := json.Unmarshal(msg.Data, &data)
+			require.NoError(t, err)
+
+			candidate, err := ice.UnmarshalCandidate(data["candidate"].(map[string]any)["candidate"].(string))
+			require.NoError(t, err)
+
+			addr, err := netip.ParseAddr(candidate.Address())
+			require.NoError(t, err)
+			require.True(t, addr.Is6(), "unexpected IPv4 candidate %s", candidate.Address())
+			require.True(t, candidate.NetworkType().IsIPv6())
+			candidates++
+		case <-timeoutCh:
+			require.NotZero(t, candidates)
+			return
+		}
+	}
+}
+
+func TestInitSettingEngineICEKeepalive(t *testing.T) {
+	getTimeout := func(sEngine webrtc.SettingEngine, name string) *time.Duration {
+		// The setting engine doesn't expose its timeouts so we need to peek
+		// into the unexported fields.
+		field := reflect.ValueOf(sEngine).FieldByName("timeout").FieldByName(name)
+		if field.IsNil() {
+			return nil
+		}
+		d := time.Duration(field.Elem().Int())
+		return &d
+	}
+
+	t.Run("default", func(t *testing.T) {
+		s := &Server{}
+		sEngine, err := s.initSettingEngine()
+		require.NoError(t, err)
+		require.Nil(t, getTimeout(sEngine, "ICEKeepaliveInterval"))
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		s := &Server{
+			cfg: ServerConfig{
+				ICEKeepaliveIntervalMs: 500,
+			},
+		}
+		sEngine, err := s.initSettingEngine()
+		require.NoError(t, err)
+		require.Equal(t, 500*time.Millisecond, *getTimeout(sEngine, "ICEKeepaliveInterval"))
+		require.Equal(t, iceDisconnectedTimeout, *getTimeout(sEngine, "ICEDisconnectedTimeout"))
+		require.Equal(t, iceFailedTimeout, *getTimeout(sEngine, "ICEFailedTimeout"))
+	})
+}
+
+func TestInitSettingEngineICECredentials(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	getCredentials := func(t *testing.T, s *Server) (string, string) {
+		t.Helper()
+		s.log = log
+		sEngine, err := s.initSettingEngine()
+		require.NoError(t, err)
+
+		pc, err := webrtc.NewAPI(webrtc.WithSettingEngine(sEngine)).NewPeerConnection(webrtc.Configuration{})
+		require.NoError(t, err)
+		defer pc.Close()
+
+		_, err = pc.CreateDataChannel("test", nil)
+		require.NoError(t, err)
+		offer, err := pc.CreateOffer(nil)
+		require.NoError(t, err)
+
+		var ufrag, pwd string
+		for _, line := range strings.Split(offer.SDP, "\r\n") {
+			if v, ok := strings.CutPrefix(line, "a=ice-ufrag:"); ok {
+				ufrag = v
+			} else if v, ok := strings.CutPrefix(line, "a=ice-pwd:"); ok {
+				pwd = v
+			}
+		}
+		require.NotEmpty(t, ufrag)
+		require.NotEmpty(t, pwd)
+
+		return ufrag, pwd
+	}
+
+	t.Run("default", func(t *testing.T) {
+		ufrag, pwd := getCredentials(t, &Server{})
+		require.Len(t, ufrag, iceUfragDefaultLength)
+		require.Len(t, pwd, icePwdDefaultLength)
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		s := &Server{
+			cfg: ServerConfig{
+				ICEUfragLength: 4,
+				ICEPwdLength:   64,
+			},
+		}
+		ufrag, pwd := getCredentials(t, s)
+		require.Len(t, ufrag, 4)
+		require.Len(t, pwd, 64)
+		for _, c := range ufrag + pwd {
+			require.Contains(t, iceCharset, string(c))
+		}
+
+		// Credentials should be unique for each session.
+		ufrag2, pwd2 := getCredentials(t, s)
+		require.NotEqual(t, pwd, pwd2)
+		require.Len(t, ufrag2, 4)
+	})
+
+	t.Run("partially configured", func(t *testing.T) {
+		ufrag, pwd := getCredentials(t, &Server{cfg: ServerConfig{ICEUfragLength: 8}})
+		require.Len(t, ufrag, 8)
+		require.Len(t, pwd, icePwdDefaultLength)
+	})
+}
+
+func TestHandleDCMessageRateLimit(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.MaxDCMessagesPerSecond = 10
+
+	cfg := SessionConfig{
+		GroupID:   random.NewID(),
+		CallID:    random.NewID(),
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+
+	peerConn, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+
+	us, err := s.addSession(cfg, peerConn, nil)
+	require.NoError(t, err)
+	require.NotNil(t, us.dcLimiter)
+	defer func() {
+		close(us.doneCh)
+		err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	metrics := s.metrics.Metrics.(*perf.Metrics)
+	droppedCounter := metrics.RTCDroppedMessages.With(prometheus.Labels{"groupID": cfg.GroupID, "channel": "dc", "reason": "rate_limit"})
+
+	lossRateMsg, err := dc.EncodeMessage(dc.MessageTypeLossRate, 0.1)
+	require.NoError(t, err)
+
+	// Flooding the server.
+	n := 1000
+	for i := 0; i < n; i++ {
+		err := s.handleDCMessage(lossRateMsg, us, nil)
+		require.NoError(t, err)
+	}
+
+	dropped := testutil.ToFloat64(droppedCounter)
+	require.GreaterOrEqual(t, dropped, float64(n-2*s.cfg.MaxDCMessagesPerSecond))
+	require.Less(t, dropped, float64(n))
+
+	// Signaling should still go through while limited.
+	offer, err := peerConn.CreateOffer(nil)
+	require.NoError(t, err)
+	offerData, err := json.Marshal(offer)
+	require.NoError(t, err)
+	sdpMsg, err := dc.EncodeMessage(dc.MessageTypeSDP, offerData)
+	require.NoError(t, err)
+
+	err = s.handleDCMessage(sdpMsg, us, nil)
+	require.NoError(t, err)
+	require.Len(t, us.sdpOfferInCh, 1)
+	require.Equal(t, dropped, testutil.ToFloat64(droppedCounter))
+
+	// So should keepalives and control messages.
+	pongMsg, err := dc.EncodeMessage(dc.MessageTypePong, nil)
+	require.NoError(t, err)
+	levelMsg, err := dc.EncodeMessage(dc.MessageTypePreferredSimulcastLevel, SimulcastLevelLow)
+	require.NoError(t, err)
+	for _, msg := range [][]byte{pongMsg, levelMsg} {
+		err = s.handleDCMessage(msg, us, nil)
+		require.NoError(t, err)
+	}
+	require.Equal(t, dropped, testutil.ToFloat64(droppedCounter))
+	us.mut.RLock()
+	require.Equal(t, SimulcastLevelLow, us.preferredSimulcastLevel)
+	us.mut.RUnlock()
+}
+
+func TestMetricsSampling(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.MaxDCMessagesPerSecond = 1
+	s.cfg.MetricsSampleRate = 0.5
+
+	metrics := s.metrics.Metrics.(*perf.Metrics)
+
+	addSession := func(t *testing.T, cfg SessionConfig) *session {
+		t.Helper()
+		peerConn, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+		require.NoError(t, err)
+		us, err := s.addSession(cfg, peerConn, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			close(us.doneCh)
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		})
+		return us
+	}
+
+	lossRateMsg, err := dc.EncodeMessage(dc.MessageTypeLossRate, 0.1)
+	require.NoError(t, err)
+
+	t.Run("not sampled", func(t *testing.T) {
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		us := addSession(t, cfg)
+		us.metricsSampled = false
+
+		for i := 0; i < 2; i++ {
+			err := s.handleDCMessage(lossRateMsg, us, nil)
+			require.NoError(t, err)
+		}
+
+		// Fine-grained metrics should not be emitted.
+		require.Zero(t, testutil.CollectAndCount(metrics.RTCClientLoss))
+
+		// Coarse counters should always be emitted.
+		droppedCounter := metrics.RTCDroppedMessages.With(prometheus.Labels{"groupID": cfg.GroupID, "channel": "dc", "reason": "rate_limit"})
+		require.Equal(t, float64(1), testutil.ToFloat64(droppedCounter))
+	})
+
+	t.Run("sampled", func(t *testing.T) {
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		us := addSession(t, cfg)
+		us.metricsSampled = true
+
+		err := s.handleDCMessage(lossRateMsg, us, nil)
+		require.NoError(t, err)
+
+		require.Equal(t, 1, testutil.CollectAndCount(metrics.RTCClientLoss))
+	})
+}
+
+func TestTrackResubscribe(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.SignalingTimeoutMs = 1000
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+	senderCfg := SessionConfig{
+		GroupID:   groupID,
+		CallID:    callID,
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+	receiverCfg := SessionConfig{
+		GroupID:   groupID,
+		CallID:    callID,
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+
+	var mut sync.Mutex
+	pcs := make(map[string]*webrtc.PeerConnection)
+	offerCh := make(chan webrtc.SessionDescription, 10)
+	go func() {
+		for msg := range s.ReceiveCh() {
+			if msg.Type != SDPMessage {
+				continue
+			}
+			var sdp webrtc.SessionDescription
+			err := json.Unmarshal(msg.Data, &sdp)
+			require.NoError(t, err)
+			if sdp.Type == webrtc.SDPTypeOffer {
+				offerCh <- sdp
+				continue
+			}
+			mut.Lock()
+			err = pcs[msg.SessionID].SetRemoteDescription(sdp)
+			mut.Unlock()
+			require.NoError(t, err)
+		}
+	}()
+
+	sendSDP := func(cfg SessionConfig, sdp webrtc.SessionDescription) {
+		t.Helper()
+		data, err := json.Marshal(sdp)
+		require.NoError(t, err)
+		err = s.Send(Message{
+			GroupID:   cfg.GroupID,
+			CallID:    cfg.CallID,
+			UserID:    cfg.UserID,
+			SessionID: cfg.SessionID,
+			Type:      SDPMessage,
+			Data:      data,
+		})
+		require.NoError(t, err)
+	}
+
+	// initSession initializes a session and completes its initial
+	// negotiation.
+	initSession := func(cfg SessionConfig) *webrtc.PeerConnection {
+		t.Helper()
+		pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+		require.NoError(t, err)
+		_, err = pc.CreateDataChannel("calls-dc", nil)
+		require.NoError(t, err)
+		offer, err := pc.CreateOffer(nil)
+		require.NoError(t, err)
+		err = pc.SetLocalDescription(offer)
+		require.NoError(t, err)
+		mut.Lock()
+		pcs[cfg.SessionID] = pc
+		mut.Unlock()
+
+		err = s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		sendSDP(cfg, offer)
+
+		require.Eventually(t, func() bool {
+			return pc.SignalingState() == webrtc.SignalingStateStable
+		}, 4*time.Second, 20*time.Millisecond)
+
+		return pc
+	}
+
+	senderPC := initSession(senderCfg)
+	defer senderPC.Close()
+	defer func() {
+		err := s.CloseSession(senderCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	ss := s.getGroup(groupID).getCall(callID).getSession(senderCfg.SessionID)
+	require.NotNil(t, ss)
+	track, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, genTrackID(trackTypeVoice, senderCfg.SessionID, 0), random.NewID())
+	require.NoError(t, err)
+	ss.mut.Lock()
+	ss.outVoiceTrack = track
+	ss.mut.Unlock()
+
+	receiverPC := initSession(receiverCfg)
+	defer receiverPC.Close()
+	defer func() {
+		err := s.CloseSession(receiverCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	us := s.getGroup(groupID).getCall(callID).getSession(receiverCfg.SessionID)
+	require.NotNil(t, us)
+
+	resubscribe := func(tt trackType) {
+		t.Helper()
+		msg, err := dc.EncodeMessage(dc.MessageTypeTrackResubscribe, dc.MessageTrackResubscribe{
+			SessionID: senderCfg.SessionID,
+			TrackType: string(tt),
+		})
+		require.NoError(t, err)
+		err = s.handleDCMessage(msg, us, nil)
+		require.NoError(t, err)
+	}
+
+	hasTrack := func() bool {
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		return us.rxTracks[track.ID()] != nil
+	}
+
+	// The offer adding the track gets dropped.
+	select {
+	case offer := <-offerCh:
+		require.Contains(t, offer.SDP, track.ID())
+	case <-time.After(4 * time.Second):
+		require.FailNow(t, "timed out waiting for offer")
+	}
+
+	// Resubscribing while negotiation is in progress is a no-op.
+	resubscribe(trackTypeVoice)
+	require.Empty(t, us.tracksCh)
+
+	// Wait for the negotiation to time out.
+	require.Eventually(t, func() bool {
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		return !us.makingOffer
+	}, 4*time.Second, 50*time.Millisecond)
+	require.False(t, hasTrack())
+
+	// The sender is removed as well.
+	for _, sender := range us.rtcConn.GetSenders() {
+		require.False(t, sender.Track() == webrtc.TrackLocal(track))
+	}
+
+	resubscribe(trackTypeVoice)
+
+	// The unanswered offer is sent again first, followed by the one adding
+	// the track back.
+	for i := 0; i < 2; i++ {
+		var offer webrtc.SessionDescription
+		select {
+		case offer = <-offerCh:
+		case <-time.After(4 * time.Second):
+			require.FailNow(t, "timed out waiting for offer")
+		}
+		require.Contains(t, offer.SDP, track.ID())
+
+		err = receiverPC.SetRemoteDescription(offer)
+		require.NoError(t, err)
+		answer, err := receiverPC.CreateAnswer(nil)
+		require.NoError(t, err)
+		err = receiverPC.SetLocalDescription(answer)
+		require.NoError(t, err)
+		sendSDP(receiverCfg, answer)
+	}
+
+	require.Eventually(t, hasTrack, 4*time.Second, 50*time.Millisecond)
+
+	// Resubscribing to a received track is a no-op.
+	resubscribe(trackTypeVoice)
+	require.Empty(t, us.tracksCh)
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for _, msg := range []dc.MessageTrackResubscribe{
+			{SessionID: senderCfg.SessionID, TrackType: "invalid"},
+			{SessionID: receiverCfg.SessionID, TrackType: string(trackTypeVoice)},
+			{SessionID: random.NewID(), TrackType: string(trackTypeVoice)},
+			{SessionID: senderCfg.SessionID, TrackType: string(trackTypeScreen)},
+		} {
+			data, err := dc.EncodeMessage(dc.MessageTypeTrackResubscribe, msg)
+			require.NoError(t, err)
+			err = s.handleDCMessage(data, us, nil)
+			require.Error(t, err)
+		}
+	})
+
+	t.Run("screen track", func(t *testing.T) {
+		levels := []string{SimulcastLevelLow, SimulcastLevelHigh}
+		levelTracks := make(map[string]*webrtc.TrackLocalStaticRTP)
+		ss.mut.Lock()
+		for _, level := range levels {
+			screenTrack, err := webrtc.NewTrackLocalStaticRTP(rtpVideoCodecs[ScreenTrackMimeTypeDefault].RTPCodecCapability,
+				genTrackID(trackTypeScreen, senderCfg.SessionID, 0), random.NewID())
+			require.NoError(t, err)
+			levelTracks[level] = screenTrack
+			ss.outScreenTracks[getTrackIndex(ScreenTrackMimeTypeDefault, level)] = []*webrtc.TrackLocalStaticRTP{screenTrack}
+		}
+		ss.mut.Unlock()
+
+		// The track at the level the receiver is expected to get is the one
+		// being added back.
+		expectedTrack := levelTracks[fitSimulcastLevel(levels, us.getExpectedSimulcastLevel(senderCfg.SessionID))]
+		resubscribe(trackTypeScreen)
+
+		var offer webrtc.SessionDescription
+		select {
+		case offer = <-offerCh:
+		case <-time.After(4 * time.Second):
+			require.FailNow(t, "timed out waiting for offer")
+		}
+		require.Contains(t, offer.SDP, expectedTrack.ID())
+
+		err = receiverPC.SetRemoteDescription(offer)
+		require.NoError(t, err)
+		answer, err := receiverPC.CreateAnswer(nil)
+		require.NoError(t, err)
+		err = receiverPC.SetLocalDescription(answer)
+		require.NoError(t, err)
+		sendSDP(receiverCfg, answer)
+
+		require.Eventually(t, func() bool {
+			us.mut.RLock()
+			defer us.mut.RUnlock()
+			return us.screenTrackSender != nil
+		}, 4*time.Second, 50*time.Millisecond)
+
+		// Resubscribing while receiving a screen track is a no-op.
+		resubscribe(trackTypeScreen)
+		require.Empty(t, us.tracksCh)
+	})
+}
+
+func TestLateSDPAnswer(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.SignalingTimeoutMs = 1000
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	cfg := SessionConfig{
+		GroupID:   random.NewID(),
+		CallID:    random.NewID(),
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer pc.Close()
+
+	offerCh := make(chan sdpMessage, 10)
+	go func() {
+		for msg := range s.ReceiveCh() {
+			if msg.Type != SDPMessage {
+				continue
+			}
+			var sdp sdpMessage
+			err := json.Unmarshal(msg.Data, &sdp)
+			require.NoError(t, err)
+			if sdp.Type == webrtc.SDPTypeOffer {
+				offerCh <- sdp
+				continue
+			}
+			err = pc.SetRemoteDescription(sdp.SessionDescription)
+			require.NoError(t, err)
+		}
+	}()
+
+	sendSDP := func(sdp sdpMessage) {
+		t.Helper()
+		data, err := json.Marshal(sdp)
+		require.NoError(t, err)
+		err = s.Send(Message{
+			GroupID:   cfg.GroupID,
+			CallID:    cfg.CallID,
+			UserID:    cfg.UserID,
+			SessionID: cfg.SessionID,
+			Type:      SDPMessage,
+			Data:      data,
+		})
+		require.NoError(t, err)
+	}
+
+	receiveOffer := func() sdpMessage {
+		t.Helper()
+		select {
+		case offer := <-offerCh:
+			return offer
+		case <-time.After(4 * time.Second):
+			require.FailNow(t, "timed out waiting for offer")
+		}
+		return sdpMessage{}
+	}
+
+	answerOffer := func(offer sdpMessage) sdpMessage {
+		t.Helper()
+		err := pc.SetRemoteDescription(offer.SessionDescription)
+		require.NoError(t, err)
+		answer, err := pc.CreateAnswer(nil)
+		require.NoError(t, err)
+		err = pc.SetLocalDescription(answer)
+		require.NoError(t, err)
+		return sdpMessage{SessionDescription: answer, OfferSeq: offer.OfferSeq}
+	}
+
+	_, err = pc.CreateDataChannel("calls-dc", nil)
+	require.NoError(t, err)
+	offer, err := pc.CreateOffer(nil)
+	require.NoError(t, err)
+	err = pc.SetLocalDescription(offer)
+	require.NoError(t, err)
+	err = s.InitSession(cfg, nil)
+	require.NoError(t, err)
+	defer func() {
+		err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+	sendSDP(sdpMessage{SessionDescription: offer})
+	require.Eventually(t, func() bool {
+		return pc.SignalingState() == webrtc.SignalingStateStable
+	}, 4*time.Second, 20*time.Millisecond)
+
+	us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+	require.NotNil(t, us)
+
+	isNegotiating := func() bool {
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		return us.makingOffer
+	}
+
+	hasTrack := func(track webrtc.TrackLocal) bool {
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		return us.rxTracks[track.ID()] != nil
+	}
+
+	newTrack := func() webrtc.TrackLocal {
+		t.Helper()
+		track, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, genTrackID(trackTypeVoice, random.NewID(), 0), random.NewID())
+		require.NoError(t, err)
+		return track
+	}
+
+	trackA := newTrack()
+	us.tracksCh <- trackActionContext{action: trackActionAdd, track: trackA}
+	offerA := receiveOffer()
+	require.Equal(t, uint64(1), offerA.OfferSeq)
+	require.Contains(t, offerA.SDP, trackA.ID())
+
+	// The offer is left unanswered until the negotiation times out.
+	require.Eventually(t, isNegotiating, 4*time.Second, 20*time.Millisecond)
+	require.Eventually(t, func() bool { return !isNegotiating() }, 4*time.Second, 20*time.Millisecond)
+	require.False(t, hasTrack(trackA))
+
+	// The answer finally arrives, while no negotiation is in progress.
+	sendSDP(answerOffer(offerA))
+
+	// Adding a new track completes the pending offer first, for which the late
+	// answer is valid.
+	trackB := newTrack()
+	us.tracksCh <- trackActionContext{action: trackActionAdd, track: trackB}
+	resentOfferA := receiveOffer()
+	require.Equal(t, offerA.OfferSeq, resentOfferA.OfferSeq)
+	require.Equal(t, offerA.SDP, resentOfferA.SDP)
+
+	offerB := receiveOffer()
+	require.Equal(t, uint64(2), offerB.OfferSeq)
+	require.Contains(t, offerB.SDP, trackB.ID())
+
+	// The client answering the resent offer as well. This answer is stale and
+	// should not be applied to the newer offer.
+	staleAnswer := answerOffer(resentOfferA)
+	sendSDP(staleAnswer)
+	answerB := answerOffer(offerB)
+	sendSDP(answerB)
+
+	require.Eventually(t, func() bool {
+		return hasTrack(trackB) && !isNegotiating()
+	}, 4*time.Second, 20*time.Millisecond)
+	require.Equal(t, webrtc.SignalingStateStable, us.rtcConn.SignalingState())
+	require.Equal(t, answerB.SDP, us.rtcConn.RemoteDescription().SDP)
+	require.Equal(t, webrtc.SignalingStateStable, pc.SignalingState())
+	require.Empty(t, us.sdpAnswerInCh)
+
+	t.Run("answers without sequence number", func(t *testing.T) {
+		// Queued answers are discarded before a new offer is sent.
+		staleAnswer.OfferSeq = 0
+		sendSDP(staleAnswer)
+		require.Eventually(t, func() bool {
+			return len(us.sdpAnswerInCh) == 1
+		}, time.Second, 10*time.Millisecond)
+
+		trackC := newTrack()
+		us.tracksCh <- trackActionContext{action: trackActionAdd, track: trackC}
+		offerC := receiveOffer()
+		require.Equal(t, uint64(3), offerC.OfferSeq)
+		answer := answerOffer(offerC)
+		answer.OfferSeq = 0
+		sendSDP(answer)
+
+		require.Eventually(t, func() bool {
+			return hasTrack(trackC) && !isNegotiating()
+		}, 4*time.Second, 20*time.Millisecond)
+		require.Equal(t, webrtc.SignalingStateStable, us.rtcConn.SignalingState())
+		require.Equal(t, answer.SDP, us.rtcConn.RemoteDescription().SDP)
+	})
+}
+
+// setupTestPeers acts as the clients for the sessions initialized through the
+// returned function: offers from the server are answered and ICE candidates
+// are exchanged so that media can flow.
+func setupTestPeers(t *testing.T, s *Server) func(cfg SessionConfig, tracks ...webrtc.TrackLocal) *webrtc.PeerConnection {
+	t.Helper()
+
+	sendMsg := func(cfg SessionConfig, msgType MessageType, data []byte) {
+		t.Helper()
+		err := s.Send(Message{
+			GroupID:   cfg.GroupID,
+			CallID:    cfg.CallID,
+			UserID:    cfg.UserID,
+			SessionID: cfg.SessionID,
+			Type:      msgType,
+			Data:      data,
+		})
+		require.NoError(t, err)
+	}
+
+	var mut sync.Mutex
+	pcs := make(map[string]*webrtc.PeerConnection)
+	getPC := func(sessionID string) *webrtc.PeerConnection {
+		mut.Lock()
+		defer mut.Unlock()
+		return pcs[sessionID]
+	}
+	cfgs := make(map[string]SessionConfig)
+
+	// Acting as the clients: answering offers and trickling candidates.
+	go func() {
+		for msg := range s.ReceiveCh() {
+			pc := getPC(msg.SessionID)
+			if pc == nil {
+				continue
+			}
+
+			switch msg.Type {
+			case ICEMessage:
+				data := make(map[string]any)
+				err := json.Unmarshal(msg.Data, &data)
+				require.NoError(t, err)
+				candidate := data["candidate"].(map[string]any)["candidate"].(string)
+				go func() {
+					// Candidates can only be added after the remote description is set.
+					for pc.RemoteDescription() == nil {
+						time.Sleep(10 * time.Millisecond)
+					}
+					_ = pc.AddICECandidate(webrtc.ICECandidateInit{Candidate: candidate})
+				}()
+			case SDPMessage:
+				var sdp webrtc.SessionDescription
+				err := json.Unmarshal(msg.Data, &sdp)
+				require.NoError(t, err)
+				err = pc.SetRemoteDescription(sdp)
+				require.NoError(t, err)
+				if sdp.Type != webrtc.SDPTypeOffer {
+					continue
+				}
+				answer, err := pc.CreateAnswer(nil)
+				require.NoError(t, err)
+				err = pc.SetLocalDescription(answer)
+				require.NoError(t, err)
+				data, err := json.Marshal(answer)
+				require.NoError(t, err)
+				mut.Lock()
+				cfg := cfgs[msg.SessionID]
+				mut.Unlock()
+				sendMsg(cfg, SDPMessage, data)
+			}
+		}
+	}()
+
+	return func(cfg SessionConfig, tracks ...webrtc.TrackLocal) *webrtc.PeerConnection {
+		t.Helper()
+		pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+		require.NoError(t, err)
+		pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+			if candidate == nil {
+				return
+			}
+			data, err := json.Marshal(candidate.ToJSON())
+			require.NoError(t, err)
+			sendMsg(cfg, ICEMessage, data)
+		})
+		_, err = pc.CreateDataChannel("calls-dc", nil)
+		require.NoError(t, err)
+		for _, track := range tracks {
+			_, err := pc.AddTrack(track)
+			require.NoError(t, err)
+		}
+		offer, err := pc.CreateOffer(nil)
+		require.NoError(t, err)
+		err = pc.SetLocalDescription(offer)
+		require.NoError(t, err)
+		mut.Lock()
+		pcs[cfg.SessionID] = pc
+		cfgs[cfg.SessionID] = cfg
+		mut.Unlock()
+
+		err = s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		data, err := json.Marshal(offer)
+		require.NoError(t, err)
+		sendMsg(cfg, SDPMessage, data)
+
+		return pc
+	}
+}
+
+func TestStopReceiving(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+	senderCfg := SessionConfig{
+		GroupID:   groupID,
+		CallID:    callID,
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+	receiverCfg := SessionConfig{
+		GroupID:   groupID,
+		CallID:    callID,
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+
+	initSession := setupTestPeers(t, s)
+
+	var received atomic.Int64
+	receiverPC := initSession(receiverCfg)
+	defer receiverPC.Close()
+	defer func() {
+		err := s.CloseSession(receiverCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+	receiverPC.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		for {
+			if _, _, err := track.ReadRTP(); err != nil {
+				return
+			}
+			received.Add(1)
+		}
+	})
+
+	voiceTrack, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, "voice", random.NewID())
+	require.NoError(t, err)
+	senderPC := initSession(senderCfg, voiceTrack)
+	defer senderPC.Close()
+	defer func() {
+		err := s.CloseSession(senderCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		var seq uint16
+		for {
+			select {
+			case <-ticker.C:
+				seq++
+				_ = voiceTrack.WriteRTP(&rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						SequenceNumber: seq,
+						Timestamp:      uint32(seq) * 960,
+					},
+					Payload: []byte{0xf8, 0xff, 0xfe},
+				})
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	// Packets from the sender should be flowing.
+	require.Eventually(t, func() bool {
+		return received.Load() > 0
+	}, 10*time.Second, 50*time.Millisecond)
+
+	us := s.getGroup(groupID).getCall(callID).getSession(receiverCfg.SessionID)
+	require.NotNil(t, us)
+
+	rxTracksCount := func() int {
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		return len(us.rxTracks)
+	}
+	require.Equal(t, 1, rxTracksCount())
+
+	msg, err := dc.EncodeMessage(dc.MessageTypeStopReceiving, senderCfg.SessionID)
+	require.NoError(t, err)
+	err = s.handleDCMessage(msg, us, nil)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return rxTracksCount() == 0
+	}, 4*time.Second, 50*time.Millisecond)
+
+	// No further packets should arrive from the stopped source.
+	time.Sleep(200 * time.Millisecond)
+	count := received.Load()
+	time.Sleep(time.Second)
+	require.Equal(t, count, received.Load())
+
+	// Tracks from the stopped source should not be added back.
+	err = s.handleTrackResubscribe(us, senderCfg.SessionID, trackTypeVoice)
+	require.NoError(t, err)
+	require.Never(t, func() bool {
+		return rxTracksCount() > 0
+	}, time.Second, 50*time.Millisecond)
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for _, sessionID := range []string{"", receiverCfg.SessionID} {
+			msg, err := dc.EncodeMessage(dc.MessageTypeStopReceiving, sessionID)
+			require.NoError(t, err)
+			err = s.handleDCMessage(msg, us, nil)
+			require.Error(t, err)
+		}
+	})
+}
+
+func TestMaxTracksPerSession(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	initSession := setupTestPeers(t, s)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+	newSessionCfg := func() SessionConfig {
+		return SessionConfig{
+			GroupID:   groupID,
+			CallID:    callID,
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+	}
+
+	getSession := func(cfg SessionConfig) *session {
+		t.Helper()
+		us := s.getGroup(groupID).getCall(callID).getSession(cfg.SessionID)
+		require.NotNil(t, us)
+		return us
+	}
+
+	rxTracksCount := func(us *session) int {
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		return len(us.rxTracks)
+	}
+
+	// Two senders with their voice tracks already set.
+	for i := 0; i < 2; i++ {
+		cfg := newSessionCfg()
+		pc := initSession(cfg)
+		defer pc.Close()
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		track, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, genTrackID(trackTypeVoice, cfg.SessionID, 0), random.NewID())
+		require.NoError(t, err)
+		ss := getSession(cfg)
+		ss.mut.Lock()
+		ss.outVoiceTrack = track
+		ss.mut.Unlock()
+	}
+
+	// The first receiver is capped at a single track, the second one has no
+	// limit.
+	receivers := make([]*session, 2)
+	for i, maxTracks := range []int{1, 0} {
+		s.cfg.MaxTracksPerSession = maxTracks
+		cfg := newSessionCfg()
+		pc := initSession(cfg)
+		defer pc.Close()
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+		receivers[i] = getSession(cfg)
+		require.Equal(t, maxTracks, receivers[i].maxTracks)
+	}
+
+	// The uncapped receiver should get both tracks.
+	require.Eventually(t, func() bool {
+		return rxTracksCount(receivers[1]) == 2
+	}, 4*time.Second, 50*time.Millisecond)
+
+	// The capped receiver should stop accepting tracks after the first one.
+	require.Eventually(t, func() bool {
+		receivers[0].mut.RLock()
+		defer receivers[0].mut.RUnlock()
+		return len(receivers[0].tracksCh) == 0 && !receivers[0].makingOffer
+	}, 4*time.Second, 50*time.Millisecond)
+	require.Never(t, func() bool {
+		return rxTracksCount(receivers[0]) > 1
+	}, time.Second, 50*time.Millisecond)
+	require.Equal(t, 1, rxTracksCount(receivers[0]))
+
+	metrics := s.metrics.Metrics.(*perf.Metrics)
+	require.Equal(t, float64(1), testutil.ToFloat64(metrics.RTCErrors.With(prometheus.Labels{"groupID": groupID, "type": "track_limit"})))
+}
+
+func TestE2EEPassthrough(t *testing.T) {
+	for _, e2ee := range []bool{false, true} {
+		t.Run(fmt.Sprintf("e2ee=%t", e2ee), func(t *testing.T) {
+			s, shutdown := setupServer(t)
+			defer shutdown()
+
+			s.cfg.AllowE2EE = true
+			err := s.Start()
+			require.NoError(t, err)
+
+			groupID := random.NewID()
+			callID := random.NewID()
+			senderCfg := SessionConfig{
+				GroupID:   groupID,
+				CallID:    callID,
+				UserID:    random.NewID(),
+				SessionID: random.NewID(),
+				Props: SessionProps{
+					"e2ee": e2ee,
+				},
+			}
+			receiverCfg := SessionConfig{
+				GroupID:   groupID,
+				CallID:    callID,
+				UserID:    random.NewID(),
+				SessionID: random.NewID(),
+			}
+
+			initSession := setupTestPeers(t, s)
+
+			// Payloads are keyed by sequence number so that the receiving end
+			// can verify they were forwarded untouched.
+			var payloads sync.Map
+			var received atomic.Int64
+			receiverPC := initSession(receiverCfg)
+			defer receiverPC.Close()
+			defer func() {
+				err := s.CloseSession(receiverCfg.SessionID, CloseReasonLeft)
+				require.NoError(t, err)
+			}()
+			receiverPC.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+				for {
+					pkt, _, err := track.ReadRTP()
+					if err != nil {
+						return
+					}
+					sent, ok := payloads.Load(pkt.SequenceNumber)
+					if !ok || !reflect.DeepEqual(sent, pkt.Payload) {
+						continue
+					}
+					received.Add(1)
+				}
+			})
+
+			err = s.StartCallAudioMixer(groupID, callID, newTestAudioMixerConfig(&testAudioSink{}))
+			require.NoError(t, err)
+			var decoders atomic.Int64
+			mixer := s.getGroup(groupID).getCall(callID).audioMixer.Load()
+			mixer.mut.Lock()
+			newDecoder := mixer.cfg.NewDecoder
+			mixer.cfg.NewDecoder = func() (AudioDecoder, error) {
+				decoders.Add(1)
+				return newDecoder()
+			}
+			mixer.mut.Unlock()
 
-			candidate, err := ice.UnmarshalCandidate(iceString)
+			voiceTrack, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, "voice", random.NewID())
 			require.NoError(t, err)
+			senderPC := initSession(senderCfg, voiceTrack)
+			defer senderPC.Close()
+			defer func() {
+				err := s.CloseSession(senderCfg.SessionID, CloseReasonLeft)
+				require.NoError(t, err)
+			}()
+
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			go func() {
+				ticker := time.NewTicker(20 * time.Millisecond)
+				defer ticker.Stop()
+				var seq uint16
+				for {
+					select {
+					case <-ticker.C:
+						seq++
+						// Random bytes standing in for an encrypted frame.
+						payload := []byte(random.NewID())
+						payloads.Store(seq, payload)
+						_ = voiceTrack.WriteRTP(&rtp.Packet{
+							Header: rtp.Header{
+								Version:        2,
+								SequenceNumber: seq,
+								Timestamp:      uint32(seq) * 960,
+							},
+							Payload: payload,
+						})
+					case <-stopCh:
+						return
+					}
+				}
+			}()
 
-			require.Equal(t, ice.CandidateTypeHost, candidate.Type())
-			require.Equal(t, serverCfg.ICEPortTCP, candidate.Port())
+			require.Eventually(t, func() bool {
+				return received.Load() > 10
+			}, 10*time.Second, 50*time.Millisecond)
 
-			if candidate.NetworkType() == ice.NetworkTypeTCP4 {
-				break
+			// Encrypted payloads should never make it to the mixer.
+			if e2ee {
+				require.Zero(t, decoders.Load())
+			} else {
+				require.Eventually(t, func() bool {
+					return decoders.Load() > 0
+				}, time.Second, 10*time.Millisecond)
 			}
-		}
+		})
 	}
-
-	err = s.CloseSession(cfg.SessionID)
-	require.NoError(t, err)
 }
 
-func TestICEHostPortOverride(t *testing.T) {
-	log, err := logger.New(logger.Config{
-		EnableConsole: true,
-		ConsoleLevel:  "DEBUG",
-	})
-	require.NoError(t, err)
-	defer func() {
-		err := log.Shutdown()
-		require.NoError(t, err)
-	}()
-
-	metrics := perf.NewMetrics("rtcd", nil)
-	require.NotNil(t, metrics)
-
-	gatherCandidates := func(serverCfg ServerConfig, publicAddrsMap map[netip.Addr]string) <-chan ice.Candidate {
-		s, err := NewServer(serverCfg, log, metrics)
-		require.NoError(t, err)
-		require.NotNil(t, s)
-
-		if publicAddrsMap != nil {
-			s.publicAddrsMap = publicAddrsMap
-		}
+func TestInitSessionAllowE2EE(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
 
-		err = s.Start()
-		require.NoError(t, err)
-		defer func() {
-			err := s.Stop()
-			require.NoError(t, err)
-		}()
+	err := s.Start()
+	require.NoError(t, err)
 
-		cfg := SessionConfig{
+	newCfg := func() SessionConfig {
+		return SessionConfig{
 			GroupID:   random.NewID(),
 			CallID:    random.NewID(),
 			UserID:    random.NewID(),
 			SessionID: random.NewID(),
+			Props:     SessionProps{"e2ee": true},
 		}
-		err = s.InitSession(cfg, nil)
-		require.NoError(t, err)
+	}
 
-		pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
-		require.NoError(t, err)
-		defer pc.Close()
+	t.Run("not allowed", func(t *testing.T) {
+		err := s.InitSession(newCfg(), nil)
+		require.ErrorIs(t, err, ErrE2EENotAllowed)
+	})
 
-		dc, err := pc.CreateDataChannel("calls-dc", nil)
-		require.NoError(t, err)
-		require.NotNil(t, dc)
+	t.Run("allowed", func(t *testing.T) {
+		s.cfg.AllowE2EE = true
+		defer func() { s.cfg.AllowE2EE = false }()
 
-		offer, err := pc.CreateOffer(nil)
+		cfg := newCfg()
+		err := s.InitSession(cfg, nil)
 		require.NoError(t, err)
 
-		err = pc.SetLocalDescription(offer)
+		err = s.CloseSession(cfg.SessionID, CloseReasonLeft)
 		require.NoError(t, err)
+	})
+}
 
-		offerData, err := json.Marshal(&offer)
-		require.NoError(t, err)
+func TestDCSignalingFallback(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
 
-		err = s.Send(Message{
+	s.cfg.SignalingTimeoutMs = 1000
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	sendMsg := func(cfg SessionConfig, msgType MessageType, data []byte) {
+		t.Helper()
+		err := s.Send(Message{
 			GroupID:   cfg.GroupID,
 			CallID:    cfg.CallID,
 			UserID:    cfg.UserID,
 			SessionID: cfg.SessionID,
-			Type:      SDPMessage,
-			Data:      offerData,
+			Type:      msgType,
+			Data:      data,
 		})
 		require.NoError(t, err)
+	}
 
-		candidatesCh := make(chan ice.Candidate, 10)
-		go func() {
-			for msg := range s.ReceiveCh() {
-				if msg.Type == ICEMessage {
-					data := make(map[string]any)
-					err := json.Unmarshal(msg.Data, &data)
-					require.NoError(t, err)
+	answer := func(pc *webrtc.PeerConnection, offer sdpMessage) []byte {
+		t.Helper()
+		err := pc.SetRemoteDescription(offer.SessionDescription)
+		require.NoError(t, err)
+		answer, err := pc.CreateAnswer(nil)
+		require.NoError(t, err)
+		err = pc.SetLocalDescription(answer)
+		require.NoError(t, err)
+		data, err := json.Marshal(sdpMessage{SessionDescription: answer, OfferSeq: offer.OfferSeq})
+		require.NoError(t, err)
+		return data
+	}
 
-					iceString := data["candidate"].(map[string]interface{})["candidate"].(string)
+	var mut sync.Mutex
+	pcs := make(map[string]*webrtc.PeerConnection)
+	cfgs := make(map[string]SessionConfig)
+	var wsOffers atomic.Int64
 
-					candidate, err := ice.UnmarshalCandidate(iceString)
-					require.NoError(t, err)
+	// Acting as the clients on the WebSocket side: answering offers and
+	// trickling candidates.
+	go func() {
+		for msg := range s.ReceiveCh() {
+			mut.Lock()
+			pc := pcs[msg.SessionID]
+			cfg := cfgs[msg.SessionID]
+			mut.Unlock()
+			if pc == nil {
+				continue
+			}
 
-					candidatesCh <- candidate
+			switch msg.Type {
+			case ICEMessage:
+				data := make(map[string]any)
+				err := json.Unmarshal(msg.Data, &data)
+				require.NoError(t, err)
+				candidate := data["candidate"].(map[string]any)["candidate"].(string)
+				go func() {
+					for pc.RemoteDescription() == nil {
+						time.Sleep(10 * time.Millisecond)
+					}
+					_ = pc.AddICECandidate(webrtc.ICECandidateInit{Candidate: candidate})
+				}()
+			case SDPMessage:
+				var sdp sdpMessage
+				err := json.Unmarshal(msg.Data, &sdp)
+				require.NoError(t, err)
+				if sdp.Type != webrtc.SDPTypeOffer {
+					err = pc.SetRemoteDescription(sdp.SessionDescription)
+					require.NoError(t, err)
+					continue
 				}
+				wsOffers.Add(1)
+				sendMsg(cfg, SDPMessage, answer(pc, sdp))
 			}
-		}()
+		}
+	}()
 
-		time.Sleep(time.Second)
+	// initSession connects a client with DC signaling enabled. Offers
+	// received through the data channel are answered only if answerDC is set.
+	// If withDC is false the client never creates the data channel.
+	initSession := func(cfg SessionConfig, withDC bool, answerDC *atomic.Bool, dcOffers *atomic.Int64) (*webrtc.PeerConnection, *webrtc.DataChannel) {
+		t.Helper()
+
+		cfg.Props = SessionProps{"dcSignaling": true}
 
-		err = s.CloseSession(cfg.SessionID)
+		pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
 		require.NoError(t, err)
+		pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+			if candidate == nil {
+				return
+			}
+			data, err := json.Marshal(candidate.ToJSON())
+			require.NoError(t, err)
+			sendMsg(cfg, ICEMessage, data)
+		})
 
-		return candidatesCh
-	}
+		var dataCh *webrtc.DataChannel
+		dcOpenCh := make(chan struct{})
+		if withDC {
+			dataCh, err = pc.CreateDataChannel("calls-dc", nil)
+			require.NoError(t, err)
+			dataCh.OnMessage(func(msg webrtc.DataChannelMessage) {
+				mt, payload, err := dc.DecodeMessage(msg.Data)
+				require.NoError(t, err)
+				if mt != dc.MessageTypeSDP {
+					return
+				}
+				var sdp sdpMessage
+				err = json.Unmarshal(payload.([]byte), &sdp)
+				require.NoError(t, err)
+				if sdp.Type != webrtc.SDPTypeOffer {
+					return
+				}
+				dcOffers.Add(1)
+				if !answerDC.Load() {
+					return
+				}
+				data, err := dc.EncodeMessage(dc.MessageTypeSDP, answer(pc, sdp))
+				require.NoError(t, err)
+				err = dataCh.Send(data)
+				require.NoError(t, err)
+			})
+			dataCh.OnOpen(func() {
+				close(dcOpenCh)
+			})
+		} else {
+			// The offer needs at least one media section.
+			_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{
+				Direction: webrtc.RTPTransceiverDirectionRecvonly,
+			})
+			require.NoError(t, err)
+		}
 
-	t.Run("no host override", func(t *testing.T) {
-		serverCfg := ServerConfig{
-			ICEPortUDP:          30433,
-			ICEPortTCP:          30433,
-			ICEHostPortOverride: "8443",
-			UDPSocketsCount:     GetDefaultUDPListeningSocketsCount(),
+		offer, err := pc.CreateOffer(nil)
+		require.NoError(t, err)
+		err = pc.SetLocalDescription(offer)
+		require.NoError(t, err)
+
+		mut.Lock()
+		pcs[cfg.SessionID] = pc
+		cfgs[cfg.SessionID] = cfg
+		mut.Unlock()
+
+		err = s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		data, err := json.Marshal(offer)
+		require.NoError(t, err)
+		sendMsg(cfg, SDPMessage, data)
+
+		if !withDC {
+			return pc, nil
 		}
 
-		candidatesCh := gatherCandidates(serverCfg, nil)
+		select {
+		case <-dcOpenCh:
+		case <-time.After(10 * time.Second):
+			require.FailNow(t, "timed out waiting for data channel")
+		}
 
-		require.NotEmpty(t, candidatesCh)
-		for i := 0; i < len(candidatesCh); i++ {
-			candidate := <-candidatesCh
-			require.Equal(t, ice.CandidateTypeHost, candidate.Type())
-			require.Equal(t, serverCfg.ICEPortUDP, candidate.Port())
+		return pc, dataCh
+	}
+
+	newTrack := func() webrtc.TrackLocal {
+		t.Helper()
+		track, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, genTrackID(trackTypeVoice, random.NewID(), 0), random.NewID())
+		require.NoError(t, err)
+		return track
+	}
+
+	hasTrack := func(us *session, track webrtc.TrackLocal) bool {
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		return us.rxTracks[track.ID()] != nil
+	}
+
+	metrics := s.metrics.Metrics.(*perf.Metrics)
+
+	t.Run("dc closed", func(t *testing.T) {
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
 		}
+
+		var answerDC atomic.Bool
+		answerDC.Store(true)
+		var dcOffers atomic.Int64
+		pc, dataCh := initSession(cfg, true, &answerDC, &dcOffers)
+		defer pc.Close()
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+		require.NotNil(t, us)
+		wsOffersBefore := wsOffers.Load()
+
+		// Negotiation goes through the data channel.
+		trackA := newTrack()
+		us.tracksCh <- trackActionContext{action: trackActionAdd, track: trackA}
+		require.Eventually(t, func() bool {
+			return hasTrack(us, trackA)
+		}, 4*time.Second, 20*time.Millisecond)
+		require.Equal(t, int64(1), dcOffers.Load())
+		require.Equal(t, wsOffersBefore, wsOffers.Load())
+
+		// The data channel gets closed mid-call.
+		err := dataCh.Close()
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return !us.dcSignaling()
+		}, 4*time.Second, 20*time.Millisecond)
+		require.Equal(t, 1.0, testutil.ToFloat64(metrics.RTCErrors.With(prometheus.Labels{"groupID": cfg.GroupID, "type": "dc_signaling"})))
+
+		// WebSocket signaling takes over.
+		trackB := newTrack()
+		us.tracksCh <- trackActionContext{action: trackActionAdd, track: trackB}
+		require.Eventually(t, func() bool {
+			return hasTrack(us, trackB)
+		}, 4*time.Second, 20*time.Millisecond)
+		require.Equal(t, int64(1), dcOffers.Load())
+		require.Equal(t, wsOffersBefore+1, wsOffers.Load())
 	})
 
-	t.Run("host override - single port", func(t *testing.T) {
-		serverCfg := ServerConfig{
-			ICEPortUDP:          30433,
-			ICEPortTCP:          30433,
-			ICEHostOverride:     "8.8.8.8",
-			ICEHostPortOverride: "8443",
-			UDPSocketsCount:     GetDefaultUDPListeningSocketsCount(),
+	t.Run("dc signaling timeout", func(t *testing.T) {
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
 		}
 
-		candidatesCh := gatherCandidates(serverCfg, nil)
+		// The data channel is open but offers sent through it are never
+		// answered.
+		var answerDC atomic.Bool
+		var dcOffers atomic.Int64
+		pc, _ := initSession(cfg, true, &answerDC, &dcOffers)
+		defer pc.Close()
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
 
-		require.NotEmpty(t, candidatesCh)
-		for i := 0; i < len(candidatesCh); i++ {
-			candidate := <-candidatesCh
-			require.Equal(t, ice.CandidateTypeHost, candidate.Type())
+		us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+		require.NotNil(t, us)
+
+		// The track gets added through WebSocket after the DC negotiation
+		// times out.
+		track := newTrack()
+		us.tracksCh <- trackActionContext{action: trackActionAdd, track: track}
+		require.Eventually(t, func() bool {
+			return hasTrack(us, track)
+		}, 4*time.Second, 20*time.Millisecond)
+		require.Equal(t, int64(1), dcOffers.Load())
+		require.False(t, us.dcSignaling())
+		require.Equal(t, 1.0, testutil.ToFloat64(metrics.RTCErrors.With(prometheus.Labels{"groupID": cfg.GroupID, "type": "dc_signaling"})))
+		require.Equal(t, webrtc.SignalingStateStable, us.rtcConn.SignalingState())
+	})
 
-			if candidate.Address() == serverCfg.ICEHostOverride {
-				require.Equal(t, 8443, candidate.Port())
-			} else {
-				require.Equal(t, serverCfg.ICEPortUDP, candidate.Port())
-			}
+	t.Run("dc never opened", func(t *testing.T) {
+		// Making sure falling back doesn't rely on negotiations timing out.
+		s.cfg.SignalingTimeoutMs = 0
+		defer func() {
+			s.cfg.SignalingTimeoutMs = 1000
+		}()
+		s.cfg.DCOpenTimeoutMs = 500
+		defer func() {
+			s.cfg.DCOpenTimeoutMs = 0
+		}()
+
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
 		}
+
+		// The client asks for DC signaling but never creates the data channel.
+		var answerDC atomic.Bool
+		answerDC.Store(true)
+		var dcOffers atomic.Int64
+		pc, _ := initSession(cfg, false, &answerDC, &dcOffers)
+		defer pc.Close()
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+		require.NotNil(t, us)
+		wsOffersBefore := wsOffers.Load()
+
+		track := newTrack()
+		us.tracksCh <- trackActionContext{action: trackActionAdd, track: track}
+		require.Eventually(t, func() bool {
+			return hasTrack(us, track)
+		}, 4*time.Second, 20*time.Millisecond)
+		require.False(t, us.dcSignaling())
+		require.Equal(t, wsOffersBefore+1, wsOffers.Load())
+		require.Zero(t, dcOffers.Load())
+		require.Equal(t, 1.0, testutil.ToFloat64(metrics.RTCErrors.With(prometheus.Labels{"groupID": cfg.GroupID, "type": "dc_signaling"})))
 	})
+}
 
-	t.Run("host override - mapping", func(t *testing.T) {
-		serverCfg := ServerConfig{
-			ICEPortUDP:          30433,
-			ICEPortTCP:          30433,
-			ICEHostOverride:     "8.8.8.8",
-			ICEHostPortOverride: "127.0.0.1/8443",
-			UDPSocketsCount:     GetDefaultUDPListeningSocketsCount(),
+func TestGetCalls(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	t.Run("no calls", func(t *testing.T) {
+		require.Empty(t, s.GetCalls())
+	})
+
+	t.Run("active calls", func(t *testing.T) {
+		cfgs := []SessionConfig{
+			{GroupID: "groupA", CallID: "callB", UserID: random.NewID(), SessionID: random.NewID()},
+			{GroupID: "groupA", CallID: "callA", UserID: random.NewID(), SessionID: random.NewID()},
+			{GroupID: "groupA", CallID: "callA", UserID: random.NewID(), SessionID: random.NewID()},
+			{GroupID: "groupB", CallID: "callC", UserID: random.NewID(), SessionID: random.NewID()},
+		}
+		for _, cfg := range cfgs {
+			err := s.InitSession(cfg, nil)
+			require.NoError(t, err)
 		}
 
-		candidatesCh := gatherCandidates(serverCfg, nil)
+		c := s.getGroup("groupA").getCall("callA")
+		require.True(t, c.setScreenSession(c.getSession(cfgs[1].SessionID)))
 
-		require.NotEmpty(t, candidatesCh)
-		for i := 0; i < len(candidatesCh); i++ {
-			candidate := <-candidatesCh
-			require.Equal(t, ice.CandidateTypeHost, candidate.Type())
+		require.Equal(t, []CallInfo{
+			{GroupID: "groupA", CallID: "callA", SessionsCount: 2, HasScreen: true},
+			{GroupID: "groupA", CallID: "callB", SessionsCount: 1},
+			{GroupID: "groupB", CallID: "callC", SessionsCount: 1},
+		}, s.GetCalls())
 
-			if candidate.Address() == serverCfg.ICEHostOverride {
-				require.Equal(t, 8443, candidate.Port())
-			} else {
-				require.Equal(t, serverCfg.ICEPortUDP, candidate.Port())
+		// Listing calls while sessions are closing must not deadlock.
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				s.GetCalls()
 			}
+		}()
+		for _, cfg := range cfgs {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
 		}
+		wg.Wait()
+
+		require.Empty(t, s.GetCalls())
 	})
+}
 
-	t.Run("host override from STUN", func(t *testing.T) {
-		serverCfg := ServerConfig{
-			ICEPortUDP:          30433,
-			ICEPortTCP:          30433,
-			ICEHostPortOverride: "8443",
-			ICEHostOverride:     "",
-			UDPSocketsCount:     GetDefaultUDPListeningSocketsCount(),
+func TestActiveSpeakerCleared(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+	newCfg := func() SessionConfig {
+		return SessionConfig{
+			GroupID:   groupID,
+			CallID:    callID,
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
 		}
+	}
+	speakerCfg := newCfg()
+	listenerCfg := newCfg()
+	for _, cfg := range []SessionConfig{speakerCfg, listenerCfg} {
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+	}
+	defer func() {
+		err := s.CloseSession(listenerCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
 
-		publicIP := "8.8.8.8"
-		candidatesCh := gatherCandidates(serverCfg, map[netip.Addr]string{
-			netip.MustParseAddr("127.0.0.1"): publicIP,
-		})
+	c := s.getGroup(groupID).getCall(callID)
+	require.NotNil(t, c)
+	c.activeSpeaker.mut.Lock()
+	c.activeSpeaker.current = speakerCfg.SessionID
+	c.activeSpeaker.mut.Unlock()
 
-		require.NotEmpty(t, candidatesCh)
-		for i := 0; i < len(candidatesCh); i++ {
-			candidate := <-candidatesCh
-			require.Equal(t, ice.CandidateTypeHost, candidate.Type())
+	err = s.CloseSession(speakerCfg.SessionID, CloseReasonLeft)
+	require.NoError(t, err)
 
-			if candidate.Address() == publicIP {
-				require.Equal(t, 8443, candidate.Port())
-			} else {
-				require.Equal(t, serverCfg.ICEPortUDP, candidate.Port())
+	for {
+		select {
+		case msg := <-s.ReceiveCh():
+			if msg.Type != ActiveSpeakerClearedMessage {
+				continue
 			}
+			require.Equal(t, listenerCfg.SessionID, msg.SessionID)
+			require.Equal(t, callID, msg.CallID)
+			var data map[string]string
+			require.NoError(t, json.Unmarshal(msg.Data, &data))
+			require.Equal(t, speakerCfg.SessionID, data["sessionID"])
+			require.Empty(t, c.activeSpeaker.getActiveSpeaker())
+			return
+		case <-time.After(time.Second):
+			require.FailNow(t, "timed out waiting for message")
 		}
-	})
+	}
 }
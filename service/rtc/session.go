@@ -8,11 +8,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
 
+	"github.com/mattermost/rtcd/service/rtc/dc"
 	"github.com/mattermost/rtcd/service/rtc/vad"
 
 	"github.com/pion/interceptor/pkg/cc"
@@ -25,8 +27,62 @@ import (
 const (
 	signalChSize = 20
 	tracksChSize = 100
+
+	// audioPLCHintLossThreshold is the fraction of lost packets reported by a
+	// receiver above which the sender is hinted to increase FEC.
+	audioPLCHintLossThreshold = 0.1
+	// audioPLCHintRate is the maximum number of hints per second sent to a
+	// given session.
+	audioPLCHintRate = 0.2
+)
+
+// CloseReason describes why a session was closed.
+type CloseReason string
+
+const (
+	// CloseReasonLeft means the session was explicitly closed (e.g. the
+	// client left the call).
+	CloseReasonLeft CloseReason = "left"
+	// CloseReasonFailed means the session was closed due to a connection or
+	// signaling failure.
+	CloseReasonFailed CloseReason = "failed"
+	// CloseReasonDrained means the session was closed as part of draining
+	// the server or the call (Server.DrainCall).
+	CloseReasonDrained CloseReason = "drained"
+	// CloseReasonKicked means the session was forcibly removed from the call.
+	CloseReasonKicked CloseReason = "kicked"
+	// CloseReasonMaxDuration means the session was closed after exceeding
+	// the maximum allowed duration.
+	CloseReasonMaxDuration CloseReason = "max-duration"
+)
+
+// errTrackLimitReached is returned when adding a track to a session that
+// already has as many as ServerConfig.MaxTracksPerSession.
+var errTrackLimitReached = errors.New("session track limit reached")
+
+// errNoScreenTrackSender is returned when replacing the screen track of a
+// session that isn't receiving one.
+var errNoScreenTrackSender = errors.New("screen track sender is not set")
+
+// errSessionExists is returned when adding a session that's already part of
+// the call.
+var errSessionExists = errors.New("user session already exists")
+
+var (
+	errSignalingTimeout = errors.New("timed out signaling")
+	errSessionClosed    = errors.New("session closed")
 )
 
+// sdpMessage is the format of the SDP messages exchanged with the client.
+// OfferSeq is set on the offers we send and is expected to be echoed back in
+// the matching answer, so that an answer arriving late (e.g. after a signaling
+// timeout) can be told apart from the one to the currently pending offer.
+// It's optional as not all clients support it.
+type sdpMessage struct {
+	webrtc.SessionDescription
+	OfferSeq uint64 `json:"offerSeq,omitempty"`
+}
+
 // offerMessage is a wrapper struct to tie offers to a given answerCh
 // This channel could be backed by either WebSocket or DataChannel
 type offerMessage struct {
@@ -43,30 +99,141 @@ type session struct {
 	tracksCh      chan trackActionContext
 	iceInCh       chan []byte
 	sdpOfferInCh  chan offerMessage
-	sdpAnswerInCh chan webrtc.SessionDescription
+	sdpAnswerInCh chan sdpMessage
 	dcSDPCh       chan Message
+	dcBWECh       chan int
+	dcPLCHintCh   chan float64
+	// dcICEServersCh carries refreshed ICE servers (e.g. renewed TURN
+	// credentials) to be sent to the client.
+	dcICEServersCh chan []webrtc.ICEServer
+	// dcMediaMapCh carries the media map (MIDs to tracks) to be sent to the
+	// client after each negotiation.
+	dcMediaMapCh chan dc.MessageMediaMap
+	// dcLevelCh carries the simulcast level the session is receiving the
+	// screen track at, sent to the client whenever it changes.
+	dcLevelCh chan string
+	// dcOpenCh is closed once the client's data channel is open.
+	dcOpenCh chan struct{}
+	// dcLimiter rate limits inbound data channel messages
+	// (ServerConfig.MaxDCMessagesPerSecond). Nil if no limit is set.
+	dcLimiter    *rate.Limiter
+	rtcpCompound *rtcpCompoundInterceptor
+	stats        *statsInterceptor
+	// metricsSampled is set if the session emits fine-grained metrics
+	// (ServerConfig.MetricsSampleRate).
+	metricsSampled bool
+	// clientStats holds the latest network stats reported by the client,
+	// relayed at most every clientStatsInterval.
+	clientStats           ClientStats
+	clientStatsReportedAt time.Time
+	// answerBandwidth is the bandwidth advertised in the SDP answers sent to
+	// the session (e.g. ServerConfig.AudioAnswerBandwidthKbps).
+	answerBandwidth answerBandwidth
+	// maxTracks caps the number of tracks, forwarded and published, attached
+	// to the session (ServerConfig.MaxTracksPerSession). Zero means no limit.
+	maxTracks int
+	// signalingTimeout bounds how long negotiations with the client can take
+	// (ServerConfig.SignalingTimeoutMs).
+	signalingTimeout time.Duration
+	// inTracks is the number of tracks published by the session that are
+	// currently being read.
+	inTracks int
+	// offerSeq is the sequence number of the last offer sent to the client.
+	// It's only accessed by the negotiation goroutine.
+	offerSeq uint64
+	// offerSentAt is when the last offer was sent to the client. It's only
+	// accessed by the negotiation goroutine.
+	offerSentAt time.Time
+	// signalingRTT is the time it took the client to answer the last offer.
+	signalingRTT time.Duration
+	// connState is the last state the peer connection transitioned to.
+	connState webrtc.PeerConnectionState
+	// iceRestarting is set from the time the connection gets disconnected
+	// until it recovers.
+	iceRestarting bool
+	// iceRestartTimer is set while a session whose connection failed during
+	// an ICE restart is given time to recover.
+	iceRestartTimer *time.Timer
 
 	// Sender (publishing side)
 	outVoiceTrack        *webrtc.TrackLocalStaticRTP
 	outVoiceTrackEnabled bool
-	screenStreamID       string
-	outScreenTracks      map[string][]*webrtc.TrackLocalStaticRTP
-	outScreenAudioTrack  *webrtc.TrackLocalStaticRTP
-	remoteScreenTracks   map[string]*webrtc.TrackRemote
-	screenRateMonitors   map[string]*RateMonitor
+	// voiceMuted is whether the client last asked for its voice track to be
+	// muted. Since a mute can come in while the voice track is still being
+	// added, it takes precedence over enabling the track once received.
+	voiceMuted     bool
+	screenStreamID string
+	// rejectedScreenStreamID is the ID of the screen stream the session
+	// attempted to share while another session was already sharing.
+	rejectedScreenStreamID string
+	outScreenTracks        map[string][]*webrtc.TrackLocalStaticRTP
+	outScreenAudioTrack    *webrtc.TrackLocalStaticRTP
+	remoteScreenTracks     map[string]*webrtc.TrackRemote
+	screenRateMonitors     map[string]*RateMonitor
+	// demotedScreenTracks holds the screen output tracks that get demoted
+	// under CPU pressure (ServerConfig.ScreenDemotionCPUThreshold).
+	demotedScreenTracks map[*webrtc.TrackLocalStaticRTP]bool
+	// screenLayerSwitch is set while the screen tracks should be demoted but
+	// can't be thinned, in which case receivers of demoted tracks get
+	// switched to the lowest simulcast level instead.
+	screenLayerSwitch bool
+	// videoStreamID is the ID of the camera stream the session is sending.
+	videoStreamID    string
+	outVideoTrack    *webrtc.TrackLocalStaticRTP
+	remoteVideoTrack *webrtc.TrackRemote
 
 	// Receiver
 	bwEstimator       cc.BandwidthEstimator
 	screenTrackSender *webrtc.RTPSender
 	rxTracks          map[string]webrtc.TrackLocal
+	// screenDemoted is set while the session is kept at the lowest simulcast
+	// level in place of thinning the screen track it was receiving.
+	screenDemoted bool
+	// preferredSimulcastLevel is the highest simulcast level the client is
+	// willing to receive. An empty value means no preference.
+	preferredSimulcastLevel string
+	// sourceSimulcastLevels holds the preferred simulcast levels for tracks
+	// sent by specific sessions, keyed by session ID. These take precedence
+	// over preferredSimulcastLevel.
+	sourceSimulcastLevels map[string]string
+	// levelChangeBackoff throttles simulcast level changes
+	// (ServerConfig.SimulcastBackoffInitialMs).
+	levelChangeBackoff levelChangeBackoff
+	// stoppedSources holds the IDs of the sessions this session asked to stop
+	// receiving tracks from.
+	stoppedSources map[string]bool
+	// dcSignalingFailed is set if signaling through the data channel failed,
+	// in which case we fall back to WebSocket signaling.
+	dcSignalingFailed bool
+	// videoCodecs holds the mime types of the video codecs that were
+	// registered when the session was created.
+	videoCodecs []string
+	// opusDTX is set if Opus DTX was offered to the session, in which case
+	// its audio tracks may have gaps during silence.
+	opusDTX bool
 
 	closeCh chan struct{}
-	closeCb func() error
+	closeCb func(reason CloseReason) error
 	doneCh  chan struct{}
 
 	vadMonitor *vad.Monitor
+	// vadDebouncer holds voice off events for the session. It's stopped when
+	// the session closes.
+	vadDebouncer *vadDebouncer
 
 	makingOffer bool
+	// outstandingOffers is the number of offers sent to the client, including
+	// those sent again, since the last answer was received.
+	outstandingOffers int
+
+	// createdAt is the time the session was initialized.
+	createdAt time.Time
+	// turnCredentialsIssuedAt is the time the TURN credentials last given to
+	// the client were generated. Zero if none were.
+	turnCredentialsIssuedAt time.Time
+	// connectedAt is the time the peer connection first reached the
+	// connected state. Zero if it never did.
+	connectedAt time.Time
 
 	log  mlog.LoggerIFace
 	call *call
@@ -74,7 +241,7 @@ type session struct {
 	mut sync.RWMutex
 }
 
-func (s *Server) addSession(cfg SessionConfig, peerConn *webrtc.PeerConnection, closeCb func() error) (*session, error) {
+func (s *Server) addSession(cfg SessionConfig, peerConn *webrtc.PeerConnection, closeCb func(reason CloseReason) error) (*session, error) {
 	if err := cfg.IsValid(); err != nil {
 		return nil, err
 	}
@@ -87,34 +254,78 @@ func (s *Server) addSession(cfg SessionConfig, peerConn *webrtc.PeerConnection,
 	g := s.groups[cfg.GroupID]
 	if g == nil {
 		// group is missing, creating one
-		g = &group{
-			id:    cfg.GroupID,
-			calls: map[string]*call{},
+		g = newGroup(cfg.GroupID, s.cfg.getGroupMessagesPerSecond(cfg.GroupID))
+		if g.signalingCh != nil {
+			go g.processSignaling(s.sendMessage)
 		}
 		s.groups[g.id] = g
+		s.metrics.SetRTCGroupCount(len(s.groups))
 	}
 	s.mut.Unlock()
 
 	g.mut.Lock()
 	c := g.calls[cfg.CallID]
+	if c != nil && c.isDraining() {
+		g.mut.Unlock()
+		return nil, ErrCallDraining
+	}
+	callCreated := c == nil
 	if c == nil {
 		// call is missing, creating one
 		c = &call{
 			id:          cfg.CallID,
 			sessions:    map[string]*session{},
 			pliLimiters: map[webrtc.SSRC]*rate.Limiter{},
+			pliInterval: pliMaxIntervalDefault,
 			metrics:     s.metrics,
+			drops:       s.drops,
+			maxSessions: s.cfg.MaxCallParticipants,
+		}
+		c.activeSpeaker = newActiveSpeakerDetector(time.Duration(s.cfg.ActiveSpeakerDebounceMs)*time.Millisecond, nil)
+		if s.cfg.PLIMaxIntervalMs > 0 {
+			c.pliInterval = time.Duration(s.cfg.PLIMaxIntervalMs) * time.Millisecond
+		}
+		if s.cfg.MaxForwardedAudioStreams > 0 {
+			c.audioSelector = newAudioSelector(s.cfg.MaxForwardedAudioStreams, s.cfg.AudioLevelSilenceThreshold, nil)
+		}
+		if s.cfg.EnableAudioPLCHint {
+			c.plcHintLimiters = map[string]*rate.Limiter{}
+		}
+		if s.cfg.MaxForwardingWorkersPerCall > 0 {
+			c.forwardingSem = make(chan struct{}, s.cfg.MaxForwardingWorkersPerCall)
+		}
+		if s.cfg.MaxReceiversPerPublisher > 0 {
+			c.receiversLimiter = newReceiversLimiter(s.cfg.MaxReceiversPerPublisher)
 		}
 		g.calls[c.id] = c
 	}
 	g.mut.Unlock()
 
-	us, ok := c.addSession(cfg, peerConn, closeCb, s.log)
-	if !ok {
-		return nil, fmt.Errorf("user session already exists")
+	if callCreated {
+		s.updateCallsCount(1)
+	}
+
+	us, err := c.addSession(cfg, peerConn, closeCb, s.log.With(mlog.String("callID", cfg.CallID)))
+	if err != nil {
+		return nil, err
 	}
+	if s.cfg.MaxDCMessagesPerSecond > 0 {
+		us.dcLimiter = rate.NewLimiter(rate.Limit(s.cfg.MaxDCMessagesPerSecond), s.cfg.MaxDCMessagesPerSecond)
+	}
+	us.metricsSampled = isSessionSampled(s.cfg.MetricsSampleRate)
+	us.maxTracks = s.cfg.MaxTracksPerSession
+	us.signalingTimeout = s.cfg.getSignalingTimeout()
+	us.answerBandwidth = answerBandwidth{
+		audioKbps:  s.cfg.AudioAnswerBandwidthKbps,
+		screenKbps: s.cfg.ScreenAnswerBandwidthKbps,
+		videoKbps:  s.cfg.VideoAnswerBandwidthKbps,
+	}
+	us.mut.Lock()
+	us.levelChangeBackoff = newLevelChangeBackoff(s.cfg.getSimulcastBackoff())
+	us.mut.Unlock()
 	s.mut.Lock()
 	s.sessions[cfg.SessionID] = cfg
+	s.metrics.IncRTCSessions(cfg.GroupID)
 	s.mut.Unlock()
 
 	return us, nil
@@ -143,19 +354,19 @@ func (s *Server) handleNegotiations(us *session, call *call) {
 
 			// We need to preemptively close doneCh to avoid CloseSession from blocking indefinitely on it.
 			close(us.doneCh)
-			if err := s.CloseSession(us.cfg.SessionID); err != nil {
+			if err := s.CloseSession(us.cfg.SessionID, CloseReasonFailed); err != nil {
 				s.log.Error("failed to close session", mlog.Any("sessionCfg", us.cfg))
 			}
 
 			return
 		}
-	case <-time.After(signalingTimeout):
+	case <-time.After(us.signalingTimeout):
 		s.log.Error("timed out signaling", mlog.Any("sessionCfg", us.cfg))
 		s.metrics.IncRTCErrors(us.cfg.GroupID, "signaling")
 
 		// We need to preemptively close doneCh to avoid CloseSession from blocking indefinitely on it.
 		close(us.doneCh)
-		if err := s.CloseSession(us.cfg.SessionID); err != nil {
+		if err := s.CloseSession(us.cfg.SessionID, CloseReasonFailed); err != nil {
 			s.log.Error("failed to close session", mlog.Any("sessionCfg", us.cfg))
 		}
 
@@ -182,6 +393,44 @@ func (s *session) getScreenStreamID() string {
 	return s.screenStreamID
 }
 
+func (s *session) getVideoStreamID() string {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return s.videoStreamID
+}
+
+// setScreenLayerSwitch sets whether receivers of demoted screen tracks
+// should be switched to the lowest simulcast level.
+func (s *session) setScreenLayerSwitch(enabled bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.screenLayerSwitch = enabled
+}
+
+// getScreenLayerSwitch returns whether receivers of demoted screen tracks
+// should be switched to the lowest simulcast level and whether the given
+// track is a demoted one.
+func (s *session) getScreenLayerSwitch(track *webrtc.TrackLocalStaticRTP) (bool, bool) {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return s.screenLayerSwitch, s.demotedScreenTracks[track]
+}
+
+// requestScreenKeyFrame asks the client for a keyframe on the screen track
+// at the given level, subject to the call's PLI rate limiting.
+func (s *session) requestScreenKeyFrame(mimeType, rid string) error {
+	screenTrack := s.getRemoteScreenTrack(mimeType, rid)
+	if screenTrack == nil {
+		return fmt.Errorf("screen track not found")
+	}
+
+	if !s.call.getPLILimiter(screenTrack.SSRC()).Allow() {
+		return nil
+	}
+
+	return s.rtcConn.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(screenTrack.SSRC())}})
+}
+
 func (s *session) getRemoteScreenTrack(mimeType, rid string) *webrtc.TrackRemote {
 	s.mut.RLock()
 	defer s.mut.RUnlock()
@@ -213,6 +462,21 @@ func (s *session) getSourceRate(mimeType, rid string) int {
 	return rate
 }
 
+// getScreenSimulcastLevels returns the simulcast levels of the screen tracks
+// currently received for the given mime type, sorted from lowest to highest.
+func (s *session) getScreenSimulcastLevels(mimeType string) []string {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+
+	var levels []string
+	for _, level := range simulcastLevels {
+		if _, ok := s.outScreenTracks[getTrackIndex(mimeType, level)]; ok {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
 func (s *session) getOutScreenTrack(mimeType, rid string) *webrtc.TrackLocalStaticRTP {
 	s.mut.RLock()
 	defer s.mut.RUnlock()
@@ -220,15 +484,145 @@ func (s *session) getOutScreenTrack(mimeType, rid string) *webrtc.TrackLocalStat
 	return pickRandom(s.outScreenTracks[getTrackIndex(mimeType, rid)])
 }
 
-func (s *session) getExpectedSimulcastLevel() string {
+func (s *session) getExpectedSimulcastLevel(sourceSessionID string) string {
+	// A level pinned for the whole call takes precedence over both network
+	// conditions and preferences.
+	if s.call != nil {
+		if level := s.call.getFixedSimulcastLevel(); level != "" {
+			return level
+		}
+	}
+
 	s.mut.RLock()
 	defer s.mut.RUnlock()
 
+	if s.congestionControlDisabled() {
+		return s.capSimulcastLevel(SimulcastLevelHigh, sourceSessionID)
+	}
+
 	if s.bwEstimator == nil {
 		return SimulcastLevelDefault
 	}
 
-	return getSimulcastLevelForRate(s.bwEstimator.GetTargetBitrate())
+	return s.capSimulcastLevel(getSimulcastLevelForRate(s.bwEstimator.GetTargetBitrate()), sourceSessionID)
+}
+
+func (s *session) setPreferredSimulcastLevel(level string) error {
+	if !isValidSimulcastLevel(level) {
+		return fmt.Errorf("invalid simulcast level %q", level)
+	}
+
+	s.mut.Lock()
+	s.preferredSimulcastLevel = level
+	s.mut.Unlock()
+
+	return nil
+}
+
+func (s *session) setSourceSimulcastLevel(sourceSessionID, level string) error {
+	if sourceSessionID == "" {
+		return fmt.Errorf("invalid empty source session ID")
+	}
+
+	if !isValidSimulcastLevel(level) {
+		return fmt.Errorf("invalid simulcast level %q", level)
+	}
+
+	s.mut.Lock()
+	if s.sourceSimulcastLevels == nil {
+		s.sourceSimulcastLevels = make(map[string]string)
+	}
+	s.sourceSimulcastLevels[sourceSessionID] = level
+	s.mut.Unlock()
+
+	return nil
+}
+
+// trackLimitReached returns whether the session has as many tracks attached
+// as it's allowed to.
+// NOTE: this is expected to be called under lock (s.mut).
+func (s *session) trackLimitReached() bool {
+	if s.maxTracks == 0 {
+		return false
+	}
+
+	count := s.inTracks
+	for _, snd := range s.rtcConn.GetSenders() {
+		if snd.Track() != nil {
+			count++
+		}
+	}
+
+	return count >= s.maxTracks
+}
+
+// acquireInTrack accounts for a newly published track, returning false if
+// the session's track limit has been reached.
+func (s *session) acquireInTrack() bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.trackLimitReached() {
+		return false
+	}
+	s.inTracks++
+
+	return true
+}
+
+func (s *session) releaseInTrack() {
+	s.mut.Lock()
+	s.inTracks--
+	s.mut.Unlock()
+}
+
+// stopReceiving marks the given source session as stopped and returns the
+// tracks from it that are currently being received.
+func (s *session) stopReceiving(sourceSessionID string) []webrtc.TrackLocal {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.stoppedSources == nil {
+		s.stoppedSources = make(map[string]bool)
+	}
+	s.stoppedSources[sourceSessionID] = true
+
+	var tracks []webrtc.TrackLocal
+	for trackID, track := range s.rxTracks {
+		if _, senderID, err := parseTrackID(trackID); err == nil && senderID == sourceSessionID {
+			tracks = append(tracks, track)
+		}
+	}
+
+	return tracks
+}
+
+// isReceivingStopped returns whether the session asked to stop receiving
+// tracks from the sender of the given track.
+func (s *session) isReceivingStopped(trackID string) bool {
+	_, senderID, err := parseTrackID(trackID)
+	if err != nil {
+		return false
+	}
+
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return s.stoppedSources[senderID]
+}
+
+// capSimulcastLevel lowers the given level to the preferred one for the
+// source session, if set, falling back to the session wide preference.
+// NOTE: this is expected to be called under lock (s.mut).
+func (s *session) capSimulcastLevel(level, sourceSessionID string) string {
+	preferredLevel := s.preferredSimulcastLevel
+	if sourceLevel, ok := s.sourceSimulcastLevels[sourceSessionID]; ok {
+		preferredLevel = sourceLevel
+	}
+
+	if preferredLevel != "" && slices.Index(simulcastLevels, preferredLevel) < slices.Index(simulcastLevels, level) {
+		return preferredLevel
+	}
+	return level
 }
 
 // handleICE deals with trickle ICE candidates.
@@ -295,7 +689,18 @@ func (s *session) handleSenderRTCP(sender *webrtc.RTPSender) {
 			}
 			return
 		}
+		// The track is unset while being removed (i.e. replaced with nil) but
+		// the sender can still get RTCP for it in the meantime.
+		track := sender.Track()
+		if track == nil {
+			continue
+		}
 		for _, pkt := range pkts {
+			if rr, ok := pkt.(*rtcp.ReceiverReport); ok {
+				s.handleVoiceReceiverReport(track.ID(), rr)
+				continue
+			}
+
 			if p, ok := pkt.(*rtcp.PictureLossIndication); ok {
 				// When a PLI is received the request is forwarded
 				// to the peer generating the track (e.g. presenter).
@@ -304,42 +709,35 @@ func (s *session) handleSenderRTCP(sender *webrtc.RTPSender) {
 					s.log.Debug("received PLI request for track", mlog.String("sessionID", s.cfg.SessionID), mlog.Uint("SSRC", dstSSRC))
 				}
 
+				if tt, sourceSessionID, err := parseTrackID(track.ID()); err == nil && tt == trackTypeVideo {
+					if err := s.forwardVideoPLI(sourceSessionID); err != nil {
+						s.log.Error("failed to forward PLI request", mlog.Err(err), mlog.String("sessionID", s.cfg.SessionID))
+					}
+					continue
+				}
+
 				screenSession := s.call.getScreenSession()
 				if screenSession == nil {
 					s.log.Error("screenSession should not be nil", mlog.String("sessionID", s.cfg.SessionID))
 					return
 				}
 
-				senderTrack, ok := sender.Track().(*webrtc.TrackLocalStaticRTP)
+				senderTrack, ok := track.(*webrtc.TrackLocalStaticRTP)
 				if !ok {
 					s.log.Error("track conversion failed", mlog.String("sessionID", s.cfg.SessionID))
 					return
 				}
 
-				if senderTrack == nil {
-					s.log.Error("senderTrack should not be nil", mlog.String("sessionID", s.cfg.SessionID))
-					return
-				}
-
-				screenTrack := screenSession.getRemoteScreenTrack(senderTrack.Codec().MimeType, sender.Track().RID())
+				screenTrack := screenSession.getRemoteScreenTrack(senderTrack.Codec().MimeType, track.RID())
 				if screenTrack == nil {
 					s.log.Error("screenTrack should not be nil", mlog.String("sessionID", s.cfg.SessionID))
 					return
 				}
 
-				s.call.mut.Lock()
-				// We allow at most one PLI request per second for a given SSRC to avoid overloading the sender.
-				// If a receiving client were to miss it due to rate limiting (e.g. joining right in the second of backoff),
-				// it will request it again and eventually get it.
-				limiter, ok := s.call.pliLimiters[screenTrack.SSRC()]
-				if !ok {
-					s.log.Debug("creating new PLI limiter for track", mlog.Uint("SSRC", screenTrack.SSRC()))
-					limiter = rate.NewLimiter(1, 1)
-					s.call.pliLimiters[screenTrack.SSRC()] = limiter
-				}
-				s.call.mut.Unlock()
-
-				if limiter.Allow() {
+				// We allow at most one PLI request per interval (ServerConfig.PLIMaxIntervalMs) for a given SSRC
+				// to avoid overloading the sender. If a receiving client were to miss it due to rate limiting
+				// (e.g. joining right in the interval of backoff), it will request it again and eventually get it.
+				if s.call.getPLILimiter(screenTrack.SSRC()).Allow() {
 					s.log.Debug("forwarding PLI request for track", mlog.String("sessionID", s.cfg.SessionID), mlog.Uint("SSRC", screenTrack.SSRC()))
 					if err := screenSession.rtcConn.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(screenTrack.SSRC())}}); err != nil {
 						s.log.Error("failed to write RTCP packet", mlog.Err(err), mlog.String("sessionID", s.cfg.SessionID))
@@ -351,31 +749,216 @@ func (s *session) handleSenderRTCP(sender *webrtc.RTPSender) {
 	}
 }
 
-// sendOffer creates and sends out a new SDP offer.
-func (s *session) sendOffer(sdpOutCh chan<- Message) error {
-	offer, err := s.rtcConn.CreateOffer(nil)
-	if err != nil {
-		return fmt.Errorf("failed to create offer: %w", err)
+// handleVoiceReceiverReport checks the loss reported for a received voice
+// track and, if high enough, hints the session sending it to increase its
+// error resilience.
+func (s *session) handleVoiceReceiverReport(trackID string, rr *rtcp.ReceiverReport) {
+	if s.call.plcHintLimiters == nil {
+		return
 	}
 
-	err = s.rtcConn.SetLocalDescription(offer)
+	tt, senderID, err := parseTrackID(trackID)
+	if err != nil || tt != trackTypeVoice {
+		return
+	}
+
+	var lossRate float64
+	for _, report := range rr.Reports {
+		lossRate = max(lossRate, float64(report.FractionLost)/256)
+	}
+	if lossRate < audioPLCHintLossThreshold {
+		return
+	}
+
+	ss := s.call.getSession(senderID)
+	if ss == nil {
+		return
+	}
+
+	s.call.mut.Lock()
+	limiter, ok := s.call.plcHintLimiters[senderID]
+	if !ok {
+		limiter = rate.NewLimiter(audioPLCHintRate, 1)
+		s.call.plcHintLimiters[senderID] = limiter
+	}
+	s.call.mut.Unlock()
+
+	if !limiter.Allow() {
+		return
+	}
+
+	s.log.Debug("sending audio PLC hint",
+		mlog.String("sessionID", senderID),
+		mlog.String("reporterSessionID", s.cfg.SessionID),
+		mlog.Float("lossRate", lossRate))
+
+	select {
+	case ss.dcPLCHintCh <- lossRate:
+	default:
+	}
+}
+
+func (s *session) setRemoteDescription(desc webrtc.SessionDescription) error {
+	if err := s.rtcConn.SetRemoteDescription(desc); err != nil {
+		return err
+	}
+	s.rtcpCompound.onRemoteDescription(desc.SDP)
+	return nil
+}
+
+// localDescription returns the local description to be sent to the client.
+func (s *session) localDescription() *webrtc.SessionDescription {
+	desc := s.rtcConn.LocalDescription()
+	if desc == nil {
+		return nil
+	}
+	return &webrtc.SessionDescription{
+		Type: desc.Type,
+		SDP:  s.rtcpCompound.localDescription(desc.SDP),
+	}
+}
+
+// completePendingOffer sends again a local offer left unanswered by a previous
+// negotiation (e.g. because it got lost) and waits for the answer. Since
+// local rollbacks are not supported, this is needed before a new offer can
+// be made.
+func (s *session) completePendingOffer(sdpOutCh chan<- Message) error {
+	if s.rtcConn.SignalingState() != webrtc.SignalingStateHaveLocalOffer {
+		return nil
+	}
+
+	s.log.Debug("resending pending offer", mlog.String("sessionID", s.cfg.SessionID))
+
+	// The offer is the same so it keeps its sequence number. This way a late
+	// answer to it is still accepted.
+	if err := s.sendLocalDescription(sdpOutCh); err != nil {
+		return err
+	}
+
+	answer, err := s.waitForAnswer()
 	if err != nil {
-		return fmt.Errorf("failed to set local description: %w", err)
+		return err
+	}
+	if err := s.setRemoteDescription(answer); err != nil {
+		return fmt.Errorf("failed to set remote description: %w", err)
 	}
 
-	sdp, err := json.Marshal(s.rtcConn.LocalDescription())
+	return nil
+}
+
+// sendLocalDescription sends out the current local description, tagged with
+// the current offer sequence number.
+func (s *session) sendLocalDescription(sdpOutCh chan<- Message) error {
+	desc := s.localDescription()
+	if desc == nil {
+		return fmt.Errorf("local description is not set")
+	}
+
+	sdp, err := json.Marshal(sdpMessage{
+		SessionDescription: *desc,
+		OfferSeq:           s.offerSeq,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to marshal sdp: %w", err)
 	}
 
 	select {
 	case sdpOutCh <- newMessage(s, SDPMessage, sdp):
+		s.offerSentAt = time.Now()
+		s.mut.Lock()
+		s.outstandingOffers++
+		s.mut.Unlock()
 		return nil
 	default:
+		s.call.metrics.IncRTCChannelFull(s.cfg.GroupID, "sdp")
 		return fmt.Errorf("failed to send SDP message: channel is full")
 	}
 }
 
+// waitForAnswer waits for the answer to the currently pending offer. Answers
+// to previous offers are discarded so that they don't get applied to the
+// wrong one.
+func (s *session) waitForAnswer() (webrtc.SessionDescription, error) {
+	timeoutCh := time.After(s.signalingTimeout)
+	for {
+		select {
+		case answer, ok := <-s.sdpAnswerInCh:
+			if !ok {
+				return webrtc.SessionDescription{}, errSessionClosed
+			}
+			if answer.OfferSeq != 0 && answer.OfferSeq != s.offerSeq {
+				s.log.Debug("discarding stale sdp answer",
+					mlog.String("sessionID", s.cfg.SessionID),
+					mlog.Uint("answerOfferSeq", answer.OfferSeq),
+					mlog.Uint("offerSeq", s.offerSeq))
+				continue
+			}
+			s.observeSignalingRTT(time.Since(s.offerSentAt))
+			s.resetOutstandingOffers()
+			return answer.SessionDescription, nil
+		case <-timeoutCh:
+			return webrtc.SessionDescription{}, errSignalingTimeout
+		case <-s.closeCh:
+			return webrtc.SessionDescription{}, errSessionClosed
+		}
+	}
+}
+
+func (s *session) observeSignalingRTT(rtt time.Duration) {
+	s.mut.Lock()
+	s.signalingRTT = rtt
+	s.mut.Unlock()
+
+	if s.metricsSampled {
+		s.call.metrics.ObserveRTCSignalingRTT(s.cfg.GroupID, rtt.Seconds())
+	}
+}
+
+// discardQueuedAnswers drops any answer still queued. Answers that don't
+// carry an offer sequence number can't be matched to their offer so this
+// makes sure that at least those that arrived late, while no negotiation was
+// in progress, are not applied to the next offer.
+func (s *session) discardQueuedAnswers() {
+	for {
+		select {
+		case answer, ok := <-s.sdpAnswerInCh:
+			if !ok {
+				return
+			}
+			s.log.Debug("discarding stale sdp answer",
+				mlog.String("sessionID", s.cfg.SessionID),
+				mlog.Uint("answerOfferSeq", answer.OfferSeq),
+				mlog.Uint("offerSeq", s.offerSeq))
+		default:
+			return
+		}
+	}
+}
+
+// sendOffer creates and sends out a new SDP offer.
+func (s *session) sendOffer(sdpOutCh chan<- Message, opts *webrtc.OfferOptions) error {
+	if err := s.completePendingOffer(sdpOutCh); err != nil {
+		return fmt.Errorf("failed to complete pending offer: %w", err)
+	}
+
+	// No offer is pending at this point so anything left in the queue is stale.
+	s.discardQueuedAnswers()
+
+	offer, err := s.rtcConn.CreateOffer(opts)
+	if err != nil {
+		return fmt.Errorf("failed to create offer: %w", err)
+	}
+
+	err = s.rtcConn.SetLocalDescription(offer)
+	if err != nil {
+		return fmt.Errorf("failed to set local description: %w", err)
+	}
+
+	s.offerSeq++
+
+	return s.sendLocalDescription(sdpOutCh)
+}
+
 // addTrack adds the given track to the peer and starts negotiation.
 func (s *session) addTrack(sdpOutCh chan<- Message, track webrtc.TrackLocal) (errRet error) {
 	if track == nil {
@@ -395,32 +978,57 @@ func (s *session) addTrack(sdpOutCh chan<- Message, track webrtc.TrackLocal) (er
 	}()
 
 	s.mut.Lock()
-	for _, sender := range s.rtcConn.GetSenders() {
-		if sender.Track() == track {
+	for _, snd := range s.rtcConn.GetSenders() {
+		if snd.Track() == track {
 			s.mut.Unlock()
 			return fmt.Errorf("sender for track already exists")
 		}
 	}
 
-	if track.Kind() == webrtc.RTPCodecTypeVideo && s.screenTrackSender != nil {
+	if isScreenTrack(track) && s.screenTrackSender != nil {
 		s.mut.Unlock()
 		return fmt.Errorf("screen track sender is already set")
 	}
 
+	if s.trackLimitReached() {
+		s.mut.Unlock()
+		return errTrackLimitReached
+	}
+
 	sender, err := s.rtcConn.AddTrack(track)
 	if err != nil {
 		s.mut.Unlock()
 		return fmt.Errorf("failed to add track %s: %w", track.ID(), err)
 	}
+	go s.handleSenderRTCP(sender)
 	s.call.metrics.IncRTPTracks(s.cfg.GroupID, "out", getTrackType(track.Kind()))
 	s.mut.Unlock()
 
+	var timedOut bool
 	defer func() {
 		if errRet == nil {
 			return
 		}
 
 		s.mut.Lock()
+		defer s.mut.Unlock()
+
+		// On timeout the sender is removed altogether. The pending offer
+		// cannot be rolled back so it gets completed on the next negotiation
+		// (see completePendingOffer) while the removal goes out with the
+		// following offer. Resubscribing adds the track through a new sender.
+		if timedOut {
+			if err := s.rtcConn.RemoveTrack(sender); err != nil {
+				s.log.Error("failed to remove track",
+					mlog.String("sessionID", s.cfg.SessionID),
+					mlog.String("trackID", track.ID()),
+					mlog.Err(err))
+			}
+			s.call.metrics.DecRTPTracks(s.cfg.GroupID, "out", getTrackType(track.Kind()))
+			delete(s.rxTracks, track.ID())
+			return
+		}
+
 		if err := sender.ReplaceTrack(nil); err != nil {
 			s.log.Error("failed to replace track",
 				mlog.String("sessionID", s.cfg.SessionID),
@@ -429,38 +1037,95 @@ func (s *session) addTrack(sdpOutCh chan<- Message, track webrtc.TrackLocal) (er
 			s.call.metrics.DecRTPTracks(s.cfg.GroupID, "out", getTrackType(track.Kind()))
 			delete(s.rxTracks, track.ID())
 		}
-		s.mut.Unlock()
 	}()
 
-	go s.handleSenderRTCP(sender)
-
-	if err := s.sendOffer(sdpOutCh); err != nil {
+	if err := s.sendOffer(sdpOutCh, nil); err != nil {
 		return fmt.Errorf("failed to send offer for track %s: %w", track.ID(), err)
 	}
 
-	select {
-	case answer, ok := <-s.sdpAnswerInCh:
-		if !ok {
-			return nil
+	answer, err := s.waitForAnswer()
+	if errors.Is(err, errSessionClosed) {
+		s.log.Debug("session closed during signaling", mlog.Any("sessionCfg", s.cfg))
+		return nil
+	} else if err != nil {
+		timedOut = true
+		return err
+	}
+	if err := s.setRemoteDescription(answer); err != nil {
+		return fmt.Errorf("failed to set remote description for track %s: %w", track.ID(), err)
+	}
+
+	s.mut.Lock()
+	if isScreenTrack(track) {
+		s.screenTrackSender = sender
+	}
+	s.rxTracks[track.ID()] = track
+	s.mut.Unlock()
+
+	return nil
+}
+
+// isReceivingPublishedTrack returns whether the session is being sent an out
+// track, other than the given one, of the same published track (i.e. same
+// sender and type).
+func (s *session) isReceivingPublishedTrack(track webrtc.TrackLocal) bool {
+	tt, senderID, err := parseTrackID(track.ID())
+	if err != nil {
+		return false
+	}
+
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+
+	for trackID := range s.rxTracks {
+		if trackID == track.ID() {
+			continue
 		}
-		if err := s.rtcConn.SetRemoteDescription(answer); err != nil {
-			return fmt.Errorf("failed to set remote description for track %s: %w", track.ID(), err)
+		if rxType, rxSenderID, err := parseTrackID(trackID); err == nil && rxType == tt && rxSenderID == senderID {
+			return true
 		}
+	}
 
-		s.mut.Lock()
-		if track.Kind() == webrtc.RTPCodecTypeVideo {
-			s.screenTrackSender = sender
-		}
-		s.rxTracks[track.ID()] = track
-		s.mut.Unlock()
-	case <-time.After(signalingTimeout):
-		return fmt.Errorf("timed out signaling")
-	case <-s.closeCh:
-		s.log.Debug("closeCh closed during signaling", mlog.Any("sessionCfg", s.cfg))
-		return nil
+	return false
+}
+
+// replaceScreenTrack swaps the screen track currently being sent to the peer
+// with the given one. No renegotiation happens so the new track is expected to
+// use the same codec. It returns the replaced track, if any.
+func (s *session) replaceScreenTrack(track webrtc.TrackLocal) (webrtc.TrackLocal, error) {
+	if track == nil {
+		return nil, fmt.Errorf("trying to replace with a nil track")
 	}
 
-	return nil
+	if !isScreenTrack(track) {
+		return nil, fmt.Errorf("track %s is not a screen track", track.ID())
+	}
+
+	s.log.Debug("replaceScreenTrack", mlog.String("sessionID", s.cfg.SessionID),
+		mlog.String("trackID", track.ID()))
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.screenTrackSender == nil {
+		return nil, errNoScreenTrackSender
+	}
+
+	oldTrack := s.screenTrackSender.Track()
+	if oldTrack == track {
+		return nil, nil
+	}
+
+	if err := s.screenTrackSender.ReplaceTrack(track); err != nil {
+		return nil, fmt.Errorf("failed to replace track: %w", err)
+	}
+
+	if oldTrack != nil {
+		delete(s.rxTracks, oldTrack.ID())
+	}
+	s.rxTracks[track.ID()] = track
+
+	return oldTrack, nil
 }
 
 // removeTrack removes the given track to the peer and starts (re)negotiation.
@@ -498,23 +1163,19 @@ func (s *session) removeTrack(sdpOutCh chan<- Message, track webrtc.TrackLocal)
 	}
 	s.mut.Unlock()
 
-	if err := s.sendOffer(sdpOutCh); err != nil {
+	if err := s.sendOffer(sdpOutCh, nil); err != nil {
 		return fmt.Errorf("failed to send offer: %w", err)
 	}
 
-	select {
-	case answer, ok := <-s.sdpAnswerInCh:
-		if !ok {
-			return nil
-		}
-		if err := s.rtcConn.SetRemoteDescription(answer); err != nil {
-			return fmt.Errorf("failed to set remote description: %w", err)
-		}
-	case <-time.After(signalingTimeout):
-		return fmt.Errorf("timed out signaling")
-	case <-s.closeCh:
-		s.log.Debug("closeCh closed during signaling", mlog.Any("sessionCfg", s.cfg))
+	answer, err := s.waitForAnswer()
+	if errors.Is(err, errSessionClosed) {
+		s.log.Debug("session closed during signaling", mlog.Any("sessionCfg", s.cfg))
 		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := s.setRemoteDescription(answer); err != nil {
+		return fmt.Errorf("failed to set remote description: %w", err)
 	}
 
 	return nil
@@ -527,7 +1188,7 @@ func (s *session) signaling(offer webrtc.SessionDescription, answerCh chan<- Mes
 		return nil
 	}
 
-	if err := s.rtcConn.SetRemoteDescription(offer); err != nil {
+	if err := s.setRemoteDescription(offer); err != nil {
 		return err
 	}
 
@@ -540,7 +1201,12 @@ func (s *session) signaling(offer webrtc.SessionDescription, answerCh chan<- Mes
 		return err
 	}
 
-	sdp, err := json.Marshal(s.rtcConn.LocalDescription())
+	desc := s.localDescription()
+	if desc != nil && s.answerBandwidth.isSet() {
+		desc.SDP = addAnswerBandwidth(offer.SDP, desc.SDP, s.answerBandwidth, s.getScreenStreamID())
+	}
+
+	sdp, err := json.Marshal(desc)
 	if err != nil {
 		return err
 	}
@@ -548,6 +1214,7 @@ func (s *session) signaling(offer webrtc.SessionDescription, answerCh chan<- Mes
 	select {
 	case answerCh <- newMessage(s, SDPMessage, sdp):
 	default:
+		s.call.metrics.IncRTCChannelFull(s.cfg.GroupID, "sdp")
 		return fmt.Errorf("failed to send SDP message: channel is full")
 	}
 
@@ -563,9 +1230,20 @@ func (s *session) hasSignalingConflict() bool {
 	return s.makingOffer || s.rtcConn.SignalingState() != webrtc.SignalingStateStable
 }
 
-func (s *session) InitVAD(log mlog.LoggerIFace, msgCh chan<- Message) error {
-	monitor, err := vad.NewMonitor((vad.MonitorConfig{}).SetDefaults(), func(voice bool) {
-		log.Debug("vad", mlog.Bool("voice", voice), mlog.String("sessionID", s.cfg.SessionID))
+// InitVAD sets up voice activity detection for the session. Voice off events
+// are held for voiceOffHold before being sent to msgCh.
+func (s *session) InitVAD(log mlog.LoggerIFace, msgCh chan<- Message, voiceOffHold time.Duration) error {
+	debouncer := newVADDebouncer(voiceOffHold, func(voice bool) {
+		// Voice off events can be delayed past the session closing.
+		select {
+		case <-s.closeCh:
+			return
+		default:
+		}
+
+		if s.call != nil {
+			s.call.activeSpeaker.setVoice(s.cfg.SessionID, voice)
+		}
 
 		var msgType MessageType
 		if voice {
@@ -577,26 +1255,53 @@ func (s *session) InitVAD(log mlog.LoggerIFace, msgCh chan<- Message) error {
 		select {
 		case msgCh <- newMessage(s, msgType, nil):
 		default:
-			log.Error("failed to send VAD message: channel is full")
+			if s.call != nil {
+				s.call.drops.droppedMessage(s.cfg.GroupID, "receive", "vad", mlog.String("sessionID", s.cfg.SessionID))
+			}
 		}
 	})
+
+	monitor, err := vad.NewMonitor((vad.MonitorConfig{}).SetDefaults(), func(voice bool) {
+		log.Debug("vad", mlog.Bool("voice", voice), mlog.String("sessionID", s.cfg.SessionID))
+		debouncer.push(voice)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create vad monitor: %w", err)
 	}
 
 	s.mut.Lock()
 	s.vadMonitor = monitor
+	s.vadDebouncer = debouncer
 	s.mut.Unlock()
 
 	return nil
 }
 
+func (s *session) getRejectedScreenStreamID() string {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return s.rejectedScreenStreamID
+}
+
 func (s *session) clearScreenState() {
 	s.screenStreamID = ""
-	s.outScreenTracks = make(map[string][]*webrtc.TrackLocalStaticRTP)
 	s.outScreenAudioTrack = nil
+	s.clearScreenTracks()
+}
+
+// clearScreenTracks drops the screen video tracks published by the session.
+func (s *session) clearScreenTracks() {
+	s.outScreenTracks = make(map[string][]*webrtc.TrackLocalStaticRTP)
 	s.remoteScreenTracks = make(map[string]*webrtc.TrackRemote)
 	s.screenRateMonitors = make(map[string]*RateMonitor)
+	s.demotedScreenTracks = nil
+	s.screenLayerSwitch = false
+}
+
+func (s *session) clearVideoState() {
+	s.videoStreamID = ""
+	s.outVideoTrack = nil
+	s.remoteVideoTrack = nil
 }
 
 func (s *session) supportsAV1() bool {
@@ -604,13 +1309,99 @@ func (s *session) supportsAV1() bool {
 		return false
 	}
 
+	// AV1 may have been disabled on the server side at the time the session
+	// was created.
+	if !slices.Contains(s.videoCodecs, webrtc.MimeTypeAV1) {
+		return false
+	}
+
 	return s.cfg.Props.AV1Support()
 }
 
+func (s *session) supportsVP9() bool {
+	if s.cfg.Props == nil {
+		return false
+	}
+
+	// VP9 may have been disabled on the server side at the time the session
+	// was created.
+	if !slices.Contains(s.videoCodecs, webrtc.MimeTypeVP9) {
+		return false
+	}
+
+	return s.cfg.Props.VP9Support()
+}
+
 func (s *session) dcSignaling() bool {
 	if s.cfg.Props == nil {
 		return false
 	}
 
-	return s.cfg.Props.DCSignaling()
+	s.mut.RLock()
+	failed := s.dcSignalingFailed
+	s.mut.RUnlock()
+
+	return !failed && s.cfg.Props.DCSignaling()
+}
+
+// waitForDC waits for the data channel to be open, for up to timeout since the
+// session was created. It returns false if the data channel didn't open in
+// time.
+func (s *session) waitForDC(timeout time.Duration) bool {
+	select {
+	case <-s.dcOpenCh:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(time.Until(s.createdAt.Add(timeout)))
+	defer timer.Stop()
+
+	select {
+	case <-s.dcOpenCh:
+		return true
+	case <-timer.C:
+		return false
+	case <-s.closeCh:
+		// Nothing to fall back from if the session is going away.
+		return true
+	}
+}
+
+// disableDCSignaling makes any subsequent negotiation go through WebSocket.
+// It returns false if DC signaling was not in use.
+func (s *session) disableDCSignaling() bool {
+	if !s.dcSignaling() {
+		return false
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.dcSignalingFailed {
+		return false
+	}
+	s.dcSignalingFailed = true
+
+	return true
+}
+
+// e2ee returns whether the session's media payloads are end-to-end encrypted.
+// Anything that needs to read the payload (e.g. decoding or frame dropping)
+// must be skipped for such sessions.
+func (s *session) e2ee() bool {
+	if s.cfg.Props == nil {
+		return false
+	}
+
+	return s.cfg.Props.E2EE()
+}
+
+// congestionControlDisabled returns whether bandwidth estimation was skipped
+// for the session.
+func (s *session) congestionControlDisabled() bool {
+	if s.cfg.Props == nil {
+		return false
+	}
+
+	return s.cfg.Props.DisableCongestionControl()
 }
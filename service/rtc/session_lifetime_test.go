@@ -0,0 +1,140 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionGoroutinesLeak(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	initSession := setupTestPeers(t, s)
+
+	baseline := runtime.NumGoroutine()
+
+	for i := 0; i < 5; i++ {
+		groupID := random.NewID()
+		callID := random.NewID()
+		newCfg := func() SessionConfig {
+			return SessionConfig{
+				GroupID:   groupID,
+				CallID:    callID,
+				UserID:    random.NewID(),
+				SessionID: random.NewID(),
+			}
+		}
+
+		// A session that never signals.
+		idleCfg := newCfg()
+		err := s.InitSession(idleCfg, nil)
+		require.NoError(t, err)
+
+		// A receiver getting a voice track forwarded from a sender.
+		receiverCfg := newCfg()
+		receiverPC := initSession(receiverCfg)
+		trackCh := make(chan struct{})
+		receiverPC.OnTrack(func(_ *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+			close(trackCh)
+		})
+
+		senderCfg := newCfg()
+		voiceTrack, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, "voice", random.NewID())
+		require.NoError(t, err)
+		senderPC := initSession(senderCfg, voiceTrack)
+
+		var seq uint16
+		require.Eventually(t, func() bool {
+			seq++
+			_ = voiceTrack.WriteRTP(&rtp.Packet{
+				Header: rtp.Header{
+					Version:        2,
+					SequenceNumber: seq,
+					Timestamp:      uint32(seq) * 960,
+				},
+				Payload: []byte{0xf8, 0xff, 0xfe},
+			})
+			select {
+			case <-trackCh:
+				return true
+			default:
+				return false
+			}
+		}, 10*time.Second, 20*time.Millisecond)
+
+		for _, cfg := range []SessionConfig{idleCfg, receiverCfg, senderCfg} {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}
+		require.NoError(t, receiverPC.Close())
+		require.NoError(t, senderPC.Close())
+	}
+
+	// Not using require.Eventually as it runs the condition in a separate
+	// goroutine, which would skew the count.
+	deadline := time.Now().Add(10 * time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), baseline, "goroutines leaked")
+}
+
+func TestMaxSessionDuration(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.MaxSessionDurationMs = 2000
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	initSession := setupTestPeers(t, s)
+
+	cfg := SessionConfig{
+		GroupID:   random.NewID(),
+		CallID:    random.NewID(),
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+	reasonCh := make(chan CloseReason, 1)
+	pc := initSession(cfg)
+	defer pc.Close()
+
+	// Swapping the close callback since the helper doesn't set one.
+	us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+	require.NotNil(t, us)
+	us.mut.Lock()
+	us.closeCb = func(reason CloseReason) error {
+		reasonCh <- reason
+		return nil
+	}
+	us.mut.Unlock()
+
+	start := time.Now()
+	select {
+	case reason := <-reasonCh:
+		require.Equal(t, CloseReasonMaxDuration, reason)
+		require.GreaterOrEqual(t, time.Since(start), time.Second)
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "timed out waiting for session to close")
+	}
+
+	select {
+	case <-us.doneCh:
+	default:
+		require.FailNow(t, "signaling goroutines should be done")
+	}
+}
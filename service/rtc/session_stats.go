@@ -0,0 +1,63 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"time"
+)
+
+// GetSessionStats returns live statistics for the given session.
+func (s *Server) GetSessionStats(groupID, callID, sessionID string) (SessionStats, error) {
+	group := s.getGroup(groupID)
+	if group == nil {
+		return SessionStats{SessionID: sessionID}, ErrSessionNotFound
+	}
+	call := group.getCall(callID)
+	if call == nil {
+		return SessionStats{SessionID: sessionID}, ErrSessionNotFound
+	}
+	us := call.getSession(sessionID)
+	if us == nil {
+		return SessionStats{SessionID: sessionID}, ErrSessionNotFound
+	}
+
+	return us.getStats(call.getScreenSession()), nil
+}
+
+// getStats collects the session's statistics. The screen session of the call,
+// if any, is passed in so that this can be called while holding the call lock.
+func (s *session) getStats(screenSession *session) SessionStats {
+	stats := SessionStats{
+		SessionID: s.cfg.SessionID,
+		UserID:    s.cfg.UserID,
+	}
+
+	if screenSession != nil && screenSession != s {
+		stats.SimulcastLevel = s.getExpectedSimulcastLevel(screenSession.cfg.SessionID)
+	}
+
+	s.mut.RLock()
+	stats.SignalingRTTMs = float64(s.signalingRTT) / float64(time.Millisecond)
+	if s.bwEstimator != nil {
+		stats.BandwidthEstimate = s.bwEstimator.GetTargetBitrate()
+	}
+	for trackIdx, rm := range s.screenRateMonitors {
+		if rate, _ := rm.GetRate(); rate >= 0 {
+			if stats.ScreenRates == nil {
+				stats.ScreenRates = map[string]int{}
+			}
+			stats.ScreenRates[trackIdx] = rate
+		}
+	}
+	s.mut.RUnlock()
+
+	if s.stats != nil {
+		stats.PacketsReceived = s.stats.packetsReceived.Load()
+		stats.PacketsSent = s.stats.packetsSent.Load()
+		stats.NACKsSent = s.stats.nacksSent.Load()
+		stats.NACKsReceived = s.stats.nacksReceived.Load()
+	}
+
+	return stats
+}
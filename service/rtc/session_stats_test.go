@@ -0,0 +1,108 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSessionStats(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+	senderCfg := SessionConfig{
+		GroupID:   groupID,
+		CallID:    callID,
+		UserID:    random.NewID(),
+		SessionID: "sessionA",
+	}
+	receiverCfg := SessionConfig{
+		GroupID:   groupID,
+		CallID:    callID,
+		UserID:    random.NewID(),
+		SessionID: "sessionB",
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := s.GetSessionStats(random.NewID(), callID, senderCfg.SessionID)
+		require.ErrorIs(t, err, ErrSessionNotFound)
+	})
+
+	initSession := setupTestPeers(t, s)
+
+	receiverPC := initSession(receiverCfg)
+	defer receiverPC.Close()
+	defer func() {
+		err := s.CloseSession(receiverCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	t.Run("missing session", func(t *testing.T) {
+		_, err := s.GetSessionStats(groupID, random.NewID(), senderCfg.SessionID)
+		require.ErrorIs(t, err, ErrSessionNotFound)
+
+		_, err = s.GetSessionStats(groupID, callID, senderCfg.SessionID)
+		require.ErrorIs(t, err, ErrSessionNotFound)
+	})
+
+	voiceTrack, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, "voice", random.NewID())
+	require.NoError(t, err)
+	senderPC := initSession(senderCfg, voiceTrack)
+	defer senderPC.Close()
+	defer func() {
+		err := s.CloseSession(senderCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	t.Run("packet counters", func(t *testing.T) {
+		var seq uint16
+		require.Eventually(t, func() bool {
+			seq++
+			_ = voiceTrack.WriteRTP(&rtp.Packet{
+				Header: rtp.Header{
+					Version:        2,
+					SequenceNumber: seq,
+					Timestamp:      uint32(seq) * 960,
+				},
+				Payload: []byte{0xf8, 0xff, 0xfe},
+			})
+
+			receiverStats, err := s.GetSessionStats(groupID, callID, receiverCfg.SessionID)
+			require.NoError(t, err)
+			return receiverStats.PacketsSent > 0
+		}, 10*time.Second, 20*time.Millisecond)
+
+		senderStats, err := s.GetSessionStats(groupID, callID, senderCfg.SessionID)
+		require.NoError(t, err)
+		require.Equal(t, senderCfg.SessionID, senderStats.SessionID)
+		require.Equal(t, senderCfg.UserID, senderStats.UserID)
+		require.NotZero(t, senderStats.PacketsReceived)
+		require.NotZero(t, senderStats.BandwidthEstimate)
+		require.Empty(t, senderStats.SimulcastLevel)
+		require.Empty(t, senderStats.ScreenRates)
+	})
+}
+
+func TestCountNACKs(t *testing.T) {
+	require.Zero(t, countNACKs(nil))
+	require.Equal(t, uint64(2), countNACKs([]rtcp.Packet{
+		&rtcp.ReceiverReport{},
+		&rtcp.TransportLayerNack{},
+		&rtcp.PictureLossIndication{},
+		&rtcp.TransportLayerNack{},
+	}))
+}
@@ -4,10 +4,17 @@
 package rtc
 
 import (
+	"encoding/json"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4"
 	"github.com/stretchr/testify/require"
 )
@@ -52,7 +59,7 @@ func TestAddSession(t *testing.T) {
 
 		close(us.doneCh)
 
-		err = server.CloseSession(cfg.SessionID)
+		err = server.CloseSession(cfg.SessionID, CloseReasonLeft)
 		require.NoError(t, err)
 	})
 
@@ -68,13 +75,13 @@ func TestAddSession(t *testing.T) {
 		require.NoError(t, err)
 
 		cbError := errors.New("closeCb failed")
-		closeCbError := func() error {
+		closeCbError := func(_ CloseReason) error {
 			return cbError
 		}
 
-		var cbCalled bool
-		closeCbSuccess := func() error {
-			cbCalled = true
+		var cbReason CloseReason
+		closeCbSuccess := func(reason CloseReason) error {
+			cbReason = reason
 			return nil
 		}
 
@@ -84,7 +91,7 @@ func TestAddSession(t *testing.T) {
 
 		close(us.doneCh)
 
-		err = server.CloseSession(cfg.SessionID)
+		err = server.CloseSession(cfg.SessionID, CloseReasonLeft)
 		require.Error(t, err)
 		require.Equal(t, cbError, err)
 
@@ -94,9 +101,9 @@ func TestAddSession(t *testing.T) {
 
 		close(us.doneCh)
 
-		err = server.CloseSession(cfg.SessionID)
+		err = server.CloseSession(cfg.SessionID, CloseReasonKicked)
 		require.NoError(t, err)
-		require.True(t, cbCalled)
+		require.Equal(t, CloseReasonKicked, cbReason)
 	})
 }
 
@@ -126,9 +133,461 @@ func TestCloseSessionConcurrent(t *testing.T) {
 	for i := 0; i < n; i++ {
 		go func() {
 			defer wg.Done()
-			err := server.CloseSession(cfg.SessionID)
+			err := server.CloseSession(cfg.SessionID, CloseReasonLeft)
 			require.Nil(t, err)
 		}()
 	}
 	wg.Wait()
 }
+
+func TestSessionPreferredSimulcastLevel(t *testing.T) {
+	var s session
+
+	require.Error(t, s.setPreferredSimulcastLevel("invalid"))
+	require.Equal(t, SimulcastLevelHigh, s.capSimulcastLevel(SimulcastLevelHigh, ""))
+
+	require.NoError(t, s.setPreferredSimulcastLevel(SimulcastLevelLow))
+	require.Equal(t, SimulcastLevelLow, s.capSimulcastLevel(SimulcastLevelHigh, ""))
+	require.Equal(t, SimulcastLevelLow, s.capSimulcastLevel(SimulcastLevelLow, ""))
+
+	require.NoError(t, s.setPreferredSimulcastLevel(SimulcastLevelMid))
+	require.Equal(t, SimulcastLevelMid, s.capSimulcastLevel(SimulcastLevelHigh, ""))
+	require.Equal(t, SimulcastLevelMid, s.capSimulcastLevel(SimulcastLevelMid, ""))
+	require.Equal(t, SimulcastLevelLow, s.capSimulcastLevel(SimulcastLevelLow, ""))
+
+	require.NoError(t, s.setPreferredSimulcastLevel(SimulcastLevelHigh))
+	require.Equal(t, SimulcastLevelHigh, s.capSimulcastLevel(SimulcastLevelHigh, ""))
+}
+
+func TestSessionSourceSimulcastLevel(t *testing.T) {
+	var s session
+
+	require.Error(t, s.setSourceSimulcastLevel("", SimulcastLevelLow))
+	require.Error(t, s.setSourceSimulcastLevel("sessionA", "invalid"))
+
+	require.NoError(t, s.setSourceSimulcastLevel("sessionA", SimulcastLevelLow))
+	require.NoError(t, s.setSourceSimulcastLevel("sessionB", SimulcastLevelHigh))
+
+	require.Equal(t, SimulcastLevelLow, s.capSimulcastLevel(SimulcastLevelHigh, "sessionA"))
+	require.Equal(t, SimulcastLevelHigh, s.capSimulcastLevel(SimulcastLevelHigh, "sessionB"))
+	require.Equal(t, SimulcastLevelLow, s.capSimulcastLevel(SimulcastLevelLow, "sessionB"))
+	require.Equal(t, SimulcastLevelHigh, s.capSimulcastLevel(SimulcastLevelHigh, "sessionC"))
+
+	// Source preferences take precedence over the session wide one.
+	require.NoError(t, s.setPreferredSimulcastLevel(SimulcastLevelLow))
+	require.Equal(t, SimulcastLevelHigh, s.capSimulcastLevel(SimulcastLevelHigh, "sessionB"))
+	require.Equal(t, SimulcastLevelLow, s.capSimulcastLevel(SimulcastLevelHigh, "sessionC"))
+}
+
+func TestHandleVoiceReceiverReport(t *testing.T) {
+	server, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := server.Start()
+	require.NoError(t, err)
+
+	setupCall := func(t *testing.T, enabled bool) (*session, *session) {
+		t.Helper()
+
+		server.cfg.EnableAudioPLCHint = enabled
+		defer func() { server.cfg.EnableAudioPLCHint = false }()
+
+		groupID := random.NewID()
+		callID := random.NewID()
+		var sessions []*session
+		for i := 0; i < 2; i++ {
+			cfg := SessionConfig{
+				GroupID:   groupID,
+				CallID:    callID,
+				UserID:    random.NewID(),
+				SessionID: random.NewID(),
+			}
+			err := server.InitSession(cfg, nil)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				err := server.CloseSession(cfg.SessionID, CloseReasonLeft)
+				require.NoError(t, err)
+			})
+			sessions = append(sessions, server.getGroup(groupID).getCall(callID).getSession(cfg.SessionID))
+		}
+
+		return sessions[0], sessions[1]
+	}
+
+	newReport := func(fractionLost uint8) *rtcp.ReceiverReport {
+		return &rtcp.ReceiverReport{
+			Reports: []rtcp.ReceptionReport{{FractionLost: fractionLost}},
+		}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		sender, receiver := setupCall(t, false)
+		receiver.handleVoiceReceiverReport(genTrackID(trackTypeVoice, sender.cfg.SessionID, 0), newReport(128))
+		require.Empty(t, sender.dcPLCHintCh)
+	})
+
+	t.Run("low loss", func(t *testing.T) {
+		sender, receiver := setupCall(t, true)
+		receiver.handleVoiceReceiverReport(genTrackID(trackTypeVoice, sender.cfg.SessionID, 0), newReport(10))
+		require.Empty(t, sender.dcPLCHintCh)
+	})
+
+	t.Run("non voice track", func(t *testing.T) {
+		sender, receiver := setupCall(t, true)
+		receiver.handleVoiceReceiverReport(genTrackID(trackTypeScreenAudio, sender.cfg.SessionID, 0), newReport(128))
+		require.Empty(t, sender.dcPLCHintCh)
+	})
+
+	t.Run("high loss", func(t *testing.T) {
+		sender, receiver := setupCall(t, true)
+		receiver.handleVoiceReceiverReport(genTrackID(trackTypeVoice, sender.cfg.SessionID, 0), newReport(128))
+		require.Len(t, sender.dcPLCHintCh, 1)
+		require.Equal(t, 0.5, <-sender.dcPLCHintCh)
+
+		// Hints are rate limited.
+		receiver.handleVoiceReceiverReport(genTrackID(trackTypeVoice, sender.cfg.SessionID, 0), newReport(128))
+		require.Empty(t, sender.dcPLCHintCh)
+	})
+}
+
+func TestPLIMaxInterval(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.PLIMaxIntervalMs = 200
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+	newCfg := func() SessionConfig {
+		return SessionConfig{
+			GroupID:   groupID,
+			CallID:    callID,
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+	}
+
+	initSession := setupTestPeers(t, s)
+
+	receiverCfg := newCfg()
+	receiverPC := initSession(receiverCfg)
+	defer receiverPC.Close()
+	defer func() {
+		err := s.CloseSession(receiverCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+	remoteTrackCh := make(chan *webrtc.TrackRemote, 1)
+	receiverPC.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		remoteTrackCh <- track
+		for {
+			if _, _, err := track.ReadRTP(); err != nil {
+				return
+			}
+		}
+	})
+
+	publisherCfg := newCfg()
+	screenTrack, err := webrtc.NewTrackLocalStaticRTP(rtpVideoCodecs[webrtc.MimeTypeVP8].RTPCodecCapability, "screen", "screenStream")
+	require.NoError(t, err)
+	publisherPC := initSession(publisherCfg, screenTrack)
+	defer publisherPC.Close()
+	defer func() {
+		err := s.CloseSession(publisherCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	data, err := json.Marshal(map[string]string{"screenStreamID": "screenStream"})
+	require.NoError(t, err)
+	err = s.Send(Message{
+		GroupID:   publisherCfg.GroupID,
+		CallID:    publisherCfg.CallID,
+		UserID:    publisherCfg.UserID,
+		SessionID: publisherCfg.SessionID,
+		Type:      ScreenOnMessage,
+		Data:      data,
+	})
+	require.NoError(t, err)
+
+	var plis atomic.Int64
+	go func() {
+		sender := publisherPC.GetSenders()[0]
+		for {
+			pkts, _, err := sender.ReadRTCP()
+			if err != nil {
+				return
+			}
+			for _, pkt := range pkts {
+				if _, ok := pkt.(*rtcp.PictureLossIndication); ok {
+					plis.Add(1)
+				}
+			}
+		}
+	}()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go func() {
+		ticker := time.NewTicker(30 * time.Millisecond)
+		defer ticker.Stop()
+		var seq uint16
+		for {
+			select {
+			case <-ticker.C:
+				seq++
+				_ = screenTrack.WriteRTP(&rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						SequenceNumber: seq,
+						Timestamp:      uint32(seq) * 3000,
+					},
+					Payload: []byte{0x10, 0x00, 0x00, 0x00},
+				})
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	var remoteTrack *webrtc.TrackRemote
+	select {
+	case remoteTrack = <-remoteTrackCh:
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "timed out waiting for screen track")
+	}
+
+	// Waiting for any PLI sent while setting up to be accounted.
+	time.Sleep(500 * time.Millisecond)
+	before := plis.Load()
+
+	// The receiver requests a keyframe every 20ms for two seconds, which
+	// should result in about one forwarded request every 200ms.
+	start := time.Now()
+	for time.Since(start) < 2*time.Second {
+		err := receiverPC.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(remoteTrack.SSRC())}})
+		require.NoError(t, err)
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	forwarded := plis.Load() - before
+	require.GreaterOrEqual(t, forwarded, int64(8))
+	require.LessOrEqual(t, forwarded, int64(12))
+
+	// RTCP received while the track is unset is ignored.
+	us := s.getGroup(groupID).getCall(callID).getSession(receiverCfg.SessionID)
+	require.NotNil(t, us)
+	us.mut.RLock()
+	sender := us.screenTrackSender
+	us.mut.RUnlock()
+	require.NotNil(t, sender)
+	outTrack := sender.Track()
+	err = sender.ReplaceTrack(nil)
+	require.NoError(t, err)
+	time.Sleep(300 * time.Millisecond)
+	before = plis.Load()
+	for i := 0; i < 5; i++ {
+		err := receiverPC.WriteRTCP([]rtcp.Packet{
+			&rtcp.PictureLossIndication{MediaSSRC: uint32(remoteTrack.SSRC())},
+			&rtcp.ReceiverReport{},
+		})
+		require.NoError(t, err)
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, before, plis.Load())
+
+	// Requests are forwarded again once it's set back.
+	err = sender.ReplaceTrack(outTrack)
+	require.NoError(t, err)
+	time.Sleep(300 * time.Millisecond)
+	err = receiverPC.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(remoteTrack.SSRC())}})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return plis.Load() > before
+	}, time.Second, 20*time.Millisecond)
+}
+
+func TestReplaceScreenTrack(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+	newCfg := func() SessionConfig {
+		return SessionConfig{
+			GroupID:   groupID,
+			CallID:    callID,
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+	}
+
+	initSession := setupTestPeers(t, s)
+
+	receiverCfg := newCfg()
+	receiverPC := initSession(receiverCfg)
+	defer receiverPC.Close()
+	defer func() {
+		err := s.CloseSession(receiverCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+	remoteTrackCh := make(chan *webrtc.TrackRemote, 2)
+	payloadCh := make(chan byte, 256)
+	receiverPC.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		remoteTrackCh <- track
+		for {
+			pkt, _, err := track.ReadRTP()
+			if err != nil {
+				return
+			}
+			select {
+			case payloadCh <- pkt.Payload[len(pkt.Payload)-1]:
+			default:
+			}
+		}
+	})
+
+	publisherCfg := newCfg()
+	screenTrack, err := webrtc.NewTrackLocalStaticRTP(rtpVideoCodecs[webrtc.MimeTypeVP8].RTPCodecCapability, "screen", "screenStream")
+	require.NoError(t, err)
+	publisherPC := initSession(publisherCfg, screenTrack)
+	defer publisherPC.Close()
+	defer func() {
+		err := s.CloseSession(publisherCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	data, err := json.Marshal(map[string]string{"screenStreamID": "screenStream"})
+	require.NoError(t, err)
+	err = s.Send(Message{
+		GroupID:   publisherCfg.GroupID,
+		CallID:    publisherCfg.CallID,
+		UserID:    publisherCfg.UserID,
+		SessionID: publisherCfg.SessionID,
+		Type:      ScreenOnMessage,
+		Data:      data,
+	})
+	require.NoError(t, err)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go func() {
+		ticker := time.NewTicker(30 * time.Millisecond)
+		defer ticker.Stop()
+		var seq uint16
+		for {
+			select {
+			case <-ticker.C:
+				seq++
+				_ = screenTrack.WriteRTP(&rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						SequenceNumber: seq,
+						Timestamp:      uint32(seq) * 3000,
+					},
+					Payload: []byte{0x10, 0x00, 0x00, 0x00},
+				})
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-remoteTrackCh:
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "timed out waiting for screen track")
+	}
+
+	us := s.getGroup(groupID).getCall(callID).getSession(receiverCfg.SessionID)
+	require.NotNil(t, us)
+
+	var sender *webrtc.RTPSender
+	require.Eventually(t, func() bool {
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		sender = us.screenTrackSender
+		return sender != nil
+	}, 5*time.Second, 50*time.Millisecond)
+	oldTrack := sender.Track()
+	require.NotNil(t, oldTrack)
+	numTransceivers := len(receiverPC.GetTransceivers())
+
+	newTrack, err := webrtc.NewTrackLocalStaticRTP(rtpVideoCodecs[webrtc.MimeTypeVP8].RTPCodecCapability,
+		genTrackID(trackTypeScreen, publisherCfg.SessionID, 0), random.NewID())
+	require.NoError(t, err)
+
+	t.Run("not a screen track", func(t *testing.T) {
+		voiceTrack, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec,
+			genTrackID(trackTypeVoice, publisherCfg.SessionID, 0), random.NewID())
+		require.NoError(t, err)
+		_, err = us.replaceScreenTrack(voiceTrack)
+		require.EqualError(t, err, "track "+voiceTrack.ID()+" is not a screen track")
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		us.tracksCh <- trackActionContext{action: trackActionAdd, track: newTrack, replace: true}
+
+		require.Eventually(t, func() bool {
+			return sender.Track() == newTrack
+		}, 5*time.Second, 50*time.Millisecond)
+
+		us.mut.RLock()
+		require.Equal(t, newTrack, us.screenTrackSender.Track())
+		require.Nil(t, us.rxTracks[oldTrack.ID()])
+		require.Equal(t, newTrack, us.rxTracks[newTrack.ID()])
+		us.mut.RUnlock()
+
+		// Packets written to the new track flow through the existing
+		// receiver.
+		go func() {
+			for i := 1; i <= 50; i++ {
+				_ = newTrack.WriteRTP(&rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						SequenceNumber: uint16(i),
+						Timestamp:      uint32(i) * 3000,
+					},
+					Payload: []byte{0x10, 0x00, 0x00, 0x01},
+				})
+				time.Sleep(20 * time.Millisecond)
+			}
+		}()
+
+		require.Eventually(t, func() bool {
+			for {
+				select {
+				case b := <-payloadCh:
+					if b == 0x01 {
+						return true
+					}
+				default:
+					return false
+				}
+			}
+		}, 5*time.Second, 50*time.Millisecond)
+
+		// No renegotiation should have happened.
+		select {
+		case <-remoteTrackCh:
+			require.Fail(t, "unexpected track")
+		default:
+		}
+		require.Len(t, receiverPC.GetTransceivers(), numTransceivers)
+	})
+
+	t.Run("nothing to replace", func(t *testing.T) {
+		us.mut.Lock()
+		us.screenTrackSender = nil
+		us.mut.Unlock()
+
+		_, err := us.replaceScreenTrack(newTrack)
+		require.ErrorIs(t, err, errNoScreenTrackSender)
+	})
+}
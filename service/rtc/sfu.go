@@ -4,11 +4,14 @@
 package rtc
 
 import (
+	crand "crypto/rand"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"runtime"
+	"slices"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -25,6 +28,7 @@ import (
 	"github.com/pion/interceptor/pkg/nack"
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/rtcerr"
 )
 
 var (
@@ -61,6 +65,28 @@ var (
 			PayloadType: 45,
 		},
 	}
+	// rtpExperimentalVideoCodecs can only be negotiated if explicitly enabled
+	// through ServerConfig.Experimental.
+	rtpExperimentalVideoCodecs = map[string]webrtc.RTPCodecParameters{
+		webrtc.MimeTypeVP9: {
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:     webrtc.MimeTypeVP9,
+				ClockRate:    90000,
+				SDPFmtpLine:  "profile-id=0",
+				RTCPFeedback: videoRTCPFeedback,
+			},
+			PayloadType: 98,
+		},
+		webrtc.MimeTypeH264: {
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:     webrtc.MimeTypeH264,
+				ClockRate:    90000,
+				SDPFmtpLine:  "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+				RTCPFeedback: videoRTCPFeedback,
+			},
+			PayloadType: 102,
+		},
+	}
 	rtpVideoExtensions = []string{
 		"urn:ietf:params:rtp-hdrext:sdes:mid",
 		"urn:ietf:params:rtp-hdrext:sdes:rtp-stream-id",
@@ -72,7 +98,22 @@ const (
 	nackResponderBufferSize    = 256
 	audioLevelExtensionURI     = "urn:ietf:params:rtp-hdrext:ssrc-audio-level"
 	writerQueueSize            = 200 // Enough to hold up to one second of video packets.
+	sessionInitQueueTimeout    = 2 * time.Second
+	peerConnRetryInterval      = 100 * time.Millisecond
+	iceDisconnectedTimeout     = 5 * time.Second
+	iceFailedTimeout           = 25 * time.Second
 	ScreenTrackMimeTypeDefault = webrtc.MimeTypeVP8
+	// av1DependencyDescriptorURI is the header extension carrying the
+	// information needed to forward scalable AV1 streams.
+	av1DependencyDescriptorURI = "https://aomediacodec.github.io/av1-rtp-spec/#dependency-descriptor-rtp-header-extension"
+	// frameMarkingURI is the header extension exposing frame level
+	// information (e.g. keyframes) independently of the video codec.
+	frameMarkingURI = "urn:ietf:params:rtp-hdrext:framemarking"
+	// opusFrameSamples is the RTP timestamp increment of a 20ms Opus frame.
+	opusFrameSamples = 960
+	// opusMaxPacketSamples is the RTP timestamp increment of the longest
+	// (120ms) Opus packet.
+	opusMaxPacketSamples = 5760
 )
 
 func (s *Server) initSettingEngine() (webrtc.SettingEngine, error) {
@@ -85,19 +126,40 @@ func (s *Server) initSettingEngine() (webrtc.SettingEngine, error) {
 		webrtc.NetworkTypeUDP4,
 		webrtc.NetworkTypeTCP4,
 	}
-	if s.cfg.EnableIPv6 {
+	if s.cfg.IPv6Only {
+		networkTypes = []webrtc.NetworkType{
+			webrtc.NetworkTypeUDP6,
+			webrtc.NetworkTypeTCP6,
+		}
+	} else if s.cfg.EnableIPv6 {
 		networkTypes = append(networkTypes, webrtc.NetworkTypeUDP6, webrtc.NetworkTypeTCP6)
 	}
 	sEngine.SetNetworkTypes(networkTypes)
 	sEngine.SetICEUDPMux(s.udpMux)
 	sEngine.SetICETCPMux(s.tcpMux)
 	sEngine.SetIncludeLoopbackCandidate(true)
+	if s.cfg.ICEKeepaliveIntervalMs > 0 {
+		// Disconnected and failed timeouts are set to the library defaults.
+		sEngine.SetICETimeouts(iceDisconnectedTimeout, iceFailedTimeout,
+			time.Duration(s.cfg.ICEKeepaliveIntervalMs)*time.Millisecond)
+	}
+	if s.cfg.ICEUfragLength > 0 || s.cfg.ICEPwdLength > 0 {
+		ufrag, err := newICECredential(s.cfg.ICEUfragLength, iceUfragDefaultLength)
+		if err != nil {
+			return webrtc.SettingEngine{}, fmt.Errorf("failed to generate ICE ufrag: %w", err)
+		}
+		pwd, err := newICECredential(s.cfg.ICEPwdLength, icePwdDefaultLength)
+		if err != nil {
+			return webrtc.SettingEngine{}, fmt.Errorf("failed to generate ICE pwd: %w", err)
+		}
+		sEngine.SetICECredentials(ufrag, pwd)
+	}
 	if os.Getenv("RTCD_RTC_DTLS_INSECURE_SKIP_HELLOVERIFY") == "true" {
 		s.log.Warn("RTCD_RTC_DTLS_INSECURE_SKIP_HELLOVERIFY is set, will skip hello verify phase")
 		sEngine.SetDTLSInsecureSkipHelloVerify(true)
 	}
 
-	pairs, err := generateAddrsPairs(s.localIPs, s.publicAddrsMap, s.cfg.ICEHostOverride, s.cfg.EnableIPv6)
+	pairs, err := generateAddrsPairs(s.localIPs, s.getPublicAddrsMap(), s.cfg.ICEHostOverride, s.cfg.EnableIPv6)
 	if err != nil {
 		return webrtc.SettingEngine{}, fmt.Errorf("failed to generate addresses pairs: %w", err)
 	} else if len(pairs) > 0 {
@@ -108,15 +170,64 @@ func (s *Server) initSettingEngine() (webrtc.SettingEngine, error) {
 	return sEngine, nil
 }
 
-func initMediaEngine() (*webrtc.MediaEngine, error) {
+const (
+	iceUfragDefaultLength = 16
+	icePwdDefaultLength   = 32
+	// iceCharset holds the characters allowed in ICE credentials (ice-char).
+	iceCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+// newICECredential returns a random ICE credential of the given length,
+// falling back to defaultLength if zero.
+func newICECredential(length, defaultLength int) (string, error) {
+	if length == 0 {
+		length = defaultLength
+	}
+	data := make([]byte, length)
+	if _, err := crand.Read(data); err != nil {
+		return "", err
+	}
+	// The charset size evenly divides 256 so there's no modulo bias.
+	for i := range data {
+		data[i] = iceCharset[int(data[i])%len(iceCharset)]
+	}
+	return string(data), nil
+}
+
+// getAudioCodec returns the audio codec capability to negotiate, optionally
+// signaling support for Opus discontinuous transmission (DTX).
+func getAudioCodec(opusDTX bool) webrtc.RTPCodecCapability {
+	codec := rtpAudioCodec
+	if opusDTX {
+		codec.SDPFmtpLine += ";usedtx=1"
+	}
+	return codec
+}
+
+// getDTXSilenceFrames returns the number of Opus frames the sender skipped
+// through DTX between two consecutive audio packets, given their RTP
+// timestamps. Gaps that fit a single packet (up to 120ms) are not counted.
+func getDTXSilenceFrames(prevTS, ts uint32) int {
+	gap := ts - prevTS
+	// Out of order packet.
+	if gap > math.MaxInt32 {
+		return 0
+	}
+	if gap <= opusMaxPacketSamples {
+		return 0
+	}
+	return int(gap/opusFrameSamples) - 1
+}
+
+func initMediaEngine(audioCodec webrtc.RTPCodecCapability, videoCodecs []webrtc.RTPCodecParameters, videoExtensions []string) (*webrtc.MediaEngine, error) {
 	var m webrtc.MediaEngine
 	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
-		RTPCodecCapability: rtpAudioCodec,
+		RTPCodecCapability: audioCodec,
 		PayloadType:        111,
 	}, webrtc.RTPCodecTypeAudio); err != nil {
 		return nil, err
 	}
-	for _, params := range rtpVideoCodecs {
+	for _, params := range videoCodecs {
 		if err := m.RegisterCodec(params, webrtc.RTPCodecTypeVideo); err != nil {
 			return nil, err
 		}
@@ -128,7 +239,7 @@ func initMediaEngine() (*webrtc.MediaEngine, error) {
 		return nil, fmt.Errorf("failed to register header extension: %w", err)
 	}
 
-	for _, ext := range rtpVideoExtensions {
+	for _, ext := range videoExtensions {
 		if err := m.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: ext}, webrtc.RTPCodecTypeVideo); err != nil {
 			return nil, fmt.Errorf("failed to register header extension: %w", err)
 		}
@@ -137,8 +248,19 @@ func initMediaEngine() (*webrtc.MediaEngine, error) {
 	return &m, nil
 }
 
-func initInterceptors(m *webrtc.MediaEngine) (*interceptor.Registry, <-chan cc.BandwidthEstimator, error) {
+// initInterceptors builds the interceptors for a session. The given pacer is
+// used for outbound packets if not nil. If congestionControl is false no
+// bandwidth estimation (TWCC, GCC) interceptors are added and the returned
+// channel is nil.
+func initInterceptors(m *webrtc.MediaEngine, rtcpCompound, stats interceptor.Factory, pacer gcc.Pacer, congestionControl bool) (*interceptor.Registry, <-chan cc.BandwidthEstimator, error) {
 	var i interceptor.Registry
+
+	// This needs to come first so that RTCP packets generated by any of the
+	// following interceptors go through it.
+	i.Add(rtcpCompound)
+	// Stats are collected next so that NACKs and retransmissions from the
+	// following interceptors are accounted for.
+	i.Add(stats)
 	generator, err := nack.NewGeneratorInterceptor()
 	if err != nil {
 		return nil, nil, err
@@ -159,6 +281,10 @@ func initInterceptors(m *webrtc.MediaEngine) (*interceptor.Registry, <-chan cc.B
 		return nil, nil, err
 	}
 
+	if !congestionControl {
+		return &i, nil, nil
+	}
+
 	// TWCC
 	if err := webrtc.ConfigureTWCCSender(m, &i); err != nil {
 		return nil, nil, err
@@ -167,7 +293,9 @@ func initInterceptors(m *webrtc.MediaEngine) (*interceptor.Registry, <-chan cc.B
 	// Congestion Control
 	minRate := int(float32(getRateForSimulcastLevel(SimulcastLevelLow)) * 0.5)
 	maxRate := int(float32(getRateForSimulcastLevel(SimulcastLevelHigh)) * 1.5)
-	pacer := gcc.NewNoOpPacer()
+	if pacer == nil {
+		pacer = gcc.NewNoOpPacer()
+	}
 	bwEstimatorCh := make(chan cc.BandwidthEstimator, 1)
 	congestionController, err := cc.NewInterceptor(func() (cc.BandwidthEstimator, error) {
 		return gcc.NewSendSideBWE(
@@ -191,22 +319,23 @@ func initInterceptors(m *webrtc.MediaEngine) (*interceptor.Registry, <-chan cc.B
 	return &i, bwEstimatorCh, nil
 }
 
-func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
-	if err := cfg.IsValid(); err != nil {
-		return fmt.Errorf("invalid session config: %w", err)
-	}
-
-	s.metrics.IncRTCSessions(cfg.GroupID)
-
-	iceServers := make([]webrtc.ICEServer, 0, len(s.cfg.ICEServers))
-	for _, iceCfg := range s.cfg.ICEServers {
+// getICEServers returns the ICE servers configuration to be used by the given
+// session, generating short-lived TURN credentials if needed.
+func (s *Server) getICEServers(sessionID string) []webrtc.ICEServer {
+	iceServersCfg, turnCfg := s.getICEConfig()
+	iceServers := make([]webrtc.ICEServer, 0, len(iceServersCfg))
+	advertiseTURN := s.cfg.TURNAdvertisePolicy != TURNAdvertisePolicyNATOnly || s.isBehindNAT()
+	for _, iceCfg := range iceServersCfg {
+		if iceCfg.IsTURN() && !advertiseTURN {
+			continue
+		}
 		// generating short-lived TURN credentials if needed.
-		if iceCfg.IsTURN() && s.cfg.TURNConfig.StaticAuthSecret == "" {
+		if iceCfg.IsTURN() && turnCfg.StaticAuthSecret == "" {
 			continue
 		}
 		if iceCfg.IsTURN() && iceCfg.Username == "" && iceCfg.Credential == "" {
-			ts := time.Now().Add(time.Duration(s.cfg.TURNConfig.CredentialsExpirationMinutes) * time.Minute).Unix()
-			username, password, err := genTURNCredentials(cfg.SessionID, s.cfg.TURNConfig.StaticAuthSecret, ts)
+			ts := time.Now().Add(time.Duration(turnCfg.CredentialsExpirationMinutes) * time.Minute).Unix()
+			username, password, err := genTURNCredentials(sessionID, turnCfg.StaticAuthSecret, ts)
 			if err != nil {
 				s.log.Error("failed to generate TURN credentials", mlog.Err(err))
 				continue
@@ -215,38 +344,168 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 			iceCfg.Credential = password
 		}
 		iceServers = append(iceServers, webrtc.ICEServer{
-			URLs:       iceCfg.URLs,
+			URLs:       iceCfg.GetURLs(),
 			Username:   iceCfg.Username,
 			Credential: iceCfg.Credential,
 		})
 	}
 
-	peerConnConfig := webrtc.Configuration{
-		ICEServers:   iceServers,
-		SDPSemantics: webrtc.SDPSemanticsUnifiedPlan,
+	return iceServers
+}
+
+// hasTURNServer returns whether any of the given ICE servers is a TURN one.
+func hasTURNServer(iceServers []webrtc.ICEServer) bool {
+	for _, iceServer := range iceServers {
+		if (ICEServerConfig{URLs: iceServer.URLs}).IsTURN() {
+			return true
+		}
 	}
+	return false
+}
 
-	mEngine, err := initMediaEngine()
-	if err != nil {
-		return fmt.Errorf("failed to init media engine: %w", err)
+// acquireInitSlot waits for a session initialization slot to be available,
+// giving up after sessionInitQueueTimeout.
+func (s *Server) acquireInitSlot() error {
+	select {
+	case s.initSem <- struct{}{}:
+		return nil
+	default:
 	}
 
-	iRegistry, bwEstimatorCh, err := initInterceptors(mEngine)
-	if err != nil {
-		return fmt.Errorf("failed to init interceptors: %w", err)
+	s.metrics.IncRTCSessionInitsQueued()
+	defer s.metrics.DecRTCSessionInitsQueued()
+
+	timer := time.NewTimer(sessionInitQueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case s.initSem <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrSessionInitTimeout
+	}
+}
+
+// isRetryablePeerConnError returns whether a peer connection creation that
+// failed with the given error is worth retrying. Configuration errors (e.g.
+// invalid ICE servers or certificates) would fail again regardless.
+func isRetryablePeerConnError(err error) bool {
+	var (
+		accessErr       *rtcerr.InvalidAccessError
+		modificationErr *rtcerr.InvalidModificationError
+		stateErr        *rtcerr.InvalidStateError
+		syntaxErr       *rtcerr.SyntaxError
+		typeErr         *rtcerr.TypeError
+		notSupportedErr *rtcerr.NotSupportedError
+	)
+	return !errors.As(err, &accessErr) &&
+		!errors.As(err, &modificationErr) &&
+		!errors.As(err, &stateErr) &&
+		!errors.As(err, &syntaxErr) &&
+		!errors.As(err, &typeErr) &&
+		!errors.As(err, &notSupportedErr)
+}
+
+// createPeerConnection creates the peer connection for the given session out
+// of sa, returning the session API it was eventually created with. Transient
+// failures are retried up to ServerConfig.PeerConnectionRetries times, each
+// with a newly built session API since the failed one may be left in an
+// unusable state.
+func (s *Server) createPeerConnection(cfg SessionConfig, sa *sessionAPI, peerConnConfig webrtc.Configuration) (*webrtc.PeerConnection, *sessionAPI, error) {
+	for attempt := 0; ; attempt++ {
+		// Safe to set as no RTCP can be sent before the peer connection exists.
+		sa.rtcpCompound.cname = cfg.SessionID
+		peerConnConfig.Certificates = []webrtc.Certificate{sa.certificate}
+
+		peerConn, err := s.newPeerConnection(sa.api, peerConnConfig)
+		if err == nil {
+			return peerConn, sa, nil
+		}
+
+		if attempt >= s.cfg.PeerConnectionRetries || !isRetryablePeerConnError(err) {
+			return nil, nil, err
+		}
+
+		s.log.Warn("failed to create peer connection, retrying",
+			mlog.Err(err),
+			mlog.String("sessionID", cfg.SessionID),
+			mlog.Int("attempt", attempt+1))
+		s.metrics.IncRTCPeerConnRetries(cfg.GroupID)
+		time.Sleep(peerConnRetryInterval)
+
+		sa, err = s.newSessionAPI(sa.videoCodecs, sa.opusDTX, sa.congestionControl)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get session api: %w", err)
+		}
+	}
+}
+
+func (s *Server) InitSession(cfg SessionConfig, closeCb func(reason CloseReason) error) error {
+	if err := cfg.IsValid(); err != nil {
+		return fmt.Errorf("invalid session config: %w", err)
+	}
+
+	if s.sessionIDValidator != nil {
+		if err := s.sessionIDValidator(cfg.SessionID); err != nil {
+			return fmt.Errorf("invalid session config: invalid SessionID value: %w", err)
+		}
 	}
 
-	sEngine, err := s.initSettingEngine()
+	if s.cfg.RequireChannelID && cfg.Props.ChannelID() == "" {
+		return fmt.Errorf("invalid session config: %w", ErrMissingChannelID)
+	}
+
+	if !s.cfg.AllowE2EE && cfg.Props.E2EE() {
+		return fmt.Errorf("invalid session config: %w", ErrE2EENotAllowed)
+	}
+
+	if err := checkClientVersion(s.cfg.MinClientVersion, cfg.Props.Version()); err != nil {
+		return fmt.Errorf("invalid session config: %w", err)
+	}
+
+	if g := s.getGroup(cfg.GroupID); g != nil {
+		if c := g.getCall(cfg.CallID); c != nil && c.isDraining() {
+			return fmt.Errorf("failed to add session: %w", ErrCallDraining)
+		} else if c != nil && c.isFull() {
+			s.metrics.IncRTCErrors(cfg.GroupID, "call_full")
+			return fmt.Errorf("failed to add session: %w", ErrCallFull)
+		}
+	}
+
+	if s.isOverloaded() {
+		s.metrics.IncRTCErrors(cfg.GroupID, "overloaded")
+		return fmt.Errorf("failed to add session: %w", ErrServerOverloaded)
+	}
+
+	if s.initSem != nil {
+		if err := s.acquireInitSlot(); err != nil {
+			return err
+		}
+		defer func() { <-s.initSem }()
+	}
+
+	iceServersIssuedAt := time.Now()
+	iceServers := s.getICEServers(cfg.SessionID)
+	if cfg.Props.RelayOnly() && !hasTURNServer(iceServers) {
+		return fmt.Errorf("invalid session config: %w", ErrRelayUnavailable)
+	}
+
+	// Clients that don't understand DTX keep getting the plain fmtp line.
+	opusDTX := s.cfg.EnableOpusDTX && cfg.Props.OpusDTXSupport()
+	sa, err := s.getSessionAPI(opusDTX, !cfg.Props.DisableCongestionControl())
 	if err != nil {
-		return fmt.Errorf("failed to init setting engine: %w", err)
+		return fmt.Errorf("failed to get session api: %w", err)
 	}
 
-	api := webrtc.NewAPI(
-		webrtc.WithMediaEngine(mEngine),
-		webrtc.WithSettingEngine(sEngine),
-		webrtc.WithInterceptorRegistry(iRegistry),
-	)
-	peerConn, err := api.NewPeerConnection(peerConnConfig)
+	peerConnConfig := webrtc.Configuration{
+		ICEServers:   iceServers,
+		SDPSemantics: webrtc.SDPSemanticsUnifiedPlan,
+	}
+	if cfg.Props.RelayOnly() {
+		peerConnConfig.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	}
+
+	peerConn, sa, err := s.createPeerConnection(cfg, sa, peerConnConfig)
 	if err != nil {
 		return fmt.Errorf("failed to create peer connection: %w", err)
 	}
@@ -254,12 +513,31 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 	us, err := s.addSession(cfg, peerConn, closeCb)
 	if err != nil {
 		// TODO: handle case session exists
+		peerConn.Close()
+		// The call may have filled up since the check above.
+		if errors.Is(err, ErrCallFull) {
+			s.metrics.IncRTCErrors(cfg.GroupID, "call_full")
+		}
 		return fmt.Errorf("failed to add session: %w", err)
 	}
+	us.rtcpCompound = sa.rtcpCompound
+	us.stats = sa.stats
+	generatesTURNCredentials := s.generatesTURNCredentials()
+	us.mut.Lock()
+	us.videoCodecs = sa.videoCodecs
+	us.opusDTX = sa.opusDTX
+	if generatesTURNCredentials {
+		us.turnCredentialsIssuedAt = iceServersIssuedAt
+	}
+	us.mut.Unlock()
 	group := s.getGroup(cfg.GroupID)
 	call := group.getCall(cfg.CallID)
 
-	us.initBWEstimator(<-bwEstimatorCh)
+	if sa.congestionControl {
+		us.initBWEstimator(<-sa.bwEstimatorCh)
+	} else {
+		s.log.Debug("congestion control disabled for session", mlog.String("sessionID", cfg.SessionID))
+	}
 
 	peerConn.OnICECandidate(func(candidate *webrtc.ICECandidate) {
 		us.mut.RLock()
@@ -269,7 +547,7 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 		}
 
 		if port := s.cfg.ICEHostPortOverride.SinglePort(); port != 0 && candidate.Typ == webrtc.ICECandidateTypeHost {
-			if m := getExternalAddrMapFromHostOverride(s.cfg.ICEHostOverride, s.publicAddrsMap); m[candidate.Address] {
+			if m := getExternalAddrMapFromHostOverride(s.cfg.ICEHostOverride, s.getPublicAddrsMap()); m[candidate.Address] {
 				s.log.Debug("overriding host candidate port",
 					mlog.String("sessionID", cfg.SessionID),
 					mlog.Uint("port", candidate.Port),
@@ -296,7 +574,7 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 		select {
 		case s.receiveCh <- msg:
 		default:
-			s.log.Error("failed to send ICE message: channel is full", mlog.String("sessionID", cfg.SessionID))
+			s.droppedMessage(cfg.GroupID, "receive", "ice_candidate", mlog.String("sessionID", cfg.SessionID))
 		}
 	})
 
@@ -307,24 +585,14 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 	})
 
 	peerConn.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
-		if state == webrtc.PeerConnectionStateConnected {
-			s.log.Debug("rtc connected!", mlog.String("sessionID", cfg.SessionID))
-			s.metrics.IncRTCConnState("connected")
-		} else if state == webrtc.PeerConnectionStateDisconnected {
-			s.log.Debug("peer connection disconnected", mlog.String("sessionID", cfg.SessionID))
-			s.metrics.IncRTCConnState("disconnected")
-		} else if state == webrtc.PeerConnectionStateFailed {
-			s.log.Debug("peer connection failed", mlog.String("sessionID", cfg.SessionID))
-			s.metrics.IncRTCConnState("failed")
-		} else if state == webrtc.PeerConnectionStateClosed {
-			s.log.Debug("peer connection closed", mlog.String("sessionID", cfg.SessionID))
-			s.metrics.IncRTCConnState("closed")
-		}
-		switch state {
-		case webrtc.PeerConnectionStateClosed, webrtc.PeerConnectionStateFailed:
-			if err := s.CloseSession(cfg.SessionID); err != nil {
-				s.log.Error("failed to close RTC session", mlog.Err(err), mlog.Any("sessionCfg", cfg))
-			}
+		s.handleConnectionStateChange(us, state)
+	})
+
+	peerConn.OnSignalingStateChange(func(state webrtc.SignalingState) {
+		// Clients get the media map once negotiation completes so that they
+		// can match incoming tracks to their senders by MID.
+		if state == webrtc.SignalingStateStable {
+			s.sendMediaMap(us)
 		}
 	})
 
@@ -341,6 +609,14 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 	peerConn.OnDataChannel(func(dataCh *webrtc.DataChannel) {
 		s.log.Debug("data channel open", mlog.String("sessionID", cfg.SessionID))
 
+		us.mut.Lock()
+		select {
+		case <-us.dcOpenCh:
+		default:
+			close(us.dcOpenCh)
+		}
+		us.mut.Unlock()
+
 		go func() {
 			for {
 				select {
@@ -351,6 +627,61 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 						continue
 					}
 
+					if err := dataCh.Send(dcMsg); err != nil {
+						s.log.Error("failed to send message", mlog.Err(err), mlog.String("sessionID", cfg.SessionID))
+						continue
+					}
+				case lossRate := <-us.dcPLCHintCh:
+					dcMsg, err := dc.EncodeMessage(dc.MessageTypeAudioPLCHint, lossRate)
+					if err != nil {
+						s.log.Error("failed to encode audio plc hint message", mlog.Err(err), mlog.String("sessionID", cfg.SessionID))
+						continue
+					}
+
+					if err := dataCh.Send(dcMsg); err != nil {
+						s.log.Error("failed to send message", mlog.Err(err), mlog.String("sessionID", cfg.SessionID))
+						continue
+					}
+				case rate := <-us.dcBWECh:
+					dcMsg, err := dc.EncodeMessage(dc.MessageTypeBandwidthEstimation, rate)
+					if err != nil {
+						s.log.Error("failed to encode bwe message", mlog.Err(err), mlog.String("sessionID", cfg.SessionID))
+						continue
+					}
+
+					if err := dataCh.Send(dcMsg); err != nil {
+						s.log.Error("failed to send message", mlog.Err(err), mlog.String("sessionID", cfg.SessionID))
+						continue
+					}
+				case level := <-us.dcLevelCh:
+					dcMsg, err := dc.EncodeMessage(dc.MessageTypeSimulcastLevelChanged, level)
+					if err != nil {
+						s.log.Error("failed to encode simulcast level message", mlog.Err(err), mlog.String("sessionID", cfg.SessionID))
+						continue
+					}
+
+					if err := dataCh.Send(dcMsg); err != nil {
+						s.log.Error("failed to send message", mlog.Err(err), mlog.String("sessionID", cfg.SessionID))
+						continue
+					}
+				case iceServers := <-us.dcICEServersCh:
+					dcMsg, err := dc.EncodeMessage(dc.MessageTypeICEServers, newICEServersMessage(iceServers, cfg.SessionID, s.getTURNCredentialsExpiration()))
+					if err != nil {
+						s.log.Error("failed to encode ice servers message", mlog.Err(err), mlog.String("sessionID", cfg.SessionID))
+						continue
+					}
+
+					if err := dataCh.Send(dcMsg); err != nil {
+						s.log.Error("failed to send message", mlog.Err(err), mlog.String("sessionID", cfg.SessionID))
+						continue
+					}
+				case mediaMap := <-us.dcMediaMapCh:
+					dcMsg, err := dc.EncodeMessage(dc.MessageTypeMediaMap, mediaMap)
+					if err != nil {
+						s.log.Error("failed to encode media map message", mlog.Err(err), mlog.String("sessionID", cfg.SessionID))
+						continue
+					}
+
 					if err := dataCh.Send(dcMsg); err != nil {
 						s.log.Error("failed to send message", mlog.Err(err), mlog.String("sessionID", cfg.SessionID))
 						continue
@@ -361,6 +692,15 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 			}
 		}()
 
+		dataCh.OnClose(func() {
+			select {
+			case <-us.closeCh:
+				return
+			default:
+			}
+			s.fallbackToWSSignaling(us, "data channel closed")
+		})
+
 		dataCh.OnMessage(func(msg webrtc.DataChannelMessage) {
 			// DEPRECATED
 			// keeping this for compatibility with older clients (i.e. mobile)
@@ -392,6 +732,19 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 			mlog.String("sessionID", us.cfg.SessionID),
 		)
 
+		if !us.acquireInTrack() {
+			s.log.Warn("session track limit reached, dropping track",
+				mlog.String("remoteTrackID", remoteTrack.ID()),
+				mlog.String("rid", remoteTrack.RID()),
+				mlog.String("sessionID", us.cfg.SessionID))
+			s.metrics.IncRTCErrors(us.cfg.GroupID, "track_limit")
+			if err := receiver.Stop(); err != nil {
+				s.log.Error("failed to stop receiver", mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID))
+			}
+			return
+		}
+		defer us.releaseInTrack()
+
 		s.metrics.IncRTPTracks(us.cfg.GroupID, "in", getTrackType(remoteTrack.Kind()))
 		defer func() {
 			s.log.Debug("exiting track handler",
@@ -414,6 +767,14 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 			s.metrics.DecRTPTracks(us.cfg.GroupID, "in", getTrackType(remoteTrack.Kind()))
 		}()
 
+		// Tracks belonging to a rejected screen share are dropped, which also
+		// stops the receiver.
+		if rejectedStreamID := us.getRejectedScreenStreamID(); rejectedStreamID != "" && streamID == rejectedStreamID {
+			s.log.Debug("dropping track from rejected screen share",
+				mlog.String("streamID", streamID), mlog.String("sessionID", us.cfg.SessionID))
+			return
+		}
+
 		var screenStreamID string
 		if screenSession := call.getScreenSession(); screenSession != nil {
 			screenStreamID = screenSession.getScreenStreamID()
@@ -428,7 +789,7 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 				trackType = trackTypeScreenAudio
 			}
 
-			outAudioTrack, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, genTrackID(trackType, us.cfg.SessionID), random.NewID())
+			outAudioTrack, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, genTrackID(trackType, us.cfg.SessionID, s.cfg.TrackIDLength), random.NewID())
 			if err != nil {
 				s.log.Error("failed to create local track", mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID))
 				return
@@ -437,12 +798,15 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 			us.mut.Lock()
 			if trackType == trackTypeVoice {
 				us.outVoiceTrack = outAudioTrack
-				us.outVoiceTrackEnabled = true
 			} else {
 				us.outScreenAudioTrack = outAudioTrack
 			}
 			us.mut.Unlock()
 
+			if trackType == trackTypeVoice {
+				s.enableVoiceTrack(call, us)
+			}
+
 			call.iterSessions(func(ss *session) {
 				if ss.cfg.SessionID == us.cfg.SessionID {
 					return
@@ -450,10 +814,8 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 				select {
 				case ss.tracksCh <- trackActionContext{action: trackActionAdd, track: outAudioTrack}:
 				default:
-					s.log.Error("failed to send voice track: channel is full",
-						mlog.String("userID", ss.cfg.UserID),
+					s.droppedMessage(ss.cfg.GroupID, "tracks", "voice_track",
 						mlog.String("sessionID", ss.cfg.SessionID),
-						mlog.String("trackUserID", us.cfg.UserID),
 						mlog.String("trackSessionID", us.cfg.SessionID),
 					)
 				}
@@ -468,15 +830,28 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 				}
 			}
 
+			us.mut.RLock()
+			opusDTX := us.opusDTX
+			us.mut.RUnlock()
+
 			var hasVAD bool
 			if audioLevelExtensionID > 0 {
-				if err := us.InitVAD(s.log, s.receiveCh); err != nil {
+				if err := us.InitVAD(s.log, s.receiveCh, time.Duration(s.cfg.VADVoiceOffHoldMs)*time.Millisecond); err != nil {
 					s.log.Error("failed to init VAD", mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID))
 				} else {
 					hasVAD = true
 				}
 			}
 
+			recTrack := RecordingTrack{
+				SessionID: us.cfg.SessionID,
+				Type:      string(trackType),
+				MimeType:  trackMimeType,
+				SSRC:      uint32(remoteTrack.SSRC()),
+			}
+
+			var lastTS uint32
+			var hasLastTS bool
 			for {
 				packet, _, readErr := remoteTrack.ReadRTP()
 				if readErr != nil {
@@ -488,27 +863,55 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 					return
 				}
 
+				// With DTX no packets are sent during silence. The skipped frames
+				// are accounted as silent so that the VAD monitor doesn't keep
+				// reporting voice activity until enough packets come in.
+				var dtxSilenceFrames int
+				if opusDTX && hasLastTS {
+					dtxSilenceFrames = getDTXSilenceFrames(lastTS, packet.Timestamp)
+				}
+				if !hasLastTS || packet.Timestamp-lastTS <= math.MaxInt32 {
+					lastTS = packet.Timestamp
+					hasLastTS = true
+				}
+
 				// Mitigating against https://github.com/pion/webrtc/issues/2403
 				// The padding will be stripped by pion but the header bit will be forwarded as is (set).
 				// This causes clients (e.g. calls-transcriber) to fail to decode the packet.
 				// Since the payload is empty, we simply reset the padding to 0.
+				// This only checks the payload length so it's safe for E2EE sessions as well.
 				if packet.Padding && len(packet.Payload) == 0 {
 					packet.Padding = false
 					packet.PaddingSize = 0
 				}
 
+				var audioLevel rtp.AudioLevelExtension
+				var hasAudioLevel bool
+				if hasVAD && dtxSilenceFrames > 0 {
+					us.mut.RLock()
+					us.vadMonitor.PushSilence(dtxSilenceFrames)
+					us.mut.RUnlock()
+				}
 				if hasVAD {
-					var ext rtp.AudioLevelExtension
 					audioExtData := packet.GetExtension(uint8(audioLevelExtensionID))
 					if audioExtData != nil {
-						if err := ext.Unmarshal(audioExtData); err != nil {
+						if err := audioLevel.Unmarshal(audioExtData); err != nil {
 							s.log.Error("failed to unmarshal audio level extension",
 								mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID))
+						} else {
+							hasAudioLevel = true
 						}
 						us.mut.RLock()
-						us.vadMonitor.PushAudioLevel(ext.Level)
+						us.vadMonitor.PushAudioLevel(audioLevel.Level)
 						us.mut.RUnlock()
 					}
+					if hasAudioLevel && call.activeSpeaker.pushAudioLevel(us.cfg.SessionID, audioLevel.Level) {
+						select {
+						case s.receiveCh <- newMessage(us, ActiveSpeakerMessage, nil):
+						default:
+							s.droppedMessage(us.cfg.GroupID, "receive", "active_speaker", mlog.String("sessionID", us.cfg.SessionID))
+						}
+					}
 				}
 
 				if trackType == trackTypeVoice {
@@ -518,19 +921,54 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 					if !isEnabled {
 						continue
 					}
+
+					// Mixing requires decoding the payload which is not possible
+					// if encrypted. E2EE sessions are only accepted if the server
+					// allows them (ServerConfig.AllowE2EE).
+					if mixer := call.audioMixer.Load(); mixer != nil && !us.e2ee() {
+						mixer.push(us.cfg.SessionID, packet)
+					}
+				}
+
+				// Same as mixing, recording is pointless if the payload is encrypted.
+				if recorder := call.recorder.Load(); recorder != nil && !us.e2ee() {
+					recorder.push(recTrack, packet)
+				}
+
+				// Only forwarding the loudest speakers when a limit is set.
+				if trackType == trackTypeVoice && call.audioSelector != nil && hasVAD {
+					if hasAudioLevel {
+						call.audioSelector.pushAudioLevel(us.cfg.SessionID, audioLevel.Level)
+					}
+					if !call.audioSelector.isForwarded(us.cfg.SessionID) {
+						continue
+					}
 				}
 
 				writeStartTime := time.Now()
-				if err := outAudioTrack.WriteRTP(packet); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+				err := outAudioTrack.WriteRTP(packet)
+				if err != nil && !errors.Is(err, io.ErrClosedPipe) {
 					s.log.Error("failed to write RTP packet",
 						mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID))
 					s.metrics.IncRTCErrors(us.cfg.GroupID, "rtp")
 					return
 				}
-				s.metrics.ObserveRTPTracksWrite(us.cfg.GroupID, string(trackType), time.Since(writeStartTime).Seconds())
+				if us.metricsSampled {
+					s.metrics.ObserveRTPTracksWrite(us.cfg.GroupID, string(trackType), time.Since(writeStartTime).Seconds())
+				}
+			}
+		} else if params, ok := s.videoCodecParams[trackMimeType]; ok {
+			tt := trackTypeScreen
+			if videoStreamID := us.getVideoStreamID(); videoStreamID != "" && streamID == videoStreamID {
+				tt = trackTypeVideo
+			} else if screenStreamID != streamID {
+				tt = s.holdUnexpectedVideoTrack(call, us, streamID)
 			}
-		} else if params, ok := rtpVideoCodecs[trackMimeType]; ok {
-			if screenStreamID != "" && screenStreamID != streamID {
+
+			if tt == trackTypeVideo {
+				s.handleVideoTrack(call, us, remoteTrack, params)
+				return
+			} else if tt != trackTypeScreen {
 				s.log.Error("received unexpected video track",
 					mlog.String("streamID", streamID), mlog.String("sessionID", us.cfg.SessionID))
 				return
@@ -543,7 +981,7 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 				outTracks := make([]*webrtc.TrackLocalStaticRTP, num)
 				for i := 0; i < num; i++ {
 					outTrack, err := webrtc.NewTrackLocalStaticRTP(params.RTPCodecCapability,
-						genTrackID(trackTypeScreen, us.cfg.SessionID), random.NewID(), webrtc.WithRTPStreamID(remoteTrack.RID()))
+						genTrackID(trackTypeScreen, us.cfg.SessionID, s.cfg.TrackIDLength), random.NewID(), webrtc.WithRTPStreamID(remoteTrack.RID()))
 					if err != nil {
 						return nil, fmt.Errorf("failed to create screen track")
 					}
@@ -577,6 +1015,14 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 			us.screenRateMonitors[trackIdx] = rm
 			us.mut.Unlock()
 
+			// The levels published by the sender are known upfront from the
+			// negotiated encodings, even if their tracks haven't started yet.
+			rids := make([]string, 0, len(receiver.Tracks()))
+			for _, track := range receiver.Tracks() {
+				rids = append(rids, track.RID())
+			}
+			publishedLevels := getSimulcastLevels(rids)
+
 			call.iterSessions(func(ss *session) {
 				if ss.cfg.SessionID == us.cfg.SessionID {
 					return
@@ -584,21 +1030,19 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 
 				expectedLevel := SimulcastLevelDefault
 				if remoteTrack.RID() != "" {
-					expectedLevel = ss.getExpectedSimulcastLevel()
+					// Receivers get the closest level the sender is actually publishing.
+					expectedLevel = fitSimulcastLevel(publishedLevels, ss.getExpectedSimulcastLevel(us.cfg.SessionID))
 				}
 
 				if rid != expectedLevel {
 					return
 				}
 
-				if trackMimeType == ScreenTrackMimeTypeDefault && us.supportsAV1() && ss.supportsAV1() {
-					s.log.Debug("skipping VP8 track for AV1 supported receiver",
-						mlog.String("sessionID", ss.cfg.SessionID),
-					)
-					return
-				} else if trackMimeType == webrtc.MimeTypeAV1 && !ss.supportsAV1() {
-					s.log.Debug("skipping AV1 track for unsupported receiver",
+				if preferredMimeType := getScreenTrackMimeType(us, ss); slices.Contains(screenTrackMimeTypes, trackMimeType) && trackMimeType != preferredMimeType {
+					s.log.Debug("skipping screen track in favor of preferred codec",
 						mlog.String("sessionID", ss.cfg.SessionID),
+						mlog.String("trackMimeType", trackMimeType),
+						mlog.String("preferredMimeType", preferredMimeType),
 					)
 					return
 				}
@@ -609,36 +1053,57 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 					mlog.String("trackMimeType", trackMimeType),
 				)
 
+				// Codecs can be published at different times. A receiver already
+				// getting a less preferred one gets its track swapped in place.
 				select {
-				case ss.tracksCh <- trackActionContext{action: trackActionAdd, track: pickRandom(outScreenTracks)}:
+				case ss.tracksCh <- trackActionContext{action: trackActionAdd, track: pickRandom(outScreenTracks), replace: true}:
 				default:
-					s.log.Error("failed to send screen track: channel is full",
-						mlog.String("userID", ss.cfg.UserID),
+					s.droppedMessage(ss.cfg.GroupID, "tracks", "screen_track",
 						mlog.String("sessionID", ss.cfg.SessionID),
-						mlog.String("trackUserID", us.cfg.UserID),
 						mlog.String("trackSessionID", us.cfg.SessionID),
 					)
 				}
 			})
 
-			writeTrack := func(writerCh <-chan *rtp.Packet, outTrack *webrtc.TrackLocalStaticRTP) {
-				for pkt := range writerCh {
-					writeStartTime := time.Now()
-					if err := outTrack.WriteRTP(pkt); err != nil && !errors.Is(err, io.ErrClosedPipe) {
-						s.log.Error("failed to write RTP packet",
-							mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID))
-						s.metrics.IncRTCErrors(us.cfg.GroupID, "rtp")
-						continue
+			writerChs := make([]chan videoPacket, len(outScreenTracks))
+			for i := 0; i < len(outScreenTracks); i++ {
+				writerChs[i] = make(chan videoPacket, writerQueueSize)
+				defer close(writerChs[i])
+				// Without access to the payload we can't tell whether dropping frames would
+				// break decoding on the receiving end, so E2EE tracks are never demoted.
+				var dropper *frameDropper
+				if !us.e2ee() {
+					dropper = s.newScreenFrameDropper(i, len(outScreenTracks), params.ClockRate, trackMimeType)
+				}
+				if dropper != nil {
+					us.mut.Lock()
+					if us.demotedScreenTracks == nil {
+						us.demotedScreenTracks = map[*webrtc.TrackLocalStaticRTP]bool{}
 					}
-					s.metrics.ObserveRTPTracksWrite(us.cfg.GroupID, string(trackTypeScreen), time.Since(writeStartTime).Seconds())
+					us.demotedScreenTracks[outScreenTracks[i]] = true
+					us.mut.Unlock()
 				}
+				go s.writeVideoTrack(call, us, trackTypeScreen, writerChs[i], outScreenTracks[i], dropper)
 			}
 
-			writerChs := make([]chan *rtp.Packet, len(outScreenTracks))
-			for i := 0; i < len(outScreenTracks); i++ {
-				writerChs[i] = make(chan *rtp.Packet, writerQueueSize)
-				defer close(writerChs[i])
-				go writeTrack(writerChs[i], outScreenTracks[i])
+			var frameMarkingExtID uint8
+			for _, ext := range receiver.GetParameters().HeaderExtensions {
+				if ext.URI == frameMarkingURI {
+					s.log.Debug("found frame marking extension", mlog.Any("ext", ext), mlog.String("sessionID", us.cfg.SessionID))
+					frameMarkingExtID = uint8(ext.ID)
+					break
+				}
+			}
+
+			// Only the highest level gets recorded. Same as audio, recording is
+			// pointless if the payload is encrypted.
+			recordable := isRecordableMimeType(trackMimeType) && !us.e2ee() &&
+				(remoteTrack.RID() == "" || remoteTrack.RID() == SimulcastLevelHigh)
+			recTrack := RecordingTrack{
+				SessionID: us.cfg.SessionID,
+				Type:      string(trackTypeScreen),
+				MimeType:  trackMimeType,
+				SSRC:      uint32(remoteTrack.SSRC()),
 			}
 
 			limiter := rate.NewLimiter(0.25, 1)
@@ -657,11 +1122,25 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 				// The padding will be stripped by pion but the header bit will be forwarded as is (set).
 				// This causes clients (e.g. calls-transcriber) to fail to decode the packet.
 				// Since the payload is empty, we simply reset the padding to 0.
+				// This only checks the payload length so it's safe for E2EE sessions as well.
 				if packet.Padding && len(packet.Payload) == 0 {
 					packet.Padding = false
 					packet.PaddingSize = 0
 				}
 
+				var marking *frameMarking
+				if frameMarkingExtID > 0 {
+					if data := packet.GetExtension(frameMarkingExtID); data != nil {
+						if fm, err := parseFrameMarking(data); err == nil {
+							marking = &fm
+						}
+					}
+				}
+
+				if recorder := call.recorder.Load(); recorder != nil && recordable {
+					recorder.push(recTrack, packet)
+				}
+
 				rm.PushSample(packet.MarshalSize())
 				if limiter.Allow() {
 					rate, dur := rm.GetRate()
@@ -683,10 +1162,9 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 					pkt.Extensions = nil
 
 					select {
-					case writerCh <- &pkt:
+					case writerCh <- videoPacket{Packet: &pkt, marking: marking}:
 					default:
-						s.log.Error("failed to write RTP packet to writer channel", mlog.String("trackID", outScreenTracks[i].ID()))
-						s.metrics.IncRTCErrors(us.cfg.GroupID, "rtp")
+						s.droppedMessage(us.cfg.GroupID, "screen_writer", "rtp", mlog.String("trackID", outScreenTracks[i].ID()))
 					}
 				}
 			}
@@ -695,6 +1173,10 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 
 	go s.handleNegotiations(us, call)
 
+	if generatesTURNCredentials {
+		go s.handleTURNCredentialsRefresh(us)
+	}
+
 	s.log.Debug("session has joined call",
 		mlog.String("userID", cfg.UserID),
 		mlog.String("sessionID", cfg.SessionID),
@@ -705,10 +1187,49 @@ func (s *Server) InitSession(cfg SessionConfig, closeCb func() error) error {
 	return nil
 }
 
-func (s *Server) CloseSession(sessionID string) error {
+// CloseCall forcibly ends the given call by closing all of its sessions with
+// CloseReasonKicked. It's a no-op if the call doesn't exist.
+func (s *Server) CloseCall(groupID, callID string) error {
+	group := s.getGroup(groupID)
+	if group == nil {
+		return nil
+	}
+	call := group.getCall(callID)
+	if call == nil {
+		return nil
+	}
+
+	// CloseSession needs to lock the call so sessions are collected first.
+	var sessionIDs []string
+	call.iterSessions(func(us *session) {
+		sessionIDs = append(sessionIDs, us.cfg.SessionID)
+	})
+
+	s.log.Info("closing call",
+		mlog.String("groupID", groupID),
+		mlog.String("callID", callID),
+		mlog.Int("sessions", len(sessionIDs)),
+	)
+
+	var errs []error
+	for _, sessionID := range sessionIDs {
+		if err := s.CloseSession(sessionID, CloseReasonKicked); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close session %s: %w", sessionID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// CloseSession closes the session with the given ID. The reason is passed
+// to the close callback given to InitSession, if any.
+func (s *Server) CloseSession(sessionID string, reason CloseReason) error {
 	s.mut.Lock()
 	cfg, ok := s.sessions[sessionID]
 	delete(s.sessions, sessionID)
+	if ok {
+		s.metrics.DecRTCSessions(cfg.GroupID)
+	}
 
 	if len(s.sessions) == 0 && s.drainCh != nil {
 		s.log.Debug("closing drain channel")
@@ -721,8 +1242,6 @@ func (s *Server) CloseSession(sessionID string) error {
 		return nil
 	}
 
-	s.metrics.DecRTCSessions(cfg.GroupID)
-
 	group := s.getGroup(cfg.GroupID)
 	if group == nil {
 		return fmt.Errorf("group not found: %s", cfg.GroupID)
@@ -739,110 +1258,298 @@ func (s *Server) CloseSession(sessionID string) error {
 	call.mut.Lock()
 
 	call.handleSessionClose(us)
+	if call.audioSelector != nil {
+		call.audioSelector.removeSpeaker(cfg.SessionID)
+	}
+	speakerCleared := call.activeSpeaker.removeSession(cfg.SessionID)
+	if call.receiversLimiter != nil {
+		call.receiversLimiter.removeSession(cfg.SessionID)
+	}
 
+	if mixer := call.audioMixer.Load(); mixer != nil {
+		mixer.removeSource(cfg.SessionID)
+	}
+	if recorder := call.recorder.Load(); recorder != nil {
+		recorder.removeSession(cfg.SessionID)
+	}
+
+	// The mixer and recorder are stopped once the locks are released since
+	// closing their outputs requires IO.
+	var mixer *audioMixer
+	var recorder *callRecorder
+	// The session the active speaker cleared message is sent on behalf of.
+	var speakerClearedSession *session
 	delete(call.sessions, cfg.SessionID)
+	if speakerCleared {
+		for _, ss := range call.sessions {
+			speakerClearedSession = ss
+			break
+		}
+	}
 	if len(call.sessions) == 0 {
+		mixer = call.audioMixer.Swap(nil)
+		recorder = call.recorder.Swap(nil)
 		group.mut.Lock()
 		delete(group.calls, cfg.CallID)
+		s.updateCallsCount(-1)
 		if len(group.calls) == 0 {
 			s.mut.Lock()
 			delete(s.groups, cfg.GroupID)
+			s.metrics.SetRTCGroupCount(len(s.groups))
+			// Stopping under lock so that Stop can't close sendCh while
+			// queued messages are still being sent.
+			group.stop()
 			s.mut.Unlock()
 		}
 		group.mut.Unlock()
 	}
 	call.mut.Unlock()
 
+	if speakerClearedSession != nil {
+		s.sendActiveSpeakerCleared(speakerClearedSession, cfg.SessionID)
+	}
+
+	if mixer != nil {
+		mixer.stop()
+	}
+	if recorder != nil {
+		recorder.stop()
+	}
+
 	us.mut.Lock()
 	close(us.closeCh)
+	debouncer := us.vadDebouncer
 	us.mut.Unlock()
 	us.rtcConn.Close()
 
-	// Wait for the signaling goroutines to be done.
-	<-us.doneCh
+	// Cancelling any pending voice off event.
+	if debouncer != nil {
+		debouncer.stop()
+	}
+
+	// Wait for the signaling goroutines to be done. This is bounded so that a
+	// goroutine failing to exit doesn't also leak the caller.
+	select {
+	case <-us.doneCh:
+	case <-time.After(signalingExitTimeout):
+		s.metrics.IncRTCErrors(cfg.GroupID, "signaling_exit")
+		s.log.Error("timed out waiting for signaling goroutines to exit", mlog.String("sessionID", cfg.SessionID))
+	}
 
 	if us.closeCb != nil {
-		return us.closeCb()
+		return us.closeCb(reason)
 	}
 
 	return nil
 }
 
-// handleTracks manages (adds and removes) a/v tracks for the peer associated with the session.
-func (s *Server) handleTracks(call *call, us *session) {
-	call.iterSessions(func(ss *session) {
-		if ss.cfg.SessionID == us.cfg.SessionID {
-			return
-		}
+// getSenderOutTracks returns the tracks sent by session ss that should be
+// forwarded to session us.
+func (s *Server) getSenderOutTracks(us, ss *session) []*webrtc.TrackLocalStaticRTP {
+	// Screen track selection. Both sender and receiver need to support a
+	// codec in order to send out its track.
+	screenTrackMimeType := getScreenTrackMimeType(ss, us)
 
-		ss.mut.RLock()
-		outVoiceTrack := ss.outVoiceTrack
+	ss.mut.RLock()
+	outVoiceTrack := ss.outVoiceTrack
+	outScreenTracks := ss.outScreenTracks[getTrackIndex(screenTrackMimeType, SimulcastLevelDefault)]
 
-		// Screen track selection. Both sender and receiver support it
-		// in order to send out the AV1 track.
-		screenTrackMimeType := ScreenTrackMimeTypeDefault
-		if ss.supportsAV1() && us.supportsAV1() {
-			s.log.Debug("both sender and receiver support AV1", mlog.String("sessionID", us.cfg.SessionID))
-			screenTrackMimeType = webrtc.MimeTypeAV1
-		}
-		outScreenTracks := ss.outScreenTracks[getTrackIndex(screenTrackMimeType, SimulcastLevelDefault)]
+	outScreenAudioTrack := ss.outScreenAudioTrack
+	outVideoTrack := ss.outVideoTrack
+	ss.mut.RUnlock()
+
+	var outTracks []*webrtc.TrackLocalStaticRTP
+	if outVoiceTrack != nil {
+		outTracks = append(outTracks, outVoiceTrack)
+	}
+	if len(outScreenTracks) > 0 {
+		outTracks = append(outTracks, pickRandom(outScreenTracks))
+	}
+	if outScreenAudioTrack != nil {
+		outTracks = append(outTracks, outScreenAudioTrack)
+	}
+	if outVideoTrack != nil && canReceiveVideoTrack(us, outVideoTrack) {
+		outTracks = append(outTracks, outVideoTrack)
+	}
 
-		outScreenAudioTrack := ss.outScreenAudioTrack
-		ss.mut.RUnlock()
+	return outTracks
+}
+
+// getExpectedScreenTrack returns the screen track the receiving session is
+// expected to get from the sending one, matching the codec both support and
+// the simulcast level the receiver would be switched to.
+func getExpectedScreenTrack(us, ss *session) *webrtc.TrackLocalStaticRTP {
+	mimeType := getScreenTrackMimeType(ss, us)
+	level := fitSimulcastLevel(ss.getScreenSimulcastLevels(mimeType), us.getExpectedSimulcastLevel(ss.cfg.SessionID))
+	return ss.getOutScreenTrack(mimeType, level)
+}
+
+// handleTrackResubscribe queues again the track of the given type sent by
+// the source session. This lets clients recover from a renegotiation failure
+// that caused an expected track to never be received.
+func (s *Server) handleTrackResubscribe(us *session, sourceSessionID string, tt trackType) error {
+	if sourceSessionID == us.cfg.SessionID {
+		return fmt.Errorf("cannot resubscribe to own track")
+	}
+
+	ss := us.call.getSession(sourceSessionID)
+	if ss == nil {
+		return fmt.Errorf("source session not found")
+	}
 
-		var outTracks []*webrtc.TrackLocalStaticRTP
-		if outVoiceTrack != nil {
-			outTracks = append(outTracks, outVoiceTrack)
+	var track *webrtc.TrackLocalStaticRTP
+	if tt == trackTypeScreen {
+		track = getExpectedScreenTrack(us, ss)
+	} else {
+		for _, t := range s.getSenderOutTracks(us, ss) {
+			if ttype, _, err := parseTrackID(t.ID()); err == nil && ttype == tt {
+				track = t
+				break
+			}
 		}
-		if len(outScreenTracks) > 0 {
-			outTracks = append(outTracks, pickRandom(outScreenTracks))
+	}
+	if track == nil {
+		return fmt.Errorf("track not found")
+	}
+
+	us.mut.RLock()
+	// Screen tracks come in several copies and levels, any of which the
+	// receiver could be getting already.
+	subscribed := us.rxTracks[track.ID()] != nil || (tt == trackTypeScreen && us.screenTrackSender != nil)
+	negotiating := us.makingOffer
+	us.mut.RUnlock()
+	if subscribed {
+		s.log.Debug("track already subscribed, ignoring resubscribe request",
+			mlog.String("sessionID", us.cfg.SessionID), mlog.String("trackID", track.ID()))
+		return nil
+	}
+	if negotiating {
+		// The client is expected to retry later on, should the ongoing
+		// negotiation fail.
+		s.log.Debug("negotiation in progress, ignoring resubscribe request",
+			mlog.String("sessionID", us.cfg.SessionID), mlog.String("trackID", track.ID()))
+		return nil
+	}
+
+	s.log.Debug("resubscribing track", mlog.String("sessionID", us.cfg.SessionID), mlog.String("trackID", track.ID()))
+
+	select {
+	case us.tracksCh <- trackActionContext{action: trackActionAdd, track: track}:
+	default:
+		s.metrics.IncRTCChannelFull(us.cfg.GroupID, "tracks")
+		return fmt.Errorf("channel is full")
+	}
+
+	return nil
+}
+
+// handleStopReceiving stops forwarding the tracks of the given source session
+// to the receiving one, both current and future ones.
+func (s *Server) handleStopReceiving(us *session, sourceSessionID string) error {
+	if sourceSessionID == "" {
+		return fmt.Errorf("invalid empty source session ID")
+	}
+
+	if sourceSessionID == us.cfg.SessionID {
+		return fmt.Errorf("cannot stop receiving from own session")
+	}
+
+	for _, track := range us.stopReceiving(sourceSessionID) {
+		s.log.Debug("stop receiving track", mlog.String("sessionID", us.cfg.SessionID), mlog.String("trackID", track.ID()))
+		select {
+		case us.tracksCh <- trackActionContext{action: trackActionRemove, track: track}:
+		default:
+			s.metrics.IncRTCChannelFull(us.cfg.GroupID, "tracks")
+			return fmt.Errorf("channel is full")
 		}
-		if outScreenAudioTrack != nil {
-			outTracks = append(outTracks, outScreenAudioTrack)
+	}
+
+	return nil
+}
+
+// fallbackToWSSignaling makes the session use WebSocket signaling for any
+// subsequent negotiation. It returns false if the session was not using DC
+// signaling.
+func (s *Server) fallbackToWSSignaling(us *session, reason string) bool {
+	if !us.disableDCSignaling() {
+		return false
+	}
+
+	s.log.Warn("dc signaling failed, falling back to ws", mlog.String("sessionID", us.cfg.SessionID), mlog.String("reason", reason))
+	s.metrics.IncRTCErrors(us.cfg.GroupID, "dc_signaling")
+
+	return true
+}
+
+// handleTracks manages (adds and removes) a/v tracks for the peer associated with the session.
+func (s *Server) handleTracks(call *call, us *session) {
+	call.iterSessions(func(ss *session) {
+		if ss.cfg.SessionID == us.cfg.SessionID {
+			return
 		}
 
-		for _, track := range outTracks {
+		for _, track := range s.getSenderOutTracks(us, ss) {
 			select {
 			case us.tracksCh <- trackActionContext{action: trackActionAdd, track: track}:
 			default:
 				s.metrics.IncRTCErrors(us.cfg.GroupID, "track")
-				s.log.Error("failed to add track on join: channel is full", mlog.String("sessionID", us.cfg.SessionID))
+				s.droppedMessage(us.cfg.GroupID, "tracks", "join_track", mlog.String("sessionID", us.cfg.SessionID))
 			}
 		}
 	})
 
+	// The session's lifetime, and so that of its signaling goroutines, is
+	// optionally bounded.
+	var maxDurationCh <-chan time.Time
+	if s.cfg.MaxSessionDurationMs > 0 {
+		timer := time.NewTimer(time.Until(us.createdAt.Add(time.Duration(s.cfg.MaxSessionDurationMs) * time.Millisecond)))
+		defer timer.Stop()
+		maxDurationCh = timer.C
+	}
+
+	// Track actions held while the session has too many outstanding offers
+	// (ServerConfig.MaxOutstandingOffers).
+	var held heldTrackActions
+	defer held.stop()
+
 	for {
+		// Answers are only waited for here while actions are held.
+		// Otherwise they are consumed as part of negotiating.
+		var heldAnswerCh chan sdpMessage
+		if len(held.actions) > 0 {
+			heldAnswerCh = us.sdpAnswerInCh
+		}
+
 		select {
 		case ctx, ok := <-us.tracksCh:
 			if !ok {
 				return
 			}
 
-			sdpCh := s.receiveCh
-			if us.dcSignaling() {
-				sdpCh = us.dcSDPCh
+			if ctx.action != trackActionICERestart && (len(held.actions) > 0 || s.tooManyOutstandingOffers(us)) {
+				s.holdTrackAction(us, &held, ctx)
+				continue
 			}
 
-			if ctx.action == trackActionAdd {
-				if err := us.addTrack(sdpCh, ctx.track); err != nil {
-					s.metrics.IncRTCErrors(us.cfg.GroupID, "track")
-					s.log.Error("failed to add track", mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID), mlog.String("trackID", ctx.track.ID()))
-					continue
-				}
-			} else if ctx.action == trackActionRemove {
-				if err := us.removeTrack(sdpCh, ctx.track); err != nil {
-					s.metrics.IncRTCErrors(us.cfg.GroupID, "track")
-					var trackID string
-					if ctx.track != nil {
-						trackID = ctx.track.ID()
-					}
-					s.log.Error("failed to remove track", mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID), mlog.String("trackID", trackID))
-					continue
-				}
-			} else {
-				s.log.Error("invalid track action", mlog.Int("action", int(ctx.action)), mlog.String("sessionID", us.cfg.SessionID))
+			s.handleTrackAction(call, us, ctx)
+		case answer, ok := <-heldAnswerCh:
+			if !ok {
+				return
+			}
+
+			if applied, err := us.applyLateAnswer(answer); err != nil {
+				s.metrics.IncRTCErrors(us.cfg.GroupID, "signaling")
+				s.log.Error("failed to apply answer", mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID))
+				continue
+			} else if !applied {
 				continue
 			}
+
+			s.releaseHeldTrackActions(call, us, &held, false)
+		case <-held.timeoutCh():
+			// Answers didn't catch up in time. Going ahead anyway gives the
+			// pending offer another chance through completePendingOffer.
+			s.releaseHeldTrackActions(call, us, &held, true)
 		case offerMsg, ok := <-us.sdpOfferInCh:
 			if !ok {
 				return
@@ -853,8 +1560,257 @@ func (s *Server) handleTracks(call *call, us *session) {
 				s.log.Error("failed to signal", mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID))
 				continue
 			}
+		case <-maxDurationCh:
+			s.log.Info("session exceeded max duration, closing", mlog.String("sessionID", us.cfg.SessionID))
+			// CloseSession waits for this goroutine to be done so it can't be
+			// called inline.
+			go func() {
+				if err := s.CloseSession(us.cfg.SessionID, CloseReasonMaxDuration); err != nil {
+					s.log.Error("failed to close session", mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID))
+				}
+			}()
 		case <-us.closeCh:
 			return
 		}
 	}
 }
+
+// handleTrackAction performs the given track action (e.g. adding a track) on
+// the session, negotiating with the client as needed.
+func (s *Server) handleTrackAction(call *call, us *session, ctx trackActionContext) {
+	// Clients not opening a data channel in time get signaled
+	// through WebSocket rather than having negotiations time out.
+	if s.cfg.DCOpenTimeoutMs > 0 && us.dcSignaling() && !us.waitForDC(time.Duration(s.cfg.DCOpenTimeoutMs)*time.Millisecond) {
+		s.fallbackToWSSignaling(us, "data channel not opened")
+	}
+
+	sdpCh := s.receiveCh
+	if us.dcSignaling() {
+		sdpCh = us.dcSDPCh
+	}
+
+	if ctx.action == trackActionAdd {
+		if ctx.track != nil && us.isReceivingStopped(ctx.track.ID()) {
+			s.log.Debug("receiving stopped for track source, skipping", mlog.String("sessionID", us.cfg.SessionID), mlog.String("trackID", ctx.track.ID()))
+			return
+		}
+		// The receiver slot is shared with any out track of the same published
+		// track already being sent (e.g. a different simulcast level), in which
+		// case it must be kept if this action fails.
+		sharedSlot := us.isReceivingPublishedTrack(ctx.track)
+		releaseReceiver := func() {
+			if !sharedSlot {
+				s.releaseReceiver(call, us, ctx.track)
+			}
+		}
+		if call.receiversLimiter != nil && !call.receiversLimiter.acquire(ctx.track.ID(), us.cfg.SessionID) {
+			s.metrics.IncRTCErrors(us.cfg.GroupID, "receivers_limit")
+			s.log.Warn("publisher receivers limit reached, not adding track", mlog.String("sessionID", us.cfg.SessionID), mlog.String("trackID", ctx.track.ID()))
+			if err := s.sendTrackReject(us, ctx.track.ID()); err != nil {
+				s.log.Error("failed to send track reject message", mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID))
+			}
+			return
+		}
+		if ctx.replace {
+			oldTrack, err := us.replaceScreenTrack(ctx.track)
+			if err == nil {
+				if call.receiversLimiter != nil && oldTrack != nil {
+					call.receiversLimiter.replace(oldTrack.ID(), ctx.track.ID(), us.cfg.SessionID)
+				}
+				return
+			} else if !errors.Is(err, errNoScreenTrackSender) {
+				releaseReceiver()
+				s.metrics.IncRTCErrors(us.cfg.GroupID, "track")
+				s.log.Error("failed to replace screen track", mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID), mlog.String("trackID", ctx.track.ID()))
+				return
+			}
+			// Nothing to replace, the track gets added as usual.
+		}
+		if err := us.addTrack(sdpCh, ctx.track); errors.Is(err, errTrackLimitReached) {
+			releaseReceiver()
+			s.metrics.IncRTCErrors(us.cfg.GroupID, "track_limit")
+			s.log.Warn("session track limit reached, not adding track", mlog.String("sessionID", us.cfg.SessionID), mlog.String("trackID", ctx.track.ID()))
+			return
+		} else if errors.Is(err, errSignalingTimeout) && sdpCh == us.dcSDPCh && s.fallbackToWSSignaling(us, "signaling timed out") {
+			// The pending offer gets sent again through WebSocket as part
+			// of retrying.
+			select {
+			case us.tracksCh <- ctx:
+			default:
+				s.metrics.IncRTCErrors(us.cfg.GroupID, "track")
+				s.droppedMessage(us.cfg.GroupID, "tracks", "track_retry", mlog.String("sessionID", us.cfg.SessionID), mlog.String("trackID", ctx.track.ID()))
+			}
+			return
+		} else if err != nil {
+			releaseReceiver()
+			s.metrics.IncRTCErrors(us.cfg.GroupID, "track")
+			s.log.Error("failed to add track", mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID), mlog.String("trackID", ctx.track.ID()))
+			return
+		}
+		// Receiving may have been stopped while the track was being negotiated.
+		if us.isReceivingStopped(ctx.track.ID()) {
+			if err := us.removeTrack(sdpCh, ctx.track); err != nil {
+				s.metrics.IncRTCErrors(us.cfg.GroupID, "track")
+				s.log.Error("failed to remove track", mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID), mlog.String("trackID", ctx.track.ID()))
+			} else {
+				s.releaseReceiver(call, us, ctx.track)
+			}
+		}
+	} else if ctx.action == trackActionRemove {
+		if err := us.removeTrack(sdpCh, ctx.track); err != nil {
+			// The pending offer will be completed through WebSocket on the
+			// next negotiation.
+			if errors.Is(err, errSignalingTimeout) && sdpCh == us.dcSDPCh {
+				s.fallbackToWSSignaling(us, "signaling timed out")
+			}
+			s.metrics.IncRTCErrors(us.cfg.GroupID, "track")
+			var trackID string
+			if ctx.track != nil {
+				trackID = ctx.track.ID()
+			}
+			s.log.Error("failed to remove track", mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID), mlog.String("trackID", trackID))
+			return
+		}
+		s.releaseReceiver(call, us, ctx.track)
+	} else if ctx.action == trackActionICERestart {
+		// The connection may have recovered in the meantime.
+		if !us.isRestartingICE() {
+			return
+		}
+		// The library restarts ICE with the credentials set in the setting
+		// engine, if any. Restarting with the same credentials would leave
+		// the client unaware so it's left to initiate the restart instead.
+		if s.cfg.ICEUfragLength > 0 || s.cfg.ICEPwdLength > 0 {
+			s.log.Debug("ice credentials are fixed, waiting for client to restart ice", mlog.String("sessionID", us.cfg.SessionID))
+			return
+		}
+		err := us.restartICE(sdpCh)
+		if errors.Is(err, errSignalingTimeout) && sdpCh == us.dcSDPCh && s.fallbackToWSSignaling(us, "signaling timed out") {
+			// The data channel may be affected by the disconnection as well.
+			err = us.restartICE(s.receiveCh)
+		}
+		if err != nil {
+			s.metrics.IncRTCErrors(us.cfg.GroupID, "ice_restart")
+			s.log.Error("failed to restart ice", mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID))
+		}
+	} else {
+		s.log.Error("invalid track action", mlog.Int("action", int(ctx.action)), mlog.String("sessionID", us.cfg.SessionID))
+	}
+}
+
+// handleConnectionStateChange tracks the state of the session's peer
+// connection, closing the session once it's gone. Disconnections are first
+// given a chance to recover through an ICE restart.
+func (s *Server) handleConnectionStateChange(us *session, state webrtc.PeerConnectionState) {
+	cfg := us.cfg
+
+	us.mut.Lock()
+	us.connState = state
+	us.mut.Unlock()
+
+	if state == webrtc.PeerConnectionStateConnected {
+		s.log.Debug("rtc connected!", mlog.String("sessionID", cfg.SessionID))
+		s.metrics.IncRTCConnState("connected")
+		us.mut.Lock()
+		if us.connectedAt.IsZero() {
+			us.connectedAt = time.Now()
+		}
+		us.mut.Unlock()
+		us.stopICERestart()
+	} else if state == webrtc.PeerConnectionStateDisconnected {
+		s.log.Debug("peer connection disconnected", mlog.String("sessionID", cfg.SessionID))
+		s.metrics.IncRTCConnState("disconnected")
+		s.startICERestart(us)
+	} else if state == webrtc.PeerConnectionStateFailed {
+		s.log.Debug("peer connection failed", mlog.String("sessionID", cfg.SessionID))
+		s.metrics.IncRTCConnState("failed")
+	} else if state == webrtc.PeerConnectionStateClosed {
+		s.log.Debug("peer connection closed", mlog.String("sessionID", cfg.SessionID))
+		s.metrics.IncRTCConnState("closed")
+		us.stopICERestart()
+	}
+	var reason CloseReason
+	switch state {
+	case webrtc.PeerConnectionStateClosed:
+		reason = CloseReasonLeft
+	case webrtc.PeerConnectionStateFailed:
+		// The session gets closed at the end of the grace period unless
+		// the ICE restart succeeds.
+		if us.isRestartingICE() {
+			s.log.Debug("waiting for ice restart before closing session", mlog.String("sessionID", cfg.SessionID))
+			s.startICERestartTimeout(us)
+			return
+		}
+		reason = CloseReasonFailed
+	}
+	if reason != "" {
+		if err := s.CloseSession(cfg.SessionID, reason); err != nil {
+			s.log.Error("failed to close RTC session", mlog.Err(err), mlog.Any("sessionCfg", cfg))
+		}
+	}
+}
+
+// releaseReceiver frees the receiver slot held by the session for the given
+// track, if receivers are limited.
+func (s *Server) releaseReceiver(call *call, us *session, track webrtc.TrackLocal) {
+	if call.receiversLimiter == nil || track == nil {
+		return
+	}
+	call.receiversLimiter.release(track.ID(), us.cfg.SessionID)
+}
+
+// unexpectedTrackCheckInterval is how often the expected screen stream ID is
+// checked while holding an unexpected video track.
+const unexpectedTrackCheckInterval = 20 * time.Millisecond
+
+// holdUnexpectedVideoTrack waits for up to ServerConfig.UnexpectedVideoTrackHoldMs
+// for the given stream to become the expected screen or camera stream. This
+// mitigates the race of a track being received before the matching ScreenOn
+// or VideoOn message. It returns the type the track should be handled as, or
+// an empty one if it should be dropped. Tracks not claimed in time while
+// nobody is screen sharing are handled as screen ones.
+func (s *Server) holdUnexpectedVideoTrack(call *call, us *session, streamID string) trackType {
+	getScreenStreamID := func() string {
+		if screenSession := call.getScreenSession(); screenSession != nil {
+			return screenSession.getScreenStreamID()
+		}
+		return ""
+	}
+
+	if s.cfg.UnexpectedVideoTrackHoldMs == 0 {
+		if getScreenStreamID() == "" {
+			return trackTypeScreen
+		}
+		return ""
+	}
+
+	s.log.Debug("holding unexpected video track",
+		mlog.String("streamID", streamID), mlog.String("sessionID", us.cfg.SessionID))
+
+	ticker := time.NewTicker(unexpectedTrackCheckInterval)
+	defer ticker.Stop()
+	timer := time.NewTimer(time.Duration(s.cfg.UnexpectedVideoTrackHoldMs) * time.Millisecond)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if us.getVideoStreamID() == streamID {
+				return trackTypeVideo
+			}
+			if us.getRejectedScreenStreamID() == streamID {
+				return ""
+			}
+			if getScreenStreamID() == streamID {
+				return trackTypeScreen
+			}
+		case <-timer.C:
+			if getScreenStreamID() == "" {
+				return trackTypeScreen
+			}
+			return ""
+		case <-us.closeCh:
+			return ""
+		}
+	}
+}
@@ -6,6 +6,7 @@ package rtc
 import (
 	"fmt"
 	"math"
+	"slices"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -18,42 +19,207 @@ import (
 
 const (
 	SimulcastLevelHigh        = "h"
+	SimulcastLevelMid         = "m"
 	SimulcastLevelLow         = "l"
 	SimulcastLevelDefault     = SimulcastLevelLow
 	levelChangeInitialBackoff = 10 * time.Second
+	levelChangeBackoffFactor  = 1.5
 	rateTolerance             = 0.9
 )
 
+// SimulcastBackoff holds the parameters controlling how often the simulcast
+// level received by a session can change.
+type SimulcastBackoff struct {
+	// Initial is the minimum time between the first level changes.
+	Initial time.Duration
+	// Max caps the time between level changes. A zero value means no cap.
+	Max time.Duration
+	// Factor is the multiplier applied to the backoff after each level change.
+	Factor float64
+}
+
+// IsValid validates the backoff parameters.
+func (b SimulcastBackoff) IsValid() error {
+	if b.Initial <= 0 {
+		return fmt.Errorf("invalid Initial value: should be a positive duration")
+	}
+
+	if b.Max != 0 && b.Max < b.Initial {
+		return fmt.Errorf("invalid Max value: should not be lower than Initial")
+	}
+
+	if b.Factor < simulcastBackoffFactorMin || b.Factor > simulcastBackoffFactorMax {
+		return fmt.Errorf("invalid Factor value: %g is not in allowed range [%g, %g]",
+			b.Factor, simulcastBackoffFactorMin, simulcastBackoffFactorMax)
+	}
+
+	return nil
+}
+
+// next returns the backoff following the given one.
+func (b SimulcastBackoff) next(backoff time.Duration) time.Duration {
+	backoff = time.Duration(float64(backoff) * b.Factor)
+	if b.Max > 0 && backoff > b.Max {
+		return b.Max
+	}
+	return backoff
+}
+
+// levelChangeBackoff tracks the backoff state of a session's simulcast level
+// changes.
+type levelChangeBackoff struct {
+	params       SimulcastBackoff
+	curr         time.Duration
+	lastChangeAt time.Time
+}
+
+func newLevelChangeBackoff(params SimulcastBackoff) levelChangeBackoff {
+	return levelChangeBackoff{
+		params: params,
+		curr:   params.Initial,
+	}
+}
+
+// active returns whether a level change at the given time would fall within
+// the backoff period.
+func (b *levelChangeBackoff) active(now time.Time) bool {
+	return now.Sub(b.lastChangeAt) < b.curr
+}
+
+// onLevelChange records a level change, growing the backoff.
+func (b *levelChangeBackoff) onLevelChange(now time.Time) {
+	b.lastChangeAt = now
+	b.curr = b.params.next(b.curr)
+}
+
+// simulcastLevels holds the supported simulcast levels, from lowest to
+// highest.
+var simulcastLevels = []string{
+	SimulcastLevelLow,
+	SimulcastLevelMid,
+	SimulcastLevelHigh,
+}
+
 var simulcastRates = map[string]int{
 	SimulcastLevelHigh: 2_500_000,
+	SimulcastLevelMid:  1_000_000,
 	SimulcastLevelLow:  500_000,
 }
 
 var simulcastRateMonitorSampleSizes = map[string]time.Duration{
 	SimulcastLevelHigh: 2 * time.Second,
+	SimulcastLevelMid:  3 * time.Second,
 	SimulcastLevelLow:  5 * time.Second,
 }
 
+func isValidSimulcastLevel(level string) bool {
+	return slices.Contains(simulcastLevels, level)
+}
+
 func getRateForSimulcastLevel(level string) int {
 	return simulcastRates[level]
 }
 
-func getSimulcastLevel(downRate, sourceRate int) string {
+// getSimulcastLevel returns the level to switch to from currLevel given the
+// estimated downstream rate and the rate of the source for the current
+// level. Levels are stepped through one at a time among the available ones,
+// which are expected to be sorted from lowest to highest.
+func getSimulcastLevel(levels []string, currLevel string, downRate, sourceRate int) string {
+	idx := slices.Index(levels, currLevel)
+	if idx < 0 {
+		return currLevel
+	}
+
 	if sourceRate > 0 && downRate > int(float32(sourceRate)*rateTolerance) {
-		return SimulcastLevelHigh
+		return levels[min(idx+1, len(levels)-1)]
 	}
 
-	return SimulcastLevelLow
+	return levels[max(idx-1, 0)]
 }
 
 func getSimulcastLevelForRate(rate int) string {
-	if rate > int(float32(simulcastRates[SimulcastLevelHigh])*rateTolerance) {
-		return SimulcastLevelHigh
+	for i := len(simulcastLevels) - 1; i > 0; i-- {
+		if rate > int(float32(simulcastRates[simulcastLevels[i]])*rateTolerance) {
+			return simulcastLevels[i]
+		}
 	}
 
 	return SimulcastLevelLow
 }
 
+// fitSimulcastLevel returns the highest of the available levels that is not
+// above the given one, falling back to the lowest available. Levels are
+// expected to be sorted from lowest to highest.
+func fitSimulcastLevel(levels []string, level string) string {
+	if len(levels) == 0 {
+		return level
+	}
+
+	fit := levels[0]
+	for _, lvl := range levels {
+		if slices.Index(simulcastLevels, lvl) <= slices.Index(simulcastLevels, level) {
+			fit = lvl
+		}
+	}
+
+	return fit
+}
+
+// getSimulcastLevels returns the levels found among the given RIDs, sorted
+// from lowest to highest.
+func getSimulcastLevels(rids []string) []string {
+	levels := make([]string, 0, len(simulcastLevels))
+	for _, level := range simulcastLevels {
+		if slices.Contains(rids, level) {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+// SetSessionSimulcastBackoff updates the simulcast level change backoff
+// parameters of a running session. The current backoff is reset to the new
+// initial value while the time of the last level change is preserved.
+func (s *Server) SetSessionSimulcastBackoff(sessionID string, backoff SimulcastBackoff) error {
+	if err := backoff.IsValid(); err != nil {
+		return err
+	}
+
+	s.mut.RLock()
+	cfg, ok := s.sessions[sessionID]
+	s.mut.RUnlock()
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	group := s.getGroup(cfg.GroupID)
+	if group == nil {
+		return ErrSessionNotFound
+	}
+	call := group.getCall(cfg.CallID)
+	if call == nil {
+		return ErrSessionNotFound
+	}
+	us := call.getSession(sessionID)
+	if us == nil {
+		return ErrSessionNotFound
+	}
+
+	us.mut.Lock()
+	us.levelChangeBackoff.params = backoff
+	us.levelChangeBackoff.curr = backoff.Initial
+	us.mut.Unlock()
+
+	s.log.Debug("simulcast backoff updated",
+		mlog.String("sessionID", sessionID),
+		mlog.Float("initial", backoff.Initial.Seconds()),
+		mlog.Float("max", backoff.Max.Seconds()),
+		mlog.Float("factor", backoff.Factor),
+	)
+
+	return nil
+}
+
 func (s *session) initBWEstimator(bwEstimator cc.BandwidthEstimator) {
 	s.mut.Lock()
 	s.bwEstimator = bwEstimator
@@ -70,17 +236,22 @@ func (s *session) initBWEstimator(bwEstimator cc.BandwidthEstimator) {
 		select {
 		case rateCh <- rate:
 		default:
-			s.log.Error("failed to send on rateCh", mlog.String("sessionID", s.cfg.SessionID))
+			s.call.drops.droppedMessage(s.cfg.GroupID, "rate", "target_bitrate", mlog.String("sessionID", s.cfg.SessionID))
 		}
 	})
 
 	currLevel := SimulcastLevelDefault
-	backoff := levelChangeInitialBackoff
-	var lastLevelChangeAt time.Time
 	var lastDelayRate int
 	var lastLossRate int
 
 	rateChangeHandler := func(rate int) {
+		// Forwarding the estimation to the client. If the previous value
+		// hasn't been sent yet we skip it as a more recent one will follow.
+		select {
+		case s.dcBWECh <- rate:
+		default:
+		}
+
 		stats := bwEstimator.GetStats()
 		lossRate, _ := stats["lossTargetBitrate"].(int)
 		delayRate, _ := stats["delayTargetBitrate"].(int)
@@ -93,6 +264,13 @@ func (s *session) initBWEstimator(bwEstimator cc.BandwidthEstimator) {
 		lastDelayRate = delayRate
 		lastLossRate = lossRate
 
+		now := time.Now()
+		s.mut.RLock()
+		backoff := s.levelChangeBackoff.curr
+		lastLevelChangeAt := s.levelChangeBackoff.lastChangeAt
+		inBackoff := s.levelChangeBackoff.active(now)
+		s.mut.RUnlock()
+
 		s.log.Debug("sender bwe",
 			mlog.String("sessionID", s.cfg.SessionID),
 			mlog.Int("delayRate", delayRate),
@@ -100,7 +278,7 @@ func (s *session) initBWEstimator(bwEstimator cc.BandwidthEstimator) {
 			mlog.String("averageLoss", fmt.Sprintf("%.5f", averageLoss)),
 			mlog.String("state", state),
 			mlog.Float("backoff", backoff.Seconds()),
-			mlog.Float("lastLevelChange", time.Since(lastLevelChangeAt).Seconds()),
+			mlog.Float("lastLevelChange", now.Sub(lastLevelChangeAt).Seconds()),
 			mlog.Float("rateDiff", rateDiff),
 		)
 
@@ -108,7 +286,7 @@ func (s *session) initBWEstimator(bwEstimator cc.BandwidthEstimator) {
 		// before attempting to change level again, unless we are serving the
 		// high rate track and there was a drop in the estimated rate
 		// in which case we want to act as quickly as possible.
-		if time.Since(lastLevelChangeAt) < backoff && (currLevel == SimulcastLevelLow || rateDiff >= 0) {
+		if inBackoff && (currLevel == SimulcastLevelLow || rateDiff >= 0) {
 			s.log.Debug("skipping bitrate check due to backoff, no drop", mlog.String("sessionID", s.cfg.SessionID))
 			return
 		}
@@ -117,9 +295,11 @@ func (s *session) initBWEstimator(bwEstimator cc.BandwidthEstimator) {
 			// Adding some exponential backoff to avoid switching levels too often
 			// if either client's network conditions fluctuate too often or the client has
 			// not enough bandwidth to handle the higher rate track.
-			backoff = backoff + backoff/2
+			s.mut.Lock()
+			s.levelChangeBackoff.onLevelChange(time.Now())
+			s.mut.Unlock()
 
-			if newLevel == SimulcastLevelHigh {
+			if slices.Index(simulcastLevels, newLevel) > slices.Index(simulcastLevels, currLevel) {
 				// On upgrading level we update the target rate to better reflect the
 				// actual rate of the source.
 				bwEstimator.SetTargetBitrate(newRate)
@@ -130,8 +310,9 @@ func (s *session) initBWEstimator(bwEstimator cc.BandwidthEstimator) {
 			lastDelayRate = newRate
 			lastLossRate = newRate
 
-			lastLevelChangeAt = time.Now()
 			currLevel = newLevel
+
+			s.sendSimulcastLevelChange(newLevel)
 		}
 	}
 
@@ -151,6 +332,24 @@ func (s *session) initBWEstimator(bwEstimator cc.BandwidthEstimator) {
 	}()
 }
 
+// sendSimulcastLevelChange queues a notification for the client about the
+// simulcast level it's now receiving the screen track at. Only the latest
+// level is relevant so any pending notification gets replaced.
+func (s *session) sendSimulcastLevelChange(level string) {
+	for {
+		select {
+		case s.dcLevelCh <- level:
+			return
+		default:
+		}
+
+		select {
+		case <-s.dcLevelCh:
+		default:
+		}
+	}
+}
+
 func (s *session) handleSenderBitrateChange(downRate int, lossRate int) (bool, int, string) {
 	screenSession := s.call.getScreenSession()
 	if screenSession == nil {
@@ -192,7 +391,49 @@ func (s *session) handleSenderBitrateChange(downRate int, lossRate int) (bool, i
 		return false, 0, ""
 	}
 
-	newLevel := getSimulcastLevel(downRate, currSourceRate)
+	levels := screenSession.getScreenSimulcastLevels(mimeType)
+	if len(levels) == 0 {
+		// The screen tracks may have been removed in the meantime.
+		return false, 0, ""
+	}
+
+	// Receivers of demoted tracks that can't be thinned are kept at the
+	// lowest level for as long as the demotion lasts.
+	layerSwitch, demotedTrack := screenSession.getScreenLayerSwitch(localTrack)
+	s.mut.Lock()
+	if !layerSwitch {
+		s.screenDemoted = false
+	} else if demotedTrack {
+		s.screenDemoted = true
+	}
+	screenDemoted := s.screenDemoted
+	maxLevel := s.capSimulcastLevel(SimulcastLevelHigh, screenSession.cfg.SessionID)
+	s.mut.Unlock()
+	if screenDemoted {
+		maxLevel = SimulcastLevelLow
+	}
+
+	// Levels above the preferred one, if any, are not eligible.
+	cappedLevels := slices.DeleteFunc(slices.Clone(levels), func(level string) bool {
+		return slices.Index(simulcastLevels, level) > slices.Index(simulcastLevels, maxLevel)
+	})
+	if len(cappedLevels) == 0 {
+		cappedLevels = levels[:1]
+	}
+
+	var newLevel string
+	overCap := !slices.Contains(cappedLevels, currLevel)
+	fixedLevel := s.call.getFixedSimulcastLevel()
+	if fixedLevel != "" {
+		// A level pinned for the whole call takes precedence over the
+		// bandwidth estimation.
+		newLevel = fitSimulcastLevel(levels, fixedLevel)
+	} else if overCap {
+		// The preferred level was lowered so we move to it straight away.
+		newLevel = cappedLevels[len(cappedLevels)-1]
+	} else {
+		newLevel = getSimulcastLevel(cappedLevels, currLevel, downRate, currSourceRate)
+	}
 	if newLevel == currLevel {
 		// no level change, nothing to do
 		return false, 0, ""
@@ -200,7 +441,9 @@ func (s *session) handleSenderBitrateChange(downRate int, lossRate int) (bool, i
 
 	// If the loss based rate estimation is greater than the source rate we avoid
 	// potentially downgrading the level due to fluctuating delay rate estimation.
-	if currLevel == SimulcastLevelHigh && lossRate > int(float32(currSourceRate)*rateTolerance) {
+	// This doesn't apply if the downgrade was requested by the client.
+	isDowngrade := slices.Index(simulcastLevels, newLevel) < slices.Index(simulcastLevels, currLevel)
+	if isDowngrade && !overCap && fixedLevel == "" && lossRate > int(float32(currSourceRate)*rateTolerance) {
 		s.log.Debug("skipping level downgrade, no loss", mlog.String("sessionID", s.cfg.SessionID))
 		return false, 0, ""
 	}
@@ -226,18 +469,22 @@ func (s *session) handleSenderBitrateChange(downRate int, lossRate int) (bool, i
 		mlog.Int("newSourceRate", sourceRate),
 	)
 
+	// Levels share the codec so the track is swapped in place, keeping the
+	// receiver slot (ServerConfig.MaxReceiversPerPublisher) and avoiding
+	// a renegotiation.
 	select {
-	case s.tracksCh <- trackActionContext{action: trackActionRemove, track: currTrack}:
+	case s.tracksCh <- trackActionContext{action: trackActionAdd, track: newTrack, replace: true}:
 	default:
-		s.log.Error("failed to send screen track: channel is full", mlog.String("sessionID", s.cfg.SessionID))
+		s.call.drops.droppedMessage(s.cfg.GroupID, "tracks", "screen_track", mlog.String("sessionID", s.cfg.SessionID))
 		return false, 0, ""
 	}
 
-	select {
-	case s.tracksCh <- trackActionContext{action: trackActionAdd, track: newTrack}:
-	default:
-		s.log.Error("failed to send screen track: channel is full", mlog.String("sessionID", s.cfg.SessionID))
-		return false, 0, ""
+	if screenDemoted && fixedLevel == "" {
+		// The switch replaces frame dropping so receivers shouldn't have to
+		// wait for the next keyframe.
+		if err := screenSession.requestScreenKeyFrame(mimeType, newLevel); err != nil {
+			s.log.Error("failed to request keyframe", mlog.Err(err), mlog.String("sessionID", s.cfg.SessionID))
+		}
 	}
 
 	return true, sourceRate, newLevel
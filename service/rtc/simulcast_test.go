@@ -0,0 +1,346 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/interceptor/pkg/gcc"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSimulcastLevelForRate(t *testing.T) {
+	tcs := []struct {
+		rate  int
+		level string
+	}{
+		{0, SimulcastLevelLow},
+		{500_000, SimulcastLevelLow},
+		{900_000, SimulcastLevelLow},
+		{900_001, SimulcastLevelMid},
+		{2_000_000, SimulcastLevelMid},
+		{2_250_000, SimulcastLevelMid},
+		{2_250_001, SimulcastLevelHigh},
+		{5_000_000, SimulcastLevelHigh},
+	}
+
+	for _, tc := range tcs {
+		require.Equal(t, tc.level, getSimulcastLevelForRate(tc.rate), "rate %d", tc.rate)
+	}
+}
+
+func TestGetSimulcastLevel(t *testing.T) {
+	allLevels := []string{SimulcastLevelLow, SimulcastLevelMid, SimulcastLevelHigh}
+
+	t.Run("transitions", func(t *testing.T) {
+		// Driving the estimated rate up and down while assuming each level's
+		// source rate matches its nominal one.
+		steps := []struct {
+			downRate int
+			level    string
+		}{
+			{300_000, SimulcastLevelLow},
+			{600_000, SimulcastLevelMid},
+			{800_000, SimulcastLevelLow},
+			{1_000_000, SimulcastLevelMid},
+			{1_000_000, SimulcastLevelHigh},
+			{2_600_000, SimulcastLevelHigh},
+			{4_000_000, SimulcastLevelHigh},
+			// A large drop only moves one level down at a time.
+			{200_000, SimulcastLevelMid},
+			{200_000, SimulcastLevelLow},
+			{200_000, SimulcastLevelLow},
+		}
+
+		level := SimulcastLevelLow
+		for i, step := range steps {
+			level = getSimulcastLevel(allLevels, level, step.downRate, getRateForSimulcastLevel(level))
+			require.Equal(t, step.level, level, "step %d", i)
+		}
+	})
+
+	t.Run("missing source rate", func(t *testing.T) {
+		require.Equal(t, SimulcastLevelLow, getSimulcastLevel(allLevels, SimulcastLevelMid, 5_000_000, 0))
+	})
+
+	t.Run("unavailable levels are skipped", func(t *testing.T) {
+		levels := []string{SimulcastLevelLow, SimulcastLevelHigh}
+		require.Equal(t, SimulcastLevelHigh, getSimulcastLevel(levels, SimulcastLevelLow, 600_000, 500_000))
+		require.Equal(t, SimulcastLevelLow, getSimulcastLevel(levels, SimulcastLevelHigh, 600_000, 2_500_000))
+	})
+
+	t.Run("unknown current level", func(t *testing.T) {
+		levels := []string{SimulcastLevelLow, SimulcastLevelHigh}
+		require.Equal(t, SimulcastLevelMid, getSimulcastLevel(levels, SimulcastLevelMid, 5_000_000, 1_000_000))
+	})
+}
+
+func TestFitSimulcastLevel(t *testing.T) {
+	allLevels := []string{SimulcastLevelLow, SimulcastLevelMid, SimulcastLevelHigh}
+	require.Equal(t, SimulcastLevelHigh, fitSimulcastLevel(allLevels, SimulcastLevelHigh))
+	require.Equal(t, SimulcastLevelMid, fitSimulcastLevel(allLevels, SimulcastLevelMid))
+	require.Equal(t, SimulcastLevelLow, fitSimulcastLevel(allLevels, SimulcastLevelLow))
+
+	twoLevels := []string{SimulcastLevelLow, SimulcastLevelHigh}
+	require.Equal(t, SimulcastLevelLow, fitSimulcastLevel(twoLevels, SimulcastLevelMid))
+	require.Equal(t, SimulcastLevelHigh, fitSimulcastLevel(twoLevels, SimulcastLevelHigh))
+
+	require.Equal(t, SimulcastLevelHigh, fitSimulcastLevel([]string{SimulcastLevelHigh}, SimulcastLevelLow))
+	require.Equal(t, SimulcastLevelMid, fitSimulcastLevel(nil, SimulcastLevelMid))
+}
+
+func TestGetSimulcastLevels(t *testing.T) {
+	require.Empty(t, getSimulcastLevels(nil))
+	require.Empty(t, getSimulcastLevels([]string{""}))
+	require.Equal(t, []string{SimulcastLevelLow, SimulcastLevelHigh}, getSimulcastLevels([]string{"h", "l"}))
+	require.Equal(t, []string{SimulcastLevelLow, SimulcastLevelMid, SimulcastLevelHigh}, getSimulcastLevels([]string{"m", "h", "l", "x"}))
+}
+
+func TestSimulcastBackoffIsValid(t *testing.T) {
+	t.Run("invalid Initial", func(t *testing.T) {
+		err := SimulcastBackoff{Factor: 1.5}.IsValid()
+		require.EqualError(t, err, "invalid Initial value: should be a positive duration")
+	})
+
+	t.Run("invalid Max", func(t *testing.T) {
+		err := SimulcastBackoff{Initial: 2 * time.Second, Max: time.Second, Factor: 1.5}.IsValid()
+		require.EqualError(t, err, "invalid Max value: should not be lower than Initial")
+	})
+
+	t.Run("invalid Factor", func(t *testing.T) {
+		err := SimulcastBackoff{Initial: time.Second, Factor: 0.5}.IsValid()
+		require.EqualError(t, err, "invalid Factor value: 0.5 is not in allowed range [1, 4]")
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		err := SimulcastBackoff{Initial: time.Second, Max: 4 * time.Second, Factor: 2}.IsValid()
+		require.NoError(t, err)
+	})
+}
+
+func TestLevelChangeBackoff(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		b := newLevelChangeBackoff(ServerConfig{}.getSimulcastBackoff())
+		now := time.Now()
+
+		// No level change yet.
+		require.False(t, b.active(now))
+
+		b.onLevelChange(now)
+		require.True(t, b.active(now.Add(14*time.Second)))
+		require.False(t, b.active(now.Add(15*time.Second)))
+
+		b.onLevelChange(now)
+		require.True(t, b.active(now.Add(22*time.Second)))
+		require.False(t, b.active(now.Add(22500*time.Millisecond)))
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		cfg := ServerConfig{
+			SimulcastBackoffInitialMs: 1000,
+			SimulcastBackoffMaxMs:     3000,
+			SimulcastBackoffFactor:    2,
+		}
+		b := newLevelChangeBackoff(cfg.getSimulcastBackoff())
+		now := time.Now()
+
+		expected := []time.Duration{2 * time.Second, 3 * time.Second, 3 * time.Second}
+		for _, backoff := range expected {
+			b.onLevelChange(now)
+			require.True(t, b.active(now.Add(backoff-time.Millisecond)))
+			require.False(t, b.active(now.Add(backoff)))
+		}
+	})
+
+	t.Run("constant", func(t *testing.T) {
+		b := newLevelChangeBackoff(SimulcastBackoff{Initial: time.Second, Factor: 1})
+		now := time.Now()
+
+		for i := 0; i < 5; i++ {
+			b.onLevelChange(now)
+			require.True(t, b.active(now.Add(999*time.Millisecond)))
+			require.False(t, b.active(now.Add(time.Second)))
+		}
+	})
+}
+
+func TestSetSessionSimulcastBackoff(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.SimulcastBackoffInitialMs = 2000
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	t.Run("session not found", func(t *testing.T) {
+		err := s.SetSessionSimulcastBackoff(random.NewID(), SimulcastBackoff{Initial: time.Second, Factor: 1})
+		require.ErrorIs(t, err, ErrSessionNotFound)
+	})
+
+	cfg := SessionConfig{
+		GroupID:   random.NewID(),
+		CallID:    random.NewID(),
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+	err = s.InitSession(cfg, nil)
+	require.NoError(t, err)
+	defer func() {
+		err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+	require.NotNil(t, us)
+
+	t.Run("initialized from config", func(t *testing.T) {
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		require.Equal(t, 2*time.Second, us.levelChangeBackoff.curr)
+		require.Equal(t, SimulcastBackoff{Initial: 2 * time.Second, Factor: levelChangeBackoffFactor}, us.levelChangeBackoff.params)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		err := s.SetSessionSimulcastBackoff(cfg.SessionID, SimulcastBackoff{Initial: time.Second})
+		require.EqualError(t, err, "invalid Factor value: 0 is not in allowed range [1, 4]")
+	})
+
+	t.Run("updated", func(t *testing.T) {
+		now := time.Now()
+		us.mut.Lock()
+		us.levelChangeBackoff.onLevelChange(now)
+		us.mut.Unlock()
+
+		backoff := SimulcastBackoff{Initial: 500 * time.Millisecond, Max: time.Second, Factor: 3}
+		err := s.SetSessionSimulcastBackoff(cfg.SessionID, backoff)
+		require.NoError(t, err)
+
+		us.mut.Lock()
+		defer us.mut.Unlock()
+		require.Equal(t, backoff, us.levelChangeBackoff.params)
+		require.True(t, us.levelChangeBackoff.active(now.Add(499*time.Millisecond)))
+		require.False(t, us.levelChangeBackoff.active(now.Add(500*time.Millisecond)))
+
+		us.levelChangeBackoff.onLevelChange(now)
+		require.True(t, us.levelChangeBackoff.active(now.Add(999*time.Millisecond)))
+		require.False(t, us.levelChangeBackoff.active(now.Add(time.Second)))
+	})
+}
+
+func TestCongestionControlDisabled(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	initSession := func(t *testing.T, props SessionProps) *session {
+		t.Helper()
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+			Props:     props,
+		}
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		})
+		return s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+	}
+
+	// newEstimator returns an estimator simulating a constrained network.
+	newEstimator := func(t *testing.T) cc.BandwidthEstimator {
+		t.Helper()
+		rate := getRateForSimulcastLevel(SimulcastLevelLow)
+		bwEstimator, err := gcc.NewSendSideBWE(
+			gcc.SendSideBWEInitialBitrate(rate),
+			gcc.SendSideBWEMinBitrate(rate),
+			gcc.SendSideBWEMaxBitrate(rate),
+		)
+		require.NoError(t, err)
+		return bwEstimator
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		us := initSession(t, nil)
+		us.mut.Lock()
+		require.NotNil(t, us.bwEstimator)
+		us.bwEstimator = newEstimator(t)
+		us.mut.Unlock()
+		require.Equal(t, SimulcastLevelLow, us.getExpectedSimulcastLevel(""))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		us := initSession(t, SessionProps{"disableCongestionControl": true})
+		us.mut.RLock()
+		require.Nil(t, us.bwEstimator)
+		us.mut.RUnlock()
+		require.Equal(t, SimulcastLevelHigh, us.getExpectedSimulcastLevel(""))
+
+		// Network conditions are ignored.
+		us.mut.Lock()
+		us.bwEstimator = newEstimator(t)
+		us.mut.Unlock()
+		require.Equal(t, SimulcastLevelHigh, us.getExpectedSimulcastLevel(""))
+
+		// Preferences still apply.
+		require.NoError(t, us.setPreferredSimulcastLevel(SimulcastLevelMid))
+		require.Equal(t, SimulcastLevelMid, us.getExpectedSimulcastLevel(""))
+	})
+
+	t.Run("session api", func(t *testing.T) {
+		s.cfg.EnablePacing = true
+		defer func() { s.cfg.EnablePacing = false }()
+
+		getOffer := func(t *testing.T, congestionControl bool) string {
+			t.Helper()
+			sa, err := s.getSessionAPI(false, congestionControl)
+			require.NoError(t, err)
+			require.Equal(t, congestionControl, sa.congestionControl)
+			require.Equal(t, congestionControl, sa.bwEstimatorCh != nil)
+			require.Equal(t, congestionControl, sa.pacer != nil)
+
+			pc, err := sa.api.NewPeerConnection(webrtc.Configuration{})
+			require.NoError(t, err)
+			defer pc.Close()
+			_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo)
+			require.NoError(t, err)
+			offer, err := pc.CreateOffer(nil)
+			require.NoError(t, err)
+			return offer.SDP
+		}
+
+		require.Contains(t, getOffer(t, true), "transport-cc")
+		require.NotContains(t, getOffer(t, false), "transport-cc")
+	})
+}
+
+func TestSendSimulcastLevelChange(t *testing.T) {
+	us := &session{dcLevelCh: make(chan string, 1)}
+
+	us.sendSimulcastLevelChange(SimulcastLevelLow)
+	require.Equal(t, SimulcastLevelLow, <-us.dcLevelCh)
+
+	// A pending notification gets replaced by the latest level.
+	us.sendSimulcastLevelChange(SimulcastLevelLow)
+	us.sendSimulcastLevelChange(SimulcastLevelMid)
+	us.sendSimulcastLevelChange(SimulcastLevelHigh)
+	require.Equal(t, SimulcastLevelHigh, <-us.dcLevelCh)
+
+	select {
+	case level := <-us.dcLevelCh:
+		require.Fail(t, "unexpected level change", level)
+	default:
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"sync/atomic"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// statsInterceptor keeps packet and NACK counters for a peer connection.
+// Counters are updated atomically so that reading them never blocks the
+// media paths.
+type statsInterceptor struct {
+	interceptor.NoOp
+
+	packetsReceived atomic.Uint64
+	packetsSent     atomic.Uint64
+	nacksSent       atomic.Uint64
+	nacksReceived   atomic.Uint64
+}
+
+func newStatsInterceptor() *statsInterceptor {
+	return &statsInterceptor{}
+}
+
+// NewInterceptor implements interceptor.Factory. The registry is built once
+// per peer connection so we can return the same instance.
+func (i *statsInterceptor) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+	return i, nil
+}
+
+func (i *statsInterceptor) BindRTCPReader(reader interceptor.RTCPReader) interceptor.RTCPReader {
+	return interceptor.RTCPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		n, attr, err := reader.Read(b, a)
+		if err != nil {
+			return n, attr, err
+		}
+
+		if attr == nil {
+			attr = make(interceptor.Attributes)
+		}
+		pkts, err := attr.GetRTCPPackets(b[:n])
+		if err != nil {
+			// Parsing failures are handled further down the chain.
+			return n, attr, nil
+		}
+		i.nacksReceived.Add(countNACKs(pkts))
+
+		return n, attr, nil
+	})
+}
+
+func (i *statsInterceptor) BindRTCPWriter(writer interceptor.RTCPWriter) interceptor.RTCPWriter {
+	return interceptor.RTCPWriterFunc(func(pkts []rtcp.Packet, attributes interceptor.Attributes) (int, error) {
+		i.nacksSent.Add(countNACKs(pkts))
+		return writer.Write(pkts, attributes)
+	})
+}
+
+func (i *statsInterceptor) BindLocalStream(_ *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		n, err := writer.Write(header, payload, attributes)
+		if err == nil {
+			i.packetsSent.Add(1)
+		}
+		return n, err
+	})
+}
+
+func (i *statsInterceptor) BindRemoteStream(_ *interceptor.StreamInfo, reader interceptor.RTPReader) interceptor.RTPReader {
+	return interceptor.RTPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		n, attr, err := reader.Read(b, a)
+		if err == nil {
+			i.packetsReceived.Add(1)
+		}
+		return n, attr, err
+	})
+}
+
+func countNACKs(pkts []rtcp.Packet) uint64 {
+	var count uint64
+	for _, pkt := range pkts {
+		if _, ok := pkt.(*rtcp.TransportLayerNack); ok {
+			count++
+		}
+	}
+	return count
+}
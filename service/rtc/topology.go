@@ -0,0 +1,72 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+var ErrCallNotFound = errors.New("call not found")
+
+// CallTopology describes how media is being forwarded among the sessions
+// connected to a call.
+type CallTopology struct {
+	CallID   string            `json:"callID"`
+	Sessions []SessionTopology `json:"sessions"`
+}
+
+// SessionTopology describes the media a session is currently receiving.
+type SessionTopology struct {
+	SessionID string `json:"sessionID"`
+	UserID    string `json:"userID"`
+	// Receiving maps remote session IDs to the types of tracks (e.g. voice,
+	// screen) received from them.
+	Receiving map[string][]string `json:"receiving"`
+}
+
+// GetCallTopology returns the forwarding topology for the given call.
+func (s *Server) GetCallTopology(groupID, callID string) (CallTopology, error) {
+	topology := CallTopology{
+		CallID: callID,
+	}
+
+	c := s.getCallByID(groupID, callID)
+	if c == nil {
+		return topology, ErrCallNotFound
+	}
+
+	c.iterSessions(func(us *session) {
+		st := SessionTopology{
+			SessionID: us.cfg.SessionID,
+			UserID:    us.cfg.UserID,
+			Receiving: map[string][]string{},
+		}
+
+		us.mut.RLock()
+		for trackID := range us.rxTracks {
+			tt, senderID, err := parseTrackID(trackID)
+			if err != nil {
+				us.log.Warn("unexpected track ID", mlog.String("trackID", trackID), mlog.Err(err))
+				continue
+			}
+			st.Receiving[senderID] = append(st.Receiving[senderID], string(tt))
+		}
+		us.mut.RUnlock()
+
+		for _, types := range st.Receiving {
+			sort.Strings(types)
+		}
+
+		topology.Sessions = append(topology.Sessions, st)
+	})
+
+	sort.Slice(topology.Sessions, func(i, j int) bool {
+		return topology.Sessions[i].SessionID < topology.Sessions[j].SessionID
+	})
+
+	return topology, nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"testing"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCallTopology(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	t.Run("call not found", func(t *testing.T) {
+		_, err := s.GetCallTopology(random.NewID(), random.NewID())
+		require.ErrorIs(t, err, ErrCallNotFound)
+	})
+
+	t.Run("known call", func(t *testing.T) {
+		groupID := random.NewID()
+		callID := random.NewID()
+		sessionIDs := []string{"sessionA", "sessionB", "sessionC"}
+
+		for _, sessionID := range sessionIDs {
+			cfg := SessionConfig{
+				GroupID:   groupID,
+				CallID:    callID,
+				UserID:    "user_" + sessionID,
+				SessionID: sessionID,
+			}
+			err := s.InitSession(cfg, nil)
+			require.NoError(t, err)
+			defer func() {
+				err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+				require.NoError(t, err)
+			}()
+		}
+
+		addRxTrack := func(t *testing.T, receiverID string, tt trackType, senderID string) {
+			t.Helper()
+			kind := webrtc.MimeTypeOpus
+			if tt == trackTypeScreen {
+				kind = webrtc.MimeTypeVP8
+			}
+			track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: kind},
+				genTrackID(tt, senderID, 0), random.NewID())
+			require.NoError(t, err)
+
+			us := s.getGroup(groupID).getCall(callID).getSession(receiverID)
+			require.NotNil(t, us)
+			us.mut.Lock()
+			us.rxTracks[track.ID()] = track
+			us.mut.Unlock()
+		}
+
+		// sessionA is sharing screen and unmuted, sessionB is unmuted,
+		// sessionC is only listening.
+		addRxTrack(t, "sessionA", trackTypeVoice, "sessionB")
+		addRxTrack(t, "sessionB", trackTypeVoice, "sessionA")
+		addRxTrack(t, "sessionB", trackTypeScreen, "sessionA")
+		addRxTrack(t, "sessionC", trackTypeVoice, "sessionA")
+		addRxTrack(t, "sessionC", trackTypeScreen, "sessionA")
+		addRxTrack(t, "sessionC", trackTypeVoice, "sessionB")
+
+		_, err := s.GetCallTopology(random.NewID(), callID)
+		require.ErrorIs(t, err, ErrCallNotFound)
+
+		topology, err := s.GetCallTopology(groupID, callID)
+		require.NoError(t, err)
+		require.Equal(t, CallTopology{
+			CallID: callID,
+			Sessions: []SessionTopology{
+				{
+					SessionID: "sessionA",
+					UserID:    "user_sessionA",
+					Receiving: map[string][]string{
+						"sessionB": {"voice"},
+					},
+				},
+				{
+					SessionID: "sessionB",
+					UserID:    "user_sessionB",
+					Receiving: map[string][]string{
+						"sessionA": {"screen", "voice"},
+					},
+				},
+				{
+					SessionID: "sessionC",
+					UserID:    "user_sessionC",
+					Receiving: map[string][]string{
+						"sessionA": {"screen", "voice"},
+						"sessionB": {"voice"},
+					},
+				},
+			},
+		}, topology)
+	})
+}
@@ -12,9 +12,15 @@ type trackAction int
 const (
 	trackActionAdd trackAction = iota + 1
 	trackActionRemove
+	trackActionICERestart
 )
 
 type trackActionContext struct {
 	action trackAction
 	track  webrtc.TrackLocal
+	// replace, when set on a trackActionAdd of a screen track, swaps the
+	// screen track currently being sent to the session, if any, with the given
+	// one without renegotiating (e.g. on resolution switches). Otherwise the
+	// track gets added as usual.
+	replace bool
 }
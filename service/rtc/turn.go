@@ -74,7 +74,7 @@ func GenTURNConfigs(turnServers ICEServers, username, secret string, expiryMinut
 			return nil, err
 		}
 		configs = append(configs, ICEServerConfig{
-			URLs:       cfg.URLs,
+			URLs:       cfg.GetURLs(),
 			Username:   username,
 			Credential: password,
 		})
@@ -0,0 +1,106 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mattermost/rtcd/service/rtc/dc"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// turnCredentialsRefreshRatio is the fraction of the TURN credentials
+// lifetime after which they get refreshed for sessions still connected.
+var turnCredentialsRefreshRatio = 0.8
+
+// generatesTURNCredentials returns whether short-lived TURN credentials are
+// generated for sessions.
+func (s *Server) generatesTURNCredentials() bool {
+	iceServers, turnCfg := s.getICEConfig()
+	if turnCfg.StaticAuthSecret == "" {
+		return false
+	}
+	for _, iceCfg := range iceServers {
+		if iceCfg.IsTURN() && iceCfg.Username == "" && iceCfg.Credential == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// getTURNCredentialsExpiration returns the lifetime of generated TURN
+// credentials.
+func (s *Server) getTURNCredentialsExpiration() time.Duration {
+	_, turnCfg := s.getICEConfig()
+	return time.Duration(turnCfg.CredentialsExpirationMinutes) * time.Minute
+}
+
+// handleTURNCredentialsRefresh periodically generates new TURN credentials
+// for the given session, before the previous ones expire, and pushes them to
+// the client through the data channel so that they can be used for any
+// future ICE restart.
+func (s *Server) handleTURNCredentialsRefresh(us *session) {
+	for {
+		// Read on every iteration as it can change (UpdateICEConfig).
+		refreshAfter := time.Duration(float64(s.getTURNCredentialsExpiration()) * turnCredentialsRefreshRatio)
+
+		us.mut.RLock()
+		issuedAt := us.turnCredentialsIssuedAt
+		us.mut.RUnlock()
+
+		timer := time.NewTimer(time.Until(issuedAt.Add(refreshAfter)))
+		select {
+		case <-timer.C:
+		case <-us.closeCh:
+			timer.Stop()
+			return
+		}
+
+		issuedAt = time.Now()
+		iceServers := s.getICEServers(us.cfg.SessionID)
+
+		us.mut.Lock()
+		us.turnCredentialsIssuedAt = issuedAt
+		us.mut.Unlock()
+
+		s.log.Debug("refreshing TURN credentials", mlog.String("sessionID", us.cfg.SessionID))
+
+		// Only the most recent credentials are worth sending so we replace any
+		// that haven't been delivered yet (e.g. data channel not open).
+		select {
+		case <-us.dcICEServersCh:
+		default:
+		}
+		select {
+		case us.dcICEServersCh <- iceServers:
+		default:
+			s.droppedMessage(us.cfg.GroupID, "dc_ice_servers", "ice_servers", mlog.String("sessionID", us.cfg.SessionID))
+		}
+	}
+}
+
+// newICEServersMessage returns the data channel message for the given ICE
+// servers. Credentials generated for the given session are sent along with
+// their lifetime.
+func newICEServersMessage(iceServers []webrtc.ICEServer, sessionID string, ttl time.Duration) dc.MessageICEServers {
+	msg := make(dc.MessageICEServers, 0, len(iceServers))
+	for _, srv := range iceServers {
+		credential, _ := srv.Credential.(string)
+		msgSrv := dc.MessageICEServer{
+			URLs:       srv.URLs,
+			Username:   srv.Username,
+			Credential: credential,
+		}
+		// Generated usernames are in the form of <expiration ts>:<sessionID>.
+		if strings.HasSuffix(srv.Username, ":"+sessionID) {
+			msgSrv.TTL = int64(ttl.Seconds())
+		}
+		msg = append(msg, msgSrv)
+	}
+	return msg
+}
@@ -4,10 +4,19 @@
 package rtc
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/netip"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc/dc"
+
+	"github.com/pion/turn/v4"
+	"github.com/pion/webrtc/v4"
 	"github.com/stretchr/testify/require"
 )
 
@@ -97,4 +106,425 @@ func TestGenTURNConfigs(t *testing.T) {
 		require.NotEmpty(t, configs[1].Username)
 		require.NotEmpty(t, configs[1].Credential)
 	})
+	t.Run("TLS", func(t *testing.T) {
+		servers := ICEServers{
+			ICEServerConfig{
+				URLs: []string{"turn:turn.example.com:443?transport=tcp"},
+				TLS:  true,
+			},
+		}
+		configs, err := GenTURNConfigs(servers, "username", "secret", 1440)
+		require.NoError(t, err)
+		require.Len(t, configs, 1)
+		require.Equal(t, []string{"turns:turn.example.com:443?transport=tcp"}, configs[0].URLs)
+		require.NotEmpty(t, configs[0].Username)
+		require.NotEmpty(t, configs[0].Credential)
+	})
+}
+
+func TestGetICEServersTURNAdvertisePolicy(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.ICEServers = ICEServers{
+		ICEServerConfig{
+			URLs: []string{"stun:stun.example.com:3478"},
+		},
+		ICEServerConfig{
+			URLs: []string{"turn:turn.example.com:3478"},
+		},
+	}
+	s.cfg.TURNConfig.StaticAuthSecret = "secret"
+	s.cfg.TURNConfig.CredentialsExpirationMinutes = 1440
+
+	localAddr := netip.MustParseAddr("10.0.0.1")
+	s.localIPs = []netip.Addr{localAddr}
+
+	getURLs := func() []string {
+		var urls []string
+		for _, srv := range s.getICEServers("sessionID") {
+			urls = append(urls, srv.URLs...)
+		}
+		return urls
+	}
+
+	t.Run("always", func(t *testing.T) {
+		s.cfg.TURNAdvertisePolicy = TURNAdvertisePolicyAlways
+		s.setPublicAddrsMap(map[netip.Addr]string{localAddr: localAddr.String()})
+		require.Equal(t, []string{"stun:stun.example.com:3478", "turn:turn.example.com:3478"}, getURLs())
+	})
+
+	t.Run("natOnly with direct mapping", func(t *testing.T) {
+		s.cfg.TURNAdvertisePolicy = TURNAdvertisePolicyNATOnly
+		s.setPublicAddrsMap(map[netip.Addr]string{localAddr: localAddr.String()})
+		require.Equal(t, []string{"stun:stun.example.com:3478"}, getURLs())
+	})
+
+	t.Run("natOnly behind NAT", func(t *testing.T) {
+		s.cfg.TURNAdvertisePolicy = TURNAdvertisePolicyNATOnly
+		s.setPublicAddrsMap(map[netip.Addr]string{localAddr: "8.8.8.8"})
+		require.Equal(t, []string{"stun:stun.example.com:3478", "turn:turn.example.com:3478"}, getURLs())
+	})
+
+	t.Run("natOnly unknown mapping", func(t *testing.T) {
+		s.cfg.TURNAdvertisePolicy = TURNAdvertisePolicyNATOnly
+		s.setPublicAddrsMap(map[netip.Addr]string{})
+		require.Equal(t, []string{"stun:stun.example.com:3478", "turn:turn.example.com:3478"}, getURLs())
+	})
+
+	t.Run("TLS", func(t *testing.T) {
+		s.cfg.TURNAdvertisePolicy = TURNAdvertisePolicyAlways
+		s.cfg.ICEServers[1].TLS = true
+		defer func() { s.cfg.ICEServers[1].TLS = false }()
+		require.Equal(t, []string{"stun:stun.example.com:3478", "turns:turn.example.com:3478"}, getURLs())
+	})
+}
+
+func TestTURNCredentialsRefresh(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.ICEServers = ICEServers{
+		ICEServerConfig{
+			URLs: []string{"turn:turn.example.com:3478"},
+		},
+	}
+	s.cfg.TURNConfig.StaticAuthSecret = "secret"
+	s.cfg.TURNConfig.CredentialsExpirationMinutes = 1
+
+	// Refreshing a bit more than a second after issuing so that the new
+	// credentials get a different expiration timestamp.
+	defaultRatio := turnCredentialsRefreshRatio
+	turnCredentialsRefreshRatio = 0.02
+	defer func() {
+		turnCredentialsRefreshRatio = defaultRatio
+	}()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	cfg := SessionConfig{
+		GroupID:   random.NewID(),
+		CallID:    random.NewID(),
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer pc.Close()
+
+	iceServersCh := make(chan dc.MessageICEServers, 10)
+	dataCh, err := pc.CreateDataChannel("calls-dc", nil)
+	require.NoError(t, err)
+	dataCh.OnMessage(func(msg webrtc.DataChannelMessage) {
+		mt, payload, err := dc.DecodeMessage(msg.Data)
+		require.NoError(t, err)
+		if mt == dc.MessageTypeICEServers {
+			iceServersCh <- payload.(dc.MessageICEServers)
+		}
+	})
+
+	sendMsg := func(msgType MessageType, data []byte) {
+		t.Helper()
+		err := s.Send(Message{
+			GroupID:   cfg.GroupID,
+			CallID:    cfg.CallID,
+			UserID:    cfg.UserID,
+			SessionID: cfg.SessionID,
+			Type:      msgType,
+			Data:      data,
+		})
+		require.NoError(t, err)
+	}
+
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		data, err := json.Marshal(candidate.ToJSON())
+		require.NoError(t, err)
+		sendMsg(ICEMessage, data)
+	})
+
+	go func() {
+		for msg := range s.ReceiveCh() {
+			switch msg.Type {
+			case ICEMessage:
+				data := make(map[string]any)
+				err := json.Unmarshal(msg.Data, &data)
+				require.NoError(t, err)
+				candidate := data["candidate"].(map[string]any)["candidate"].(string)
+				go func() {
+					for pc.RemoteDescription() == nil {
+						time.Sleep(10 * time.Millisecond)
+					}
+					_ = pc.AddICECandidate(webrtc.ICECandidateInit{Candidate: candidate})
+				}()
+			case SDPMessage:
+				var sdp webrtc.SessionDescription
+				err := json.Unmarshal(msg.Data, &sdp)
+				require.NoError(t, err)
+				err = pc.SetRemoteDescription(sdp)
+				require.NoError(t, err)
+			}
+		}
+	}()
+
+	offer, err := pc.CreateOffer(nil)
+	require.NoError(t, err)
+	err = pc.SetLocalDescription(offer)
+	require.NoError(t, err)
+
+	err = s.InitSession(cfg, nil)
+	require.NoError(t, err)
+	defer func() {
+		err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+	require.NotNil(t, us)
+	us.mut.RLock()
+	issuedAt := us.turnCredentialsIssuedAt
+	us.mut.RUnlock()
+	require.NotZero(t, issuedAt)
+	initialServers := us.rtcConn.GetConfiguration().ICEServers
+	require.Len(t, initialServers, 1)
+
+	data, err := json.Marshal(offer)
+	require.NoError(t, err)
+	sendMsg(SDPMessage, data)
+
+	select {
+	case iceServers := <-iceServersCh:
+		require.Len(t, iceServers, 1)
+		require.Equal(t, []string{"turn:turn.example.com:3478"}, iceServers[0].URLs)
+		require.NotEmpty(t, iceServers[0].Username)
+		require.NotEmpty(t, iceServers[0].Credential)
+		require.NotEqual(t, initialServers[0].Username, iceServers[0].Username)
+		require.NotEqual(t, initialServers[0].Credential, iceServers[0].Credential)
+		require.Equal(t, int64(60), iceServers[0].TTL)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for refreshed ice servers")
+	}
+
+	us.mut.RLock()
+	defer us.mut.RUnlock()
+	require.True(t, us.turnCredentialsIssuedAt.After(issuedAt))
+}
+
+func TestUpdateICEConfig(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	s.cfg.ICEServers = ICEServers{
+		ICEServerConfig{
+			URLs: []string{"turn:turn.example.com:3478"},
+		},
+	}
+	s.cfg.TURNConfig.StaticAuthSecret = "secret"
+	s.cfg.TURNConfig.CredentialsExpirationMinutes = 1440
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	initSession := func(t *testing.T) (SessionConfig, webrtc.ICEServer) {
+		t.Helper()
+
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		})
+
+		us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+		require.NotNil(t, us)
+		iceServers := us.rtcConn.GetConfiguration().ICEServers
+		require.Len(t, iceServers, 1)
+
+		return cfg, iceServers[0]
+	}
+
+	// checkCredential verifies the given TURN server credential was generated
+	// from the given secret.
+	checkCredential := func(t *testing.T, cfg SessionConfig, iceServer webrtc.ICEServer, secret string) {
+		t.Helper()
+
+		var ts int64
+		_, err := fmt.Sscanf(iceServer.Username, "%d:", &ts)
+		require.NoError(t, err)
+		username, credential, err := genTURNCredentials(cfg.SessionID, secret, ts)
+		require.NoError(t, err)
+		require.Equal(t, username, iceServer.Username)
+		require.Equal(t, credential, iceServer.Credential)
+	}
+
+	cfg1, iceServer1 := initSession(t)
+	checkCredential(t, cfg1, iceServer1, "secret")
+	require.Equal(t, []string{"turn:turn.example.com:3478"}, iceServer1.URLs)
+
+	t.Run("invalid", func(t *testing.T) {
+		err := s.UpdateICEConfig(ICEServers{{URLs: []string{"invalid"}}}, TURNConfig{})
+		require.ErrorContains(t, err, "invalid ICEServers value")
+
+		err = s.UpdateICEConfig(nil, TURNConfig{StaticAuthSecret: "newSecret"})
+		require.ErrorContains(t, err, "invalid TURNConfig")
+	})
+
+	t.Run("new secret", func(t *testing.T) {
+		err := s.UpdateICEConfig(ICEServers{
+			ICEServerConfig{
+				URLs: []string{"turn:turn2.example.com:3478"},
+			},
+		}, TURNConfig{
+			StaticAuthSecret:             "newSecret",
+			CredentialsExpirationMinutes: 60,
+		})
+		require.NoError(t, err)
+
+		cfg2, iceServer2 := initSession(t)
+		checkCredential(t, cfg2, iceServer2, "newSecret")
+		require.Equal(t, []string{"turn:turn2.example.com:3478"}, iceServer2.URLs)
+
+		// Existing sessions are left untouched.
+		us := s.getGroup(cfg1.GroupID).getCall(cfg1.CallID).getSession(cfg1.SessionID)
+		require.NotNil(t, us)
+		require.Equal(t, []webrtc.ICEServer{iceServer1}, us.rtcConn.GetConfiguration().ICEServers)
+	})
+}
+
+func TestRelayOnlySession(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	newCfg := func() SessionConfig {
+		return SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+			Props: SessionProps{
+				"relayOnly": true,
+			},
+		}
+	}
+
+	t.Run("no TURN server", func(t *testing.T) {
+		err := s.InitSession(newCfg(), nil)
+		require.ErrorIs(t, err, ErrRelayUnavailable)
+	})
+
+	// Local TURN server validating the credentials generated for sessions.
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	turnServer, err := turn.NewServer(turn.ServerConfig{
+		Realm:       "rtcd",
+		AuthHandler: turn.LongTermTURNRESTAuthHandler("secret", nil),
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer turnServer.Close()
+
+	s.cfg.ICEServers = ICEServers{
+		ICEServerConfig{
+			URLs: []string{"turn:" + udpListener.LocalAddr().String()},
+		},
+	}
+	s.cfg.TURNConfig.StaticAuthSecret = "secret"
+	s.cfg.TURNConfig.CredentialsExpirationMinutes = 10
+
+	t.Run("relay candidates only", func(t *testing.T) {
+		cfg := newCfg()
+
+		pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+		require.NoError(t, err)
+		defer pc.Close()
+		_, err = pc.CreateDataChannel("calls-dc", nil)
+		require.NoError(t, err)
+
+		var candidates []string
+		var mut sync.Mutex
+		go func() {
+			for msg := range s.ReceiveCh() {
+				switch msg.Type {
+				case ICEMessage:
+					data := make(map[string]any)
+					err := json.Unmarshal(msg.Data, &data)
+					require.NoError(t, err)
+					mut.Lock()
+					candidates = append(candidates, data["candidate"].(map[string]any)["candidate"].(string))
+					mut.Unlock()
+				case SDPMessage:
+					var sdp webrtc.SessionDescription
+					err := json.Unmarshal(msg.Data, &sdp)
+					require.NoError(t, err)
+					err = pc.SetRemoteDescription(sdp)
+					require.NoError(t, err)
+				}
+			}
+		}()
+
+		offer, err := pc.CreateOffer(nil)
+		require.NoError(t, err)
+		err = pc.SetLocalDescription(offer)
+		require.NoError(t, err)
+
+		err = s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		defer func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		us := s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+		require.NotNil(t, us)
+		require.Equal(t, webrtc.ICETransportPolicyRelay, us.rtcConn.GetConfiguration().ICETransportPolicy)
+
+		data, err := json.Marshal(offer)
+		require.NoError(t, err)
+		err = s.Send(Message{
+			GroupID:   cfg.GroupID,
+			CallID:    cfg.CallID,
+			UserID:    cfg.UserID,
+			SessionID: cfg.SessionID,
+			Type:      SDPMessage,
+			Data:      data,
+		})
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return us.rtcConn.ICEGatheringState() == webrtc.ICEGatheringStateComplete
+		}, 10*time.Second, 50*time.Millisecond)
+
+		require.Eventually(t, func() bool {
+			mut.Lock()
+			defer mut.Unlock()
+			return len(candidates) > 0
+		}, 5*time.Second, 50*time.Millisecond)
+
+		mut.Lock()
+		defer mut.Unlock()
+		for _, candidate := range candidates {
+			require.Contains(t, candidate, "typ relay")
+		}
+	})
 }
@@ -12,6 +12,7 @@ import (
 
 	"github.com/mattermost/rtcd/service/random"
 
+	"github.com/blang/semver/v4"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -21,22 +22,43 @@ const (
 	trackTypeVoice       trackType = "voice"
 	trackTypeScreen      trackType = "screen"
 	trackTypeScreenAudio trackType = "screen-audio"
+	trackTypeVideo       trackType = "video"
 )
 
 var trackTypes = map[string]trackType{
 	"voice":        trackTypeVoice,
 	"screen":       trackTypeScreen,
 	"screen-audio": trackTypeScreenAudio,
+	"video":        trackTypeVideo,
 }
 
-func genTrackID(tt trackType, baseID string) string {
-	return string(tt) + "_" + baseID + "_" + random.NewID()[0:8]
+// trackIDDefaultLength is the default length of the random part of track IDs.
+const trackIDDefaultLength = 8
+
+// genTrackID returns a new track ID for the given type and base (session) ID.
+// The random part is idLength characters long, falling back to
+// trackIDDefaultLength if zero.
+func genTrackID(tt trackType, baseID string, idLength int) string {
+	if idLength == 0 {
+		idLength = trackIDDefaultLength
+	}
+	return string(tt) + "_" + baseID + "_" + random.NewID()[0:idLength]
 }
 
 func getTrackIndex(mimeType, rid string) string {
 	return mimeType + "_" + rid
 }
 
+// isScreenTrack returns whether the given track is a screen sharing video
+// track, as opposed to a camera one.
+func isScreenTrack(track webrtc.TrackLocal) bool {
+	if track.Kind() != webrtc.RTPCodecTypeVideo {
+		return false
+	}
+	tt, _, err := parseTrackID(track.ID())
+	return err == nil && tt == trackTypeScreen
+}
+
 func isValidTrackID(trackID string) bool {
 	fields := strings.Split(trackID, "_")
 	if len(fields) != 3 {
@@ -46,6 +68,61 @@ func isValidTrackID(trackID string) bool {
 	return trackTypes[fields[0]] != ""
 }
 
+// parseTrackID returns the track type and the ID of the sending session
+// encoded in the given track ID.
+func parseTrackID(trackID string) (trackType, string, error) {
+	fields := strings.Split(trackID, "_")
+	if len(fields) != 3 {
+		return "", "", fmt.Errorf("invalid number of fields")
+	}
+
+	tt := trackTypes[fields[0]]
+	if tt == "" {
+		return "", "", fmt.Errorf("invalid track type %q", fields[0])
+	}
+
+	return tt, fields[1], nil
+}
+
+// isSessionSampled returns whether a session should emit fine-grained
+// metrics given the configured sample rate. A zero rate means all sessions
+// are sampled.
+func isSessionSampled(rate float64) bool {
+	if rate == 0 || rate >= 1 {
+		return true
+	}
+	return rand.Float64() < rate
+}
+
+// checkClientVersion returns ErrClientVersionTooOld if the given client
+// version is lower than minVersion. Missing or invalid versions are also
+// rejected since they can't be verified.
+func checkClientVersion(minVersion, version string) error {
+	if minVersion == "" {
+		return nil
+	}
+
+	minV, err := semver.ParseTolerant(minVersion)
+	if err != nil {
+		return fmt.Errorf("failed to parse min version: %w", err)
+	}
+
+	if version == "" {
+		return fmt.Errorf("%w: missing version", ErrClientVersionTooOld)
+	}
+
+	v, err := semver.ParseTolerant(version)
+	if err != nil {
+		return fmt.Errorf("invalid version %q: %w", version, err)
+	}
+
+	if v.LT(minV) {
+		return fmt.Errorf("%w: %s is lower than %s", ErrClientVersionTooOld, v, minV)
+	}
+
+	return nil
+}
+
 func getTrackType(kind webrtc.RTPCodecType) string {
 	if kind == webrtc.RTPCodecTypeAudio {
 		return "audio"
@@ -133,6 +210,44 @@ func generateAddrsPairs(localIPs []netip.Addr, publicAddrsMap map[netip.Addr]str
 	return pairs, nil
 }
 
+// hasDirectPublicMapping returns whether the public addresses (either
+// discovered or set through the host override) map 1:1 to local addresses,
+// meaning the server is reachable directly and not behind NAT.
+func hasDirectPublicMapping(localIPs []netip.Addr, publicAddrsMap map[netip.Addr]string, hostOverride string) bool {
+	if hostOverride != "" {
+		if !strings.Contains(hostOverride, "/") {
+			for _, localAddr := range localIPs {
+				if localAddr.String() == hostOverride {
+					return true
+				}
+			}
+			return false
+		}
+
+		for _, p := range strings.Split(hostOverride, ",") {
+			pair := strings.Split(p, "/")
+			if len(pair) != 2 || pair[0] != pair[1] {
+				return false
+			}
+		}
+		return true
+	}
+
+	var found bool
+	for _, localAddr := range localIPs {
+		publicAddr := publicAddrsMap[localAddr]
+		if publicAddr == "" {
+			continue
+		}
+		if publicAddr != localAddr.String() {
+			return false
+		}
+		found = true
+	}
+
+	return found
+}
+
 func getExternalAddrMapFromHostOverride(override string, publicAddrsMap map[netip.Addr]string) map[string]bool {
 	m := make(map[string]bool)
 
@@ -5,6 +5,7 @@ package rtc
 
 import (
 	"net/netip"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -128,7 +129,7 @@ func TestIsValidTrackID(t *testing.T) {
 		},
 		{
 			name:   "invalid track type",
-			input:  "video_id_id",
+			input:  "data_id_id",
 			result: false,
 		},
 		{
@@ -155,6 +156,73 @@ func TestIsValidTrackID(t *testing.T) {
 	}
 }
 
+func TestGenTrackID(t *testing.T) {
+	t.Run("default length", func(t *testing.T) {
+		trackID := genTrackID(trackTypeVoice, "sessionID", 0)
+		require.True(t, isValidTrackID(trackID))
+		require.Len(t, strings.Split(trackID, "_")[2], trackIDDefaultLength)
+	})
+
+	t.Run("configured length", func(t *testing.T) {
+		for _, idLength := range []int{trackIDMinLength, 16, trackIDMaxLength} {
+			trackID := genTrackID(trackTypeScreen, "sessionID", idLength)
+			require.True(t, isValidTrackID(trackID))
+			require.Equal(t, "screen_sessionID_", trackID[:len(trackID)-idLength])
+			require.Len(t, strings.Split(trackID, "_")[2], idLength)
+		}
+	})
+}
+
+func TestParseTrackID(t *testing.T) {
+	t.Run("invalid", func(t *testing.T) {
+		_, _, err := parseTrackID("")
+		require.EqualError(t, err, "invalid number of fields")
+
+		_, _, err = parseTrackID("data_sessionID_trackID")
+		require.EqualError(t, err, `invalid track type "data"`)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		tt, sessionID, err := parseTrackID(genTrackID(trackTypeScreenAudio, "sessionID", 0))
+		require.NoError(t, err)
+		require.Equal(t, trackTypeScreenAudio, tt)
+		require.Equal(t, "sessionID", sessionID)
+	})
+}
+
+func TestHasDirectPublicMapping(t *testing.T) {
+	localIPs := []netip.Addr{
+		netip.MustParseAddr("127.0.0.1"),
+		netip.MustParseAddr("10.0.0.1"),
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		require.False(t, hasDirectPublicMapping(localIPs, nil, ""))
+	})
+
+	t.Run("discovered direct", func(t *testing.T) {
+		require.True(t, hasDirectPublicMapping(localIPs, map[netip.Addr]string{
+			netip.MustParseAddr("10.0.0.1"): "10.0.0.1",
+		}, ""))
+	})
+
+	t.Run("discovered NAT", func(t *testing.T) {
+		require.False(t, hasDirectPublicMapping(localIPs, map[netip.Addr]string{
+			netip.MustParseAddr("10.0.0.1"): "8.8.8.8",
+		}, ""))
+	})
+
+	t.Run("single host override", func(t *testing.T) {
+		require.True(t, hasDirectPublicMapping(localIPs, nil, "10.0.0.1"))
+		require.False(t, hasDirectPublicMapping(localIPs, nil, "8.8.8.8"))
+	})
+
+	t.Run("mapping override", func(t *testing.T) {
+		require.True(t, hasDirectPublicMapping(localIPs, nil, "10.0.0.1/10.0.0.1,10.0.0.2/10.0.0.2"))
+		require.False(t, hasDirectPublicMapping(localIPs, nil, "8.8.8.8/10.0.0.1,10.0.0.2/10.0.0.2"))
+	})
+}
+
 func TestGetExternalAddrMapFromHostOverride(t *testing.T) {
 	t.Run("empty", func(t *testing.T) {
 		m := getExternalAddrMapFromHostOverride("", nil)
@@ -194,3 +262,60 @@ func TestGetExternalAddrMapFromHostOverride(t *testing.T) {
 		}, m)
 	})
 }
+
+func TestIsSessionSampled(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			require.True(t, isSessionSampled(0))
+		}
+	})
+
+	t.Run("all", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			require.True(t, isSessionSampled(1))
+		}
+	})
+
+	t.Run("fraction", func(t *testing.T) {
+		n := 10000
+		var sampled int
+		for i := 0; i < n; i++ {
+			if isSessionSampled(0.2) {
+				sampled++
+			}
+		}
+		require.InDelta(t, 0.2, float64(sampled)/float64(n), 0.05)
+	})
+}
+
+func TestCheckClientVersion(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		require.NoError(t, checkClientVersion("", ""))
+		require.NoError(t, checkClientVersion("", "0.1.0"))
+	})
+
+	t.Run("missing version", func(t *testing.T) {
+		err := checkClientVersion("1.2.0", "")
+		require.ErrorIs(t, err, ErrClientVersionTooOld)
+	})
+
+	t.Run("invalid version", func(t *testing.T) {
+		err := checkClientVersion("1.2.0", "invalid")
+		require.Error(t, err)
+		require.NotErrorIs(t, err, ErrClientVersionTooOld)
+	})
+
+	t.Run("older", func(t *testing.T) {
+		for _, v := range []string{"1.1.9", "v1.1.0", "1.2.0-rc1", "0.9"} {
+			err := checkClientVersion("1.2.0", v)
+			require.ErrorIs(t, err, ErrClientVersionTooOld, v)
+		}
+	})
+
+	t.Run("same or newer", func(t *testing.T) {
+		for _, v := range []string{"1.2.0", "v1.2.0", "1.2.1", "1.10.0", "2.0"} {
+			err := checkClientVersion("1.2.0", v)
+			require.NoError(t, err, v)
+		}
+	})
+}
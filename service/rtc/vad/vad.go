@@ -15,6 +15,9 @@ const (
 	defaultVoiceActivationThreshold   = 10
 	defaultVoiceDeactivationThreshold = 4
 	defaultActivationDuration         = 2 * time.Second
+	// silenceLevel is the lowest audio level (-127 dBov) as defined in
+	// RFC 6464.
+	silenceLevel = 127
 )
 
 type VoiceCB func(voice bool)
@@ -126,6 +129,14 @@ func (m *Monitor) PushAudioLevel(level uint8) {
 	m.voiceState = newState
 }
 
+// PushSilence accounts for n audio frames that were not received (e.g.
+// because of discontinuous transmission) by pushing them as silent.
+func (m *Monitor) PushSilence(n int) {
+	for i := 0; i < min(n, m.cfg.VoiceLevelsSampleSize); i++ {
+		m.PushAudioLevel(silenceLevel)
+	}
+}
+
 func (m *Monitor) Reset() {
 	m.voiceLevelsSamplePtr = 0
 	m.voiceLevelsSample = m.voiceLevelsSample[:0]
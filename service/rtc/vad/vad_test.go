@@ -169,3 +169,43 @@ func TestReset(t *testing.T) {
 	require.True(t, activated)
 	require.True(t, deactivated)
 }
+
+func TestPushSilence(t *testing.T) {
+	cfg := MonitorConfig{
+		VoiceLevelsSampleSize:      10,
+		ActivationDuration:         250 * time.Millisecond,
+		VoiceActivationThreshold:   10,
+		VoiceDeactivationThreshold: 5,
+	}
+
+	var activated bool
+	var deactivated bool
+	m, err := NewMonitor(cfg, func(voice bool) {
+		if voice {
+			activated = true
+		} else {
+			deactivated = true
+		}
+	})
+	require.NoError(t, err)
+	require.NotNil(t, m)
+
+	for i := 0; i < cfg.VoiceLevelsSampleSize; i++ {
+		m.PushAudioLevel(45)
+	}
+	m.PushAudioLevel(100)
+	require.True(t, m.voiceState)
+	require.True(t, activated)
+	require.False(t, deactivated)
+
+	time.Sleep(cfg.ActivationDuration)
+
+	// A long gap fills the whole sample with silence.
+	m.PushSilence(cfg.VoiceLevelsSampleSize * 10)
+	require.Len(t, m.voiceLevelsSample, cfg.VoiceLevelsSampleSize)
+	for _, level := range m.voiceLevelsSample {
+		require.Equal(t, uint8(silenceLevel), level)
+	}
+	require.False(t, m.voiceState)
+	require.True(t, deactivated)
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"sync"
+	"time"
+)
+
+// vadDebouncer delays voice off events by a hold time so that brief pauses
+// in speech don't cause voice activity to flap. Voice resuming while a voice
+// off event is pending cancels it, in which case no voice on event is
+// emitted either.
+type vadDebouncer struct {
+	hold time.Duration
+	cb   func(voice bool)
+
+	timer *time.Timer
+	// gen is bumped on cancellation so that a timer which already fired
+	// doesn't emit a stale event.
+	gen int
+	mut sync.Mutex
+}
+
+func newVADDebouncer(hold time.Duration, cb func(voice bool)) *vadDebouncer {
+	return &vadDebouncer{
+		hold: hold,
+		cb:   cb,
+	}
+}
+
+func (d *vadDebouncer) push(voice bool) {
+	if d.hold <= 0 {
+		d.cb(voice)
+		return
+	}
+
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	if voice {
+		if d.timer != nil {
+			d.timer.Stop()
+			d.timer = nil
+			d.gen++
+			return
+		}
+		d.cb(true)
+		return
+	}
+
+	if d.timer != nil {
+		return
+	}
+
+	gen := d.gen
+	d.timer = time.AfterFunc(d.hold, func() {
+		d.mut.Lock()
+		defer d.mut.Unlock()
+		if gen != d.gen {
+			return
+		}
+		d.timer = nil
+		d.cb(false)
+	})
+}
+
+// stop cancels any pending voice off event.
+func (d *vadDebouncer) stop() {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+		d.gen++
+	}
+}
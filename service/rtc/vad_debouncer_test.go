@@ -0,0 +1,127 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVADDebouncer(t *testing.T) {
+	newDebouncer := func(hold time.Duration) (*vadDebouncer, <-chan bool) {
+		eventsCh := make(chan bool, 10)
+		return newVADDebouncer(hold, func(voice bool) {
+			eventsCh <- voice
+		}), eventsCh
+	}
+
+	t.Run("no hold", func(t *testing.T) {
+		d, eventsCh := newDebouncer(0)
+		d.push(true)
+		d.push(false)
+		require.True(t, <-eventsCh)
+		require.False(t, <-eventsCh)
+	})
+
+	t.Run("voice off held", func(t *testing.T) {
+		d, eventsCh := newDebouncer(100 * time.Millisecond)
+		d.push(true)
+		require.True(t, <-eventsCh)
+
+		start := time.Now()
+		d.push(false)
+		require.False(t, <-eventsCh)
+		require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	})
+
+	t.Run("short gaps", func(t *testing.T) {
+		d, eventsCh := newDebouncer(100 * time.Millisecond)
+		d.push(true)
+		require.True(t, <-eventsCh)
+
+		for i := 0; i < 5; i++ {
+			d.push(false)
+			time.Sleep(20 * time.Millisecond)
+			d.push(true)
+		}
+		time.Sleep(150 * time.Millisecond)
+		require.Empty(t, eventsCh)
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		d, eventsCh := newDebouncer(50 * time.Millisecond)
+		d.push(false)
+		d.stop()
+		time.Sleep(100 * time.Millisecond)
+		require.Empty(t, eventsCh)
+	})
+}
+
+func TestInitVADVoiceOffHold(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	us := &session{
+		cfg: SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		},
+		closeCh: make(chan struct{}),
+	}
+
+	hold := 200 * time.Millisecond
+	msgCh := make(chan Message, 10)
+	err = us.InitVAD(log, msgCh, hold)
+	require.NoError(t, err)
+
+	// speak feeds enough varying audio levels to fill the monitor's sample
+	// and trigger voice activity.
+	speak := func() {
+		for i := 0; i < 100; i++ {
+			us.vadMonitor.PushAudioLevel(uint8(20 + (i%2)*60))
+		}
+	}
+
+	speak()
+	require.Equal(t, VoiceOnMessage, (<-msgCh).Type)
+
+	// A short pause followed by speech doesn't emit any message.
+	us.vadMonitor.Reset()
+	time.Sleep(hold / 2)
+	speak()
+	time.Sleep(hold)
+	require.Empty(t, msgCh)
+
+	start := time.Now()
+	us.vadMonitor.Reset()
+	require.Equal(t, VoiceOffMessage, (<-msgCh).Type)
+	require.GreaterOrEqual(t, time.Since(start), hold)
+
+	// Stopping cancels the pending voice off event.
+	speak()
+	require.Equal(t, VoiceOnMessage, (<-msgCh).Type)
+	us.vadMonitor.Reset()
+	us.vadDebouncer.stop()
+	time.Sleep(hold * 2)
+	require.Empty(t, msgCh)
+
+	// No message is sent once the session is closed.
+	speak()
+	require.Equal(t, VoiceOnMessage, (<-msgCh).Type)
+	us.vadMonitor.Reset()
+	close(us.closeCh)
+	time.Sleep(hold * 2)
+	require.Empty(t, msgCh)
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+)
+
+// screenTrackMimeTypes lists the codecs a screen share can be published
+// with, in order of preference.
+var screenTrackMimeTypes = []string{
+	webrtc.MimeTypeAV1,
+	webrtc.MimeTypeVP9,
+	ScreenTrackMimeTypeDefault,
+}
+
+// getScreenTrackMimeType returns the preferred codec for forwarding the
+// screen share published by the sender session to the receiver session. This
+// is the first codec, in order of preference, the sender is actually
+// publishing a track for and the receiver supports, falling back to VP8
+// otherwise.
+func getScreenTrackMimeType(sender, receiver *session) string {
+	for _, mimeType := range screenTrackMimeTypes {
+		if canReceiveVideoCodec(receiver, mimeType) && len(sender.getScreenSimulcastLevels(mimeType)) > 0 {
+			return mimeType
+		}
+	}
+	return ScreenTrackMimeTypeDefault
+}
+
+// canReceiveVideoCodec returns whether the receiving session supports the
+// given video codec.
+func canReceiveVideoCodec(us *session, mimeType string) bool {
+	switch mimeType {
+	case webrtc.MimeTypeAV1:
+		return us.supportsAV1()
+	case webrtc.MimeTypeVP9:
+		return us.supportsVP9()
+	default:
+		return true
+	}
+}
+
+// canReceiveVideoTrack returns whether the receiving session supports the
+// codec of the given camera track.
+func canReceiveVideoTrack(us *session, track *webrtc.TrackLocalStaticRTP) bool {
+	return canReceiveVideoCodec(us, track.Codec().MimeType)
+}
+
+// handleVideoTrack forwards the camera track published by the session to all
+// the other sessions in the call. Unlike screen sharing, camera tracks are
+// forwarded as a single layer.
+func (s *Server) handleVideoTrack(call *call, us *session, remoteTrack *webrtc.TrackRemote, params webrtc.RTPCodecParameters) {
+	s.log.Debug("received camera stream", mlog.String("streamID", remoteTrack.StreamID()), mlog.String("sessionID", us.cfg.SessionID))
+
+	outVideoTrack, err := webrtc.NewTrackLocalStaticRTP(params.RTPCodecCapability, genTrackID(trackTypeVideo, us.cfg.SessionID, s.cfg.TrackIDLength), random.NewID())
+	if err != nil {
+		s.log.Error("failed to create local track", mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID))
+		return
+	}
+
+	us.mut.Lock()
+	us.outVideoTrack = outVideoTrack
+	us.remoteVideoTrack = remoteTrack
+	us.mut.Unlock()
+
+	call.iterSessions(func(ss *session) {
+		if ss.cfg.SessionID == us.cfg.SessionID || !canReceiveVideoTrack(ss, outVideoTrack) {
+			return
+		}
+		select {
+		case ss.tracksCh <- trackActionContext{action: trackActionAdd, track: outVideoTrack}:
+		default:
+			s.droppedMessage(ss.cfg.GroupID, "tracks", "video_track",
+				mlog.String("sessionID", ss.cfg.SessionID),
+				mlog.String("trackSessionID", us.cfg.SessionID),
+			)
+		}
+	})
+
+	// Same as screen sharing, writing happens on a separate goroutine so that
+	// slow writes don't stall reading from the remote track.
+	writerCh := make(chan videoPacket, writerQueueSize)
+	defer close(writerCh)
+	go s.writeVideoTrack(call, us, trackTypeVideo, writerCh, outVideoTrack, nil)
+
+	for {
+		packet, _, readErr := remoteTrack.ReadRTP()
+		if readErr != nil {
+			if !errors.Is(readErr, io.EOF) {
+				s.log.Error("failed to read RTP packet",
+					mlog.Err(readErr), mlog.String("sessionID", us.cfg.SessionID))
+				s.metrics.IncRTCErrors(us.cfg.GroupID, "rtp")
+			}
+			return
+		}
+
+		// See the screen track handler for why the padding is reset.
+		if packet.Padding && len(packet.Payload) == 0 {
+			packet.Padding = false
+			packet.PaddingSize = 0
+		}
+		packet.Extension = false
+		packet.Extensions = nil
+
+		select {
+		case writerCh <- videoPacket{Packet: packet}:
+		default:
+			s.droppedMessage(us.cfg.GroupID, "video_writer", "rtp", mlog.String("trackID", outVideoTrack.ID()))
+		}
+	}
+}
+
+// writeVideoTrack writes the video packets received on writerCh to the given
+// outgoing track until the channel is closed. If a frame dropper is passed,
+// packets get thinned out while the server is under CPU pressure.
+//
+// When the call's forwarding is limited (ServerConfig.MaxForwardingWorkersPerCall),
+// a slot is held for each burst of queued packets, up to forwardingBatchSize,
+// rather than for every packet.
+func (s *Server) writeVideoTrack(call *call, us *session, tt trackType, writerCh <-chan videoPacket, outTrack *webrtc.TrackLocalStaticRTP, dropper *frameDropper) {
+	var layerSwitch bool
+	write := func(pkt videoPacket) {
+		if dropper != nil {
+			underPressure := s.isUnderCPUPressure()
+			dropped := dropper.drop(pkt.Packet, pkt.marking, underPressure)
+			// Streams that can't be thinned get their receivers
+			// switched to a lower level instead.
+			if needsSwitch := underPressure && !dropper.thinnable(); needsSwitch != layerSwitch {
+				layerSwitch = needsSwitch
+				us.setScreenLayerSwitch(needsSwitch)
+			}
+			if dropped {
+				return
+			}
+		}
+
+		writeStartTime := time.Now()
+		if err := outTrack.WriteRTP(pkt.Packet); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			s.log.Error("failed to write RTP packet",
+				mlog.Err(err), mlog.String("sessionID", us.cfg.SessionID))
+			s.metrics.IncRTCErrors(us.cfg.GroupID, "rtp")
+			return
+		}
+		if us.metricsSampled {
+			s.metrics.ObserveRTPTracksWrite(us.cfg.GroupID, string(tt), time.Since(writeStartTime).Seconds())
+		}
+	}
+
+	for pkt := range writerCh {
+		call.acquireForwardingSlot()
+		write(pkt)
+		closed := false
+	burst:
+		for i := 1; i < forwardingBatchSize; i++ {
+			select {
+			case pkt, ok := <-writerCh:
+				if !ok {
+					closed = true
+					break burst
+				}
+				write(pkt)
+			default:
+				break burst
+			}
+		}
+		call.releaseForwardingSlot()
+		if closed {
+			return
+		}
+	}
+}
+
+// forwardVideoPLI forwards a PLI request for the camera track sent by the
+// given source session.
+func (s *session) forwardVideoPLI(sourceSessionID string) error {
+	ss := s.call.getSession(sourceSessionID)
+	if ss == nil {
+		return fmt.Errorf("source session not found")
+	}
+
+	ss.mut.RLock()
+	videoTrack := ss.remoteVideoTrack
+	ss.mut.RUnlock()
+	if videoTrack == nil {
+		return fmt.Errorf("video track not found")
+	}
+
+	if !s.call.getPLILimiter(videoTrack.SSRC()).Allow() {
+		return nil
+	}
+
+	s.log.Debug("forwarding PLI request for video track", mlog.String("sessionID", s.cfg.SessionID), mlog.Uint("SSRC", videoTrack.SSRC()))
+
+	return ss.rtcConn.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(videoTrack.SSRC())}})
+}
@@ -0,0 +1,374 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsScreenTrack(t *testing.T) {
+	voiceTrack, err := webrtc.NewTrackLocalStaticRTP(rtpAudioCodec, genTrackID(trackTypeVoice, random.NewID(), 0), random.NewID())
+	require.NoError(t, err)
+	require.False(t, isScreenTrack(voiceTrack))
+
+	screenTrack, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		genTrackID(trackTypeScreen, random.NewID(), 0), random.NewID())
+	require.NoError(t, err)
+	require.True(t, isScreenTrack(screenTrack))
+
+	videoTrack, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		genTrackID(trackTypeVideo, random.NewID(), 0), random.NewID())
+	require.NoError(t, err)
+	require.False(t, isScreenTrack(videoTrack))
+
+	invalidTrack, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		"invalid", random.NewID())
+	require.NoError(t, err)
+	require.False(t, isScreenTrack(invalidTrack))
+}
+
+func TestVideoTrack(t *testing.T) {
+	t.Run("video on before track", func(t *testing.T) {
+		testVideoTrack(t, false)
+	})
+
+	// The track can be received before the message announcing it, in which
+	// case it's held until the message comes through.
+	t.Run("video on after track", func(t *testing.T) {
+		testVideoTrack(t, true)
+	})
+}
+
+func testVideoTrack(t *testing.T, lateVideoOn bool) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	if lateVideoOn {
+		s.cfg.UnexpectedVideoTrackHoldMs = 2000
+	}
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+	senderCfg := SessionConfig{
+		GroupID:   groupID,
+		CallID:    callID,
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+	receiverCfg := SessionConfig{
+		GroupID:   groupID,
+		CallID:    callID,
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+
+	initSession := setupTestPeers(t, s)
+
+	receiverPC := initSession(receiverCfg)
+	defer receiverPC.Close()
+	defer func() {
+		err := s.CloseSession(receiverCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+	trackIDCh := make(chan string, 1)
+	receiverPC.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		select {
+		case trackIDCh <- track.ID():
+		default:
+		}
+		for {
+			if _, _, err := track.ReadRTP(); err != nil {
+				return
+			}
+		}
+	})
+
+	videoTrack, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		"video", "camera")
+	require.NoError(t, err)
+	senderPC := initSession(senderCfg, videoTrack)
+	defer senderPC.Close()
+	defer func() {
+		err := s.CloseSession(senderCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	data, err := json.Marshal(map[string]string{"videoStreamID": "camera"})
+	require.NoError(t, err)
+	sendMsg := func(msgType MessageType, data []byte) {
+		t.Helper()
+		err := s.Send(Message{
+			GroupID:   senderCfg.GroupID,
+			CallID:    senderCfg.CallID,
+			UserID:    senderCfg.UserID,
+			SessionID: senderCfg.SessionID,
+			Type:      msgType,
+			Data:      data,
+		})
+		require.NoError(t, err)
+	}
+	if !lateVideoOn {
+		sendMsg(VideoOnMessage, data)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go func() {
+		ticker := time.NewTicker(30 * time.Millisecond)
+		defer ticker.Stop()
+		var seq uint16
+		for {
+			select {
+			case <-ticker.C:
+				seq++
+				_ = videoTrack.WriteRTP(&rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						SequenceNumber: seq,
+						Timestamp:      uint32(seq) * 3000,
+						Marker:         true,
+					},
+					Payload: []byte{0x10, 0x00, 0x9d, 0x01, 0x2a},
+				})
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	if lateVideoOn {
+		time.Sleep(500 * time.Millisecond)
+		sendMsg(VideoOnMessage, data)
+	}
+
+	select {
+	case trackID := <-trackIDCh:
+		tt, sessionID, err := parseTrackID(trackID)
+		require.NoError(t, err)
+		require.Equal(t, trackTypeVideo, tt)
+		require.Equal(t, senderCfg.SessionID, sessionID)
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "timed out waiting for video track")
+	}
+
+	call := s.getGroup(groupID).getCall(callID)
+	require.Nil(t, call.getScreenSession())
+
+	us := call.getSession(receiverCfg.SessionID)
+	require.NotNil(t, us)
+	rxTracksCount := func() int {
+		us.mut.RLock()
+		defer us.mut.RUnlock()
+		return len(us.rxTracks)
+	}
+	require.Equal(t, 1, rxTracksCount())
+
+	// Turning the camera off should remove the track from the receiver.
+	sendMsg(VideoOffMessage, nil)
+
+	require.Eventually(t, func() bool {
+		return rxTracksCount() == 0
+	}, 4*time.Second, 50*time.Millisecond)
+
+	ss := call.getSession(senderCfg.SessionID)
+	require.NotNil(t, ss)
+	require.Empty(t, ss.getVideoStreamID())
+}
+
+func TestVP9ScreenTrack(t *testing.T) {
+	s, shutdown := setupServer(t)
+	defer shutdown()
+
+	// VP9 is experimental so it needs to be registered explicitly.
+	s.cfg.Experimental.EnableVP9 = true
+	s.videoCodecParams = getSupportedVideoCodecs(s.cfg.Experimental)
+	s.videoCodecs = getVideoCodecsMimeTypes(s.videoCodecParams)
+
+	err := s.Start()
+	require.NoError(t, err)
+
+	groupID := random.NewID()
+	callID := random.NewID()
+	newCfg := func(props SessionProps) SessionConfig {
+		return SessionConfig{
+			GroupID:   groupID,
+			CallID:    callID,
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+			Props:     props,
+		}
+	}
+	senderCfg := newCfg(SessionProps{"vp9Support": true})
+	vp9ReceiverCfg := newCfg(SessionProps{"vp9Support": true})
+	vp8ReceiverCfg := newCfg(nil)
+
+	initSession := setupTestPeers(t, s)
+
+	connectReceiver := func(cfg SessionConfig) (*webrtc.PeerConnection, chan *webrtc.TrackRemote) {
+		t.Helper()
+		pc := initSession(cfg)
+		tracksCh := make(chan *webrtc.TrackRemote, 1)
+		pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+			select {
+			case tracksCh <- track:
+			default:
+			}
+			for {
+				if _, _, err := track.ReadRTP(); err != nil {
+					return
+				}
+			}
+		})
+		return pc, tracksCh
+	}
+
+	vp9ReceiverPC, vp9TracksCh := connectReceiver(vp9ReceiverCfg)
+	defer vp9ReceiverPC.Close()
+	defer func() {
+		err := s.CloseSession(vp9ReceiverCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	vp8ReceiverPC, vp8TracksCh := connectReceiver(vp8ReceiverCfg)
+	defer vp8ReceiverPC.Close()
+	defer func() {
+		err := s.CloseSession(vp8ReceiverCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	screenTrack, err := webrtc.NewTrackLocalStaticRTP(rtpExperimentalVideoCodecs[webrtc.MimeTypeVP9].RTPCodecCapability, "screen", "screenStream")
+	require.NoError(t, err)
+	senderPC := initSession(senderCfg, screenTrack)
+	defer senderPC.Close()
+	defer func() {
+		err := s.CloseSession(senderCfg.SessionID, CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	data, err := json.Marshal(map[string]string{"screenStreamID": "screenStream"})
+	require.NoError(t, err)
+	err = s.Send(Message{
+		GroupID:   senderCfg.GroupID,
+		CallID:    senderCfg.CallID,
+		UserID:    senderCfg.UserID,
+		SessionID: senderCfg.SessionID,
+		Type:      ScreenOnMessage,
+		Data:      data,
+	})
+	require.NoError(t, err)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go func() {
+		ticker := time.NewTicker(30 * time.Millisecond)
+		defer ticker.Stop()
+		var seq uint16
+		for {
+			select {
+			case <-ticker.C:
+				seq++
+				_ = screenTrack.WriteRTP(&rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						SequenceNumber: seq,
+						Timestamp:      uint32(seq) * 3000,
+						Marker:         true,
+					},
+					Payload: []byte{0x8c, 0x00, 0x00, 0x00},
+				})
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	select {
+	case track := <-vp9TracksCh:
+		require.Equal(t, webrtc.MimeTypeVP9, track.Codec().MimeType)
+		tt, sessionID, err := parseTrackID(track.ID())
+		require.NoError(t, err)
+		require.Equal(t, trackTypeScreen, tt)
+		require.Equal(t, senderCfg.SessionID, sessionID)
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "timed out waiting for screen track")
+	}
+
+	// The receiver not supporting VP9 should never get the track.
+	select {
+	case <-vp8TracksCh:
+		require.Fail(t, "unexpected screen track")
+	case <-time.After(time.Second):
+	}
+
+	us := s.getGroup(groupID).getCall(callID).getSession(vp8ReceiverCfg.SessionID)
+	require.NotNil(t, us)
+	us.mut.RLock()
+	require.Empty(t, us.rxTracks)
+	us.mut.RUnlock()
+}
+
+func TestGetScreenTrackMimeType(t *testing.T) {
+	allCodecs := []string{webrtc.MimeTypeAV1, webrtc.MimeTypeVP8, webrtc.MimeTypeVP9}
+	newSession := func(props SessionProps, published ...string) *session {
+		ss := &session{
+			cfg:             SessionConfig{Props: props},
+			videoCodecs:     allCodecs,
+			outScreenTracks: make(map[string][]*webrtc.TrackLocalStaticRTP),
+		}
+		for _, mimeType := range published {
+			ss.outScreenTracks[getTrackIndex(mimeType, SimulcastLevelDefault)] = nil
+		}
+		return ss
+	}
+
+	vp8 := newSession(nil)
+	vp9 := newSession(SessionProps{"vp9Support": true})
+	av1 := newSession(SessionProps{"av1Support": true})
+	all := newSession(SessionProps{"av1Support": true, "vp9Support": true})
+
+	t.Run("published codecs", func(t *testing.T) {
+		vp8Sender := newSession(nil, webrtc.MimeTypeVP8)
+		vp9Sender := newSession(nil, webrtc.MimeTypeVP8, webrtc.MimeTypeVP9)
+		allSender := newSession(nil, webrtc.MimeTypeVP8, webrtc.MimeTypeVP9, webrtc.MimeTypeAV1)
+
+		require.Equal(t, webrtc.MimeTypeVP8, getScreenTrackMimeType(vp8Sender, vp8))
+		require.Equal(t, webrtc.MimeTypeVP8, getScreenTrackMimeType(vp8Sender, all))
+		require.Equal(t, webrtc.MimeTypeVP8, getScreenTrackMimeType(vp9Sender, vp8))
+		require.Equal(t, webrtc.MimeTypeVP8, getScreenTrackMimeType(vp9Sender, av1))
+		require.Equal(t, webrtc.MimeTypeVP9, getScreenTrackMimeType(vp9Sender, vp9))
+		require.Equal(t, webrtc.MimeTypeVP9, getScreenTrackMimeType(vp9Sender, all))
+		require.Equal(t, webrtc.MimeTypeVP9, getScreenTrackMimeType(allSender, vp9))
+		require.Equal(t, webrtc.MimeTypeAV1, getScreenTrackMimeType(allSender, av1))
+		require.Equal(t, webrtc.MimeTypeAV1, getScreenTrackMimeType(allSender, all))
+	})
+
+	t.Run("sender props are ignored", func(t *testing.T) {
+		// Nothing is published yet.
+		require.Equal(t, webrtc.MimeTypeVP8, getScreenTrackMimeType(all, all))
+		require.Equal(t, webrtc.MimeTypeVP8, getScreenTrackMimeType(vp9, vp9))
+
+		// A codec published regardless of what the sender advertised.
+		sender := newSession(nil, webrtc.MimeTypeVP9)
+		require.Equal(t, webrtc.MimeTypeVP9, getScreenTrackMimeType(sender, vp9))
+	})
+
+	t.Run("VP9 disabled", func(t *testing.T) {
+		// VP9 disabled on the server at the time the receiver was created.
+		receiver := newSession(SessionProps{"vp9Support": true})
+		receiver.videoCodecs = []string{webrtc.MimeTypeAV1, webrtc.MimeTypeVP8}
+		sender := newSession(nil, webrtc.MimeTypeVP8, webrtc.MimeTypeVP9)
+		require.Equal(t, webrtc.MimeTypeVP8, getScreenTrackMimeType(sender, receiver))
+	})
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/interceptor/pkg/gcc"
+	"github.com/pion/webrtc/v4"
+)
+
+// warmPoolRetryInterval is how long the warm pool filler waits before trying
+// again after failing to build a session API.
+const warmPoolRetryInterval = time.Second
+
+// sessionAPI holds a webrtc API along with the per session state tied to it.
+// Since the interceptors report to a dedicated channel, each instance must be
+// used to create a single peer connection.
+type sessionAPI struct {
+	api *webrtc.API
+	// certificate is the DTLS certificate for the peer connection. Generating
+	// it is the most expensive part of creating a peer connection.
+	certificate  webrtc.Certificate
+	rtcpCompound *rtcpCompoundInterceptor
+	stats        *statsInterceptor
+	// bwEstimatorCh is nil if congestion control is disabled.
+	bwEstimatorCh <-chan cc.BandwidthEstimator
+	// pacer is only set if pacing is enabled (ServerConfig.EnablePacing) and
+	// so is congestion control, since it relies on the estimated rate.
+	pacer             *pacer
+	videoCodecs       []string
+	opusDTX           bool
+	congestionControl bool
+}
+
+func (s *Server) newSessionAPI(videoCodecs []string, opusDTX, congestionControl bool) (*sessionAPI, error) {
+	videoCodecParams := make([]webrtc.RTPCodecParameters, 0, len(videoCodecs))
+	for _, mimeType := range videoCodecs {
+		videoCodecParams = append(videoCodecParams, s.videoCodecParams[mimeType])
+	}
+	mEngine, err := initMediaEngine(getAudioCodec(opusDTX), videoCodecParams, s.videoExtensions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init media engine: %w", err)
+	}
+
+	// The CNAME is set once the session is known.
+	rtcpCompound := newRTCPCompoundInterceptor(s.cfg.EnableRTCPReducedSize, rand.Uint32(), "")
+	stats := newStatsInterceptor()
+	var p *pacer
+	var ccPacer gcc.Pacer
+	if s.cfg.EnablePacing && congestionControl {
+		p = newPacer()
+		ccPacer = p
+	}
+	iRegistry, bwEstimatorCh, err := initInterceptors(mEngine, rtcpCompound, stats, ccPacer, congestionControl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init interceptors: %w", err)
+	}
+
+	sEngine, err := s.initSettingEngine()
+	if err != nil {
+		return nil, fmt.Errorf("failed to init setting engine: %w", err)
+	}
+
+	// Same key type the library would use by default.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+	certificate, err := webrtc.GenerateCertificate(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate: %w", err)
+	}
+
+	return &sessionAPI{
+		certificate: *certificate,
+		api: webrtc.NewAPI(
+			webrtc.WithMediaEngine(mEngine),
+			webrtc.WithSettingEngine(sEngine),
+			webrtc.WithInterceptorRegistry(iRegistry),
+		),
+		rtcpCompound:      rtcpCompound,
+		stats:             stats,
+		bwEstimatorCh:     bwEstimatorCh,
+		pacer:             p,
+		videoCodecs:       videoCodecs,
+		opusDTX:           opusDTX,
+		congestionControl: congestionControl,
+	}, nil
+}
+
+// getSessionAPI returns a pre-built API from the warm pool
+// (ServerConfig.WarmPoolSize) if one is available and matches the currently
+// enabled video codecs. Otherwise a new one is built.
+// Pool entries are built with Opus DTX set as configured and congestion
+// control enabled so sessions negotiating different values always get a new
+// one.
+func (s *Server) getSessionAPI(opusDTX, congestionControl bool) (*sessionAPI, error) {
+	videoCodecs := s.GetEnabledVideoCodecs()
+
+	if opusDTX != s.cfg.EnableOpusDTX || !congestionControl {
+		return s.newSessionAPI(videoCodecs, opusDTX, congestionControl)
+	}
+
+	select {
+	case sa := <-s.warmPool:
+		if slices.Equal(sa.videoCodecs, videoCodecs) {
+			return sa, nil
+		}
+		// Enabled codecs changed since this was built.
+		s.log.Debug("discarding stale session api from warm pool")
+	default:
+	}
+
+	return s.newSessionAPI(videoCodecs, opusDTX, congestionControl)
+}
+
+// fillWarmPool keeps the warm pool full until doneCh is closed.
+func (s *Server) fillWarmPool(doneCh <-chan struct{}) {
+	for {
+		sa, err := s.newSessionAPI(s.GetEnabledVideoCodecs(), s.cfg.EnableOpusDTX, true)
+		if err != nil {
+			s.log.Error("failed to build session api for warm pool", mlog.Err(err))
+			select {
+			case <-time.After(warmPoolRetryInterval):
+				continue
+			case <-doneCh:
+				return
+			}
+		}
+
+		select {
+		case s.warmPool <- sa:
+		case <-doneCh:
+			return
+		}
+	}
+}
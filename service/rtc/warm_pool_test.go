@@ -0,0 +1,150 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rtc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattermost/rtcd/service/perf"
+	"github.com/mattermost/rtcd/service/random"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func setupWarmPoolServer(tb testing.TB, poolSize int) (*Server, func()) {
+	tb.Helper()
+
+	log, err := mlog.NewLogger()
+	require.NoError(tb, err)
+
+	metrics := perf.NewMetrics("rtcd", nil)
+	require.NotNil(tb, metrics)
+
+	cfg := ServerConfig{
+		ICEPortUDP:      30433,
+		ICEPortTCP:      30433,
+		UDPSocketsCount: GetDefaultUDPListeningSocketsCount(),
+		WarmPoolSize:    poolSize,
+	}
+
+	s, err := NewServer(cfg, log, metrics)
+	require.NoError(tb, err)
+
+	err = s.Start()
+	require.NoError(tb, err)
+
+	return s, func() {
+		err := s.Stop()
+		require.NoError(tb, err)
+		err = log.Shutdown()
+		require.NoError(tb, err)
+	}
+}
+
+func waitForWarmPool(tb testing.TB, s *Server) {
+	tb.Helper()
+	require.Eventually(tb, func() bool {
+		return len(s.warmPool) == cap(s.warmPool)
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestWarmPool(t *testing.T) {
+	s, shutdown := setupWarmPoolServer(t, 2)
+	defer shutdown()
+
+	initSession := func(t *testing.T) *session {
+		t.Helper()
+		cfg := SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err := s.InitSession(cfg, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			err := s.CloseSession(cfg.SessionID, CloseReasonLeft)
+			require.NoError(t, err)
+		})
+		return s.getGroup(cfg.GroupID).getCall(cfg.CallID).getSession(cfg.SessionID)
+	}
+
+	t.Run("per session state", func(t *testing.T) {
+		waitForWarmPool(t, s)
+
+		// Going past the pool size to also cover sessions built on demand.
+		var sessions []*session
+		for i := 0; i < 3; i++ {
+			sessions = append(sessions, initSession(t))
+		}
+
+		for i, us := range sessions {
+			require.NotNil(t, us.bwEstimator)
+			require.NotNil(t, us.rtcpCompound)
+			require.Equal(t, us.cfg.SessionID, us.rtcpCompound.cname)
+			for _, other := range sessions[i+1:] {
+				require.NotSame(t, us.rtcpCompound, other.rtcpCompound)
+				require.NotSame(t, us.bwEstimator, other.bwEstimator)
+				require.False(t, us.rtcConn.GetConfiguration().Certificates[0].Equals(other.rtcConn.GetConfiguration().Certificates[0]))
+			}
+		}
+
+		// The pool gets filled up again.
+		waitForWarmPool(t, s)
+	})
+
+	t.Run("codecs change", func(t *testing.T) {
+		waitForWarmPool(t, s)
+
+		err := s.SetEnabledVideoCodecs([]string{webrtc.MimeTypeVP8})
+		require.NoError(t, err)
+		defer func() {
+			err := s.SetEnabledVideoCodecs([]string{webrtc.MimeTypeAV1, webrtc.MimeTypeVP8})
+			require.NoError(t, err)
+		}()
+
+		// Stale entries built with the previous codecs are not used.
+		us := initSession(t)
+		us.mut.RLock()
+		require.Equal(t, []string{webrtc.MimeTypeVP8}, us.videoCodecs)
+		us.mut.RUnlock()
+	})
+}
+
+func BenchmarkInitSessionWarmPool(b *testing.B) {
+	for _, poolSize := range []int{0, 1} {
+		b.Run(fmt.Sprintf("poolSize=%d", poolSize), func(b *testing.B) {
+			s, shutdown := setupWarmPoolServer(b, poolSize)
+			defer shutdown()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				if poolSize > 0 {
+					waitForWarmPool(b, s)
+				}
+				cfg := SessionConfig{
+					GroupID:   "groupID",
+					CallID:    random.NewID(),
+					UserID:    random.NewID(),
+					SessionID: random.NewID(),
+				}
+				b.StartTimer()
+
+				err := s.InitSession(cfg, nil)
+				require.NoError(b, err)
+
+				b.StopTimer()
+				err = s.CloseSession(cfg.SessionID, CloseReasonLeft)
+				require.NoError(b, err)
+				b.StartTimer()
+			}
+		})
+	}
+}
@@ -4,17 +4,21 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 	"net/http/pprof"
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mattermost/rtcd/logger"
 	"github.com/mattermost/rtcd/service/api"
 	"github.com/mattermost/rtcd/service/auth"
 	"github.com/mattermost/rtcd/service/perf"
+	"github.com/mattermost/rtcd/service/random"
 	"github.com/mattermost/rtcd/service/rtc"
 	"github.com/mattermost/rtcd/service/store"
 	"github.com/mattermost/rtcd/service/ws"
@@ -37,6 +41,10 @@ type Service struct {
 	systemInfo   SystemInfo
 	log          *mlog.Logger
 	sessionCache *auth.SessionCache
+	callLogs     *callLogsStreamer
+	// instanceID uniquely identifies this process. It's advertised to clients
+	// so that they can detect a service restart upon reconnecting.
+	instanceID string
 	// connMap maps user sessions to the websocket connection they originated
 	// from. This is needed to keep track of the MM instance end users are
 	// connected to in order to route any message to it and avoid the additional
@@ -44,18 +52,39 @@ type Service struct {
 	connMap map[string]string
 	mut     sync.RWMutex
 	stopCh  chan struct{}
+	// registerMut serializes registrations so that MaxRegisteredClients
+	// can't be exceeded by concurrent requests.
+	registerMut sync.Mutex
+	// ready is set once the service has started and is accepting
+	// connections.
+	ready atomic.Bool
+
+	newAudioDecoder func() (rtc.AudioDecoder, error)
+	newAudioEncoder func() (rtc.AudioEncoder, error)
+	// audioRecordings maps the calls being recorded, keyed by group and call
+	// ID, to their recording.
+	audioRecordings    map[string]*audioRecording
+	audioRecordingsMut sync.Mutex
 }
 
-func New(cfg Config) (*Service, error) {
+func New(cfg Config, opts ...ServiceOption) (*Service, error) {
 	if err := cfg.IsValid(); err != nil {
 		return nil, err
 	}
 
 	s := &Service{
-		cfg:     cfg,
-		metrics: perf.NewMetrics("rtcd", nil),
-		connMap: map[string]string{},
-		stopCh:  make(chan struct{}),
+		cfg:             cfg,
+		metrics:         perf.NewMetrics("rtcd", nil),
+		connMap:         map[string]string{},
+		stopCh:          make(chan struct{}),
+		instanceID:      random.NewID(),
+		audioRecordings: map[string]*audioRecording{},
+	}
+
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, fmt.Errorf("failed to apply option: %w", err)
+		}
 	}
 
 	var err error
@@ -66,22 +95,13 @@ func New(cfg Config) (*Service, error) {
 
 	s.log.Info("rtcd: starting up", getVersionInfo().logFields()...)
 
-	// Mac does not have /proc/stat
-	if runtime.GOOS != "darwin" {
-		proc, err := procfs.NewDefaultFS()
-		if err != nil {
-			s.log.Error("failed to create proc file-system", mlog.Err(err))
-		}
-		s.proc = proc
-
-		go s.collectSystemInfo()
-	}
+	s.callLogs = newCallLogsStreamer(s.log, cfg.Logger)
 
 	s.store, err = store.New(cfg.Store.DataSource)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create store: %w", err)
 	}
-	s.log.Info("initiated data store", mlog.String("DataSource", cfg.Store.DataSource))
+	s.log.Info("initiated data store", mlog.String("DataSource", store.RedactDataSource(cfg.Store.DataSource)))
 
 	s.sessionCache, err = auth.NewSessionCache(cfg.API.Security.SessionCache)
 	if err != nil {
@@ -93,6 +113,7 @@ func New(cfg Config) (*Service, error) {
 		return nil, fmt.Errorf("failed to create auth service: %w", err)
 	}
 	s.log.Info("initiated auth service")
+	s.updateRegisteredClientsMetric()
 
 	s.apiServer, err = api.NewServer(cfg.API.HTTP, s.log)
 	if err != nil {
@@ -100,11 +121,14 @@ func New(cfg Config) (*Service, error) {
 	}
 
 	wsConfig := ws.ServerConfig{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		PingInterval:    10 * time.Second,
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		PingInterval:      wsPingInterval,
+		PongWait:          time.Duration(cfg.API.WebSocket.PongWaitSeconds) * time.Second,
+		MaxMessageSize:    int64(cfg.API.WebSocket.MaxMessageSizeKB) * 1024,
+		EnableCompression: cfg.API.WebSocket.EnableCompression,
 	}
-	s.wsServer, err = ws.NewServer(wsConfig, s.log, ws.WithAuthCb(s.authHandler))
+	s.wsServer, err = ws.NewServer(wsConfig, s.log, ws.WithAuthCb(s.authHandler), ws.WithMetrics(s.metrics))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ws server: %w", err)
 	}
@@ -114,11 +138,34 @@ func New(cfg Config) (*Service, error) {
 		return nil, fmt.Errorf("failed to create rtc server: %w", err)
 	}
 
+	// Mac does not have /proc/stat
+	if runtime.GOOS != "darwin" {
+		proc, err := procfs.NewDefaultFS()
+		if err != nil {
+			s.log.Error("failed to create proc file-system", mlog.Err(err))
+		}
+		s.proc = proc
+
+		// Started after the RTC server is created since CPU usage is fed to it.
+		go s.collectSystemInfo()
+	}
+
 	s.apiServer.RegisterHandleFunc("/version", s.getVersion)
+	s.apiServer.RegisterHandleFunc("/health", s.getHealth)
+	s.apiServer.RegisterHandleFunc("/ready", s.getReady)
 	s.apiServer.RegisterHandleFunc("/login", s.loginClient)
 	s.apiServer.RegisterHandleFunc("/register", s.registerClient)
 	s.apiServer.RegisterHandleFunc("/unregister", s.unregisterClient)
 	s.apiServer.RegisterHandler("/ws", s.wsServer)
+	s.apiServer.RegisterHandleFunc("/calls", s.adminHandler("getCalls", s.getCalls, http.MethodGet))
+	s.apiServer.RegisterHandleFunc("/calls/{id}/logs", s.adminHandler("streamCallLogs", s.streamCallLogs, http.MethodGet))
+	s.apiServer.RegisterHandleFunc("/calls/{id}/topology", s.adminHandler("getCallTopology", s.getCallTopology, http.MethodGet))
+	s.apiServer.RegisterHandleFunc("/calls/{id}/end", s.adminHandler("endCall", s.endCall, http.MethodPost))
+	s.apiServer.RegisterHandleFunc("/calls/{id}/drain", s.adminHandler("drainCall", s.drainCall, http.MethodPost))
+	s.apiServer.RegisterHandleFunc("/calls/{id}/simulcast_level", s.adminHandler("setCallSimulcastLevel", s.setCallSimulcastLevel, http.MethodPost))
+	s.apiServer.RegisterHandleFunc("/sessions/{id}/ice_stats", s.adminHandler("getSessionICEStats", s.getSessionICEStats, http.MethodGet))
+	s.apiServer.RegisterHandleFunc("/groups/{groupID}/calls/{callID}/sessions/{sessionID}/stats", s.authedHandler("getSessionStats", s.getSessionStats, http.MethodGet))
+	s.apiServer.RegisterHandleFunc("/codecs/video", s.adminHandler("handleVideoCodecs", s.handleVideoCodecs, http.MethodGet, http.MethodPost))
 
 	if runtime.GOOS != "darwin" {
 		s.apiServer.RegisterHandleFunc("/system", s.getSystemInfo)
@@ -161,8 +208,9 @@ func (s *Service) Start() error {
 				s.metrics.IncWSConnections(msg.ClientID)
 
 				data, err := NewPackedClientMessage(ClientMessageHello, map[string]string{
-					"clientID": msg.ClientID,
-					"connID":   msg.ConnID,
+					"clientID":   msg.ClientID,
+					"connID":     msg.ConnID,
+					"instanceID": s.instanceID,
 				})
 				if err != nil {
 					s.log.Error("failed to pack hello message", mlog.Err(err))
@@ -204,6 +252,8 @@ func (s *Service) Start() error {
 		}
 	}()
 
+	s.ready.Store(true)
+
 	return nil
 }
 
@@ -241,6 +291,16 @@ func (s *Service) handleRTCMsg(msg rtc.Message) error {
 		cm.Type = ClientMessageRTC
 	case rtc.VoiceOnMessage, rtc.VoiceOffMessage:
 		cm.Type = ClientMessageVAD
+	case rtc.ScreenRejectMessage:
+		cm.Type = ClientMessageScreen
+	case rtc.UnmuteRejectMessage:
+		cm.Type = ClientMessageMute
+	case rtc.StatsMessage:
+		cm.Type = ClientMessageStats
+	case rtc.TrackRejectMessage:
+		cm.Type = ClientMessageTrack
+	case rtc.ActiveSpeakerMessage, rtc.ActiveSpeakerClearedMessage:
+		cm.Type = ClientMessageActiveSpeaker
 	default:
 		return fmt.Errorf("unexpected rtc message type: %s", cm.Type)
 	}
@@ -297,13 +357,22 @@ func (s *Service) handleClientMsg(msg ws.Message) error {
 		}
 		cfg.GroupID = msg.ClientID
 
-		closeCb := func() error {
+		if s.isOverCapacity() {
+			s.log.Info("over capacity, redirecting session",
+				mlog.String("sessionID", cfg.SessionID),
+				mlog.String("url", s.cfg.API.Redirect.URL),
+			)
+			return s.sendRedirect(msg.ConnID, msg.ClientID, cfg.SessionID)
+		}
+
+		closeCb := func(reason rtc.CloseReason) error {
 			s.mut.Lock()
 			defer s.mut.Unlock()
 			delete(s.connMap, cfg.SessionID)
 
 			data, err := NewPackedClientMessage(ClientMessageClose, map[string]string{
 				"sessionID": cfg.SessionID,
+				"reason":    string(reason),
 			})
 			if err != nil {
 				return fmt.Errorf("failed to pack close message: %w", err)
@@ -318,7 +387,26 @@ func (s *Service) handleClientMsg(msg ws.Message) error {
 
 		s.log.Debug("join message", mlog.Any("sessionCfg", cfg))
 
-		if err := s.rtcServer.InitSession(cfg, closeCb); err != nil {
+		if err := s.rtcServer.InitSession(cfg, closeCb); errors.Is(err, rtc.ErrCallFull) {
+			s.log.Info("call is full, rejecting session",
+				mlog.String("sessionID", cfg.SessionID),
+				mlog.String("callID", cfg.CallID),
+			)
+			return s.sendJoinError(msg.ConnID, msg.ClientID, cfg.SessionID, ClientErrorCodeCallFull, err)
+		} else if errors.Is(err, rtc.ErrServerOverloaded) {
+			s.log.Warn("server is overloaded, rejecting session",
+				mlog.String("sessionID", cfg.SessionID),
+				mlog.String("callID", cfg.CallID),
+			)
+			return s.sendJoinError(msg.ConnID, msg.ClientID, cfg.SessionID, ClientErrorCodeServerOverloaded, err)
+		} else if errors.Is(err, rtc.ErrClientVersionTooOld) {
+			s.log.Info("client version is too old, rejecting session",
+				mlog.String("sessionID", cfg.SessionID),
+				mlog.String("callID", cfg.CallID),
+				mlog.String("version", cfg.Props.Version()),
+			)
+			return s.sendJoinError(msg.ConnID, msg.ClientID, cfg.SessionID, ClientErrorCodeClientVersionTooOld, err)
+		} else if err != nil {
 			return fmt.Errorf("failed to initialize rtc session: %w", err)
 		}
 
@@ -354,7 +442,7 @@ func (s *Service) handleClientMsg(msg ws.Message) error {
 		}
 
 		s.log.Debug("leave message", mlog.String("sessionID", sessionID))
-		if err := s.rtcServer.CloseSession(sessionID); err != nil {
+		if err := s.rtcServer.CloseSession(sessionID, rtc.CloseReasonLeft); err != nil {
 			return fmt.Errorf("failed to close session: %w", err)
 		}
 		return nil
@@ -365,6 +453,21 @@ func (s *Service) handleClientMsg(msg ws.Message) error {
 			return fmt.Errorf("unexpected data type: %T", cm.Data)
 		}
 		s.log.Debug("rtc message", mlog.String("sessionID", rtcMsg.SessionID), mlog.Int("type", int(rtcMsg.Type)))
+	case ClientMessageAudioRecordingStart, ClientMessageAudioRecordingStop:
+		data, ok := cm.Data.(map[string]string)
+		if !ok {
+			return fmt.Errorf("unexpected data type: %T", cm.Data)
+		}
+		callID := data["callID"]
+		if callID == "" {
+			return fmt.Errorf("missing callID in client message")
+		}
+
+		s.log.Debug("audio recording message", mlog.String("type", cm.Type), mlog.String("callID", callID))
+		if cm.Type == ClientMessageAudioRecordingStart {
+			return s.startAudioRecording(msg.ConnID, msg.ClientID, callID)
+		}
+		return s.stopAudioRecording(msg.ConnID, msg.ClientID, callID)
 	default:
 		return fmt.Errorf("unexpected client message type: %s", cm.Type)
 	}
@@ -390,3 +493,22 @@ func (s *Service) sendClientMessage(connID, clientID string, data []byte) error
 
 	return nil
 }
+
+// sendJoinError notifies the client that the given session failed to join
+// for a known reason (code) it can act upon.
+func (s *Service) sendJoinError(connID, clientID, sessionID, code string, joinErr error) error {
+	data, err := NewPackedClientMessage(ClientMessageError, map[string]string{
+		"sessionID": sessionID,
+		"code":      code,
+		"error":     joinErr.Error(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to pack error message: %w", err)
+	}
+
+	if err := s.sendClientMessage(connID, clientID, data); err != nil {
+		return fmt.Errorf("failed to send error message: %w", err)
+	}
+
+	return nil
+}
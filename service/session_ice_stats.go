@@ -0,0 +1,39 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mattermost/rtcd/service/rtc"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+// getSessionICEStats returns the ICE connectivity stats for the given session,
+// useful to diagnose slow or failed connections. Admin only.
+func (s *Service) getSessionICEStats(w http.ResponseWriter, r *http.Request, _ string, data *httpData) {
+	sessionID := r.PathValue("id")
+	data.reqData["sessionID"] = sessionID
+
+	stats, err := s.rtcServer.GetSessionICEStats(sessionID)
+	if errors.Is(err, rtc.ErrSessionNotFound) {
+		data.err = err.Error()
+		data.code = http.StatusNotFound
+		return
+	} else if err != nil {
+		data.err = err.Error()
+		data.code = http.StatusInternalServerError
+		return
+	}
+
+	data.code = http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&stats); err != nil {
+		s.log.Error("failed to encode data", mlog.Err(err))
+	}
+}
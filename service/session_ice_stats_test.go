@@ -0,0 +1,70 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSessionICEStats(t *testing.T) {
+	th := SetupTestHelper(t, nil)
+	defer th.Teardown()
+
+	t.Run("unauthorized", func(t *testing.T) {
+		req, err := http.NewRequest("GET", th.apiURL+"/sessions/sessionA/ice_stats", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("", "invalid")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		req, err := http.NewRequest("GET", th.apiURL+"/sessions/sessionA/ice_stats", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("", th.srvc.cfg.API.Security.AdminSecretKey)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		cfg := rtc.SessionConfig{
+			GroupID:   random.NewID(),
+			CallID:    random.NewID(),
+			UserID:    random.NewID(),
+			SessionID: random.NewID(),
+		}
+		err := th.srvc.rtcServer.InitSession(cfg, nil)
+		require.NoError(t, err)
+		defer func() {
+			err := th.srvc.rtcServer.CloseSession(cfg.SessionID, rtc.CloseReasonLeft)
+			require.NoError(t, err)
+		}()
+
+		req, err := http.NewRequest("GET", th.apiURL+"/sessions/"+cfg.SessionID+"/ice_stats", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("", th.srvc.cfg.API.Security.AdminSecretKey)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var stats rtc.SessionICEStats
+		err = json.NewDecoder(resp.Body).Decode(&stats)
+		require.NoError(t, err)
+		require.Equal(t, cfg.SessionID, stats.SessionID)
+		require.NotEmpty(t, stats.ICEState)
+		require.Nil(t, stats.NominatedPair)
+	})
+}
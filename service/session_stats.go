@@ -0,0 +1,50 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mattermost/rtcd/service/rtc"
+
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+)
+
+// getSessionStats returns live media statistics for the given session.
+// Clients can only access sessions belonging to their own group.
+func (s *Service) getSessionStats(w http.ResponseWriter, r *http.Request, clientID string, data *httpData) {
+	groupID := r.PathValue("groupID")
+	callID := r.PathValue("callID")
+	sessionID := r.PathValue("sessionID")
+	data.reqData["groupID"] = groupID
+	data.reqData["callID"] = callID
+	data.reqData["sessionID"] = sessionID
+
+	// An empty clientID means admin.
+	if clientID != "" && clientID != groupID {
+		data.err = "forbidden"
+		data.code = http.StatusForbidden
+		return
+	}
+
+	stats, err := s.rtcServer.GetSessionStats(groupID, callID, sessionID)
+	if errors.Is(err, rtc.ErrSessionNotFound) {
+		data.err = err.Error()
+		data.code = http.StatusNotFound
+		return
+	} else if err != nil {
+		data.err = err.Error()
+		data.code = http.StatusInternalServerError
+		return
+	}
+
+	data.code = http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&stats); err != nil {
+		s.log.Error("failed to encode data", mlog.Err(err))
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package service
+
+import (
+	"testing"
+
+	"github.com/mattermost/rtcd/service/auth"
+	"github.com/mattermost/rtcd/service/random"
+	"github.com/mattermost/rtcd/service/rtc"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientGetSessionStats(t *testing.T) {
+	th := SetupTestHelper(t, nil)
+	defer th.Teardown()
+
+	adminClient, err := NewClient(ClientConfig{
+		URL:     th.apiURL,
+		AuthKey: th.srvc.cfg.API.Security.AdminSecretKey,
+	})
+	require.NoError(t, err)
+	defer adminClient.Close()
+
+	authKey, err := random.NewSecureString(auth.MinKeyLen)
+	require.NoError(t, err)
+	err = adminClient.Register("clientA", authKey)
+	require.NoError(t, err)
+
+	c, err := NewClient(ClientConfig{
+		URL:      th.apiURL,
+		ClientID: "clientA",
+		AuthKey:  authKey,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	cfg := rtc.SessionConfig{
+		GroupID:   "clientA",
+		CallID:    random.NewID(),
+		UserID:    random.NewID(),
+		SessionID: random.NewID(),
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		c, err := NewClient(ClientConfig{
+			URL:      th.apiURL,
+			ClientID: "clientA",
+			AuthKey:  "invalid",
+		})
+		require.NoError(t, err)
+		defer c.Close()
+
+		_, err = c.GetSessionStats(cfg.GroupID, cfg.CallID, cfg.SessionID)
+		require.EqualError(t, err, "request failed with status 401 Unauthorized")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := c.GetSessionStats(cfg.GroupID, cfg.CallID, cfg.SessionID)
+		require.ErrorIs(t, err, rtc.ErrSessionNotFound)
+	})
+
+	err = th.srvc.rtcServer.InitSession(cfg, nil)
+	require.NoError(t, err)
+	defer func() {
+		err := th.srvc.rtcServer.CloseSession(cfg.SessionID, rtc.CloseReasonLeft)
+		require.NoError(t, err)
+	}()
+
+	t.Run("forbidden", func(t *testing.T) {
+		_, err := c.GetSessionStats("clientB", cfg.CallID, cfg.SessionID)
+		require.EqualError(t, err, "request failed with status 403 Forbidden")
+	})
+
+	t.Run("success", func(t *testing.T) {
+		stats, err := c.GetSessionStats(cfg.GroupID, cfg.CallID, cfg.SessionID)
+		require.NoError(t, err)
+		require.Equal(t, cfg.SessionID, stats.SessionID)
+		require.Equal(t, cfg.UserID, stats.UserID)
+		require.Zero(t, stats.PacketsReceived)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		stats, err := adminClient.GetSessionStats(cfg.GroupID, cfg.CallID, cfg.SessionID)
+		require.NoError(t, err)
+		require.Equal(t, cfg.SessionID, stats.SessionID)
+	})
+}
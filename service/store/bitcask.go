@@ -110,6 +110,13 @@ func (s *bitcaskStore) Delete(key string) error {
 	return nil
 }
 
+func (s *bitcaskStore) Count() (int, error) {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+
+	return s.db.Len(), nil
+}
+
 func (s *bitcaskStore) Close() error {
 	s.mut.Lock()
 	defer s.mut.Unlock()
@@ -18,9 +18,25 @@ type Store interface {
 	Set(key, value string) error
 	Get(key string) (string, error)
 	Delete(key string) error
+	Count() (int, error)
 	Close() error
 }
 
+// ChangeNotifier is implemented by stores that can be shared by multiple
+// instances of the service, letting them know about entries changed by
+// others (e.g. to invalidate any data cached from them).
+type ChangeNotifier interface {
+	// OnChange registers a callback to be invoked with the key of any entry
+	// that gets updated or deleted.
+	OnChange(cb func(key string)) error
+}
+
+// New returns a Store for the given data source. Data sources with a redis://
+// or rediss:// scheme are backed by Redis so that the data can be shared by
+// multiple instances. Anything else is treated as a path to a local database.
 func New(dataSource string) (Store, error) {
+	if isRedisDataSource(dataSource) {
+		return newRedisStore(dataSource)
+	}
 	return newBitcaskStore(dataSource)
 }
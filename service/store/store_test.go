@@ -170,3 +170,34 @@ func TestDelete(t *testing.T) {
 		require.Empty(t, val)
 	})
 }
+
+func TestCount(t *testing.T) {
+	dbDir, err := os.MkdirTemp("", "db")
+	require.NoError(t, err)
+	defer os.RemoveAll(dbDir)
+
+	store, err := New(dbDir)
+	require.NoError(t, err)
+	require.NotNil(t, store)
+	defer store.Close()
+
+	count, err := store.Count()
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	err = store.Set("keyA", "value")
+	require.NoError(t, err)
+	err = store.Set("keyB", "value")
+	require.NoError(t, err)
+
+	count, err = store.Count()
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	err = store.Delete("keyA")
+	require.NoError(t, err)
+
+	count, err = store.Count()
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
@@ -5,6 +5,7 @@ package service
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
 	"time"
 
@@ -40,6 +41,7 @@ func (s *Service) collectSystemInfo() {
 				s.mut.Lock()
 				s.systemInfo.CPULoad = 1 / (idleDiff / currTime.Sub(prevTime).Seconds())
 				s.mut.Unlock()
+				s.rtcServer.SetCPUUsage(getCPUUsage(prevStat.CPUTotal, currStat.CPUTotal))
 			}
 
 			prevStat = currStat
@@ -50,6 +52,22 @@ func (s *Service) collectSystemInfo() {
 	}
 }
 
+// getCPUUsage returns the fraction, in the [0, 1] range, of CPU time spent
+// not idling between two samples.
+func getCPUUsage(prev, curr procfs.CPUStat) float64 {
+	total := func(st procfs.CPUStat) float64 {
+		return st.User + st.Nice + st.System + st.Idle + st.Iowait + st.IRQ + st.SoftIRQ + st.Steal
+	}
+
+	totalDiff := total(curr) - total(prev)
+	if totalDiff <= 0 {
+		return 0
+	}
+	idleDiff := (curr.Idle + curr.Iowait) - (prev.Idle + prev.Iowait)
+
+	return math.Max(0, math.Min(1, 1-idleDiff/totalDiff))
+}
+
 func (s *Service) getSystemInfo(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
 		http.NotFound(w, req)
@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/procfs"
 	"github.com/stretchr/testify/require"
 )
 
@@ -36,3 +37,26 @@ func TestGetSystem(t *testing.T) {
 		require.NotZero(t, info.CPULoad)
 	})
 }
+
+func TestGetCPUUsage(t *testing.T) {
+	prev := procfs.CPUStat{User: 100, System: 50, Idle: 800, Iowait: 50}
+
+	t.Run("no elapsed time", func(t *testing.T) {
+		require.Zero(t, getCPUUsage(prev, prev))
+	})
+
+	t.Run("idle", func(t *testing.T) {
+		curr := prev
+		curr.Idle += 10
+		require.Zero(t, getCPUUsage(prev, curr))
+	})
+
+	t.Run("busy", func(t *testing.T) {
+		curr := prev
+		curr.User += 6
+		curr.System += 2
+		curr.Idle += 1
+		curr.Iowait += 1
+		require.InDelta(t, 0.8, getCPUUsage(prev, curr), 0.0001)
+	})
+}
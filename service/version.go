@@ -24,6 +24,7 @@ type VersionInfo struct {
 	GoVersion    string `json:"goVersion"`
 	GoOS         string `json:"goOS"`
 	GoArch       string `json:"goArch"`
+	InstanceID   string `json:"instanceID,omitempty"`
 }
 
 func getVersionInfo() VersionInfo {
@@ -55,7 +56,9 @@ func (s *Service) getVersion(w http.ResponseWriter, req *http.Request) {
 	}
 
 	w.Header().Add("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(getVersionInfo()); err != nil {
+	info := getVersionInfo()
+	info.InstanceID = s.instanceID
+	if err := json.NewEncoder(w).Encode(info); err != nil {
 		s.log.Error("failed to encode data", mlog.Err(err))
 	}
 }
@@ -46,6 +46,7 @@ func TestGetVersion(t *testing.T) {
 			GoVersion:    goVersion,
 			GoOS:         runtime.GOOS,
 			GoArch:       runtime.GOARCH,
+			InstanceID:   th.srvc.instanceID,
 		}, info)
 	})
 
@@ -59,9 +60,10 @@ func TestGetVersion(t *testing.T) {
 		err = json.NewDecoder(resp.Body).Decode(&info)
 		require.NoError(t, err)
 		require.Equal(t, VersionInfo{
-			GoVersion: goVersion,
-			GoOS:      runtime.GOOS,
-			GoArch:    runtime.GOARCH,
+			GoVersion:  goVersion,
+			GoOS:       runtime.GOOS,
+			GoArch:     runtime.GOARCH,
+			InstanceID: th.srvc.instanceID,
 		}, info)
 	})
 }
@@ -70,6 +70,7 @@ func NewClient(cfg ClientConfig, opts ...ClientOption) (*Client, error) {
 	}
 
 	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = cfg.EnableCompression
 	if c.dialFn != nil {
 		dialer.NetDialContext = c.dialFn
 	}
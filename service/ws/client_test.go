@@ -11,9 +11,12 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/mattermost/rtcd/service/random"
 
+	"github.com/gorilla/websocket"
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
 	"github.com/stretchr/testify/require"
 )
 
@@ -215,3 +218,102 @@ func TestMultipleClose(t *testing.T) {
 	err = c.Close()
 	require.Error(t, err)
 }
+
+func TestClientCompression(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	cfg := ServerConfig{
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		PingInterval:      time.Second,
+		EnableCompression: true,
+	}
+	server, err := NewServer(cfg, log)
+	require.NoError(t, err)
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		_ = http.Serve(listener, server)
+	}()
+
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	u := url.URL{Scheme: "ws", Host: "localhost:" + port, Path: "/ws"}
+
+	t.Run("negotiated", func(t *testing.T) {
+		dialer := *websocket.DefaultDialer
+		dialer.EnableCompression = true
+		c, resp, err := dialer.Dial(u.String(), nil)
+		require.NoError(t, err)
+		defer c.Close()
+		require.Contains(t, resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+
+		msg := <-server.ReceiveCh()
+		require.Equal(t, OpenMessage, msg.Type)
+		err = c.Close()
+		require.NoError(t, err)
+		msg = <-server.ReceiveCh()
+		require.Equal(t, CloseMessage, msg.Type)
+	})
+
+	t.Run("not forced", func(t *testing.T) {
+		c, resp, err := websocket.DefaultDialer.Dial(u.String(), nil)
+		require.NoError(t, err)
+		defer c.Close()
+		require.Empty(t, resp.Header.Get("Sec-Websocket-Extensions"))
+
+		msg := <-server.ReceiveCh()
+		require.Equal(t, OpenMessage, msg.Type)
+		err = c.Close()
+		require.NoError(t, err)
+		msg = <-server.ReceiveCh()
+		require.Equal(t, CloseMessage, msg.Type)
+	})
+
+	t.Run("large message round trip", func(t *testing.T) {
+		c, err := NewClient(ClientConfig{
+			URL:               u.String(),
+			AuthType:          BasicClientAuthType,
+			EnableCompression: true,
+		})
+		require.NoError(t, err)
+		defer c.Close()
+
+		msg := <-server.ReceiveCh()
+		require.Equal(t, OpenMessage, msg.Type)
+		connID := msg.ConnID
+
+		// Mimicking an SDP payload, which compresses well, followed by some
+		// random data.
+		data := []byte(strings.Repeat("a=candidate:1 1 udp 2130706431 192.168.1.1 8443 typ host\r\n", 4096))
+		data = append(data, random.NewID()...)
+
+		err = c.Send(BinaryMessage, data)
+		require.NoError(t, err)
+		msg = <-server.ReceiveCh()
+		require.Equal(t, BinaryMessage, msg.Type)
+		require.Equal(t, data, msg.Data)
+
+		err = server.Send(Message{
+			ConnID: connID,
+			Type:   BinaryMessage,
+			Data:   data,
+		})
+		require.NoError(t, err)
+		select {
+		case msg = <-c.ReceiveCh():
+			require.Equal(t, BinaryMessage, msg.Type)
+			require.Equal(t, data, msg.Data)
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "timed out waiting for message")
+		}
+	})
+}
@@ -17,9 +17,36 @@ type ServerConfig struct {
 	// used to wirte to a ws connection.
 	WriteBufferSize int
 	// PingInterval specifies the interval at which the server should send ping
-	// messages to its connections. If the client doesn't respond in 2*PingInterval
-	// the server will consider the client as disconnected and drop the connection.
+	// messages to its connections.
 	PingInterval time.Duration
+	// PongWait specifies how long the server should wait for a pong response
+	// before considering the client as disconnected and dropping the connection.
+	// This is what allows to detect half-open connections (e.g. a client whose
+	// network went away without sending a close frame). If zero, it defaults
+	// to 2*PingInterval.
+	PongWait time.Duration
+	// MaxMessageSize specifies the maximum size, in bytes, of a message read
+	// from a ws connection, after decompression if enabled. Connections
+	// sending larger messages are closed. If zero, it defaults to 1MB.
+	MaxMessageSize int64
+	// EnableCompression specifies whether the server should negotiate
+	// per-message compression (RFC 7692) with clients asking for it.
+	// Connections from clients that don't are left uncompressed.
+	EnableCompression bool
+}
+
+func (c ServerConfig) getPongWait() time.Duration {
+	if c.PongWait == 0 {
+		return 2 * c.PingInterval
+	}
+	return c.PongWait
+}
+
+func (c ServerConfig) getMaxMessageSize() int64 {
+	if c.MaxMessageSize == 0 {
+		return connMaxReadBytes
+	}
+	return c.MaxMessageSize
 }
 
 func (c ServerConfig) IsValid() error {
@@ -32,6 +59,12 @@ func (c ServerConfig) IsValid() error {
 	if c.PingInterval < time.Second {
 		return fmt.Errorf("invalid PingInterval value: should be at least 1 second")
 	}
+	if c.PongWait != 0 && c.PongWait <= c.PingInterval {
+		return fmt.Errorf("invalid PongWait value: should be greater than PingInterval")
+	}
+	if c.MaxMessageSize < 0 {
+		return fmt.Errorf("invalid MaxMessageSize value: should not be negative")
+	}
 
 	return nil
 }
@@ -55,6 +88,10 @@ type ClientConfig struct {
 	AuthToken string
 	// AuthType specifies the type of HTTP authentication to use when connecting.
 	AuthType ClientAuthType
+	// EnableCompression specifies whether the client should ask the server to
+	// negotiate per-message compression (RFC 7692). Messages are sent
+	// uncompressed if the server doesn't support it.
+	EnableCompression bool
 }
 
 func (c ClientConfig) IsValid() error {
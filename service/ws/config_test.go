@@ -37,6 +37,28 @@ func TestServerConfigIsValid(t *testing.T) {
 		require.Equal(t, "invalid PingInterval value: should be at least 1 second", err.Error())
 	})
 
+	t.Run("invalid PongWait", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ReadBufferSize = 1024
+		cfg.WriteBufferSize = 1024
+		cfg.PingInterval = 2 * time.Second
+		cfg.PongWait = time.Second
+		err := cfg.IsValid()
+		require.Error(t, err)
+		require.Equal(t, "invalid PongWait value: should be greater than PingInterval", err.Error())
+	})
+
+	t.Run("invalid MaxMessageSize", func(t *testing.T) {
+		var cfg ServerConfig
+		cfg.ReadBufferSize = 1024
+		cfg.WriteBufferSize = 1024
+		cfg.PingInterval = time.Second
+		cfg.MaxMessageSize = -1
+		err := cfg.IsValid()
+		require.Error(t, err)
+		require.Equal(t, "invalid MaxMessageSize value: should not be negative", err.Error())
+	})
+
 	t.Run("valid", func(t *testing.T) {
 		var cfg ServerConfig
 		cfg.ReadBufferSize = 1024
@@ -44,6 +66,10 @@ func TestServerConfigIsValid(t *testing.T) {
 		cfg.PingInterval = 1 * time.Second
 		err := cfg.IsValid()
 		require.NoError(t, err)
+
+		cfg.PongWait = 3 * time.Second
+		err = cfg.IsValid()
+		require.NoError(t, err)
 	})
 }
 
@@ -0,0 +1,8 @@
+// Copyright (c) 2022-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package ws
+
+type Metrics interface {
+	IncWSErrors(clientID, errType string)
+}
@@ -22,6 +22,15 @@ func WithAuthCb(cb AuthCb) ServerOption {
 	}
 }
 
+// WithMetrics lets the caller set an optional metrics implementation to
+// record connection errors.
+func WithMetrics(m Metrics) ServerOption {
+	return func(s *Server) error {
+		s.metrics = m
+		return nil
+	}
+}
+
 // WithDialFunc lets the caller set an optional dialing function to setup the
 // TCP connection needed by the client.
 func WithDialFunc(dialFn DialContextFn) ClientOption {
@@ -4,7 +4,9 @@
 package ws
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"sync"
 	"time"
@@ -28,6 +30,7 @@ type Server struct {
 	log       mlog.LoggerIFace
 	conns     map[string]*conn
 	authCb    AuthCb
+	metrics   Metrics
 	mut       sync.RWMutex
 	sendCh    chan Message
 	receiveCh chan Message
@@ -126,10 +129,13 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	upgrader := websocket.Upgrader{
-		ReadBufferSize:  s.cfg.ReadBufferSize,
-		WriteBufferSize: s.cfg.WriteBufferSize,
+		ReadBufferSize:    s.cfg.ReadBufferSize,
+		WriteBufferSize:   s.cfg.WriteBufferSize,
+		EnableCompression: s.cfg.EnableCompression,
 	}
-	ws, err := upgrader.Upgrade(w, r, nil)
+	// Passing along any header already set (e.g. load balancer affinity
+	// hints) since the upgrade response is written directly to the connection.
+	ws, err := upgrader.Upgrade(w, r, w.Header())
 	if err != nil {
 		s.log.Error("failed to upgrade connection", mlog.Err(err))
 		sendCloseMsg(clientID)
@@ -150,18 +156,29 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer s.removeConn(conn.id)
 	defer sendCloseMsg(clientID)
 
-	ws.SetReadLimit(connMaxReadBytes)
-	if err := ws.SetReadDeadline(time.Now().Add(2 * s.cfg.PingInterval)); err != nil {
+	ws.SetReadLimit(s.cfg.getMaxMessageSize())
+	// The read deadline only gets extended upon receiving a pong so that
+	// half-open connections are detected and dropped in a timely manner.
+	pongWait := s.cfg.getPongWait()
+	if err := ws.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
 		s.log.Error("failed to set read deadline", mlog.Err(err))
 		return
 	}
 	ws.SetPongHandler(func(_ string) error {
-		return ws.SetReadDeadline(time.Now().Add(2 * s.cfg.PingInterval))
+		return ws.SetReadDeadline(time.Now().Add(pongWait))
 	})
 
 	for {
-		mt, data, err := ws.ReadMessage()
-		if err != nil {
+		mt, data, err := readMessage(ws, s.cfg.getMaxMessageSize())
+		if errors.Is(err, websocket.ErrReadLimit) {
+			// The connection gets closed as the message can't be recovered from.
+			s.log.Warn("ws message too large, closing connection",
+				mlog.String("connID", connID), mlog.String("clientID", conn.clientID))
+			if s.metrics != nil {
+				s.metrics.IncWSErrors(conn.clientID, "message_too_large")
+			}
+			break
+		} else if err != nil {
 			s.log.Error("ws read failed", mlog.Err(err))
 			break
 		}
@@ -186,6 +203,28 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// readMessage reads the next message from the connection. The read limit set
+// on the connection applies to the bytes on the wire, so when compression is
+// negotiated the decompressed message is limited as well to prevent a small
+// payload from inflating to an arbitrary size.
+func readMessage(ws *websocket.Conn, limit int64) (int, []byte, error) {
+	mt, rd, err := ws.NextReader()
+	if err != nil {
+		return mt, nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(rd, limit+1))
+	if err != nil {
+		return mt, nil, err
+	}
+
+	if int64(len(data)) > limit {
+		return mt, nil, websocket.ErrReadLimit
+	}
+
+	return mt, data, nil
+}
+
 func (s *Server) connWriter() {
 	pingTicker := time.NewTicker(s.cfg.PingInterval)
 	defer pingTicker.Stop()
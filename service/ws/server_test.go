@@ -117,8 +117,11 @@ func TestNewServer(t *testing.T) {
 func TestServeHTTP(t *testing.T) {
 	upgradeRan := false
 
-	authCb := func(_ http.ResponseWriter, _ *http.Request) (string, int, error) {
+	// Headers set before upgrading (e.g. by middlewares) should be part of
+	// the upgrade response.
+	authCb := func(w http.ResponseWriter, _ *http.Request) (string, int, error) {
 		upgradeRan = true
+		w.Header().Set("X-Rtcd-Node", "rtcd-1")
 		return "", 0, nil
 	}
 
@@ -129,11 +132,12 @@ func TestServeHTTP(t *testing.T) {
 	require.NoError(t, err)
 
 	u := url.URL{Scheme: "ws", Host: "localhost:" + port, Path: "/ws"}
-	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	c, resp, err := websocket.DefaultDialer.Dial(u.String(), nil)
 	require.NoError(t, err)
 	defer c.Close()
 
 	require.True(t, upgradeRan)
+	require.Equal(t, "rtcd-1", resp.Header.Get("X-Rtcd-Node"))
 
 	err = c.WriteMessage(websocket.TextMessage, []byte("some data"))
 	require.NoError(t, err)
@@ -511,3 +515,211 @@ func TestRaceSendClose(t *testing.T) {
 
 	require.EqualError(t, s.Send(Message{}), "server is closed")
 }
+
+func TestHalfOpenConnCleanup(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	cfg := ServerConfig{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		PingInterval:    time.Second,
+		PongWait:        1500 * time.Millisecond,
+	}
+	s, err := NewServer(cfg, log)
+	require.NoError(t, err)
+	defer s.Close()
+
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		_ = http.Serve(listener, s)
+	}()
+
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	u := url.URL{Scheme: "ws", Host: "localhost:" + port, Path: "/ws"}
+
+	// The client never reads from the connection, meaning pings are never
+	// responded to, simulating a half-open connection.
+	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	openMsg := <-s.ReceiveCh()
+	require.Equal(t, OpenMessage, openMsg.Type)
+	require.NotNil(t, s.getConn(openMsg.ConnID))
+
+	start := time.Now()
+	select {
+	case closeMsg := <-s.ReceiveCh():
+		require.Equal(t, CloseMessage, closeMsg.Type)
+		require.Equal(t, openMsg.ConnID, closeMsg.ConnID)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "timed out waiting for close message")
+	}
+	require.Less(t, time.Since(start), 3*time.Second)
+
+	require.Eventually(t, func() bool {
+		return s.getConn(openMsg.ConnID) == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+type testMetrics struct {
+	mut    sync.Mutex
+	errors map[string]int
+}
+
+func (m *testMetrics) IncWSErrors(clientID, errType string) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.errors[clientID+":"+errType]++
+}
+
+func (m *testMetrics) getErrors(clientID, errType string) int {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	return m.errors[clientID+":"+errType]
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	cfg := ServerConfig{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		PingInterval:    time.Second,
+		MaxMessageSize:  1024,
+	}
+	metrics := &testMetrics{errors: map[string]int{}}
+	authCb := func(_ http.ResponseWriter, _ *http.Request) (string, int, error) {
+		return "clientA", 0, nil
+	}
+	s, err := NewServer(cfg, log, WithMetrics(metrics), WithAuthCb(authCb))
+	require.NoError(t, err)
+	defer s.Close()
+
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		_ = http.Serve(listener, s)
+	}()
+
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	u := url.URL{Scheme: "ws", Host: "localhost:" + port, Path: "/ws"}
+
+	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	openMsg := <-s.ReceiveCh()
+	require.Equal(t, OpenMessage, openMsg.Type)
+
+	// Messages within the limit go through.
+	err = c.WriteMessage(websocket.BinaryMessage, make([]byte, 1024))
+	require.NoError(t, err)
+	msg := <-s.ReceiveCh()
+	require.Equal(t, BinaryMessage, msg.Type)
+	require.Len(t, msg.Data, 1024)
+
+	// Larger ones cause the connection to be closed.
+	err = c.WriteMessage(websocket.BinaryMessage, make([]byte, 1025))
+	require.NoError(t, err)
+
+	select {
+	case closeMsg := <-s.ReceiveCh():
+		require.Equal(t, CloseMessage, closeMsg.Type)
+		require.Equal(t, openMsg.ConnID, closeMsg.ConnID)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "timed out waiting for close message")
+	}
+
+	// The client may see either the close frame or the connection reset,
+	// depending on timing.
+	_, _, err = c.ReadMessage()
+	require.Error(t, err)
+
+	require.Equal(t, 1, metrics.getErrors("clientA", "message_too_large"))
+	require.Eventually(t, func() bool {
+		return s.getConn(openMsg.ConnID) == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMaxMessageSizeCompressed(t *testing.T) {
+	log, err := mlog.NewLogger()
+	require.NoError(t, err)
+	defer func() {
+		err := log.Shutdown()
+		require.NoError(t, err)
+	}()
+
+	cfg := ServerConfig{
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		PingInterval:      time.Second,
+		MaxMessageSize:    4096,
+		EnableCompression: true,
+	}
+	metrics := &testMetrics{errors: map[string]int{}}
+	authCb := func(_ http.ResponseWriter, _ *http.Request) (string, int, error) {
+		return "clientA", 0, nil
+	}
+	s, err := NewServer(cfg, log, WithMetrics(metrics), WithAuthCb(authCb))
+	require.NoError(t, err)
+	defer s.Close()
+
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		_ = http.Serve(listener, s)
+	}()
+
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	u := url.URL{Scheme: "ws", Host: "localhost:" + port, Path: "/ws"}
+
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = true
+	c, resp, err := dialer.Dial(u.String(), nil)
+	require.NoError(t, err)
+	defer c.Close()
+	require.Contains(t, resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+
+	openMsg := <-s.ReceiveCh()
+	require.Equal(t, OpenMessage, openMsg.Type)
+
+	// Messages within the limit go through.
+	err = c.WriteMessage(websocket.BinaryMessage, make([]byte, 4096))
+	require.NoError(t, err)
+	msg := <-s.ReceiveCh()
+	require.Equal(t, BinaryMessage, msg.Type)
+	require.Len(t, msg.Data, 4096)
+
+	// A message compressing well below the limit but exceeding it once
+	// decompressed causes the connection to be closed.
+	err = c.WriteMessage(websocket.BinaryMessage, make([]byte, 1024*1024))
+	require.NoError(t, err)
+
+	select {
+	case closeMsg := <-s.ReceiveCh():
+		require.Equal(t, CloseMessage, closeMsg.Type)
+		require.Equal(t, openMsg.ConnID, closeMsg.ConnID)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "timed out waiting for close message")
+	}
+
+	require.Equal(t, 1, metrics.getErrors("clientA", "message_too_large"))
+}